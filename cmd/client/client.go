@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"flag"
 	"fmt"
@@ -11,30 +13,80 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"fenrir/internal/common"
 	fenrirNet "fenrir/internal/net"
 )
 
-// reportFixedHeaderLen matches the server's expectation:
-// 1+1+1+8+8+8+2+4+4+16 = 53 bytes.
-const reportFixedHeaderLen = 53
+// How often an otherwise quiet client tells the server it is still there.
+const heartbeatInterval = 5 * time.Second
 
 func main() {
 	// 1. CLI Parameter Parsing
 	serverAddr := flag.String("server", "127.0.0.1:9001", "Address of the exchange server")
+	feedAddr := flag.String("feed", "127.0.0.1:9002", "Address of the exchange market data feed")
 	owner := flag.String("owner", "", "Owner username (compulsory)")
-	action := flag.String("action", "place", "Action to perform: ['place', 'cancel', 'log']")
+	secret := flag.String("secret", "", "Owner API secret logons are signed with")
+	action := flag.String("action", "place", "Action to perform: ['place', 'group', 'batch', 'cancel', 'rfq', 'bbo', 'depth', 'candles', 'status', 'feed', 'levels', 'quotes', 'tape', 'analytics', 'dropcopy', 'admincancel', 'setstatus', 'killswitch', 'settle', 'phase', 'register', 'journal', 'ping', 'log']")
 
 	// Order Parameters
 	ticker := flag.String("ticker", "AAPL", "Ticker symbol (max 4 chars)")
 	sideStr := flag.String("side", "buy", "Order side: 'buy' or 'sell'")
 	typeStr := flag.String("type", "limit", "Order type: 'limit' or 'market'")
+	tifStr := flag.String("tif", "day", "Time in force: 'day' or 'gtc'")
 	price := flag.Float64("price", 100.0, "Limit price")
 	qtyStr := flag.String("qty", "10", "Quantity or comma-separated list (e.g. 10,20,50)")
+	qtyScale := flag.Uint("qtyscale", 0, "Decimal places of the instrument's quantity lot (e.g. 8 for 0.00000001)")
+	legs := flag.String("legs", "", "Comma-separated orders to place together for 'group' or 'batch', each TICKER:side:price:qty (e.g. AAPL:buy:100:10,MSFT:sell:300:5)")
+	groupID := flag.Uint64("groupid", 0, "Id of the order group for 'group' (0 picks one from the clock)")
+	clOrdID := flag.Uint64("clordid", 0, "Client order id of the first order placed, counting up for each in -qty (0 picks one from the clock), or of the order to cancel")
+
+	// Market Data Parameters
+	depth := flag.Uint("depth", fenrirNet.DefaultSnapshotDepth, "Number of price levels per side for 'depth'")
+	interval := flag.Duration("interval", time.Minute, "Interval of each candle for 'candles', a whole number of minutes")
+	since := flag.Duration("since", time.Hour, "How far back to fetch candles from for 'candles'")
+
+	// Drop Copy Parameters
+	symbols := flag.String("symbols", "", "Comma-separated symbols to filter drop copies to")
+	participants := flag.String("participants", "", "Comma-separated participants to filter drop copies to")
+
+	// Ping Parameters
+	count := flag.Uint("count", 5, "Number of pings to send for 'ping'")
 
 	// Cancel Parameters
-	uuid := flag.String("uuid", "", "UUID of the order to cancel")
+	uuid := flag.String("uuid", "", "UUID of the order to cancel, cancels by -clordid if empty, or comma-separated UUIDs to cancel for 'batch'")
+	reason := flag.Uint("reason", uint(common.AdminCancelled), "Admin cancel reason code (1: unspecified, 2: erroneous, 3: risk, 4: regulatory)")
+
+	// Session Parameters
+	limit := flag.Uint("limit", 50, "Number of the latest messages to fetch for 'journal', 0 for all kept, or of candles to fetch for 'candles'")
+	resendFrom := flag.Uint64("resendfrom", 0, "Ask for the session's reports to be resent from this sequence number after logging on, e.g. after reconnecting")
+	batchBytes := flag.Uint("batchbytes", 0, "Ask for reports to be batched into writes of up to this many bytes (0 for reports as they are sent)")
+	batchDelay := flag.Duration("batchdelay", time.Millisecond, "Longest a report may be held back to be batched, with -batchbytes")
+	useTLS := flag.Bool("tls", false, "Connect to the server over TLS")
+	caFile := flag.String("ca", "", "PEM CA certificates the server is verified with over -tls, the system's if empty")
+	tlsSession := flag.String("tlssession", "", "File the TLS session is kept in over -tls, so connecting again resumes it in one round trip, with -resendfrom picking up the reports missed")
+
+	// Onboarding Parameters
+	participantID := flag.String("id", "", "Id of the participant to 'register', or whose session 'journal' to fetch")
+	participantSecret := flag.String("newsecret", "", "API secret of the participant to 'register'")
+	entitlements := flag.String("entitlements", "", "Comma-separated entitlements of the participant to 'register': admin, observer, marketmaker")
+	maxQty := flag.Uint64("maxqty", 0, "Largest order (in lots) the participant to 'register' may place, 0 for no limit")
+	feeTier := flag.Uint("feetier", 0, "Fee tier of the participant to 'register'")
+	creditLimit := flag.Float64("credit", 0, "Credit limit of the participant to 'register', the most they may have exposed across resting orders and positions, 0 for no limit")
+	marginMode := flag.String("margin", "standard", "How the positions of the participant to 'register' are margined: standard, or portfolio to net positions priced off the same underlying")
+	dataTier := flag.String("datatier", "full", "Market data the participant to 'register' may subscribe to: full for every level, depth for the top 5 levels, or bbo for the top of book")
+
+	// Exchange status flags
+	event := flag.String("event", "", "Exchange status event for 'setstatus': opened, closed, halted, resumed, degraded, recovered, maintenance, cancelmaintenance")
+	component := flag.String("component", "", "Component which is 'degraded' or 'recovered' for 'setstatus'")
+	note := flag.String("note", "", "Message to broadcast alongside the change for 'setstatus' or 'killswitch'")
+	maintenanceIn := flag.Duration("in", time.Hour, "How long until the 'maintenance' scheduled by 'setstatus' starts")
+	maintenanceFor := flag.Duration("window", 30*time.Minute, "How long the 'maintenance' scheduled by 'setstatus' lasts")
+	blockLogons := flag.Bool("blocklogons", false, "Refuse logons from everyone but admins once the 'killswitch' is pulled, until the exchange is resumed")
+	settleDay := flag.String("day", "", "Day to 'settle', as 2006-01-02 (UTC), today if empty")
+	tradingPhase := flag.String("phase", "", "Trading phase to put -scope in for 'phase': continuous, preopen, halted, closed, or scheduled to put it back on its calendar")
+	scope := flag.String("scope", "", "Symbol, or asset type ('equities' or 'crypto'), 'phase' applies to, -ticker if empty")
 
 	flag.Parse()
 
@@ -45,8 +97,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The market data feed is a separate connection, logged on to only for
+	// what the owner is entitled to.
+	if strings.ToLower(*action) == "feed" {
+		if err := streamFeed(*feedAddr, *owner, *secret, *ticker); err != nil {
+			log.Fatalf("Feed failed: %v", err)
+		}
+		return
+	}
+	if strings.ToLower(*action) == "quotes" {
+		if err := streamQuotes(*feedAddr, *owner, *secret, *ticker); err != nil {
+			log.Fatalf("Quotes failed: %v", err)
+		}
+		return
+	}
+	if strings.ToLower(*action) == "analytics" {
+		if err := streamAnalytics(*feedAddr, *owner, *secret, *ticker); err != nil {
+			log.Fatalf("Analytics failed: %v", err)
+		}
+		return
+	}
+	if strings.ToLower(*action) == "tape" {
+		if err := streamTape(*feedAddr, *owner, *secret, *ticker); err != nil {
+			log.Fatalf("Tape failed: %v", err)
+		}
+		return
+	}
+	if strings.ToLower(*action) == "levels" {
+		if err := streamLevels(*feedAddr, *owner, *secret, *ticker); err != nil {
+			log.Fatalf("Levels failed: %v", err)
+		}
+		return
+	}
+
 	// Connect to Server
-	conn, err := net.Dial("tcp", *serverAddr)
+	conn, err := dial(*serverAddr, *useTLS, *caFile, *tlsSession)
 	if err != nil {
 		log.Fatalf("Failed to connect to server at %s: %v", *serverAddr, err)
 	}
@@ -54,7 +139,29 @@ func main() {
 	fmt.Printf("Connected to %s as '%s'\n", *serverAddr, *owner)
 
 	// Start Listening for Reports (Async)
-	go readReports(conn)
+	logons := make(chan fenrirNet.SessionNotice, 1)
+	pongs := make(chan uint64, 1)
+	go readReports(conn, logons, pongs)
+
+	// Logon, so that orders and reports are tied to the owner rather than this
+	// particular connection. Wait for the answer before sending anything else,
+	// so nothing is sent under a rejected logon.
+	if err := sendLogon(conn, *owner, *secret, uint16(*batchBytes), uint16(*batchDelay/time.Microsecond)); err != nil {
+		log.Fatalf("Failed to send logon: %v", err)
+	}
+	select {
+	case notice := <-logons:
+		if notice == fenrirNet.LogonRejected || notice == fenrirNet.AuthenticationRejected || notice == fenrirNet.LogonBlocked {
+			os.Exit(1)
+		}
+	case <-time.After(5 * time.Second):
+		log.Fatal("Timed out waiting for logon")
+	}
+	if *resendFrom > 0 {
+		if err := sendResendRequest(conn, *resendFrom); err != nil {
+			log.Fatalf("Failed to send resend request: %v", err)
+		}
+	}
 
 	// Prepare Enums using 'common' package
 	side := common.Buy
@@ -67,30 +174,278 @@ func main() {
 		orderType = common.MarketOrder
 	}
 
+	tif := common.Day
+	if strings.ToLower(*tifStr) == "gtc" {
+		tif = common.GoodTillCancel
+	}
+
 	// Execute Action
 	switch strings.ToLower(*action) {
 	case "place":
-		quantities := parseQuantities(*qtyStr)
-		for _, q := range quantities {
-			err := sendPlaceOrder(conn, *owner, common.Equities, orderType, *ticker, *price, q, side)
+		scale := uint8(*qtyScale)
+		quantities := parseQuantities(*qtyStr, scale)
+		// Client order ids only need to be unique among the owner's live
+		// orders, the clock keeps them apart across runs.
+		if *clOrdID == 0 {
+			*clOrdID = uint64(time.Now().UnixNano())
+		}
+		for i, q := range quantities {
+			id := *clOrdID + uint64(i)
+			err := sendPlaceOrder(conn, *owner, common.Equities, orderType, tif, *ticker, *price, q, side, id)
+			qty := common.FormatQuantity(q, scale)
 			if err != nil {
-				fmt.Printf("Failed to place order (Qty: %d): %v", q, err)
+				fmt.Printf("Failed to place order (Qty: %s): %v", qty, err)
 			} else {
-				fmt.Printf("-> Sent %s Order: %s %d @ %.2f\n", strings.ToUpper(*sideStr), *ticker, q, *price)
+				fmt.Printf("-> Sent %s Order #%d: %s %s @ %v\n", strings.ToUpper(*sideStr), id, *ticker, qty, *price)
+			}
+		}
+
+	case "group":
+		orders, err := parseLegs(*legs, common.Equities, tif, uint8(*qtyScale))
+		if err != nil {
+			log.Fatalf("Invalid -legs: %v", err)
+		}
+		if *clOrdID == 0 {
+			*clOrdID = uint64(time.Now().UnixNano())
+		}
+		for i := range orders {
+			orders[i].ClOrdID = *clOrdID + uint64(i)
+		}
+		if *groupID == 0 {
+			*groupID = uint64(time.Now().UnixNano())
+		}
+		if err := sendOrderGroup(conn, *groupID, orders); err != nil {
+			log.Printf("Failed to send order group: %v", err)
+		} else {
+			fmt.Printf("-> Sent Order Group #%d of %d orders\n", *groupID, len(orders))
+		}
+
+	case "batch":
+		var orders []fenrirNet.NewOrderMessage
+		if *legs != "" {
+			orders, err = parseLegs(*legs, common.Equities, tif, uint8(*qtyScale))
+			if err != nil {
+				log.Fatalf("Invalid -legs: %v", err)
 			}
 		}
+		if *clOrdID == 0 {
+			*clOrdID = uint64(time.Now().UnixNano())
+		}
+		for i := range orders {
+			orders[i].ClOrdID = *clOrdID + uint64(i)
+		}
+		cancels := splitList(*uuid)
+		if err := sendOrderBatch(conn, orders, cancels); err != nil {
+			log.Printf("Failed to send order batch: %v", err)
+		} else {
+			fmt.Printf("-> Sent Order Batch of %d orders and %d cancels\n", len(orders), len(cancels))
+		}
 
 	case "cancel":
-		if *uuid == "" {
-			log.Fatal("Error: -uuid is required for cancellation")
+		if *uuid == "" && *clOrdID == 0 {
+			log.Fatal("Error: -uuid or -clordid is required for cancellation")
 		}
 		// Using common.Equities for cancel as well
-		err := sendCancelOrder(conn, common.Equities, *uuid)
-		if err != nil {
+		err := sendCancelOrder(conn, common.Equities, *uuid, *clOrdID)
+		switch {
+		case err != nil:
 			log.Printf("Failed to send cancel request: %v", err)
-		} else {
+		case *uuid != "":
 			fmt.Printf("-> Sent Cancel Request for UUID: %s\n", *uuid)
+		default:
+			fmt.Printf("-> Sent Cancel Request for Order #%d\n", *clOrdID)
+		}
+
+	case "rfq":
+		quantities := parseQuantities(*qtyStr, uint8(*qtyScale))
+		if len(quantities) == 0 {
+			log.Fatal("No valid quantity to request a quote for")
+		}
+		if err := sendQuoteRequest(conn, *ticker, quantities[0]); err != nil {
+			log.Printf("Failed to send quote request: %v", err)
+		} else {
+			fmt.Printf("-> Sent Quote Request for %s %s\n", *ticker, common.FormatQuantity(quantities[0], uint8(*qtyScale)))
+		}
+
+	case "bbo":
+		err := sendBBORequest(conn, *ticker)
+		if err != nil {
+			log.Printf("Failed to send BBO request: %v", err)
+		} else {
+			fmt.Printf("-> Sent BBO Request for %s\n", *ticker)
+		}
+
+	case "depth":
+		err := sendBookSnapshotRequest(conn, *ticker, uint16(*depth))
+		if err != nil {
+			log.Printf("Failed to send book snapshot request: %v", err)
+		} else {
+			fmt.Printf("-> Sent Book Snapshot Request for %s\n", *ticker)
+		}
+
+	case "candles":
+		from := time.Now().Add(-*since)
+		if err := sendCandleRequest(conn, *ticker, *interval, from, uint16(*limit)); err != nil {
+			log.Printf("Failed to send candle request: %v", err)
+		} else {
+			fmt.Printf("-> Sent Candle Request for %s every %v since %s\n", *ticker, *interval, from.Format(time.TimeOnly))
+		}
+
+	case "status":
+		if err := sendExchangeStatusRequest(conn); err != nil {
+			log.Printf("Failed to send exchange status request: %v", err)
+		} else {
+			fmt.Println("-> Sent Exchange Status Request")
+		}
+
+	case "dropcopy":
+		err := sendDropCopySubscribe(conn, splitList(*symbols), splitList(*participants))
+		if err != nil {
+			log.Printf("Failed to send drop copy subscription: %v", err)
+		} else {
+			fmt.Println("-> Sent Drop Copy Subscription")
+		}
+
+	case "admincancel":
+		// A uuid cancels a single order, otherwise the whole ticker is cancelled.
+		scope := fenrirNet.AdminCancelSymbolScope
+		if *uuid != "" {
+			scope = fenrirNet.AdminCancelOrderScope
+		}
+		err := sendAdminCancel(conn, scope, common.CancelReason(*reason), *ticker, *uuid)
+		if err != nil {
+			log.Printf("Failed to send admin cancel: %v", err)
+		} else {
+			fmt.Println("-> Sent Admin Cancel")
+		}
+
+	case "setstatus":
+		statusEvent, ok := map[string]fenrirNet.StatusEvent{
+			"opened":            fenrirNet.StatusOpened,
+			"closed":            fenrirNet.StatusClosed,
+			"halted":            fenrirNet.StatusHalted,
+			"resumed":           fenrirNet.StatusResumed,
+			"degraded":          fenrirNet.StatusComponentDegraded,
+			"recovered":         fenrirNet.StatusComponentRecovered,
+			"maintenance":       fenrirNet.StatusMaintenanceScheduled,
+			"cancelmaintenance": fenrirNet.StatusMaintenanceCancelled,
+		}[strings.ToLower(*event)]
+		if !ok {
+			log.Fatalf("Error: unknown -event '%s'", *event)
+		}
+		update := fenrirNet.StatusUpdate{Event: statusEvent, Component: *component, Message: *note}
+		if statusEvent == fenrirNet.StatusMaintenanceScheduled {
+			start := time.Now().Add(*maintenanceIn)
+			update.Maintenance = fenrirNet.MaintenanceWindow{Start: start, End: start.Add(*maintenanceFor)}
+		}
+		if err := sendExchangeStatusUpdate(conn, update); err != nil {
+			log.Printf("Failed to send exchange status update: %v", err)
+		} else {
+			fmt.Printf("-> Sent Exchange Status Update '%s'\n", *event)
+		}
+
+	case "killswitch":
+		var flags fenrirNet.KillSwitchFlags
+		if *blockLogons {
+			flags |= fenrirNet.KillSwitchBlockLogons
+		}
+		if err := sendKillSwitch(conn, flags, *note); err != nil {
+			log.Printf("Failed to send kill switch: %v", err)
+		} else {
+			fmt.Println("-> Sent Kill Switch")
+		}
+
+	case "settle":
+		var day time.Time
+		if *settleDay != "" {
+			day, err = time.Parse(time.DateOnly, *settleDay)
+			if err != nil {
+				log.Fatalf("Invalid -day: %v", err)
+			}
+		}
+		if err := sendSettle(conn, day); err != nil {
+			log.Printf("Failed to send settle: %v", err)
+		} else {
+			fmt.Println("-> Sent Settle")
+		}
+
+	case "phase":
+		phase, ok := map[string]common.TradingPhase{
+			"continuous": common.PhaseContinuous,
+			"preopen":    common.PhasePreOpen,
+			"halted":     common.PhaseHalted,
+			"closed":     common.PhaseClosed,
+			"scheduled":  fenrirNet.PhaseScheduled,
+		}[strings.ToLower(*tradingPhase)]
+		if !ok {
+			log.Fatalf("Error: unknown -phase '%s'", *tradingPhase)
+		}
+		if *scope == "" {
+			*scope = *ticker
+		}
+		phaseScope, err := common.ParseCalendarScope(*scope)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := sendTradingPhase(conn, phaseScope, phase); err != nil {
+			log.Printf("Failed to send trading phase: %v", err)
+		} else {
+			fmt.Printf("-> Sent Trading Phase '%s' for %s\n", *tradingPhase, phaseScope)
+		}
+
+	case "register":
+		participant := common.Participant{
+			ID:               *participantID,
+			Secret:           *participantSecret,
+			MaxOrderQuantity: *maxQty,
+			FeeTier:          uint8(*feeTier),
+			CreditLimit:      *creditLimit,
+		}
+		participant.MarginMode, err = common.ParseMarginMode(*marginMode)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		participant.DataTier, err = common.ParseDataTier(*dataTier)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, name := range splitList(*entitlements) {
+			entitlement, ok := map[string]common.Entitlement{
+				"admin":       common.AdminEntitlement,
+				"observer":    common.ObserverEntitlement,
+				"marketmaker": common.MarketMakerEntitlement,
+			}[strings.ToLower(name)]
+			if !ok {
+				log.Fatalf("Error: unknown entitlement '%s'", name)
+			}
+			participant.Entitlements |= entitlement
+		}
+		if err := sendRegisterParticipant(conn, participant); err != nil {
+			log.Printf("Failed to send registration: %v", err)
+		} else {
+			fmt.Printf("-> Sent Registration for '%s'\n", participant.ID)
+		}
+
+	case "journal":
+		if err := sendJournalRequest(conn, *participantID, uint32(*limit)); err != nil {
+			log.Printf("Failed to send journal request: %v", err)
+		} else {
+			fmt.Printf("-> Sent Journal Request for '%s'\n", *participantID)
+		}
+
+	case "ping":
+		// One ping in flight at a time, so each round trip is measured alone.
+		for id := range uint64(*count) {
+			if err := sendPing(conn, id); err != nil {
+				log.Fatalf("Failed to send ping: %v", err)
+			}
+			select {
+			case <-pongs:
+			case <-time.After(5 * time.Second):
+				log.Fatalf("Timed out waiting for pong %d", id)
+			}
 		}
+		return
 
 	case "log":
 		err := sendLog(conn)
@@ -104,19 +459,57 @@ func main() {
 		log.Fatalf("Unknown action: %s", *action)
 	}
 
-	// Keep the client alive to receive execution reports
+	// Keep the client alive to receive execution reports, heartbeating so the
+	// server does not consider the session idle.
 	fmt.Println("\nListening for reports... (Press Ctrl+C to exit)")
-	for {
+	for range time.Tick(heartbeatInterval) {
+		if err := sendHeartbeat(conn); err != nil {
+			log.Fatalf("Failed to send heartbeat: %v", err)
+		}
+	}
+}
+
+// parseQuantities splits a comma-separated string of decimal quantities into a
+// slice of lot counts at the given scale.
+// dial connects to the server at addr, over TLS if asked. The TLS session is
+// resumed from sessionFile, if there is one, and kept there for next time.
+func dial(addr string, useTLS bool, caFile, sessionFile string) (net.Conn, error) {
+	if !useTLS {
+		return net.Dial("tcp", addr)
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	if sessionFile != "" {
+		config.ClientSessionCache = fenrirNet.NewFileSessionCache(sessionFile)
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates in %s", caFile)
+		}
+	}
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	if conn.ConnectionState().DidResume {
+		fmt.Println("Resumed TLS session")
 	}
+	return conn, nil
 }
 
-// parseQuantities splits a comma-separated string into a slice of uint64
-func parseQuantities(input string) []uint64 {
+func parseQuantities(input string, scale uint8) []uint64 {
 	parts := strings.Split(input, ",")
 	var result []uint64
 	for _, p := range parts {
 		p = strings.TrimSpace(p)
-		if val, err := strconv.ParseUint(p, 10, 64); err == nil {
+		if val, err := common.ParseQuantity(p, scale); err == nil {
 			result = append(result, val)
 		} else {
 			log.Printf("Warning: Invalid quantity '%s', skipping.", p)
@@ -125,14 +518,24 @@ func parseQuantities(input string) []uint64 {
 	return result
 }
 
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(input string) []string {
+	var result []string
+	for _, p := range strings.Split(input, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 // sendPlaceOrder constructs and sends the NewOrder message
-func sendPlaceOrder(conn net.Conn, owner string, asset common.AssetType, orderType common.OrderType, ticker string, price float64, qty uint64, side common.Side) error {
+func sendPlaceOrder(conn net.Conn, owner string, asset common.AssetType, orderType common.OrderType, tif common.TimeInForce, ticker string, price float64, qty uint64, side common.Side, clOrdID uint64) error {
 	usernameLen := len(owner)
 
-	// We must include BaseMessageHeaderLen (2) in the total size.
-	// Previous calculation was: NewOrderMessageHeaderLen (26) + usernameLen.
-	// This was 2 bytes short, causing truncation of the username.
-	totalLen := fenrirNet.BaseMessageHeaderLen + fenrirNet.NewOrderMessageHeaderLen + usernameLen
+	// We must include BaseMessageHeaderLen (2) in the total size, as well as the
+	// username length byte.
+	totalLen := fenrirNet.BaseMessageHeaderLen + fenrirNet.NewOrderMessageHeaderLen + 1 + usernameLen
 
 	buf := make([]byte, totalLen)
 
@@ -140,34 +543,127 @@ func sendPlaceOrder(conn net.Conn, owner string, asset common.AssetType, orderTy
 	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.NewOrder))
 
 	// 2. Body
+	putNewOrder(buf[2:44], fenrirNet.NewOrderMessage{
+		AssetType:   asset,
+		OrderType:   orderType,
+		Ticker:      ticker,
+		LimitPrice:  price,
+		Quantity:    qty,
+		Side:        side,
+		TimeInForce: tif,
+		ClOrdID:     clOrdID,
+	})
+	buf[44] = uint8(usernameLen)
+
+	// Copy owner name into buffer
+	copy(buf[45:], owner)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// putNewOrder writes the body of a NewOrder message, without the trailing
+// owner, into buf.
+func putNewOrder(buf []byte, order fenrirNet.NewOrderMessage) {
 	// internal/net/messages.go expects AssetType and OrderType as uint16
-	binary.BigEndian.PutUint16(buf[2:4], uint16(asset))
-	binary.BigEndian.PutUint16(buf[4:6], uint16(orderType))
+	binary.BigEndian.PutUint16(buf[0:2], uint16(order.AssetType))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(order.OrderType))
 
 	// Ticker (Pad or truncate to 4 bytes)
 	tickerBytes := make([]byte, 4)
-	copy(tickerBytes, ticker)
-	copy(buf[6:10], tickerBytes)
+	copy(tickerBytes, order.Ticker)
+	copy(buf[4:8], tickerBytes)
 
-	binary.BigEndian.PutUint64(buf[10:18], math.Float64bits(price))
-	binary.BigEndian.PutUint64(buf[18:26], qty)
+	binary.BigEndian.PutUint64(buf[8:16], math.Float64bits(order.LimitPrice))
+	binary.BigEndian.PutUint64(buf[16:24], order.Quantity)
 
-	// Side is cast to byte/uint8
-	buf[26] = byte(side)
-	buf[27] = uint8(usernameLen)
+	// Side and TimeInForce are cast to byte/uint8
+	buf[24] = byte(order.Side)
+	buf[25] = byte(order.TimeInForce)
+	binary.BigEndian.PutUint64(buf[26:34], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint64(buf[34:42], order.ClOrdID)
+}
 
-	// Copy owner name into buffer
-	// buf[28:] now has sufficient space for the full username
-	copy(buf[28:], owner)
+// parseLegs parses -legs, each TICKER:side:price:qty, into limit orders.
+func parseLegs(legs string, asset common.AssetType, tif common.TimeInForce, scale uint8) ([]fenrirNet.NewOrderMessage, error) {
+	var orders []fenrirNet.NewOrderMessage
+	for _, leg := range strings.Split(legs, ",") {
+		fields := strings.Split(strings.TrimSpace(leg), ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("leg %q is not TICKER:side:price:qty", leg)
+		}
+		side := common.Buy
+		if strings.ToLower(fields[1]) == "sell" {
+			side = common.Sell
+		}
+		price, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("leg %q: %w", leg, err)
+		}
+		qty, err := common.ParseQuantity(fields[3], scale)
+		if err != nil {
+			return nil, fmt.Errorf("leg %q: %w", leg, err)
+		}
+		orders = append(orders, fenrirNet.NewOrderMessage{
+			AssetType:   asset,
+			OrderType:   common.LimitOrder,
+			Ticker:      fields[0],
+			LimitPrice:  price,
+			Quantity:    qty,
+			Side:        side,
+			TimeInForce: tif,
+		})
+	}
+	return orders, nil
+}
+
+// sendOrderGroup sends orders to be placed all together, or not at all.
+func sendOrderGroup(conn net.Conn, groupID uint64, orders []fenrirNet.NewOrderMessage) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.OrderGroupHeaderLen+len(orders)*fenrirNet.NewOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.OrderGroup))
+	binary.BigEndian.PutUint64(buf[2:10], groupID)
+	buf[10] = uint8(len(orders))
+	body := buf[fenrirNet.BaseMessageHeaderLen+fenrirNet.OrderGroupHeaderLen:]
+	for i, order := range orders {
+		putNewOrder(body[i*fenrirNet.NewOrderMessageHeaderLen:], order)
+	}
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendOrderBatch sends orders, then cancels of the orders with the given UUIDs,
+// in one frame.
+func sendOrderBatch(conn net.Conn, orders []fenrirNet.NewOrderMessage, cancels []string) error {
+	const (
+		orderLen  = fenrirNet.BaseMessageHeaderLen + fenrirNet.NewOrderMessageHeaderLen
+		cancelLen = fenrirNet.BaseMessageHeaderLen + fenrirNet.CancelOrderMessageHeaderLen
+	)
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.OrderBatchHeaderLen, fenrirNet.BaseMessageHeaderLen+fenrirNet.OrderBatchHeaderLen+len(orders)*orderLen+len(cancels)*cancelLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.OrderBatch))
+	buf[2] = uint8(len(orders) + len(cancels))
+	for _, order := range orders {
+		entry := make([]byte, orderLen)
+		binary.BigEndian.PutUint16(entry[0:2], uint16(fenrirNet.NewOrder))
+		putNewOrder(entry[2:], order)
+		buf = append(buf, entry...)
+	}
+	for _, uuid := range cancels {
+		entry := make([]byte, cancelLen)
+		binary.BigEndian.PutUint16(entry[0:2], uint16(fenrirNet.CancelOrder))
+		binary.BigEndian.PutUint16(entry[2:4], uint16(common.Equities))
+		copy(entry[4:4+fenrirNet.UUIDLen], uuid)
+		buf = append(buf, entry...)
+	}
 
 	_, err := conn.Write(buf)
 	return err
 }
 
 // sendCancelOrder constructs and sends the CancelOrder message
-func sendCancelOrder(conn net.Conn, asset common.AssetType, uuid string) error {
+func sendCancelOrder(conn net.Conn, asset common.AssetType, uuid string, clOrdID uint64) error {
 	// Using exported constants from fenrir/internal/net
-	buf := make([]byte, fenrirNet.CancelOrderMessageHeaderLen)
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
 
 	// 1. Header (TypeOf = CancelOrder)
 	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.CancelOrder))
@@ -175,11 +671,237 @@ func sendCancelOrder(conn net.Conn, asset common.AssetType, uuid string) error {
 	// 2. Body
 	binary.BigEndian.PutUint16(buf[2:4], uint16(asset))
 
-	// UUID (Truncate or pad to 16 bytes)
-	uuidBytes := make([]byte, 16)
-	copy(uuidBytes, uuid)
-	copy(buf[4:20], uuidBytes)
+	// UUID (Truncate or pad to the full uuid length), left blank to cancel by
+	// client order id instead.
+	copy(buf[4:4+fenrirNet.UUIDLen], uuid)
+	binary.BigEndian.PutUint64(buf[4+fenrirNet.UUIDLen:], clOrdID)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendLogon constructs and sends the Logon message, signed with the owner's
+// secret, asking for reports to be batched if batchBytes is set
+func sendLogon(conn net.Conn, owner string, secret string, batchBytes uint16, batchDelay uint16) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.LogonMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.Logon))
+	buf[2] = uint8(len(owner))
+	buf = append(buf, owner...)
+
+	timestamp := uint64(time.Now().UnixNano())
+	buf = binary.BigEndian.AppendUint64(buf, timestamp)
+	buf = append(buf, fenrirNet.SignLogon(owner, timestamp, secret)...)
+	buf = binary.BigEndian.AppendUint16(buf, batchBytes)
+	buf = binary.BigEndian.AppendUint16(buf, batchDelay)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendBBORequest constructs and sends the BBORequest message
+func sendQuoteRequest(conn net.Conn, ticker string, qty uint64) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.QuoteRequestHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.QuoteRequest))
+	copy(buf[2:6], ticker)
+	binary.BigEndian.PutUint64(buf[6:14], qty)
+	_, err := conn.Write(buf)
+	return err
+}
+
+func sendBBORequest(conn net.Conn, ticker string) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.BBORequestMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.BBORequest))
+
+	// Ticker (Pad or truncate to 4 bytes)
+	tickerBytes := make([]byte, 4)
+	copy(tickerBytes, ticker)
+	copy(buf[2:6], tickerBytes)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendBookSnapshotRequest constructs and sends the BookSnapshotRequest message
+func sendBookSnapshotRequest(conn net.Conn, ticker string, depth uint16) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.BookSnapshotRequestHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.BookSnapshotRequest))
+
+	// Ticker (Pad or truncate to 4 bytes)
+	tickerBytes := make([]byte, 4)
+	copy(tickerBytes, ticker)
+	copy(buf[2:6], tickerBytes)
+	binary.BigEndian.PutUint16(buf[6:8], depth)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendCandleRequest asks for up to limit of the ticker's candles since from.
+func sendCandleRequest(conn net.Conn, ticker string, interval time.Duration, from time.Time, limit uint16) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CandleRequestHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.CandleRequest))
+
+	// Ticker (Pad or truncate to 4 bytes)
+	tickerBytes := make([]byte, 4)
+	copy(tickerBytes, ticker)
+	copy(buf[2:6], tickerBytes)
+	binary.BigEndian.PutUint32(buf[6:10], uint32(interval/time.Second))
+	binary.BigEndian.PutUint64(buf[10:18], uint64(from.UnixNano()))
+	// Up to now.
+	binary.BigEndian.PutUint16(buf[26:28], limit)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendAdminCancel constructs and sends the AdminCancel message
+func sendAdminCancel(conn net.Conn, scope fenrirNet.AdminCancelScope, reason common.CancelReason, ticker string, uuid string) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.AdminCancelMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.AdminCancel))
+	buf[2] = byte(scope)
+	buf[3] = byte(reason)
+
+	// Ticker and UUID are padded or truncated to their fixed widths
+	copy(buf[4:8], ticker)
+	copy(buf[8:8+fenrirNet.UUIDLen], uuid)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendKillSwitch constructs and sends the KillSwitch message
+func sendKillSwitch(conn net.Conn, flags fenrirNet.KillSwitchFlags, note string) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.KillSwitchHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.KillSwitch))
+	buf[2] = byte(flags)
+	buf[3] = uint8(len(note))
+	buf = append(buf, note...)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendSettle asks for the day to be settled, today if day is zero.
+func sendSettle(conn net.Conn, day time.Time) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.SettleRequestHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.SettleRequest))
+	if !day.IsZero() {
+		binary.BigEndian.PutUint64(buf[2:10], uint64(day.UnixNano()))
+	}
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendTradingPhase puts the symbols in scope in phase, over their calendar.
+func sendTradingPhase(conn net.Conn, scope common.CalendarScope, phase common.TradingPhase) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.TradingPhaseOverrideHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.TradingPhaseOverride))
+	buf[2] = byte(phase)
+	buf[3] = byte(scope.AssetType)
+	copy(buf[4:8], scope.Ticker)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+func sendExchangeStatusRequest(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.ExchangeStatusRequest))
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendExchangeStatusUpdate constructs and sends the ExchangeStatusUpdate message
+func sendExchangeStatusUpdate(conn net.Conn, update fenrirNet.StatusUpdate) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.ExchangeStatusUpdateHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.ExchangeStatusUpdate))
+	buf[2] = byte(update.Event)
+	if !update.Maintenance.Start.IsZero() {
+		binary.BigEndian.PutUint64(buf[3:11], uint64(update.Maintenance.Start.UnixNano()))
+		binary.BigEndian.PutUint64(buf[11:19], uint64(update.Maintenance.End.UnixNano()))
+	}
+	buf[19] = uint8(len(update.Component))
+	buf[20] = uint8(len(update.Message))
+	buf = append(buf, update.Component...)
+	buf = append(buf, update.Message...)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendRegisterParticipant constructs and sends the RegisterParticipant message
+func sendRegisterParticipant(conn net.Conn, participant common.Participant) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.RegisterParticipantHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.RegisterParticipant))
+	buf[2] = uint8(len(participant.ID))
+	buf[3] = uint8(len(participant.Secret))
+	buf[4] = byte(participant.Entitlements)
+	binary.BigEndian.PutUint64(buf[5:13], participant.MaxOrderQuantity)
+	buf[13] = participant.FeeTier
+	binary.BigEndian.PutUint64(buf[14:22], math.Float64bits(participant.CreditLimit))
+	buf[22] = byte(participant.MarginMode)
+	buf[23] = byte(participant.DataTier)
+	buf = append(buf, participant.ID...)
+	buf = append(buf, participant.Secret...)
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// sendDropCopySubscribe constructs and sends the DropCopySubscribe message
+func sendDropCopySubscribe(conn net.Conn, symbols []string, participants []string) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.DropCopySubscribeHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.DropCopySubscribe))
+	buf[2] = uint8(len(symbols))
+	buf[3] = uint8(len(participants))
+
+	for _, symbol := range symbols {
+		// Symbols are padded or truncated to 4 bytes
+		symbolBytes := make([]byte, 4)
+		copy(symbolBytes, symbol)
+		buf = append(buf, symbolBytes...)
+	}
+	for _, participant := range participants {
+		buf = append(buf, uint8(len(participant)))
+		buf = append(buf, participant...)
+	}
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+func sendPing(conn net.Conn, id uint64) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.PingMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.Ping))
+	binary.BigEndian.PutUint64(buf[2:10], id)
+	binary.BigEndian.PutUint64(buf[10:18], uint64(time.Now().UnixNano()))
+	_, err := conn.Write(buf)
+	return err
+}
+
+func sendResendRequest(conn net.Conn, sequence uint64) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.ResendRequestHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.ResendRequest))
+	binary.BigEndian.PutUint64(buf[2:10], sequence)
+	_, err := conn.Write(buf)
+	return err
+}
+
+func sendJournalRequest(conn net.Conn, owner string, limit uint32) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.JournalRequestHeaderLen, fenrirNet.BaseMessageHeaderLen+fenrirNet.JournalRequestHeaderLen+len(owner))
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.JournalRequest))
+	buf[2] = byte(len(owner))
+	binary.BigEndian.PutUint32(buf[3:7], limit)
+	buf = append(buf, owner...)
+	_, err := conn.Write(buf)
+	return err
+}
 
+func sendHeartbeat(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.Heartbeat))
 	_, err := conn.Write(buf)
 	return err
 }
@@ -192,11 +914,91 @@ func sendLog(conn net.Conn) error {
 }
 
 // readReports continuously reads and parses Report messages from the server
-func readReports(conn net.Conn) {
+func readReports(conn net.Conn, logons chan<- fenrirNet.SessionNotice, pongs chan<- uint64) {
+	var next uint64
 	for {
-		// 1. Read Fixed Header
-		headerBuf := make([]byte, reportFixedHeaderLen)
-		_, err := io.ReadFull(conn, headerBuf)
+		// 0. Every report is numbered, ask again for any which went missing.
+		err := readSequence(conn, &next)
+
+		// 1. Read Fixed Header. Book snapshots and pongs have their own layout,
+		// so look at the message type first.
+		headerBuf := make([]byte, fenrirNet.ReportFixedHeaderLen)
+		if err == nil {
+			_, err = io.ReadFull(conn, headerBuf[:1])
+		}
+		if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.BookSnapshotReport {
+			err = readBookSnapshot(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.CandleReport {
+			err = readCandles(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.ExchangeStatusReport {
+			err = readExchangeStatus(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.OrderAckReport {
+			err = readOrderAck(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.CancelAckReport {
+			err = readCancelAck(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.CancelRejectReport {
+			err = readCancelReject(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.QuoteReport {
+			err = readQuote(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.NettingReport {
+			err = readNetting(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.FundingReport {
+			err = readFunding(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.JournalReport {
+			err = readJournal(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.PongReport {
+			err = readPong(conn, pongs)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.SettlementReport {
+			err = readSettlement(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.FlowControlReport {
+			err = readFlowControl(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil && fenrirNet.ReportMessageType(headerBuf[0]) == fenrirNet.LatencyReport {
+			err = readLatencyEcho(conn)
+			if err == nil {
+				continue
+			}
+		} else if err == nil {
+			_, err = io.ReadFull(conn, headerBuf[1:])
+		}
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("Connection lost: %v", err)
@@ -215,9 +1017,21 @@ func readReports(conn net.Conn) {
 
 		ticker := string(headerBuf[33:37])
 		uuid := string(headerBuf[37:53])
+		scale := headerBuf[53]
+		status := common.SymbolStatus(headerBuf[54])
+
+		ownerLen := headerBuf[55]
+		clOrdID := binary.BigEndian.Uint64(headerBuf[56:64])
+		priceScale := headerBuf[64]
+		tradeID := binary.BigEndian.Uint64(headerBuf[65:73])
+		liquidity := common.Liquidity(headerBuf[73])
+		leaves := binary.BigEndian.Uint64(headerBuf[74:82])
+		cumQty := binary.BigEndian.Uint64(headerBuf[82:90])
+		orderStatus := common.OrderStatus(headerBuf[90])
+		rejectReason := common.RejectReason(headerBuf[91])
 
-		// 3. Read Variable Length Strings (Error and Counterparty)
-		totalVarLen := int(counterpartyLen) + int(errStrLen)
+		// 3. Read Variable Length Strings (Error, Counterparty and Owner)
+		totalVarLen := int(counterpartyLen) + int(errStrLen) + int(ownerLen)
 		varBuf := make([]byte, totalVarLen)
 		if totalVarLen > 0 {
 			_, err := io.ReadFull(conn, varBuf)
@@ -234,22 +1048,746 @@ func readReports(conn net.Conn) {
 			errStr = string(varBuf[:errStrLen])
 		}
 		if counterpartyLen > 0 {
-			counterparty = string(varBuf[errStrLen:])
+			counterparty = string(varBuf[errStrLen : int(errStrLen)+int(counterpartyLen)])
 		}
+		owner := string(varBuf[int(errStrLen)+int(counterpartyLen):])
 
 		// 4. Print Report using imported Enums
 		switch msgType {
+		case fenrirNet.HeartbeatRequest:
+			// The server has not heard from us for a while.
+			if err := sendHeartbeat(conn); err != nil {
+				log.Printf("Failed to answer heartbeat request: %v", err)
+			}
 		case fenrirNet.ErrorReport:
-			fmt.Printf("\n[SERVER ERROR] %s\n", errStr)
+			fmt.Printf("\n[SERVER ERROR] %v: %s\n", rejectReason, errStr)
 		case fenrirNet.ExecutionReport:
 			sideStr := "BUY"
 			if side == common.Sell {
 				sideStr = "SELL"
 			}
-			fmt.Printf("\n[EXECUTION] Match: %s %s | Qty: %d | Price: %.2f | vs: %s | UUID: %s\n",
-				sideStr, ticker, qty, price, counterparty, strings.TrimRight(uuid, "\x00"))
-		case fenrirNet.OrderPlacedReport:
-			fmt.Printf("Order placed (UUID: %s)\n", uuid)
+			fmt.Printf("\n[EXECUTION] Order #%d Match: %s %s | Qty: %s | Price: %s | vs: %s | UUID: %s\n",
+				clOrdID, sideStr, ticker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), counterparty, strings.TrimRight(uuid, "\x00"))
+			fmt.Printf("  Trade #%d (%v) | %v | Filled: %s | Leaves: %s\n",
+				tradeID, liquidity, orderStatus, common.FormatQuantity(cumQty, scale), common.FormatQuantity(leaves, scale))
+		case fenrirNet.UnsolicitedCancelReport:
+			reasonStr := map[common.CancelReason]string{
+				common.AdminCancelled:      "cancelled by operator",
+				common.AdminErroneousOrder: "erroneous order",
+				common.AdminRiskBreach:     "risk breach",
+				common.AdminRegulatory:     "regulatory",
+				common.BrokerCancelled:     "cancelled by broker",
+				common.AdminKillSwitch:     "kill switch",
+				common.AdminShutdown:       "exchange shutting down",
+				common.MarketClosed:        "market closed before the open",
+			}[common.CancelReason(status)]
+			fmt.Printf("\n[CANCELLED] Order #%d %s | Qty: %s | Price: %s | UUID: %s | Reason: %s\n",
+				clOrdID, ticker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), uuid, reasonStr)
+		case fenrirNet.DropCopyReport:
+			sideStr := "BUY"
+			if side == common.Sell {
+				sideStr = "SELL"
+			}
+			fmt.Printf("[DROP COPY] %s: Order #%d %s %s | Qty: %s | Price: %s | vs: %s | UUID: %s\n",
+				owner, clOrdID, sideStr, ticker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), counterparty, strings.TrimRight(uuid, "\x00"))
+		case fenrirNet.OpenOrderReport:
+			sideStr := "BUY"
+			if side == common.Sell {
+				sideStr = "SELL"
+			}
+			tifStr := "DAY"
+			if common.TimeInForce(status) == common.GoodTillCancel {
+				tifStr = "GTC"
+			}
+			fmt.Printf("[OPEN ORDER] Order #%d %s %s %s | Qty: %s | Price: %s | UUID: %s\n",
+				clOrdID, tifStr, sideStr, ticker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), uuid)
+		case fenrirNet.BBOReport:
+			sideStr := "BID"
+			if side == common.Sell {
+				sideStr = "ASK"
+			}
+			if qty == 0 {
+				fmt.Printf("[BBO] %s %s: none\n", ticker, sideStr)
+			} else {
+				fmt.Printf("[BBO] %s %s: %s @ %s\n", ticker, sideStr, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale))
+			}
+		case fenrirNet.ParticipantRegisteredReport:
+			fmt.Printf("\n[ONBOARDED] '%s' registered (Entitlements: %d)\n", counterparty, status)
+		case fenrirNet.SymbolStatusReport:
+			statusStr := "NORMAL"
+			switch common.SymbolStatus(status) {
+			case common.SymbolStressed:
+				statusStr = "STRESSED"
+			case common.SymbolHalted:
+				statusStr = "HALTED"
+			case common.SymbolPreOpen:
+				statusStr = "PRE-OPEN"
+			case common.SymbolClosed:
+				statusStr = "CLOSED"
+			}
+			fmt.Printf("\n[STATUS] %s is %s\n", ticker, statusStr)
+		case fenrirNet.SessionReport:
+			notice := fenrirNet.SessionNotice(status)
+			switch notice {
+			case fenrirNet.LogonAccepted, fenrirNet.LogonRejected, fenrirNet.SessionTakeover, fenrirNet.SessionResumed, fenrirNet.AuthenticationRejected, fenrirNet.LogonBlocked:
+				select {
+				case logons <- notice:
+				default:
+				}
+			}
+			switch notice {
+			case fenrirNet.LogonAccepted:
+				fmt.Printf("Logged on as '%s'\n", counterparty)
+			case fenrirNet.LogonRejected:
+				fmt.Printf("\n[SESSION] Logon rejected, '%s' is active elsewhere\n", counterparty)
+			case fenrirNet.DuplicateLogonRejected:
+				fmt.Printf("\n[SESSION] Rejected another logon as '%s'\n", counterparty)
+			case fenrirNet.SessionTakeover:
+				fmt.Printf("Logged on as '%s', replacing an existing session\n", counterparty)
+			case fenrirNet.SessionTakenOver:
+				fmt.Printf("\n[SESSION] Session taken over by another logon as '%s'\n", counterparty)
+			case fenrirNet.AuthenticationRejected:
+				fmt.Printf("\n[SESSION] Logon as '%s' failed authentication\n", counterparty)
+			case fenrirNet.SessionResumed:
+				fmt.Printf("Logged on as '%s', resuming the previous session\n", counterparty)
+			case fenrirNet.LogonBlocked:
+				fmt.Printf("\n[SESSION] Logon as '%s' refused, the exchange has been killed\n", counterparty)
+			case fenrirNet.CertificationPassed:
+				fmt.Printf("\n[SESSION] '%s' passed certification\n", counterparty)
+			case fenrirNet.CertificationFailed:
+				fmt.Printf("\n[SESSION] '%s' failed certification, the exchange's operators have the report\n", counterparty)
+			}
+		}
+	}
+}
+
+// readSequence reads the sequence number ahead of a report. A report numbered
+// past the next one expected means some were missed, so they are asked for
+// again. Those numbered before it are being resent.
+func readSequence(conn net.Conn, next *uint64) error {
+	buf := make([]byte, fenrirNet.SequenceHeaderLen)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	sequence := binary.BigEndian.Uint64(buf)
+
+	switch {
+	case *next != 0 && sequence > *next:
+		fmt.Printf("\n[GAP] Missed reports #%d to #%d, asking for them again\n", *next, sequence-1)
+		if err := sendResendRequest(conn, *next); err != nil {
+			return err
+		}
+	case sequence < *next:
+		fmt.Printf("[RESENT #%d] ", sequence)
+	}
+	*next = max(*next, sequence+1)
+	return nil
+}
+
+// readOrderAck reads the rest of an order acknowledgement and prints it.
+func readOrderAck(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.OrderAckLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	clOrdID := binary.BigEndian.Uint64(buf[0:8])
+	uuid := string(buf[8:44])
+	status := common.OrderStatus(buf[44])
+	leaves := binary.BigEndian.Uint64(buf[58:66])
+	total := binary.BigEndian.Uint64(buf[66:74])
+	scale := buf[74]
+	groupID := binary.BigEndian.Uint64(buf[84:92])
+
+	group := ""
+	if groupID != 0 {
+		group = fmt.Sprintf(" in group #%d", groupID)
+	}
+	fmt.Printf("Order #%d%s acknowledged (UUID: %s) | Status: %s | Leaves: %s of %s\n",
+		clOrdID, group, uuid, status, common.FormatQuantity(leaves, scale), common.FormatQuantity(total, scale))
+	return nil
+}
+
+// readQuote reads the rest of a quote and prints it.
+func readQuote(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.QuoteLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	ticker := string(buf[0:4])
+	bid := math.Float64frombits(binary.BigEndian.Uint64(buf[4:12]))
+	ask := math.Float64frombits(binary.BigEndian.Uint64(buf[12:20]))
+	qty := binary.BigEndian.Uint64(buf[20:28])
+	scale := buf[28]
+	priceScale := buf[29]
+
+	fmt.Printf("[QUOTE] %s %s | Bid: %s | Ask: %s\n", ticker, common.FormatQuantity(qty, scale),
+		common.FormatPrice(bid, priceScale), common.FormatPrice(ask, priceScale))
+	return nil
+}
+
+// readNetting reads the rest of a netting report and prints it.
+func readNetting(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.NettingLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	ticker := string(buf[0:4])
+	fills := binary.BigEndian.Uint32(buf[4:8])
+	netQuantity := int64(binary.BigEndian.Uint64(buf[8:16]))
+	gross := binary.BigEndian.Uint64(buf[16:24])
+	vwap := math.Float64frombits(binary.BigEndian.Uint64(buf[24:32]))
+	scale := buf[32]
+	priceScale := buf[33]
+
+	// Net quantities are signed, long is positive.
+	netQty := common.FormatQuantity(uint64(netQuantity), scale)
+	if netQuantity < 0 {
+		netQty = "-" + common.FormatQuantity(uint64(-netQuantity), scale)
+	}
+	// VWAPs fall between ticks, so are shown a couple of places finer.
+	fmt.Printf("\n[NETTING] %s | Fills: %d | Net: %s | Gross: %s | VWAP: %s\n", ticker, fills, netQty,
+		common.FormatQuantity(gross, scale), common.FormatPrice(vwap, priceScale+2))
+	return nil
+}
+
+// readFunding reads the rest of a funding statement and prints it.
+func readFunding(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.FundingStatementLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	ticker := string(buf[0:4])
+	rate := math.Float64frombits(binary.BigEndian.Uint64(buf[4:12]))
+	mark := math.Float64frombits(binary.BigEndian.Uint64(buf[12:20]))
+	index := math.Float64frombits(binary.BigEndian.Uint64(buf[20:28]))
+	position := int64(binary.BigEndian.Uint64(buf[28:36]))
+	amount := math.Float64frombits(binary.BigEndian.Uint64(buf[36:44]))
+	scale := buf[44]
+	priceScale := buf[45]
+
+	held := common.FormatQuantity(uint64(position), scale)
+	if position < 0 {
+		held = "-" + common.FormatQuantity(uint64(-position), scale)
+	}
+	// Payments are a fraction of the position's value, so are shown a couple
+	// of places finer.
+	fmt.Printf("\n[FUNDING] %s | Rate: %.4f%% | Mark: %s | Index: %s | Position: %s | Amount: %s\n", ticker, rate*100,
+		common.FormatPrice(mark, priceScale), common.FormatPrice(index, priceScale), held, common.FormatPrice(amount, priceScale+2))
+	return nil
+}
+
+// readCancelAck reads the rest of a cancel acknowledgement and prints it.
+func readCancelAck(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.CancelAckLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	clOrdID := binary.BigEndian.Uint64(buf[0:8])
+	uuid := string(buf[8:44])
+	ticker := string(buf[44:48])
+	price := math.Float64frombits(binary.BigEndian.Uint64(buf[49:57]))
+	qty := binary.BigEndian.Uint64(buf[57:65])
+	scale := buf[65]
+	priceScale := buf[66]
+
+	fmt.Printf("\n[CANCELLED] Order #%d %s | Qty: %s | Price: %s | UUID: %s\n",
+		clOrdID, ticker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), uuid)
+	return nil
+}
+
+// readCancelReject reads the rest of a cancel reject and prints it.
+func readCancelReject(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.CancelRejectLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	clOrdID := binary.BigEndian.Uint64(buf[0:8])
+	uuid := strings.TrimRight(string(buf[8:44]), "\x00")
+	reason := common.CancelRejectReason(buf[44])
+	status := common.OrderStatus(buf[53])
+	ticker := strings.TrimRight(string(buf[54:58]), "\x00")
+	filled := binary.BigEndian.Uint64(buf[58:66])
+
+	fmt.Printf("\n[CANCEL REJECTED] Order #%d | UUID: %s | Reason: %v\n", clOrdID, uuid, reason)
+	if status != common.OrderUnknown {
+		fmt.Printf("  Order is %v | %s | Filled: %d\n", status, ticker, filled)
+	}
+	return nil
+}
+
+// readPong reads the rest of a pong and prints where the round trip went.
+func readPong(conn net.Conn, pongs chan<- uint64) error {
+	buf := make([]byte, fenrirNet.PongLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	now := time.Now()
+	id := binary.BigEndian.Uint64(buf[0:8])
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:16])))
+	serverReceived := time.Unix(0, int64(binary.BigEndian.Uint64(buf[16:24])))
+	serverSent := time.Unix(0, int64(binary.BigEndian.Uint64(buf[24:32])))
+
+	fmt.Printf("<- PONG #%d | RTT: %v | Gateway: %v\n", id, now.Sub(sentAt), serverSent.Sub(serverReceived))
+	select {
+	case pongs <- id:
+	default:
+	}
+	return nil
+}
+
+// readSettlement reads the rest of a settlement summary and prints it.
+func readSettlement(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.SettlementSummaryLen-1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	day := time.Unix(0, int64(binary.BigEndian.Uint64(buf[0:8]))).UTC()
+	fmt.Printf("\n[SETTLED] %s | Trades: %d | Owners: %d | Positions: %d\n", day.Format(time.DateOnly),
+		binary.BigEndian.Uint32(buf[8:12]), binary.BigEndian.Uint32(buf[12:16]), binary.BigEndian.Uint32(buf[16:20]))
+	return nil
+}
+
+// readFlowControl reads the rest of a flow control and prints it.
+func readFlowControl(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.FlowControlLen)
+	buf[0] = byte(fenrirNet.FlowControlReport)
+	if _, err := io.ReadFull(conn, buf[1:]); err != nil {
+		return err
+	}
+	flow, err := fenrirNet.ParseFlowControl(buf)
+	if err != nil {
+		return err
+	}
+
+	state := "QUEUED"
+	switch flow.State {
+	case fenrirNet.FlowThrottled:
+		state = "THROTTLED"
+	case fenrirNet.FlowSessionThrottled:
+		state, flow.Ticker = "THROTTLED", "session"
+	}
+	fmt.Printf("\n[FLOW] %s %s | Remaining: query %d, order %d, cancel %d | Retry after: %v\n", state, flow.Ticker,
+		flow.Budget.Remaining[common.QueryPriority], flow.Budget.Remaining[common.NewOrderPriority],
+		flow.Budget.Remaining[common.CancelPriority], flow.Budget.RetryAfter[flow.Priority])
+	return nil
+}
+
+// readLatencyEcho reads the rest of a latency echo and prints how long the
+// exchange took over the message it is of.
+func readLatencyEcho(conn net.Conn) error {
+	buf := make([]byte, fenrirNet.LatencyEchoLen)
+	buf[0] = byte(fenrirNet.LatencyReport)
+	if _, err := io.ReadFull(conn, buf[1:]); err != nil {
+		return err
+	}
+	echo, err := fenrirNet.ParseLatencyEcho(buf)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n[LATENCY] Message %d | In exchange: %v\n", echo.Of, echo.WrittenAt.Sub(echo.ReadAt))
+	return nil
+}
+
+// readJournal reads and prints the remainder of a SessionJournal message, the
+// message type has already been consumed.
+func readJournal(conn net.Conn) error {
+	headerBuf := make([]byte, fenrirNet.JournalHeaderLen-1)
+	if _, err := io.ReadFull(conn, headerBuf); err != nil {
+		return err
+	}
+	ownerBuf := make([]byte, headerBuf[0])
+	if _, err := io.ReadFull(conn, ownerBuf); err != nil {
+		return err
+	}
+	nEntries := int(binary.BigEndian.Uint32(headerBuf[1:5]))
+
+	fmt.Printf("\n[JOURNAL] '%s' (%d messages)\n", ownerBuf, nEntries)
+	directions := map[fenrirNet.JournalDirection]string{
+		fenrirNet.JournalInbound:     "IN ",
+		fenrirNet.JournalOutbound:    "OUT",
+		fenrirNet.JournalUndelivered: "UND",
+		fenrirNet.JournalResent:      "RES",
+	}
+	for range nEntries {
+		entry := make([]byte, fenrirNet.JournalEntryHeaderLen)
+		if _, err := io.ReadFull(conn, entry); err != nil {
+			return err
+		}
+		message := make([]byte, binary.BigEndian.Uint32(entry[17:21]))
+		if _, err := io.ReadFull(conn, message); err != nil {
+			return err
+		}
+
+		// Inbound messages start with a 2 byte type, reports with a 1 byte one.
+		direction := fenrirNet.JournalDirection(entry[0])
+		msgType := 0
+		if direction == fenrirNet.JournalInbound && len(message) >= 2 {
+			msgType = int(binary.BigEndian.Uint16(message[0:2]))
+		} else if len(message) >= 1 {
+			msgType = int(message[0])
+		}
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(entry[9:17])))
+		fmt.Printf("  %s #%-6d %s | Type: %2d | %x\n", directions[direction], binary.BigEndian.Uint64(entry[1:9]),
+			timestamp.Format(time.StampMicro), msgType, message)
+	}
+	return nil
+}
+
+// readBookSnapshot reads and prints the remainder of a BookSnapshot message,
+// the message type has already been consumed.
+func readBookSnapshot(conn net.Conn) error {
+	headerBuf := make([]byte, fenrirNet.BookSnapshotHeaderLen-1)
+	if _, err := io.ReadFull(conn, headerBuf); err != nil {
+		return err
+	}
+	ticker := string(headerBuf[0:4])
+	scale := headerBuf[4]
+	priceScale := headerBuf[5]
+	sequence := binary.BigEndian.Uint64(headerBuf[6:14])
+	nBids := int(binary.BigEndian.Uint16(headerBuf[14:16]))
+	nAsks := int(binary.BigEndian.Uint16(headerBuf[16:18]))
+
+	levelsBuf := make([]byte, (nBids+nAsks)*fenrirNet.BookSnapshotLevelLen)
+	if _, err := io.ReadFull(conn, levelsBuf); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n[DEPTH] %s (Seq: %d)\n", ticker, sequence)
+	for i := 0; i < nBids+nAsks; i++ {
+		level := levelsBuf[i*fenrirNet.BookSnapshotLevelLen:]
+		price := math.Float64frombits(binary.BigEndian.Uint64(level[0:8]))
+		qty := binary.BigEndian.Uint64(level[8:16])
+		orders := binary.BigEndian.Uint32(level[16:20])
+
+		sideStr := "BID"
+		if i >= nBids {
+			sideStr = "ASK"
+		}
+		fmt.Printf("  %s %10s | Qty: %s (%d orders)\n", sideStr, common.FormatPrice(price, priceScale), common.FormatQuantity(qty, scale), orders)
+	}
+	return nil
+}
+
+// readCandles reads the rest of a page of candles and prints it.
+func readCandles(conn net.Conn) error {
+	headerBuf := make([]byte, fenrirNet.CandleHistoryHeaderLen-1)
+	if _, err := io.ReadFull(conn, headerBuf); err != nil {
+		return err
+	}
+	ticker := string(headerBuf[0:4])
+	interval := time.Duration(binary.BigEndian.Uint32(headerBuf[4:8])) * time.Second
+	scale := headerBuf[8]
+	priceScale := headerBuf[9]
+	next := binary.BigEndian.Uint64(headerBuf[10:18])
+	count := int(binary.BigEndian.Uint16(headerBuf[18:20]))
+
+	candlesBuf := make([]byte, count*fenrirNet.CandleLen)
+	if _, err := io.ReadFull(conn, candlesBuf); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n[CANDLES] %s every %v (%d)\n", ticker, interval, count)
+	for i := range count {
+		c := candlesBuf[i*fenrirNet.CandleLen:]
+		start := time.Unix(0, int64(binary.BigEndian.Uint64(c[0:8])))
+		price := func(b []byte) string {
+			return common.FormatPrice(math.Float64frombits(binary.BigEndian.Uint64(b)), priceScale)
+		}
+		fmt.Printf("  %s | O: %s H: %s L: %s C: %s | Vol: %s (%d trades)\n",
+			start.Format(time.DateTime), price(c[8:16]), price(c[16:24]), price(c[24:32]), price(c[32:40]),
+			common.FormatQuantity(binary.BigEndian.Uint64(c[40:48]), scale), binary.BigEndian.Uint32(c[48:52]))
+	}
+	if next != 0 {
+		fmt.Printf("  More from %s\n", time.Unix(0, int64(next)).Format(time.DateTime))
+	}
+	return nil
+}
+
+func readExchangeStatus(conn net.Conn) error {
+	// The header, then each length prefixed field in turn: the component, the
+	// degraded components and the message.
+	buf := make([]byte, fenrirNet.ExchangeStatusChangeHeaderLen+1)
+	buf[0] = byte(fenrirNet.ExchangeStatusReport)
+	if _, err := io.ReadFull(conn, buf[1:]); err != nil {
+		return err
+	}
+	readString := func() error {
+		n := len(buf)
+		buf = append(buf, make([]byte, buf[n-1])...)
+		_, err := io.ReadFull(conn, buf[n:])
+		return err
+	}
+	readLen := func() error {
+		buf = append(buf, 0)
+		_, err := io.ReadFull(conn, buf[len(buf)-1:])
+		return err
+	}
+	if err := readString(); err != nil {
+		return err
+	}
+	if err := readLen(); err != nil {
+		return err
+	}
+	for range int(buf[len(buf)-1]) {
+		if err := readLen(); err != nil {
+			return err
+		}
+		if err := readString(); err != nil {
+			return err
+		}
+	}
+	if err := readLen(); err != nil {
+		return err
+	}
+	if err := readString(); err != nil {
+		return err
+	}
+	change, _, err := fenrirNet.ParseExchangeStatusChange(buf)
+	if err != nil {
+		return err
+	}
+
+	state := map[fenrirNet.ExchangeState]string{
+		fenrirNet.ExchangeOpen:   "OPEN",
+		fenrirNet.ExchangeHalted: "HALTED",
+		fenrirNet.ExchangeClosed: "CLOSED",
+		fenrirNet.ExchangeKilled: "KILLED, logons refused",
+	}[change.State]
+	switch change.Event {
+	case fenrirNet.StatusComponentDegraded:
+		fmt.Printf("\n[EXCHANGE] %s is degraded\n", change.Component)
+	case fenrirNet.StatusComponentRecovered:
+		fmt.Printf("\n[EXCHANGE] %s has recovered\n", change.Component)
+	case fenrirNet.StatusMaintenanceScheduled:
+		fmt.Println("\n[EXCHANGE] Maintenance scheduled")
+	case fenrirNet.StatusMaintenanceCancelled:
+		fmt.Println("\n[EXCHANGE] Maintenance cancelled")
+	case fenrirNet.StatusKilled:
+		fmt.Printf("\n[EXCHANGE] Kill switch pulled, every order cancelled, exchange is %s\n", state)
+	default:
+		fmt.Printf("\n[EXCHANGE] Exchange is %s\n", state)
+	}
+	if len(change.Degraded) > 0 {
+		fmt.Printf("  Degraded: %s\n", strings.Join(change.Degraded, ", "))
+	}
+	if !change.Maintenance.Start.IsZero() {
+		fmt.Printf("  Maintenance: %s until %s\n", change.Maintenance.Start.Format(time.DateTime), change.Maintenance.End.Format(time.DateTime))
+	}
+	if change.Message != "" {
+		fmt.Printf("  %s\n", change.Message)
+	}
+	return nil
+}
+
+// streamFeed subscribes to the market data feed for ticker and prints updates
+// until the connection drops.
+func streamFeed(feedAddr string, owner string, secret string, ticker string) error {
+	conn, err := dialFeed(feedAddr, owner, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := subscribeFeed(conn, fenrirNet.DepthChannel, ticker); err != nil {
+		return err
+	}
+
+	update := make([]byte, fenrirNet.MarketDataUpdateLen)
+	for {
+		if _, err := io.ReadFull(conn, update); err != nil {
+			return err
+		}
+
+		updateType := common.MarketDataUpdateType(update[1])
+		side := common.Side(update[2])
+		updateTicker := string(update[3:7])
+		sequence := binary.BigEndian.Uint64(update[7:15])
+		price := math.Float64frombits(binary.BigEndian.Uint64(update[23:31]))
+		qty := binary.BigEndian.Uint64(update[31:39])
+		orders := binary.BigEndian.Uint32(update[39:43])
+		scale := update[43]
+		priceScale := update[44]
+		priceStr := common.FormatPrice(price, priceScale)
+
+		sideStr := "BID"
+		if side == common.Sell {
+			sideStr = "ASK"
+		}
+		switch updateType {
+		case common.LevelAdd:
+			fmt.Printf("[%d] %s ADD    %s %s | Qty: %s (%d orders)\n", sequence, updateTicker, sideStr, priceStr, common.FormatQuantity(qty, scale), orders)
+		case common.LevelModify:
+			fmt.Printf("[%d] %s MODIFY %s %s | Qty: %s (%d orders)\n", sequence, updateTicker, sideStr, priceStr, common.FormatQuantity(qty, scale), orders)
+		case common.LevelDelete:
+			fmt.Printf("[%d] %s DELETE %s %s\n", sequence, updateTicker, sideStr, priceStr)
+		case common.TradeUpdate:
+			aggressor := "BUY"
+			if side == common.Sell {
+				aggressor = "SELL"
+			}
+			fmt.Printf("[%d] %s TRADE  %s @ %s (aggressor: %s)\n", sequence, updateTicker, common.FormatQuantity(qty, scale), priceStr, aggressor)
+		case common.IndicativeUpdate:
+			if qty == 0 {
+				fmt.Printf("[%d] %s INDIC  none\n", sequence, updateTicker)
+				continue
+			}
+			surplus := "buyers"
+			if side == common.Sell {
+				surplus = "sellers"
+			}
+			fmt.Printf("[%d] %s INDIC  %s @ %s (surplus of %s)\n", sequence, updateTicker, common.FormatQuantity(qty, scale), priceStr, surplus)
+		}
+	}
+}
+
+// streamTape subscribes to the time and sales for ticker and prints every
+// trade until the connection drops.
+func streamTape(feedAddr string, owner string, secret string, ticker string) error {
+	conn, err := dialFeed(feedAddr, owner, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := subscribeFeed(conn, fenrirNet.TradesChannel, ticker); err != nil {
+		return err
+	}
+
+	tape := make([]byte, fenrirNet.TradeTapeLen)
+	for {
+		if _, err := io.ReadFull(conn, tape); err != nil {
+			return err
+		}
+
+		tapeTicker := string(tape[1:5])
+		tradeID := binary.BigEndian.Uint64(tape[5:13])
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(tape[13:21])))
+		price := math.Float64frombits(binary.BigEndian.Uint64(tape[21:29]))
+		qty := binary.BigEndian.Uint64(tape[29:37])
+		scale := tape[38]
+		priceScale := tape[39]
+
+		aggressor := "BUY"
+		if common.Side(tape[37]) == common.Sell {
+			aggressor = "SELL"
+		}
+		fmt.Printf("%s #%d %s %s @ %s (aggressor: %s)\n",
+			timestamp.Format("15:04:05.000000"), tradeID, tapeTicker, common.FormatQuantity(qty, scale), common.FormatPrice(price, priceScale), aggressor)
+	}
+}
+
+// streamQuotes subscribes to top of book changes for ticker and prints them
+// until the connection drops.
+func streamQuotes(feedAddr string, owner string, secret string, ticker string) error {
+	conn, err := dialFeed(feedAddr, owner, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := subscribeFeed(conn, fenrirNet.BBOChannel, ticker); err != nil {
+		return err
+	}
+
+	quote := make([]byte, fenrirNet.BBOUpdateLen)
+	for {
+		if _, err := io.ReadFull(conn, quote); err != nil {
+			return err
+		}
+
+		quoteTicker := string(quote[1:5])
+		sequence := binary.BigEndian.Uint64(quote[5:13])
+		bidPrice := math.Float64frombits(binary.BigEndian.Uint64(quote[13:21]))
+		bidQty := binary.BigEndian.Uint64(quote[21:29])
+		askPrice := math.Float64frombits(binary.BigEndian.Uint64(quote[29:37]))
+		askQty := binary.BigEndian.Uint64(quote[37:45])
+		scale := quote[45]
+		priceScale := quote[46]
+
+		fmt.Printf("[%d] %s %s @ %s / %s @ %s\n", sequence, quoteTicker,
+			common.FormatQuantity(bidQty, scale), common.FormatPrice(bidPrice, priceScale),
+			common.FormatQuantity(askQty, scale), common.FormatPrice(askPrice, priceScale))
+	}
+}
+
+// streamAnalytics subscribes to the valuations of option ticker and prints
+// them until the connection drops.
+func streamAnalytics(feedAddr string, owner string, secret string, ticker string) error {
+	conn, err := dialFeed(feedAddr, owner, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := subscribeFeed(conn, fenrirNet.AnalyticsChannel, ticker); err != nil {
+		return err
+	}
+
+	greeks := make([]byte, fenrirNet.GreeksLen)
+	for {
+		if _, err := io.ReadFull(conn, greeks); err != nil {
+			return err
+		}
+
+		optionTicker := string(greeks[1:5])
+		timestamp := time.Unix(0, int64(binary.BigEndian.Uint64(greeks[5:13])))
+		value := func(i int) float64 {
+			return math.Float64frombits(binary.BigEndian.Uint64(greeks[i : i+8]))
+		}
+		priceScale := greeks[61]
+
+		fmt.Printf("%s %s theo %s (underlying %s) delta %.4f gamma %.4f vega %.4f theta %.4f\n",
+			timestamp.Format("15:04:05.000000"), optionTicker, common.FormatPrice(value(21), priceScale),
+			common.FormatPrice(value(13), priceScale), value(29), value(37), value(45), value(53))
+	}
+}
+
+// streamLevels subscribes to the top levels of ticker's book and prints them
+// each time they change, until the connection drops.
+func streamLevels(feedAddr string, owner string, secret string, ticker string) error {
+	conn, err := dialFeed(feedAddr, owner, secret)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := subscribeFeed(conn, fenrirNet.TopDepthChannel, ticker); err != nil {
+		return err
+	}
+
+	messageType := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, messageType); err != nil {
+			return err
+		}
+		if err := readBookSnapshot(conn); err != nil {
+			return err
 		}
 	}
 }
+
+// dialFeed connects to the feed and logs on as owner, so it may subscribe to
+// whatever owner is entitled to.
+func dialFeed(feedAddr string, owner string, secret string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", feedAddr)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Connected to feed at %s\n", feedAddr)
+
+	if err := sendLogon(conn, owner, secret, 0, 0); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// subscribeFeed asks the feed for a channel of ticker.
+func subscribeFeed(conn net.Conn, channel fenrirNet.Channel, ticker string) error {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.SubscribeHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.Subscribe))
+	buf[2] = byte(channel)
+	copy(buf[3:7], ticker)
+	_, err := conn.Write(buf)
+	return err
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+)
+
+const usage = `fenrirctl operates a running exchange through its REST API, or admin API if
+served apart, as an admin.
+
+Usage:
+  fenrirctl [flags] COMMAND [ARGS]
+
+Commands:
+  halt SYMBOL                    halt new orders on a symbol
+  resume SYMBOL                  resume a halted symbol
+  exchange EVENT [-component C] [-note N]
+                                 change the exchange's status, EVENT being opened, closed,
+                                 halted, resumed, componentDegraded or componentRecovered
+  phase SCOPE PHASE              put a symbol, or every symbol of an asset type, in a trading
+                                 phase over its calendar, PHASE being continuous, preOpen,
+                                 halted or closed, or scheduled to put it back on its calendar
+  cancel -owner O | -symbol S | -uuid U [-reason R]
+                                 cancel every order of an owner, on a symbol, or just one,
+                                 R being adminCancelled, erroneousOrder, riskBreach or regulatory
+  book SYMBOL [-depth N]         dump a symbol's book, however deep
+  stats                          the server's connections, sessions, input queue and halts
+  books                          how many books, levels and orders are held, and how stale
+  sessions                       every connection, and session which may yet be resumed
+  disconnect ADDRESS             disconnect the client on an address, as listed by sessions
+  certifications                 how each owner did when last certified, with why steps failed
+  snapshot                       snapshot the books now
+  trade SYMBOL -buyer B -seller S -price P -qty N
+                                 book a trade between two owners, to correct an error or
+                                 register one agreed off the exchange
+
+Flags:
+`
+
+func main() {
+	api := flag.String("api", "http://127.0.0.1:9004", "URL of the exchange's REST API")
+	owner := flag.String("owner", "", "Admin the requests are made on behalf of (compulsory)")
+	secret := flag.String("secret", "", "Admin's API secret requests are signed with")
+	output := flag.String("o", "table", "Output format: 'table' or 'json'")
+	timeout := flag.Duration("timeout", 10*time.Second, "How long to wait for the exchange to answer")
+	cert := flag.String("cert", "", "PEM client certificate presented to an admin API which asks for one")
+	key := flag.String("key", "", "PEM key of -cert")
+	ca := flag.String("ca", "", "PEM CA certificates an https API is verified with, the system's if empty")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		log.Fatalf("Invalid output format %q", *output)
+	}
+	tlsConfig, err := clientTLS(*cert, *key, *ca)
+	if err != nil {
+		log.Fatalf("Invalid TLS: %v", err)
+	}
+	ctl := &ctl{
+		api:    *api,
+		owner:  *owner,
+		secret: *secret,
+		json:   *output == "json",
+		client: &http.Client{
+			Timeout:   *timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "halt", "resume":
+		symbol := symbolArg(command, args)
+		err = ctl.do(http.MethodPost, "/admin/symbols/"+url.PathEscape(symbol)+"/"+command, nil, printObject)
+	case "exchange":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		component := flags.String("component", "", "Component degraded or recovered")
+		note := flags.String("note", "", "Note sent to sessions with the change")
+		if len(args) == 0 {
+			log.Fatal("exchange needs an EVENT")
+		}
+		flags.Parse(args[1:])
+		body, _ := json.Marshal(map[string]string{"event": args[0], "component": *component, "note": *note})
+		err = ctl.do(http.MethodPost, "/admin/status", body, printObject)
+	case "phase":
+		if len(args) < 2 {
+			log.Fatal("phase needs a SCOPE and PHASE")
+		}
+		body, _ := json.Marshal(map[string]string{"scope": args[0], "phase": args[1]})
+		err = ctl.do(http.MethodPost, "/admin/phase", body, printObject)
+	case "cancel":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		cancelOwner := flags.String("owner", "", "Owner whose orders are all cancelled")
+		symbol := flags.String("symbol", "", "Symbol whose orders are all cancelled")
+		uuid := flags.String("uuid", "", "UUID of the one order cancelled")
+		reason := flags.String("reason", "", "Why the orders are cancelled, adminCancelled if empty")
+		flags.Parse(args)
+		query := url.Values{}
+		for key, value := range map[string]string{"owner": *cancelOwner, "symbol": *symbol, "uuid": *uuid, "reason": *reason} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+		err = ctl.do(http.MethodDelete, "/admin/orders?"+query.Encode(), nil, printOrders("cancelled"))
+	case "book":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		depth := flags.Uint("depth", fenrirNet.DefaultSnapshotDepth, "Number of price levels per side")
+		symbol := symbolArg(command, args)
+		flags.Parse(args[1:])
+		path := "/admin/book/" + url.PathEscape(symbol) + "?depth=" + strconv.FormatUint(uint64(*depth), 10)
+		err = ctl.do(http.MethodGet, path, nil, printBook)
+	case "stats":
+		err = ctl.do(http.MethodGet, "/admin/stats", nil, printStats)
+	case "books":
+		err = ctl.do(http.MethodGet, "/admin/books", nil, printBookMetrics)
+	case "sessions":
+		err = ctl.do(http.MethodGet, "/admin/sessions", nil, printSessions)
+	case "certifications":
+		err = ctl.do(http.MethodGet, "/admin/certifications", nil, printCertifications)
+	case "disconnect":
+		if len(args) == 0 {
+			log.Fatal("disconnect needs an ADDRESS")
+		}
+		err = ctl.do(http.MethodDelete, "/admin/sessions/"+url.PathEscape(args[0]), nil, printObject)
+	case "snapshot":
+		err = ctl.do(http.MethodPost, "/admin/snapshot", nil, printObject)
+	case "trade":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		buyer := flags.String("buyer", "", "Owner buying")
+		seller := flags.String("seller", "", "Owner selling")
+		price := flags.Float64("price", 0, "Price traded at")
+		quantity := flags.Uint64("qty", 0, "Lots traded")
+		symbol := symbolArg(command, args)
+		flags.Parse(args[1:])
+		body, _ := json.Marshal(map[string]any{"symbol": symbol, "buyer": *buyer, "seller": *seller, "price": *price, "quantity": *quantity})
+		err = ctl.do(http.MethodPost, "/admin/trades", body, printOrders("filled"))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", command, err)
+	}
+}
+
+func symbolArg(command string, args []string) string {
+	if len(args) == 0 {
+		log.Fatalf("%s needs a SYMBOL", command)
+	}
+	return args[0]
+}
+
+// clientTLS is what an https API is dialled with.
+func clientTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates in %s", caFile)
+		}
+	}
+	return config, nil
+}
+
+type ctl struct {
+	api    string
+	owner  string
+	secret string
+	json   bool
+	client *http.Client
+}
+
+// do makes a signed request of the API, printing what it answers with as it is
+// if -o json, otherwise as a table with print.
+func (c *ctl) do(method, path string, body []byte, print func(w io.Writer, body []byte) error) error {
+	req, err := http.NewRequest(method, c.api+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := uint64(time.Now().UnixNano())
+	req.Header.Set(fenrirNet.OwnerHeader, c.owner)
+	req.Header.Set(fenrirNet.TimestampHeader, strconv.FormatUint(timestamp, 10))
+	req.Header.Set(fenrirNet.SignatureHeader, hex.EncodeToString(fenrirNet.SignLogon(c.owner, timestamp, c.secret)))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(answer, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	if c.json {
+		_, err := os.Stdout.Write(answer)
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if err := print(w, answer); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// printObject prints each field of an object on a line of its own.
+func printObject(w io.Writer, body []byte) error {
+	// Timestamps are unix nanos, too big to be printed as floats.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		fmt.Fprintf(w, "%s\t%v\n", key, object[key])
+	}
+	return nil
+}
+
+// printOrders prints the orders, and how many were whatever done says.
+func printOrders(done string) func(w io.Writer, body []byte) error {
+	return func(w io.Writer, body []byte) error {
+		var orders []struct {
+			UUID     string  `json:"uuid"`
+			Ticker   string  `json:"ticker"`
+			Side     string  `json:"side"`
+			Price    float64 `json:"price"`
+			Quantity uint64  `json:"quantity"`
+			Leaves   uint64  `json:"leaves"`
+		}
+		if err := json.Unmarshal(body, &orders); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "UUID\tSYMBOL\tSIDE\tPRICE\tQTY\tLEAVES")
+		for _, order := range orders {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%g\t%d\t%d\n", order.UUID, order.Ticker, order.Side, order.Price, order.Quantity, order.Leaves)
+		}
+		fmt.Fprintf(w, "%d %s\n", len(orders), done)
+		return nil
+	}
+}
+
+func printBook(w io.Writer, body []byte) error {
+	type level struct {
+		Price    float64 `json:"price"`
+		Quantity uint64  `json:"quantity"`
+		Orders   uint32  `json:"orders"`
+	}
+	var book struct {
+		Ticker   string  `json:"ticker"`
+		Sequence uint64  `json:"sequence"`
+		Bids     []level `json:"bids"`
+		Asks     []level `json:"asks"`
+	}
+	if err := json.Unmarshal(body, &book); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\tsequence %d\n", book.Ticker, book.Sequence)
+	fmt.Fprintln(w, "ORDERS\tBID QTY\tBID\tASK\tASK QTY\tORDERS")
+	for i := range max(len(book.Bids), len(book.Asks)) {
+		var bid, ask [3]string
+		if i < len(book.Bids) {
+			b := book.Bids[i]
+			bid = [3]string{strconv.Itoa(int(b.Orders)), strconv.FormatUint(b.Quantity, 10), strconv.FormatFloat(b.Price, 'g', -1, 64)}
+		}
+		if i < len(book.Asks) {
+			a := book.Asks[i]
+			ask = [3]string{strconv.FormatFloat(a.Price, 'g', -1, 64), strconv.FormatUint(a.Quantity, 10), strconv.Itoa(int(a.Orders))}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", bid[0], bid[1], bid[2], ask[0], ask[1], ask[2])
+	}
+	return nil
+}
+
+func printSessions(w io.Writer, body []byte) error {
+	var sessions []fenrirNet.SessionInfo
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "OWNER\tADDRESS\tLAST SEEN\tDISCONNECTED")
+	at := func(nanos int64) string {
+		if nanos == 0 {
+			return "-"
+		}
+		return time.Unix(0, nanos).Format(time.RFC3339)
+	}
+	for _, session := range sessions {
+		owner, address := session.Owner, session.Address
+		if owner == "" {
+			owner = "-"
+		}
+		if address == "" {
+			address = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", owner, address, at(session.LastSeen), at(session.DisconnectedAt))
+	}
+	return nil
+}
+
+func printCertifications(w io.Writer, body []byte) error {
+	var reports []fenrirNet.CertificationReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "OWNER\tFINISHED\tRESULT\tSTEP\tDETAIL")
+	for _, report := range reports {
+		result := "FAILED"
+		if report.Passed {
+			result = "PASSED"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t\t\n", report.Owner, report.Finished.Format(time.RFC3339), result)
+		for _, step := range report.Steps {
+			stepResult, detail := "passed", step.Detail
+			if !step.Passed {
+				stepResult = "failed"
+			}
+			if detail == "" {
+				detail = "-"
+			}
+			fmt.Fprintf(w, "\t\t%s\t%s\t%s\n", stepResult, step.Step, detail)
+		}
+	}
+	return nil
+}
+
+func printBookMetrics(w io.Writer, body []byte) error {
+	var metrics common.BookMetrics
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "books\t%d (%d empty, %d stale)\n", metrics.Books, metrics.EmptyBooks, metrics.StaleBooks)
+	fmt.Fprintf(w, "levels\t%d (%d stale)\n", metrics.Levels, metrics.StaleLevels)
+	fmt.Fprintf(w, "orders\t%d\n", metrics.Orders)
+	fmt.Fprintf(w, "oldest level\t%v\n", metrics.OldestLevel)
+	fmt.Fprintf(w, "books dropped\t%d\n", metrics.Dropped)
+	return nil
+}
+
+func printStats(w io.Writer, body []byte) error {
+	var stats fenrirNet.Stats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "status\t%s\n", stats.Status)
+	fmt.Fprintf(w, "connections\t%d\n", stats.Connections)
+	fmt.Fprintf(w, "sessions\t%d\n", stats.Sessions)
+	fmt.Fprintf(w, "halted symbols\t%v\n", stats.HaltedSymbols)
+	queue := stats.Queue
+	fmt.Fprintf(w, "input queue\t%d/%d (high water %d)\n", queue.Depth, queue.Capacity, queue.HighWater)
+	fmt.Fprintf(w, "  enqueued\t%d\n", queue.Enqueued)
+	fmt.Fprintf(w, "  blocked\t%d\n", queue.Blocked)
+	fmt.Fprintf(w, "  rejected\t%d\n", queue.Rejected)
+	fmt.Fprintf(w, "  dropped\t%d\n", queue.Dropped)
+	fmt.Fprintf(w, "  reordered\t%d\n", queue.Reordered)
+	fmt.Fprintf(w, "  late\t%d\n", queue.Late)
+	fmt.Fprintf(w, "tls handshakes\t%d (%d resumed, %d failed)\n", stats.TLS.Handshakes, stats.TLS.Resumed, stats.TLS.Failed)
+	for _, message := range slices.Sorted(maps.Keys(stats.Latency)) {
+		latency := stats.Latency[message]
+		fmt.Fprintf(w, "latency %s\t%d (p50 %v, p99 %v, max %v)\n", message, latency.Count, latency.P50, latency.P99, latency.Max)
+	}
+	return nil
+}
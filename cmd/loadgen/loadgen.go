@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+)
+
+const usage = `loadgen opens sessions on a running exchange and sends them order flow at a
+steady rate, then reports the throughput achieved and how long orders and
+cancels took to be answered, for validating performance changes.
+
+Usage:
+  loadgen [flags]
+
+Each session logs on as -owner with its number appended (loadgen1, loadgen2,
+...), signed with -secret if the exchange asks for one. Orders are limits on
+-symbols, picked by weight, bought and sold alike around -mid, so that some
+trade and the rest rest. Cancels are of orders each session has resting.
+Orders are sent as scheduled whether or not earlier ones have been answered,
+so a slow exchange shows in the latencies rather than slowing the load down.
+
+Latencies are from writing an order or cancel to its acknowledgement, or its
+rejection, and as coarse as the exchange's own, see LatencyHistogram.
+
+Flags:
+`
+
+func main() {
+	serverAddr := flag.String("server", "127.0.0.1:9001", "Address of the exchange server")
+	sessions := flag.Int("sessions", 10, "Number of sessions to open, each sending its share of the load")
+	owner := flag.String("owner", "loadgen", "Owner each session logs on as, its number appended")
+	secret := flag.String("secret", "", "API secret every session's logon is signed with")
+	rate := flag.Float64("rate", 1000, "Orders and cancels per second, across every session")
+	duration := flag.Duration("duration", 10*time.Second, "How long to send for")
+	drain := flag.Duration("drain", 2*time.Second, "How long to wait for answers once sending stops")
+	symbols := flag.String("symbols", "AAPL", "Comma-separated symbols to send orders on, each optionally SYMBOL:weight (e.g. AAPL:3,MSFT:1)")
+	mid := flag.Float64("mid", 100, "Price orders are sent around")
+	width := flag.Float64("width", 1, "How far from -mid prices go, the most for uniform, the standard deviation for normal")
+	prices := flag.String("prices", "uniform", "Distribution of prices around -mid: 'uniform' or 'normal'")
+	tick := flag.Float64("tick", 0.01, "Prices are rounded to a whole number of ticks of this size")
+	maxQty := flag.Uint64("maxqty", 100, "Orders are for 1 to this many lots, uniformly")
+	cancelRatio := flag.Float64("cancel", 0.3, "Fraction of messages which cancel a resting order, where there is one")
+	seed := flag.Int64("seed", 0, "Seed the order flow is drawn from, from the clock if 0")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 || *sessions < 1 || *rate <= 0 || *maxQty < 1 || *tick <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *cancelRatio < 0 || *cancelRatio >= 1 {
+		log.Fatalf("Invalid cancel ratio %v, must be at least 0 and under 1", *cancelRatio)
+	}
+
+	weighted, err := parseSymbols(*symbols)
+	if err != nil {
+		log.Fatalf("Invalid symbols: %v", err)
+	}
+	var price func(rng *rand.Rand) float64
+	switch *prices {
+	case "uniform":
+		price = func(rng *rand.Rand) float64 { return *mid + (2*rng.Float64()-1)**width }
+	case "normal":
+		price = func(rng *rand.Rand) float64 { return *mid + rng.NormFloat64()**width }
+	default:
+		log.Fatalf("Invalid price distribution %q", *prices)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	flow := orderFlow{
+		symbols: weighted,
+		price: func(rng *rand.Rand) float64 {
+			return max(math.Round(price(rng) / *tick), 1) * *tick
+		},
+		maxQty:      *maxQty,
+		cancelRatio: *cancelRatio,
+	}
+
+	// Every session logs on before any sends, so they all start together.
+	stats := &loadStats{}
+	var loaded []*session
+	for i := range *sessions {
+		name := *owner + strconv.Itoa(i+1)
+		s, err := logon(*serverAddr, name, *secret, stats)
+		if err != nil {
+			log.Fatalf("Unable to log on as %s: %v", name, err)
+		}
+		defer s.conn.Close()
+		loaded = append(loaded, s)
+	}
+	fmt.Printf("Logged on %d sessions, sending %.0f messages per second for %v\n", *sessions, *rate, *duration)
+
+	interval := time.Duration(float64(*sessions) * float64(time.Second) / *rate)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, s := range loaded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Staggered, so sessions don't all send at once.
+			begin := start.Add(interval * time.Duration(i) / time.Duration(len(loaded)))
+			if err := s.send(flow, rand.New(rand.NewSource(*seed+int64(i))), begin, start.Add(*duration), interval); err != nil {
+				log.Printf("Session %s stopped sending: %v", s.owner, err)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	time.Sleep(*drain)
+	stats.print(elapsed)
+}
+
+// weightedSymbol is a symbol orders are sent on, picked in proportion to its
+// weight.
+type weightedSymbol struct {
+	symbol string
+	weight float64
+}
+
+func parseSymbols(spec string) ([]weightedSymbol, error) {
+	var symbols []weightedSymbol
+	for _, part := range strings.Split(spec, ",") {
+		symbol, weight, found := strings.Cut(strings.TrimSpace(part), ":")
+		if symbol == "" || len(symbol) > 4 {
+			return nil, fmt.Errorf("%q is not a symbol of 1 to 4 characters", part)
+		}
+		w := 1.0
+		if found {
+			var err error
+			if w, err = strconv.ParseFloat(weight, 64); err != nil || w <= 0 {
+				return nil, fmt.Errorf("%q has no positive weight", part)
+			}
+		}
+		symbols = append(symbols, weightedSymbol{symbol: symbol, weight: w})
+	}
+	return symbols, nil
+}
+
+// orderFlow draws the orders and cancels sessions send.
+type orderFlow struct {
+	symbols     []weightedSymbol
+	price       func(rng *rand.Rand) float64
+	maxQty      uint64
+	cancelRatio float64
+}
+
+func (flow orderFlow) symbol(rng *rand.Rand) string {
+	total := 0.0
+	for _, s := range flow.symbols {
+		total += s.weight
+	}
+	pick := rng.Float64() * total
+	for _, s := range flow.symbols {
+		if pick -= s.weight; pick < 0 {
+			return s.symbol
+		}
+	}
+	return flow.symbols[len(flow.symbols)-1].symbol
+}
+
+// loadStats is what every session has sent and been answered with.
+type loadStats struct {
+	orders, cancels                   atomic.Uint64 // Sent
+	acked, filled, cancelled, refused atomic.Uint64 // Answered
+	errors                            atomic.Uint64 // Messages rejected outright
+	orderLatency, cancelLatency       fenrirNet.LatencyHistogram
+}
+
+func (stats *loadStats) print(elapsed time.Duration) {
+	sent := stats.orders.Load() + stats.cancels.Load()
+	fmt.Printf("Sent %d orders and %d cancels in %v, %.0f messages per second\n",
+		stats.orders.Load(), stats.cancels.Load(), elapsed.Round(time.Millisecond), float64(sent)/elapsed.Seconds())
+	fmt.Printf("Orders acknowledged %d, fills %d, cancelled %d, cancels rejected %d, errors %d\n",
+		stats.acked.Load(), stats.filled.Load(), stats.cancelled.Load(), stats.refused.Load(), stats.errors.Load())
+	if unanswered := int64(sent) - int64(stats.acked.Load()+stats.cancelled.Load()+stats.refused.Load()+stats.errors.Load()); unanswered > 0 {
+		fmt.Printf("Unanswered %d\n", unanswered)
+	}
+	for _, latency := range []struct {
+		of    string
+		stats fenrirNet.LatencyStats
+	}{{"order", stats.orderLatency.Stats()}, {"cancel", stats.cancelLatency.Stats()}} {
+		fmt.Printf("%s latency: count %d, mean %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v\n",
+			latency.of, latency.stats.Count, latency.stats.Mean, latency.stats.P50, latency.stats.P90, latency.stats.P99, latency.stats.P999, latency.stats.Max)
+	}
+}
+
+// session is a logged on connection sending order flow and reading back what
+// it is answered with.
+type session struct {
+	owner string
+	conn  net.Conn
+	stats *loadStats
+
+	lock      sync.Mutex
+	sentAt    map[uint64]time.Time // Orders and cancels not yet answered, by ClOrdID
+	resting   []uint64             // Acknowledged orders not yet filled or cancelled
+	cancelled map[uint64]bool      // Orders cancels were sent for, not yet answered
+}
+
+func logon(addr, owner, secret string, stats *loadStats) (*session, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(fenrirNet.Logon))
+	buf = append(buf, byte(len(owner)))
+	buf = append(buf, owner...)
+	timestamp := uint64(time.Now().UnixNano())
+	buf = binary.BigEndian.AppendUint64(buf, timestamp)
+	buf = append(buf, fenrirNet.SignLogon(owner, timestamp, secret)...)
+	buf = binary.BigEndian.AppendUint32(buf, 0)
+	if _, err := conn.Write(buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &session{owner: owner, conn: conn, stats: stats, sentAt: make(map[uint64]time.Time), cancelled: make(map[uint64]bool)}
+	logons := make(chan fenrirNet.SessionNotice, 1)
+	go s.read(logons)
+	select {
+	case notice := <-logons:
+		if notice != fenrirNet.LogonAccepted {
+			conn.Close()
+			return nil, fmt.Errorf("logon refused (notice %d)", notice)
+		}
+	case <-time.After(5 * time.Second):
+		conn.Close()
+		return nil, errors.New("no answer to logon")
+	}
+	return s, nil
+}
+
+// send sends order flow from begin until end, a message every interval.
+func (s *session) send(flow orderFlow, rng *rand.Rand, begin, end time.Time, interval time.Duration) error {
+	order := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.NewOrderMessageHeaderLen+1)
+	binary.BigEndian.PutUint16(order[0:2], uint16(fenrirNet.NewOrder))
+	cancel := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(cancel[0:2], uint16(fenrirNet.CancelOrder))
+
+	var clOrdID uint64
+	for next := begin; next.Before(end); next = next.Add(interval) {
+		time.Sleep(time.Until(next))
+
+		frame := order
+		s.lock.Lock()
+		if len(s.resting) > 0 && rng.Float64() < flow.cancelRatio {
+			i := rng.Intn(len(s.resting))
+			id := s.resting[i]
+			s.resting[i] = s.resting[len(s.resting)-1]
+			s.resting = s.resting[:len(s.resting)-1]
+			s.cancelled[id] = true
+			binary.BigEndian.PutUint64(cancel[4+fenrirNet.UUIDLen:], id)
+			frame = cancel
+			s.sentAt[id] = time.Now()
+			s.stats.cancels.Add(1)
+		} else {
+			clOrdID++
+			putOrder(order[fenrirNet.BaseMessageHeaderLen:], flow.symbol(rng), common.Side(rng.Intn(2)), flow.price(rng), 1+uint64(rng.Int63n(int64(flow.maxQty))), clOrdID)
+			s.sentAt[clOrdID] = time.Now()
+			s.stats.orders.Add(1)
+		}
+		s.lock.Unlock()
+
+		if _, err := s.conn.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putOrder writes a day limit order, without its message type, into buf.
+func putOrder(buf []byte, symbol string, side common.Side, price float64, qty, clOrdID uint64) {
+	binary.BigEndian.PutUint16(buf[0:2], uint16(common.Equities))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(common.LimitOrder))
+	clear(buf[4:8])
+	copy(buf[4:8], symbol)
+	binary.BigEndian.PutUint64(buf[8:16], math.Float64bits(price))
+	binary.BigEndian.PutUint64(buf[16:24], qty)
+	buf[24] = byte(side)
+	buf[25] = byte(common.Day)
+	binary.BigEndian.PutUint64(buf[26:34], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint64(buf[34:42], clOrdID)
+}
+
+// read reads reports until the connection closes, passing on the notice the
+// logon is answered with.
+func (s *session) read(logons chan<- fenrirNet.SessionNotice) {
+	buf := make([]byte, 0, 64<<10)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := s.conn.Read(buf[len(buf):cap(buf)])
+		if err != nil {
+			return
+		}
+		buf = buf[:len(buf)+n]
+
+		read := 0
+		for len(buf)-read > fenrirNet.SequenceHeaderLen {
+			report := buf[read+fenrirNet.SequenceHeaderLen:]
+			n, err := fenrirNet.ReportLen(report)
+			if errors.Is(err, fenrirNet.ErrReportTooShort) {
+				break
+			}
+			if err != nil {
+				log.Printf("Session %s unable to read report: %v", s.owner, err)
+				return
+			}
+			s.handle(report[:n], logons)
+			read += fenrirNet.SequenceHeaderLen + n
+		}
+		buf = buf[:copy(buf, buf[read:])]
+	}
+}
+
+// handle counts a report, timing the order or cancel it answers.
+func (s *session) handle(report []byte, logons chan<- fenrirNet.SessionNotice) {
+	now := time.Now()
+	answered := func(clOrdID uint64) (time.Time, bool) {
+		sentAt, ok := s.sentAt[clOrdID]
+		delete(s.sentAt, clOrdID)
+		return sentAt, ok
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch fenrirNet.ReportMessageType(report[0]) {
+	case fenrirNet.SessionReport:
+		r, _, err := fenrirNet.ParseReport(report)
+		if err == nil && logons != nil {
+			select {
+			case logons <- fenrirNet.SessionNotice(r.Status):
+			default:
+			}
+		}
+	case fenrirNet.OrderAckReport:
+		clOrdID := binary.BigEndian.Uint64(report[1:9])
+		if sentAt, ok := answered(clOrdID); ok {
+			s.stats.orderLatency.Observe(now.Sub(sentAt))
+		}
+		s.stats.acked.Add(1)
+		if status := common.OrderStatus(report[45]); status == common.OrderNew || status == common.OrderPartiallyFilled {
+			s.resting = append(s.resting, clOrdID)
+		}
+	case fenrirNet.ExecutionReport:
+		s.stats.filled.Add(1)
+		// Filled orders are no longer there to cancel.
+		if common.OrderStatus(report[90]) == common.OrderFilled {
+			clOrdID := binary.BigEndian.Uint64(report[56:64])
+			for i, id := range s.resting {
+				if id == clOrdID {
+					s.resting = append(s.resting[:i], s.resting[i+1:]...)
+					break
+				}
+			}
+		}
+	case fenrirNet.CancelAckReport, fenrirNet.CancelRejectReport:
+		clOrdID := binary.BigEndian.Uint64(report[1:9])
+		if sentAt, ok := answered(clOrdID); ok && s.cancelled[clOrdID] {
+			s.stats.cancelLatency.Observe(now.Sub(sentAt))
+		}
+		delete(s.cancelled, clOrdID)
+		if fenrirNet.ReportMessageType(report[0]) == fenrirNet.CancelAckReport {
+			s.stats.cancelled.Add(1)
+		} else {
+			s.stats.refused.Add(1)
+		}
+	case fenrirNet.ErrorReport:
+		s.stats.errors.Add(1)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/wal"
+
+	"github.com/rs/zerolog"
+)
+
+const usage = `replay feeds the commands in a write ahead log to a fresh engine, as many
+times as asked, and checks every run leaves the books and trade tape byte for
+byte the same, and the same as the exchange's, for debugging matching and
+validating disaster recovery. It exits 1 if they differ.
+
+Usage:
+  replay [flags] WAL
+
+With -from, the log is replayed over the snapshot the server took as it
+started it, otherwise from empty books. With -books, what the replay leaves on
+the books is checked against a snapshot taken as the log ended, e.g. at
+shutdown. With -tape, the trades it makes are checked against the server's
+-tape of the log's run. Replays match as they did the first time around only
+if the instruments and market makers are as they were.
+
+Flags:
+`
+
+func main() {
+	fromPath := flag.String("from", "", "Snapshot the log is replayed over, as the server's -snapshot on startup, empty books if empty")
+	booksPath := flag.String("books", "", "Snapshot the books replayed to are checked against, not checked if empty")
+	tapePath := flag.String("tape", "", "Trade tape the trades replayed are checked against, as the server's -tape, not checked if empty")
+	runs := flag.Int("runs", 2, "How many times the log is replayed, each on a fresh engine, every run checked against the first")
+	instruments := flag.String("instruments", "", "Comma-separated ticker:qtyScale:priceScale instruments to register, as the server's -instruments")
+	marketMakers := flag.String("marketmakers", "", "Comma-separated owners given designated market maker priority, as the server's -marketmakers")
+	mmAllocation := flag.Uint64("mmallocation", 0, "Percent of each fill allocated to market makers, as the server's -mmallocation")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *runs < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Only what differs is of interest, not the engine's account of
+	// replaying.
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	setup := func() *engine.Engine {
+		eng := engine.New(common.Equities)
+		if *instruments != "" {
+			for _, spec := range strings.Split(*instruments, ",") {
+				inst, err := common.ParseInstrument(common.Equities, spec)
+				if err != nil {
+					log.Fatalf("Invalid instrument: %v", err)
+				}
+				if err := eng.RegisterInstrument(inst); err != nil {
+					log.Fatalf("Unable to register instrument %s: %v", inst.Ticker, err)
+				}
+			}
+		}
+		if *marketMakers != "" {
+			for _, owner := range strings.Split(*marketMakers, ",") {
+				if err := eng.SetPriorityClass(owner, common.MarketMakerClass); err != nil {
+					log.Fatalf("Unable to set market maker: %v", err)
+				}
+			}
+		}
+		if err := eng.SetAllocation(common.MarketMakerClass, *mmAllocation); err != nil {
+			log.Fatalf("Unable to set market maker allocation: %v", err)
+		}
+		return eng
+	}
+
+	var from common.Snapshot
+	if *fromPath != "" {
+		var err error
+		if from, err = engine.LoadSnapshot(*fromPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cmds, err := wal.Read(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Unable to read wal: %v", err)
+	}
+
+	var first engine.ReplayState
+	for run := 1; run <= *runs; run++ {
+		state, err := engine.ReplayFresh(setup, from, cmds)
+		if err != nil {
+			log.Fatalf("Unable to replay wal: %v", err)
+		}
+		if run == 1 {
+			first = state
+			fmt.Printf("Replayed %d commands, %d trades\n", len(cmds), bytes.Count(state.Tape, []byte("\n")))
+			continue
+		}
+		if err := state.Check(first); err != nil {
+			fmt.Printf("Run %d: %v\n", run, err)
+			os.Exit(1)
+		}
+	}
+	if *runs > 1 {
+		fmt.Printf("%d runs match\n", *runs)
+	}
+
+	diverged := false
+	if *booksPath != "" {
+		want, err := engine.LoadSnapshot(*booksPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		books, err := json.Marshal(want.Books)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := engine.CheckBooks(first.Books, books); err != nil {
+			fmt.Printf("Books: %v\n", err)
+			var replayed []common.BookState
+			if err := json.Unmarshal(first.Books, &replayed); err != nil {
+				log.Fatal(err)
+			}
+			for _, diff := range engine.DiffSnapshots(common.Snapshot{Books: replayed}, common.Snapshot{Books: want.Books}) {
+				fmt.Println(diff)
+			}
+			diverged = true
+		} else {
+			fmt.Println("Books match")
+		}
+	}
+	if *tapePath != "" {
+		want, err := os.ReadFile(*tapePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := engine.CheckTape(first.Tape, want); err != nil {
+			fmt.Printf("Tape: %v\n", err)
+			diverged = true
+		} else {
+			fmt.Println("Tape matches")
+		}
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
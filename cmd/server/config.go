@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fenrir/internal/common"
+	"fenrir/internal/config"
+	"fenrir/internal/engine"
+	"fenrir/internal/events"
+	"fenrir/internal/net"
+	"fenrir/internal/prices"
+	"fenrir/internal/quoter"
+	"fenrir/internal/tradestore"
+	"fenrir/internal/wal"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checks validate the flags whose values are parsed once the server is being
+// set up, so -check can tell a config is bad without starting it.
+func checks() map[string]config.Check {
+	ports := func(allowNone bool) config.Check {
+		return func(value string) error {
+			port, err := strconv.Atoi(value)
+			if err != nil || port < 0 || port > 65535 || (port == 0 && !allowNone) {
+				return fmt.Errorf("%q is not a port", value)
+			}
+			return nil
+		}
+	}
+	return map[string]config.Check{
+		"assets": each(func(spec string) error {
+			_, err := common.ParseAssetType(spec)
+			return err
+		}),
+		"port":      ports(false),
+		"feedport":  ports(false),
+		"wsport":    ports(true),
+		"restport":  ports(true),
+		"adminport": ports(true),
+		"instruments": each(func(spec string) error {
+			_, err := common.ParseInstrument(common.Equities, spec)
+			return err
+		}),
+		"strategies": each(func(spec string) error {
+			_, err := common.ParseStrategy(common.Equities, spec)
+			return err
+		}),
+		"options": each(func(spec string) error {
+			_, err := common.ParseOption(common.Equities, spec)
+			return err
+		}),
+		"prorata": each(func(spec string) error {
+			_, _, err := engine.ParseProRata(spec)
+			return err
+		}),
+		"ladder": each(func(spec string) error {
+			_, _, err := engine.ParsePriceLadder(spec)
+			return err
+		}),
+		"calendars": each(func(spec string) error {
+			_, err := common.ParseTradingCalendar(spec)
+			return err
+		}),
+		"perpetuals": each(func(spec string) error {
+			_, err := common.ParsePerpetual(common.Equities, spec)
+			return err
+		}),
+		"shards": func(value string) error {
+			if shards, _ := strconv.Atoi(value); shards < 1 {
+				return errors.New("at least one shard is needed")
+			}
+			return nil
+		},
+		"pricing": func(value string) error {
+			_, err := common.ParsePricingModel(value)
+			return err
+		},
+		"policy": func(value string) error {
+			switch strings.ToLower(value) {
+			case "fifo", "random":
+				return nil
+			}
+			return fmt.Errorf("unknown matching policy %q", value)
+		},
+		"mmallocation": func(value string) error {
+			if allocation, _ := strconv.ParseUint(value, 10, 64); allocation > 100 {
+				return errors.New("more than 100 percent")
+			}
+			return nil
+		},
+		"disclosure": func(value string) error {
+			_, err := net.ParseDisclosure(value)
+			return err
+		},
+		"brokers": each(func(spec string) error {
+			if _, _, ok := strings.Cut(spec, ":"); !ok {
+				return fmt.Errorf("broker %q has no owners", spec)
+			}
+			return nil
+		}),
+		"queuepolicy": func(value string) error {
+			_, err := net.ParseOverflowPolicy(value)
+			return err
+		},
+		"tracesample": func(value string) error {
+			if fraction, _ := strconv.ParseFloat(value, 64); fraction < 0 || fraction > 1 {
+				return fmt.Errorf("%s is not between 0 and 1", value)
+			}
+			return nil
+		},
+		"speed": func(value string) error {
+			if speed, _ := strconv.ParseFloat(value, 64); !(speed > 0) {
+				return errors.New("clock speed must be positive")
+			}
+			return nil
+		},
+		"epoch": optional(func(value string) error {
+			_, err := time.Parse(time.RFC3339, value)
+			return err
+		}),
+		"walsync": func(value string) error {
+			_, err := wal.ParseSyncPolicy(value)
+			return err
+		},
+		"tradedb": optional(func(value string) error {
+			driver, _, ok := strings.Cut(value, ":")
+			if !ok {
+				return fmt.Errorf("%q is not driver:dsn", value)
+			}
+			_, err := tradestore.DialectOf(driver)
+			return err
+		}),
+		"eventtopics": func(value string) error {
+			_, err := events.ParseTopics(value)
+			return err
+		},
+		"quote": each(func(spec string) error {
+			_, err := quoter.ParseSymbol(spec)
+			return err
+		}),
+		"indexsources": each(func(spec string) error {
+			_, err := prices.ParseSource(spec, prices.DefaultPollInterval)
+			return err
+		}),
+		"risklimits": optional(func(value string) error {
+			_, err := net.ParseRiskLimits(value)
+			return err
+		}),
+		"positionlimits": optional(func(value string) error {
+			_, err := common.ParsePositionLimits(value)
+			return err
+		}),
+		"scanranges": optional(func(value string) error {
+			_, err := common.ParseScanRanges(value)
+			return err
+		}),
+		"datatiers": optional(func(value string) error {
+			_, err := common.ParseDataTiers(value)
+			return err
+		}),
+		"anonymoustier": func(value string) error {
+			_, err := common.ParseDataTier(value)
+			return err
+		},
+		"refprices": optional(func(value string) error {
+			_, err := net.ParseReferencePrices(value)
+			return err
+		}),
+	}
+}
+
+// optional checks a flag only if it is set.
+func optional(check config.Check) config.Check {
+	return func(value string) error {
+		if value == "" {
+			return nil
+		}
+		return check(value)
+	}
+}
+
+// each checks every comma-separated spec a flag is set to.
+func each(check config.Check) config.Check {
+	return optional(func(value string) error {
+		var errs []error
+		for _, spec := range strings.Split(value, ",") {
+			errs = append(errs, check(spec))
+		}
+		return errors.Join(errs...)
+	})
+}
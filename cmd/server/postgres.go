@@ -0,0 +1,7 @@
+//go:build !nopostgres
+
+package main
+
+// Links the Postgres driver, for -tradedb postgres:<connection string>. Builds
+// tagged nopostgres leave it out.
+import _ "github.com/lib/pq"
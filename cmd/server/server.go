@@ -2,27 +2,755 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fenrir/internal/audit"
+	"fenrir/internal/backoffice"
 	"fenrir/internal/common"
+	"fenrir/internal/config"
 	"fenrir/internal/engine"
+	"fenrir/internal/events"
 	"fenrir/internal/net"
+	"fenrir/internal/participants"
+	"fenrir/internal/prices"
+	"fenrir/internal/quoter"
+	"fenrir/internal/tracing"
+	"fenrir/internal/tradestore"
+	"fenrir/internal/wal"
+	"flag"
+	"io/fs"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	ctx, stop := signal.NotifyContext(
+	configPath := flag.String("config", "", "YAML file of settings keyed by flag name, overridden by FENRIR_<FLAG> environment variables and flags, none if empty")
+	check := flag.Bool("check", false, "Check the configuration is valid and exit, rather than starting the server")
+	host := flag.String("host", "0.0.0.0", "Address the server, feed, WebSocket gateway and REST API listen on")
+	port := flag.Int("port", 9001, "Port of the order entry server")
+	certFile := flag.String("cert", "", "PEM certificate sessions are served over TLS with, plain TCP if empty")
+	keyFile := flag.String("key", "", "PEM key of -cert")
+	ticketKeys := flag.String("ticketkeys", "", "File of hex TLS session ticket keys, one a line, the first issuing tickets, so clients can resume their sessions across restarts (keys made afresh each start if empty)")
+	feedPort := flag.Int("feedport", 9002, "Port of the market data feed")
+	assets := flag.String("assets", "equities", "Comma-separated asset types traded, 'equities' or 'crypto'")
+	calendars := flag.String("calendars", "", "Comma-separated scope=preOpen/open/close@location trading calendars of symbols or asset types, trading weekdays, the pre-open and location (UTC) optional, symbols with none trading continuously (e.g. equities=08:00/09:30/16:00@America/New_York)")
+	queuePreOpen := flag.Bool("queuepreopen", false, "Hold orders sent in a -calendars pre-open for the open, rather than refusing them")
+	auction := flag.Bool("auction", false, "Gather orders sent in a -calendars pre-open in an opening auction, uncrossing at the price executing the most volume as the symbol opens, rather than refusing or holding them")
+	certify := flag.Duration("certify", 0, "Certify every session logging on, running it through acks, cancels, heartbeats and gap recovery with this long to pass each, for a test environment (0 off)")
+	certDir := flag.String("certdir", "", "Directory -certify reports are written to as JSON, only kept in memory if empty")
+	gtcPath := flag.String("gtc", "fenrir-gtc.json", "File good-till-cancel orders are persisted to across restarts")
+	snapshotPath := flag.String("snapshot", "", "File the books are snapshotted to and restored from across restarts, in place of -gtc, none if empty")
+	snapshotEvery := flag.Duration("snapshotevery", time.Minute, "How often the books are snapshotted to -snapshot, as well as at shutdown and when an admin asks (0 only then)")
+	auditPath := flag.String("audit", "", "File the order event audit trail is appended to, none if empty")
+	walPath := flag.String("wal", "", "File every command is written ahead to before it is applied, and replayed over -snapshot on startup, none if empty")
+	walSync := flag.String("walsync", "always", "When the -wal is synced to disk: 'always' (every command), 'interval' or 'never' (left to the OS)")
+	walSyncInterval := flag.Duration("walsyncinterval", 10*time.Millisecond, "How often an 'interval' -walsync syncs the -wal")
+	tapePath := flag.String("tape", "", "File the trade tape of the -wal's run is written to, a trade a line, for replaying the -wal to be checked against (see cmd/replay), none if empty")
+	tradeDB := flag.String("tradedb", "", "Database every trade is kept in, as driver:dsn (e.g. sqlite3:fenrir.db or postgres:postgres://...), none if empty. SQLite needs a cgo build")
+	retainTrades := flag.Int("retaintrades", engine.DefaultRetainedTrades, "How many of the latest trades are still kept in memory with a -tradedb (0 keeps them all)")
+	eventsAddr := flag.String("events", "", "Broker order events and trades are streamed to, nats://host:port or the http(s) URL of a Kafka REST proxy, none if empty")
+	eventTopics := flag.String("eventtopics", "", "Comma-separated assetType:orders:trades topics -events are published on, fenrir.<asset type>.orders and .trades for any left out")
+	settlementDir := flag.String("settlement", "", "Directory end of day settlement files are written to as the exchange closes, or an admin asks, none if empty")
+	reconcileInterval := flag.Duration("reconcile", 0, "How often to reconcile positions against the audit trail (0 only on SIGUSR1), needs -audit")
+	credentials := flag.String("credentials", "", "File of owner:secret lines logons are authenticated against, logons are not authenticated if empty")
+	admins := flag.String("admins", "", "Comma-separated owners allowed to send admin messages")
+	observers := flag.String("observers", "", "Comma-separated owners allowed drop copies of execution reports")
+	disclosure := flag.String("disclosure", "full", "How much execution reports tell parties of who they traded with: 'full' (their owner), 'anonymized' (an ID standing in for them) or 'hidden'")
+	disclosureKey := flag.String("disclosurekey", "", "Secret 'anonymized' counterparty IDs are keyed by, so they stay the same across restarts, random if empty")
+	brokers := flag.String("brokers", "", "Comma-separated brokers and the owners they may cancel orders for, each broker:owner|owner (e.g. acme:alice|bob)")
+	marketMakers := flag.String("marketmakers", "", "Comma-separated owners given designated market maker priority")
+	mmAllocation := flag.Uint64("mmallocation", 0, "Percent of each fill at a price level allocated to market makers ahead of time priority")
+	policy := flag.String("policy", "fifo", "Matching policy at a price level: 'fifo' or 'random' (size-weighted)")
+	seed := flag.Uint64("seed", 0, "Seed for the 'random' matching policy, 0 picks one from the clock")
+	shardCount := flag.Int("shards", 1, "Engines the books are spread over by symbol, each matching on a goroutine of its own, so orders on books of different ones are matched at once. More than one can't be used with -snapshot, -wal, -audit, -tape, -tradedb, -events, -quote, -compact or -perpetuals, and good-till-cancel orders are not kept across restarts")
+	ladders := flag.String("ladder", "", "Comma-separated ticker:ticks instruments liquid enough to keep the levels near their top of book in an array of price buckets, ticks wide (1024 if left out), rather than only a tree (e.g. AAPL:2048)")
+	proRata := flag.String("prorata", "", "Comma-separated ticker:minAllocation instruments matched pro-rata to resting size instead of by -policy, orders whose share is under the minimum lots given none and leftovers going in time priority (e.g. ES:2)")
+	idleTimeout := flag.Duration("idle", 0, "Disconnect sessions which send nothing, not even a heartbeat, for this long (0 never does)")
+	msgRate := flag.Float64("msgrate", 0, "Most messages a second each session may send, others rejected as throttled, heartbeats and cancels aside (0 for no limit)")
+	msgBurst := flag.Int("msgburst", 0, "Most messages a session may send at once within -msgrate, the rate rounded up if 0")
+	queueDepth := flag.Int("queuedepth", net.DefaultInputQueueDepth, "How many messages read off sessions may wait for the engine")
+	fairness := flag.Duration("fairness", 0, "How long after a message is read the engine waits for others read about the same time, to handle them in the order they were read rather than handed over, 0 to handle them as they come (e.g. 100us)")
+	queuePolicy := flag.String("queuepolicy", "block", "What happens to messages read while the engine's input queue is full: 'block' the session, 'reject' them as busy, or 'dropoldest' to reject the oldest queued instead")
+	writeQueue := flag.Int("writequeue", net.DefaultWriteQueueLen, "How many writes may wait on each session's connection before the client is disconnected as too slow")
+	captureDir := flag.String("capture", "", "Directory every byte exchanged over each TCP session is recorded to, for replaying in tests, none if empty")
+	otlp := flag.String("otlp", "", "OpenTelemetry collector messages are traced to over OTLP/HTTP, e.g. http://localhost:4318, none if empty")
+	traceSample := flag.Float64("tracesample", 1, "Fraction of messages traced to -otlp, between 0 and 1")
+	echoLatency := flag.Bool("echolatency", false, "Follow the reports each message causes with when it was read and they were written, for clients to measure latency by")
+	takeover := flag.Bool("takeover", false, "Let a duplicate logon take over the owner's active session, rather than rejecting it")
+	batchBytes := flag.Int("batchbytes", net.DefaultMaxReportBatchBytes, "Most bytes of reports a session may ask to have batched into one write (0 never batches)")
+	batchDelay := flag.Duration("batchdelay", net.DefaultMaxReportBatchDelay, "Longest a session may ask to have a report held back to be batched")
+	speed := flag.Float64("speed", 1, "Run the exchange clock this many times faster than real time, for simulations and backtests")
+	epoch := flag.String("epoch", "", "RFC 3339 time an accelerated exchange clock starts from, now if empty")
+	participantsPath := flag.String("participants", "fenrir-participants.json", "File participants onboarded by admins are registered in")
+	quotes := flag.String("quote", "", "Comma-separated ticker:mid:spread:size test symbols the built in quoter makes a market in and answers RFQs on")
+	quoterOwner := flag.String("quoter", quoter.DefaultOwner, "Owner the built in quoter's orders belong to")
+	wsPort := flag.Int("wsport", 9003, "Port of the WebSocket gateway for JSON clients, 0 to not run one")
+	restPort := flag.Int("restport", 9004, "Port of the REST API, 0 to not run one")
+	adminPort := flag.Int("adminport", 0, "Port the admin endpoints are served on apart from the REST API, 0 to serve them with it")
+	adminCert := flag.String("admincert", "", "PEM certificate the -adminport API is served over TLS with, plain HTTP if empty")
+	adminKey := flag.String("adminkey", "", "PEM key of -admincert")
+	adminCA := flag.String("adminca", "", "PEM CA certificates -adminport clients must present a certificate signed by, any client if empty")
+	drainTimeout := flag.Duration("drain", 10*time.Second, "How long sessions are given on SIGTERM to have what they already sent handled and their reports written, before the server stops")
+	drainCancel := flag.Bool("draincancel", false, "Cancel every resting order as the server drains on SIGTERM, rather than leaving GTC orders to be saved")
+	netting := flag.Duration("netting", 0, "How often market makers are sent netting reports of their fills (0 never)")
+	netOwners := flag.String("netowners", "", "Comma-separated owners sent netting reports, the market makers if empty")
+	compact := flag.Duration("compact", 0, "Compact the engine once no commands have been handled for this long (0 never does)")
+	levelTTL := flag.Duration("levelttl", 0, "How long price levels and books go untouched before they are counted stale, empty books made for unlisted tickers being dropped by -compact once they are (0 never are)")
+	reap := flag.Duration("reap", 0, "Probe connections which send nothing for this long, closing them if they still do not answer (0 never does)")
+	abandon := flag.Duration("abandon", net.DefaultAbandonAfter, "Drop the sessions of owners disconnected for this long, when reaping")
+	instruments := flag.String("instruments", "", "Comma-separated ticker:qtyScale:priceScale instruments to register, others are whole lots priced in cents")
+	strategies := flag.String("strategies", "", "Comma-separated ticker:kind:leg|leg multi-leg strategies to register, kind being 'vertical' (buying the first leg, selling the second) or 'straddle'")
+	options := flag.String("options", "", "Comma-separated ticker:underlying:kind:strike:expiry options to list, kind being 'call' or 'put' and expiry a date (e.g. C100:AAPL:call:100:2026-12-18)")
+	pricing := flag.String("pricing", "blackscholes:30:5", "What listed options are valued with for the analytics feed, 'intrinsic' or 'blackscholes:vol%:rate%'")
+	perpetuals := flag.String("perpetuals", "", "Comma-separated ticker:index:interval:cap% perpetuals to list, funded every interval from midnight UTC at the premium over the index, capped at cap% if set (e.g. BTCP:BTC:8h:0.75)")
+	indexSources := flag.String("indexsources", "", "Comma-separated kind:url sources of index prices from outside the exchange, most preferred first, kind being 'rest' (polled for a {\"ticker\": price} object) or 'ws' (streaming {\"ticker\", \"price\"} messages)")
+	indexPoll := flag.Duration("indexpoll", prices.DefaultPollInterval, "How often REST -indexsources are polled")
+	indexStale := flag.Duration("indexstale", prices.DefaultStaleAfter, "How long an index price is used without being updated before failing over to the next source")
+	riskLimits := flag.String("risklimits", "", "Comma-separated owner:maxQty:maxNotional:collar% pre-trade limits new orders are checked against, any left empty unchecked, owner '*' for everyone else (e.g. *:1000:50000:5)")
+	positionLimits := flag.String("positionlimits", "", "Comma-separated owner:ticker:maxLong:maxShort position limits in lots, either left empty unchecked, owner '*' for everyone else in the ticker (e.g. *:AAPL:1000:1000)")
+	portfolioMargin := flag.String("portfoliomargin", "", "Comma-separated owners whose positions are portfolio margined, netting those priced off the same underlying, rather than each valued in full")
+	scanRanges := flag.String("scanranges", "", "Comma-separated ticker:percent moves of each underlying portfolio margin is worked out over, 15% for any not given (e.g. BTC:25)")
+	referencePrices := flag.String("refprices", "", "Comma-separated ticker:price reference prices -risklimits collars are around until each ticker trades")
+	dataTiers := flag.String("datatiers", "", "Comma-separated owner:tier market data entitlements, tier being full for every level, depth for the top 5 or bbo for the top of book, anyone else seeing every level (e.g. alice:bbo,bob:depth)")
+	anonymousTier := flag.String("anonymoustier", "full", "Market data tier of feed subscribers and WebSocket sessions which have not logged on: full, depth or bbo")
+	riskURL := flag.String("risk", "", "URL of an external risk service every new order is checked with before it is placed, none if empty")
+	riskTimeout := flag.Duration("risktimeout", net.DefaultRiskTimeout, "How long the risk service is given to answer for each order")
+	riskFailOpen := flag.Bool("riskfailopen", false, "Place orders the risk service did not answer for in time, rather than rejecting them")
+	flag.Parse()
+
+	if *configPath == "" {
+		*configPath = os.Getenv(config.EnvName("config"))
+	}
+	var settings map[string]string
+	if *configPath != "" {
+		var err error
+		if settings, err = config.Load(*configPath); err != nil {
+			log.Fatal().Err(err).Msg("unable to load config")
+		}
+	}
+	if err := config.Apply(flag.CommandLine, settings, os.Getenv); err != nil {
+		log.Fatal().Err(err).Msg("invalid config")
+	}
+	if err := config.Validate(flag.CommandLine, checks()); err != nil {
+		log.Fatal().Err(err).Msg("invalid config")
+	}
+	if *check {
+		log.Info().Str("config", *configPath).Msg("config is valid")
+		return
+	}
+
+	signals, stop := signal.NotifyContext(
 		context.Background(),
 		syscall.SIGTERM,
 		syscall.SIGINT,
 	)
 	defer stop()
+	// Everything runs until the server has drained, after being signalled.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Setup the TCP server and the matching engine.
-	eng := engine.New(common.Equities)
-	srv := net.New("0.0.0.0", 9001, eng)
-	eng.SetReporter(srv)
+	var supported []common.AssetType
+	for _, name := range strings.Split(*assets, ",") {
+		assetType, err := common.ParseAssetType(name)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to start engine")
+		}
+		supported = append(supported, assetType)
+	}
+	if *shardCount > 1 {
+		// Each of these works on a single engine's books.
+		for name, set := range map[string]bool{
+			"snapshot":   *snapshotPath != "",
+			"wal":        *walPath != "",
+			"audit":      *auditPath != "",
+			"tape":       *tapePath != "",
+			"tradedb":    *tradeDB != "",
+			"events":     *eventsAddr != "",
+			"quote":      *quotes != "",
+			"compact":    *compact > 0,
+			"perpetuals": *perpetuals != "",
+		} {
+			if set {
+				log.Fatal().Str("flag", name).Int("shards", *shardCount).Msg("unable to shard the engine")
+			}
+		}
+		log.Warn().Int("shards", *shardCount).Msg("good-till-cancel orders are not kept across restarts with shards")
+	}
+	engines := make([]*engine.Engine, *shardCount)
+	for i := range engines {
+		engines[i] = engine.New(supported...)
+	}
+	// Everything only supported on a single engine uses the first.
+	eng := engines[0]
+	var clock common.Clock = common.SystemClock{}
+	if *speed != 1 {
+		if *speed <= 0 {
+			log.Fatal().Float64("speed", *speed).Msg("clock speed must be positive")
+		}
+		start := time.Now()
+		if *epoch != "" {
+			var err error
+			if start, err = time.Parse(time.RFC3339, *epoch); err != nil {
+				log.Fatal().Err(err).Msg("invalid clock epoch")
+			}
+		}
+		log.Info().Float64("speed", *speed).Time("epoch", start).Msg("accelerated exchange clock")
+		clock = common.NewAcceleratedClock(start, *speed)
+	}
+	for _, eng := range engines {
+		eng.SetClock(clock)
+		eng.SetLevelTTL(*levelTTL)
+	}
+	var auditors engine.Auditors
+	if *auditPath != "" {
+		// Candle history is rebuilt from the trades of earlier runs.
+		trades, err := audit.ReadTrades(*auditPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Fatal().Err(err).Msg("unable to restore candles")
+		}
+		eng.RestoreCandles(trades)
+		log.Info().Int("trades", len(trades)).Msg("restored candles")
+
+		auditLog, err := audit.Open(*auditPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open audit log")
+		}
+		defer func() {
+			if err := auditLog.Close(); err != nil {
+				log.Error().Err(err).Msg("unable to close audit log")
+			}
+		}()
+		eng.SetAuditor(auditLog)
+		auditors = append(auditors, auditLog)
+	}
+	// Instruments must be registered before any orders for them are restored.
+	if *instruments != "" {
+		for _, spec := range strings.Split(*instruments, ",") {
+			inst, err := common.ParseInstrument(common.Equities, spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to register instrument")
+			}
+			for _, eng := range engines {
+				if err := eng.RegisterInstrument(inst); err != nil {
+					log.Fatal().Err(err).Str("ticker", inst.Ticker).Msg("unable to register instrument")
+				}
+			}
+		}
+	}
+	if *strategies != "" {
+		for _, spec := range strings.Split(*strategies, ",") {
+			strategy, err := common.ParseStrategy(common.Equities, spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to register strategy")
+			}
+			for _, eng := range engines {
+				if err := eng.RegisterStrategy(strategy); err != nil {
+					log.Fatal().Err(err).Str("ticker", strategy.Ticker).Msg("unable to register strategy")
+				}
+			}
+		}
+	}
+	if *options != "" {
+		for _, spec := range strings.Split(*options, ",") {
+			option, err := common.ParseOption(common.Equities, spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to list option")
+			}
+			for _, eng := range engines {
+				if err := eng.RegisterOption(option); err != nil {
+					log.Fatal().Err(err).Str("ticker", option.Ticker).Msg("unable to list option")
+				}
+			}
+		}
+	}
+	var perps []common.Perpetual
+	if *perpetuals != "" {
+		for _, spec := range strings.Split(*perpetuals, ",") {
+			perp, err := common.ParsePerpetual(common.Equities, spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to list perpetual")
+			}
+			if err := eng.RegisterPerpetual(perp); err != nil {
+				log.Fatal().Err(err).Str("ticker", perp.Ticker).Msg("unable to list perpetual")
+			}
+			perps = append(perps, perp)
+		}
+	}
+	model, err := common.ParsePricingModel(*pricing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid pricing model")
+	}
+	for _, eng := range engines {
+		eng.SetPricingModel(model)
+		if *marketMakers != "" {
+			for _, owner := range strings.Split(*marketMakers, ",") {
+				if err := eng.SetPriorityClass(owner, common.MarketMakerClass); err != nil {
+					log.Fatal().Err(err).Msg("unable to set market maker")
+				}
+			}
+		}
+		if err := eng.SetAllocation(common.MarketMakerClass, *mmAllocation); err != nil {
+			log.Fatal().Err(err).Msg("unable to set market maker allocation")
+		}
+	}
+	switch strings.ToLower(*policy) {
+	case "fifo":
+	case "random":
+		if *seed == 0 {
+			*seed = uint64(time.Now().UnixNano())
+		}
+		log.Info().Uint64("seed", *seed).Msg("random matching policy")
+		for _, eng := range engines {
+			eng.SetMatchPolicy(engine.NewRandomPolicy(*seed))
+		}
+	default:
+		log.Fatal().Str("policy", *policy).Msg("unknown matching policy")
+	}
+	if *proRata != "" {
+		for _, spec := range strings.Split(*proRata, ",") {
+			ticker, policy, err := engine.ParseProRata(spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid pro-rata instrument")
+			}
+			for _, eng := range engines {
+				eng.SetInstrumentPolicy(ticker, policy)
+			}
+		}
+	}
+	if *ladders != "" {
+		for _, spec := range strings.Split(*ladders, ",") {
+			ticker, ticks, err := engine.ParsePriceLadder(spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid price ladder")
+			}
+			for _, eng := range engines {
+				eng.SetPriceLadder(ticker, ticks)
+			}
+		}
+	}
+	feed := net.NewFeed(*host, *feedPort)
+	for _, eng := range engines {
+		eng.SetMarketDataPublisher(feed)
+	}
+	// Shards are served with new orders pipelined to them, so orders on
+	// different shards' books are matched at once.
+	var served interface {
+		net.Engine
+		participants.Onboarder
+		SetReporter(reporter engine.Reporter)
+	} = eng
+	if len(engines) > 1 {
+		shards := engine.NewShards(engines...)
+		defer shards.Close()
+		served = shards
+	}
+	srv := net.New(*host, *port, served)
+	served.SetReporter(srv)
+	if len(engines) > 1 {
+		if err := srv.SetPipelined(true); err != nil {
+			log.Fatal().Err(err).Msg("unable to shard the engine")
+		}
+	}
+	srv.SetClock(clock)
+	if *calendars != "" {
+		var schedule []common.TradingCalendar
+		for _, spec := range strings.Split(*calendars, ",") {
+			calendar, err := common.ParseTradingCalendar(spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid trading calendar")
+			}
+			schedule = append(schedule, calendar)
+		}
+		srv.SetTradingCalendars(schedule...)
+	}
+	srv.SetQueuePreOpen(*queuePreOpen)
+	srv.SetOpeningAuction(*auction)
+	if *certify > 0 {
+		if *certDir != "" {
+			if err := os.MkdirAll(*certDir, 0o755); err != nil {
+				log.Fatal().Err(err).Msg("unable to make certification report directory")
+			}
+		}
+		log.Warn().Dur("timeout", *certify).Msg("certifying every session logging on")
+		srv.SetCertification(*certify, *certDir)
+	}
+	if *certFile != "" {
+		config, err := net.ServerTLSConfig(*certFile, *keyFile, *ticketKeys)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid tls")
+		}
+		srv.SetTLS(config)
+	}
+	if *admins != "" {
+		srv.SetAdmins(strings.Split(*admins, ",")...)
+	}
+	if *observers != "" {
+		srv.SetObservers(strings.Split(*observers, ",")...)
+	}
+	counterparties, err := net.ParseDisclosure(*disclosure)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to set counterparty disclosure")
+	}
+	if err := srv.SetCounterpartyDisclosure(counterparties, []byte(*disclosureKey)); err != nil {
+		log.Fatal().Err(err).Msg("unable to set counterparty disclosure")
+	}
+	if *brokers != "" {
+		clients := make(map[string][]string)
+		for _, entry := range strings.Split(*brokers, ",") {
+			broker, owners, ok := strings.Cut(entry, ":")
+			if !ok {
+				log.Fatal().Str("broker", entry).Msg("broker has no owners")
+			}
+			clients[broker] = strings.Split(owners, "|")
+		}
+		srv.SetBrokers(clients)
+	}
+	srv.SetIdleTimeout(*idleTimeout)
+	overflow, err := net.ParseOverflowPolicy(*queuePolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to set input queue")
+	}
+	srv.SetInputQueue(*queueDepth, overflow)
+	srv.SetFairnessWindow(*fairness)
+	srv.SetMessageRate(*msgRate, *msgBurst)
+	srv.SetWriteQueueLen(*writeQueue)
+	srv.SetCaptureDir(*captureDir)
+	srv.SetLatencyEcho(*echoLatency)
+	if *otlp != "" {
+		tracer := tracing.New(tracing.NewOTLP(*otlp), *traceSample, tracing.DefaultBuffer)
+		defer func() {
+			if err := tracer.Close(); err != nil {
+				log.Error().Err(err).Msg("unable to close tracer")
+			}
+			if dropped := tracer.Dropped(); dropped > 0 {
+				log.Warn().Uint64("spans", dropped).Msg("spans never exported")
+			}
+		}()
+		srv.SetTracer(tracer)
+	}
+	if *netOwners == "" {
+		*netOwners = *marketMakers
+	}
+	if *netting > 0 && *netOwners != "" {
+		srv.SetNetting(strings.Split(*netOwners, ",")...)
+	}
+	if *credentials != "" {
+		secrets, err := net.LoadCredentials(*credentials)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load credentials")
+		}
+		srv.SetCredentials(secrets)
+	}
+	if *takeover {
+		srv.SetSessionPolicy(net.TakeoverDuplicateSession)
+	}
+	srv.SetReportBatchLimits(*batchBytes, *batchDelay)
+	tiers := make(map[string]common.DataTier)
+	if *dataTiers != "" {
+		if tiers, err = common.ParseDataTiers(*dataTiers); err != nil {
+			log.Fatal().Err(err).Msg("unable to set data tiers")
+		}
+	}
+	anonymous, err := common.ParseDataTier(*anonymousTier)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to set data tiers")
+	}
+	srv.SetDataTiers(tiers, anonymous)
+	feed.SetEntitler(srv)
+	if *riskLimits != "" {
+		limits, err := net.ParseRiskLimits(*riskLimits)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to set risk limits")
+		}
+		srv.SetRiskLimits(limits)
+	}
+	if *positionLimits != "" {
+		limits, err := common.ParsePositionLimits(*positionLimits)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to set position limits")
+		}
+		for _, eng := range engines {
+			for key, limit := range limits {
+				eng.SetPositionLimit(key.Owner, key.Ticker, limit)
+			}
+		}
+	}
+	if *portfolioMargin != "" {
+		for _, owner := range strings.Split(*portfolioMargin, ",") {
+			for _, eng := range engines {
+				eng.SetMarginMode(owner, common.PortfolioMargin)
+			}
+		}
+	}
+	if *scanRanges != "" {
+		ranges, err := common.ParseScanRanges(*scanRanges)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to set scan ranges")
+		}
+		for _, eng := range engines {
+			for ticker, fraction := range ranges {
+				eng.SetScanRange(ticker, fraction)
+			}
+		}
+	}
+	if *referencePrices != "" {
+		prices, err := net.ParseReferencePrices(*referencePrices)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to set reference prices")
+		}
+		srv.SetReferencePrices(prices)
+	}
+	if *riskURL != "" {
+		riskPolicy := net.RiskFailClosed
+		if *riskFailOpen {
+			riskPolicy = net.RiskFailOpen
+		}
+		srv.SetRiskGate(net.NewRiskGate(net.HTTPRiskChecker{URL: *riskURL}, *riskTimeout, riskPolicy))
+	}
+	// Registered participants are onboarded on top of the flags above.
+	registry, err := participants.Open(*participantsPath, srv, served)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to open participant registry")
+	}
+	srv.SetParticipantRegistry(registry)
+	if *credentials == "" {
+		log.Warn().Msg("no credentials given, only registered participants' logons are authenticated")
+	}
+
+	// The books are restored once everything they are matched with is set up,
+	// so commands replayed match as they did the first time around. A snapshot
+	// holds every resting order, gtc ones included, so the gtc file is only
+	// restored without one.
+	restored := false
+	if *snapshotPath != "" {
+		snap, err := engine.LoadSnapshot(*snapshotPath)
+		missing := errors.Is(err, fs.ErrNotExist)
+		if err != nil && !missing {
+			log.Fatal().Err(err).Msg("unable to restore snapshot")
+		}
+		var cmds []common.Command
+		if *walPath != "" {
+			if cmds, err = wal.Read(*walPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Fatal().Err(err).Msg("unable to read wal")
+			}
+		}
+		if !missing || len(cmds) > 0 {
+			replayed, err := eng.Recover(snap, cmds)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to recover")
+			}
+			log.Info().
+				Time("taken", snap.TakenAt).
+				Int("replayed", replayed).
+				Uint64("sequence", eng.ReplayMarkers().Sequence).
+				Msg("recovered from snapshot and wal")
+			restored = true
+		}
+	}
+	if !restored && len(engines) == 1 {
+		if err := eng.RestoreGTC(*gtcPath); err != nil {
+			log.Fatal().Err(err).Msg("unable to restore gtc orders")
+		}
+	}
+	if *snapshotPath != "" && *walPath != "" {
+		// The wal only keeps its latest run, the one started below, so
+		// everything before it has to be in the snapshot.
+		if err := engine.SaveSnapshot(*snapshotPath, eng.Snapshot()); err != nil {
+			log.Fatal().Err(err).Msg("unable to save snapshot")
+		}
+	}
+	if *walPath != "" {
+		policy, err := wal.ParseSyncPolicy(*walSync)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open wal")
+		}
+		walLog, err := wal.Open(*walPath, policy, *walSyncInterval)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open wal")
+		}
+		defer func() {
+			if err := walLog.Close(); err != nil {
+				log.Error().Err(err).Msg("unable to close wal")
+			}
+		}()
+		eng.SetCommandJournal(walLog)
+	}
+	var recorders engine.TradeRecorders
+	retain := 0
+	if *tradeDB != "" {
+		driver, dsn, _ := strings.Cut(*tradeDB, ":")
+		store, err := tradestore.OpenSQL(driver, dsn)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open trade store")
+		}
+		trades := tradestore.NewWriter(store, tradestore.DefaultWriteBuffer)
+		defer func() {
+			if err := trades.Close(); err != nil {
+				log.Error().Err(err).Msg("unable to close trade store")
+			}
+			if dropped := trades.Dropped(); dropped > 0 {
+				log.Warn().Uint64("trades", dropped).Msg("trades never saved to the trade store")
+			}
+		}()
+		recorders = append(recorders, trades)
+		retain = *retainTrades
+		srv.SetTradeHistory(trades)
+	}
+	if *eventsAddr != "" {
+		topics, err := events.ParseTopics(*eventTopics)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to start event publisher")
+		}
+		sink, err := events.Open(*eventsAddr)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to start event publisher")
+		}
+		publisher := events.NewPublisher(sink, topics, events.DefaultBuffer)
+		defer func() {
+			if err := publisher.Close(); err != nil {
+				log.Error().Err(err).Msg("unable to close event publisher")
+			}
+			if dropped := publisher.Dropped(); dropped > 0 {
+				log.Warn().Uint64("events", dropped).Msg("events never published")
+			}
+		}()
+		eng.SetAuditor(append(auditors, publisher))
+		recorders = append(recorders, publisher)
+	}
+	if *tapePath != "" {
+		// Started afresh alongside the wal, so it is of the same run.
+		file, err := os.Create(*tapePath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open trade tape")
+		}
+		tape := engine.NewTradeTape(file)
+		defer func() {
+			if err := errors.Join(tape.Flush(), file.Close()); err != nil {
+				log.Error().Err(err).Msg("unable to write trade tape")
+			}
+		}()
+		recorders = append(recorders, tape)
+	}
+	if len(recorders) > 0 {
+		eng.SetTradeRecorder(recorders, retain)
+	}
+	if *settlementDir != "" {
+		srv.SetSettler(backoffice.NewSettler(srv, *settlementDir))
+	}
+
+	if *quotes != "" {
+		var symbols []quoter.Symbol
+		for _, spec := range strings.Split(*quotes, ",") {
+			symbol, err := quoter.ParseSymbol(spec)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to start quoter")
+			}
+			symbols = append(symbols, symbol)
+		}
+		autoQuoter, err := quoter.New(eng, *quoterOwner, symbols...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to start quoter")
+		}
+		if err := autoQuoter.Replenish(); err != nil {
+			log.Fatal().Err(err).Msg("unable to start quoter")
+		}
+		srv.SetQuoter(autoQuoter)
+		log.Info().Str("owner", *quoterOwner).Int("symbols", len(symbols)).Msg("quoter running")
+	}
+
+	if *auditPath != "" {
+		reconciler := backoffice.NewReconciler(eng, *auditPath)
+		if *reconcileInterval > 0 {
+			go reconciler.Run(ctx, *reconcileInterval)
+		}
+		// Reconcile on demand.
+		checks := make(chan os.Signal, 1)
+		signal.Notify(checks, syscall.SIGUSR1)
+		go func() {
+			for range checks {
+				reconciler.Check()
+			}
+		}()
+	}
 
 	go srv.Run(ctx)
+	go feed.Run(ctx)
+	if *netting > 0 {
+		go srv.RunNetting(ctx, *netting)
+	}
+	if *reap > 0 {
+		go srv.RunReaper(ctx, *reap, *abandon)
+	}
+	if *compact > 0 {
+		go srv.RunCompaction(ctx, eng, *compact)
+	}
+	for _, perp := range perps {
+		go srv.RunFunding(ctx, eng, perp)
+	}
+	if *calendars != "" {
+		go srv.RunSchedule(ctx)
+	}
+	if *indexSources != "" {
+		var sources []prices.Source
+		for _, spec := range strings.Split(*indexSources, ",") {
+			source, err := prices.ParseSource(spec, *indexPoll)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid index price source")
+			}
+			sources = append(sources, source)
+		}
+		go prices.NewIngester(srv, *indexStale, sources...).Run(ctx)
+	}
+	if *snapshotPath != "" {
+		// Also taken whenever an admin asks.
+		go srv.RunSnapshots(ctx, eng, *snapshotEvery, func(snap common.Snapshot) error {
+			return engine.SaveSnapshot(*snapshotPath, snap)
+		})
+	}
+	if *wsPort != 0 {
+		go net.NewGateway(*host, *wsPort, srv, feed).Run(ctx)
+	}
+	if *restPort != 0 {
+		api := net.NewAPI(*host, *restPort, srv)
+		api.SetAdmin(*adminPort == 0)
+		go api.Run(ctx)
+	}
+	if *adminPort != 0 {
+		admin := net.NewAdminAPI(*host, *adminPort, srv)
+		if *adminCert != "" {
+			config, err := net.AdminTLSConfig(*adminCert, *adminKey, *adminCA)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid admin api tls")
+			}
+			admin.SetTLS(config)
+		}
+		go admin.Run(ctx)
+	}
 	// Block on running the server.
-	<-ctx.Done()
+	<-signals.Done()
+	// A second signal stops the server without waiting on the drain.
+	stop()
+
+	drainCtx, cancelDrain := context.WithTimeout(ctx, *drainTimeout)
+	if err := srv.Drain(drainCtx, *drainCancel); err != nil {
+		log.Error().Err(err).Msg("unable to drain server")
+	}
+	cancelDrain()
+	cancel()
+
+	if len(engines) == 1 {
+		if err := eng.SaveGTC(*gtcPath); err != nil {
+			log.Error().Err(err).Msg("unable to save gtc orders")
+		}
+	}
+	if *snapshotPath != "" {
+		if err := engine.SaveSnapshot(*snapshotPath, eng.Snapshot()); err != nil {
+			log.Error().Err(err).Msg("unable to save snapshot")
+		}
+	}
 }
@@ -0,0 +1,7 @@
+//go:build cgo && !nosqlite
+
+package main
+
+// Links the SQLite driver, for -tradedb sqlite3:<path>. It needs cgo, builds
+// without it, or tagged nosqlite, can only keep trades in Postgres.
+import _ "github.com/mattn/go-sqlite3"
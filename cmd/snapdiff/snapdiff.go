@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/wal"
+
+	"github.com/rs/zerolog"
+)
+
+const usage = `snapdiff prints how two book snapshots differ, per symbol and price level,
+for debugging recovery and replication. It exits 1 if they differ.
+
+Usage:
+  snapdiff [flags] A B
+
+With -wal, the log is replayed over A first, as the server recovers on startup,
+and what that recovers is compared with B. Replays match as they did the first
+time around only if the instruments and market makers are as they were.
+
+Flags:
+`
+
+func main() {
+	walPath := flag.String("wal", "", "Write ahead log to replay over A before comparing, as the server's -wal")
+	instruments := flag.String("instruments", "", "Comma-separated ticker:qtyScale:priceScale instruments to register for -wal, as the server's -instruments")
+	marketMakers := flag.String("marketmakers", "", "Comma-separated owners given designated market maker priority for -wal, as the server's -marketmakers")
+	mmAllocation := flag.Uint64("mmallocation", 0, "Percent of each fill allocated to market makers for -wal, as the server's -mmallocation")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a, err := engine.LoadSnapshot(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := engine.LoadSnapshot(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *walPath != "" {
+		// Only what differs is of interest, not the engine's account of
+		// replaying.
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		eng := engine.New(common.Equities)
+		if *instruments != "" {
+			for _, spec := range strings.Split(*instruments, ",") {
+				inst, err := common.ParseInstrument(common.Equities, spec)
+				if err != nil {
+					log.Fatalf("Invalid instrument: %v", err)
+				}
+				if err := eng.RegisterInstrument(inst); err != nil {
+					log.Fatalf("Unable to register instrument %s: %v", inst.Ticker, err)
+				}
+			}
+		}
+		if *marketMakers != "" {
+			for _, owner := range strings.Split(*marketMakers, ",") {
+				if err := eng.SetPriorityClass(owner, common.MarketMakerClass); err != nil {
+					log.Fatalf("Unable to set market maker: %v", err)
+				}
+			}
+		}
+		if err := eng.SetAllocation(common.MarketMakerClass, *mmAllocation); err != nil {
+			log.Fatalf("Unable to set market maker allocation: %v", err)
+		}
+
+		cmds, err := wal.Read(*walPath)
+		if err != nil {
+			log.Fatalf("Unable to read wal: %v", err)
+		}
+		replayed, err := eng.Recover(a, cmds)
+		if err != nil {
+			log.Fatalf("Unable to replay wal: %v", err)
+		}
+		fmt.Printf("Replayed %d commands over %s\n", replayed, flag.Arg(0))
+		a = eng.Snapshot()
+	}
+
+	diffs := engine.DiffSnapshots(a, b)
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("%d differences\n", len(diffs))
+		os.Exit(1)
+	}
+	fmt.Println("Snapshots match")
+}
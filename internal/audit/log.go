@@ -0,0 +1,144 @@
+// Package audit writes the regulatory audit trail of order events.
+package audit
+
+import (
+	"encoding/json"
+	. "fenrir/internal/common"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Log appends audit events to a file as JSON lines, one event per line, in the
+// style of a CAT or MiFID order event report. Times are written with full
+// nanosecond precision.
+type Log struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// record is the layout of a single line of the file.
+type record struct {
+	Event         string  `json:"event"`
+	Sequence      uint64  `json:"seq"`
+	OrderID       string  `json:"orderId"`
+	ClOrdID       uint64  `json:"clOrdId,omitempty"`
+	Owner         string  `json:"owner"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"orderType"`
+	TimeInForce   string  `json:"tif"`
+	LimitPrice    float64 `json:"limitPrice,omitempty"`
+	Quantity      string  `json:"qty"`
+	QuantityScale uint8   `json:"qtyScale"`
+	OrderSequence uint64  `json:"orderSeq"`
+
+	ClientTimestamp    string `json:"clientTs,omitempty"`
+	GatewayTimestamp   string `json:"gatewayTs,omitempty"`
+	SequencerTimestamp string `json:"sequencerTs,omitempty"`
+	MatchTimestamp     string `json:"matchTs,omitempty"`
+
+	TradeID        uint64  `json:"tradeId,omitempty"`
+	Price          float64 `json:"price,omitempty"`
+	CounterpartyID string  `json:"counterpartyOrderId,omitempty"`
+	Aggressor      bool    `json:"aggressor,omitempty"`
+	Manual         bool    `json:"manual,omitempty"` // Booked by an admin, see ManualTrade
+
+	CancelReason *CancelReason `json:"cancelReason,omitempty"`
+
+	Timestamp string `json:"ts,omitempty"`
+}
+
+// startRecord marks where a new run of the engine begins in the file. Audit
+// sequences start again from 1 after it.
+type startRecord struct {
+	Event     string `json:"event"`
+	Timestamp string `json:"ts"`
+}
+
+const startEvent = "START"
+
+// Open appends to the audit file at path, creating it if needed.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{file: file, encoder: json.NewEncoder(file)}
+	if err := l.encoder.Encode(startRecord{Event: startEvent, Timestamp: timestamp(time.Now())}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// RecordAuditEvent writes the event straight through to the file. The matching
+// path carries on if the write fails, the failure is logged.
+func (l *Log) RecordAuditEvent(event AuditEvent) {
+	rec := record{
+		Event:              eventNames[event.Type],
+		Sequence:           event.Sequence,
+		OrderID:            event.OrderUUID,
+		ClOrdID:            event.ClOrdID,
+		Owner:              event.Owner,
+		Symbol:             event.Ticker,
+		Side:               sideNames[event.Side],
+		OrderType:          orderTypeNames[event.OrderType],
+		TimeInForce:        tifNames[event.TimeInForce],
+		LimitPrice:         event.LimitPrice,
+		Quantity:           FormatQuantity(event.Quantity, event.QuantityScale),
+		QuantityScale:      event.QuantityScale,
+		OrderSequence:      event.OrderSequence,
+		ClientTimestamp:    timestamp(event.ClientTimestamp),
+		GatewayTimestamp:   timestamp(event.GatewayTimestamp),
+		SequencerTimestamp: timestamp(event.SequencerTimestamp),
+		MatchTimestamp:     timestamp(event.MatchTimestamp),
+		TradeID:            event.TradeID,
+		Price:              event.Price,
+		CounterpartyID:     event.CounterpartyUUID,
+		Aggressor:          event.Aggressor,
+		Manual:             event.TradeType == ManualTrade,
+		Timestamp:          timestamp(event.Timestamp),
+	}
+	if event.Type == CancelEvent {
+		rec.CancelReason = &event.CancelReason
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.encoder.Encode(rec); err != nil {
+		log.Error().
+			Err(err).
+			Uint64("seq", event.Sequence).
+			Msg("unable to write audit event")
+	}
+}
+
+// Close syncs the file to disk and closes it.
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
+
+var (
+	eventNames     = map[AuditEventType]string{NewOrderEvent: "NEW", TradeEvent: "TRADE", CancelEvent: "CANCEL", KillSwitchEvent: "KILL"}
+	sideNames      = map[Side]string{Buy: "BUY", Sell: "SELL"}
+	orderTypeNames = map[OrderType]string{LimitOrder: "LIMIT", MarketOrder: "MARKET"}
+	tifNames       = map[TimeInForce]string{Day: "DAY", GoodTillCancel: "GTC"}
+)
+
+// timestamp formats t at nanosecond precision, leaving out times never set.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	. "fenrir/internal/common"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ReadLedger rebuilds the ledger of the engine's current run from the audit
+// file at path, using only trades audited up to and including sequence upTo.
+// Earlier runs in the same file are skipped.
+func ReadLedger(path string, upTo uint64) (Ledger, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Ledger{}, err
+	}
+	defer file.Close()
+
+	ledger := NewLedger()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return Ledger{}, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		switch {
+		case rec.Event == startEvent:
+			ledger = NewLedger()
+			continue
+		case rec.Event != eventNames[TradeEvent] || rec.Sequence > upTo:
+			continue
+		}
+
+		quantity, err := ParseQuantity(rec.Quantity, rec.QuantityScale)
+		if err != nil {
+			return Ledger{}, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		// Each side of a trade is its own event, so count the trade once.
+		key := PositionKey{Owner: rec.Owner, Ticker: rec.Symbol}
+		if rec.Side == sideNames[Buy] {
+			ledger.Positions[key] += int64(quantity)
+		} else {
+			ledger.Positions[key] -= int64(quantity)
+		}
+		if rec.Aggressor {
+			ledger.TradeCounts[rec.Symbol]++
+		}
+		ledger.AuditSequence = max(ledger.AuditSequence, rec.Sequence)
+	}
+	return ledger, scanner.Err()
+}
+
+// ReadTrades returns every trade in the audit file at path, over every run, in
+// the order they were audited. Only the aggressor's side of each is returned.
+func ReadTrades(path string) ([]AuditEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var trades []AuditEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if rec.Event != eventNames[TradeEvent] || !rec.Aggressor {
+			continue
+		}
+
+		quantity, err := ParseQuantity(rec.Quantity, rec.QuantityScale)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		matched, err := time.Parse(time.RFC3339Nano, rec.MatchTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		tradeType := MatchedTrade
+		if rec.Manual {
+			tradeType = ManualTrade
+		}
+		trades = append(trades, AuditEvent{
+			Type:           TradeEvent,
+			Sequence:       rec.Sequence,
+			OrderUUID:      rec.OrderID,
+			Owner:          rec.Owner,
+			Ticker:         rec.Symbol,
+			QuantityScale:  rec.QuantityScale,
+			Quantity:       quantity,
+			MatchTimestamp: matched,
+			TradeID:        rec.TradeID,
+			Price:          rec.Price,
+			Aggressor:      true,
+			TradeType:      tradeType,
+		})
+	}
+	return trades, scanner.Err()
+}
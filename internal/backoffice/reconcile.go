@@ -0,0 +1,148 @@
+// Package backoffice holds checks run alongside the exchange, away from the
+// matching path.
+package backoffice
+
+import (
+	"context"
+	"fenrir/internal/audit"
+	. "fenrir/internal/common"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DiscrepancyKind is which part of the ledger disagrees.
+type DiscrepancyKind int
+
+const (
+	PositionDiscrepancy DiscrepancyKind = iota
+	TradeCountDiscrepancy
+)
+
+// Discrepancy is a single figure the engine and storage disagree on. Owner is
+// empty for trade counts.
+type Discrepancy struct {
+	Kind   DiscrepancyKind
+	Owner  string
+	Ticker string
+	Hot    int64 // What the engine has in memory
+	Stored int64 // What the audit trail adds up to
+}
+
+// LedgerSource is the engine's side of a reconciliation.
+type LedgerSource interface {
+	Ledger() Ledger
+}
+
+// Reconciler compares the engine's in-memory positions and trade counts
+// against the audit trail on disk, so the two silently drifting apart is
+// caught.
+type Reconciler struct {
+	source    LedgerSource
+	auditPath string
+}
+
+func NewReconciler(source LedgerSource, auditPath string) *Reconciler {
+	return &Reconciler{source: source, auditPath: auditPath}
+}
+
+// Reconcile runs a single check. The engine's ledger is taken first, then the
+// audit trail is read up to the same point, so trading carries on throughout.
+func (r *Reconciler) Reconcile() ([]Discrepancy, error) {
+	hot := r.source.Ledger()
+	stored, err := audit.ReadLedger(r.auditPath, hot.AuditSequence)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(hot, stored), nil
+}
+
+// Compare lists every figure the two ledgers disagree on, in a stable order.
+func Compare(hot, stored Ledger) []Discrepancy {
+	var discrepancies []Discrepancy
+
+	positions := make(map[PositionKey]bool)
+	for key := range hot.Positions {
+		positions[key] = true
+	}
+	for key := range stored.Positions {
+		positions[key] = true
+	}
+	for key := range positions {
+		if hot.Positions[key] != stored.Positions[key] {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:   PositionDiscrepancy,
+				Owner:  key.Owner,
+				Ticker: key.Ticker,
+				Hot:    hot.Positions[key],
+				Stored: stored.Positions[key],
+			})
+		}
+	}
+
+	tickers := make(map[string]bool)
+	for ticker := range hot.TradeCounts {
+		tickers[ticker] = true
+	}
+	for ticker := range stored.TradeCounts {
+		tickers[ticker] = true
+	}
+	for ticker := range tickers {
+		if hot.TradeCounts[ticker] != stored.TradeCounts[ticker] {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:   TradeCountDiscrepancy,
+				Ticker: ticker,
+				Hot:    int64(hot.TradeCounts[ticker]),
+				Stored: int64(stored.TradeCounts[ticker]),
+			})
+		}
+	}
+
+	slices.SortFunc(discrepancies, func(a, b Discrepancy) int {
+		if a.Kind != b.Kind {
+			return int(a.Kind) - int(b.Kind)
+		}
+		if c := strings.Compare(a.Ticker, b.Ticker); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Owner, b.Owner)
+	})
+	return discrepancies
+}
+
+// Run reconciles every interval until ctx is done, logging what it finds.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check()
+		}
+	}
+}
+
+// Check reconciles once, logging what it finds.
+func (r *Reconciler) Check() {
+	discrepancies, err := r.Reconcile()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to reconcile")
+		return
+	}
+	for _, d := range discrepancies {
+		log.Error().
+			Int("kind", int(d.Kind)).
+			Str("owner", d.Owner).
+			Str("ticker", d.Ticker).
+			Int64("hot", d.Hot).
+			Int64("stored", d.Stored).
+			Msg("reconciliation discrepancy")
+	}
+	if len(discrepancies) == 0 {
+		log.Info().Msg("reconciled, no discrepancies")
+	}
+}
@@ -0,0 +1,156 @@
+package backoffice
+
+import (
+	"context"
+	"encoding/csv"
+	. "fenrir/internal/common"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A TradeSource looks up the trades to settle, see net.Server.Trades.
+type TradeSource interface {
+	Trades(ctx context.Context, query TradeQuery) ([]TradeRecord, error)
+}
+
+// Settler runs end of day settlement, netting a day's trades into what each
+// owner has to settle and writing it out as CSV files in dir:
+//
+//	trades-2006-01-02.csv    every trade of the day
+//	positions-2006-01-02.csv each owner's net position and cash per instrument
+//	cash-2006-01-02.csv      each owner's cash across every instrument
+//
+// Days run midnight to midnight UTC. Settling a day again replaces its files,
+// so a day settled early can be settled again once it is over.
+type Settler struct {
+	source TradeSource
+	dir    string
+	lock   sync.Mutex // Held settling, so only one day's files are written at once
+}
+
+func NewSettler(source TradeSource, dir string) *Settler {
+	return &Settler{source: source, dir: dir}
+}
+
+// Settle settles the day starting at day, see SettlementDay, writing its files
+// before returning what it settled.
+func (settler *Settler) Settle(ctx context.Context, day time.Time) (Settlement, error) {
+	settler.lock.Lock()
+	defer settler.lock.Unlock()
+
+	day = SettlementDay(day)
+	trades, err := settler.source.Trades(ctx, TradeQuery{From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil {
+		return Settlement{}, err
+	}
+	settlement := Settle(day, trades)
+
+	if err := os.MkdirAll(settler.dir, 0o755); err != nil {
+		return Settlement{}, err
+	}
+	date := day.Format(time.DateOnly)
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"trades-" + date + ".csv", tradeRows(settlement)},
+		{"positions-" + date + ".csv", positionRows(settlement)},
+		{"cash-" + date + ".csv", cashRows(settlement)},
+	}
+	for _, file := range files {
+		if err := writeCSVAtomic(filepath.Join(settler.dir, file.name), file.rows); err != nil {
+			return Settlement{}, err
+		}
+	}
+
+	log.Info().
+		Str("day", date).
+		Int("trades", len(settlement.Trades)).
+		Int("owners", len(settlement.Cash)).
+		Str("dir", settler.dir).
+		Msg("settled")
+	return settlement, nil
+}
+
+func tradeRows(settlement Settlement) [][]string {
+	rows := [][]string{{"trade_id", "timestamp", "ticker", "asset_type", "price", "quantity", "aggressor", "taker", "taker_order", "maker", "maker_order"}}
+	for _, trade := range settlement.Trades {
+		rows = append(rows, []string{
+			strconv.FormatUint(trade.ID, 10),
+			trade.Timestamp.UTC().Format(time.RFC3339Nano),
+			trade.Ticker,
+			assetTypeNames[trade.AssetType],
+			FormatPrice(trade.Price, trade.PriceScale),
+			FormatQuantity(trade.Quantity, trade.QuantityScale),
+			sideNames[trade.Aggressor],
+			trade.Taker,
+			trade.TakerOrder,
+			trade.Maker,
+			trade.MakerOrder,
+		})
+	}
+	return rows
+}
+
+func positionRows(settlement Settlement) [][]string {
+	rows := [][]string{{"owner", "ticker", "asset_type", "trades", "bought", "sold", "net_quantity", "cash"}}
+	for _, position := range settlement.Positions {
+		net := FormatQuantity(uint64(position.NetQuantity), position.QuantityScale)
+		if position.NetQuantity < 0 {
+			net = "-" + FormatQuantity(uint64(-position.NetQuantity), position.QuantityScale)
+		}
+		rows = append(rows, []string{
+			position.Owner,
+			position.Ticker,
+			assetTypeNames[position.AssetType],
+			strconv.FormatUint(position.Trades, 10),
+			FormatQuantity(position.Bought, position.QuantityScale),
+			FormatQuantity(position.Sold, position.QuantityScale),
+			net,
+			FormatPrice(position.Cash, position.PriceScale),
+		})
+	}
+	return rows
+}
+
+func cashRows(settlement Settlement) [][]string {
+	rows := [][]string{{"owner", "cash"}}
+	for _, cash := range settlement.Cash {
+		rows = append(rows, []string{cash.Owner, FormatPrice(cash.Cash, cash.PriceScale)})
+	}
+	return rows
+}
+
+// writeCSVAtomic writes rows to path. It is written alongside and renamed into
+// place, so a crash mid-write never leaves a truncated file behind.
+func writeCSVAtomic(path string, rows [][]string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := csv.NewWriter(tmp)
+	if err := w.WriteAll(rows); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	assetTypeNames = map[AssetType]string{Equities: "equities", Crypto: "crypto"}
+	sideNames      = map[Side]string{Buy: "buy", Sell: "sell"}
+)
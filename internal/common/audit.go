@@ -0,0 +1,59 @@
+package common
+
+import "time"
+
+// AuditEventType is what happened to an order.
+type AuditEventType int
+
+const (
+	// The order was accepted by the engine.
+	NewOrderEvent AuditEventType = iota
+	// The order traded, one event is recorded for each side of a trade.
+	TradeEvent
+	// The order was taken off the book before it filled.
+	CancelEvent
+	// An operator pulled the kill switch. It is not of any one order, the
+	// cancels which follow it are.
+	KillSwitchEvent
+)
+
+// AuditEvent is a single, regulatory style, record of an order event. It
+// carries the order's full chain of timestamps and sequence numbers so its
+// lifecycle can be reconstructed from the audit trail alone.
+type AuditEvent struct {
+	Type          AuditEventType
+	Sequence      uint64 // Engine assigned, increases across every event
+	OrderUUID     string
+	ClOrdID       uint64 // Zero if the client did not assign one
+	Owner         string
+	Ticker        string
+	AssetType     AssetType
+	Side          Side
+	OrderType     OrderType
+	TimeInForce   TimeInForce
+	LimitPrice    float64
+	QuantityScale uint8
+	// For new orders the order's size, for trades the matched size and for
+	// cancels the size left on the book (in lots).
+	Quantity uint64
+
+	ClientTimestamp    time.Time // Zero if the client did not supply one
+	GatewayTimestamp   time.Time // Received by the gateway
+	SequencerTimestamp time.Time // Sequenced into the book
+	OrderSequence      uint64    // Time priority assigned by the sequencer
+
+	// Trades only.
+	MatchTimestamp   time.Time
+	TradeID          uint64
+	Price            float64
+	CounterpartyUUID string
+	Aggressor        bool // Whether this side was the taker
+	TradeType        TradeType
+
+	// Cancels only.
+	CancelReason CancelReason
+
+	// Cancels and kill switches, for which the admin who pulled it is the
+	// owner.
+	Timestamp time.Time
+}
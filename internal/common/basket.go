@@ -0,0 +1,16 @@
+package common
+
+// BasketLeg is a single constituent of a basket instrument.
+type BasketLeg struct {
+	Ticker string // Leg instrument
+	Weight uint64 // Lots of the leg per unit of the basket
+}
+
+// Basket is a synthetic instrument made up of weighted legs. Baskets have no
+// book of their own, an order on a basket is decomposed into orders on each
+// of its legs.
+type Basket struct {
+	Ticker    string
+	AssetType AssetType
+	Legs      []BasketLeg
+}
@@ -0,0 +1,14 @@
+package common
+
+// BBO is the best bid and offer of a book. A side with no resting orders has a
+// zero quantity. Sequence is the book's market data sequence it was taken at.
+type BBO struct {
+	Ticker        string
+	Sequence      uint64
+	BidPrice      float64
+	BidQuantity   uint64 // Aggregate quantity at the best bid (in lots)
+	AskPrice      float64
+	AskQuantity   uint64 // Aggregate quantity at the best ask (in lots)
+	QuantityScale uint8
+	PriceScale    uint8
+}
@@ -0,0 +1,186 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCalendar      = errors.New("invalid trading calendar")
+	ErrInvalidCalendarScope = errors.New("invalid trading calendar scope")
+)
+
+// TradingPhase is where a symbol is in its trading day. New orders are only
+// placed on the book in continuous trading, the default of symbols without a
+// trading calendar.
+type TradingPhase uint8
+
+const (
+	PhaseContinuous TradingPhase = iota
+	// Ahead of the open, orders are refused, or held for it, see
+	// Server.SetQueuePreOpen.
+	PhasePreOpen
+	// Halted by an admin until they put it back in another phase.
+	PhaseHalted
+	// Outside trading hours, orders are refused until the next pre-open or
+	// open.
+	PhaseClosed
+)
+
+func (phase TradingPhase) Valid() bool {
+	return phase <= PhaseClosed
+}
+
+// SymbolStatus is the status a symbol in the phase is published with.
+func (phase TradingPhase) SymbolStatus() SymbolStatus {
+	switch phase {
+	case PhasePreOpen:
+		return SymbolPreOpen
+	case PhaseHalted:
+		return SymbolHalted
+	case PhaseClosed:
+		return SymbolClosed
+	}
+	return SymbolNormal
+}
+
+// CalendarScope is what a trading calendar, or a phase an admin puts symbols
+// in, applies to: a single ticker, or every ticker of an asset type if Ticker
+// is empty.
+type CalendarScope struct {
+	AssetType AssetType
+	Ticker    string
+}
+
+// ParseCalendarScope parses a scope named by an asset type, "equities" or
+// "crypto", or else by a ticker.
+func ParseCalendarScope(name string) (CalendarScope, error) {
+	if assetType, err := ParseAssetType(name); err == nil {
+		return CalendarScope{AssetType: assetType}, nil
+	}
+	if name == "" || len(name) > 4 {
+		return CalendarScope{}, fmt.Errorf("%w: %q is neither an asset type nor a ticker", ErrInvalidCalendarScope, name)
+	}
+	return CalendarScope{Ticker: name}, nil
+}
+
+func (scope CalendarScope) String() string {
+	if scope.Ticker != "" {
+		return strings.TrimRight(scope.Ticker, "\x00")
+	}
+	if scope.AssetType == Crypto {
+		return "crypto"
+	}
+	return "equities"
+}
+
+// TradingCalendar is when the symbols in its scope trade, each weekday in its
+// location: in pre-open from PreOpen until Open, then continuously until
+// Close, and closed overnight and at weekends. Times are since midnight, and
+// keep to the wall clock across daylight saving changes.
+type TradingCalendar struct {
+	Scope    CalendarScope
+	PreOpen  time.Duration // Open itself if there is no pre-open
+	Open     time.Duration
+	Close    time.Duration
+	Location *time.Location
+}
+
+// ParseTradingCalendar parses a "scope=preOpen/open/close@location" calendar,
+// e.g. "equities=08:00/09:30/16:00@America/New_York" for equities to pre-open
+// at 8am and trade from 9:30am to 4pm New York time. The pre-open may be left
+// out, as may the location for UTC.
+func ParseTradingCalendar(spec string) (TradingCalendar, error) {
+	name, hours, ok := strings.Cut(spec, "=")
+	if !ok {
+		return TradingCalendar{}, fmt.Errorf("%w: %q is not scope=preOpen/open/close@location", ErrInvalidCalendar, spec)
+	}
+	scope, err := ParseCalendarScope(name)
+	if err != nil {
+		return TradingCalendar{}, err
+	}
+	calendar := TradingCalendar{Scope: scope, Location: time.UTC}
+	hours, zone, zoned := strings.Cut(hours, "@")
+	if zoned {
+		if calendar.Location, err = time.LoadLocation(zone); err != nil {
+			return TradingCalendar{}, fmt.Errorf("%w: location %q", ErrInvalidCalendar, zone)
+		}
+	}
+
+	var times []time.Duration
+	for _, part := range strings.Split(hours, "/") {
+		at, err := time.Parse("15:04", part)
+		if err != nil {
+			return TradingCalendar{}, fmt.Errorf("%w: time %q", ErrInvalidCalendar, part)
+		}
+		times = append(times, time.Duration(at.Hour())*time.Hour+time.Duration(at.Minute())*time.Minute)
+	}
+	switch len(times) {
+	case 2:
+		calendar.PreOpen, calendar.Open, calendar.Close = times[0], times[0], times[1]
+	case 3:
+		calendar.PreOpen, calendar.Open, calendar.Close = times[0], times[1], times[2]
+	default:
+		return TradingCalendar{}, fmt.Errorf("%w: %q is not preOpen/open/close", ErrInvalidCalendar, hours)
+	}
+	if calendar.PreOpen > calendar.Open || calendar.Open >= calendar.Close {
+		return TradingCalendar{}, fmt.Errorf("%w: %q is out of order", ErrInvalidCalendar, hours)
+	}
+	return calendar, nil
+}
+
+// Phase returns the phase the calendar has its symbols in at t.
+func (calendar TradingCalendar) Phase(t time.Time) TradingPhase {
+	preOpen, open, close, trading := calendar.day(t)
+	switch {
+	case !trading || t.Before(preOpen) || !t.Before(close):
+		return PhaseClosed
+	case t.Before(open):
+		return PhasePreOpen
+	}
+	return PhaseContinuous
+}
+
+// Next returns when the calendar next moves its symbols into another phase
+// after t, and the phase.
+func (calendar TradingCalendar) Next(t time.Time) (time.Time, TradingPhase) {
+	day := t.In(calendar.location())
+	// A week holds at least one trading day.
+	for range 8 {
+		if preOpen, open, close, trading := calendar.day(day); trading {
+			if preOpen.After(t) && preOpen.Before(open) {
+				return preOpen, PhasePreOpen
+			}
+			if open.After(t) {
+				return open, PhaseContinuous
+			}
+			if close.After(t) {
+				return close, PhaseClosed
+			}
+		}
+		year, month, date := day.Date()
+		day = time.Date(year, month, date+1, 0, 0, 0, 0, day.Location())
+	}
+	return time.Time{}, PhaseClosed
+}
+
+// day returns when the calendar pre-opens, opens and closes on the day of t,
+// and whether it trades at all that day.
+func (calendar TradingCalendar) day(t time.Time) (time.Time, time.Time, time.Time, bool) {
+	t = t.In(calendar.location())
+	year, month, date := t.Date()
+	at := func(since time.Duration) time.Time {
+		return time.Date(year, month, date, int(since/time.Hour), int(since%time.Hour/time.Minute), 0, 0, t.Location())
+	}
+	weekday := t.Weekday()
+	return at(calendar.PreOpen), at(calendar.Open), at(calendar.Close), weekday != time.Saturday && weekday != time.Sunday
+}
+
+func (calendar TradingCalendar) location() *time.Location {
+	if calendar.Location == nil {
+		return time.UTC
+	}
+	return calendar.Location
+}
@@ -0,0 +1,56 @@
+package common
+
+import "time"
+
+// Candle sums up a symbol's trades over an interval: the first, highest, lowest
+// and last prices traded, and how much traded.
+type Candle struct {
+	Start  time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume uint64 // (in lots)
+	Trades uint32
+}
+
+// Add folds a trade into the candle, trades being added in the order they
+// happened.
+func (c *Candle) Add(price float64, quantity uint64) {
+	if c.Trades == 0 {
+		c.Open, c.High, c.Low = price, price, price
+	}
+	c.High = max(c.High, price)
+	c.Low = min(c.Low, price)
+	c.Close = price
+	c.Volume += quantity
+	c.Trades++
+}
+
+// Merge folds a later candle into the candle, e.g. to roll minutes up into an
+// hour.
+func (c *Candle) Merge(later Candle) {
+	if later.Trades == 0 {
+		return
+	}
+	if c.Trades == 0 {
+		c.Open, c.High, c.Low = later.Open, later.High, later.Low
+	}
+	c.High = max(c.High, later.High)
+	c.Low = min(c.Low, later.Low)
+	c.Close = later.Close
+	c.Volume += later.Volume
+	c.Trades += later.Trades
+}
+
+// CandlePage is a page of a symbol's candles, oldest first. Intervals without
+// any trades have no candle. Next is where the following page starts, zero if
+// this is the last.
+type CandlePage struct {
+	Ticker        string
+	Interval      time.Duration
+	QuantityScale uint8
+	PriceScale    uint8
+	Candles       []Candle
+	Next          time.Time
+}
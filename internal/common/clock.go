@@ -0,0 +1,54 @@
+package common
+
+import "time"
+
+// Clock is where the exchange gets the time from. Timestamps and timers read it
+// rather than the system clock, so simulations and backtests can run the
+// exchange faster than real time.
+type Clock interface {
+	Now() time.Time
+	// After waits for d to pass on the clock, then sends the clock's time.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is real time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// AcceleratedClock is a virtual clock running speed times faster than real
+// time, starting from epoch when it is created. At a speed of 60 an 8 hour
+// trading day passes in 8 minutes.
+type AcceleratedClock struct {
+	epoch time.Time // Virtual time at start
+	start time.Time // Real time the clock was created
+	speed float64
+}
+
+func NewAcceleratedClock(epoch time.Time, speed float64) *AcceleratedClock {
+	return &AcceleratedClock{
+		epoch: epoch,
+		start: time.Now(),
+		speed: speed,
+	}
+}
+
+// Now is monotonic, it does not jump with changes to the system clock.
+func (clock *AcceleratedClock) Now() time.Time {
+	elapsed := time.Since(clock.start)
+	return clock.epoch.Add(time.Duration(float64(elapsed) * clock.speed))
+}
+
+func (clock *AcceleratedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(time.Duration(float64(d)/clock.speed), func() {
+		ch <- clock.Now()
+	})
+	return ch
+}
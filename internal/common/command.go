@@ -0,0 +1,76 @@
+package common
+
+import "time"
+
+// CommandType is which engine command a Command is.
+type CommandType uint8
+
+const (
+	PlaceOrderCommand CommandType = iota
+	PlaceOrderGroupCommand
+	CancelOwnOrderCommand
+	CancelClientOrderCommand
+	AdminCancelOrderCommand
+	AdminCancelSymbolCommand
+	KillSwitchCommand
+	AdminCancelOwnerCommand
+	ManualTradeCommand
+	AdminCancelAllCommand
+	StartAuctionCommand
+	UncrossCommand
+)
+
+// CommandOrigin is where a command came from, the message a session sent it in.
+// Sessions number what they receive in order, so an origin a session has
+// already had applied is never applied again.
+type CommandOrigin struct {
+	Session  string // Owner of the session, empty if not sent over one
+	Sequence uint64 // Inbound sequence of the message, see Journal
+	Part     uint32 // Of the message, for those carrying several commands
+}
+
+// After returns whether origin came later in the session than other.
+func (origin CommandOrigin) After(other CommandOrigin) bool {
+	if origin.Sequence != other.Sequence {
+		return origin.Sequence > other.Sequence
+	}
+	return origin.Part > other.Part
+}
+
+// ReplayMarkers are how far along the engine has applied commands, overall and
+// for each session. Commands at or before them are skipped when replayed, so
+// replaying a journal over state which already has some of it applied only
+// applies the rest.
+type ReplayMarkers struct {
+	Sequence uint64                   // Of the last command applied
+	Sessions map[string]CommandOrigin // Last command applied from each session
+}
+
+// Command is a single change to the books, as the engine journals it. Which of
+// its fields are set depends on its Type.
+type Command struct {
+	Sequence  uint64    // Assigned by the engine as it is applied
+	Time      time.Time // When it was applied, replays are timestamped with it
+	Origin    CommandOrigin
+	Type      CommandType
+	AssetType AssetType
+	Orders    []Order      // Orders placed, one unless a group, or the buyer's and seller's of a manual trade
+	Owner     string       // Whose orders are cancelled, or the admin pulling the kill switch
+	UUID      string       // Of the order cancelled
+	ClOrdID   uint64       // Of the order cancelled, by its owner's id
+	Ticker    string       // Symbol admin cancels, or of an auction
+	Reason    CancelReason // Admin cancels
+}
+
+// CommandReply is run with what a command applied without being waited on
+// came to, on the goroutine applying it, with a view of the engine it was
+// applied on as the command left it. What it returns is handed back to be run
+// on the goroutine the command was submitted from.
+type CommandReply func(view EngineView, orders []Order, err error) func()
+
+// EngineView is what a CommandReply may look up on the engine its command was
+// applied on.
+type EngineView interface {
+	Instrument(ticker string) (Instrument, bool)
+	OrderStatus(ticker string, uuid string) (OrderStatus, uint64)
+}
@@ -0,0 +1,23 @@
+package common
+
+// CreditUsage is how much of a participant's credit limit is taken up. Resting
+// orders reserve their remaining quantity at their limit price, released as
+// they fill or are cancelled. Positions are exposed according to the
+// participant's MarginMode, under StandardMargin at their instrument's index
+// price, or the last price it traded at without one, long or short. Amounts
+// are in whole units of price.
+type CreditUsage struct {
+	Limit     float64
+	Reserved  float64 // By resting orders
+	Positions float64 // By positions
+}
+
+// Exposure is everything the participant stands to lose or owe.
+func (usage CreditUsage) Exposure() float64 {
+	return usage.Reserved + usage.Positions
+}
+
+// Available is how much more the participant may be exposed to.
+func (usage CreditUsage) Available() float64 {
+	return usage.Limit - usage.Exposure()
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidDataTier  = errors.New("invalid data tier")
+	ErrInvalidDataTiers = errors.New("invalid data tiers")
+)
+
+// TopDepthLevels is how many levels of each side of a book the depth tier is
+// entitled to.
+const TopDepthLevels = 5
+
+// DataTier is how much of the books' market data a participant is entitled
+// to, each tier getting everything the ones after it do. Top of book is
+// enough for most, and far less to send.
+type DataTier uint8
+
+const (
+	// Every level of every book, as it changes. The default, so those
+	// registered before there were tiers keep what they had.
+	FullDepthTier DataTier = iota
+	// The top TopDepthLevels levels of each side.
+	TopDepthTier
+	// The best bid and offer, and trades.
+	TopOfBookTier
+	NumDataTiers
+)
+
+func (tier DataTier) String() string {
+	switch tier {
+	case FullDepthTier:
+		return "full"
+	case TopDepthTier:
+		return "depth"
+	case TopOfBookTier:
+		return "bbo"
+	}
+	return "unknown"
+}
+
+// Includes returns whether the tier is entitled to everything want is.
+func (tier DataTier) Includes(want DataTier) bool {
+	return tier <= want
+}
+
+// Levels is how many levels of each side of a book the tier may see.
+func (tier DataTier) Levels() int {
+	switch tier {
+	case FullDepthTier:
+		return math.MaxInt
+	case TopDepthTier:
+		return TopDepthLevels
+	}
+	return 1
+}
+
+// ParseDataTier parses a data tier by name, "full", "depth" or "bbo".
+func ParseDataTier(name string) (DataTier, error) {
+	for tier := range NumDataTiers {
+		if strings.EqualFold(name, tier.String()) {
+			return tier, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidDataTier, name)
+}
+
+// ParseDataTiers reads comma-separated owner:tier entitlements, e.g.
+// "alice:bbo,bob:depth".
+func ParseDataTiers(spec string) (map[string]DataTier, error) {
+	tiers := make(map[string]DataTier)
+	for _, entry := range strings.Split(spec, ",") {
+		owner, name, ok := strings.Cut(entry, ":")
+		if !ok || owner == "" {
+			return nil, fmt.Errorf("%w: %q is not owner:tier", ErrInvalidDataTiers, entry)
+		}
+		tier, err := ParseDataTier(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidDataTiers, err)
+		}
+		tiers[owner] = tier
+	}
+	return tiers, nil
+}
@@ -0,0 +1,35 @@
+package common
+
+import "time"
+
+// DepthLevel is an aggregated price level, as published to clients.
+type DepthLevel struct {
+	Price    float64
+	Quantity uint64 // Total quantity resting on the level (in lots)
+	Orders   uint32 // Number of orders resting on the level
+}
+
+// BookDepth is a level 2 view of the top of a book, best prices first.
+// Sequence is that of the last market data update applied to the book.
+type BookDepth struct {
+	Ticker        string
+	QuantityScale uint8
+	PriceScale    uint8
+	Sequence      uint64
+	Bids          []DepthLevel
+	Asks          []DepthLevel
+}
+
+// BookMetrics is what the books are holding on to, for keeping their memory in
+// check. Levels and books are stale once nothing has touched them for the
+// engine's level TTL, none being while it is not set.
+type BookMetrics struct {
+	Books       int           `json:"books"`
+	EmptyBooks  int           `json:"emptyBooks"` // With nothing resting
+	StaleBooks  int           `json:"staleBooks"` // Empty, and dropped by the next compaction
+	Levels      int           `json:"levels"`
+	StaleLevels int           `json:"staleLevels"` // Orders have rested on untouched
+	Orders      int           `json:"orders"`
+	OldestLevel time.Duration `json:"oldestLevel"` // Longest any level has gone untouched
+	Dropped     uint64        `json:"dropped"`     // Stale books dropped so far
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidQuantity   = Reject(RejectInvalidQuantity, errors.New("invalid quantity"))
+	ErrInvalidInstrument = errors.New("invalid instrument")
+)
+
+// MaxQuantityScale bounds the number of decimal places an instrument may quote
+// quantities in. 10^19 overflows a uint64, so stay well clear of it.
+const MaxQuantityScale = 18
+
+// MaxPriceScale bounds the number of decimal places an instrument may quote
+// prices in. Prices are still floating point, which only hold around 15
+// significant digits exactly.
+const MaxPriceScale = 8
+
+// DefaultPriceScale is the price precision of instruments created on first use,
+// i.e. cents.
+const DefaultPriceScale = 2
+
+// Instrument describes a tradeable symbol.
+//
+// Quantities are always carried as integer lots through the engine and on the
+// wire. QuantityScale is the number of decimal places a lot represents, e.g. a
+// scale of 8 means a quantity of 1 is 0.00000001 of the asset. A scale of 0 is
+// plain whole shares.
+//
+// Prices are carried as floating point, but may only have up to PriceScale
+// decimal places, e.g. a scale of 2 means prices are in cents.
+type Instrument struct {
+	Ticker        string    // Specific asset identifier
+	AssetType     AssetType //
+	QuantityScale uint8     // Decimal places of a single lot
+	PriceScale    uint8     // Decimal places of a price
+}
+
+// ParseInstrument parses a "ticker:qtyScale:priceScale" instrument definition,
+// e.g. "BTC:8:2" for a coin traded to a hundred millionth and priced in cents.
+func ParseInstrument(assetType AssetType, spec string) (Instrument, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return Instrument{}, fmt.Errorf("%w: %q is not ticker:qtyScale:priceScale", ErrInvalidInstrument, spec)
+	}
+	qtyScale, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || qtyScale > MaxQuantityScale {
+		return Instrument{}, fmt.Errorf("%w: quantity scale %q", ErrInvalidInstrument, parts[1])
+	}
+	priceScale, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil || priceScale > MaxPriceScale {
+		return Instrument{}, fmt.Errorf("%w: price scale %q", ErrInvalidInstrument, parts[2])
+	}
+	return Instrument{
+		Ticker:        parts[0],
+		AssetType:     assetType,
+		QuantityScale: uint8(qtyScale),
+		PriceScale:    uint8(priceScale),
+	}, nil
+}
+
+// Lot returns the size of a single quantity unit in the instrument's asset.
+func (inst Instrument) Lot() float64 {
+	return math.Pow10(-int(inst.QuantityScale))
+}
+
+// FormatQuantity renders a lot count as a decimal string.
+func (inst Instrument) FormatQuantity(quantity uint64) string {
+	return FormatQuantity(quantity, inst.QuantityScale)
+}
+
+// ParseQuantity converts a decimal string into a lot count.
+func (inst Instrument) ParseQuantity(s string) (uint64, error) {
+	return ParseQuantity(s, inst.QuantityScale)
+}
+
+// Tick returns the smallest price increment of the instrument.
+func (inst Instrument) Tick() float64 {
+	return math.Pow10(-int(inst.PriceScale))
+}
+
+// ValidPrice returns whether price has no more decimal places than the
+// instrument allows, give or take floating point error.
+func (inst Instrument) ValidPrice(price float64) bool {
+	ticks := price * math.Pow10(int(inst.PriceScale))
+	return math.Abs(ticks-math.Round(ticks)) <= 1e-9*math.Max(1, math.Abs(ticks))
+}
+
+// FormatPrice renders a price to the instrument's precision.
+func (inst Instrument) FormatPrice(price float64) string {
+	return FormatPrice(price, inst.PriceScale)
+}
+
+// FormatPrice renders a price, given a scale, as a decimal string.
+func FormatPrice(price float64, scale uint8) string {
+	return strconv.FormatFloat(price, 'f', int(scale), 64)
+}
+
+// FormatQuantity renders a lot count, given a scale, as a decimal string
+// without going through floating point.
+func FormatQuantity(quantity uint64, scale uint8) string {
+	digits := strconv.FormatUint(quantity, 10)
+	if scale == 0 {
+		return digits
+	}
+	if len(digits) <= int(scale) {
+		digits = strings.Repeat("0", int(scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(scale)
+	return digits[:point] + "." + digits[point:]
+}
+
+// ParseQuantity converts a decimal string into a lot count, given a scale.
+// Strings with more precision than the scale allows are rejected rather than
+// silently rounded.
+func ParseQuantity(s string, scale uint8) (uint64, error) {
+	if scale > MaxQuantityScale {
+		return 0, fmt.Errorf("%w: scale %d too large", ErrInvalidQuantity, scale)
+	}
+
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, s)
+	}
+	if len(frac) > int(scale) {
+		return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidQuantity, s, scale)
+	}
+	frac += strings.Repeat("0", int(scale)-len(frac))
+
+	lots, err := strconv.ParseUint(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, s)
+	}
+	return lots, nil
+}
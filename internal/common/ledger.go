@@ -0,0 +1,34 @@
+package common
+
+// PositionKey identifies an owner's position in a single instrument.
+type PositionKey struct {
+	Owner  string
+	Ticker string
+}
+
+// Ledger is the net result of trading: every owner's position and the number
+// of trades per instrument. Positions are signed lots, long is positive.
+// Funding is what owners have received less paid holding perpetuals, see
+// Funding.
+type Ledger struct {
+	Positions   map[PositionKey]int64
+	TradeCounts map[string]uint64
+	Funding     map[PositionKey]float64
+	// The audit sequence the ledger is complete up to, see AuditEvent.
+	AuditSequence uint64
+}
+
+func NewLedger() Ledger {
+	return Ledger{
+		Positions:   make(map[PositionKey]int64),
+		TradeCounts: make(map[string]uint64),
+		Funding:     make(map[PositionKey]float64),
+	}
+}
+
+// ApplyTrade books a trade of quantity between buyer and seller.
+func (ledger *Ledger) ApplyTrade(ticker, buyer, seller string, quantity uint64) {
+	ledger.Positions[PositionKey{Owner: buyer, Ticker: ticker}] += int64(quantity)
+	ledger.Positions[PositionKey{Owner: seller, Ticker: ticker}] -= int64(quantity)
+	ledger.TradeCounts[ticker]++
+}
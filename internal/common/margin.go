@@ -0,0 +1,75 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMarginMode = errors.New("invalid margin mode")
+	ErrInvalidScanRanges = errors.New("invalid scan ranges")
+)
+
+// MarginMode is how a participant's positions are margined against their
+// credit limit, see CreditUsage.
+type MarginMode uint8
+
+const (
+	// Every position is exposed on its own, at its full value.
+	StandardMargin MarginMode = iota
+	// Positions are grouped by what they are priced off, and each group is
+	// exposed by the most it would lose over MarginScenarios, so that
+	// positions hedging one another offset. Options are priced off their
+	// underlying and perpetuals off their index.
+	PortfolioMargin
+	NumMarginModes
+)
+
+func (mode MarginMode) String() string {
+	switch mode {
+	case StandardMargin:
+		return "standard"
+	case PortfolioMargin:
+		return "portfolio"
+	}
+	return "unknown"
+}
+
+// ParseMarginMode parses a margin mode by name, "standard" or "portfolio".
+func ParseMarginMode(name string) (MarginMode, error) {
+	for mode := range NumMarginModes {
+		if strings.EqualFold(name, mode.String()) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidMarginMode, name)
+}
+
+// DefaultScanRange is how far, as a fraction of its price, an underlying is
+// moved up and down in portfolio margin scenarios, unless given a range of its
+// own.
+const DefaultScanRange = 0.15
+
+// MarginScenarios are the moves of an underlying's price a group of positions
+// is revalued at under portfolio margin, as fractions of its scan range.
+var MarginScenarios = []float64{-1, -2.0 / 3, -1.0 / 3, 0, 1.0 / 3, 2.0 / 3, 1}
+
+// ParseScanRanges reads comma-separated ticker:percent scan ranges, e.g.
+// "BTC:25,AAPL:10" to move BTC 25% either way and AAPL 10%.
+func ParseScanRanges(spec string) (map[string]float64, error) {
+	ranges := make(map[string]float64)
+	for _, entry := range strings.Split(spec, ",") {
+		ticker, percent, ok := strings.Cut(entry, ":")
+		if !ok || ticker == "" {
+			return nil, fmt.Errorf("%w: %q is not ticker:percent", ErrInvalidScanRanges, entry)
+		}
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil || !(value > 0) {
+			return nil, fmt.Errorf("%w: percent %q", ErrInvalidScanRanges, percent)
+		}
+		ranges[ticker] = value / 100
+	}
+	return ranges, nil
+}
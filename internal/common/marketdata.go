@@ -0,0 +1,53 @@
+package common
+
+import "time"
+
+// MarketDataUpdateType is the kind of change a MarketDataUpdate describes.
+type MarketDataUpdateType int
+
+const (
+	// A new price level appeared on the book.
+	LevelAdd MarketDataUpdateType = iota
+	// An existing price level's aggregate quantity or order count changed.
+	LevelModify
+	// A price level no longer has any resting orders.
+	LevelDelete
+	// A trade printed on the book.
+	TradeUpdate
+	// Where a book in an auction would uncross if it did now, see Uncross:
+	// Price and Quantity are the price and volume, Side that of the surplus.
+	// Both are zero once it does not cross, or the auction is over.
+	IndicativeUpdate
+)
+
+// MarketDataUpdate is a single incremental change to a symbol's public state.
+//
+// Updates are sequenced per symbol without gaps, so a consumer can apply them
+// in order on top of a book snapshot of a lower sequence to maintain a copy of
+// the book. For level updates, Quantity and Orders are the new aggregate for
+// the level. For trades, Side is the aggressor's side and TradeID identifies
+// the match.
+type MarketDataUpdate struct {
+	Type          MarketDataUpdateType
+	Ticker        string
+	Sequence      uint64
+	TradeID       uint64
+	Timestamp     time.Time
+	Side          Side
+	Price         float64
+	Quantity      uint64 // (in lots)
+	Orders        uint32
+	QuantityScale uint8
+	PriceScale    uint8
+}
+
+// Uncross is where a book in an auction uncrosses: at the price executing the
+// most volume, leaving Surplus unexecuted at that price on SurplusSide. Price
+// and Volume are zero if the book does not cross.
+type Uncross struct {
+	Ticker      string
+	Price       float64
+	Volume      uint64 // (in lots)
+	Surplus     uint64 // (in lots)
+	SurplusSide Side   // Meaningless without a surplus
+}
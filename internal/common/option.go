@@ -0,0 +1,95 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidOption = errors.New("invalid option")
+
+// OptionKind is the right an option gives its holder.
+type OptionKind uint8
+
+const (
+	Call OptionKind = iota // To buy the underlying at the strike
+	Put                    // To sell the underlying at the strike
+)
+
+func (kind OptionKind) Valid() bool {
+	return kind == Call || kind == Put
+}
+
+func (kind OptionKind) String() string {
+	switch kind {
+	case Call:
+		return "CALL"
+	case Put:
+		return "PUT"
+	}
+	return "UNKNOWN"
+}
+
+// Option is a listed European option on an underlying traded on the exchange.
+// It is an instrument with a book of its own, the definition is only used to
+// value it, see PricingModel.
+type Option struct {
+	Ticker     string
+	AssetType  AssetType
+	Underlying string
+	Kind       OptionKind
+	Strike     float64
+	Expiry     time.Time
+}
+
+// ParseOption parses a "ticker:underlying:kind:strike:expiry" option definition,
+// e.g. "C100:AAPL:call:100:2026-12-18" for a call on AAPL struck at 100. Kinds
+// are "call" and "put", and options expire at midnight UTC of their expiry date.
+func ParseOption(assetType AssetType, spec string) (Option, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 5 || parts[0] == "" || parts[1] == "" {
+		return Option{}, fmt.Errorf("%w: %q is not ticker:underlying:kind:strike:expiry", ErrInvalidOption, spec)
+	}
+	option := Option{Ticker: parts[0], AssetType: assetType, Underlying: parts[1]}
+	switch strings.ToLower(parts[2]) {
+	case "call":
+		option.Kind = Call
+	case "put":
+		option.Kind = Put
+	default:
+		return Option{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidOption, parts[2])
+	}
+	strike, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil || !(strike > 0) {
+		return Option{}, fmt.Errorf("%w: strike %q", ErrInvalidOption, parts[3])
+	}
+	option.Strike = strike
+	if option.Expiry, err = time.Parse(time.DateOnly, parts[4]); err != nil {
+		return Option{}, fmt.Errorf("%w: expiry %q", ErrInvalidOption, parts[4])
+	}
+	return option, nil
+}
+
+// Intrinsic is what the option would be worth exercised against spot now.
+func (option Option) Intrinsic(spot float64) float64 {
+	if option.Kind == Put {
+		return max(option.Strike-spot, 0)
+	}
+	return max(spot-option.Strike, 0)
+}
+
+// Greeks are an option's theoretical value and its sensitivities, as worked
+// out by a PricingModel from the underlying's price at Timestamp.
+type Greeks struct {
+	Ticker          string
+	Timestamp       time.Time
+	UnderlyingPrice float64
+	Theo            float64 // Theoretical value
+	Delta           float64 // Change in value per unit move of the underlying
+	Gamma           float64 // Change in delta per unit move of the underlying
+	Vega            float64 // Change in value per point (1%) of volatility
+	Theta           float64 // Change in value per calendar day passing
+	PriceScale      uint8
+}
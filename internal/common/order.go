@@ -1,46 +1,66 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
 
+// Orders placed as a group are accepted together or not at all. A group is
+// rejected with this, wrapping why the first order to fail was.
+var ErrOrderGroupRejected = errors.New("order group rejected")
+
 type Order struct {
-	UUID          string    // Order tracked uuid
-	AssetType     AssetType //
-	OrderType     OrderType //
-	Ticker        string    // Specific asset identifier
-	Side          Side      // Order side
-	LimitPrice    float64   // Limiting price
-	Quantity      uint64    // Remaining quantity
-	TotalQuantity uint64    // Total volume requested
-	Timestamp     time.Time // Time of arrival of order
-	ExchTimestamp time.Time // Time of arrival of order into the book
-	Owner         string    // Who ownes this order
+	UUID            string        // Order tracked uuid
+	ClOrdID         uint64        // Client assigned id, unique among the owner's live orders, 0 if none
+	AssetType       AssetType     //
+	OrderType       OrderType     //
+	TimeInForce     TimeInForce   //
+	Ticker          string        // Specific asset identifier
+	Side            Side          // Order side
+	LimitPrice      float64       // Limiting price
+	Quantity        uint64        // Remaining quantity (in lots)
+	TotalQuantity   uint64        // Total volume requested (in lots)
+	QuantityScale   uint8         // Decimal places of a lot, see Instrument
+	PriceScale      uint8         // Decimal places of a price, see Instrument
+	ClientTimestamp time.Time     // Time the client says it sent the order, if it did
+	Timestamp       time.Time     // Time of arrival of order at the gateway
+	ExchTimestamp   time.Time     // Time of arrival of order into the book
+	Owner           string        // Who ownes this order
+	Sequence        uint64        // Engine assigned time priority
+	PriorityClass   PriorityClass // Engine assigned allocation class
 }
 
 func (order Order) String() string {
 	return fmt.Sprintf(
 		`UUID:          %v
+ClOrdID:       %d
 AssetType:     %v
 OrderType:     %v
+TimeInForce:   %v
 Ticker:        %s
 Side:          %v
-LimitPrice:    %f
-Quantity:      %d (Total: %d)
+LimitPrice:    %s
+Quantity:      %s (Total: %s)
 Timestamp:     %v
 ExchTimestamp: %v
-Owner:         %s`,
+Owner:         %s
+Sequence:      %d
+PriorityClass: %v`,
 		order.UUID,
+		order.ClOrdID,
 		order.AssetType,
 		order.OrderType,
+		order.TimeInForce,
 		order.Ticker,
 		order.Side,
-		order.LimitPrice,
-		order.Quantity,
-		order.TotalQuantity,
+		FormatPrice(order.LimitPrice, order.PriceScale),
+		FormatQuantity(order.Quantity, order.QuantityScale),
+		FormatQuantity(order.TotalQuantity, order.QuantityScale),
 		order.Timestamp.Format(time.RFC3339), // Formatted for readability
 		order.ExchTimestamp.Format(time.RFC3339),
 		order.Owner,
+		order.Sequence,
+		order.PriorityClass,
 	)
 }
@@ -0,0 +1,40 @@
+package common
+
+// Entitlement is a set of rights a participant has beyond trading.
+type Entitlement uint8
+
+const (
+	// May send admin messages, including onboarding other participants.
+	AdminEntitlement Entitlement = 1 << iota
+	// May subscribe to drop copies of other participants' execution reports.
+	ObserverEntitlement
+	// Designated market maker, see MarketMakerClass.
+	MarketMakerEntitlement
+)
+
+// Has returns whether every entitlement in want is held.
+func (entitlements Entitlement) Has(want Entitlement) bool {
+	return entitlements&want == want
+}
+
+// Participant is a member of the exchange, able to log on and trade.
+type Participant struct {
+	ID           string      `json:"id"`
+	Secret       string      `json:"secret"` // API secret logons are signed with
+	Entitlements Entitlement `json:"entitlements"`
+	// Largest single order the participant may place (in lots), 0 for no limit.
+	MaxOrderQuantity uint64 `json:"maxOrderQuantity,omitempty"`
+	// Fee schedule the participant is charged on, 0 being the standard one.
+	FeeTier uint8 `json:"feeTier,omitempty"`
+	// Most the participant may have exposed across resting orders and
+	// positions, in whole units of price, 0 for no limit. See CreditUsage.
+	CreditLimit float64 `json:"creditLimit,omitempty"`
+	// How the participant's positions are margined against their credit limit.
+	MarginMode MarginMode `json:"marginMode,omitempty"`
+	// Furthest the participant may be long or short, by ticker.
+	PositionLimits map[string]PositionLimit `json:"positionLimits,omitempty"`
+	// Owners the participant is a broker for, and may cancel the orders of.
+	Clients []string `json:"clients,omitempty"`
+	// Market data the participant may subscribe to.
+	DataTier DataTier `json:"dataTier,omitempty"`
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPerpetual = errors.New("invalid perpetual")
+
+// Perpetual is a contract tracking an index without ever expiring. It trades
+// on a book of its own like any other instrument, and is kept near the index
+// by funding: every Interval, holders on the side the contract trades rich to
+// pay those on the other, in proportion to the premium over the index.
+type Perpetual struct {
+	Ticker    string
+	AssetType AssetType
+	Index     string        // Instrument tracked, its mark price the index price
+	Interval  time.Duration // Between fundings, counted from midnight UTC
+	Cap       float64       // Largest rate a single funding may charge, e.g. 0.0075 for 0.75%, 0 for none
+}
+
+// ParsePerpetual parses a "ticker:index:interval:cap%" perpetual definition,
+// e.g. "BTCP:BTC:8h:0.75" for a perpetual on BTC funded every eight hours, at
+// most 0.75% a time. The cap may be left empty for none.
+func ParsePerpetual(assetType AssetType, spec string) (Perpetual, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[0] == parts[1] {
+		return Perpetual{}, fmt.Errorf("%w: %q is not ticker:index:interval:cap%%", ErrInvalidPerpetual, spec)
+	}
+	perp := Perpetual{Ticker: parts[0], AssetType: assetType, Index: parts[1]}
+	interval, err := time.ParseDuration(parts[2])
+	if err != nil || interval <= 0 {
+		return Perpetual{}, fmt.Errorf("%w: interval %q", ErrInvalidPerpetual, parts[2])
+	}
+	perp.Interval = interval
+	if parts[3] != "" {
+		percent, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil || percent < 0 {
+			return Perpetual{}, fmt.Errorf("%w: cap %q", ErrInvalidPerpetual, parts[3])
+		}
+		perp.Cap = percent / 100
+	}
+	return perp, nil
+}
+
+// FundingRate is the rate charged for a premium index, the premium of the
+// contract over its index as a fraction of the index, within the cap.
+func (perp Perpetual) FundingRate(premium float64) float64 {
+	if perp.Cap > 0 {
+		return min(max(premium, -perp.Cap), perp.Cap)
+	}
+	return premium
+}
+
+// NextFunding returns when the perpetual is next funded after t.
+func (perp Perpetual) NextFunding(t time.Time) time.Time {
+	return t.UTC().Truncate(perp.Interval).Add(perp.Interval)
+}
+
+// FundingPayment is what one holder paid or received in a funding.
+type FundingPayment struct {
+	Owner    string
+	Position int64   // Signed lots held, long is positive
+	Amount   float64 // Received less paid, in whole units of the price
+}
+
+// Funding is a single exchange of payments between a perpetual's longs and
+// shorts. A positive rate has longs paying shorts, a negative one shorts
+// paying longs, each by rate times the value of their position at the mark
+// price. Payments net to nothing.
+type Funding struct {
+	Ticker        string
+	Timestamp     time.Time
+	MarkPrice     float64 // The perpetual's last trade
+	IndexPrice    float64
+	Premium       float64 // Averaged over the interval
+	Rate          float64
+	Payments      []FundingPayment // By owner
+	QuantityScale uint8
+	PriceScale    uint8
+}
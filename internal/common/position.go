@@ -0,0 +1,52 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPositionLimits = errors.New("invalid position limits")
+
+// DefaultPositionAccount is the account whose limit in a ticker applies to
+// owners without a limit of their own in it.
+const DefaultPositionAccount = "*"
+
+// PositionLimit is the furthest an account may be long or short a single
+// instrument, in lots. Orders are checked as though everything the account has
+// resting on the same side, and the order itself, were to fill. A zero limit is
+// not checked.
+type PositionLimit struct {
+	MaxLong  uint64 `json:"maxLong,omitempty"`
+	MaxShort uint64 `json:"maxShort,omitempty"`
+}
+
+// ParsePositionLimits reads comma-separated owner:ticker:maxLong:maxShort
+// limits, e.g. "alice:AAPL:1000:500" for alice to be at most 1000 lots long
+// and 500 short of AAPL. Either limit may be left empty, and the owner
+// DefaultPositionAccount sets everyone else's in the ticker.
+func ParsePositionLimits(spec string) (map[PositionKey]PositionLimit, error) {
+	limits := make(map[PositionKey]PositionLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 4 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%w: %q is not owner:ticker:maxLong:maxShort", ErrInvalidPositionLimits, entry)
+		}
+
+		var limit PositionLimit
+		var err error
+		if parts[2] != "" {
+			if limit.MaxLong, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: max long %q", ErrInvalidPositionLimits, parts[2])
+			}
+		}
+		if parts[3] != "" {
+			if limit.MaxShort, err = strconv.ParseUint(parts[3], 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: max short %q", ErrInvalidPositionLimits, parts[3])
+			}
+		}
+		limits[PositionKey{Owner: parts[0], Ticker: parts[1]}] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPricingModel = errors.New("invalid pricing model")
+
+// Length of a year in working out time to expiry, and of the day theta is
+// quoted over.
+const (
+	yearLength = 365 * 24 * time.Hour
+	daysInYear = 365
+)
+
+// A PricingModel values options from the price of their underlying.
+type PricingModel interface {
+	Price(option Option, spot float64, now time.Time) Greeks
+}
+
+// BlackScholes prices European options assuming the underlying's returns are
+// lognormal with a constant volatility, and a constant risk free rate.
+type BlackScholes struct {
+	Volatility float64 // Annualised, e.g. 0.2 for 20%
+	Rate       float64 // Annual, continuously compounded
+}
+
+func (model BlackScholes) Price(option Option, spot float64, now time.Time) Greeks {
+	greeks := Greeks{Ticker: option.Ticker, Timestamp: now, UnderlyingPrice: spot}
+	years := option.Expiry.Sub(now).Seconds() / yearLength.Seconds()
+	if years <= 0 || !(spot > 0) {
+		return IntrinsicModel{}.Price(option, spot, now)
+	}
+
+	sigma := model.Volatility * math.Sqrt(years)
+	d1 := (math.Log(spot/option.Strike) + (model.Rate+model.Volatility*model.Volatility/2)*years) / sigma
+	d2 := d1 - sigma
+	discount := option.Strike * math.Exp(-model.Rate*years)
+	decay := -spot * normalPDF(d1) * model.Volatility / (2 * math.Sqrt(years))
+
+	greeks.Gamma = normalPDF(d1) / (spot * sigma)
+	greeks.Vega = spot * normalPDF(d1) * math.Sqrt(years) / 100
+	if option.Kind == Put {
+		greeks.Theo = discount*normalCDF(-d2) - spot*normalCDF(-d1)
+		greeks.Delta = normalCDF(d1) - 1
+		greeks.Theta = (decay + model.Rate*discount*normalCDF(-d2)) / daysInYear
+	} else {
+		greeks.Theo = spot*normalCDF(d1) - discount*normalCDF(d2)
+		greeks.Delta = normalCDF(d1)
+		greeks.Theta = (decay - model.Rate*discount*normalCDF(d2)) / daysInYear
+	}
+	return greeks
+}
+
+// IntrinsicModel values options at what they would be worth exercised now,
+// ignoring the time left to expiry.
+type IntrinsicModel struct{}
+
+func (IntrinsicModel) Price(option Option, spot float64, now time.Time) Greeks {
+	greeks := Greeks{
+		Ticker:          option.Ticker,
+		Timestamp:       now,
+		UnderlyingPrice: spot,
+		Theo:            option.Intrinsic(spot),
+	}
+	if greeks.Theo > 0 {
+		greeks.Delta = 1
+		if option.Kind == Put {
+			greeks.Delta = -1
+		}
+	}
+	return greeks
+}
+
+// ParsePricingModel parses a pricing model definition, either "intrinsic" or
+// "blackscholes:vol%:rate%", e.g. "blackscholes:25:4.5" for 25% volatility and
+// a 4.5% rate.
+func ParsePricingModel(spec string) (PricingModel, error) {
+	parts := strings.Split(spec, ":")
+	switch strings.ToLower(parts[0]) {
+	case "intrinsic":
+		if len(parts) == 1 {
+			return IntrinsicModel{}, nil
+		}
+	case "blackscholes":
+		if len(parts) != 3 {
+			break
+		}
+		volatility, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || !(volatility > 0) {
+			return nil, fmt.Errorf("%w: volatility %q", ErrInvalidPricingModel, parts[1])
+		}
+		rate, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("%w: rate %q", ErrInvalidPricingModel, parts[2])
+		}
+		return BlackScholes{Volatility: volatility / 100, Rate: rate / 100}, nil
+	}
+	return nil, fmt.Errorf("%w: %q is not intrinsic or blackscholes:vol%%:rate%%", ErrInvalidPricingModel, spec)
+}
+
+func normalCDF(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
+
+func normalPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
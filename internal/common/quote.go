@@ -0,0 +1,12 @@
+package common
+
+// Quote is a two way price in answer to a request for quote, good for at least
+// Quantity (in lots) on either side.
+type Quote struct {
+	Ticker        string
+	BidPrice      float64
+	AskPrice      float64
+	Quantity      uint64
+	QuantityScale uint8
+	PriceScale    uint8
+}
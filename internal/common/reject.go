@@ -0,0 +1,121 @@
+package common
+
+import "errors"
+
+// RejectReason is why a message was rejected, sent alongside the error's text
+// so clients can act on it without parsing English. Errors are tagged with
+// theirs by Reject, anything untagged is RejectUnspecified.
+type RejectReason uint8
+
+const (
+	RejectUnspecified RejectReason = iota
+	// The message could not be parsed.
+	RejectMalformed
+	// The order's side, type, time in force or asset type is not one traded.
+	RejectInvalidOrder
+	RejectUnknownSymbol
+	RejectInvalidPrice
+	// The price is not a whole number of the instrument's ticks.
+	RejectInvalidTick
+	RejectInvalidQuantity
+	RejectDuplicateOrderID
+	// Not enough resting to fill an order which must be filled on arrival.
+	RejectInsufficientLiquidity
+	// Refused by the risk checks, or over the participant's limits.
+	RejectRiskBreach
+	// The risk service could not be asked in time.
+	RejectRiskUnavailable
+	// The book is backing up, see CommandPriority.
+	RejectThrottled
+	// The exchange is halted or closed.
+	RejectTradingHalted
+	// The session is not logged on, or not entitled to the message.
+	RejectNotEntitled
+	// Something went wrong inside the exchange handling the message.
+	RejectInternalError
+	// Over the account's largest order quantity, see the pre-trade checks.
+	RejectMaxQuantity
+	// Over the account's largest order notional.
+	RejectMaxNotional
+	// Priced too far from the last trade, or reference price.
+	RejectPriceCollar
+	// Would take the participant's exposure over their credit limit.
+	RejectCreditLimit
+	// Could take the account's position over its long or short limit.
+	RejectPositionLimit
+	// The engine's input queue is full, see OverflowPolicy.
+	RejectEngineBusy
+)
+
+func (reason RejectReason) String() string {
+	switch reason {
+	case RejectMalformed:
+		return "MALFORMED"
+	case RejectInvalidOrder:
+		return "INVALID_ORDER"
+	case RejectUnknownSymbol:
+		return "UNKNOWN_SYMBOL"
+	case RejectInvalidPrice:
+		return "INVALID_PRICE"
+	case RejectInvalidTick:
+		return "INVALID_TICK"
+	case RejectInvalidQuantity:
+		return "INVALID_QUANTITY"
+	case RejectDuplicateOrderID:
+		return "DUPLICATE_ORDER_ID"
+	case RejectInsufficientLiquidity:
+		return "INSUFFICIENT_LIQUIDITY"
+	case RejectRiskBreach:
+		return "RISK_BREACH"
+	case RejectRiskUnavailable:
+		return "RISK_UNAVAILABLE"
+	case RejectThrottled:
+		return "THROTTLED"
+	case RejectTradingHalted:
+		return "TRADING_HALTED"
+	case RejectNotEntitled:
+		return "NOT_ENTITLED"
+	case RejectInternalError:
+		return "INTERNAL_ERROR"
+	case RejectMaxQuantity:
+		return "MAX_QUANTITY"
+	case RejectMaxNotional:
+		return "MAX_NOTIONAL"
+	case RejectPriceCollar:
+		return "PRICE_COLLAR"
+	case RejectCreditLimit:
+		return "CREDIT_LIMIT"
+	case RejectPositionLimit:
+		return "POSITION_LIMIT"
+	case RejectEngineBusy:
+		return "ENGINE_BUSY"
+	}
+	return "UNSPECIFIED"
+}
+
+// RejectError is an error tagged with the reason clients are told it was
+// rejected for. It compares equal to itself, so tagged sentinel errors still
+// work with errors.Is.
+type RejectError struct {
+	Reason RejectReason
+	error
+}
+
+// Reject tags err with reason.
+func Reject(reason RejectReason, err error) error {
+	return RejectError{Reason: reason, error: err}
+}
+
+func (err RejectError) Unwrap() error {
+	return err.error
+}
+
+// RejectReasonOf returns the reason err was tagged with, the outermost if it
+// was tagged more than once.
+func RejectReasonOf(err error) RejectReason {
+	var reject RejectError
+	if errors.As(err, &reject) {
+		return reject.Reason
+	}
+	return RejectUnspecified
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SettlementPosition is what an owner traded in one instrument over a day.
+// Quantities are lots, see Instrument.QuantityScale. Cash is received selling
+// less paid buying, so is negative for an owner who bought more than they
+// sold.
+type SettlementPosition struct {
+	Owner         string
+	Ticker        string
+	AssetType     AssetType
+	Trades        uint64
+	Bought        uint64
+	Sold          uint64
+	NetQuantity   int64 // Bought less sold
+	Cash          float64
+	QuantityScale uint8
+	PriceScale    uint8
+}
+
+// SettlementCash is an owner's cash across every instrument they traded over a
+// day, to the finest price scale of them.
+type SettlementCash struct {
+	Owner      string
+	Cash       float64
+	PriceScale uint8
+}
+
+// Settlement is a day's trading netted down to what each owner has to settle.
+type Settlement struct {
+	Day       time.Time // Midnight UTC the day starts at
+	Trades    []TradeRecord
+	Positions []SettlementPosition // By owner, then ticker
+	Cash      []SettlementCash     // By owner
+}
+
+// SettlementDay returns midnight UTC of the day t falls on.
+func SettlementDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Settle nets trades, those of the day starting at day, into each owner's
+// position and cash in every instrument they traded. An owner trading with
+// themselves both buys and sells.
+func Settle(day time.Time, trades []TradeRecord) Settlement {
+	settlement := Settlement{Day: day, Trades: trades}
+
+	positions := make(map[PositionKey]*SettlementPosition)
+	book := func(owner string, trade TradeRecord, side Side) {
+		key := PositionKey{Owner: owner, Ticker: trade.Ticker}
+		position, ok := positions[key]
+		if !ok {
+			position = &SettlementPosition{
+				Owner:         owner,
+				Ticker:        trade.Ticker,
+				AssetType:     trade.AssetType,
+				QuantityScale: trade.QuantityScale,
+				PriceScale:    trade.PriceScale,
+			}
+			positions[key] = position
+		}
+
+		notional := trade.Price * float64(trade.Quantity) / math.Pow10(int(trade.QuantityScale))
+		position.Trades++
+		if side == Buy {
+			position.Bought += trade.Quantity
+			position.NetQuantity += int64(trade.Quantity)
+			position.Cash -= notional
+		} else {
+			position.Sold += trade.Quantity
+			position.NetQuantity -= int64(trade.Quantity)
+			position.Cash += notional
+		}
+	}
+	for _, trade := range trades {
+		makerSide := Sell
+		if trade.Aggressor == Sell {
+			makerSide = Buy
+		}
+		book(trade.Taker, trade, trade.Aggressor)
+		book(trade.Maker, trade, makerSide)
+	}
+
+	for _, position := range positions {
+		settlement.Positions = append(settlement.Positions, *position)
+	}
+	slices.SortFunc(settlement.Positions, func(a, b SettlementPosition) int {
+		if c := strings.Compare(a.Owner, b.Owner); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Ticker, b.Ticker)
+	})
+
+	for _, position := range settlement.Positions {
+		n := len(settlement.Cash)
+		if n == 0 || settlement.Cash[n-1].Owner != position.Owner {
+			settlement.Cash = append(settlement.Cash, SettlementCash{Owner: position.Owner})
+			n++
+		}
+		settlement.Cash[n-1].Cash += position.Cash
+		settlement.Cash[n-1].PriceScale = max(settlement.Cash[n-1].PriceScale, position.PriceScale)
+	}
+	return settlement
+}
@@ -0,0 +1,21 @@
+package common
+
+import "time"
+
+// Snapshot is every order resting in the engine at a point in time, and how
+// far along the engine was, so it can be restored as it was after a restart.
+type Snapshot struct {
+	TakenAt  time.Time
+	Markers  ReplayMarkers // Of the last command applied before it was taken
+	Sequence uint64        // Last assigned order sequence
+	TradeID  uint64        // Last assigned trade id
+	Books    []BookState
+}
+
+// BookState is every order resting on a book, bids then asks, each side best
+// price first and in time priority within a price.
+type BookState struct {
+	AssetType AssetType
+	Ticker    string
+	Orders    []Order
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidStrategy = errors.New("invalid strategy")
+
+// StrategyLeg is a single leg of a strategy, as traded buying the strategy.
+type StrategyLeg struct {
+	Ticker string // Leg instrument
+	Side   Side   // Traded buying the strategy, the other side selling it
+	Ratio  uint64 // Lots of the leg per unit of the strategy
+}
+
+// Strategy is an instrument made up of legs traded together, such as an
+// options spread, ordered as one at a net price: the prices of the legs bought
+// less those sold, per unit. Buyers pay at most their limit, sellers receive at
+// least theirs.
+//
+// Unlike baskets, strategies have a book of their own, so strategy orders
+// match against each other as well as against the legs' books.
+type Strategy struct {
+	Ticker    string
+	AssetType AssetType
+	Legs      []StrategyLeg
+}
+
+// Vertical is a spread buying one option and selling another on the same
+// underlying, e.g. a call at one strike against a call at a higher one. Buying
+// it buys long and sells short.
+func Vertical(ticker string, assetType AssetType, long, short string) Strategy {
+	return Strategy{
+		Ticker:    ticker,
+		AssetType: assetType,
+		Legs: []StrategyLeg{
+			{Ticker: long, Side: Buy, Ratio: 1},
+			{Ticker: short, Side: Sell, Ratio: 1},
+		},
+	}
+}
+
+// Straddle is a call and a put at the same strike, bought or sold together.
+func Straddle(ticker string, assetType AssetType, call, put string) Strategy {
+	return Strategy{
+		Ticker:    ticker,
+		AssetType: assetType,
+		Legs: []StrategyLeg{
+			{Ticker: call, Side: Buy, Ratio: 1},
+			{Ticker: put, Side: Buy, Ratio: 1},
+		},
+	}
+}
+
+// ParseStrategy parses a "ticker:kind:leg|leg" strategy definition, e.g.
+// "CS1:vertical:C100|C105" for a call spread bought long the 100 strike call,
+// or "ST1:straddle:C100|P100". Kinds are "vertical" and "straddle".
+func ParseStrategy(assetType AssetType, spec string) (Strategy, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return Strategy{}, fmt.Errorf("%w: %q is not ticker:kind:leg|leg", ErrInvalidStrategy, spec)
+	}
+	legs := strings.Split(parts[2], "|")
+	if len(legs) != 2 || legs[0] == "" || legs[1] == "" {
+		return Strategy{}, fmt.Errorf("%w: %q does not have two legs", ErrInvalidStrategy, parts[2])
+	}
+	switch strings.ToLower(parts[1]) {
+	case "vertical":
+		return Vertical(parts[0], assetType, legs[0], legs[1]), nil
+	case "straddle":
+		return Straddle(parts[0], assetType, legs[0], legs[1]), nil
+	}
+	return Strategy{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidStrategy, parts[1])
+}
@@ -5,8 +5,31 @@ import (
 	"time"
 )
 
+// TradeType is how a trade came about.
+type TradeType uint8
+
+const (
+	// Matched in the books.
+	MatchedTrade TradeType = iota
+	// Booked by an admin between two participants, to correct an error or
+	// register a trade agreed off the exchange, see engine.BookManualTrade.
+	ManualTrade
+)
+
+func (tradeType TradeType) String() string {
+	switch tradeType {
+	case MatchedTrade:
+		return "matched"
+	case ManualTrade:
+		return "manual"
+	}
+	return "unknown"
+}
+
 // Trade accounts for the two parties who matched.
 type Trade struct {
+	ID           uint64 // Engine assigned, unique per engine
+	Type         TradeType
 	Party        *Order
 	CounterParty *Order
 	Timestamp    time.Time
@@ -16,17 +39,76 @@ type Trade struct {
 
 func (t Trade) String() string {
 	return fmt.Sprintf(
-		`Party: [
+		`ID:             %d
+Party: [
 %s]
 CounterParty:   [
 %s]
 Timestamp:      %v
-MatchQty:       %d
+MatchQty:       %s
 Price:          %f`,
+		t.ID,
 		t.Party.String(),
 		t.CounterParty.String(),
 		t.Timestamp.Format(time.RFC3339),
-		t.MatchQty,
+		FormatQuantity(t.MatchQty, t.Party.QuantityScale),
 		t.Price,
 	)
 }
+
+// TradeRecord is a trade as it is kept once it has happened, with who was on
+// either side. Unlike Trade it points at nothing still changing in the books.
+type TradeRecord struct {
+	ID            uint64
+	Type          TradeType
+	Ticker        string
+	AssetType     AssetType
+	Timestamp     time.Time
+	Price         float64
+	Quantity      uint64
+	Aggressor     Side   // Side of the taker
+	Taker         string // Owner of the order which took liquidity
+	TakerOrder    string // UUID
+	Maker         string // Owner of the resting order
+	MakerOrder    string // UUID
+	QuantityScale uint8
+	PriceScale    uint8
+}
+
+// Record copies out the trade as it stands now.
+func (t Trade) Record() TradeRecord {
+	return TradeRecord{
+		ID:            t.ID,
+		Type:          t.Type,
+		Ticker:        t.Party.Ticker,
+		AssetType:     t.Party.AssetType,
+		Timestamp:     t.Timestamp,
+		Price:         t.Price,
+		Quantity:      t.MatchQty,
+		Aggressor:     t.Party.Side,
+		Taker:         t.Party.Owner,
+		TakerOrder:    t.Party.UUID,
+		Maker:         t.CounterParty.Owner,
+		MakerOrder:    t.CounterParty.UUID,
+		QuantityScale: t.Party.QuantityScale,
+		PriceScale:    t.Party.PriceScale,
+	}
+}
+
+// TradeQuery picks out kept trades. Fields left zero match every trade.
+type TradeQuery struct {
+	Ticker string
+	Owner  string    // On either side
+	From   time.Time // Inclusive
+	To     time.Time // Exclusive
+	Limit  int       // The latest this many, still returned earliest first
+}
+
+// Matches returns whether the trade is picked out by the query, leaving aside
+// its limit.
+func (query TradeQuery) Matches(trade TradeRecord) bool {
+	return (query.Ticker == "" || trade.Ticker == query.Ticker) &&
+		(query.Owner == "" || trade.Taker == query.Owner || trade.Maker == query.Owner) &&
+		(query.From.IsZero() || !trade.Timestamp.Before(query.From)) &&
+		(query.To.IsZero() || trade.Timestamp.Before(query.To))
+}
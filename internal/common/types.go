@@ -1,13 +1,41 @@
 package common
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidAssetType = errors.New("invalid asset type")
+
 type AssetType int
 
 // TODO: Flesh these out more, if we care.
 
 const (
 	Equities AssetType = iota
+	// Crypto assets are typically traded in fractional sizes, see
+	// Instrument.QuantityScale.
+	Crypto
 )
 
+// Valid returns whether the asset type is one the exchange knows of.
+func (assetType AssetType) Valid() bool {
+	return assetType == Equities || assetType == Crypto
+}
+
+// ParseAssetType parses an asset type by name, "equities" or "crypto".
+func ParseAssetType(name string) (AssetType, error) {
+	switch strings.ToLower(name) {
+	case "equities":
+		return Equities, nil
+	case "crypto":
+		return Crypto, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidAssetType, name)
+}
+
 type Side int
 
 const (
@@ -15,6 +43,18 @@ const (
 	Sell
 )
 
+func (side Side) Valid() bool {
+	return side == Buy || side == Sell
+}
+
+// Opposite is the side a counterparty to side trades on.
+func (side Side) Opposite() Side {
+	if side == Buy {
+		return Sell
+	}
+	return Buy
+}
+
 type OrderType int
 
 const (
@@ -28,3 +68,180 @@ const (
 	// execute at or near the current best price .
 	MarketOrder
 )
+
+func (orderType OrderType) Valid() bool {
+	return orderType == LimitOrder || orderType == MarketOrder
+}
+
+// TimeInForce is how long an order may rest in the book for.
+type TimeInForce int
+
+const (
+	// Day orders expire at the end of the trading day, so do not survive a
+	// restart.
+	Day TimeInForce = iota
+	// Good-till-cancel orders rest until filled or cancelled, across restarts.
+	GoodTillCancel
+)
+
+func (tif TimeInForce) Valid() bool {
+	return tif == Day || tif == GoodTillCancel
+}
+
+// PriorityClass groups orders which share an allocation at a price level, see
+// Engine.SetAllocation.
+type PriorityClass int
+
+const (
+	// Plain price-time priority.
+	StandardClass PriorityClass = iota
+	// Designated market makers, typically allocated a share of each fill ahead
+	// of time priority.
+	MarketMakerClass
+	NumPriorityClasses
+)
+
+// CancelReason is why an order was taken off the book.
+type CancelReason int
+
+const (
+	// The owner asked for the cancel.
+	CancelRequested CancelReason = iota
+	// An operator cancelled the order, with no further reason given.
+	AdminCancelled
+	// An operator cancelled the order as it was entered in error.
+	AdminErroneousOrder
+	// An operator cancelled the order to contain risk.
+	AdminRiskBreach
+	// An operator cancelled the order for regulatory reasons.
+	AdminRegulatory
+	// A broker acting for the owner asked for the cancel.
+	BrokerCancelled
+	// An operator pulled the exchange's kill switch, cancelling every order.
+	AdminKillSwitch
+	// The exchange cancelled the order as it shut down.
+	AdminShutdown
+	// The order was held for the open, but the symbol closed before it did.
+	MarketClosed
+)
+
+// IsAdmin returns whether the cancel was operator initiated.
+func (reason CancelReason) IsAdmin() bool {
+	return reason >= AdminCancelled && reason <= AdminRegulatory || reason == AdminKillSwitch || reason == AdminShutdown
+}
+
+// CancelRejectReason is why a cancel request was refused. It is the error the
+// engine refuses the cancel with, so it can be passed straight on to clients.
+type CancelRejectReason int
+
+const (
+	// No resting order has the given id.
+	CancelRejectUnknownOrder CancelRejectReason = iota
+	// The order has already been completely filled.
+	CancelRejectFilled
+	// The order belongs to another owner.
+	CancelRejectNotOwner
+)
+
+func (reason CancelRejectReason) Error() string {
+	switch reason {
+	case CancelRejectUnknownOrder:
+		return "order not found"
+	case CancelRejectFilled:
+		return "order already filled"
+	case CancelRejectNotOwner:
+		return "order belongs to another owner"
+	}
+	return "cancel rejected"
+}
+
+// CommandPriority ranks inbound commands for throttling. When a book is under
+// stress, the lowest priorities are rejected first.
+type CommandPriority int
+
+const (
+	// Informational requests which do not change the book.
+	QueryPriority CommandPriority = iota
+	// Orders adding new risk to the book.
+	NewOrderPriority
+	// Orders removing risk from the book.
+	CancelPriority
+	NumCommandPriorities
+)
+
+// ThrottleBudget is how much more a book will take before it throttles, so
+// clients can pace themselves rather than retry blindly.
+type ThrottleBudget struct {
+	// Commands of each priority the book will still admit, -1 if that priority
+	// is never throttled.
+	Remaining [NumCommandPriorities]int
+	// How long until the book is expected to admit a command of each priority
+	// again, zero for those it admits now.
+	RetryAfter [NumCommandPriorities]time.Duration
+}
+
+// OrderStatus is how far an order has got, as acknowledged to its owner.
+type OrderStatus uint8
+
+const (
+	// Resting in the book, nothing filled yet.
+	OrderNew OrderStatus = iota
+	// Resting in the book with some of it filled.
+	OrderPartiallyFilled
+	// Completely filled, no longer in the book.
+	OrderFilled
+	// Not known to the exchange, or not to whoever is asking about it.
+	OrderUnknown
+)
+
+func (status OrderStatus) String() string {
+	switch status {
+	case OrderNew:
+		return "NEW"
+	case OrderPartiallyFilled:
+		return "PARTIALLY_FILLED"
+	case OrderFilled:
+		return "FILLED"
+	case OrderUnknown:
+		return "UNKNOWN"
+	}
+	return "UNKNOWN"
+}
+
+// Liquidity is whether a fill added liquidity to the book or took it, for fees.
+type Liquidity uint8
+
+const (
+	// Not a fill.
+	LiquidityNone Liquidity = iota
+	// The order was resting in the book.
+	LiquidityMaker
+	// The order traded on arrival.
+	LiquidityTaker
+)
+
+func (liquidity Liquidity) String() string {
+	switch liquidity {
+	case LiquidityMaker:
+		return "MAKER"
+	case LiquidityTaker:
+		return "TAKER"
+	}
+	return "NONE"
+}
+
+// SymbolStatus is the state of an individual symbol, as published to clients.
+type SymbolStatus int
+
+const (
+	SymbolNormal SymbolStatus = iota
+	// The symbol's book is backed up and is throttling incoming commands.
+	SymbolStressed
+	// An admin has halted the symbol, new orders are refused until it is
+	// resumed. Cancels are still accepted.
+	SymbolHalted
+	// The symbol's trading calendar has it in pre-open, or closed, see
+	// TradingCalendar.
+	SymbolPreOpen
+	SymbolClosed
+)
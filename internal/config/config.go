@@ -0,0 +1,140 @@
+// Package config configures a command from a YAML file and the environment as
+// well as its flags, so a deployment can be written down once rather than as a
+// command line. The file and environment set flags by name, so anything which
+// can be set by a flag can be set by either, and is checked as the flag is.
+// The command line wins over the environment, and the environment over the
+// file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrInvalidSetting = errors.New("invalid setting")
+)
+
+// EnvPrefix starts the environment variables flags are set from, e.g.
+// FENRIR_MSGRATE for -msgrate.
+const EnvPrefix = "FENRIR_"
+
+// Load reads a config file of settings keyed by flag name, e.g.
+//
+//	port: 9001
+//	msgrate: 500
+//	admins: [root, ops]
+//	risklimits:
+//	  - "*:1000:50000:5"
+//	  - "alice:5000::"
+//
+// Lists are joined with commas, as the flags take them. Values ending in a
+// colon must be quoted, or YAML takes them as keys.
+func Load(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unable to read config %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case nil:
+			settings[name] = ""
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				if !scalar(item) {
+					return nil, fmt.Errorf("%w: %s, lists may only hold values", ErrInvalidSetting, name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			settings[name] = strings.Join(items, ",")
+		default:
+			if !scalar(value) {
+				return nil, fmt.Errorf("%w: %s, expected a value or list of them", ErrInvalidSetting, name)
+			}
+			settings[name] = fmt.Sprint(value)
+		}
+	}
+	return settings, nil
+}
+
+func scalar(value any) bool {
+	switch value.(type) {
+	case string, bool, int, float64:
+		return true
+	}
+	return false
+}
+
+// Apply sets every flag not given on the command line from the environment,
+// as looked up by getenv, or failing that from settings. Settings for flags
+// which do not exist are refused, so mistyped ones are not silently ignored.
+// The flags must already have been parsed.
+func Apply(flags *flag.FlagSet, settings map[string]string, getenv func(string) string) error {
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+		}
+	}
+
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] {
+			return
+		}
+		value, ok := settings[f.Name]
+		if env := getenv(EnvName(f.Name)); env != "" {
+			value, ok = env, true
+		}
+		if !ok {
+			return
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidSetting, f.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// EnvName is the environment variable flag name is set from.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// A Check validates a flag's value beyond what parsing it as its type does,
+// e.g. that a spec parses.
+type Check func(value string) error
+
+// Validate runs each flag's check on its value, returning every flag which
+// fails.
+func Validate(flags *flag.FlagSet, checks map[string]Check) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		f := flags.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+		}
+		if err := checks[name](f.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidSetting, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
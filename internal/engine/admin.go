@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNotAdminReason = errors.New("not an admin cancel reason")
+)
+
+// AdminCancelOrder cancels any resting order, regardless of owner. The owner is
+// sent an unsolicited cancel carrying the reason.
+func (engine *Engine) AdminCancelOrder(uuid string, reason CancelReason) (Order, error) {
+	if !reason.IsAdmin() {
+		return Order{}, ErrNotAdminReason
+	}
+
+	for _, book := range engine.Books {
+		if order, ok := book.removeOrder(uuid); ok {
+			engine.auditCancel(order, reason)
+			book.flushUpdates()
+			engine.reportUnsolicitedCancel(*order, reason)
+			return *order, nil
+		}
+	}
+	return Order{}, ErrOrderNotFound
+}
+
+// AdminCancelSymbol cancels every resting order on the ticker's book. Each owner
+// is sent an unsolicited cancel per order carrying the reason.
+func (engine *Engine) AdminCancelSymbol(ticker string, reason CancelReason) ([]Order, error) {
+	if !reason.IsAdmin() {
+		return nil, ErrNotAdminReason
+	}
+
+	book, ok := engine.Books[ticker]
+	if !ok {
+		return nil, ErrBookNotFound
+	}
+
+	var orders []Order
+	book.scanOrders(func(order *Order) {
+		orders = append(orders, *order)
+	})
+	for _, order := range orders {
+		if removed, ok := book.removeOrder(order.UUID); ok {
+			engine.auditCancel(removed, reason)
+		}
+		engine.reportUnsolicitedCancel(order, reason)
+	}
+	book.flushUpdates()
+
+	log.Warn().
+		Str("ticker", ticker).
+		Int("orders", len(orders)).
+		Int("reason", int(reason)).
+		Msg("admin cancelled symbol")
+	return orders, nil
+}
+
+// AdminCancelOwner cancels every resting order owner has on any book, in ticker
+// order. They are sent an unsolicited cancel per order carrying the reason.
+func (engine *Engine) AdminCancelOwner(owner string, reason CancelReason) ([]Order, error) {
+	if !reason.IsAdmin() {
+		return nil, ErrNotAdminReason
+	}
+
+	var orders []Order
+	for _, ticker := range slices.Sorted(maps.Keys(engine.Books)) {
+		book := engine.Books[ticker]
+		var owned []Order
+		book.scanOrders(func(order *Order) {
+			if order.Owner == owner {
+				owned = append(owned, *order)
+			}
+		})
+		for _, order := range owned {
+			if removed, ok := book.removeOrder(order.UUID); ok {
+				engine.auditCancel(removed, reason)
+			}
+			engine.reportUnsolicitedCancel(order, reason)
+		}
+		book.flushUpdates()
+		orders = append(orders, owned...)
+	}
+
+	log.Warn().
+		Str("owner", owner).
+		Int("orders", len(orders)).
+		Int("reason", int(reason)).
+		Msg("admin cancelled owner")
+	return orders, nil
+}
+
+// KillSwitch cancels every resting order on every book, on behalf of admin. It
+// is recorded in the audit trail ahead of the cancels, and each owner is sent
+// an unsolicited cancel per order. Halting the books is up to whoever pulls it.
+func (engine *Engine) KillSwitch(admin string) []Order {
+	engine.auditKillSwitch(admin)
+
+	orders, _ := engine.AdminCancelAll(AdminKillSwitch)
+
+	log.Warn().
+		Str("admin", admin).
+		Int("books", len(engine.Books)).
+		Int("orders", len(orders)).
+		Msg("kill switch pulled")
+	return orders
+}
+
+// AdminCancelAll cancels every resting order on every book, in ticker order,
+// for reason, e.g. as the exchange shuts down. Returns the orders cancelled.
+func (engine *Engine) AdminCancelAll(reason CancelReason) ([]Order, error) {
+	if !reason.IsAdmin() {
+		return nil, ErrNotAdminReason
+	}
+
+	var orders []Order
+	for _, ticker := range slices.Sorted(maps.Keys(engine.Books)) {
+		cancelled, _ := engine.AdminCancelSymbol(ticker, reason)
+		orders = append(orders, cancelled...)
+	}
+	return orders, nil
+}
+
+// reportUnsolicitedCancel lets the owner know their order is gone. Failing to
+// reach them does not undo the cancel.
+func (engine *Engine) reportUnsolicitedCancel(order Order, reason CancelReason) {
+	if engine.reporter == nil {
+		return
+	}
+	if err := engine.reporter.ReportUnsolicitedCancel(order, reason); err != nil {
+		log.Error().
+			Err(err).
+			Str("owner", order.Owner).
+			Str("uuid", order.UUID).
+			Msg("unable to report unsolicited cancel")
+	}
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrAuctionMarketOrder = Reject(RejectInvalidOrder, errors.New("market orders are not accepted in an auction"))
+	ErrLegInAuction       = Reject(RejectTradingHalted, errors.New("a leg is in an auction"))
+)
+
+// StartAuction puts ticker in an opening auction until Uncross. Limit orders
+// rest on its book without matching, however far they cross, and market
+// orders are refused, as are basket and strategy orders with it as a leg.
+// Where the book would uncross is published as it changes, as an
+// IndicativeUpdate. The book need not exist yet, one made for an order in the
+// auction is in it.
+func (engine *Engine) StartAuction(ticker string) {
+	engine.auctions[ticker] = true
+	if book, ok := engine.Books[ticker]; ok {
+		book.flushUpdates()
+	}
+}
+
+// InAuction returns whether ticker is in an auction.
+func (engine *Engine) InAuction(ticker string) bool {
+	return engine.auctions[ticker]
+}
+
+// IndicativeUncross returns where ticker, in an auction, would uncross now.
+func (engine *Engine) IndicativeUncross(ticker string) (Uncross, error) {
+	book, ok := engine.Books[ticker]
+	if !ok {
+		return Uncross{}, ErrBookNotFound
+	}
+	return book.uncross(), nil
+}
+
+// Uncross ends ticker's auction, executing every order which crosses at the
+// price executing the most volume. Of the prices executing as much, that
+// leaving the least surplus is taken, then the highest if the surplus is
+// always of buyers, the lowest if always of sellers, else the middle one.
+// Orders execute in price then time priority, the later of each pair as the
+// taker, and what is left of them goes on trading continuously. Returns where
+// the book uncrossed, nothing if it was not in an auction.
+func (engine *Engine) Uncross(ticker string) (Uncross, error) {
+	if !engine.auctions[ticker] {
+		return Uncross{Ticker: ticker}, nil
+	}
+	delete(engine.auctions, ticker)
+	book, ok := engine.Books[ticker]
+	if !ok {
+		return Uncross{Ticker: ticker}, nil
+	}
+
+	defer book.flushUpdates()
+	uncross := book.uncross()
+	if uncross.Volume == 0 {
+		return uncross, nil
+	}
+	return uncross, book.match(uncross.Price)
+}
+
+// legsInAuction returns whether any of tickers is in an auction.
+func (engine *Engine) legsInAuction(tickers ...string) bool {
+	return slices.ContainsFunc(tickers, engine.InAuction)
+}
+
+func (book *OrderBook) inAuction() bool {
+	return book.engine.auctions[book.Instrument.Ticker]
+}
+
+// uncross finds where the book would uncross, see Engine.Uncross.
+func (book *OrderBook) uncross() Uncross {
+	none := Uncross{Ticker: book.Instrument.Ticker}
+	bestBid, _, bidOk := book.BestBid()
+	bestAsk, _, askOk := book.BestAsk()
+	if !bidOk || !askOk || bestBid < bestAsk {
+		return none
+	}
+
+	// Only prices between the best ask and best bid execute anything, and
+	// only those of levels execute more than the ones either side.
+	var prices []float64
+	for _, levels := range []*PriceLevels{book.Bids, book.Asks} {
+		levels.Scan(func(level *PriceLevel) bool {
+			if level.PriceLevel < bestAsk || level.PriceLevel > bestBid {
+				return false
+			}
+			prices = append(prices, level.PriceLevel)
+			return true
+		})
+	}
+	slices.Sort(prices)
+	prices = slices.Compact(prices)
+
+	var best []Uncross
+	for _, price := range prices {
+		candidate := book.uncrossAt(price)
+		switch {
+		case len(best) == 0, candidate.Volume > best[0].Volume,
+			candidate.Volume == best[0].Volume && candidate.Surplus < best[0].Surplus:
+			best = []Uncross{candidate}
+		case candidate.Volume == best[0].Volume && candidate.Surplus == best[0].Surplus:
+			best = append(best, candidate)
+		}
+	}
+
+	pressure := func(side Side) bool {
+		return !slices.ContainsFunc(best, func(u Uncross) bool { return u.Surplus == 0 || u.SurplusSide != side })
+	}
+	switch {
+	case pressure(Buy):
+		return best[len(best)-1]
+	case pressure(Sell):
+		return best[0]
+	}
+	return best[(len(best)-1)/2]
+}
+
+// uncrossAt returns what the book would execute at price.
+func (book *OrderBook) uncrossAt(price float64) Uncross {
+	volume := func(levels *PriceLevels, within func(float64) bool) uint64 {
+		total := uint64(0)
+		levels.Scan(func(level *PriceLevel) bool {
+			if !within(level.PriceLevel) {
+				return false
+			}
+			total += level.Quantity()
+			return true
+		})
+		return total
+	}
+	bought := volume(book.Bids, func(p float64) bool { return p >= price })
+	sold := volume(book.Asks, func(p float64) bool { return p <= price })
+
+	uncross := Uncross{Ticker: book.Instrument.Ticker, Price: price, Volume: min(bought, sold)}
+	if bought > sold {
+		uncross.Surplus, uncross.SurplusSide = bought-sold, Buy
+	} else {
+		uncross.Surplus, uncross.SurplusSide = sold-bought, Sell
+	}
+	return uncross
+}
+
+// publishIndicative sends where the book would uncross if it has changed since
+// it was last sent, and that it no longer would once its auction is over.
+func (book *OrderBook) publishIndicative() {
+	var indicative Uncross
+	if book.inAuction() {
+		indicative = book.uncross()
+	}
+	if indicative == book.lastIndicative {
+		return
+	}
+	book.lastIndicative = indicative
+	book.publish(MarketDataUpdate{
+		Type:      IndicativeUpdate,
+		Timestamp: book.engine.Now(),
+		Side:      indicative.SurplusSide,
+		Price:     indicative.Price,
+		Quantity:  indicative.Volume,
+	})
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	. "fenrir/internal/common"
+)
+
+// An Auditor records the audit trail of every order event. Record is called
+// synchronously from the matching path.
+type Auditor interface {
+	RecordAuditEvent(event AuditEvent)
+}
+
+// Auditors records every event with each auditor in turn.
+type Auditors []Auditor
+
+func (auditors Auditors) RecordAuditEvent(event AuditEvent) {
+	for _, auditor := range auditors {
+		auditor.RecordAuditEvent(event)
+	}
+}
+
+func (engine *Engine) SetAuditor(auditor Auditor) {
+	engine.auditor = auditor
+}
+
+// orderEvent fills in what an audit event knows of the order itself.
+func orderEvent(typ AuditEventType, order *Order) AuditEvent {
+	return AuditEvent{
+		Type:               typ,
+		OrderUUID:          order.UUID,
+		ClOrdID:            order.ClOrdID,
+		Owner:              order.Owner,
+		Ticker:             order.Ticker,
+		AssetType:          order.AssetType,
+		Side:               order.Side,
+		OrderType:          order.OrderType,
+		TimeInForce:        order.TimeInForce,
+		LimitPrice:         order.LimitPrice,
+		QuantityScale:      order.QuantityScale,
+		Quantity:           order.Quantity,
+		ClientTimestamp:    order.ClientTimestamp,
+		GatewayTimestamp:   order.Timestamp,
+		SequencerTimestamp: order.ExchTimestamp,
+		OrderSequence:      order.Sequence,
+	}
+}
+
+// audit stamps the event with the next audit sequence and records it.
+func (engine *Engine) audit(event AuditEvent) {
+	if engine.auditor == nil {
+		return
+	}
+	engine.auditSequence++
+	event.Sequence = engine.auditSequence
+	engine.auditor.RecordAuditEvent(event)
+}
+
+func (engine *Engine) auditNewOrder(order *Order) {
+	engine.audit(orderEvent(NewOrderEvent, order))
+}
+
+// auditTrade records the trade from both sides.
+func (engine *Engine) auditTrade(trade Trade) {
+	for _, side := range []struct {
+		order, counterparty *Order
+		aggressor           bool
+	}{
+		{trade.Party, trade.CounterParty, true},
+		{trade.CounterParty, trade.Party, false},
+	} {
+		event := orderEvent(TradeEvent, side.order)
+		event.Quantity = trade.MatchQty
+		event.MatchTimestamp = trade.Timestamp
+		event.TradeID = trade.ID
+		event.Price = trade.Price
+		event.CounterpartyUUID = side.counterparty.UUID
+		event.Aggressor = side.aggressor
+		event.TradeType = trade.Type
+		engine.audit(event)
+	}
+}
+
+func (engine *Engine) auditKillSwitch(admin string) {
+	engine.audit(AuditEvent{
+		Type:      KillSwitchEvent,
+		Owner:     admin,
+		Timestamp: engine.Now(),
+	})
+}
+
+func (engine *Engine) auditCancel(order *Order, reason CancelReason) {
+	event := orderEvent(CancelEvent, order)
+	event.CancelReason = reason
+	event.Timestamp = engine.Now()
+	engine.audit(event)
+}
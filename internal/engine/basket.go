@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrInvalidBasket         = Reject(RejectInvalidOrder, errors.New("invalid basket"))
+	ErrBasketNotExecutable   = Reject(RejectInsufficientLiquidity, errors.New("basket cannot be executed in full"))
+	ErrBasketLimitNotReached = Reject(RejectInsufficientLiquidity, errors.New("basket limit price not reached"))
+)
+
+// RegisterBasket adds a basket instrument to the engine. All legs must trade in
+// the basket's asset type, and the basket ticker must not clash with an
+// existing instrument.
+func (engine *Engine) RegisterBasket(basket Basket) error {
+	if !engine.assets[basket.AssetType] {
+		return ErrUnsupportedAsset
+	}
+	if len(basket.Legs) == 0 {
+		return ErrInvalidBasket
+	}
+	if _, ok := engine.Instruments[basket.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Baskets[basket.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+
+	seen := make(map[string]bool)
+	for _, leg := range basket.Legs {
+		if leg.Weight == 0 || seen[leg.Ticker] || leg.Ticker == basket.Ticker {
+			return ErrInvalidBasket
+		}
+		seen[leg.Ticker] = true
+		// Make sure every leg has a book to trade against.
+		if _, err := engine.Book(basket.AssetType, leg.Ticker); err != nil {
+			return err
+		}
+	}
+
+	engine.Baskets[basket.Ticker] = basket
+	return nil
+}
+
+// placeBasketOrder decomposes a basket order into an order per leg, with
+// all-or-nothing semantics. Before anything is executed, each leg is checked
+// for enough resting liquidity to fill in full and, for limit orders, the
+// combined per-unit price of the legs is checked against the limit. Only then
+// are the legs executed. If any check fails, nothing trades.
+//
+// Basket orders never rest, they are always liquidity takers.
+func (engine *Engine) placeBasketOrder(basket Basket, order Order) error {
+	legs, err := engine.planBasketOrder(basket, order)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, leg := range legs {
+		if err := leg.book.PlaceOrder(leg.order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// basketLeg is the order a basket order sends to one of its legs' books.
+type basketLeg struct {
+	book  *OrderBook
+	order Order
+}
+
+// planBasketOrder runs the checks for a basket order, returning the order to
+// send to each leg if they pass. Nothing is executed.
+func (engine *Engine) planBasketOrder(basket Basket, order Order) ([]basketLeg, error) {
+	legs := make([]basketLeg, 0, len(basket.Legs))
+	notional := 0.0
+	for _, leg := range basket.Legs {
+		hi, quantity := bits.Mul64(order.Quantity, leg.Weight)
+		if hi != 0 {
+			return nil, ErrInvalidBasket
+		}
+
+		book := engine.Books[leg.Ticker]
+		worst, cost, ok := book.sweep(order.Side, quantity)
+		if !ok {
+			return nil, ErrBasketNotExecutable
+		}
+		notional += cost
+
+		// Each leg is sent as a limit order at the worst price level the sweep
+		// touched. As we have checked there is enough liquidity up to that
+		// price, the leg fills in full and never rests.
+		legOrder := order
+		legOrder.Ticker = book.Instrument.Ticker
+		legOrder.OrderType = LimitOrder
+		legOrder.LimitPrice = worst
+		legOrder.Quantity = quantity
+		legOrder.TotalQuantity = quantity
+		legs = append(legs, basketLeg{book: book, order: legOrder})
+	}
+
+	if order.OrderType == LimitOrder && order.Quantity > 0 {
+		unitPrice := notional / float64(order.Quantity)
+		if (order.Side == Buy && unitPrice > order.LimitPrice) ||
+			(order.Side == Sell && unitPrice < order.LimitPrice) {
+			return nil, ErrBasketLimitNotReached
+		}
+	}
+	return legs, nil
+}
+
+// sweep walks the opposite side of the book to a taker on side, as far as is
+// needed to fill quantity. It returns the worst price level touched and the
+// notional cost of the fill. ok is false if the book is not deep enough.
+func (book *OrderBook) sweep(side Side, quantity uint64) (worst float64, notional float64, ok bool) {
+	levels := book.Asks
+	if side == Sell {
+		levels = book.Bids
+	}
+
+	remaining := quantity
+	worst = math.NaN()
+	levels.Scan(func(level *PriceLevel) bool {
+		level.Orders.Scan(func(order *Order) bool {
+			fill := min(remaining, order.Quantity)
+			remaining -= fill
+			notional += float64(fill) * level.PriceLevel
+			return remaining > 0
+		})
+		worst = level.PriceLevel
+		return remaining > 0
+	})
+	return worst, notional, remaining == 0
+}
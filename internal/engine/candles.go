@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	. "fenrir/internal/common"
+)
+
+// CandleResolution is the shortest candle interval kept, longer ones are rolled
+// up from it as they are asked for.
+const CandleResolution = time.Minute
+
+var (
+	ErrInvalidCandleInterval = errors.New("candle interval must be a whole number of minutes")
+)
+
+// addCandleTrade folds the trade into its symbol's candle, by the time on the
+// engine's clock it was matched at.
+func (engine *Engine) addCandleTrade(ticker string, at time.Time, price float64, quantity uint64) {
+	start := at.Truncate(CandleResolution)
+	candles := engine.candles[ticker]
+	// Trades nearly always land in the latest candle, but those restored from
+	// an earlier run need not.
+	i, found := slices.BinarySearchFunc(candles, start, func(c Candle, start time.Time) int {
+		return c.Start.Compare(start)
+	})
+	if !found {
+		candles = slices.Insert(candles, i, Candle{Start: start})
+		engine.candles[ticker] = candles
+	}
+	candles[i].Add(price, quantity)
+}
+
+// RestoreCandles rebuilds candles from the trades audited by earlier runs, so
+// their history survives restarts. Only the aggressor's side of each matched
+// trade is counted.
+func (engine *Engine) RestoreCandles(events []AuditEvent) {
+	for _, event := range events {
+		if event.Type == TradeEvent && event.Aggressor && event.TradeType == MatchedTrade {
+			engine.addCandleTrade(event.Ticker, event.MatchTimestamp, event.Price, event.Quantity)
+		}
+	}
+}
+
+// Candles returns up to limit of the symbol's candles of interval starting in
+// [from, to), oldest first. A zero to means up to now, and a limit of 0 means
+// no limit.
+func (engine *Engine) Candles(ticker string, interval time.Duration, from, to time.Time, limit int) (CandlePage, error) {
+	if interval < CandleResolution || interval%CandleResolution != 0 {
+		return CandlePage{}, ErrInvalidCandleInterval
+	}
+	inst, ok := engine.Instruments[ticker]
+	if !ok {
+		// Symbols only traded in earlier runs still have their history, on
+		// the default instrument they would be traded on again.
+		if _, ok := engine.candles[ticker]; !ok {
+			return CandlePage{}, ErrBookNotFound
+		}
+		inst = Instrument{Ticker: ticker, PriceScale: DefaultPriceScale}
+	}
+
+	page := CandlePage{
+		Ticker:        ticker,
+		Interval:      interval,
+		QuantityScale: inst.QuantityScale,
+		PriceScale:    inst.PriceScale,
+	}
+	from = from.Truncate(interval)
+	candles := engine.candles[ticker]
+	i, _ := slices.BinarySearchFunc(candles, from, func(c Candle, from time.Time) int {
+		return c.Start.Compare(from)
+	})
+	for ; i < len(candles); i++ {
+		start := candles[i].Start.Truncate(interval)
+		if !to.IsZero() && !start.Before(to) {
+			break
+		}
+		n := len(page.Candles)
+		if n > 0 && page.Candles[n-1].Start.Equal(start) {
+			page.Candles[n-1].Merge(candles[i])
+			continue
+		}
+		if limit > 0 && n == limit {
+			page.Next = start
+			break
+		}
+		page.Candles = append(page.Candles, Candle{Start: start})
+		page.Candles[n].Merge(candles[i])
+	}
+	return page, nil
+}
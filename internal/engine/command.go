@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrCommandApplied      = errors.New("command already applied")
+	ErrUnknownCommand      = errors.New("unknown command type")
+	ErrCommandNotJournaled = errors.New("unable to journal command")
+)
+
+// A CommandJournal records every command the engine applies, in the order they
+// were applied, before it is applied. Replaying the journal onto the books as
+// they were rebuilds them as they are. RecordCommand is called synchronously
+// from the matching path, a command it fails to record is not applied.
+type CommandJournal interface {
+	RecordCommand(cmd Command) error
+}
+
+func (engine *Engine) SetCommandJournal(journal CommandJournal) {
+	engine.commandJournal = journal
+}
+
+// ReplayMarkers returns the engine's markers, to be saved alongside its state.
+func (engine *Engine) ReplayMarkers() ReplayMarkers {
+	return ReplayMarkers{
+		Sequence: engine.commandSequence,
+		Sessions: maps.Clone(engine.sessionMarkers),
+	}
+}
+
+// SessionMarker returns the last command applied from session, zero if none
+// has been. Sessions starting over, e.g. after a restart, number their
+// commands on from it.
+func (engine *Engine) SessionMarker(session string) CommandOrigin {
+	return engine.sessionMarkers[session]
+}
+
+// RestoreReplayMarkers sets the engine's markers to those saved with the state
+// it was restored to.
+func (engine *Engine) RestoreReplayMarkers(markers ReplayMarkers) {
+	engine.commandSequence = markers.Sequence
+	engine.sessionMarkers = maps.Clone(markers.Sessions)
+	if engine.sessionMarkers == nil {
+		engine.sessionMarkers = make(map[string]CommandOrigin)
+	}
+}
+
+// Apply journals and runs a command, returning the orders it cancelled. A
+// command from a session which has had a later, or the same, command applied
+// already is refused with ErrCommandApplied, so a session's commands only ever
+// take effect once. Commands not sent over a session are always applied.
+//
+// The command is journaled even if it is rejected, replaying it rejects it
+// again. One which could not be journaled is refused with
+// ErrCommandNotJournaled, without touching the books.
+func (engine *Engine) Apply(cmd Command) ([]Order, error) {
+	if engine.applied(cmd.Origin) {
+		return nil, ErrCommandApplied
+	}
+	cmd.Sequence = engine.commandSequence + 1
+	cmd.Time = engine.Now()
+	if engine.commandJournal != nil {
+		if err := engine.commandJournal.RecordCommand(cmd); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCommandNotJournaled, err)
+		}
+	}
+	engine.commandSequence = cmd.Sequence
+	engine.mark(cmd.Origin)
+	return engine.run(cmd)
+}
+
+// Replay applies journaled commands in order, skipping any at or before the
+// replay markers, and returns how many were applied. Commands keep the
+// sequence they were journaled under and are not journaled again, and are
+// timestamped as they were the first time around. Errors the commands
+// themselves are rejected with are not returned, they were rejected the first
+// time around too.
+func (engine *Engine) Replay(cmds []Command) (int, error) {
+	applied := 0
+	for _, cmd := range cmds {
+		if cmd.Sequence <= engine.commandSequence || engine.applied(cmd.Origin) {
+			continue
+		}
+		engine.commandSequence = cmd.Sequence
+		engine.mark(cmd.Origin)
+		if _, err := engine.run(cmd); errors.Is(err, ErrUnknownCommand) {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// applied returns whether the session origin came from has had it, or a later
+// command, applied.
+func (engine *Engine) applied(origin CommandOrigin) bool {
+	if origin.Session == "" {
+		return false
+	}
+	last, ok := engine.sessionMarkers[origin.Session]
+	return ok && !origin.After(last)
+}
+
+func (engine *Engine) mark(origin CommandOrigin) {
+	if origin.Session != "" {
+		engine.sessionMarkers[origin.Session] = origin
+	}
+}
+
+// run carries out the command on the books, at the time it was applied.
+func (engine *Engine) run(cmd Command) ([]Order, error) {
+	engine.recycle()
+	engine.commandTime = cmd.Time
+	defer func() { engine.commandTime = time.Time{} }()
+
+	switch cmd.Type {
+	case PlaceOrderCommand:
+		if len(cmd.Orders) != 1 {
+			return nil, ErrUnknownCommand
+		}
+		return nil, engine.PlaceOrder(cmd.AssetType, cmd.Orders[0])
+	case PlaceOrderGroupCommand:
+		return nil, engine.PlaceOrderGroup(cmd.Orders)
+	case CancelOwnOrderCommand:
+		order, err := engine.CancelOwnOrder(cmd.AssetType, cmd.Owner, cmd.UUID)
+		return []Order{order}, err
+	case CancelClientOrderCommand:
+		order, err := engine.CancelClientOrder(cmd.AssetType, cmd.Owner, cmd.ClOrdID)
+		return []Order{order}, err
+	case AdminCancelOrderCommand:
+		order, err := engine.AdminCancelOrder(cmd.UUID, cmd.Reason)
+		return []Order{order}, err
+	case AdminCancelSymbolCommand:
+		return engine.AdminCancelSymbol(cmd.Ticker, cmd.Reason)
+	case KillSwitchCommand:
+		return engine.KillSwitch(cmd.Owner), nil
+	case AdminCancelOwnerCommand:
+		return engine.AdminCancelOwner(cmd.Owner, cmd.Reason)
+	case AdminCancelAllCommand:
+		return engine.AdminCancelAll(cmd.Reason)
+	case ManualTradeCommand:
+		if len(cmd.Orders) != 2 {
+			return nil, ErrUnknownCommand
+		}
+		return engine.BookManualTrade(cmd.AssetType, cmd.Orders[0], cmd.Orders[1])
+	case StartAuctionCommand:
+		engine.StartAuction(cmd.Ticker)
+		return nil, nil
+	case UncrossCommand:
+		_, err := engine.Uncross(cmd.Ticker)
+		return nil, err
+	}
+	return nil, ErrUnknownCommand
+}
@@ -0,0 +1,259 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrInvariantViolation = errors.New("book invariant violated")
+)
+
+// CompactionMetrics adds up the work done by Compact since the engine started.
+type CompactionMetrics struct {
+	Runs       uint64
+	TimeSpent  time.Duration // Over every run
+	LastRun    time.Duration
+	Violations uint64 // Invariant violations found, over every run
+	Dropped    uint64 // Stale books dropped, over every run
+}
+
+// SetLevelTTL sets how long levels and books go untouched before they are
+// stale, see BookMetrics. Compact drops books which are stale and empty, once
+// it is set. Zero, the default, never has them go stale.
+func (engine *Engine) SetLevelTTL(ttl time.Duration) {
+	engine.levelTTL = ttl
+}
+
+// Compact tidies the engine up, and is meant to be run while it is quiet, e.g.
+// overnight. Every book's price level indexes are rebuilt, as they fragment
+// with orders coming and going, and the spare capacity left behind by bursts of
+// activity is handed back. Each book's invariants are then checked, anything
+// wrong with them being returned. Nothing about the books changes as far as
+// trading is concerned.
+//
+// With a level TTL set, books made on the fly for unlisted tickers are dropped
+// once empty and stale, along with their instrument, so tickers traded for a
+// while and never again are not held on to for good. They are made again if
+// traded, their market data sequences starting over.
+func (engine *Engine) Compact() error {
+	start := time.Now()
+
+	dropped := engine.dropStaleBooks()
+	for _, book := range engine.Books {
+		book.compact()
+	}
+	engine.Trades = slices.Clone(engine.Trades)
+	engine.throttle.compact()
+
+	var violations []error
+	for _, book := range engine.Books {
+		violations = append(violations, book.checkInvariants()...)
+	}
+
+	elapsed := time.Since(start)
+	engine.compaction.Runs++
+	engine.compaction.TimeSpent += elapsed
+	engine.compaction.LastRun = elapsed
+	engine.compaction.Violations += uint64(len(violations))
+	engine.compaction.Dropped += uint64(dropped)
+	log.Info().
+		Int("books", len(engine.Books)).
+		Int("dropped", dropped).
+		Int("violations", len(violations)).
+		Dur("elapsed", elapsed).
+		Uint64("runs", engine.compaction.Runs).
+		Dur("timeSpent", engine.compaction.TimeSpent).
+		Msg("engine compacted")
+	return errors.Join(violations...)
+}
+
+// CheckIntegrity checks every book's invariants, as Compact does, without
+// touching them, returning anything wrong.
+func (engine *Engine) CheckIntegrity() error {
+	var violations []error
+	for _, book := range engine.Books {
+		violations = append(violations, book.checkInvariants()...)
+	}
+	return errors.Join(violations...)
+}
+
+// CompactionMetrics returns the work done by Compact so far.
+func (engine *Engine) CompactionMetrics() CompactionMetrics {
+	return engine.compaction
+}
+
+// compact rebuilds the book's levels into freshly packed trees, and its index
+// of resting orders, which never shrinks.
+func (book *OrderBook) compact() {
+	book.Bids.compact()
+	book.Asks.compact()
+	book.orders = maps.Clone(book.orders)
+	// Cleared after every command, but never shrinks.
+	book.touched = make(map[levelKey]bool)
+}
+
+// checkInvariants returns everything wrong with the book: levels with no
+// orders or the wrong aggregate quantity, orders on the wrong level or side,
+// orders with nothing left to trade, orders the index of resting orders does
+// not have as they are and a crossed book.
+func (book *OrderBook) checkInvariants() []error {
+	var violations []error
+	violated := func(format string, args ...any) {
+		violations = append(violations, fmt.Errorf("%w: %s: %s",
+			ErrInvariantViolation, book.Instrument.Ticker, fmt.Sprintf(format, args...)))
+	}
+
+	uuids := make(map[string]bool)
+	for _, side := range []Side{Buy, Sell} {
+		book.levelsOf(side).Scan(func(level *PriceLevel) bool {
+			if level.Orders.Len() == 0 {
+				violated("empty level at %v", level.PriceLevel)
+			}
+			total := uint64(0)
+			level.Orders.Scan(func(order *Order) bool {
+				total += order.Quantity
+				switch {
+				case order.Side != side:
+					violated("order %s on the wrong side", order.UUID)
+				case order.LimitPrice != level.PriceLevel:
+					violated("order %s at %v on level %v", order.UUID, order.LimitPrice, level.PriceLevel)
+				case order.Quantity == 0 || order.Quantity > order.TotalQuantity:
+					violated("order %s resting with %d of %d", order.UUID, order.Quantity, order.TotalQuantity)
+				case uuids[order.UUID]:
+					violated("order %s resting twice", order.UUID)
+				case book.indexed(order) == nil || book.indexed(order).level != level:
+					violated("order %s not indexed as resting on level %v", order.UUID, level.PriceLevel)
+				}
+				uuids[order.UUID] = true
+				return true
+			})
+			if total != level.quantity {
+				violated("level at %v totals %d, not %d", level.PriceLevel, total, level.quantity)
+			}
+			return true
+		})
+	}
+
+	if len(book.orders) != len(uuids) {
+		violated("%d orders indexed, %d resting", len(book.orders), len(uuids))
+	}
+
+	bid, _, bidOk := book.BestBid()
+	ask, _, askOk := book.BestAsk()
+	if bidOk && askOk && bid >= ask {
+		violated("crossed at %v/%v", bid, ask)
+	}
+	return violations
+}
+
+// compact reallocates the throttle's maps, which never shrink.
+func (throttle *Throttle) compact() {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	depth := make(map[string]int, len(throttle.depth))
+	maps.Copy(depth, throttle.depth)
+	throttle.depth = depth
+	stressed := make(map[string]bool, len(throttle.stressed))
+	maps.Copy(stressed, throttle.stressed)
+	throttle.stressed = stressed
+}
+
+// BookMetrics returns what the books are holding on to, see SetLevelTTL.
+func (engine *Engine) BookMetrics() BookMetrics {
+	now := engine.Now()
+	metrics := BookMetrics{Books: len(engine.Books), Dropped: engine.compaction.Dropped}
+	for _, book := range engine.Books {
+		if book.Bids.Len() == 0 && book.Asks.Len() == 0 {
+			metrics.EmptyBooks++
+			if engine.droppable(book, now) {
+				metrics.StaleBooks++
+			}
+			continue
+		}
+		for _, levels := range []*PriceLevels{book.Bids, book.Asks} {
+			metrics.Levels += levels.Len()
+			levels.Scan(func(level *PriceLevel) bool {
+				metrics.Orders += level.Orders.Len()
+				untouched := now.Sub(level.touchedAt)
+				metrics.OldestLevel = max(metrics.OldestLevel, untouched)
+				if engine.stale(level.touchedAt, now) {
+					metrics.StaleLevels++
+				}
+				return true
+			})
+		}
+	}
+	return metrics
+}
+
+// touchLevel records level, and so its book, being touched now.
+func (book *OrderBook) touchLevel(level *PriceLevel) {
+	level.touchedAt = book.engine.Now()
+	book.touchedAt = level.touchedAt
+}
+
+// stale returns whether something last touched at touchedAt has gone untouched
+// for the level TTL by now.
+func (engine *Engine) stale(touchedAt, now time.Time) bool {
+	return engine.levelTTL > 0 && now.Sub(touchedAt) >= engine.levelTTL
+}
+
+// droppable returns whether book may be dropped: made on the fly, with nothing
+// resting, stale and with nothing listed on the exchange built on it.
+func (engine *Engine) droppable(book *OrderBook, now time.Time) bool {
+	if !book.transient || book.Bids.Len() > 0 || book.Asks.Len() > 0 || !engine.stale(book.touchedAt, now) {
+		return false
+	}
+	ticker := book.Instrument.Ticker
+	if _, ok := engine.options[ticker]; ok {
+		return false
+	}
+	if _, ok := engine.perpetuals[ticker]; ok {
+		return false
+	}
+	for _, option := range engine.options {
+		if option.Underlying == ticker {
+			return false
+		}
+	}
+	for _, perp := range engine.perpetuals {
+		if perp.Index == ticker {
+			return false
+		}
+	}
+	for _, basket := range engine.Baskets {
+		if slices.ContainsFunc(basket.Legs, func(leg BasketLeg) bool { return leg.Ticker == ticker }) {
+			return false
+		}
+	}
+	for _, strategy := range engine.Strategies {
+		if slices.ContainsFunc(strategy.Legs, func(leg StrategyLeg) bool { return leg.Ticker == ticker }) {
+			return false
+		}
+	}
+	return true
+}
+
+// dropStaleBooks drops every droppable book, and its instrument, returning how
+// many were.
+func (engine *Engine) dropStaleBooks() int {
+	now := engine.Now()
+	dropped := 0
+	for ticker, book := range engine.Books {
+		if engine.droppable(book, now) {
+			delete(engine.Books, ticker)
+			delete(engine.Instruments, ticker)
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	. "fenrir/internal/common"
+)
+
+var ErrCreditLimitExceeded = Reject(RejectCreditLimit, errors.New("order would take exposure over the credit limit"))
+
+// SetCreditLimit sets the most owner may have exposed, see CreditUsage. A limit
+// of 0 removes it.
+func (engine *Engine) SetCreditLimit(owner string, limit float64) {
+	if limit > 0 {
+		engine.creditLimits[owner] = limit
+	} else {
+		delete(engine.creditLimits, owner)
+	}
+}
+
+// reservation is what an owner has resting on a book. It is kept up to date as
+// their orders rest, fill and are cancelled, so checking credit never has to
+// walk the book.
+type reservation struct {
+	orders   int     // Resting
+	notional float64 // Of what is left of them, in lots at their limit prices
+}
+
+// reserve records quantity of owner's resting at price.
+func (book *OrderBook) reserve(owner string, price float64, quantity uint64) {
+	held, ok := book.reserved[owner]
+	if !ok {
+		held = &reservation{}
+		book.reserved[owner] = held
+	}
+	held.orders++
+	held.notional += price * float64(quantity)
+}
+
+// release records quantity of owner's at price no longer resting, filled or
+// with the order it was of removed.
+func (book *OrderBook) release(owner string, price float64, quantity uint64, removed bool) {
+	held, ok := book.reserved[owner]
+	if !ok {
+		return
+	}
+	held.notional -= price * float64(quantity)
+	if removed {
+		held.orders--
+	}
+	// Nothing rests, so whatever rounding has built up is dropped with it.
+	if held.orders <= 0 {
+		delete(book.reserved, owner)
+	}
+}
+
+// reservedBy is the notional of what owner has resting on the book.
+func (book *OrderBook) reservedBy(owner string) float64 {
+	held, ok := book.reserved[owner]
+	if !ok {
+		return 0
+	}
+	return held.notional * book.Instrument.Lot()
+}
+
+// Credit returns how much of owner's credit limit is taken up, and false if
+// they do not have one. Exposure is worked out from the books and ledger as
+// they stand, so credit is released as soon as orders fill or are cancelled.
+// Positions are margined by owner's MarginMode, each valued at its mark price
+// under StandardMargin, see markPrice.
+func (engine *Engine) Credit(owner string) (CreditUsage, bool) {
+	limit, ok := engine.creditLimits[owner]
+	if !ok {
+		return CreditUsage{}, false
+	}
+
+	usage := CreditUsage{Limit: limit}
+	for _, book := range engine.Books {
+		usage.Reserved += book.reservedBy(owner)
+	}
+
+	engine.ledgerLock.Lock()
+	defer engine.ledgerLock.Unlock()
+	if engine.marginModes[owner] == PortfolioMargin {
+		usage.Positions = engine.portfolioMargin(owner)
+		return usage, true
+	}
+	for key, position := range engine.ledger.Positions {
+		if key.Owner == owner {
+			usage.Positions += engine.positionExposure(key.Ticker, position)
+		}
+	}
+	return usage, true
+}
+
+// ScanReserved works out what owner has reserved by resting orders from every
+// order on the books, as Credit keeps track of as they change. It walks every
+// book, so is only for checking the two agree, say once an engine has been
+// recovered, and in tests.
+func (engine *Engine) ScanReserved(owner string) float64 {
+	reserved := 0.0
+	for _, book := range engine.Books {
+		lot := book.Instrument.Lot()
+		book.scanOrders(func(order *Order) {
+			if order.Owner == owner {
+				reserved += order.LimitPrice * float64(order.Quantity) * lot
+			}
+		})
+	}
+	return reserved
+}
+
+// checkCredit rejects an order which could take its owner's exposure over their
+// credit limit, were it to rest or fill in full.
+func (engine *Engine) checkCredit(order Order) error {
+	usage, ok := engine.Credit(order.Owner)
+	if !ok {
+		return nil
+	}
+	notional := engine.orderNotional(order)
+	if usage.Exposure()+notional > usage.Limit {
+		return fmt.Errorf("%w: %g exposed of %g, order %g", ErrCreditLimitExceeded, usage.Exposure(), usage.Limit, notional)
+	}
+	return nil
+}
+
+// orderNotional is the most an order could add to its owner's exposure. Limit
+// orders are taken at their limit price, market orders at what they would
+// fill at against the book, or against the legs of a basket or strategy.
+func (engine *Engine) orderNotional(order Order) float64 {
+	if order.OrderType == LimitOrder {
+		return order.LimitPrice * float64(order.Quantity) * engine.lot(order.Ticker)
+	}
+
+	if book, ok := engine.Books[order.Ticker]; ok {
+		if _, cost, ok := book.sweep(order.Side, order.Quantity); ok {
+			return cost * book.Instrument.Lot()
+		}
+	}
+	var legs []basketLeg
+	if basket, ok := engine.Baskets[order.Ticker]; ok {
+		legs, _ = engine.planBasketOrder(basket, order)
+	} else if strategy, ok := engine.Strategies[order.Ticker]; ok {
+		legs, _, _ = engine.planStrategyOrder(strategy, order)
+	}
+	notional := 0.0
+	for _, leg := range legs {
+		notional += leg.order.LimitPrice * float64(leg.order.Quantity) * leg.book.Instrument.Lot()
+	}
+	return notional
+}
+
+// lot is the size of a single lot of ticker, whole units if it is not known.
+func (engine *Engine) lot(ticker string) float64 {
+	if inst, ok := engine.Instruments[ticker]; ok {
+		return inst.Lot()
+	}
+	return 1
+}
+
+// lastPrice is the price ticker last traded at.
+func (engine *Engine) lastPrice(ticker string) (float64, bool) {
+	candles := engine.candles[ticker]
+	if len(candles) == 0 {
+		return 0, false
+	}
+	return candles[len(candles)-1].Close, true
+}
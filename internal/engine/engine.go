@@ -3,58 +3,451 @@ package engine
 import (
 	"errors"
 	. "fenrir/internal/common"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 var (
-	ErrBookNotFound = errors.New("order book not found")
+	ErrBookNotFound         = Reject(RejectUnknownSymbol, errors.New("order book not found"))
+	ErrUnsupportedAsset     = Reject(RejectInvalidOrder, errors.New("unsupported asset type"))
+	ErrInstrumentExists     = errors.New("instrument already registered")
+	ErrInstrumentMismatch   = Reject(RejectInvalidOrder, errors.New("order does not match instrument"))
+	ErrInvalidQuantityScale = Reject(RejectInvalidQuantity, errors.New("invalid quantity scale"))
+	ErrDuplicateClOrdID     = Reject(RejectDuplicateOrderID, errors.New("client order id already in use"))
+	ErrInvalidPriceScale    = Reject(RejectInvalidTick, errors.New("invalid price scale"))
 )
 
 // A reporter deals with passing a trade up to the respective owners.
 type Reporter interface {
 	ReportTrade(trade Trade, err error) error
 	ReportError(client string, err error) error
+	ReportSymbolStatus(ticker string, status SymbolStatus) error
+	ReportUnsolicitedCancel(order Order, reason CancelReason) error
 }
 
 // This is the main matchine engine.
+//
+// There is a single order book per instrument, keyed by ticker. Instruments
+// can be registered up front (to give them a non-default quantity scale),
+// otherwise they are created on first use with whole-lot quantities. Baskets
+// are synthetic instruments without a book, see RegisterBasket. Strategies
+// have a book, but also trade against their legs', see RegisterStrategy.
 type Engine struct {
-	Books    map[AssetType]OrderBook
-	Trades   []Trade
-	reporter Reporter
+	Books         map[string]*OrderBook
+	Instruments   map[string]Instrument
+	Baskets       map[string]Basket
+	Strategies    map[string]Strategy
+	Trades        []Trade
+	assets        map[AssetType]bool
+	throttle      *Throttle
+	reporter      Reporter
+	publisher     MarketDataPublisher
+	auditor       Auditor
+	clock         Clock
+	sequence      uint64 // Last assigned order sequence
+	tradeID       uint64 // Last assigned trade id
+	tradeIDStride uint64 // Trade ids are handed out in steps of, see shard.go
+	auditSequence uint64 // Last assigned audit event sequence
+
+	// Commands applied, see command.go.
+	commandJournal  CommandJournal
+	commandSequence uint64                   // Last applied command
+	sessionMarkers  map[string]CommandOrigin // Last applied command per session
+	commandTime     time.Time                // Of the command being applied
+
+	// Allocation at a price level, see priority.go.
+	priorityClasses map[string]PriorityClass
+	allocations     map[PriorityClass]uint64
+
+	// How orders at a level are matched, by default and for instruments of
+	// their own, see policy.go.
+	policy             MatchPolicy
+	instrumentPolicies map[string]MatchPolicy
+
+	// Positions and trade counts, see ledger.go.
+	ledger     Ledger
+	ledgerLock sync.Mutex
+
+	// Work done tidying up, and how long levels go untouched before they are
+	// stale, see compact.go.
+	compaction CompactionMetrics
+	levelTTL   time.Duration
+
+	// Where trades are kept for good, see trades.go.
+	tradeRecorder TradeRecorder
+	retainTrades  int
+
+	// Candles by ticker, oldest first, at CandleResolution. See candles.go.
+	candles map[string][]Candle
+
+	// Most each owner may have exposed, see credit.go.
+	creditLimits map[string]float64
+
+	// Furthest each owner may be long or short each ticker, see positions.go.
+	positionLimits map[PositionKey]PositionLimit
+
+	// How each owner's positions are margined, and how far each underlying
+	// is moved under portfolio margin, see margin.go.
+	marginModes map[string]MarginMode
+	scanRanges  map[string]float64
+
+	// Listed options by ticker, and what values them, see options.go.
+	options map[string]Option
+	pricing PricingModel
+
+	// Perpetuals by ticker, and their premium index since they were last
+	// funded, see funding.go.
+	perpetuals map[string]Perpetual
+	premiums   map[string]premiumIndex
+
+	// Prices taken from outside the exchange by ticker, see index.go.
+	indexPrices map[string]float64
+
+	// Tickers in an auction, see auction.go.
+	auctions map[string]bool
+
+	// Ticks the books of instruments kept on a price ladder span, see
+	// ladder.go.
+	ladders map[string]int
+
+	// Queue entries and levels taken off the books by the command being run,
+	// to be reused, see pool.go.
+	retired retired
 }
 
 func New(supportedAssets ...AssetType) *Engine {
 	engine := &Engine{
-		Books: make(map[AssetType]OrderBook),
+		Books:       make(map[string]*OrderBook),
+		Instruments: make(map[string]Instrument),
+		Baskets:     make(map[string]Basket),
+		Strategies:  make(map[string]Strategy),
+		assets:      make(map[AssetType]bool),
+		throttle:    NewThrottle(DefaultThrottleThresholds),
+		clock:       SystemClock{},
+
+		tradeIDStride:      1,
+		priorityClasses:    make(map[string]PriorityClass),
+		allocations:        make(map[PriorityClass]uint64),
+		policy:             FIFOPolicy{},
+		instrumentPolicies: make(map[string]MatchPolicy),
+		ledger:             NewLedger(),
+		candles:            make(map[string][]Candle),
+		sessionMarkers:     make(map[string]CommandOrigin),
+		creditLimits:       make(map[string]float64),
+		positionLimits:     make(map[PositionKey]PositionLimit),
+		marginModes:        make(map[string]MarginMode),
+		scanRanges:         make(map[string]float64),
+		options:            make(map[string]Option),
+		perpetuals:         make(map[string]Perpetual),
+		premiums:           make(map[string]premiumIndex),
+		indexPrices:        make(map[string]float64),
+		auctions:           make(map[string]bool),
+		ladders:            make(map[string]int),
 	}
 
-	for assetType := range supportedAssets {
-		engine.Books[AssetType(assetType)] = NewOrderBook(engine)
+	for _, assetType := range supportedAssets {
+		engine.assets[assetType] = true
 	}
 
 	return engine
 }
 
+// RegisterInstrument adds an instrument and its order book to the engine.
+func (engine *Engine) RegisterInstrument(inst Instrument) error {
+	if !engine.assets[inst.AssetType] {
+		return ErrUnsupportedAsset
+	}
+	if inst.QuantityScale > MaxQuantityScale {
+		return ErrInvalidQuantityScale
+	}
+	if inst.PriceScale > MaxPriceScale {
+		return ErrInvalidPriceScale
+	}
+	if _, ok := engine.Instruments[inst.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Baskets[inst.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+
+	engine.Instruments[inst.Ticker] = inst
+	engine.Books[inst.Ticker] = NewOrderBook(engine, inst)
+	return nil
+}
+
+// Instrument returns the instrument registered under ticker.
+func (engine *Engine) Instrument(ticker string) (Instrument, bool) {
+	inst, ok := engine.Instruments[ticker]
+	return inst, ok
+}
+
+// Tickers returns the ticker of every instrument of assetType, in order.
+func (engine *Engine) Tickers(assetType AssetType) []string {
+	var tickers []string
+	for ticker, inst := range engine.Instruments {
+		if inst.AssetType == assetType {
+			tickers = append(tickers, ticker)
+		}
+	}
+	slices.Sort(tickers)
+	return tickers
+}
+
+// Book returns the order book for the ticker, creating a whole-lot instrument
+// priced in cents for it if it has not been seen before.
+func (engine *Engine) Book(assetType AssetType, ticker string) (*OrderBook, error) {
+	if book, ok := engine.Books[ticker]; ok {
+		if book.Instrument.AssetType != assetType {
+			return nil, ErrInstrumentMismatch
+		}
+		return book, nil
+	}
+
+	inst := Instrument{Ticker: ticker, AssetType: assetType, PriceScale: DefaultPriceScale}
+	if err := engine.RegisterInstrument(inst); err != nil {
+		return nil, err
+	}
+	book := engine.Books[ticker]
+	book.transient = true
+	return book, nil
+}
+
+// nextSequence hands out the time priority of a new order.
+func (engine *Engine) nextSequence() uint64 {
+	engine.sequence++
+	return engine.sequence
+}
+
+// SetClock sets the clock the engine timestamps with, real time by default.
+func (engine *Engine) SetClock(clock Clock) {
+	engine.clock = clock
+}
+
+// Now is the time on the engine's clock. Everything a command does happens at
+// the time it was applied, so replaying it later does it at the same time.
+func (engine *Engine) Now() time.Time {
+	if !engine.commandTime.IsZero() {
+		return engine.commandTime
+	}
+	return engine.clock.Now()
+}
+
 func (engine *Engine) SetReporter(reporter Reporter) {
 	engine.reporter = reporter
 }
 
 func (engine *Engine) PlaceOrder(assetType AssetType, order Order) error {
-	book, ok := engine.Books[assetType]
-	if !ok {
-		return ErrBookNotFound
+	if order.ClOrdID != 0 {
+		if _, ok := engine.ClientOrder(order.Owner, order.ClOrdID); ok {
+			return ErrDuplicateClOrdID
+		}
+	}
+	if err := engine.checkCredit(order); err != nil {
+		return err
+	}
+	if err := engine.checkPositionLimit(order); err != nil {
+		return err
+	}
+
+	if basket, ok := engine.Baskets[order.Ticker]; ok {
+		if basket.AssetType != assetType {
+			return ErrInstrumentMismatch
+		}
+		for _, leg := range basket.Legs {
+			if engine.legsInAuction(leg.Ticker) {
+				return ErrLegInAuction
+			}
+		}
+		return engine.placeBasketOrder(basket, order)
+	}
+
+	book, err := engine.Book(assetType, order.Ticker)
+	if err != nil {
+		return err
+	}
+	if strategy, ok := engine.Strategies[order.Ticker]; ok {
+		for _, leg := range strategy.Legs {
+			if engine.legsInAuction(leg.Ticker) {
+				return ErrLegInAuction
+			}
+		}
+		return engine.placeStrategyOrder(strategy, book, order)
 	}
 	return book.PlaceOrder(order)
 }
 
+// BBO returns the best bid and offer for the ticker.
+func (engine *Engine) BBO(ticker string) (BBO, error) {
+	book, ok := engine.Books[ticker]
+	if !ok {
+		return BBO{}, ErrBookNotFound
+	}
+	return book.bbo(), nil
+}
+
+// Depth returns up to levels aggregated price levels per side for the ticker.
+func (engine *Engine) Depth(ticker string, levels int) (BookDepth, error) {
+	book, ok := engine.Books[ticker]
+	if !ok {
+		return BookDepth{}, ErrBookNotFound
+	}
+
+	depth := BookDepth{
+		Ticker:        ticker,
+		QuantityScale: book.Instrument.QuantityScale,
+		PriceScale:    book.Instrument.PriceScale,
+		Sequence:      book.mdSequence,
+	}
+	depth.Bids, depth.Asks = book.Depth(levels)
+	return depth, nil
+}
+
+// OpenOrders returns every order resting in the books on behalf of owner.
+func (engine *Engine) OpenOrders(owner string) []Order {
+	var orders []Order
+	for _, book := range engine.Books {
+		book.scanOrders(func(order *Order) {
+			if order.Owner == owner {
+				orders = append(orders, *order)
+			}
+		})
+	}
+	return orders
+}
+
+// OrderOwner returns who owns the resting order uuid.
+func (engine *Engine) OrderOwner(uuid string) (string, bool) {
+	for _, book := range engine.Books {
+		if order, ok := book.resting(uuid); ok {
+			return order.Owner, true
+		}
+	}
+	return "", false
+}
+
+// ClientOrder finds the live order owner assigned clOrdID to.
+func (engine *Engine) ClientOrder(owner string, clOrdID uint64) (Order, bool) {
+	if clOrdID == 0 {
+		return Order{}, false
+	}
+	for _, book := range engine.Books {
+		var found *Order
+		book.scanOrders(func(order *Order) {
+			if order.Owner == owner && order.ClOrdID == clOrdID {
+				found = order
+			}
+		})
+		if found != nil {
+			return *found, true
+		}
+	}
+	return Order{}, false
+}
+
+// OrderStatus returns how far an order placed on ticker has got, along with the
+// quantity it has left resting. An order which was placed successfully but is
+// no longer resting has been filled.
+func (engine *Engine) OrderStatus(ticker string, uuid string) (OrderStatus, uint64) {
+	var resting *Order
+	if book, ok := engine.Books[ticker]; ok {
+		resting, _ = book.resting(uuid)
+	}
+
+	switch {
+	case resting == nil:
+		return OrderFilled, 0
+	case resting.Quantity < resting.TotalQuantity:
+		return OrderPartiallyFilled, resting.Quantity
+	default:
+		return OrderNew, resting.Quantity
+	}
+}
+
 func (engine *Engine) CancelOrder(assetType AssetType, uuid string) error {
-	book, ok := engine.Books[assetType]
+	if !engine.assets[assetType] {
+		return ErrUnsupportedAsset
+	}
+	for _, book := range engine.Books {
+		if book.Instrument.AssetType != assetType {
+			continue
+		}
+		if err := book.CancelOrder(uuid); err == nil {
+			return nil
+		}
+	}
+	return ErrOrderNotFound
+}
+
+// CancelOwnOrder cancels an order on behalf of owner, who must own it. The
+// cancelled order is returned as it was on the book, or as it was last filled
+// alongside ErrOrderFilled, so the owner can reconcile.
+func (engine *Engine) CancelOwnOrder(assetType AssetType, owner string, uuid string) (Order, error) {
+	for _, book := range engine.Books {
+		resting, ok := book.resting(uuid)
+		if book.Instrument.AssetType != assetType || !ok {
+			continue
+		}
+		if resting.Owner != owner {
+			return Order{}, ErrNotOrderOwner
+		}
+		order := *resting
+		return order, book.CancelOrder(uuid)
+	}
+
+	if order, ok := engine.filled(func(order *Order) bool { return order.UUID == uuid }); ok {
+		if order.Owner != owner {
+			return Order{}, ErrNotOrderOwner
+		}
+		return order, ErrOrderFilled
+	}
+	return Order{}, ErrOrderNotFound
+}
+
+// CancelClientOrder cancels an order by the id its owner assigned it.
+func (engine *Engine) CancelClientOrder(assetType AssetType, owner string, clOrdID uint64) (Order, error) {
+	order, ok := engine.ClientOrder(owner, clOrdID)
 	if !ok {
-		return ErrBookNotFound
+		if clOrdID == 0 {
+			return Order{}, ErrOrderNotFound
+		}
+		if filled, ok := engine.filled(func(order *Order) bool {
+			return order.Owner == owner && order.ClOrdID == clOrdID
+		}); ok {
+			return filled, ErrOrderFilled
+		}
+		return Order{}, ErrOrderNotFound
 	}
-	return book.CancelOrder(uuid)
+	return engine.CancelOwnOrder(assetType, owner, order.UUID)
+}
+
+// RecentTrades returns up to limit of the latest trades, oldest first, on ticker
+// or on every ticker if it is empty. A limit of zero returns them all.
+func (engine *Engine) RecentTrades(ticker string, limit int) []Trade {
+	var trades []Trade
+	for i := len(engine.Trades) - 1; i >= 0 && (limit == 0 || len(trades) < limit); i-- {
+		if trade := engine.Trades[i]; ticker == "" || trade.Party.Ticker == ticker {
+			trades = append(trades, trade)
+		}
+	}
+	slices.Reverse(trades)
+	return trades
+}
+
+// filled returns the order matching match if it has been completely filled,
+// going by the trade history.
+func (engine *Engine) filled(match func(order *Order) bool) (Order, bool) {
+	for i := len(engine.Trades) - 1; i >= 0; i-- {
+		trade := engine.Trades[i]
+		for _, order := range []*Order{trade.Party, trade.CounterParty} {
+			if match(order) && order.Quantity == 0 {
+				return *order, true
+			}
+		}
+	}
+	return Order{}, false
 }
 
 // Match sanity checks before firing an execution report to the
@@ -62,32 +455,56 @@ func (engine *Engine) CancelOrder(assetType AssetType, uuid string) error {
 // We expect the price the trade was matched (maker's price level)
 // and quantity matched.
 func (engine *Engine) DoTrade(taker, maker *Order, price float64, quantity uint64) error {
+	return engine.bookTrade(MatchedTrade, taker, maker, price, quantity)
+}
+
+// bookTrade records, publishes and reports a trade of the given type. Only
+// matched trades were made at the market, so only they are shown to it.
+func (engine *Engine) bookTrade(tradeType TradeType, taker, maker *Order, price float64, quantity uint64) error {
+	matched := tradeType == MatchedTrade
+	engine.tradeID += engine.tradeIDStride
 	trade := Trade{
+		ID:           engine.tradeID,
+		Type:         tradeType,
 		Party:        taker,
 		CounterParty: maker,
-		Timestamp:    time.Now(),
+		Timestamp:    engine.Now(),
 		MatchQty:     quantity,
 		Price:        price,
 	}
 
-	if err := engine.reporter.ReportTrade(trade, nil); err != nil {
-		return err
+	// The match has happened regardless of whether the owners can be told
+	// about it, so record and publish it first.
+	engine.Trades = append(engine.Trades, trade)
+	engine.recordTrade(trade)
+	if matched {
+		engine.addCandleTrade(taker.Ticker, trade.Timestamp, price, quantity)
 	}
-	if err := engine.reporter.ReportTrade(trade, nil); err != nil {
-		return err
+	// Audited before it is booked, so the ledger never runs ahead of the
+	// audit trail.
+	engine.auditTrade(trade)
+	engine.applyTrade(trade)
+	if matched {
+		if book, ok := engine.Books[taker.Ticker]; ok {
+			book.publishTrade(trade)
+		}
+		engine.publishGreeks(taker.Ticker)
+		engine.samplePremium(taker.Ticker)
 	}
 
-	// TODO: Think about persistance but I cba right now.
-	engine.Trades = append(engine.Trades, trade)
-	return nil
+	// A single report covers both sides.
+	return engine.reporter.ReportTrade(trade, nil)
 }
 
 func (engine *Engine) LogBook() {
-	for asset, book := range engine.Books {
+	for ticker, book := range engine.Books {
 		bids := FlattenLevels(book.Bids.Items())
 		asks := FlattenLevels(book.Asks.Items())
 		log.Info().
-			Int("asset", int(asset)).
+			Int("asset", int(book.Instrument.AssetType)).
+			Str("ticker", ticker).
+			Uint8("quantityScale", book.Instrument.QuantityScale).
+			Uint8("priceScale", book.Instrument.PriceScale).
 			Any("bids", bids).
 			Any("asks", asks).
 			Msg("")
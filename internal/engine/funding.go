@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrNotAPerpetual    = errors.New("not a perpetual")
+	ErrNoFundingPrice   = errors.New("perpetual or its index has not traded")
+	ErrInvalidPerpIndex = errors.New("perpetuals may only track instruments with a book")
+)
+
+// premiumIndex averages a perpetual's premium over its index, sampled every
+// time either is priced, between fundings.
+type premiumIndex struct {
+	sum     float64
+	samples int
+}
+
+// RegisterPerpetual lists a perpetual, trading on a book of its own like any
+// other instrument. If its instrument has not been registered already, it is
+// created with the default scales. Its index must be an instrument with a book,
+// or one only priced from outside the exchange, see SetIndexPrice.
+func (engine *Engine) RegisterPerpetual(perp Perpetual) error {
+	if !engine.assets[perp.AssetType] {
+		return ErrUnsupportedAsset
+	}
+	if perp.Interval <= 0 || perp.Cap < 0 || perp.Index == perp.Ticker {
+		return ErrInvalidPerpetual
+	}
+	if _, ok := engine.perpetuals[perp.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Strategies[perp.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.options[perp.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Baskets[perp.Index]; ok {
+		return ErrInvalidPerpIndex
+	}
+	if _, ok := engine.Strategies[perp.Index]; ok {
+		return ErrInvalidPerpIndex
+	}
+	if _, err := engine.Book(perp.AssetType, perp.Ticker); err != nil {
+		return err
+	}
+	engine.perpetuals[perp.Ticker] = perp
+	return nil
+}
+
+// Perpetual returns the perpetual listed under ticker.
+func (engine *Engine) Perpetual(ticker string) (Perpetual, bool) {
+	perp, ok := engine.perpetuals[ticker]
+	return perp, ok
+}
+
+// samplePremium adds the premium of every perpetual priced off ticker to its
+// premium index, after ticker trades or its index price changes.
+func (engine *Engine) samplePremium(ticker string) {
+	for _, perp := range engine.perpetuals {
+		if perp.Ticker != ticker && perp.Index != ticker {
+			continue
+		}
+		premium, ok := engine.premium(perp)
+		if !ok {
+			continue
+		}
+		index := engine.premiums[perp.Ticker]
+		index.sum += premium
+		index.samples++
+		engine.premiums[perp.Ticker] = index
+	}
+}
+
+// premium is how far the perpetual last traded above its index, as a fraction
+// of the index. The index price is the index's mark price, see markPrice.
+func (engine *Engine) premium(perp Perpetual) (float64, bool) {
+	mark, ok := engine.lastPrice(perp.Ticker)
+	if !ok {
+		return 0, false
+	}
+	index, ok := engine.markPrice(perp.Index)
+	if !ok || index == 0 {
+		return 0, false
+	}
+	return (mark - index) / index, true
+}
+
+// Fund exchanges funding between the holders of the perpetual listed under
+// ticker, at the average premium since it was last funded, or the premium now
+// if neither it nor its index has traded since. Payments are booked to the
+// ledger, see Ledger.Funding, and the premium index starts over.
+func (engine *Engine) Fund(ticker string) (Funding, error) {
+	perp, ok := engine.perpetuals[ticker]
+	if !ok {
+		return Funding{}, ErrNotAPerpetual
+	}
+	premium, ok := engine.premium(perp)
+	if !ok {
+		return Funding{}, ErrNoFundingPrice
+	}
+	if index := engine.premiums[ticker]; index.samples > 0 {
+		premium = index.sum / float64(index.samples)
+	}
+	delete(engine.premiums, ticker)
+
+	inst := engine.Instruments[ticker]
+	funding := Funding{
+		Ticker:        ticker,
+		Timestamp:     engine.Now(),
+		Premium:       premium,
+		Rate:          perp.FundingRate(premium),
+		QuantityScale: inst.QuantityScale,
+		PriceScale:    inst.PriceScale,
+	}
+	funding.MarkPrice, _ = engine.lastPrice(ticker)
+	funding.IndexPrice, _ = engine.markPrice(perp.Index)
+
+	engine.ledgerLock.Lock()
+	defer engine.ledgerLock.Unlock()
+	for key, position := range engine.ledger.Positions {
+		if key.Ticker != ticker || position == 0 {
+			continue
+		}
+		// Longs pay a positive rate, shorts receive it.
+		amount := -float64(position) * inst.Lot() * funding.MarkPrice * funding.Rate
+		engine.ledger.Funding[key] += amount
+		funding.Payments = append(funding.Payments, FundingPayment{Owner: key.Owner, Position: position, Amount: amount})
+	}
+	slices.SortFunc(funding.Payments, func(a, b FundingPayment) int {
+		return strings.Compare(a.Owner, b.Owner)
+	})
+	return funding, nil
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	. "fenrir/internal/common"
+)
+
+// CheckOrder returns the error PlaceOrder would reject the order with, without
+// placing it or creating a book for it.
+func (engine *Engine) CheckOrder(assetType AssetType, order Order) error {
+	if order.ClOrdID != 0 {
+		if _, ok := engine.ClientOrder(order.Owner, order.ClOrdID); ok {
+			return ErrDuplicateClOrdID
+		}
+	}
+	if err := engine.checkCredit(order); err != nil {
+		return err
+	}
+	if err := engine.checkPositionLimit(order); err != nil {
+		return err
+	}
+
+	if basket, ok := engine.Baskets[order.Ticker]; ok {
+		if basket.AssetType != assetType {
+			return ErrInstrumentMismatch
+		}
+		_, err := engine.planBasketOrder(basket, order)
+		return err
+	}
+
+	book, ok := engine.Books[order.Ticker]
+	if !ok {
+		// It would be traded on a whole-lot instrument priced in cents, see Book.
+		if !engine.assets[assetType] {
+			return ErrUnsupportedAsset
+		}
+		inst := Instrument{Ticker: order.Ticker, AssetType: assetType, PriceScale: DefaultPriceScale}
+		book = NewOrderBook(engine, inst)
+	}
+	if book.Instrument.AssetType != assetType {
+		return ErrInstrumentMismatch
+	}
+	switch order.OrderType {
+	case LimitOrder:
+		if !book.Instrument.ValidPrice(order.LimitPrice) {
+			return ErrInvalidPricePrecision
+		}
+	case MarketOrder:
+		err := book.checkLiquidity(order)
+		if strategy, ok := engine.Strategies[order.Ticker]; ok && err != nil {
+			// It may still be implied against the legs.
+			_, _, err = engine.planStrategyOrder(strategy, order)
+		}
+		return err
+	}
+	return nil
+}
+
+// PlaceOrderGroup places every order, across any number of books, or none of
+// them. Each order is checked as PlaceOrder would before any is placed, against
+// the books as they stand, so orders in a group should not rely on each other's
+// fills. A rejected group wraps ErrOrderGroupRejected.
+func (engine *Engine) PlaceOrderGroup(orders []Order) error {
+	clOrdIDs := make(map[uint64]bool)
+	for i, order := range orders {
+		err := engine.CheckOrder(order.AssetType, order)
+		if err == nil && order.ClOrdID != 0 && clOrdIDs[order.ClOrdID] {
+			err = ErrDuplicateClOrdID
+		}
+		if err != nil {
+			return fmt.Errorf("%w: order %d: %w", ErrOrderGroupRejected, i+1, err)
+		}
+		clOrdIDs[order.ClOrdID] = true
+	}
+
+	var errs []error
+	for _, order := range orders {
+		if err := engine.PlaceOrder(order.AssetType, order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
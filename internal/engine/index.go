@@ -0,0 +1,30 @@
+package engine
+
+// SetIndexPrice sets the price of ticker taken from outside the exchange, e.g.
+// a composite of other venues, see prices.Ingester. While it has one, it is
+// what positions in ticker are marked at and what perpetuals tracking it are
+// funded against, rather than its last trade. A price of 0 clears it.
+func (engine *Engine) SetIndexPrice(ticker string, price float64) {
+	if price > 0 {
+		engine.indexPrices[ticker] = price
+	} else {
+		delete(engine.indexPrices, ticker)
+	}
+	engine.samplePremium(ticker)
+}
+
+// IndexPrice returns the price of ticker taken from outside the exchange, if
+// there is one.
+func (engine *Engine) IndexPrice(ticker string) (float64, bool) {
+	price, ok := engine.indexPrices[ticker]
+	return price, ok
+}
+
+// markPrice is what ticker is valued at, its index price if it has one,
+// otherwise its last trade.
+func (engine *Engine) markPrice(ticker string) (float64, bool) {
+	if price, ok := engine.indexPrices[ticker]; ok {
+		return price, true
+	}
+	return engine.lastPrice(ticker)
+}
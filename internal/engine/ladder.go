@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/btree"
+)
+
+// DefaultLadderTicks is how many ticks a price ladder spans, unless given.
+const DefaultLadderTicks = 1024
+
+var (
+	ErrInvalidLadder = errors.New("invalid price ladder")
+)
+
+// PriceLevels are one side of a book, best price first: bids greatest first,
+// asks least first.
+//
+// They are kept in a btree, or for instruments given a price ladder, see
+// SetPriceLadder, in an array of buckets a tick apart around the top of book,
+// with the btree only holding levels too far off to fit. Levels on the ladder
+// are found by indexing into it rather than walking down the tree, so matching
+// near the top of a busy book chases far fewer pointers. The ladder is moved
+// to wherever the top of book has got to each time it empties.
+type PriceLevels struct {
+	less   func(a, b *PriceLevel) bool
+	tree   *btree.BTreeG[*PriceLevel]
+	ladder *priceLadder // Nil without one
+}
+
+// priceLadder holds the levels within a window of ticks, a bucket each.
+type priceLadder struct {
+	ticksPer   float64 // Ticks to a whole unit of price, 10^PriceScale
+	descending bool    // Whether higher prices are better, as for bids
+	base       int64   // Tick of the first bucket
+	buckets    []*PriceLevel
+	count      int // Buckets holding a level
+	best       int // Bucket of the best level, while count is non-zero
+}
+
+func newPriceLevels(less func(a, b *PriceLevel) bool) *PriceLevels {
+	return &PriceLevels{less: less, tree: btree.NewBTreeG(less)}
+}
+
+// withLadder returns the levels on a ladder of ticks buckets for prices of
+// scale decimal places, or on the tree alone if ticks is zero.
+func (levels *PriceLevels) withLadder(ticks int, scale uint8) *PriceLevels {
+	moved := newPriceLevels(levels.less)
+	if ticks > 0 {
+		moved.ladder = &priceLadder{
+			ticksPer:   math.Pow10(int(scale)),
+			descending: levels.less(&PriceLevel{PriceLevel: 1}, &PriceLevel{PriceLevel: 0}),
+			buckets:    make([]*PriceLevel, ticks),
+		}
+	}
+	levels.Scan(func(level *PriceLevel) bool {
+		moved.Set(level)
+		return true
+	})
+	return moved
+}
+
+// Laddered returns whether the levels near the top are kept on a ladder.
+func (levels *PriceLevels) Laddered() bool {
+	return levels.ladder != nil
+}
+
+// Len returns how many levels there are.
+func (levels *PriceLevels) Len() int {
+	if levels.ladder == nil {
+		return levels.tree.Len()
+	}
+	return levels.ladder.count + levels.tree.Len()
+}
+
+// Min returns the best level.
+func (levels *PriceLevels) Min() (*PriceLevel, bool) {
+	best, ok := levels.tree.Min()
+	if ladder := levels.ladder; ladder != nil && ladder.count > 0 {
+		if top := ladder.buckets[ladder.best]; !ok || levels.less(top, best) {
+			return top, true
+		}
+	}
+	return best, ok
+}
+
+// Get returns the level at pivot's price.
+func (levels *PriceLevels) Get(pivot *PriceLevel) (*PriceLevel, bool) {
+	if i, ok := levels.ladder.bucket(pivot.PriceLevel); ok {
+		level := levels.ladder.buckets[i]
+		return level, level != nil
+	}
+	return levels.tree.Get(pivot)
+}
+
+// Set adds a level, there being none at its price already.
+func (levels *PriceLevels) Set(level *PriceLevel) {
+	ladder := levels.ladder
+	if ladder != nil && ladder.count == 0 {
+		top := level
+		if best, ok := levels.tree.Min(); ok && levels.less(best, level) {
+			top = best
+		}
+		levels.recentre(top.PriceLevel)
+	}
+	levels.place(level)
+}
+
+// place puts a level on the ladder if it fits, else in the tree.
+func (levels *PriceLevels) place(level *PriceLevel) {
+	ladder := levels.ladder
+	i, ok := ladder.bucket(level.PriceLevel)
+	if !ok {
+		levels.tree.Set(level)
+		return
+	}
+	ladder.buckets[i] = level
+	ladder.count++
+	if ladder.count == 1 || ladder.better(i, ladder.best) {
+		ladder.best = i
+	}
+}
+
+// Delete removes the level at pivot's price.
+func (levels *PriceLevels) Delete(pivot *PriceLevel) {
+	ladder := levels.ladder
+	i, ok := ladder.bucket(pivot.PriceLevel)
+	if !ok {
+		levels.tree.Delete(pivot)
+		return
+	}
+	if ladder.buckets[i] == nil {
+		return
+	}
+	ladder.buckets[i] = nil
+	ladder.count--
+	switch {
+	case ladder.count > 0 && i == ladder.best:
+		_, ladder.best = ladder.from(i + ladder.step())
+	case ladder.count == 0 && levels.tree.Len() > 0:
+		best, _ := levels.tree.Min()
+		levels.recentre(best.PriceLevel)
+	}
+}
+
+// Scan visits the levels best first until iter returns false.
+func (levels *PriceLevels) Scan(iter func(level *PriceLevel) bool) {
+	ladder := levels.ladder
+	if ladder == nil || ladder.count == 0 {
+		levels.tree.Scan(iter)
+		return
+	}
+
+	// The ladder's levels are merged in with those either side of it.
+	it := levels.tree.Iter()
+	defer it.Release()
+	more := it.First()
+	rung, i := ladder.from(ladder.best)
+	for rung != nil || more {
+		var level *PriceLevel
+		if rung == nil || more && levels.less(it.Item(), rung) {
+			level = it.Item()
+			more = it.Next()
+		} else {
+			level = rung
+			rung, i = ladder.from(i + ladder.step())
+		}
+		if !iter(level) {
+			return
+		}
+	}
+}
+
+// Items returns every level, best first.
+func (levels *PriceLevels) Items() []*PriceLevel {
+	items := make([]*PriceLevel, 0, levels.Len())
+	levels.Scan(func(level *PriceLevel) bool {
+		items = append(items, level)
+		return true
+	})
+	return items
+}
+
+// compact rebuilds the tree, which fragments as levels come and go, into a
+// freshly packed one. The ladder never does.
+func (levels *PriceLevels) compact() {
+	rebuilt := btree.NewBTreeG(levels.less)
+	levels.tree.Scan(func(level *PriceLevel) bool {
+		rebuilt.Load(level)
+		return true
+	})
+	levels.tree = rebuilt
+}
+
+// recentre moves the empty ladder to be centred on price, moving any levels in
+// the tree which are then on it over.
+func (levels *PriceLevels) recentre(price float64) {
+	ladder := levels.ladder
+	ladder.base = ladder.tick(price) - int64(len(ladder.buckets)/2)
+
+	// From the best price on the ladder, the tree's levels are in its order.
+	edge := ladder.base
+	if ladder.descending {
+		edge += int64(len(ladder.buckets)) - 1
+	}
+	var moving []*PriceLevel
+	levels.tree.Ascend(&PriceLevel{PriceLevel: float64(edge) / ladder.ticksPer}, func(level *PriceLevel) bool {
+		if _, ok := ladder.bucket(level.PriceLevel); ok {
+			moving = append(moving, level)
+		}
+		return levels.within(ladder, level.PriceLevel)
+	})
+	for _, level := range moving {
+		levels.tree.Delete(level)
+		levels.place(level)
+	}
+}
+
+// within returns whether price is no further off than the ladder's far end,
+// so levels past it in the tree may still be on the ladder.
+func (levels *PriceLevels) within(ladder *priceLadder, price float64) bool {
+	tick := ladder.tick(price)
+	if ladder.descending {
+		return tick >= ladder.base
+	}
+	return tick < ladder.base+int64(len(ladder.buckets))
+}
+
+func (ladder *priceLadder) tick(price float64) int64 {
+	return int64(math.Round(price * ladder.ticksPer))
+}
+
+// bucket returns the bucket of price, if the ladder has one for it. Prices off
+// the tick are left to the tree.
+func (ladder *priceLadder) bucket(price float64) (int, bool) {
+	if ladder == nil {
+		return 0, false
+	}
+	tick := ladder.tick(price)
+	i := tick - ladder.base
+	if i < 0 || i >= int64(len(ladder.buckets)) || float64(tick)/ladder.ticksPer != price {
+		return 0, false
+	}
+	return int(i), true
+}
+
+// step is the way through the buckets from better prices to worse.
+func (ladder *priceLadder) step() int {
+	if ladder.descending {
+		return -1
+	}
+	return 1
+}
+
+// better returns whether bucket i is at a better price than bucket j.
+func (ladder *priceLadder) better(i, j int) bool {
+	if ladder.descending {
+		return i > j
+	}
+	return i < j
+}
+
+// from returns the first level from bucket i on, towards worse prices, and its
+// bucket.
+func (ladder *priceLadder) from(i int) (*PriceLevel, int) {
+	for step := ladder.step(); i >= 0 && i < len(ladder.buckets); i += step {
+		if level := ladder.buckets[i]; level != nil {
+			return level, i
+		}
+	}
+	return nil, i
+}
+
+// ParsePriceLadder parses a "ticker:ticks" instrument whose book is kept on a
+// price ladder, e.g. "AAPL:2048" for the 2048 ticks around its top of book.
+// The ticks may be left out for DefaultLadderTicks.
+func ParsePriceLadder(spec string) (string, int, error) {
+	ticker, span, sized := strings.Cut(spec, ":")
+	if ticker == "" {
+		return "", 0, fmt.Errorf("%w: %q is not ticker:ticks", ErrInvalidLadder, spec)
+	}
+	if !sized {
+		return ticker, DefaultLadderTicks, nil
+	}
+	ticks, err := strconv.Atoi(span)
+	if err != nil || ticks <= 0 {
+		return "", 0, fmt.Errorf("%w: ticks %q", ErrInvalidLadder, span)
+	}
+	return ticker, ticks, nil
+}
+
+// SetPriceLadder keeps ticker's book on a price ladder of ticks buckets, for
+// instruments liquid enough that most of their trading is close to the top of
+// book, whether or not the book has been made yet. Zero ticks goes back to a
+// btree alone. How the book is kept makes no difference to how it trades.
+func (engine *Engine) SetPriceLadder(ticker string, ticks int) {
+	if ticks <= 0 {
+		delete(engine.ladders, ticker)
+	} else {
+		engine.ladders[ticker] = ticks
+	}
+	if book, ok := engine.Books[ticker]; ok {
+		book.Bids = book.Bids.withLadder(ticks, book.Instrument.PriceScale)
+		book.Asks = book.Asks.withLadder(ticks, book.Instrument.PriceScale)
+	}
+}
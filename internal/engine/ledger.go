@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"maps"
+
+	. "fenrir/internal/common"
+)
+
+// applyTrade books the trade into the engine's running ledger.
+func (engine *Engine) applyTrade(trade Trade) {
+	buyer, seller := trade.Party, trade.CounterParty
+	if buyer.Side == Sell {
+		buyer, seller = seller, buyer
+	}
+
+	engine.ledgerLock.Lock()
+	defer engine.ledgerLock.Unlock()
+	engine.ledger.ApplyTrade(trade.Party.Ticker, buyer.Owner, seller.Owner, trade.MatchQty)
+	engine.ledger.AuditSequence = engine.auditSequence
+}
+
+// Ledger returns a copy of every position, trade count and funding since the
+// engine started. Unlike the rest of the engine, it is safe to call from any
+// goroutine, so back-office checks need not stop matching.
+func (engine *Engine) Ledger() Ledger {
+	engine.ledgerLock.Lock()
+	defer engine.ledgerLock.Unlock()
+
+	return Ledger{
+		Positions:     maps.Clone(engine.ledger.Positions),
+		TradeCounts:   maps.Clone(engine.ledger.TradeCounts),
+		Funding:       maps.Clone(engine.ledger.Funding),
+		AuditSequence: engine.ledger.AuditSequence,
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"errors"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrInvalidManualTrade = Reject(RejectInvalidOrder, errors.New("manual trade needs a buyer and a different seller, for the same symbol, price and quantity"))
+)
+
+// BookManualTrade books a trade between the buyer's and seller's orders, at
+// their limit price for their total quantity, as an admin would to correct an
+// error or register a trade agreed off the exchange. The orders stand for
+// either side of the trade and never rest, so the books are left as they were.
+//
+// The trade goes through everything a matched one does, the ledger, audit
+// trail, trade recorder and execution reports, flagged as a ManualTrade. As it
+// was not made at the market it is left out of market data and candles. The
+// buyer stands as the taker, so the trade is counted once. Returns both orders,
+// filled.
+func (engine *Engine) BookManualTrade(assetType AssetType, buy, sell Order) ([]Order, error) {
+	if buy.Side != Buy || sell.Side != Sell ||
+		buy.Owner == "" || sell.Owner == "" || buy.Owner == sell.Owner ||
+		buy.Ticker != sell.Ticker ||
+		buy.LimitPrice <= 0 || buy.LimitPrice != sell.LimitPrice ||
+		buy.TotalQuantity == 0 || buy.TotalQuantity != sell.TotalQuantity {
+		return nil, ErrInvalidManualTrade
+	}
+	// Only symbols already listed are traded.
+	book, ok := engine.Books[buy.Ticker]
+	if !ok {
+		return nil, ErrBookNotFound
+	}
+	if book.Instrument.AssetType != assetType {
+		return nil, ErrInstrumentMismatch
+	}
+	if !book.Instrument.ValidPrice(buy.LimitPrice) {
+		return nil, ErrInvalidPricePrecision
+	}
+
+	orders := []*Order{&buy, &sell}
+	for _, order := range orders {
+		order.AssetType = assetType
+		order.OrderType = LimitOrder
+		order.ExchTimestamp = engine.Now()
+		order.Sequence = engine.nextSequence()
+		order.QuantityScale = book.Instrument.QuantityScale
+		order.PriceScale = book.Instrument.PriceScale
+		engine.auditNewOrder(order)
+		order.Quantity = 0
+	}
+
+	err := engine.bookTrade(ManualTrade, &buy, &sell, buy.LimitPrice, buy.TotalQuantity)
+	return []Order{buy, sell}, err
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"math"
+
+	. "fenrir/internal/common"
+)
+
+// SetMarginMode sets how owner's positions are margined, see MarginMode.
+func (engine *Engine) SetMarginMode(owner string, mode MarginMode) {
+	if mode != StandardMargin {
+		engine.marginModes[owner] = mode
+	} else {
+		delete(engine.marginModes, owner)
+	}
+}
+
+// MarginMode returns how owner's positions are margined.
+func (engine *Engine) MarginMode(owner string) MarginMode {
+	return engine.marginModes[owner]
+}
+
+// SetScanRange sets how far, as a fraction of its price, underlying is moved
+// either way in portfolio margin scenarios. A range of 0 puts it back to
+// DefaultScanRange.
+func (engine *Engine) SetScanRange(underlying string, fraction float64) {
+	if fraction > 0 {
+		engine.scanRanges[underlying] = fraction
+	} else {
+		delete(engine.scanRanges, underlying)
+	}
+}
+
+func (engine *Engine) scanRange(underlying string) float64 {
+	if fraction, ok := engine.scanRanges[underlying]; ok {
+		return fraction
+	}
+	return DefaultScanRange
+}
+
+// positionExposure is a position valued on its own at its mark price, long or
+// short, as under StandardMargin. Positions in tickers never priced are not
+// exposed.
+func (engine *Engine) positionExposure(ticker string, position int64) float64 {
+	price, ok := engine.markPrice(ticker)
+	if !ok {
+		return 0
+	}
+	return math.Abs(float64(position)) * engine.lot(ticker) * price
+}
+
+// riskGroup is the ticker whose price a position in ticker moves with.
+func (engine *Engine) riskGroup(ticker string) string {
+	if option, ok := engine.options[ticker]; ok {
+		return option.Underlying
+	}
+	if perp, ok := engine.perpetuals[ticker]; ok {
+		return perp.Index
+	}
+	return ticker
+}
+
+// scenarioValue is what one unit of ticker is worth with its risk group priced
+// at spot. Options are valued with the pricing model, or at their intrinsic
+// value without one, and anything else moves one for one with spot.
+func (engine *Engine) scenarioValue(ticker string, spot float64) float64 {
+	option, ok := engine.options[ticker]
+	if !ok {
+		return spot
+	}
+	if engine.pricing == nil {
+		return option.Intrinsic(spot)
+	}
+	return engine.pricing.Price(option, spot, engine.Now()).Theo
+}
+
+// portfolioMargin is the most owner's positions would lose over the
+// MarginScenarios of each risk group, summed across groups. Groups whose
+// underlying has never been priced can not be moved, so their positions are
+// exposed on their own instead. The caller must hold ledgerLock.
+func (engine *Engine) portfolioMargin(owner string) float64 {
+	groups := make(map[string]map[string]int64)
+	for key, position := range engine.ledger.Positions {
+		if key.Owner != owner || position == 0 {
+			continue
+		}
+		group := engine.riskGroup(key.Ticker)
+		if groups[group] == nil {
+			groups[group] = make(map[string]int64)
+		}
+		groups[group][key.Ticker] = position
+	}
+
+	margin := 0.0
+	for underlying, positions := range groups {
+		spot, ok := engine.markPrice(underlying)
+		if !ok {
+			for ticker, position := range positions {
+				margin += engine.positionExposure(ticker, position)
+			}
+			continue
+		}
+
+		scan := engine.scanRange(underlying)
+		worst := 0.0
+		for _, move := range MarginScenarios {
+			shocked := spot * (1 + move*scan)
+			pnl := 0.0
+			for ticker, position := range positions {
+				pnl += float64(position) * engine.lot(ticker) * (engine.scenarioValue(ticker, shocked) - engine.scenarioValue(ticker, spot))
+			}
+			worst = min(worst, pnl)
+		}
+		margin -= worst
+	}
+	return margin
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"cmp"
+	"slices"
+
+	. "fenrir/internal/common"
+)
+
+// A MarketDataPublisher distributes public, incremental book updates, top of
+// book and top levels changes and option analytics. Publish is called
+// synchronously from the matching path, so must not block.
+type MarketDataPublisher interface {
+	PublishMarketData(update MarketDataUpdate)
+	PublishBBO(bbo BBO)
+	PublishDepth(depth BookDepth)
+	PublishGreeks(greeks Greeks)
+}
+
+func (engine *Engine) SetMarketDataPublisher(publisher MarketDataPublisher) {
+	engine.publisher = publisher
+}
+
+// levelKey identifies a price level on one side of a book.
+type levelKey struct {
+	side  Side
+	price float64
+}
+
+func (book *OrderBook) sideOf(levels *PriceLevels) Side {
+	if levels == book.Bids {
+		return Buy
+	}
+	return Sell
+}
+
+func (book *OrderBook) levelsOf(side Side) *PriceLevels {
+	if side == Buy {
+		return book.Bids
+	}
+	return book.Asks
+}
+
+// touch notes a price level is about to change, remembering whether it existed
+// beforehand. This must be called before the level is modified.
+func (book *OrderBook) touch(levels *PriceLevels, price float64) {
+	key := levelKey{side: book.sideOf(levels), price: price}
+	if _, ok := book.touched[key]; ok {
+		return
+	}
+	_, existed := levels.Get(&PriceLevel{PriceLevel: price})
+	book.touched[key] = existed
+}
+
+// publishTrade sends a trade print. The taker is the aggressor.
+func (book *OrderBook) publishTrade(trade Trade) {
+	book.publish(MarketDataUpdate{
+		Type:      TradeUpdate,
+		TradeID:   trade.ID,
+		Timestamp: trade.Timestamp,
+		Side:      trade.Party.Side,
+		Price:     trade.Price,
+		Quantity:  trade.MatchQty,
+	})
+}
+
+// flushUpdates publishes the net change to every level touched since the last
+// flush, in side then price order. Levels that came and went in between are
+// not published at all.
+func (book *OrderBook) flushUpdates() {
+	keys := make([]levelKey, 0, len(book.touched))
+	for key := range book.touched {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b levelKey) int {
+		if a.side != b.side {
+			return cmp.Compare(a.side, b.side)
+		}
+		return cmp.Compare(a.price, b.price)
+	})
+
+	now := book.engine.Now()
+	for _, key := range keys {
+		existed := book.touched[key]
+		level, exists := book.levelsOf(key.side).Get(&PriceLevel{PriceLevel: key.price})
+
+		update := MarketDataUpdate{Timestamp: now, Side: key.side, Price: key.price}
+		switch {
+		case exists && !existed:
+			update.Type = LevelAdd
+		case exists && existed:
+			update.Type = LevelModify
+		case !exists && existed:
+			update.Type = LevelDelete
+		default:
+			continue
+		}
+		if exists {
+			update.Quantity = level.Quantity()
+			update.Orders = uint32(level.Orders.Len())
+		}
+		book.publish(update)
+	}
+	clear(book.touched)
+
+	book.publishBBO()
+	book.publishDepth()
+	book.publishIndicative()
+}
+
+// bbo returns the book's current top of book.
+func (book *OrderBook) bbo() BBO {
+	bbo := BBO{
+		Ticker:        book.Instrument.Ticker,
+		Sequence:      book.mdSequence,
+		QuantityScale: book.Instrument.QuantityScale,
+		PriceScale:    book.Instrument.PriceScale,
+	}
+	bbo.BidPrice, bbo.BidQuantity, _ = book.BestBid()
+	bbo.AskPrice, bbo.AskQuantity, _ = book.BestAsk()
+	return bbo
+}
+
+// publishBBO sends the top of book if it has changed since it was last sent.
+// It does not take a sequence of its own, it carries the sequence of the level
+// update which moved it.
+func (book *OrderBook) publishBBO() {
+	bbo := book.bbo()
+	last := book.lastBBO
+	if bbo.BidPrice == last.BidPrice && bbo.BidQuantity == last.BidQuantity &&
+		bbo.AskPrice == last.AskPrice && bbo.AskQuantity == last.AskQuantity {
+		return
+	}
+	book.lastBBO = bbo
+	if book.engine.publisher != nil {
+		book.engine.publisher.PublishBBO(bbo)
+	}
+}
+
+// publishDepth sends the top TopDepthLevels levels of each side if they have
+// changed since they were last sent, carrying the sequence of the level update
+// which changed them, as publishBBO does.
+func (book *OrderBook) publishDepth() {
+	if book.engine.publisher == nil {
+		return
+	}
+	bids, asks := book.Depth(TopDepthLevels)
+	last := book.lastDepth
+	if slices.Equal(bids, last.Bids) && slices.Equal(asks, last.Asks) {
+		return
+	}
+	book.lastDepth = BookDepth{
+		Ticker:        book.Instrument.Ticker,
+		QuantityScale: book.Instrument.QuantityScale,
+		PriceScale:    book.Instrument.PriceScale,
+		Sequence:      book.mdSequence,
+		Bids:          bids,
+		Asks:          asks,
+	}
+	book.engine.publisher.PublishDepth(book.lastDepth)
+}
+
+// publish stamps an update with the book's next sequence number and passes it
+// to the engine's publisher, if there is one. The sequence advances regardless
+// so snapshots taken at any point line up with the feed.
+func (book *OrderBook) publish(update MarketDataUpdate) {
+	book.mdSequence++
+	if book.engine.publisher == nil {
+		return
+	}
+
+	update.Ticker = book.Instrument.Ticker
+	update.Sequence = book.mdSequence
+	update.QuantityScale = book.Instrument.QuantityScale
+	update.PriceScale = book.Instrument.PriceScale
+	book.engine.publisher.PublishMarketData(update)
+}
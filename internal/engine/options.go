@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrNotAnOption       = errors.New("not a listed option")
+	ErrNoPricingModel    = errors.New("no pricing model set")
+	ErrNoUnderlyingPrice = errors.New("underlying has not traded")
+	ErrInvalidUnderlying = errors.New("options may only be listed on instruments with a book")
+)
+
+// RegisterOption lists an option, trading on a book of its own like any other
+// instrument. If the option's instrument has not been registered already, it
+// is created with the default scales. Its underlying must trade on a book, the
+// last price there being what the option is valued from.
+func (engine *Engine) RegisterOption(option Option) error {
+	if !engine.assets[option.AssetType] {
+		return ErrUnsupportedAsset
+	}
+	if !option.Kind.Valid() || !(option.Strike > 0) || option.Underlying == option.Ticker {
+		return ErrInvalidOption
+	}
+	if _, ok := engine.options[option.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Strategies[option.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.perpetuals[option.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+	if _, ok := engine.Baskets[option.Underlying]; ok {
+		return ErrInvalidUnderlying
+	}
+	if _, ok := engine.Strategies[option.Underlying]; ok {
+		return ErrInvalidUnderlying
+	}
+	if _, ok := engine.options[option.Underlying]; ok {
+		return ErrInvalidUnderlying
+	}
+	if _, err := engine.Book(option.AssetType, option.Ticker); err != nil {
+		return err
+	}
+	engine.options[option.Ticker] = option
+	return nil
+}
+
+// Option returns the option listed under ticker.
+func (engine *Engine) Option(ticker string) (Option, bool) {
+	option, ok := engine.options[ticker]
+	return option, ok
+}
+
+// SetPricingModel sets what options are valued with. Without one no analytics
+// are published.
+func (engine *Engine) SetPricingModel(model PricingModel) {
+	engine.pricing = model
+}
+
+// Greeks values the option listed under ticker from its underlying's last
+// trade, as of now on the engine's clock.
+func (engine *Engine) Greeks(ticker string) (Greeks, error) {
+	option, ok := engine.options[ticker]
+	if !ok {
+		return Greeks{}, ErrNotAnOption
+	}
+	if engine.pricing == nil {
+		return Greeks{}, ErrNoPricingModel
+	}
+	spot, ok := engine.lastPrice(option.Underlying)
+	if !ok {
+		return Greeks{}, ErrNoUnderlyingPrice
+	}
+	return engine.price(option, spot), nil
+}
+
+// price values option with the pricing model, at the option's price scale.
+func (engine *Engine) price(option Option, spot float64) Greeks {
+	greeks := engine.pricing.Price(option, spot, engine.Now())
+	greeks.PriceScale = engine.Instruments[option.Ticker].PriceScale
+	return greeks
+}
+
+// publishGreeks revalues every option on underlying after it trades, in ticker
+// order, passing each to the engine's publisher.
+func (engine *Engine) publishGreeks(underlying string) {
+	if engine.publisher == nil || engine.pricing == nil {
+		return
+	}
+	spot, ok := engine.lastPrice(underlying)
+	if !ok {
+		return
+	}
+
+	var tickers []string
+	for ticker, option := range engine.options {
+		if option.Underlying == underlying {
+			tickers = append(tickers, ticker)
+		}
+	}
+	slices.Sort(tickers)
+	for _, ticker := range tickers {
+		engine.publisher.PublishGreeks(engine.price(engine.options[ticker], spot))
+	}
+}
@@ -4,19 +4,28 @@ import (
 	"errors"
 	"time"
 
-	"github.com/tidwall/btree"
-
 	. "fenrir/internal/common"
 )
 
 var (
-	ErrNotEnoughLiquidity = errors.New("not enough liquidity")
+	ErrNotEnoughLiquidity = Reject(RejectInsufficientLiquidity, errors.New("not enough liquidity"))
 	ErrRejection          = errors.New("order rejection")
+	// Limit prices must be a whole number of the instrument's ticks.
+	ErrInvalidPricePrecision = Reject(RejectInvalidTick, errors.New("price has more decimal places than the instrument allows"))
+	// Cancels are refused with a reason the gateway can pass on, see
+	// CancelRejectReason.
+	ErrOrderNotFound error = CancelRejectUnknownOrder
+	ErrOrderFilled   error = CancelRejectFilled
+	ErrNotOrderOwner error = CancelRejectNotOwner
 )
 
-// OrderAsc sorts orders by time priority (FIFO).
-// If timestamps are equal, it falls back to UUID for stability.
+// OrderAsc sorts orders by time priority (FIFO), using the engine assigned
+// sequence. If sequences are equal, it falls back to timestamps and then UUID
+// for stability.
 func OrderAsc(a, b *Order) bool {
+	if a.Sequence != b.Sequence {
+		return a.Sequence < b.Sequence
+	}
 	if a.ExchTimestamp.Before(b.ExchTimestamp) {
 		return true
 	}
@@ -28,39 +37,101 @@ func OrderAsc(a, b *Order) bool {
 
 type PriceLevel struct {
 	PriceLevel float64
-	Orders     *btree.BTreeG[*Order]
+	Orders     OrderQueue
+
+	// Remaining quantity of every order on the level, kept up to date as they
+	// are added, filled and removed so market data never has to walk them.
+	// Orders on the level must only be changed through add, fill and remove.
+	quantity uint64
+
+	// The book the level is on, whose owners' reservations are kept up to
+	// date alongside, see credit.go.
+	book *OrderBook
+
+	// Last an order was added, filled or removed, see compact.go.
+	touchedAt time.Time
+}
+
+// add rests an order on the level, returning the order as it rests.
+func (level *PriceLevel) add(order Order) *Order {
+	entry := newQueuedOrder(order, level)
+	level.Orders.push(entry)
+	level.book.index(entry)
+	level.quantity += order.Quantity
+	level.book.reserve(order.Owner, level.PriceLevel, order.Quantity)
+	level.book.touchLevel(level)
+	return &entry.order
+}
+
+// fill takes quantity off an order resting on the level.
+func (level *PriceLevel) fill(order *Order, quantity uint64) {
+	order.Quantity -= quantity
+	level.quantity -= quantity
+	level.book.release(order.Owner, level.PriceLevel, quantity, false)
+	level.book.touchLevel(level)
+}
+
+// remove takes an order, with whatever it has left, off the level.
+func (level *PriceLevel) remove(order *Order) {
+	entry := level.book.unindex(order)
+	level.Orders.unlink(entry)
+	level.quantity -= order.Quantity
+	level.book.release(order.Owner, level.PriceLevel, order.Quantity, true)
+	level.book.touchLevel(level)
+	level.book.engine.retireOrder(entry)
 }
 
-type PriceLevels = btree.BTreeG[*PriceLevel]
 type OrderBook struct {
 	// Pointer to the owning engine.
 	engine *Engine
 
+	// The instrument traded on this book. All quantities in the book are in
+	// lots of the instrument's quantity scale.
+	Instrument Instrument
+
 	// Price levels to orders sat on the price level, sorted by time added
 	// as they will be push-back'd.
 	Bids *PriceLevels
 	Asks *PriceLevels
 
-	// Some book keeping
-	nBuyOrders   uint64 // Track the number of bids in the book.
-	nSellOrders  uint64 // Track the number of asks in the book.
-	buyQuantity  uint64 // Track the bid-side liquidity of the book.
-	sellQuantity uint64 // Track the ask-side liquidity of the book.
+	// Market data state, see marketdata.go.
+	touched    map[levelKey]bool // Levels changed by the current command
+	mdSequence uint64            // Last published update sequence
+	lastBBO    BBO               // Last published top of book
+	lastDepth  BookDepth         // Last published top levels, see publishDepth
+
+	lastIndicative Uncross // Last published, see auction.go
+
+	policy MatchPolicy // Overrides the engine's, see policy.go
+
+	reserved map[string]*reservation // What each owner has resting, see credit.go
+
+	orders map[string]*queuedOrder // Resting orders by UUID, see orderqueue.go
+
+	// Last any of its levels was touched, and whether it was made for an
+	// unlisted ticker on the fly, see compact.go.
+	touchedAt time.Time
+	transient bool
 }
 
-func NewOrderBook(engine *Engine) OrderBook {
-	// Sorted greatest first.
-	bids := btree.NewBTreeG(func(a, b *PriceLevel) bool {
-		return a.PriceLevel > b.PriceLevel
-	})
-	// Sorted least first.
-	asks := btree.NewBTreeG(func(a, b *PriceLevel) bool {
-		return a.PriceLevel < b.PriceLevel
-	})
-	return OrderBook{
-		engine: engine,
-		Bids:   bids,
-		Asks:   asks,
+// Bids are sorted greatest first, asks least first, so the best is always Min.
+func bidsFirst(a, b *PriceLevel) bool { return a.PriceLevel > b.PriceLevel }
+func asksFirst(a, b *PriceLevel) bool { return a.PriceLevel < b.PriceLevel }
+
+func NewOrderBook(engine *Engine, inst Instrument) *OrderBook {
+	bids, asks := newPriceLevels(bidsFirst), newPriceLevels(asksFirst)
+	if ticks, ok := engine.ladders[inst.Ticker]; ok {
+		bids, asks = bids.withLadder(ticks, inst.PriceScale), asks.withLadder(ticks, inst.PriceScale)
+	}
+	return &OrderBook{
+		engine:     engine,
+		Instrument: inst,
+		Bids:       bids,
+		Asks:       asks,
+		touched:    make(map[levelKey]bool),
+		reserved:   make(map[string]*reservation),
+		orders:     make(map[string]*queuedOrder),
+		touchedAt:  engine.Now(),
 	}
 }
 
@@ -73,7 +144,23 @@ func NewOrderBook(engine *Engine) OrderBook {
 // time at which the order was placed. We do not care about the accuracy of the
 // timestamp, just its relativity to other timestamps.
 func (book *OrderBook) PlaceOrder(order Order) error {
-	order.ExchTimestamp = time.Now()
+	if order.OrderType == LimitOrder && !book.Instrument.ValidPrice(order.LimitPrice) {
+		return ErrInvalidPricePrecision
+	}
+	if order.OrderType == MarketOrder && book.inAuction() {
+		return ErrAuctionMarketOrder
+	}
+	order.AssetType = book.Instrument.AssetType
+	order.ExchTimestamp = book.engine.Now()
+	order.Sequence = book.engine.nextSequence()
+	order.PriorityClass = book.engine.priorityClasses[order.Owner]
+	book.engine.auditNewOrder(&order)
+	// Quantities are interpreted in the book's lots, whatever the sender assumed.
+	order.QuantityScale = book.Instrument.QuantityScale
+	order.PriceScale = book.Instrument.PriceScale
+
+	// Publish whatever the order did to the book once it has settled.
+	defer book.flushUpdates()
 
 	// These handle internal book-keeping tasks such as book liquidity tracking.
 	switch order.OrderType {
@@ -85,11 +172,81 @@ func (book *OrderBook) PlaceOrder(order Order) error {
 	return nil
 }
 
+// CancelOrder removes a resting order from the book.
 func (book *OrderBook) CancelOrder(uuid string) error {
-	// FIXME: implement this
+	order, ok := book.removeOrder(uuid)
+	if !ok {
+		return ErrOrderNotFound
+	}
+	book.engine.auditCancel(order, CancelRequested)
+	book.flushUpdates()
 	return nil
 }
 
+// removeOrder finds a resting order by uuid and takes it off the book, cleaning
+// up its price level if it was the last order on it. The caller is responsible
+// for flushing market data updates.
+func (book *OrderBook) removeOrder(uuid string) (*Order, bool) {
+	entry, ok := book.orders[uuid]
+	if !ok {
+		return nil, false
+	}
+	order, level := &entry.order, entry.level
+	levels := book.levelsOf(order.Side)
+
+	book.touch(levels, level.PriceLevel)
+	level.remove(order)
+	if level.Orders.Len() == 0 {
+		book.deleteLevel(levels, level)
+	}
+	return order, true
+}
+
+// BestBid returns the highest bid price and the total quantity resting there.
+func (book *OrderBook) BestBid() (float64, uint64, bool) {
+	return topOfBook(book.Bids)
+}
+
+// BestAsk returns the lowest ask price and the total quantity resting there.
+func (book *OrderBook) BestAsk() (float64, uint64, bool) {
+	return topOfBook(book.Asks)
+}
+
+func topOfBook(levels *PriceLevels) (float64, uint64, bool) {
+	// Min accounts for bids and asks being in inverse order.
+	level, ok := levels.Min()
+	if !ok {
+		return 0, 0, false
+	}
+	return level.PriceLevel, level.Quantity(), true
+}
+
+// Quantity is the remaining quantity of every order on the level.
+func (level *PriceLevel) Quantity() uint64 {
+	return level.quantity
+}
+
+// Depth aggregates up to n price levels per side, best prices first.
+func (book *OrderBook) Depth(n int) ([]DepthLevel, []DepthLevel) {
+	return depthOf(book.Bids, n), depthOf(book.Asks, n)
+}
+
+func depthOf(levels *PriceLevels, n int) []DepthLevel {
+	out := make([]DepthLevel, 0, min(n, levels.Len()))
+	levels.Scan(func(level *PriceLevel) bool {
+		if len(out) >= n {
+			return false
+		}
+		out = append(out, DepthLevel{
+			Price:    level.PriceLevel,
+			Quantity: level.Quantity(),
+			Orders:   uint32(level.Orders.Len()),
+		})
+		return true
+	})
+	return out
+}
+
 type FlatPriceLevel struct {
 	PriceLevel float64
 	Orders     []*Order
@@ -107,6 +264,7 @@ func FlattenLevels(levels []*PriceLevel) []FlatPriceLevel {
 			// Zero out timestamps for strict equality checking in tests
 			order := *item
 			order.ExchTimestamp = time.Time{}
+			order.Sequence = 0
 			orders = append(orders, &order)
 			return true
 		})
@@ -119,7 +277,8 @@ func FlattenLevels(levels []*PriceLevel) []FlatPriceLevel {
 }
 
 // Match consumes the top of book price levels while they cross (i.e., bid >= ask).
-// While these orders cross, we match orders in price-time-priority.
+// While these orders cross, we match orders in price-time-priority, subject to
+// any class allocations at the maker's level (see allocate).
 //
 // The order that triggered the matching, if there is a cross, is considered to be
 // a liquidity taker. Otherwise, resting orders are considered liquidity makers. If
@@ -129,59 +288,70 @@ func FlattenLevels(levels []*PriceLevel) []FlatPriceLevel {
 // NOTE: There will only be a matching, if the new order's limit price is top of book.
 // Otherwise, we would have a stable state.
 func (book *OrderBook) Match() error {
+	return book.match(0)
+}
+
+// match matches crossing orders as Match does, or, uncrossing an auction at a
+// non-zero uncrossAt, those bidding at least it against those asking at most
+// it, all at that price.
+func (book *OrderBook) match(uncrossAt float64) error {
 	// Consume crossing orders. This will essentially be our latest order sweeping
 	// across priceLevels as far as its depth and liquidity go.
 	var errs []error
 	for {
-		bestBid, bidOk := book.Bids.MinMut()
-		bestAsk, askOk := book.Asks.MinMut()
+		bestBid, bidOk := book.Bids.Min()
+		bestAsk, askOk := book.Asks.Min()
 
 		// If either side is empty, or prices don't cross, we are done.
 		if !bidOk || !askOk || bestBid.PriceLevel < bestAsk.PriceLevel {
 			break
 		}
+		if uncrossAt > 0 && (bestBid.PriceLevel < uncrossAt || bestAsk.PriceLevel > uncrossAt) {
+			break
+		}
+		price := uncrossAt
+		book.touch(book.Bids, bestBid.PriceLevel)
+		book.touch(book.Asks, bestAsk.PriceLevel)
+
+		askOrder, _ := bestAsk.Orders.Front()
+		bidOrder, _ := bestBid.Orders.Front()
+
+		// Taker and maker is decided by whose order was received first. The
+		// earlier order must be resting. It is expected that, if there is
+		// functionality ot change order details at a later date, then we still
+		// consider the new order taker.
+		taker, takerLevel, makerLevel := bidOrder, bestBid, bestAsk
+		if askOrder.Sequence > bidOrder.Sequence {
+			taker, takerLevel, makerLevel = askOrder, bestAsk, bestBid
+		}
 
-		// While there are still orders on either side, move forward on the orders.
-		var aIdx, bIdx int
-		for aIdx < bestAsk.Orders.Len() && bIdx < bestBid.Orders.Len() {
-			askOrder, _ := bestAsk.Orders.MinMut()
-			bidOrder, _ := bestBid.Orders.MinMut()
-
-			matchQty := min(askOrder.Quantity, bidOrder.Quantity)
-			askOrder.Quantity -= matchQty
-			bidOrder.Quantity -= matchQty
-
-			// Call the trade engine. Taker and maker is decided by whose order was
-			// received first. The earlier order must be resting. It is expected
-			// that, if there is functionality ot change order details at a later
-			// date, then we still consider the new order taker.
-			//
-			// The price is matched at maker's price level.
-			if askOrder.ExchTimestamp.After(bidOrder.ExchTimestamp) {
-				if err := book.engine.DoTrade(askOrder, bidOrder, bestBid.PriceLevel, matchQty); err != nil {
-					errs = append(errs, err)
-				}
-			} else {
-				if err := book.engine.DoTrade(bidOrder, askOrder, bestAsk.PriceLevel, matchQty); err != nil {
-					errs = append(errs, err)
-				}
+		// The taker works through the maker's level. The price is matched at
+		// maker's price level, outside of an auction.
+		if price == 0 {
+			price = makerLevel.PriceLevel
+		}
+		for _, fill := range book.allocate(makerLevel, taker.Quantity) {
+			takerLevel.fill(taker, fill.Quantity)
+			makerLevel.fill(fill.Maker, fill.Quantity)
+			if err := book.engine.DoTrade(taker, fill.Maker, price, fill.Quantity); err != nil {
+				errs = append(errs, err)
 			}
 
 			// Remove order from book if it is completelly filled.
-			if askOrder.Quantity == 0 {
-				bestAsk.Orders.Delete(askOrder)
-			}
-			if bidOrder.Quantity == 0 {
-				bestBid.Orders.Delete(bidOrder)
+			if fill.Maker.Quantity == 0 {
+				makerLevel.remove(fill.Maker)
 			}
 		}
+		if taker.Quantity == 0 {
+			takerLevel.remove(taker)
+		}
 
 		// Full consumption cases (i.e. empty levels).
 		if bestAsk.Orders.Len() == 0 {
-			book.Asks.Delete(bestAsk)
+			book.deleteLevel(book.Asks, bestAsk)
 		}
 		if bestBid.Orders.Len() == 0 {
-			book.Bids.Delete(bestBid)
+			book.deleteLevel(book.Bids, bestBid)
 		}
 	}
 
@@ -196,11 +366,8 @@ func (book *OrderBook) Match() error {
 func (book *OrderBook) handleMarket(order Order) error {
 	// FIXME: figure out how to assign fees.
 	// Sanity check.
-	if (order.Side == Buy && book.sellQuantity < order.TotalQuantity) ||
-		(order.Side == Sell && book.buyQuantity < order.TotalQuantity) {
-		// We do not have enough liquidty to cover the order in the book,
-		// we should just give up.
-		return ErrNotEnoughLiquidity
+	if err := book.checkLiquidity(order); err != nil {
+		return err
 	}
 
 	var levels *PriceLevels
@@ -211,56 +378,57 @@ func (book *OrderBook) handleMarket(order Order) error {
 		levels = book.Bids
 	}
 
-	// While liquidity left sweep the order book. Keep track of the number of orders
-	// we lifted off the book during the sweep for book keeping.
-	liftedOrders := uint64(0)
+	// While liquidity left sweep the order book.
 	for order.Quantity > 0 {
 		// Min here accounts for bids and asks being in inverse order, based on their
 		// comparison method.
-		level, ok := levels.MinMut()
+		level, ok := levels.Min()
 		if !ok {
 			// This should not happen, as we have a sanity check.
 			// If this happens, something bad has happened.
 			return ErrNotEnoughLiquidity
 		}
+		book.touch(levels, level.PriceLevel)
 
-		level.Orders.DeleteAscend(nil, func(restingOrder *Order) btree.Action {
-			// Give up if the original order is filled fully.
-			if order.Quantity <= 0 {
-				return btree.Stop
-			}
-
-			matchQty := min(order.Quantity, restingOrder.Quantity)
-			order.Quantity -= matchQty
-			restingOrder.Quantity -= matchQty
-
-			// Consume order as much as possible and book trade, passing
-			// the taker and maker.
-			book.engine.DoTrade(&order, restingOrder, level.PriceLevel, matchQty)
+		// Consume orders as much as possible and book trades, passing the taker
+		// and maker.
+		for _, fill := range book.allocate(level, order.Quantity) {
+			order.Quantity -= fill.Quantity
+			level.fill(fill.Maker, fill.Quantity)
+			book.engine.DoTrade(&order, fill.Maker, level.PriceLevel, fill.Quantity)
 
-			if restingOrder.Quantity == 0 {
-				liftedOrders++
-				return btree.Delete
+			if fill.Maker.Quantity == 0 {
+				level.remove(fill.Maker)
 			}
-			return btree.Keep
-		})
+		}
 
 		// If orders are empty, delete the price level.
 		if level.Orders.Len() == 0 {
-			levels.Delete(level)
+			book.deleteLevel(levels, level)
 		}
 	}
 
-	// Bookkeeping
-	switch order.Side {
-	case Buy:
-		book.sellQuantity -= order.TotalQuantity
-		book.nSellOrders -= liftedOrders
-	case Sell:
-		book.buyQuantity -= order.TotalQuantity
-		book.nBuyOrders -= liftedOrders
-	}
+	return nil
+}
 
+// checkLiquidity returns whether there is enough liquidity in the book to fill a
+// market order in full. Liquidity is summed from the levels the order would
+// sweep, best first, in the book's lots, as the order's quantity is.
+func (book *OrderBook) checkLiquidity(order Order) error {
+	levels := book.Bids
+	if order.Side == Buy {
+		levels = book.Asks
+	}
+	available := uint64(0)
+	levels.Scan(func(level *PriceLevel) bool {
+		available += level.Quantity()
+		return available < order.Quantity
+	})
+	if available < order.Quantity {
+		// We do not have enough liquidty to cover the order in the book,
+		// we should just give up.
+		return ErrNotEnoughLiquidity
+	}
 	return nil
 }
 
@@ -283,18 +451,26 @@ func (book *OrderBook) handleLimit(order Order) error {
 	//       we need to keep track of a per-asset-type tick size. This is too much
 	//       effort for me right now.
 
+	book.rest(levels, order)
+
+	// Trigger the matching, held off until the auction uncrosses.
+	if book.inAuction() {
+		return nil
+	}
+	return book.Match()
+}
+
+// rest places an order onto its price level without matching, returning the
+// order as it rests.
+func (book *OrderBook) rest(levels *PriceLevels, order Order) *Order {
+	book.touch(levels, order.LimitPrice)
+
 	// Levels comparator only accounts for price levels, so we create a dummy price
 	// level for the search.
-	level, ok := levels.GetMut(&PriceLevel{PriceLevel: order.LimitPrice})
+	level, ok := levels.Get(&PriceLevel{PriceLevel: order.LimitPrice})
 	if !ok {
-		level = &PriceLevel{
-			PriceLevel: order.LimitPrice,
-			Orders:     btree.NewBTreeG(OrderAsc),
-		}
+		level = newPriceLevel(order.LimitPrice, book)
 		levels.Set(level)
 	}
-	level.Orders.Set(&order)
-
-	// Trigger the matching.
-	return book.Match()
+	return level.add(order)
 }
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	. "fenrir/internal/common"
+)
+
+// OrderQueue holds the orders resting on a price level in time priority. It is
+// a doubly linked list, each order and its links kept on its entry in the
+// book's index of resting orders by UUID, so an order is taken off from
+// anywhere in the queue in constant time however deep the level is. Entries
+// are reused once taken off, see pool.go.
+type OrderQueue struct {
+	front, back *queuedOrder
+	len         int
+}
+
+// queuedOrder is an order resting on a level, and its place in the level's
+// queue.
+type queuedOrder struct {
+	order      Order
+	rested     uint64 // Quantity the order rested with, to tell if it has traded since
+	level      *PriceLevel
+	prev, next *queuedOrder
+	twin       *queuedOrder // Resting later under the same UUID, which is not refused
+}
+
+// Len returns how many orders are queued.
+func (queue *OrderQueue) Len() int {
+	return queue.len
+}
+
+// Front returns the order first in time priority.
+func (queue *OrderQueue) Front() (*Order, bool) {
+	if queue.front == nil {
+		return nil, false
+	}
+	return &queue.front.order, true
+}
+
+// Scan visits the orders in time priority until visit returns false.
+func (queue *OrderQueue) Scan(visit func(order *Order) bool) {
+	for entry := queue.front; entry != nil; entry = entry.next {
+		if !visit(&entry.order) {
+			return
+		}
+	}
+}
+
+// push queues entry in time priority. New orders are always last, so go on
+// the back, only orders restored out of turn are walked forward from it.
+func (queue *OrderQueue) push(entry *queuedOrder) {
+	after := queue.back
+	for after != nil && OrderAsc(&entry.order, &after.order) {
+		after = after.prev
+	}
+
+	entry.prev = after
+	if after == nil {
+		entry.next = queue.front
+		queue.front = entry
+	} else {
+		entry.next = after.next
+		after.next = entry
+	}
+	if entry.next == nil {
+		queue.back = entry
+	} else {
+		entry.next.prev = entry
+	}
+	queue.len++
+}
+
+// unlink takes entry out of the queue.
+func (queue *OrderQueue) unlink(entry *queuedOrder) {
+	if entry.prev == nil {
+		queue.front = entry.next
+	} else {
+		entry.prev.next = entry.next
+	}
+	if entry.next == nil {
+		queue.back = entry.prev
+	} else {
+		entry.next.prev = entry.prev
+	}
+	entry.prev, entry.next = nil, nil
+	queue.len--
+}
+
+// index adds entry to the book's index of resting orders, after any resting
+// under its UUID already.
+func (book *OrderBook) index(entry *queuedOrder) {
+	last, ok := book.orders[entry.order.UUID]
+	if !ok {
+		book.orders[entry.order.UUID] = entry
+		return
+	}
+	for last.twin != nil {
+		last = last.twin
+	}
+	last.twin = entry
+}
+
+// indexed returns order's entry in the index, nil if it is not resting.
+func (book *OrderBook) indexed(order *Order) *queuedOrder {
+	entry := book.orders[order.UUID]
+	for entry != nil && &entry.order != order {
+		entry = entry.twin
+	}
+	return entry
+}
+
+// unindex takes order out of the book's index, returning its entry.
+func (book *OrderBook) unindex(order *Order) *queuedOrder {
+	entry := book.indexed(order)
+	if first := book.orders[order.UUID]; first == entry {
+		if entry.twin == nil {
+			delete(book.orders, order.UUID)
+		} else {
+			book.orders[order.UUID] = entry.twin
+		}
+	} else {
+		for first.twin != entry {
+			first = first.twin
+		}
+		first.twin = entry.twin
+	}
+	entry.twin = nil
+	return entry
+}
+
+// resting returns the order uuid resting on the book, the earliest placed
+// should there be several.
+func (book *OrderBook) resting(uuid string) (*Order, bool) {
+	entry, ok := book.orders[uuid]
+	if !ok {
+		return nil, false
+	}
+	return &entry.order, true
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SaveGTC writes every resting good-till-cancel order to path. Day orders are
+// not persisted, they expire with the trading day.
+//
+// The file is written alongside and renamed into place, so a crash mid-write
+// never leaves a truncated file behind.
+func (engine *Engine) SaveGTC(path string) error {
+	var orders []Order
+	for _, book := range engine.Books {
+		book.scanOrders(func(order *Order) {
+			if order.TimeInForce == GoodTillCancel {
+				orders = append(orders, *order)
+			}
+		})
+	}
+
+	if err := writeFileAtomic(path, orders); err != nil {
+		return fmt.Errorf("unable to save orders: %w", err)
+	}
+
+	log.Info().Int("orders", len(orders)).Str("path", path).Msg("saved gtc orders")
+	return nil
+}
+
+// RestoreGTC loads orders written by SaveGTC back into the books, keeping their
+// original sequence so time priority is unchanged. Nothing is matched, the
+// books were uncrossed when the orders were saved. A missing file is not an
+// error, there is simply nothing to restore.
+//
+// This must be called before any new orders are placed.
+func (engine *Engine) RestoreGTC(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to restore orders: %w", err)
+	}
+
+	var orders []Order
+	if err := json.Unmarshal(data, &orders); err != nil {
+		return fmt.Errorf("unable to restore orders: %w", err)
+	}
+
+	for _, order := range orders {
+		if err := engine.restoreOrder(order); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Int("orders", len(orders)).Str("path", path).Msg("restored gtc orders")
+	return nil
+}
+
+// writeFileAtomic writes v to path as JSON. It is written alongside and renamed
+// into place, so a crash mid-write never leaves a truncated file behind.
+func writeFileAtomic(path string, v any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreOrder rests a saved order back on its book as it was, without
+// matching it.
+func (engine *Engine) restoreOrder(order Order) error {
+	book, err := engine.Book(order.AssetType, order.Ticker)
+	if err != nil {
+		return fmt.Errorf("unable to restore order %s: %w", order.UUID, err)
+	}
+
+	levels := book.Bids
+	if order.Side == Sell {
+		levels = book.Asks
+	}
+	book.rest(levels, order)
+	book.flushUpdates()
+	engine.sequence = max(engine.sequence, order.Sequence)
+	return nil
+}
+
+// scanOrders visits every resting order in the book, bids then asks.
+func (book *OrderBook) scanOrders(visit func(order *Order)) {
+	for _, levels := range []*PriceLevels{book.Bids, book.Asks} {
+		levels.Scan(func(level *PriceLevel) bool {
+			level.Orders.Scan(func(order *Order) bool {
+				visit(order)
+				return true
+			})
+			return true
+		})
+	}
+}
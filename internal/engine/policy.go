@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidProRata = errors.New("invalid pro-rata instrument")
+
+// Fill is a single maker's share of an incoming order.
+type Fill struct {
+	Maker    *Order
+	Quantity uint64
+}
+
+// A MatchPolicy decides how an incoming order is shared between the orders
+// resting at a price level.
+//
+// Allocate is given the orders at the level in time priority, each with the
+// quantity it has available, and hands out up to quantity between them. It
+// must not give an order more than it has available, nor touch the orders
+// themselves. Class allocations (see SetAllocation) are taken out before the
+// policy is asked.
+type MatchPolicy interface {
+	Allocate(resting []Fill, quantity uint64) []Fill
+}
+
+// FIFOPolicy fills orders strictly in time priority.
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Allocate(resting []Fill, quantity uint64) []Fill {
+	var fills []Fill
+	for _, order := range resting {
+		if quantity == 0 {
+			break
+		}
+		qty := min(quantity, order.Quantity)
+		fills = append(fills, Fill{Maker: order.Maker, Quantity: qty})
+		quantity -= qty
+	}
+	return fills
+}
+
+// RandomPolicy fills orders in a random order, where an order's chance of
+// going next is weighted by its size. Each order picked is filled as far as
+// it can be, so time priority counts for nothing.
+type RandomPolicy struct {
+	rng *rand.Rand
+}
+
+// NewRandomPolicy seeds the policy, the same seed allocates the same way every
+// time.
+func NewRandomPolicy(seed uint64) *RandomPolicy {
+	return &RandomPolicy{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (policy *RandomPolicy) Allocate(resting []Fill, quantity uint64) []Fill {
+	candidates := make([]Fill, 0, len(resting))
+	total := uint64(0)
+	for _, order := range resting {
+		if order.Quantity > 0 {
+			candidates = append(candidates, order)
+			total += order.Quantity
+		}
+	}
+
+	var fills []Fill
+	for quantity > 0 && len(candidates) > 0 {
+		// Walk the candidates to find who the pick landed on.
+		pick := policy.rng.Uint64N(total)
+		i := 0
+		for pick >= candidates[i].Quantity {
+			pick -= candidates[i].Quantity
+			i++
+		}
+
+		qty := min(quantity, candidates[i].Quantity)
+		fills = append(fills, Fill{Maker: candidates[i].Maker, Quantity: qty})
+		quantity -= qty
+		total -= candidates[i].Quantity
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return fills
+}
+
+// ProRataPolicy shares an incoming order between the orders resting at a level
+// in proportion to their size, rounded down, as futures and options venues
+// commonly do. Orders whose share would come to less than MinAllocation lots
+// are given none of it. Whatever is left over, by rounding or minimums, is
+// handed out in time priority. An order for at least everything resting fills
+// every order.
+type ProRataPolicy struct {
+	MinAllocation uint64
+}
+
+func (policy ProRataPolicy) Allocate(resting []Fill, quantity uint64) []Fill {
+	total := uint64(0)
+	for _, order := range resting {
+		total += order.Quantity
+	}
+	if quantity >= total {
+		return FIFOPolicy{}.Allocate(resting, quantity)
+	}
+
+	shares := make([]uint64, len(resting))
+	left := quantity
+	for i, order := range resting {
+		// quantity is less than total, so the product over total fits.
+		hi, lo := bits.Mul64(order.Quantity, quantity)
+		share, _ := bits.Div64(hi, lo, total)
+		if share >= max(policy.MinAllocation, 1) {
+			shares[i] = share
+			left -= share
+		}
+	}
+	for i, order := range resting {
+		if left == 0 {
+			break
+		}
+		extra := min(left, order.Quantity-shares[i])
+		shares[i] += extra
+		left -= extra
+	}
+
+	var fills []Fill
+	for i, order := range resting {
+		if shares[i] > 0 {
+			fills = append(fills, Fill{Maker: order.Maker, Quantity: shares[i]})
+		}
+	}
+	return fills
+}
+
+// ParseProRata parses a "ticker:minAllocation" instrument matched pro-rata,
+// e.g. "ES:2" for orders on ES to be given no less than 2 lots of their share.
+// The minimum may be left out for none.
+func ParseProRata(spec string) (string, ProRataPolicy, error) {
+	ticker, minimum, limited := strings.Cut(spec, ":")
+	if ticker == "" {
+		return "", ProRataPolicy{}, fmt.Errorf("%w: %q is not ticker:minAllocation", ErrInvalidProRata, spec)
+	}
+	policy := ProRataPolicy{}
+	if limited {
+		allocation, err := strconv.ParseUint(minimum, 10, 64)
+		if err != nil {
+			return "", ProRataPolicy{}, fmt.Errorf("%w: minimum allocation %q", ErrInvalidProRata, minimum)
+		}
+		policy.MinAllocation = allocation
+	}
+	return ticker, policy, nil
+}
+
+// SetMatchPolicy sets the policy books use unless they have their own.
+func (engine *Engine) SetMatchPolicy(policy MatchPolicy) {
+	engine.policy = policy
+}
+
+// SetInstrumentPolicy has ticker's book matched by policy, whether or not it
+// has been made yet, unless the book is given its own. A nil policy goes back
+// to the engine's.
+func (engine *Engine) SetInstrumentPolicy(ticker string, policy MatchPolicy) {
+	if policy == nil {
+		delete(engine.instrumentPolicies, ticker)
+		return
+	}
+	engine.instrumentPolicies[ticker] = policy
+}
+
+// SetMatchPolicy overrides the engine's policy for this book. A nil policy
+// goes back to the engine's.
+func (book *OrderBook) SetMatchPolicy(policy MatchPolicy) {
+	book.policy = policy
+}
+
+func (book *OrderBook) matchPolicy() MatchPolicy {
+	if book.policy != nil {
+		return book.policy
+	}
+	if policy, ok := book.engine.instrumentPolicies[book.Instrument.Ticker]; ok {
+		return policy
+	}
+	return book.engine.policy
+}
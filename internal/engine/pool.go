@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"sync"
+
+	. "fenrir/internal/common"
+)
+
+// maxRetired is the most queue entries, and the most price levels, kept aside
+// by a command to be reused. Any more it takes off the books are left to the
+// garbage collector.
+const maxRetired = 4096
+
+// entryPool and levelPool hold the queue entries of orders, and the price
+// levels, taken off the books, for orders and levels added later to reuse
+// rather than allocating afresh. A book under sustained load otherwise makes
+// garbage of every order cancelled and every level emptied. They are shared by
+// every engine, so every shard.
+var (
+	entryPool = sync.Pool{New: func() any { return new(queuedOrder) }}
+	levelPool = sync.Pool{New: func() any { return new(PriceLevel) }}
+)
+
+// retired is what the command being applied has taken off the books. An order
+// taken off is still handed back by pointer to whoever took it off, e.g. to be
+// reported cancelled, so none of it is reused until the command is done with.
+type retired struct {
+	entries []*queuedOrder
+	levels  []*PriceLevel
+}
+
+// newQueuedOrder returns an entry, reused if there is one, for order resting
+// on level.
+func newQueuedOrder(order Order, level *PriceLevel) *queuedOrder {
+	entry := entryPool.Get().(*queuedOrder)
+	entry.order = order
+	entry.rested = order.Quantity
+	entry.level = level
+	return entry
+}
+
+// newPriceLevel returns an empty level, reused if there is one, at price on
+// book.
+func newPriceLevel(price float64, book *OrderBook) *PriceLevel {
+	level := levelPool.Get().(*PriceLevel)
+	level.PriceLevel = price
+	level.book = book
+	return level
+}
+
+// retireOrder sets aside the entry of an order taken off its level, to be
+// reused once the command is done. Orders which traded are left be, as trades
+// keep pointers to them.
+func (engine *Engine) retireOrder(entry *queuedOrder) {
+	if entry.order.Quantity != entry.rested || len(engine.retired.entries) == maxRetired {
+		return
+	}
+	engine.retired.entries = append(engine.retired.entries, entry)
+}
+
+// deleteLevel takes an emptied level off the book, setting it aside to be
+// reused once the command is done.
+func (book *OrderBook) deleteLevel(levels *PriceLevels, level *PriceLevel) {
+	levels.Delete(level)
+	if retired := &book.engine.retired; len(retired.levels) < maxRetired {
+		retired.levels = append(retired.levels, level)
+	}
+}
+
+// recycle hands whatever the last command retired back to be reused. It is
+// called as each command is run, by which point nothing from the last is
+// looked at, so orders taken off the books by calling the engine directly
+// rather than through Apply are not reused until a command is next applied.
+func (engine *Engine) recycle() {
+	for i, entry := range engine.retired.entries {
+		*entry = queuedOrder{}
+		entryPool.Put(entry)
+		engine.retired.entries[i] = nil
+	}
+	for i, level := range engine.retired.levels {
+		*level = PriceLevel{}
+		levelPool.Put(level)
+		engine.retired.levels[i] = nil
+	}
+	engine.retired.entries = engine.retired.entries[:0]
+	engine.retired.levels = engine.retired.levels[:0]
+}
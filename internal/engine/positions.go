@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	. "fenrir/internal/common"
+)
+
+var ErrPositionLimitExceeded = Reject(RejectPositionLimit, errors.New("order could take the position over its limit"))
+
+// SetPositionLimit sets the furthest owner may be long or short ticker, see
+// PositionLimit. A zero limit removes it.
+func (engine *Engine) SetPositionLimit(owner, ticker string, limit PositionLimit) {
+	key := PositionKey{Owner: owner, Ticker: ticker}
+	if limit != (PositionLimit{}) {
+		engine.positionLimits[key] = limit
+	} else {
+		delete(engine.positionLimits, key)
+	}
+}
+
+// SetPositionLimits replaces every position limit of owner with limits, by
+// ticker.
+func (engine *Engine) SetPositionLimits(owner string, limits map[string]PositionLimit) {
+	for key := range engine.positionLimits {
+		if key.Owner == owner {
+			delete(engine.positionLimits, key)
+		}
+	}
+	for ticker, limit := range limits {
+		engine.SetPositionLimit(owner, ticker, limit)
+	}
+}
+
+// positionLimit returns owner's limit in ticker, falling back on that of
+// DefaultPositionAccount.
+func (engine *Engine) positionLimit(owner, ticker string) (PositionLimit, bool) {
+	if limit, ok := engine.positionLimits[PositionKey{Owner: owner, Ticker: ticker}]; ok {
+		return limit, true
+	}
+	limit, ok := engine.positionLimits[PositionKey{Owner: DefaultPositionAccount, Ticker: ticker}]
+	return limit, ok
+}
+
+// checkPositionLimit rejects an order which could take its owner's position
+// over their limit, were it and everything they have resting on the same side
+// to fill. Only the instrument ordered is checked, not the legs of baskets and
+// strategies.
+func (engine *Engine) checkPositionLimit(order Order) error {
+	limit, ok := engine.positionLimit(order.Owner, order.Ticker)
+	if !ok {
+		return nil
+	}
+
+	var resting uint64
+	if book, ok := engine.Books[order.Ticker]; ok {
+		book.scanOrders(func(other *Order) {
+			if other.Owner == order.Owner && other.Side == order.Side {
+				resting += other.Quantity
+			}
+		})
+	}
+	engine.ledgerLock.Lock()
+	position := engine.ledger.Positions[PositionKey{Owner: order.Owner, Ticker: order.Ticker}]
+	engine.ledgerLock.Unlock()
+
+	projected := resting + order.Quantity
+	if order.Side == Buy && limit.MaxLong > 0 && position+int64(projected) > int64(limit.MaxLong) {
+		return fmt.Errorf("%w: %d long with %d more bought, limit %d", ErrPositionLimitExceeded, position, projected, limit.MaxLong)
+	}
+	if order.Side == Sell && limit.MaxShort > 0 && int64(projected)-position > int64(limit.MaxShort) {
+		return fmt.Errorf("%w: %d long with %d more sold, limit %d short", ErrPositionLimitExceeded, position, projected, limit.MaxShort)
+	}
+	return nil
+}
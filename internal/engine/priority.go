@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"slices"
+)
+
+var (
+	ErrInvalidPriorityClass = errors.New("invalid priority class")
+	ErrInvalidAllocation    = errors.New("allocations must not exceed 100 percent")
+)
+
+// SetPriorityClass puts every future order from owner into class. Orders
+// already resting keep the class they were placed with.
+func (engine *Engine) SetPriorityClass(owner string, class PriorityClass) error {
+	if class < StandardClass || class >= NumPriorityClasses {
+		return ErrInvalidPriorityClass
+	}
+	if class == StandardClass {
+		delete(engine.priorityClasses, owner)
+		return nil
+	}
+	engine.priorityClasses[owner] = class
+	return nil
+}
+
+// Onboard puts a newly registered participant's orders in the priority class
+// they are entitled to, and holds them to their credit and position limits,
+// their positions margined by their margin mode.
+func (engine *Engine) Onboard(participant Participant) error {
+	class := StandardClass
+	if participant.Entitlements.Has(MarketMakerEntitlement) {
+		class = MarketMakerClass
+	}
+	engine.SetCreditLimit(participant.ID, participant.CreditLimit)
+	engine.SetPositionLimits(participant.ID, participant.PositionLimits)
+	engine.SetMarginMode(participant.ID, participant.MarginMode)
+	return engine.SetPriorityClass(participant.ID, class)
+}
+
+// SetAllocation gives orders of class percent of every fill at a price level
+// before the rest of the fill is handed out in time priority. The standard
+// class always gets whatever is left, so can not be given an allocation.
+func (engine *Engine) SetAllocation(class PriorityClass, percent uint64) error {
+	if class <= StandardClass || class >= NumPriorityClasses {
+		return ErrInvalidPriorityClass
+	}
+
+	total := percent
+	for other, allocation := range engine.allocations {
+		if other != class {
+			total += allocation
+		}
+	}
+	if total > 100 {
+		return ErrInvalidAllocation
+	}
+
+	if percent == 0 {
+		delete(engine.allocations, class)
+		return nil
+	}
+	engine.allocations[class] = percent
+	return nil
+}
+
+// allocate splits up to quantity across the orders resting on a level, without
+// touching the level itself.
+//
+// Each class with an allocation first gets its percentage of the quantity,
+// shared among its orders in time priority. Whatever is left, including
+// allocations a class could not use, is handed out by the book's match policy.
+// An order filled in both passes is given a single fill.
+func (book *OrderBook) allocate(level *PriceLevel, quantity uint64) []Fill {
+	var fills []Fill
+	index := make(map[*Order]int)
+	give := func(order *Order, qty uint64) {
+		if i, ok := index[order]; ok {
+			fills[i].Quantity += qty
+			return
+		}
+		index[order] = len(fills)
+		fills = append(fills, Fill{Maker: order, Quantity: qty})
+	}
+	remaining := func(order *Order) uint64 {
+		if i, ok := index[order]; ok {
+			return order.Quantity - fills[i].Quantity
+		}
+		return order.Quantity
+	}
+
+	// Go through classes in a fixed order so allocation is deterministic.
+	classes := make([]PriorityClass, 0, len(book.engine.allocations))
+	for class := range book.engine.allocations {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	left := quantity
+	for _, class := range classes {
+		// Split to avoid overflowing on large quantities.
+		percent := book.engine.allocations[class]
+		share := quantity/100*percent + quantity%100*percent/100
+		level.Orders.Scan(func(order *Order) bool {
+			if share == 0 {
+				return false
+			}
+			if order.PriorityClass != class {
+				return true
+			}
+			qty := min(share, remaining(order))
+			give(order, qty)
+			share -= qty
+			left -= qty
+			return true
+		})
+	}
+	if left == 0 {
+		return fills
+	}
+
+	resting := make([]Fill, 0, level.Orders.Len())
+	level.Orders.Scan(func(order *Order) bool {
+		if qty := remaining(order); qty > 0 {
+			resting = append(resting, Fill{Maker: order, Quantity: qty})
+		}
+		return true
+	})
+	for _, fill := range book.matchPolicy().Allocate(resting, left) {
+		give(fill.Maker, fill.Quantity)
+	}
+	return fills
+}
@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	. "fenrir/internal/common"
+)
+
+var ErrJournalGap = errors.New("journal does not follow on from snapshot")
+
+// Recover rebuilds the engine as it was before it went down, from its latest
+// snapshot and the commands journaled since, and returns how many commands
+// were replayed. Sequences, time priority and replay markers all pick up from
+// where they were. The journal must run on from the snapshot, one which starts
+// after it or ends before it is from some other run, and is refused with
+// ErrJournalGap.
+//
+// Replaying does not repeat what was already done with the commands the first
+// time around. Nothing is reported, published, audited or recorded, and
+// candles and the ledger are left to be restored from the audit trail as on
+// any other start.
+//
+// This must be called before any new orders are placed.
+func (engine *Engine) Recover(snap Snapshot, cmds []Command) (int, error) {
+	from := snap.Markers.Sequence
+	if len(cmds) > 0 {
+		if first := cmds[0].Sequence; first > from+1 {
+			return 0, ErrJournalGap
+		}
+		if last := cmds[len(cmds)-1].Sequence; last < from {
+			return 0, ErrJournalGap
+		}
+	}
+	if err := engine.RestoreSnapshot(snap); err != nil {
+		return 0, err
+	}
+
+	reporter, publisher, auditor, recorder := engine.reporter, engine.publisher, engine.auditor, engine.tradeRecorder
+	candles := maps.Clone(engine.candles)
+	for ticker, history := range candles {
+		candles[ticker] = slices.Clone(history)
+	}
+	ledger := engine.Ledger()
+	engine.reporter, engine.publisher, engine.auditor, engine.tradeRecorder = discardReporter{}, nil, nil, nil
+	defer func() {
+		engine.reporter, engine.publisher, engine.auditor, engine.tradeRecorder = reporter, publisher, auditor, recorder
+		engine.candles = candles
+		engine.ledgerLock.Lock()
+		engine.ledger = ledger
+		engine.ledgerLock.Unlock()
+	}()
+
+	return engine.Replay(cmds)
+}
+
+// discardReporter reports nothing, there is nobody to report to while
+// recovering.
+type discardReporter struct{}
+
+func (discardReporter) ReportTrade(Trade, error) error                    { return nil }
+func (discardReporter) ReportError(string, error) error                   { return nil }
+func (discardReporter) ReportSymbolStatus(string, SymbolStatus) error     { return nil }
+func (discardReporter) ReportUnsolicitedCancel(Order, CancelReason) error { return nil }
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrReplayDiverged = errors.New("replay diverged")
+)
+
+// ReplayState is what running commands has left the engine with: its books and
+// the tape of every trade made, each encoded the same way every time, so that
+// two runs of the same commands, e.g. the exchange's and a replay of its
+// journal on a fresh engine, can be checked byte for byte. Running the same
+// commands from the same books must always come to the same state, or the
+// journal could not be relied on for recovery.
+type ReplayState struct {
+	Books []byte // The books as snapshotted, in ticker order, see Snapshot
+	Tape  []byte // Trades still in memory, see TradeTape
+}
+
+// ReplayState returns the engine's books and trade tape. Only trades still in
+// memory are on the tape, all of them unless some are recorded elsewhere, see
+// SetTradeRecorder.
+func (engine *Engine) ReplayState() (ReplayState, error) {
+	books, err := json.Marshal(engine.Snapshot().Books)
+	if err != nil {
+		return ReplayState{}, err
+	}
+	var tape bytes.Buffer
+	recorder := NewTradeTape(&tape)
+	for _, trade := range engine.Trades {
+		recorder.RecordTrade(trade.Record())
+	}
+	if err := recorder.Flush(); err != nil {
+		return ReplayState{}, err
+	}
+	return ReplayState{Books: books, Tape: tape.Bytes()}, nil
+}
+
+// Check returns an error wrapping ErrReplayDiverged unless state is byte for
+// byte want, saying where the two first differ.
+func (state ReplayState) Check(want ReplayState) error {
+	if err := CheckBooks(state.Books, want.Books); err != nil {
+		return err
+	}
+	return CheckTape(state.Tape, want.Tape)
+}
+
+// CheckBooks returns an error wrapping ErrReplayDiverged unless books is byte
+// for byte want, saying where the two first differ.
+func CheckBooks(books, want []byte) error {
+	if bytes.Equal(books, want) {
+		return nil
+	}
+	return fmt.Errorf("%w: books differ at byte %d", ErrReplayDiverged, firstDifference(books, want))
+}
+
+// CheckTape returns an error wrapping ErrReplayDiverged unless tape is byte for
+// byte want, saying which trade the two first differ at.
+func CheckTape(tape, want []byte) error {
+	if bytes.Equal(tape, want) {
+		return nil
+	}
+	at := firstDifference(tape, want)
+	return fmt.Errorf("%w: trade tapes differ at trade %d", ErrReplayDiverged, bytes.Count(tape[:at], []byte("\n"))+1)
+}
+
+func firstDifference(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// ReplayFresh replays cmds, the whole of a journal from the start, on a fresh
+// engine made by setup and returns the state it comes to. The engine must be
+// set up as the one journaling them was, with the same instruments and
+// allocation, for them to match as they did the first time around. Nothing is
+// reported, see Recover.
+func ReplayFresh(setup func() *Engine, from Snapshot, cmds []Command) (ReplayState, error) {
+	engine := setup()
+	if _, err := engine.Recover(from, cmds); err != nil {
+		return ReplayState{}, err
+	}
+	return engine.ReplayState()
+}
+
+// TradeTape writes each trade recorded to w, a TradeRecord in JSON a line, for
+// a journal's replay to be checked against, see ReplayState. Trades are
+// buffered, so the tape is only complete once flushed.
+type TradeTape struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewTradeTape(w io.Writer) *TradeTape {
+	return &TradeTape{w: bufio.NewWriter(w)}
+}
+
+func (tape *TradeTape) RecordTrade(trade TradeRecord) {
+	if tape.err != nil {
+		return
+	}
+	line, err := json.Marshal(trade)
+	if err == nil {
+		_, err = tape.w.Write(append(line, '\n'))
+	}
+	tape.err = err
+}
+
+// Flush writes out whatever is buffered, returning the first error the tape
+// ran into, if any. Trades recorded after an error are dropped.
+func (tape *TradeTape) Flush() error {
+	if tape.err != nil {
+		return tape.err
+	}
+	return tape.w.Flush()
+}
@@ -0,0 +1,451 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	. "fenrir/internal/common"
+	"fenrir/internal/utils"
+)
+
+// DefaultShardQueueLen is how many commands may wait on each shard.
+const DefaultShardQueueLen = 64
+
+var (
+	ErrCrossShard = Reject(RejectInvalidOrder, errors.New("orders are on books of different shards"))
+)
+
+// Shards spreads the books over engines of their own, each run by a goroutine
+// of its own, so books on different shards share no state and nothing on the
+// matching path need be locked. Every command on a ticker goes to the same
+// shard, picked by a hash of it, and a shard runs its commands one at a time
+// in the order they were routed to it, so each book is handled as
+// deterministically as on a single engine.
+//
+// Shards route commands and queries by symbol, and stand in for an engine
+// wherever one is served. Apply waits on the command as an engine's does, but
+// Submit does not: the router goes on to route more while the shards run what
+// they have been sent at once, their replies handed back to it as each is
+// done. As with an engine, commands and queries must all come from the one
+// goroutine: each shard's queue has exactly one producer, the router, and one
+// consumer, the shard, and its replies the other way around. Admit, Release
+// and ThrottleBudget are safe to call concurrently, as they are on an engine.
+//
+// Commands on several books, groups and manual trades, must have them all on
+// the one shard. Those on an owner's orders, or on every order, run on every
+// shard at once. Cancels go to the shard the order rests on. Client order ids
+// are only unique within a shard, and strategies, baskets and options are best
+// registered on the shard of their legs and underlyings.
+type Shards struct {
+	shards         []*shard
+	sessionMarkers map[string]CommandOrigin // Last command routed per session
+	replied        chan struct{}            // Signalled as shards hand back replies
+	done           chan struct{}            // Closed to stop the shards
+}
+
+// shard is an engine and the goroutine running everything asked of it.
+type shard struct {
+	engine   *Engine
+	queue    *utils.SPSCQueue[func(*Engine)]
+	replies  *utils.SPSCQueue[func()] // Handed back by submitted commands, see Submit
+	inflight int                      // Submitted whose replies are yet to be run, only touched by the router
+}
+
+// NewShards runs each of engines, at least one, as a shard until Close. They
+// should be set up alike, and share a reporter and market data publisher safe
+// to call from every shard at once. Trade ids are interleaved across them, so
+// stay unique.
+func NewShards(engines ...*Engine) *Shards {
+	shards := &Shards{
+		sessionMarkers: make(map[string]CommandOrigin),
+		replied:        make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+	stride := uint64(len(engines))
+	for i, engine := range engines {
+		// From past any it has handed out already, each shard hands out the
+		// ids congruent to its index.
+		engine.tradeIDStride = stride
+		engine.tradeID += (uint64(i) + stride - engine.tradeID%stride) % stride
+		for _, origin := range engine.sessionMarkers {
+			shards.mark(origin)
+		}
+
+		shard := &shard{
+			engine:  engine,
+			queue:   utils.NewSPSCQueue[func(*Engine)](DefaultShardQueueLen),
+			replies: utils.NewSPSCQueue[func()](DefaultShardQueueLen),
+		}
+		shards.shards = append(shards.shards, shard)
+		go shard.run(shards.done)
+	}
+	return shards
+}
+
+// Close stops every shard, once what each is running is done.
+func (shards *Shards) Close() {
+	close(shards.done)
+}
+
+func (shard *shard) run(done <-chan struct{}) {
+	for {
+		task, ok := shard.queue.Pop(done)
+		if !ok {
+			return
+		}
+		task(shard.engine)
+	}
+}
+
+// on runs fn on the shard's goroutine, returning once it has.
+func (shard *shard) on(fn func(engine *Engine)) {
+	ran := make(chan struct{})
+	shard.queue.Push(func(engine *Engine) {
+		fn(engine)
+		close(ran)
+	})
+	<-ran
+}
+
+// every runs fn on every shard at once, returning once they all have. The
+// shard's index is passed in, for each to keep what it finds apart.
+func (shards *Shards) every(fn func(i int, engine *Engine)) {
+	var ran sync.WaitGroup
+	ran.Add(len(shards.shards))
+	for i, shard := range shards.shards {
+		shard.queue.Push(func(engine *Engine) {
+			fn(i, engine)
+			ran.Done()
+		})
+	}
+	ran.Wait()
+}
+
+// shardOf returns the shard ticker's book is on, by its FNV-1a hash.
+func (shards *Shards) shardOf(ticker string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(ticker); i++ {
+		hash ^= uint32(ticker[i])
+		hash *= 16777619
+	}
+	return shards.shards[hash%uint32(len(shards.shards))]
+}
+
+// Engine returns the engine ticker's book is on. It may only be touched from
+// the goroutine routing commands, between them with none submitted still to
+// reply, or once the shards are closed.
+func (shards *Shards) Engine(ticker string) *Engine {
+	return shards.shardOf(ticker).engine
+}
+
+// SetReporter sets the reporter of every shard.
+func (shards *Shards) SetReporter(reporter Reporter) {
+	shards.every(func(_ int, engine *Engine) {
+		engine.SetReporter(reporter)
+	})
+}
+
+// Apply routes a command to the shard of its book, or to every shard if it is
+// on an owner's orders or every order, and applies it there, see
+// Engine.Apply. A session's commands are only ever applied once, whichever
+// shards they go to.
+func (shards *Shards) Apply(cmd Command) ([]Order, error) {
+	if last, ok := shards.sessionMarkers[cmd.Origin.Session]; ok && !cmd.Origin.After(last) {
+		return nil, ErrCommandApplied
+	}
+	target, everywhere, err := shards.route(cmd)
+	if err != nil {
+		return nil, err
+	}
+	shards.mark(cmd.Origin)
+
+	if everywhere {
+		return shards.applyEverywhere(cmd)
+	}
+	var cancelled []Order
+	target.on(func(engine *Engine) {
+		cancelled, err = engine.Apply(cmd)
+	})
+	return cancelled, err
+}
+
+// Submit routes a command as Apply does, but returns without waiting on it, so
+// the router can go on to send others to other shards while it is applied.
+// Once it is, reply is run on its shard with what it came to, and whatever
+// reply returns is handed back to be run by RunReplies, in the order the
+// shard applied them. Commands run on every shard are applied before Submit
+// returns, reply and what it returns along with them. An error is returned,
+// and reply never run, only for a command which cannot be routed.
+func (shards *Shards) Submit(cmd Command, reply CommandReply) error {
+	if last, ok := shards.sessionMarkers[cmd.Origin.Session]; ok && !cmd.Origin.After(last) {
+		return ErrCommandApplied
+	}
+	target, everywhere, err := shards.route(cmd)
+	if err != nil {
+		return err
+	}
+	shards.mark(cmd.Origin)
+
+	if everywhere {
+		orders, err := shards.applyEverywhere(cmd)
+		if then := reply(shards, orders, err); then != nil {
+			then()
+		}
+		return nil
+	}
+	// A shard never has more replies waiting than fit, so it never waits on
+	// the router to take them while the router waits on it.
+	for target.inflight == DefaultShardQueueLen {
+		<-shards.replied
+		shards.RunReplies()
+	}
+	target.inflight++
+	target.queue.Push(func(engine *Engine) {
+		orders, err := engine.Apply(cmd)
+		target.replies.Push(reply(engine, orders, err))
+		select {
+		case shards.replied <- struct{}{}:
+		default:
+		}
+	})
+	return nil
+}
+
+// Replied is signalled whenever shards have handed back replies for
+// RunReplies to run.
+func (shards *Shards) Replied() <-chan struct{} {
+	return shards.replied
+}
+
+// RunReplies runs what the replies of submitted commands have handed back so
+// far, each shard's in the order it applied them, see Submit.
+func (shards *Shards) RunReplies() {
+	for _, shard := range shards.shards {
+		for {
+			then, ok := shard.replies.TryPop()
+			if !ok {
+				break
+			}
+			shard.inflight--
+			if then != nil {
+				then()
+			}
+		}
+	}
+}
+
+// applyEverywhere applies a command on every shard at once.
+func (shards *Shards) applyEverywhere(cmd Command) ([]Order, error) {
+	cancelled := make([][]Order, len(shards.shards))
+	errs := make([]error, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		cancelled[i], errs[i] = engine.Apply(cmd)
+	})
+	return slices.Concat(cancelled...), errors.Join(errs...)
+}
+
+// route picks the shard a command is run on, or whether it is run on every
+// one.
+func (shards *Shards) route(cmd Command) (*shard, bool, error) {
+	switch cmd.Type {
+	case PlaceOrderCommand, PlaceOrderGroupCommand, ManualTradeCommand:
+		if len(cmd.Orders) == 0 {
+			// For the engine to refuse.
+			return shards.shards[0], false, nil
+		}
+		target := shards.shardOf(cmd.Orders[0].Ticker)
+		for _, order := range cmd.Orders[1:] {
+			if shards.shardOf(order.Ticker) != target {
+				return nil, false, ErrCrossShard
+			}
+		}
+		return target, false, nil
+	case CancelOwnOrderCommand, AdminCancelOrderCommand:
+		return shards.resting(func(engine *Engine) bool {
+			_, ok := engine.OrderOwner(cmd.UUID)
+			return ok
+		}), false, nil
+	case CancelClientOrderCommand:
+		return shards.resting(func(engine *Engine) bool {
+			_, ok := engine.ClientOrder(cmd.Owner, cmd.ClOrdID)
+			return ok
+		}), false, nil
+	case KillSwitchCommand, AdminCancelOwnerCommand, AdminCancelAllCommand:
+		return nil, true, nil
+	}
+	return shards.shardOf(cmd.Ticker), false, nil
+}
+
+// resting returns the shard an order found by rests on, the first if it is
+// not resting anywhere, for its engine to refuse the cancel.
+func (shards *Shards) resting(found func(engine *Engine) bool) *shard {
+	rests := make([]bool, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		rests[i] = found(engine)
+	})
+	if i := slices.Index(rests, true); i >= 0 {
+		return shards.shards[i]
+	}
+	return shards.shards[0]
+}
+
+func (shards *Shards) mark(origin CommandOrigin) {
+	if last, ok := shards.sessionMarkers[origin.Session]; origin.Session != "" && (!ok || origin.After(last)) {
+		shards.sessionMarkers[origin.Session] = origin
+	}
+}
+
+// Onboard onboards participant on every shard, see Engine.Onboard.
+func (shards *Shards) Onboard(participant Participant) error {
+	errs := make([]error, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		errs[i] = engine.Onboard(participant)
+	})
+	return errors.Join(errs...)
+}
+
+// SessionMarker returns the last command routed from session, see
+// Engine.SessionMarker.
+func (shards *Shards) SessionMarker(session string) CommandOrigin {
+	return shards.sessionMarkers[session]
+}
+
+func (shards *Shards) Instrument(ticker string) (inst Instrument, ok bool) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		inst, ok = engine.Instrument(ticker)
+	})
+	return inst, ok
+}
+
+// Tickers returns the ticker of every instrument of assetType on any shard, in
+// order.
+func (shards *Shards) Tickers(assetType AssetType) []string {
+	tickers := make([][]string, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		tickers[i] = engine.Tickers(assetType)
+	})
+	merged := slices.Concat(tickers...)
+	slices.Sort(merged)
+	return merged
+}
+
+func (shards *Shards) OrderStatus(ticker string, uuid string) (status OrderStatus, resting uint64) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		status, resting = engine.OrderStatus(ticker, uuid)
+	})
+	return status, resting
+}
+
+func (shards *Shards) BBO(ticker string) (bbo BBO, err error) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		bbo, err = engine.BBO(ticker)
+	})
+	return bbo, err
+}
+
+func (shards *Shards) Depth(ticker string, levels int) (depth BookDepth, err error) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		depth, err = engine.Depth(ticker, levels)
+	})
+	return depth, err
+}
+
+func (shards *Shards) InAuction(ticker string) (auction bool) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		auction = engine.InAuction(ticker)
+	})
+	return auction
+}
+
+func (shards *Shards) IndicativeUncross(ticker string) (uncross Uncross, err error) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		uncross, err = engine.IndicativeUncross(ticker)
+	})
+	return uncross, err
+}
+
+func (shards *Shards) Candles(ticker string, interval time.Duration, from, to time.Time, limit int) (page CandlePage, err error) {
+	shards.shardOf(ticker).on(func(engine *Engine) {
+		page, err = engine.Candles(ticker, interval, from, to, limit)
+	})
+	return page, err
+}
+
+// BookMetrics returns what the books of every shard are holding on to.
+func (shards *Shards) BookMetrics() BookMetrics {
+	each := make([]BookMetrics, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		each[i] = engine.BookMetrics()
+	})
+	var metrics BookMetrics
+	for _, shard := range each {
+		metrics.Books += shard.Books
+		metrics.EmptyBooks += shard.EmptyBooks
+		metrics.StaleBooks += shard.StaleBooks
+		metrics.Levels += shard.Levels
+		metrics.StaleLevels += shard.StaleLevels
+		metrics.Orders += shard.Orders
+		metrics.OldestLevel = max(metrics.OldestLevel, shard.OldestLevel)
+		metrics.Dropped += shard.Dropped
+	}
+	return metrics
+}
+
+// OpenOrders returns every order resting on behalf of owner, on any shard.
+func (shards *Shards) OpenOrders(owner string) []Order {
+	orders := make([][]Order, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		orders[i] = engine.OpenOrders(owner)
+	})
+	return slices.Concat(orders...)
+}
+
+// OrderOwner returns who owns the resting order uuid, on whichever shard.
+func (shards *Shards) OrderOwner(uuid string) (string, bool) {
+	owners := make([]string, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		owners[i], _ = engine.OrderOwner(uuid)
+	})
+	for _, owner := range owners {
+		if owner != "" {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// QueryTrades picks out trades kept in memory by every shard, earliest first.
+func (shards *Shards) QueryTrades(query TradeQuery) []TradeRecord {
+	trades := make([][]TradeRecord, len(shards.shards))
+	shards.every(func(i int, engine *Engine) {
+		trades[i] = engine.QueryTrades(query)
+	})
+	merged := slices.Concat(trades...)
+	slices.SortStableFunc(merged, func(a, b TradeRecord) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	if query.Limit > 0 && len(merged) > query.Limit {
+		merged = merged[len(merged)-query.Limit:]
+	}
+	return merged
+}
+
+func (shards *Shards) LogBook() {
+	shards.every(func(_ int, engine *Engine) {
+		engine.LogBook()
+	})
+}
+
+func (shards *Shards) Admit(ticker string, priority CommandPriority) error {
+	return shards.shardOf(ticker).engine.Admit(ticker, priority)
+}
+
+func (shards *Shards) Release(ticker string) {
+	shards.shardOf(ticker).engine.Release(ticker)
+}
+
+func (shards *Shards) ThrottleBudget(ticker string) ThrottleBudget {
+	return shards.shardOf(ticker).engine.ThrottleBudget(ticker)
+}
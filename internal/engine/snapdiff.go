@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "fenrir/internal/common"
+)
+
+// SnapshotDiff is one way in which two snapshots of the books differ, e.g. a
+// replica's and its primary's, or a snapshot and what replaying the journal
+// over an earlier one recovers.
+type SnapshotDiff struct {
+	Ticker string  // Of the book, empty for the snapshot as a whole
+	Level  bool    // Whether it is within a price level, rather than the whole book
+	Side   Side    // Of the level
+	Price  float64 // Of the level
+	What   string  // What differs, e.g. "quantity" or "order <uuid> owner"
+	A, B   string  // As it is in each snapshot, empty if missing from it
+}
+
+func (diff SnapshotDiff) String() string {
+	where := "snapshot"
+	if diff.Ticker != "" {
+		where = strings.TrimRight(diff.Ticker, "\x00")
+	}
+	if diff.Level {
+		side := "bid"
+		if diff.Side == Sell {
+			side = "ask"
+		}
+		where += " " + side + " " + strconv.FormatFloat(diff.Price, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%s: %s: %s != %s", where, diff.What, cmp.Or(diff.A, "none"), cmp.Or(diff.B, "none"))
+}
+
+// DiffSnapshots returns every way in which b differs from a: the sequences and
+// replay markers they were taken at, and for each book, in ticker order, its
+// price levels best first and the orders resting at each in time priority. A
+// book missing from one is taken as empty. Timestamps are not compared, they
+// are expected to differ between replicas.
+func DiffSnapshots(a, b Snapshot) []SnapshotDiff {
+	var diffs []SnapshotDiff
+	differ := func(diff SnapshotDiff) {
+		if diff.A != diff.B {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	differ(SnapshotDiff{What: "order sequence", A: strconv.FormatUint(a.Sequence, 10), B: strconv.FormatUint(b.Sequence, 10)})
+	differ(SnapshotDiff{What: "trade id", A: strconv.FormatUint(a.TradeID, 10), B: strconv.FormatUint(b.TradeID, 10)})
+	differ(SnapshotDiff{What: "command sequence", A: strconv.FormatUint(a.Markers.Sequence, 10), B: strconv.FormatUint(b.Markers.Sequence, 10)})
+	sessions := slices.Sorted(maps.Keys(a.Markers.Sessions))
+	for session := range b.Markers.Sessions {
+		if _, ok := a.Markers.Sessions[session]; !ok {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.Sort(sessions)
+	for _, session := range sessions {
+		differ(SnapshotDiff{
+			What: "session " + session + " replayed to",
+			A:    describeOrigin(a.Markers.Sessions, session),
+			B:    describeOrigin(b.Markers.Sessions, session),
+		})
+	}
+
+	booksA, booksB := booksByTicker(a), booksByTicker(b)
+	tickers := slices.Collect(maps.Keys(booksA))
+	for ticker := range booksB {
+		if _, ok := booksA[ticker]; !ok {
+			tickers = append(tickers, ticker)
+		}
+	}
+	slices.Sort(tickers)
+	for _, ticker := range tickers {
+		bookA, okA := booksA[ticker]
+		bookB, okB := booksB[ticker]
+		if okA && okB {
+			differ(SnapshotDiff{Ticker: ticker, What: "asset type", A: strconv.Itoa(int(bookA.AssetType)), B: strconv.Itoa(int(bookB.AssetType))})
+		}
+		for _, side := range []Side{Buy, Sell} {
+			diffs = append(diffs, diffLevels(ticker, side, bookA.Orders, bookB.Orders)...)
+		}
+	}
+	return diffs
+}
+
+func booksByTicker(snap Snapshot) map[string]BookState {
+	books := make(map[string]BookState, len(snap.Books))
+	for _, state := range snap.Books {
+		books[state.Ticker] = state
+	}
+	return books
+}
+
+func describeOrigin(sessions map[string]CommandOrigin, session string) string {
+	origin, ok := sessions[session]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d", origin.Sequence, origin.Part)
+}
+
+// diffLevels compares the price levels on one side of a book.
+func diffLevels(ticker string, side Side, ordersA, ordersB []Order) []SnapshotDiff {
+	levelsA, levelsB := levelsOf(side, ordersA), levelsOf(side, ordersB)
+	prices := slices.Collect(maps.Keys(levelsA))
+	for price := range levelsB {
+		if _, ok := levelsA[price]; !ok {
+			prices = append(prices, price)
+		}
+	}
+	// Best first.
+	slices.Sort(prices)
+	if side == Buy {
+		slices.Reverse(prices)
+	}
+
+	var diffs []SnapshotDiff
+	for _, price := range prices {
+		levelA, levelB := levelsA[price], levelsB[price]
+		differ := func(what, a, b string) {
+			if a != b {
+				diffs = append(diffs, SnapshotDiff{Ticker: ticker, Level: true, Side: side, Price: price, What: what, A: a, B: b})
+			}
+		}
+		differ("level", describeLevel(levelA), describeLevel(levelB))
+		if len(levelA) == 0 || len(levelB) == 0 {
+			continue
+		}
+
+		// Orders in only one are told of on their own, queue positions are
+		// among the orders in both.
+		inA, inB := positions(levelA), positions(levelB)
+		var bothA, bothB []Order
+		for _, order := range levelA {
+			if _, ok := inB[order.UUID]; ok {
+				bothA = append(bothA, order)
+			} else {
+				differ("order "+order.UUID, describeOrder(order), "")
+			}
+		}
+		for _, order := range levelB {
+			if _, ok := inA[order.UUID]; ok {
+				bothB = append(bothB, order)
+			} else {
+				differ("order "+order.UUID, "", describeOrder(order))
+			}
+		}
+		positionsB := positions(bothB)
+		for i, orderA := range bothA {
+			j := positionsB[orderA.UUID]
+			orderB := bothB[j]
+			differ("order "+orderA.UUID+" queue position", strconv.Itoa(i+1), strconv.Itoa(j+1))
+			differ("order "+orderA.UUID+" owner", orderA.Owner, orderB.Owner)
+			differ("order "+orderA.UUID+" quantity",
+				FormatQuantity(orderA.Quantity, orderA.QuantityScale)+"/"+FormatQuantity(orderA.TotalQuantity, orderA.QuantityScale),
+				FormatQuantity(orderB.Quantity, orderB.QuantityScale)+"/"+FormatQuantity(orderB.TotalQuantity, orderB.QuantityScale))
+			differ("order "+orderA.UUID+" sequence", strconv.FormatUint(orderA.Sequence, 10), strconv.FormatUint(orderB.Sequence, 10))
+		}
+	}
+	return diffs
+}
+
+// positions returns where each order is in level, by UUID.
+func positions(level []Order) map[string]int {
+	positions := make(map[string]int, len(level))
+	for i, order := range level {
+		positions[order.UUID] = i
+	}
+	return positions
+}
+
+// levelsOf groups the orders on side by price, each level in time priority.
+func levelsOf(side Side, orders []Order) map[float64][]Order {
+	levels := make(map[float64][]Order)
+	for _, order := range orders {
+		if order.Side == side {
+			levels[order.LimitPrice] = append(levels[order.LimitPrice], order)
+		}
+	}
+	return levels
+}
+
+func describeLevel(level []Order) string {
+	if len(level) == 0 {
+		return ""
+	}
+	var quantity uint64
+	for _, order := range level {
+		quantity += order.Quantity
+	}
+	return fmt.Sprintf("%s in %d orders", FormatQuantity(quantity, level[0].QuantityScale), len(level))
+}
+
+func describeOrder(order Order) string {
+	return fmt.Sprintf("%s of %s", FormatQuantity(order.Quantity, order.QuantityScale), order.Owner)
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Snapshot captures every order resting on the books, along with the replay
+// markers and sequences the engine has reached, so RestoreSnapshot can put it
+// back exactly as it was. Books are in ticker order.
+func (engine *Engine) Snapshot() Snapshot {
+	snap := Snapshot{
+		TakenAt:  engine.clock.Now(),
+		Markers:  engine.ReplayMarkers(),
+		Sequence: engine.sequence,
+		TradeID:  engine.tradeID,
+	}
+	for _, book := range engine.Books {
+		state := BookState{AssetType: book.Instrument.AssetType, Ticker: book.Instrument.Ticker}
+		book.scanOrders(func(order *Order) {
+			state.Orders = append(state.Orders, *order)
+		})
+		snap.Books = append(snap.Books, state)
+	}
+	slices.SortFunc(snap.Books, func(a, b BookState) int {
+		return strings.Compare(a.Ticker, b.Ticker)
+	})
+	return snap
+}
+
+// RestoreSnapshot rests every order in the snapshot back on its book, keeping
+// its sequence so time priority is unchanged, and picks the engine's sequences
+// and replay markers up from where they were. Nothing is matched, the books
+// were uncrossed when the snapshot was taken.
+//
+// This must be called before any new orders are placed. Commands journaled
+// after the snapshot was taken can then be replayed on top of it.
+func (engine *Engine) RestoreSnapshot(snap Snapshot) error {
+	for _, state := range snap.Books {
+		if _, err := engine.Book(state.AssetType, state.Ticker); err != nil {
+			return fmt.Errorf("unable to restore book %s: %w", state.Ticker, err)
+		}
+		for _, order := range state.Orders {
+			if err := engine.restoreOrder(order); err != nil {
+				return err
+			}
+		}
+	}
+	engine.sequence = max(engine.sequence, snap.Sequence)
+	engine.tradeID = max(engine.tradeID, snap.TradeID)
+	engine.RestoreReplayMarkers(snap.Markers)
+	return nil
+}
+
+// SaveSnapshot writes a snapshot to path, replacing any written before it.
+func SaveSnapshot(path string, snap Snapshot) error {
+	if err := writeFileAtomic(path, snap); err != nil {
+		return fmt.Errorf("unable to save snapshot: %w", err)
+	}
+
+	orders := 0
+	for _, state := range snap.Books {
+		orders += len(state.Orders)
+	}
+	log.Info().Int("books", len(snap.Books)).Int("orders", orders).Str("path", path).Msg("saved snapshot")
+	return nil
+}
+
+// LoadSnapshot reads the snapshot last written to path by SaveSnapshot.
+func LoadSnapshot(path string) (Snapshot, error) {
+	var snap Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, fmt.Errorf("unable to load snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("unable to load snapshot: %w", err)
+	}
+	return snap, nil
+}
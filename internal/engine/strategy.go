@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"errors"
+	"math/bits"
+
+	. "fenrir/internal/common"
+)
+
+var ErrStrategyLimitNotReached = Reject(RejectInsufficientLiquidity, errors.New("strategy limit price not reached"))
+
+// RegisterStrategy adds a strategy instrument, and the book its orders rest on,
+// to the engine. It needs two or more legs, each a different instrument traded
+// in the strategy's asset type, and is priced to the finest of their ticks.
+func (engine *Engine) RegisterStrategy(strategy Strategy) error {
+	if !engine.assets[strategy.AssetType] {
+		return ErrUnsupportedAsset
+	}
+	if len(strategy.Legs) < 2 {
+		return ErrInvalidStrategy
+	}
+	if _, ok := engine.Instruments[strategy.Ticker]; ok {
+		return ErrInstrumentExists
+	}
+
+	seen := make(map[string]bool)
+	inst := Instrument{Ticker: strategy.Ticker, AssetType: strategy.AssetType}
+	for _, leg := range strategy.Legs {
+		if leg.Ratio == 0 || !leg.Side.Valid() || seen[leg.Ticker] || leg.Ticker == strategy.Ticker {
+			return ErrInvalidStrategy
+		}
+		seen[leg.Ticker] = true
+		// Legs must be traded on books of their own, not be synthetic.
+		if _, ok := engine.Baskets[leg.Ticker]; ok {
+			return ErrInvalidStrategy
+		}
+		if _, ok := engine.Strategies[leg.Ticker]; ok {
+			return ErrInvalidStrategy
+		}
+		book, err := engine.Book(strategy.AssetType, leg.Ticker)
+		if err != nil {
+			return err
+		}
+		inst.PriceScale = max(inst.PriceScale, book.Instrument.PriceScale)
+	}
+
+	if err := engine.RegisterInstrument(inst); err != nil {
+		return err
+	}
+	engine.Strategies[strategy.Ticker] = strategy
+	return nil
+}
+
+// placeStrategyOrder places an order on a strategy, wherever it gets the best
+// net price. It either trades against strategy orders on the strategy's book,
+// resting there if not filled, or is implied against the legs' books, trading
+// every leg in full or none of them.
+//
+// Orders are only implied against the legs as they arrive, once resting they
+// are matched by later strategy orders alone.
+func (engine *Engine) placeStrategyOrder(strategy Strategy, book *OrderBook, order Order) error {
+	if order.OrderType == LimitOrder && !book.Instrument.ValidPrice(order.LimitPrice) {
+		return ErrInvalidPricePrecision
+	}
+
+	legs, implied, err := engine.planStrategyOrder(strategy, order)
+	if err == nil && !book.betterThanImplied(order, implied) {
+		var errs []error
+		for _, leg := range legs {
+			if err := leg.book.PlaceOrder(leg.order); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return book.PlaceOrder(order)
+}
+
+// planStrategyOrder runs the checks for implying a strategy order against its
+// legs' books, returning the order to send to each leg, and the net price per
+// unit they trade at, if every leg can be filled in full within the order's
+// limit. Nothing is executed.
+func (engine *Engine) planStrategyOrder(strategy Strategy, order Order) ([]basketLeg, float64, error) {
+	legs := make([]basketLeg, 0, len(strategy.Legs))
+	notional := 0.0
+	for _, leg := range strategy.Legs {
+		hi, quantity := bits.Mul64(order.Quantity, leg.Ratio)
+		if hi != 0 {
+			return nil, 0, ErrInvalidStrategy
+		}
+		side := leg.Side
+		if order.Side == Sell {
+			side = side.Opposite()
+		}
+
+		book := engine.Books[leg.Ticker]
+		worst, cost, ok := book.sweep(side, quantity)
+		if !ok {
+			return nil, 0, ErrNotEnoughLiquidity
+		}
+		// The net price is of buying the strategy, whichever side the order is.
+		if leg.Side == Buy {
+			notional += cost
+		} else {
+			notional -= cost
+		}
+
+		// As with baskets, each leg is sent as a limit order at the worst
+		// price level the sweep touched, so fills in full and never rests.
+		legOrder := order
+		legOrder.Ticker = book.Instrument.Ticker
+		legOrder.Side = side
+		legOrder.OrderType = LimitOrder
+		legOrder.LimitPrice = worst
+		legOrder.Quantity = quantity
+		legOrder.TotalQuantity = quantity
+		legs = append(legs, basketLeg{book: book, order: legOrder})
+	}
+	if order.Quantity == 0 {
+		return legs, 0, nil
+	}
+
+	unitPrice := notional / float64(order.Quantity)
+	if order.OrderType == LimitOrder &&
+		((order.Side == Buy && unitPrice > order.LimitPrice) ||
+			(order.Side == Sell && unitPrice < order.LimitPrice)) {
+		return nil, 0, ErrStrategyLimitNotReached
+	}
+	return legs, unitPrice, nil
+}
+
+// betterThanImplied returns whether an order would fill in full against the
+// orders resting on the book, at a net price per unit at least as good as
+// implied. Ties go to the book, as its orders were there first.
+func (book *OrderBook) betterThanImplied(order Order, implied float64) bool {
+	worst, notional, ok := book.sweep(order.Side, order.Quantity)
+	if !ok || order.Quantity == 0 {
+		return false
+	}
+	if order.OrderType == LimitOrder &&
+		((order.Side == Buy && worst > order.LimitPrice) ||
+			(order.Side == Sell && worst < order.LimitPrice)) {
+		return false
+	}
+	unitPrice := notional / float64(order.Quantity)
+	if order.Side == Buy {
+		return unitPrice <= implied
+	}
+	return unitPrice >= implied
+}
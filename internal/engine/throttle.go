@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSymbolThrottled = Reject(RejectThrottled, errors.New("symbol throttled"))
+)
+
+// Default per-priority queue depths at which a book starts rejecting commands.
+// Cancels are never throttled by default, they only ever take risk off the book.
+var DefaultThrottleThresholds = [NumCommandPriorities]int{
+	QueryPriority:    4,
+	NewOrderPriority: 8,
+	CancelPriority:   0,
+}
+
+// DefaultCommandInterval is how long a command is assumed to take to handle,
+// for retry hints, until the engine has been backed up long enough to measure.
+const DefaultCommandInterval = time.Millisecond
+
+// Throttle tracks the number of commands queued for each book and rejects new
+// ones, lowest priority first, once a book's queue grows too deep.
+//
+// A book is considered stressed from the moment it first rejects anything until
+// its queue drains back under half of the lowest threshold. Transitions are
+// published via the engine's reporter.
+//
+// Every book is handled in turn by the one goroutine, so while anything is
+// queued the time between releases is how long a command takes to handle. Its
+// moving average is what retry hints are worked out from.
+type Throttle struct {
+	lock        sync.Mutex
+	thresholds  [NumCommandPriorities]int // 0 means never throttled
+	depth       map[string]int
+	stressed    map[string]bool
+	queued      int           // Across every book
+	interval    time.Duration // Average time to handle a command, 0 until measured
+	lastRelease time.Time
+	backedUp    bool // Whether anything was still queued at the last release
+}
+
+func NewThrottle(thresholds [NumCommandPriorities]int) *Throttle {
+	return &Throttle{
+		thresholds: thresholds,
+		depth:      make(map[string]int),
+		stressed:   make(map[string]bool),
+	}
+}
+
+// stressLevel is the lowest non-zero threshold, i.e. when we first throttle.
+func (throttle *Throttle) stressLevel() int {
+	level := 0
+	for _, threshold := range throttle.thresholds {
+		if threshold > 0 && (level == 0 || threshold < level) {
+			level = threshold
+		}
+	}
+	return level
+}
+
+// admit accounts for a new command on the ticker's queue. Returns whether the
+// command was admitted and, if the symbol status changed, the new status.
+func (throttle *Throttle) admit(ticker string, priority CommandPriority) (bool, SymbolStatus, bool) {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	threshold := 0
+	if priority >= 0 && priority < NumCommandPriorities {
+		threshold = throttle.thresholds[priority]
+	}
+
+	if threshold > 0 && throttle.depth[ticker] >= threshold {
+		if !throttle.stressed[ticker] {
+			throttle.stressed[ticker] = true
+			return false, SymbolStressed, true
+		}
+		return false, SymbolStressed, false
+	}
+	throttle.depth[ticker]++
+	throttle.queued++
+	return true, SymbolNormal, false
+}
+
+// sample folds the time taken to handle a command into the average.
+func (throttle *Throttle) sample(took time.Duration) {
+	if took <= 0 {
+		return
+	}
+	if throttle.interval == 0 {
+		throttle.interval = took
+		return
+	}
+	throttle.interval += (took - throttle.interval) / 8
+}
+
+// budget works out what more the ticker's book will take. A book's commands
+// are handled in turn with every other book's, so before it admits a command
+// it is at the threshold for, it is expected to wait for its share of the
+// whole queue to be handled.
+func (throttle *Throttle) budget(ticker string) ThrottleBudget {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	interval := throttle.interval
+	if interval == 0 {
+		interval = DefaultCommandInterval
+	}
+	depth := throttle.depth[ticker]
+
+	var budget ThrottleBudget
+	for priority, threshold := range throttle.thresholds {
+		switch {
+		case threshold == 0:
+			budget.Remaining[priority] = -1
+		case depth < threshold:
+			budget.Remaining[priority] = threshold - depth
+		default:
+			excess := depth - threshold + 1
+			ahead := (excess*throttle.queued + depth - 1) / depth
+			budget.RetryAfter[priority] = time.Duration(ahead) * interval
+		}
+	}
+	return budget
+}
+
+// release accounts for a command having been handled at now. Returns the new
+// symbol status if it changed.
+func (throttle *Throttle) release(ticker string, now time.Time) (SymbolStatus, bool) {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	if throttle.backedUp {
+		throttle.sample(now.Sub(throttle.lastRelease))
+	}
+	if throttle.depth[ticker] > 0 {
+		throttle.depth[ticker]--
+		throttle.queued--
+	}
+	throttle.lastRelease = now
+	throttle.backedUp = throttle.queued > 0
+
+	if throttle.depth[ticker] == 0 {
+		delete(throttle.depth, ticker)
+	}
+
+	if throttle.stressed[ticker] && throttle.depth[ticker] < throttle.stressLevel()/2+1 {
+		delete(throttle.stressed, ticker)
+		return SymbolNormal, true
+	}
+	return SymbolNormal, false
+}
+
+// SetThrottleThresholds replaces the per-priority queue depths at which books
+// throttle incoming commands.
+func (engine *Engine) SetThrottleThresholds(thresholds [NumCommandPriorities]int) {
+	engine.throttle.lock.Lock()
+	defer engine.throttle.lock.Unlock()
+	engine.throttle.thresholds = thresholds
+}
+
+// Admit must be called before a command for ticker is queued for the engine. If
+// the ticker's book is backed up, lower priority commands are rejected with
+// ErrSymbolThrottled. Every admitted command must be followed by a Release.
+//
+// Admit and Release are safe to call concurrently with each other, unlike the
+// rest of the engine.
+func (engine *Engine) Admit(ticker string, priority CommandPriority) error {
+	admitted, status, changed := engine.throttle.admit(ticker, priority)
+	if changed {
+		engine.publishSymbolStatus(ticker, status)
+	}
+	if !admitted {
+		return ErrSymbolThrottled
+	}
+	return nil
+}
+
+// Release marks a previously admitted command for ticker as handled.
+func (engine *Engine) Release(ticker string) {
+	if status, changed := engine.throttle.release(ticker, engine.clock.Now()); changed {
+		engine.publishSymbolStatus(ticker, status)
+	}
+}
+
+// ThrottleBudget returns how much more ticker's book will take before it
+// throttles, and when it is expected to take more of what it throttles. Like
+// Admit, it is safe to call concurrently.
+func (engine *Engine) ThrottleBudget(ticker string) ThrottleBudget {
+	return engine.throttle.budget(ticker)
+}
+
+func (engine *Engine) publishSymbolStatus(ticker string, status SymbolStatus) {
+	log.Warn().
+		Str("ticker", ticker).
+		Int("status", int(status)).
+		Msg("symbol status changed")
+	if engine.reporter == nil {
+		return
+	}
+	if err := engine.reporter.ReportSymbolStatus(ticker, status); err != nil {
+		log.Error().Err(err).Str("ticker", ticker).Msg("unable to publish symbol status")
+	}
+}
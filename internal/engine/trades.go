@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"slices"
+
+	. "fenrir/internal/common"
+)
+
+// DefaultRetainedTrades is how many of the latest trades the engine keeps in
+// memory once they are recorded elsewhere, see SetTradeRecorder.
+const DefaultRetainedTrades = 10000
+
+// A TradeRecorder keeps every trade for good, see tradestore. RecordTrade is
+// called synchronously from the matching path, so must not block.
+type TradeRecorder interface {
+	RecordTrade(trade TradeRecord)
+}
+
+// TradeRecorders records every trade with each recorder in turn.
+type TradeRecorders []TradeRecorder
+
+func (recorders TradeRecorders) RecordTrade(trade TradeRecord) {
+	for _, recorder := range recorders {
+		recorder.RecordTrade(trade)
+	}
+}
+
+// SetTradeRecorder has every trade recorded from now on. Trades kept elsewhere
+// need not all be kept in memory too, so only the latest retain are, enough to
+// answer for recent trades and orders recently filled. Zero keeps them all.
+func (engine *Engine) SetTradeRecorder(recorder TradeRecorder, retain int) {
+	engine.tradeRecorder = recorder
+	engine.retainTrades = retain
+}
+
+// QueryTrades picks out trades still kept in memory, see SetTradeRecorder.
+func (engine *Engine) QueryTrades(query TradeQuery) []TradeRecord {
+	var trades []TradeRecord
+	for i := len(engine.Trades) - 1; i >= 0 && (query.Limit == 0 || len(trades) < query.Limit); i-- {
+		if trade := engine.Trades[i].Record(); query.Matches(trade) {
+			trades = append(trades, trade)
+		}
+	}
+	slices.Reverse(trades)
+	return trades
+}
+
+// recordTrade passes the trade on to the recorder, if there is one, and lets go
+// of trades it no longer needs to keep. Trades are let go of in bulk, once
+// twice as many as are kept have built up, so it costs next to nothing per
+// trade.
+func (engine *Engine) recordTrade(trade Trade) {
+	if engine.tradeRecorder == nil {
+		return
+	}
+	engine.tradeRecorder.RecordTrade(trade.Record())
+
+	if keep := engine.retainTrades; keep > 0 && len(engine.Trades) >= 2*keep {
+		engine.Trades = slices.Clone(engine.Trades[len(engine.Trades)-keep:])
+	}
+}
@@ -0,0 +1,251 @@
+// Package events streams order lifecycle events and trades out of the exchange
+// to external systems, such as risk, surveillance and analytics, over NATS or
+// Kafka.
+//
+// Every message is a single JSON object. Its "schema" is the version of the
+// layout below, bumped whenever a field changes meaning or goes away, never
+// for fields added. Times are RFC 3339 with nanoseconds, quantities decimal
+// strings in whole units to the instrument's scale (so "0.50000000" of a coin
+// traded in hundred millionths) and prices numbers. Fields which do not apply
+// are left out.
+//
+// Order events, on the orders topic of the order's asset type and keyed by its
+// symbol, are the audit trail as it is written:
+//
+//	schema              1
+//	type                "order"
+//	event               "new", "trade", "cancel" or "killSwitch"
+//	seq                 audit sequence, increasing across every order event of a run
+//	ts                  when it happened
+//	orderId             order uuid
+//	clOrdId             client order id, if the client gave one
+//	owner               the order's owner, or the admin pulling a kill switch
+//	symbol, assetType   "equities" or "crypto"
+//	side                "buy" or "sell"
+//	orderType           "limit" or "market"
+//	tif                 "day" or "gtc"
+//	limitPrice, qty     qty is the order's size for new orders, the matched
+//	                    size for trades and what was left for cancels
+//	orderSeq            time priority assigned by the sequencer
+//	clientTs, gatewayTs when the client sent it and the gateway received it
+//	tradeId, price      trades only, one event is sent for each side
+//	counterpartyOrderId
+//	aggressor           whether this side took liquidity
+//	manual              true of trades booked by an admin rather than matched
+//	cancelReason        cancels only: "requested", "adminCancelled",
+//	                    "erroneousOrder", "riskBreach", "regulatory",
+//	                    "brokerCancelled", "killSwitch" or "shutdown"
+//
+// A kill switch is not of any one order, so is sent on the orders topic of
+// every asset type, unkeyed, ahead of the cancels it caused.
+//
+// Trades, on the trades topic of their asset type and keyed by symbol, are a
+// single event with both parties:
+//
+//	schema       1
+//	type         "trade"
+//	tradeId      engine assigned, starting over when the engine does
+//	ts, symbol, assetType, price, qty
+//	aggressor    the taker's side, "buy" or "sell"
+//	taker, takerOrderId, maker, makerOrderId
+//	manual       true if booked by an admin rather than matched, the buyer
+//	             standing as taker
+package events
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schema is the version of the message layout, see the package doc.
+const Schema = 1
+
+var ErrInvalidTopics = errors.New("invalid event topics")
+
+// Topics are where one asset type's events are published.
+type Topics struct {
+	Orders string
+	Trades string
+}
+
+// DefaultTopics returns the topics each asset type is published on unless
+// told otherwise, fenrir.<asset type>.orders and .trades.
+func DefaultTopics() map[AssetType]Topics {
+	topics := make(map[AssetType]Topics)
+	for assetType, name := range assetTypeNames {
+		topics[assetType] = Topics{
+			Orders: "fenrir." + name + ".orders",
+			Trades: "fenrir." + name + ".trades",
+		}
+	}
+	return topics
+}
+
+// ParseTopics parses comma-separated assetType:orders:trades topics, e.g.
+// "crypto:coins.orders:coins.trades", over the defaults.
+func ParseTopics(spec string) (map[AssetType]Topics, error) {
+	topics := DefaultTopics()
+	if spec == "" {
+		return topics, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("%w %q, expected assetType:orders:trades", ErrInvalidTopics, entry)
+		}
+		assetType, ok := assetTypesByName[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w %q, unknown asset type", ErrInvalidTopics, entry)
+		}
+		topics[assetType] = Topics{Orders: fields[1], Trades: fields[2]}
+	}
+	return topics, nil
+}
+
+// orderMessage is the layout of an order event, see the package doc.
+type orderMessage struct {
+	Schema         int     `json:"schema"`
+	Type           string  `json:"type"`
+	Event          string  `json:"event"`
+	Sequence       uint64  `json:"seq"`
+	Timestamp      string  `json:"ts,omitempty"`
+	OrderID        string  `json:"orderId,omitempty"`
+	ClOrdID        uint64  `json:"clOrdId,omitempty"`
+	Owner          string  `json:"owner"`
+	Symbol         string  `json:"symbol,omitempty"`
+	AssetType      string  `json:"assetType,omitempty"`
+	Side           string  `json:"side,omitempty"`
+	OrderType      string  `json:"orderType,omitempty"`
+	TimeInForce    string  `json:"tif,omitempty"`
+	LimitPrice     float64 `json:"limitPrice,omitempty"`
+	Quantity       string  `json:"qty,omitempty"`
+	OrderSequence  uint64  `json:"orderSeq,omitempty"`
+	ClientTs       string  `json:"clientTs,omitempty"`
+	GatewayTs      string  `json:"gatewayTs,omitempty"`
+	TradeID        uint64  `json:"tradeId,omitempty"`
+	Price          float64 `json:"price,omitempty"`
+	CounterpartyID string  `json:"counterpartyOrderId,omitempty"`
+	Aggressor      bool    `json:"aggressor,omitempty"`
+	Manual         bool    `json:"manual,omitempty"`
+	CancelReason   string  `json:"cancelReason,omitempty"`
+}
+
+// tradeMessage is the layout of a trade, see the package doc.
+type tradeMessage struct {
+	Schema       int     `json:"schema"`
+	Type         string  `json:"type"`
+	TradeID      uint64  `json:"tradeId"`
+	Timestamp    string  `json:"ts"`
+	Symbol       string  `json:"symbol"`
+	AssetType    string  `json:"assetType"`
+	Price        float64 `json:"price"`
+	Quantity     string  `json:"qty"`
+	Aggressor    string  `json:"aggressor"`
+	Taker        string  `json:"taker"`
+	TakerOrderID string  `json:"takerOrderId"`
+	Maker        string  `json:"maker"`
+	MakerOrderID string  `json:"makerOrderId"`
+	Manual       bool    `json:"manual,omitempty"`
+}
+
+func newOrderMessage(event AuditEvent) orderMessage {
+	msg := orderMessage{
+		Schema:         Schema,
+		Type:           "order",
+		Event:          eventNames[event.Type],
+		Sequence:       event.Sequence,
+		OrderID:        event.OrderUUID,
+		ClOrdID:        event.ClOrdID,
+		Owner:          event.Owner,
+		Symbol:         event.Ticker,
+		AssetType:      assetTypeNames[event.AssetType],
+		Side:           sideNames[event.Side],
+		OrderType:      orderTypeNames[event.OrderType],
+		TimeInForce:    tifNames[event.TimeInForce],
+		LimitPrice:     event.LimitPrice,
+		Quantity:       FormatQuantity(event.Quantity, event.QuantityScale),
+		OrderSequence:  event.OrderSequence,
+		ClientTs:       timestamp(event.ClientTimestamp),
+		GatewayTs:      timestamp(event.GatewayTimestamp),
+		TradeID:        event.TradeID,
+		Price:          event.Price,
+		CounterpartyID: event.CounterpartyUUID,
+		Aggressor:      event.Aggressor,
+		Manual:         event.TradeType == ManualTrade,
+	}
+
+	switch event.Type {
+	case NewOrderEvent:
+		msg.Timestamp = timestamp(event.SequencerTimestamp)
+	case TradeEvent:
+		msg.Timestamp = timestamp(event.MatchTimestamp)
+	case CancelEvent:
+		msg.Timestamp = timestamp(event.Timestamp)
+		msg.CancelReason = cancelReasonNames[event.CancelReason]
+	case KillSwitchEvent:
+		// Of no order at all.
+		msg = orderMessage{
+			Schema:    Schema,
+			Type:      "order",
+			Event:     eventNames[event.Type],
+			Sequence:  event.Sequence,
+			Timestamp: timestamp(event.Timestamp),
+			Owner:     event.Owner,
+		}
+	}
+	return msg
+}
+
+func newTradeMessage(trade TradeRecord) tradeMessage {
+	return tradeMessage{
+		Schema:       Schema,
+		Type:         "trade",
+		TradeID:      trade.ID,
+		Timestamp:    timestamp(trade.Timestamp),
+		Symbol:       trade.Ticker,
+		AssetType:    assetTypeNames[trade.AssetType],
+		Price:        trade.Price,
+		Quantity:     FormatQuantity(trade.Quantity, trade.QuantityScale),
+		Aggressor:    sideNames[trade.Aggressor],
+		Taker:        trade.Taker,
+		TakerOrderID: trade.TakerOrder,
+		Maker:        trade.Maker,
+		MakerOrderID: trade.MakerOrder,
+		Manual:       trade.Type == ManualTrade,
+	}
+}
+
+var (
+	assetTypeNames   = map[AssetType]string{Equities: "equities", Crypto: "crypto"}
+	assetTypesByName = map[string]AssetType{"equities": Equities, "crypto": Crypto}
+	eventNames       = map[AuditEventType]string{
+		NewOrderEvent:   "new",
+		TradeEvent:      "trade",
+		CancelEvent:     "cancel",
+		KillSwitchEvent: "killSwitch",
+	}
+	sideNames         = map[Side]string{Buy: "buy", Sell: "sell"}
+	orderTypeNames    = map[OrderType]string{LimitOrder: "limit", MarketOrder: "market"}
+	tifNames          = map[TimeInForce]string{Day: "day", GoodTillCancel: "gtc"}
+	cancelReasonNames = map[CancelReason]string{
+		CancelRequested:     "requested",
+		AdminCancelled:      "adminCancelled",
+		AdminErroneousOrder: "erroneousOrder",
+		AdminRiskBreach:     "riskBreach",
+		AdminRegulatory:     "regulatory",
+		BrokerCancelled:     "brokerCancelled",
+		AdminKillSwitch:     "killSwitch",
+		AdminShutdown:       "shutdown",
+	}
+)
+
+// timestamp formats t at nanosecond precision, leaving out times never set.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kafkaTimeout is how long the REST proxy is given to take each topic's share
+// of a batch.
+const kafkaTimeout = 10 * time.Second
+
+// KafkaRESTSink publishes to Kafka through a Kafka REST proxy (the v2 API),
+// keyed so a symbol's events stay in order on a single partition.
+type KafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaREST publishes through the REST proxy at address, e.g.
+// http://localhost:8082.
+func NewKafkaREST(address string) *KafkaRESTSink {
+	return &KafkaRESTSink{
+		url:    strings.TrimRight(address, "/"),
+		client: &http.Client{Timeout: kafkaTimeout},
+	}
+}
+
+type kafkaRecord struct {
+	Key   *string         `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// Publish sends each topic's messages in a single request, topics in the order
+// they first appear in the batch.
+func (sink *KafkaRESTSink) Publish(messages []Message) error {
+	var topics []string
+	byTopic := make(map[string][]kafkaRecord)
+	for _, msg := range messages {
+		if _, ok := byTopic[msg.Topic]; !ok {
+			topics = append(topics, msg.Topic)
+		}
+		record := kafkaRecord{Value: msg.Value}
+		if msg.Key != "" {
+			record.Key = &msg.Key
+		}
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], record)
+	}
+
+	for _, topic := range topics {
+		if err := sink.post(topic, byTopic[topic]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *KafkaRESTSink) post(topic string, records []kafkaRecord) error {
+	body, err := json.Marshal(kafkaRecords{Records: records})
+	if err != nil {
+		return err
+	}
+	resp, err := sink.client.Post(
+		sink.url+"/topics/"+url.PathEscape(topic),
+		"application/vnd.kafka.json.v2+json",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka rest proxy answered %s: %s", resp.Status, bytes.TrimSpace(reason))
+	}
+	return nil
+}
+
+func (sink *KafkaRESTSink) Close() error {
+	sink.client.CloseIdleConnections()
+	return nil
+}
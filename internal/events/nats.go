@@ -0,0 +1,133 @@
+package events
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// natsTimeout is how long connecting to NATS, or sending it a batch, may take.
+const natsTimeout = 5 * time.Second
+
+var ErrNATSRefused = errors.New("nats refused the connection")
+
+// NATSSink publishes to NATS core, topics being subjects. It speaks the plain
+// text client protocol itself, redialling on the next batch if the connection
+// drops. NATS has no keys, so they are not sent.
+type NATSSink struct {
+	address string
+	lock    sync.Mutex // Held writing to conn, which the reader answers pings on
+	conn    net.Conn
+	w       *bufio.Writer
+}
+
+// DialNATS connects to the NATS server at address (host:port).
+func DialNATS(address string) (*NATSSink, error) {
+	sink := &NATSSink{address: address}
+	if err := sink.connect(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// connect dials the server and waits for it to accept the connection, then
+// leaves a goroutine answering its pings.
+func (sink *NATSSink) connect() error {
+	conn, err := net.DialTimeout("tcp", sink.address, natsTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+
+	// The server speaks first, then a ping is only answered once the CONNECT
+	// ahead of it has been accepted.
+	line, err := r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO") {
+		err = fmt.Errorf("%w: %s", ErrNATSRefused, strings.TrimSpace(line))
+	}
+	if err == nil {
+		_, err = conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"fenrir\"}\r\nPING\r\n"))
+	}
+	if err == nil {
+		line, err = r.ReadString('\n')
+	}
+	if err == nil && !strings.HasPrefix(line, "PONG") {
+		err = fmt.Errorf("%w: %s", ErrNATSRefused, strings.TrimSpace(line))
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	sink.conn = conn
+	sink.w = bufio.NewWriter(conn)
+	go sink.read(conn, r)
+	return nil
+}
+
+// read answers the server's pings, so it keeps the connection open, until the
+// connection drops.
+func (sink *NATSSink) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			sink.lock.Lock()
+			if sink.conn == conn {
+				sink.w.WriteString("PONG\r\n")
+				sink.w.Flush()
+			}
+			sink.lock.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Error().Str("error", strings.TrimSpace(line)).Msg("nats error")
+		}
+	}
+}
+
+func (sink *NATSSink) Publish(messages []Message) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.conn == nil {
+		if err := sink.connect(); err != nil {
+			return err
+		}
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(natsTimeout))
+	for _, msg := range messages {
+		fmt.Fprintf(sink.w, "PUB %s %d\r\n", msg.Topic, len(msg.Value))
+		sink.w.Write(msg.Value)
+		sink.w.WriteString("\r\n")
+	}
+	if err := sink.w.Flush(); err != nil {
+		// Dialled again for the next batch.
+		sink.conn.Close()
+		sink.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (sink *NATSSink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
@@ -0,0 +1,178 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultBuffer is how many events a Publisher holds waiting to be sent by
+// default.
+const DefaultBuffer = 64 * 1024
+
+// maxBatch is the most events sent to the sink at once.
+const maxBatch = 1024
+
+var ErrUnsupportedSink = errors.New("unsupported event sink")
+
+// Message is a single event as it is sent.
+type Message struct {
+	Topic string
+	Key   string // Empty if unkeyed
+	Value []byte // JSON, see the package doc
+}
+
+// A Sink sends events on to a message broker. It is only used from the
+// publisher's own goroutine.
+type Sink interface {
+	// Publish sends a batch of messages, in order.
+	Publish(messages []Message) error
+	Close() error
+}
+
+// Open connects to the broker at address: nats://host:port for NATS, or the
+// http(s) URL of a Kafka REST proxy for Kafka.
+func Open(address string) (Sink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "nats":
+		return DialNATS(u.Host)
+	case "http", "https":
+		return NewKafkaREST(address), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedSink, address)
+}
+
+// pending is an event waiting to be sent, encoded on the publisher's
+// goroutine rather than the matching path.
+type pending struct {
+	topic string
+	key   string
+	event any
+}
+
+// Publisher streams order events and trades to a sink in the background, so
+// matching never waits on the broker. It is an engine.Auditor and
+// engine.TradeRecorder. Events are sent in batches of whatever has built up
+// while the last batch was being sent. If the broker falls so far behind the
+// buffer fills, events are dropped rather than holding up matching, the audit
+// trail still has them.
+type Publisher struct {
+	sink    Sink
+	topics  map[AssetType]Topics
+	events  chan pending
+	done    chan struct{}
+	dropped atomic.Uint64 // Never sent, as the buffer was full or sending failed
+
+	// Events recorded once closed, by whatever is still winding down, are
+	// dropped.
+	lock   sync.RWMutex
+	closed bool
+}
+
+func NewPublisher(sink Sink, topics map[AssetType]Topics, buffer int) *Publisher {
+	p := &Publisher{
+		sink:   sink,
+		topics: topics,
+		events: make(chan pending, buffer),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// RecordAuditEvent queues an order event to be sent, see engine.Auditor.
+func (p *Publisher) RecordAuditEvent(event AuditEvent) {
+	msg := newOrderMessage(event)
+	if event.Type == KillSwitchEvent {
+		for _, assetType := range slices.Sorted(maps.Keys(p.topics)) {
+			p.queue(pending{topic: p.topics[assetType].Orders, event: msg})
+		}
+		return
+	}
+	if topics, ok := p.topics[event.AssetType]; ok {
+		p.queue(pending{topic: topics.Orders, key: event.Ticker, event: msg})
+	}
+}
+
+// RecordTrade queues a trade to be sent, see engine.TradeRecorder.
+func (p *Publisher) RecordTrade(trade TradeRecord) {
+	if topics, ok := p.topics[trade.AssetType]; ok {
+		p.queue(pending{topic: topics.Trades, key: trade.Ticker, event: newTradeMessage(trade)})
+	}
+}
+
+func (p *Publisher) queue(event pending) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return
+	}
+	select {
+	case p.events <- event:
+	default:
+		p.dropped.Add(1)
+		log.Error().Str("topic", event.topic).Msg("event publisher behind, event not sent")
+	}
+}
+
+// Dropped returns how many events have not been sent.
+func (p *Publisher) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Close sends whatever events are still queued, then closes the sink. Events
+// recorded after it is called are dropped.
+func (p *Publisher) Close() error {
+	p.lock.Lock()
+	p.closed = true
+	close(p.events)
+	p.lock.Unlock()
+
+	<-p.done
+	return p.sink.Close()
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	batch := make([]Message, 0, maxBatch)
+	for event := range p.events {
+		batch = append(batch[:0], p.encode(event))
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case event, ok := <-p.events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, p.encode(event))
+			default:
+				break drain
+			}
+		}
+
+		if err := p.sink.Publish(batch); err != nil {
+			p.dropped.Add(uint64(len(batch)))
+			log.Error().Err(err).Int("events", len(batch)).Msg("unable to publish events")
+		}
+	}
+}
+
+func (p *Publisher) encode(event pending) Message {
+	// Neither layout has anything which fails to encode.
+	value, _ := json.Marshal(event.event)
+	return Message{Topic: event.topic, Key: event.key, Value: value}
+}
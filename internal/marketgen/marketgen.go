@@ -0,0 +1,310 @@
+// Package marketgen generates pseudo-random order flow which is the same for
+// the same seed, so tests, benchmarks and simulations can be compared from run
+// to run.
+package marketgen
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidConfig = errors.New("invalid market generator config")
+
+// Defaults for whatever a Config leaves out.
+const (
+	DefaultIntensity    = 100.0 // Orders a second
+	DefaultParticipants = 10
+	DefaultStartPrice   = 100.0
+	DefaultVolatility   = 0.2 // A year, as a fraction of the price
+	DefaultTickSize     = 0.01
+	DefaultDepthTicks   = 5
+	DefaultMaxQuantity  = 100
+	DefaultCancelRatio  = 0.3
+	DefaultMarketRatio  = 0.05
+)
+
+// DefaultTicker is the symbol traded if a Config names none.
+const DefaultTicker = "TEST"
+
+// How many of its own orders the generator remembers, to cancel.
+const maxResting = 1024
+
+// Config shapes the flow a Generator makes. Anything left zero is defaulted.
+type Config struct {
+	Seed      uint64
+	Tickers   []string
+	AssetType AssetType
+	// Simulated time the flow starts at, the Unix epoch if zero.
+	Epoch time.Time
+	// Orders and cancels a second of simulated time, on average. Arrivals are
+	// Poisson, so come in bursts and lulls.
+	Intensity float64
+	// How many owners the flow comes from, named trader-001 on.
+	Participants int
+	StartPrice   float64
+	// Expected return and volatility of each symbol's price over a year, as
+	// fractions. Prices follow a geometric Brownian motion.
+	Drift      float64
+	Volatility float64
+	TickSize   float64
+	// How many ticks away from the price limit orders rest, on average. Some
+	// cross it by a tick, and trade.
+	DepthTicks  float64
+	MaxQuantity uint64
+	// Fractions of events cancelling a resting order, and of new orders
+	// being market orders. Below zero for none at all.
+	CancelRatio float64
+	MarketRatio float64
+}
+
+// ParseConfig reads a generator config from comma-separated key=value pairs,
+// e.g. seed=7,tickers=AAPL|MSFT,intensity=500,drift=0.05,participants=20.
+// Keys are seed, tickers, intensity, participants, price, drift, volatility,
+// tick, depth, maxqty, cancels and markets.
+func ParseConfig(spec string) (Config, error) {
+	var config Config
+	if spec == "" {
+		return config, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("%w: %q, expected key=value", ErrInvalidConfig, field)
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "seed":
+			config.Seed, err = strconv.ParseUint(value, 10, 64)
+		case "tickers":
+			config.Tickers = strings.Split(value, "|")
+		case "intensity":
+			config.Intensity, err = strconv.ParseFloat(value, 64)
+		case "participants":
+			config.Participants, err = strconv.Atoi(value)
+		case "price":
+			config.StartPrice, err = strconv.ParseFloat(value, 64)
+		case "drift":
+			config.Drift, err = strconv.ParseFloat(value, 64)
+		case "volatility":
+			config.Volatility, err = strconv.ParseFloat(value, 64)
+		case "tick":
+			config.TickSize, err = strconv.ParseFloat(value, 64)
+		case "depth":
+			config.DepthTicks, err = strconv.ParseFloat(value, 64)
+		case "maxqty":
+			config.MaxQuantity, err = strconv.ParseUint(value, 10, 64)
+		case "cancels":
+			config.CancelRatio, err = strconv.ParseFloat(value, 64)
+		case "markets":
+			config.MarketRatio, err = strconv.ParseFloat(value, 64)
+		default:
+			return Config{}, fmt.Errorf("%w: unknown key %q", ErrInvalidConfig, key)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, key, err)
+		}
+	}
+	return config, nil
+}
+
+// withDefaults fills in whatever config leaves out.
+func (config Config) withDefaults() Config {
+	if len(config.Tickers) == 0 {
+		config.Tickers = []string{DefaultTicker}
+	}
+	if config.Epoch.IsZero() {
+		config.Epoch = time.Unix(0, 0).UTC()
+	}
+	if config.Intensity <= 0 {
+		config.Intensity = DefaultIntensity
+	}
+	if config.Participants <= 0 {
+		config.Participants = DefaultParticipants
+	}
+	if config.StartPrice <= 0 {
+		config.StartPrice = DefaultStartPrice
+	}
+	if config.Volatility <= 0 {
+		config.Volatility = DefaultVolatility
+	}
+	if config.TickSize <= 0 {
+		config.TickSize = DefaultTickSize
+	}
+	if config.DepthTicks <= 0 {
+		config.DepthTicks = DefaultDepthTicks
+	}
+	if config.MaxQuantity == 0 {
+		config.MaxQuantity = DefaultMaxQuantity
+	}
+	if config.CancelRatio == 0 {
+		config.CancelRatio = DefaultCancelRatio
+	}
+	if config.MarketRatio == 0 {
+		config.MarketRatio = DefaultMarketRatio
+	}
+	return config
+}
+
+// Generator makes a stream of commands for the engine: orders placed and
+// cancelled by a crowd of participants around a price which wanders. Two
+// generators with the same config make the same stream. It is not safe for
+// concurrent use.
+type Generator struct {
+	config   Config
+	rng      *rand.Rand
+	now      time.Time
+	prices   map[string]float64 // Each ticker's current price
+	sequence uint64             // Of the last command generated
+	sessions map[string]uint64  // Last message sequence of each owner
+	resting  []Command          // Orders placed which may still rest, oldest first
+}
+
+func New(config Config) *Generator {
+	config = config.withDefaults()
+	generator := &Generator{
+		config:   config,
+		rng:      rand.New(rand.NewPCG(config.Seed, config.Seed)),
+		now:      config.Epoch,
+		prices:   make(map[string]float64),
+		sessions: make(map[string]uint64),
+	}
+	for _, ticker := range config.Tickers {
+		generator.prices[ticker] = config.StartPrice
+	}
+	return generator
+}
+
+// Now is the simulated time of the last command generated.
+func (generator *Generator) Now() time.Time {
+	return generator.now
+}
+
+// Price is ticker's price as of the last command generated.
+func (generator *Generator) Price(ticker string) float64 {
+	return generator.prices[ticker]
+}
+
+// Next generates the next command, numbered, timestamped and attributed to
+// its owner's session as if journaled. Replaying commands with engine.Replay
+// applies them on the generator's clock, so the books come out the same every
+// time. Cancels may be of orders since filled, and are then rejected.
+func (generator *Generator) Next() Command {
+	config := generator.config
+	// Time to the next arrival is exponentially distributed.
+	dt := generator.rng.ExpFloat64() / config.Intensity
+	generator.now = generator.now.Add(time.Duration(dt * float64(time.Second)))
+	generator.move(dt)
+
+	generator.sequence++
+	var cmd Command
+	if len(generator.resting) > 0 && generator.rng.Float64() < config.CancelRatio {
+		cmd = generator.cancel()
+	} else {
+		cmd = generator.place()
+	}
+	owner := cmd.Owner
+	if cmd.Type == PlaceOrderCommand {
+		owner = cmd.Orders[0].Owner
+	}
+	generator.sessions[owner]++
+	cmd.Sequence = generator.sequence
+	cmd.Time = generator.now
+	cmd.Origin = CommandOrigin{Session: owner, Sequence: generator.sessions[owner]}
+	return cmd
+}
+
+// Generate returns the next n commands.
+func (generator *Generator) Generate(n int) []Command {
+	cmds := make([]Command, n)
+	for i := range cmds {
+		cmds[i] = generator.Next()
+	}
+	return cmds
+}
+
+// move walks every price forward dt seconds.
+func (generator *Generator) move(dt float64) {
+	config := generator.config
+	years := dt / (365 * 24 * 60 * 60)
+	for _, ticker := range config.Tickers {
+		shock := generator.rng.NormFloat64() * math.Sqrt(years)
+		generator.prices[ticker] *= math.Exp((config.Drift-config.Volatility*config.Volatility/2)*years + config.Volatility*shock)
+	}
+}
+
+func (generator *Generator) place() Command {
+	config := generator.config
+	ticker := config.Tickers[generator.rng.IntN(len(config.Tickers))]
+	order := Order{
+		UUID:        generator.uuid(),
+		AssetType:   config.AssetType,
+		OrderType:   LimitOrder,
+		TimeInForce: GoodTillCancel,
+		Ticker:      ticker,
+		Side:        Side(generator.rng.IntN(2)),
+		Owner:       fmt.Sprintf("trader-%03d", generator.rng.IntN(config.Participants)+1),
+		Quantity:    generator.rng.Uint64N(config.MaxQuantity) + 1,
+		Timestamp:   generator.now,
+	}
+	order.TotalQuantity = order.Quantity
+
+	if generator.rng.Float64() < config.MarketRatio {
+		order.OrderType = MarketOrder
+		order.TimeInForce = Day
+	} else {
+		// Mostly resting a few ticks back, now and then crossing by one.
+		ticks := math.Round(generator.rng.ExpFloat64()*config.DepthTicks) - 1
+		if order.Side == Sell {
+			ticks = -ticks
+		}
+		price := math.Max(math.Round(generator.prices[ticker]/config.TickSize)-ticks, 1)
+		// Dividing by a whole number of ticks to the unit rounds as a price
+		// written out would, e.g. 100.01 rather than 100.01000000000001.
+		if config.TickSize < 1 {
+			order.LimitPrice = price / math.Round(1/config.TickSize)
+		} else {
+			order.LimitPrice = price * config.TickSize
+		}
+	}
+
+	cmd := Command{Type: PlaceOrderCommand, AssetType: config.AssetType, Orders: []Order{order}}
+	if order.OrderType == LimitOrder {
+		generator.resting = append(generator.resting, cmd)
+		if len(generator.resting) > maxResting {
+			generator.resting = generator.resting[1:]
+		}
+	}
+	return cmd
+}
+
+func (generator *Generator) cancel() Command {
+	i := generator.rng.IntN(len(generator.resting))
+	placed := generator.resting[i]
+	generator.resting = append(generator.resting[:i], generator.resting[i+1:]...)
+	order := placed.Orders[0]
+	return Command{Type: CancelOwnOrderCommand, AssetType: order.AssetType, Owner: order.Owner, UUID: order.UUID}
+}
+
+// uuid draws a UUID from the generator's own randomness, so it is the same
+// every run.
+func (generator *Generator) uuid() string {
+	var bytes [16]byte
+	for i := 0; i < len(bytes); i += 8 {
+		value := generator.rng.Uint64()
+		for j := range 8 {
+			bytes[i+j] = byte(value >> (8 * j))
+		}
+	}
+	// Marked as a version 4 UUID, as uuid.New would make.
+	bytes[6] = bytes[6]&0x0f | 0x40
+	bytes[8] = bytes[8]&0x3f | 0x80
+	return uuid.UUID(bytes).String()
+}
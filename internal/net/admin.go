@@ -0,0 +1,122 @@
+package net
+
+import (
+	"context"
+	"errors"
+	. "fenrir/internal/common"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnknownConnection = errors.New("no such connection")
+)
+
+// SessionInfo is what operators are shown of a connection or session.
+type SessionInfo struct {
+	Address   string `json:"address,omitempty"` // Empty once disconnected
+	Owner     string `json:"owner,omitempty"`   // Empty until logged on
+	Connected bool   `json:"connected"`
+	// Unix nanos the connection was last heard from, while connected, or its
+	// owner disconnected, since.
+	LastSeen       int64 `json:"lastSeen,omitempty"`
+	DisconnectedAt int64 `json:"disconnectedAt,omitempty"`
+}
+
+// Sessions returns every open connection, logged on or not, and every session
+// whose owner has disconnected but may yet resume it, by owner then address.
+func (s *Server) Sessions() []SessionInfo {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	sessions := make([]SessionInfo, 0, len(s.connections)+len(s.clientSessions))
+	for address, session := range s.connections {
+		info := SessionInfo{Address: address, Owner: session.owner, Connected: true}
+		if !session.liveness.LastSeen.IsZero() {
+			info.LastSeen = session.liveness.LastSeen.UnixNano()
+		}
+		sessions = append(sessions, info)
+	}
+	for owner, session := range s.clientSessions {
+		if !session.connected() {
+			sessions = append(sessions, SessionInfo{Owner: owner, DisconnectedAt: session.disconnectedAt.UnixNano()})
+		}
+	}
+	slices.SortFunc(sessions, func(a, b SessionInfo) int {
+		if c := strings.Compare(a.Owner, b.Owner); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Address, b.Address)
+	})
+	return sessions
+}
+
+// Disconnect closes the connection on address, as if the client had. A logged
+// on session is kept for its owner to reconnect to, as after any disconnect.
+func (s *Server) Disconnect(address string) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if _, ok := s.connections[address]; !ok {
+		return ErrUnknownConnection
+	}
+	s.closeConnectionLockFree(address)
+	return nil
+}
+
+// BookManualTrade books quantity lots of ticker at price from seller to buyer,
+// on behalf of admin, see engine.BookManualTrade. Both are sent execution
+// reports of it as of any fill, its trade type telling them it was booked
+// manually. Returns the buyer's and seller's orders, filled by it.
+func (s *Server) BookManualTrade(ctx context.Context, admin, ticker, buyer, seller string, price float64, quantity uint64) ([]Order, error) {
+	// Unknown symbols are refused by the engine.
+	assetType := Equities
+	if inst, ok := s.engine.Instrument(ticker); ok {
+		assetType = inst.AssetType
+	}
+	order := func(owner string, side Side) Order {
+		return Order{
+			UUID:          uuid.New().String(),
+			Ticker:        ticker,
+			Side:          side,
+			LimitPrice:    price,
+			Quantity:      quantity,
+			TotalQuantity: quantity,
+			Timestamp:     s.clock.Now(),
+			Owner:         owner,
+		}
+	}
+	cmd := Command{
+		Type:      ManualTradeCommand,
+		AssetType: assetType,
+		Orders:    []Order{order(buyer, Buy), order(seller, Sell)},
+	}
+
+	var orders []Order
+	var err error
+	callErr := s.call(ctx, func() {
+		s.lastActive = time.Now()
+		orders, err = s.engine.Apply(cmd)
+	})
+	if callErr != nil {
+		return nil, callErr
+	}
+	if err != nil && len(orders) == 0 {
+		return nil, err
+	}
+	// Booked, whether or not both sides could be told.
+	log.Warn().
+		Err(err).
+		Str("admin", admin).
+		Str("ticker", ticker).
+		Str("buyer", buyer).
+		Str("seller", seller).
+		Float64("price", price).
+		Uint64("quantity", quantity).
+		Msg("booked manual trade")
+	return orders, nil
+}
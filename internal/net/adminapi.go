@@ -0,0 +1,439 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidAdminCancel  = errors.New("admin cancel needs exactly one of owner, symbol or uuid")
+	ErrInvalidCancelReason = errors.New("invalid cancel reason")
+	ErrInvalidClientCAs    = errors.New("no client CA certificates found")
+)
+
+// NewAdminAPI serves only the admin endpoints of handleAdmin, on a port of
+// their own, so they can be firewalled off and secured apart from trading, see
+// SetTLS. The REST API should then be kept from serving them, see SetAdmin.
+func NewAdminAPI(address string, port int, server *Server) *API {
+	return &API{
+		address: address,
+		port:    port,
+		server:  server,
+		name:    "admin api",
+		private: true,
+	}
+}
+
+// AdminTLSConfig serves an API with the certificate and key in PEM files. If
+// clientCAFile is given, clients must present a certificate signed by one of
+// the CAs in it, on top of their requests being signed by an admin.
+func AdminTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w in %s", ErrInvalidClientCAs, clientCAFile)
+	}
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
+
+// Admin endpoints of the API, for operators and tooling such as fenrirctl:
+//
+//	POST   /admin/symbols/{symbol}/halt   halt new orders on a symbol, see HaltSymbol
+//	POST   /admin/symbols/{symbol}/resume resume a halted symbol
+//	POST   /admin/status                  change the exchange's status, the body
+//	                                      {"event", "component", "note"} with
+//	                                      event named as in exchangeStatus reports
+//	POST   /admin/phase                   put symbols in a trading phase, the body
+//	                                      {"scope", "phase"} with scope a symbol
+//	                                      or asset type and phase continuous,
+//	                                      preOpen, halted, closed or scheduled,
+//	                                      see Server.SetTradingPhase
+//	DELETE /admin/orders                  cancel every order of ?owner=, on
+//	                                      ?symbol=, or the one order ?uuid=,
+//	                                      for ?reason= (adminCancelled if left out)
+//	GET    /admin/stats                   the server's Stats
+//	GET    /admin/books                   what the books are holding on to,
+//	                                      see Server.BookMetrics
+//	GET    /admin/sessions                every connection and resumable
+//	                                      session, see Server.Sessions
+//	GET    /admin/certifications          the latest certification of each
+//	                                      owner, see Server.SetCertification
+//	DELETE /admin/sessions/{address}      disconnect the client on address
+//	POST   /admin/snapshot                snapshot the books now, see
+//	                                      Server.TriggerSnapshot
+//	GET    /admin/book/{symbol}           the book's depth, ?depth= levels per
+//	                                      side, however deep anyone may see
+//	POST   /admin/trades                  book a manual trade, the body
+//	                                      {"symbol", "buyer", "seller", "price",
+//	                                      "quantity"} with quantity in lots,
+//	                                      see Server.BookManualTrade
+//
+// Requests are authenticated as any other, and refused unless on behalf of an
+// admin. Cancels answer with an openOrder report of each order cancelled,
+// manual trades with one of the buyer's and seller's orders.
+func (api *API) handleAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("POST /admin/symbols/{symbol}/halt", api.haltSymbol)
+	mux.HandleFunc("POST /admin/symbols/{symbol}/resume", api.resumeSymbol)
+	mux.HandleFunc("POST /admin/status", api.updateStatus)
+	mux.HandleFunc("POST /admin/phase", api.setTradingPhase)
+	mux.HandleFunc("DELETE /admin/orders", api.adminCancel)
+	mux.HandleFunc("GET /admin/stats", api.stats)
+	mux.HandleFunc("GET /admin/books", api.bookMetrics)
+	mux.HandleFunc("GET /admin/sessions", api.sessions)
+	mux.HandleFunc("GET /admin/certifications", api.certifications)
+	mux.HandleFunc("DELETE /admin/sessions/{address}", api.disconnect)
+	mux.HandleFunc("POST /admin/snapshot", api.snapshot)
+	mux.HandleFunc("GET /admin/book/{symbol}", api.adminBook)
+	mux.HandleFunc("POST /admin/trades", api.manualTrade)
+}
+
+// admin authenticates whoever the request is on behalf of, who must be an
+// admin.
+func (api *API) admin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner, err := api.owner(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return "", false
+	}
+	api.server.clientSessionsLock.Lock()
+	admin := api.server.admins[owner]
+	api.server.clientSessionsLock.Unlock()
+	if !admin {
+		writeError(w, http.StatusForbidden, ErrNotAdmin)
+		return "", false
+	}
+	return owner, true
+}
+
+func (api *API) haltSymbol(w http.ResponseWriter, r *http.Request) {
+	api.setSymbolStatus(w, r, SymbolHalted, api.server.HaltSymbol)
+}
+
+func (api *API) resumeSymbol(w http.ResponseWriter, r *http.Request) {
+	api.setSymbolStatus(w, r, SymbolNormal, api.server.ResumeSymbol)
+}
+
+func (api *API) setSymbolStatus(w http.ResponseWriter, r *http.Request, status SymbolStatus, set func(ticker string) error) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	ticker, err := jsonTicker(r.PathValue("symbol"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := set(ticker); errors.Is(err, ErrSymbolNotHalted) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	// Failing to tell some session does not undo the change.
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ticker": r.PathValue("symbol"),
+		"status": jsonSymbolStatuses[status],
+	})
+}
+
+func (api *API) updateStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	var body struct {
+		Event     string `json:"event"`
+		Component string `json:"component"`
+		Note      string `json:"note"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_RECV_SIZE)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	update := StatusUpdate{Component: body.Component, Message: body.Note}
+	known := false
+	for event, name := range jsonStatusEvents {
+		// The kill switch is pulled, not set.
+		if name == body.Event && event != StatusKilled {
+			update.Event, known = event, true
+		}
+	}
+	if !known {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: event %q", ErrInvalidStatusEvent, body.Event))
+		return
+	}
+	if err := update.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Failing to tell some session does not undo the change, only the exchange
+	// not being in a state to make it does.
+	err := api.server.UpdateExchangeStatus(update)
+	if errors.Is(err, ErrExchangeNotHalted) || errors.Is(err, ErrComponentNotDegraded) || errors.Is(err, ErrNoMaintenanceScheduled) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	api.status(w, r)
+}
+
+func (api *API) setTradingPhase(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	var body struct {
+		Scope string `json:"scope"`
+		Phase string `json:"phase"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_RECV_SIZE)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	scope, err := ParseCalendarScope(body.Scope)
+	if err == nil && scope.Ticker != "" {
+		scope.Ticker, err = jsonTicker(scope.Ticker)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	phase, known := TradingPhase(0), false
+	for p, name := range jsonTradingPhases {
+		if name == body.Phase {
+			phase, known = p, true
+		}
+	}
+	if !known {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrInvalidTradingPhase, body.Phase))
+		return
+	}
+
+	// Failing to tell some session does not undo the change.
+	if err := api.server.call(r.Context(), func() { api.server.SetTradingPhase(scope, phase) }); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"scope": body.Scope,
+		"phase": body.Phase,
+	})
+}
+
+func (api *API) adminCancel(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	query := r.URL.Query()
+	cmd := Command{Reason: AdminCancelled, Owner: query.Get("owner"), UUID: query.Get("uuid")}
+	given := 0
+	if cmd.Owner != "" {
+		cmd.Type = AdminCancelOwnerCommand
+		given++
+	}
+	if query.Has("symbol") {
+		ticker, err := jsonTicker(query.Get("symbol"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		cmd.Type, cmd.Ticker = AdminCancelSymbolCommand, ticker
+		given++
+	}
+	if cmd.UUID != "" {
+		cmd.Type = AdminCancelOrderCommand
+		given++
+	}
+	if given != 1 {
+		writeError(w, http.StatusBadRequest, ErrInvalidAdminCancel)
+		return
+	}
+	if name := query.Get("reason"); name != "" {
+		known := false
+		for reason, reasonName := range jsonCancelReasons {
+			if reasonName == name && reason != CancelRequested {
+				cmd.Reason, known = reason, true
+			}
+		}
+		if !known {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrInvalidCancelReason, name))
+			return
+		}
+	}
+
+	var cancelled []Order
+	var err error
+	callErr := api.server.call(r.Context(), func() {
+		api.server.lastActive = time.Now()
+		cancelled, err = api.server.engine.Apply(cmd)
+	})
+	if callErr != nil {
+		writeError(w, http.StatusServiceUnavailable, callErr)
+		return
+	}
+	if errors.Is(err, CancelRejectUnknownOrder) || err != nil && RejectReasonOf(err) == RejectUnknownSymbol {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeOrders(w, cancelled)
+}
+
+// writeOrders answers with an openOrder report of each order.
+func writeOrders(w http.ResponseWriter, orders []Order) {
+	var buf []byte
+	for _, order := range orders {
+		report, err := generateWireOpenOrderReport(order)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		buf = append(buf, report...)
+	}
+	reports, err := JSONReports(buf, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if reports == nil {
+		reports = []map[string]any{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (api *API) stats(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, api.server.Stats())
+}
+
+func (api *API) bookMetrics(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	metrics, err := api.server.BookMetrics(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+func (api *API) sessions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, api.server.Sessions())
+}
+
+func (api *API) certifications(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, api.server.Certifications())
+}
+
+func (api *API) disconnect(w http.ResponseWriter, r *http.Request) {
+	admin, ok := api.admin(w, r)
+	if !ok {
+		return
+	}
+	address := r.PathValue("address")
+	if err := api.server.Disconnect(address); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	log.Info().Str("admin", admin).Str("clientAddress", address).Msg("disconnected client")
+	writeJSON(w, http.StatusOK, map[string]string{"address": address})
+}
+
+func (api *API) snapshot(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	err := api.server.TriggerSnapshot(r.Context())
+	if errors.Is(err, ErrNotSnapshotting) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"saved": true})
+}
+
+func (api *API) manualTrade(w http.ResponseWriter, r *http.Request) {
+	admin, ok := api.admin(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Symbol   string  `json:"symbol"`
+		Buyer    string  `json:"buyer"`
+		Seller   string  `json:"seller"`
+		Price    float64 `json:"price"`
+		Quantity uint64  `json:"quantity"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_RECV_SIZE)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ticker, err := jsonTicker(body.Symbol)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orders, err := api.server.BookManualTrade(r.Context(), admin, ticker, body.Buyer, body.Seller, body.Price, body.Quantity)
+	// Given up on before the session handler got to it.
+	if err != nil && r.Context().Err() != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil && RejectReasonOf(err) == RejectUnknownSymbol {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeOrders(w, orders)
+}
+
+func (api *API) adminBook(w http.ResponseWriter, r *http.Request) {
+	if _, ok := api.admin(w, r); !ok {
+		return
+	}
+	ticker, err := jsonTicker(r.PathValue("symbol"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	api.writeBook(w, r, ticker, math.MaxInt)
+}
@@ -0,0 +1,51 @@
+package net
+
+import (
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SetOpeningAuction has symbols in pre-open gather orders in an opening
+// auction, rather than refusing or holding them, over SetQueuePreOpen. Orders
+// rest on the book without matching, where it would uncross being published on
+// the feed as it changes, until the symbol next trades continuously and the
+// book uncrosses, see engine.Uncross. Symbols halted or closed first stay in
+// the auction until they open.
+func (s *Server) SetOpeningAuction(auction bool) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.openingAuction = auction
+}
+
+// startAuction puts ticker in an opening auction, unless it already is. It
+// must be run from the session handler.
+func (s *Server) startAuction(ticker string) error {
+	if s.engine.InAuction(ticker) {
+		return nil
+	}
+	if _, err := s.engine.Apply(Command{Type: StartAuctionCommand, Ticker: ticker}); err != nil {
+		return err
+	}
+	log.Info().Str("ticker", ticker).Msg("opening auction started")
+	return nil
+}
+
+// uncross ends ticker's opening auction, if it is in one, executing what
+// crosses. It must be run from the session handler.
+func (s *Server) uncross(ticker string) error {
+	if !s.engine.InAuction(ticker) {
+		return nil
+	}
+	indicative, _ := s.engine.IndicativeUncross(ticker)
+	if _, err := s.engine.Apply(Command{Type: UncrossCommand, Ticker: ticker}); err != nil {
+		return err
+	}
+	log.Info().
+		Str("ticker", ticker).
+		Float64("price", indicative.Price).
+		Uint64("volume", indicative.Volume).
+		Uint64("surplus", indicative.Surplus).
+		Msg("opening auction uncrossed")
+	return nil
+}
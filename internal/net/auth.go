@@ -0,0 +1,111 @@
+package net
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAuthenticationFailed = Reject(RejectNotEntitled, errors.New("authentication failed"))
+	ErrNotLoggedOn          = Reject(RejectNotEntitled, errors.New("session has not logged on"))
+)
+
+const (
+	// LogonSignatureLen is the length of the HMAC-SHA256 logon signature.
+	LogonSignatureLen = sha256.Size
+	// How far a logon's timestamp may be from the server's clock. Bounds how long
+	// a captured logon could be replayed for.
+	LogonClockSkew = 30 * time.Second
+)
+
+// SetCredentials configures the API secret of every owner allowed to log on,
+// owners without one are refused. Without it, only owners onboarded with a
+// secret are authenticated, anyone else may log on as they please.
+func (s *Server) SetCredentials(secrets map[string]string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.authRequired = true
+	s.credentials = make(map[string][]byte, len(secrets))
+	for owner, secret := range secrets {
+		s.credentials[owner] = []byte(secret)
+	}
+}
+
+// LoadCredentials reads owner API secrets from a file of "owner:secret" lines.
+// Blank lines and lines starting with # are ignored.
+func LoadCredentials(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	secrets := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		owner, secret, ok := strings.Cut(line, ":")
+		if !ok || owner == "" || secret == "" {
+			return nil, fmt.Errorf("%s:%d: expected owner:secret", path, n)
+		}
+		secrets[owner] = secret
+	}
+	return secrets, scanner.Err()
+}
+
+// SignLogon computes the signature a logon for owner at timestamp (unix nanos)
+// must carry: HMAC-SHA256, keyed by the owner's secret, of the owner followed
+// by the big endian timestamp.
+func SignLogon(owner string, timestamp uint64, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(owner))
+	mac.Write(binary.BigEndian.AppendUint64(nil, timestamp))
+	return mac.Sum(nil)
+}
+
+// authenticate checks a logon was signed with the owner's secret, recently.
+// Why it failed is deliberately not given away.
+func (s *Server) authenticate(logon LogonMessage) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	secret, ok := s.credentials[logon.Username]
+	if !ok {
+		if s.authRequired {
+			return ErrAuthenticationFailed
+		}
+		return nil
+	}
+
+	skew := time.Since(time.Unix(0, int64(logon.Timestamp)))
+	if skew > LogonClockSkew || skew < -LogonClockSkew {
+		return ErrAuthenticationFailed
+	}
+
+	expected := SignLogon(logon.Username, logon.Timestamp, string(secret))
+	if !hmac.Equal(expected, logon.Signature) {
+		return ErrAuthenticationFailed
+	}
+	return nil
+}
+
+// loggedOn returns whether the session on clientAddress has logged on.
+func (s *Server) loggedOn(clientAddress string) bool {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	return ok && session.owner != ""
+}
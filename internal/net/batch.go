@@ -0,0 +1,132 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MaxOrderBatchSize is the most orders and cancels a single OrderBatch may
+// carry, so that a full batch still fits in a read.
+const MaxOrderBatchSize = 64
+
+var (
+	ErrInvalidOrderBatchSize  = fmt.Errorf("order batch must have between 1 and %d entries", MaxOrderBatchSize)
+	ErrInvalidOrderBatchEntry = errors.New("order batch entries must be new orders or cancels")
+	ErrInvalidOrderBatch      = errors.New("invalid order batch")
+)
+
+// OrderBatchMessage carries new orders and cancels in one frame, e.g. for a
+// market maker refreshing quotes across many levels. They are handled one
+// after the other, in the order sent, with nothing else handled in between.
+// Unlike an OrderGroup, each is accepted or rejected on its own and answered
+// as if it had been sent alone, though a malformed entry rejects the batch.
+//
+//	Count   1 byte
+//	Entries each a MessageType (2 bytes, NewOrder or CancelOrder) followed by
+//	        that message, NewOrders without their trailing owner
+type OrderBatchMessage struct {
+	BaseMessage
+	Messages []Message // NewOrderMessage or CancelOrderMessage
+}
+
+// batchEntryLen returns the length of a batch entry of type typeOf, excluding
+// its type.
+func batchEntryLen(typeOf MessageType) (int, error) {
+	switch typeOf {
+	case NewOrder:
+		return NewOrderMessageHeaderLen, nil
+	case CancelOrder:
+		return CancelOrderMessageHeaderLen, nil
+	}
+	return 0, ErrInvalidOrderBatchEntry
+}
+
+func parseOrderBatch(msg []byte) (OrderBatchMessage, error) {
+	m := OrderBatchMessage{BaseMessage: BaseMessage{TypeOf: OrderBatch}}
+
+	if len(msg) < OrderBatchHeaderLen {
+		return OrderBatchMessage{}, ErrMessageTooShort
+	}
+	count := int(msg[0])
+	msg = msg[OrderBatchHeaderLen:]
+
+	for range count {
+		if len(msg) < BaseMessageHeaderLen {
+			return OrderBatchMessage{}, ErrMessageTooShort
+		}
+		typeOf := MessageType(binary.BigEndian.Uint16(msg[0:BaseMessageHeaderLen]))
+		msg = msg[BaseMessageHeaderLen:]
+		n, err := batchEntryLen(typeOf)
+		if err != nil {
+			return OrderBatchMessage{}, err
+		}
+		if len(msg) < n {
+			return OrderBatchMessage{}, ErrMessageTooShort
+		}
+
+		var entry Message
+		if typeOf == NewOrder {
+			entry, err = parseNewOrder(msg[:n])
+		} else {
+			entry, err = parseCancelOrder(msg[:n])
+		}
+		if err != nil {
+			return OrderBatchMessage{}, err
+		}
+		m.Messages = append(m.Messages, entry)
+		msg = msg[n:]
+	}
+
+	return m, nil
+}
+
+// Validate checks every entry in the batch is well formed.
+func (m OrderBatchMessage) Validate() error {
+	if len(m.Messages) == 0 || len(m.Messages) > MaxOrderBatchSize {
+		return ErrInvalidOrderBatchSize
+	}
+	for i, entry := range m.Messages {
+		switch entry.(type) {
+		case NewOrderMessage, CancelOrderMessage:
+		default:
+			return ErrInvalidOrderBatchEntry
+		}
+		if err := validateMessage(entry); err != nil {
+			return fmt.Errorf("%w: entry %d: %w", ErrInvalidOrderBatch, i+1, err)
+		}
+	}
+	return nil
+}
+
+// handleOrderBatch handles each entry in the batch as handleMessage would have
+// were it sent alone, reporting any error back on its own. Each entry is its
+// own part of the batch's origin.
+func (s *Server) handleOrderBatch(address string, origin CommandOrigin, batch OrderBatchMessage) {
+	owner := s.sessionOwner(address)
+	for i, entry := range batch.Messages {
+		origin.Part = uint32(i)
+		var err error
+		switch m := entry.(type) {
+		case NewOrderMessage:
+			var ack OrderAck
+			if ack, err = s.placeOrder(owner, origin, m); err == nil {
+				err = s.ReportOrderAck(address, ack)
+			}
+		case CancelOrderMessage:
+			ord, cancelErr := s.cancelOrder(owner, origin, m)
+			err = s.ReportCancel(address, m, ord, cancelErr)
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("clientAddress", address).
+				Int("entry", i+1).
+				Msg("error handling order batch entry")
+			s.ReportError(address, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package net
+
+// SetBrokers configures which owners each broker acts for. A broker may cancel
+// its clients' orders by UUID, as if it were them, and the client is told of
+// the cancel as an unsolicited one. Anyone else's orders are refused with
+// CancelRejectNotOwner, as they always are.
+func (s *Server) SetBrokers(brokers map[string][]string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.brokers = make(map[string]map[string]bool)
+	for broker, clients := range brokers {
+		s.brokers[broker] = make(map[string]bool)
+		for _, client := range clients {
+			s.brokers[broker][client] = true
+		}
+	}
+}
+
+// actsFor returns whether owner may act on orderOwner's orders, either being
+// them or their broker.
+func (s *Server) actsFor(owner string, orderOwner string) bool {
+	if owner == "" {
+		return false
+	}
+	if owner == orderOwner {
+		return true
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.brokers[owner][orderOwner]
+}
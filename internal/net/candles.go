@@ -0,0 +1,135 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultCandleLimit is how many candles are returned a page if the request
+	// does not say.
+	DefaultCandleLimit = 100
+	// MaxCandleLimit is the most candles returned a page.
+	MaxCandleLimit = 1000
+)
+
+var (
+	ErrInvalidCandleRange    = errors.New("candle range ends before it starts")
+	ErrInvalidCandleInterval = errors.New("candle interval must be a whole number of minutes")
+)
+
+// CandleRequestMessage asks for a page of a symbol's candles, see CandleHistory.
+// The next page is asked for from the page's Next.
+type CandleRequestMessage struct {
+	BaseMessage
+	Ticker   string    // 4 bytes
+	Interval uint32    // 4 bytes, seconds, a whole number of minutes
+	From     time.Time // 8 bytes, unix nanos
+	To       time.Time // 8 bytes, unix nanos, 0 for now
+	Limit    uint16    // 2 bytes, candles per page, 0 for the default
+}
+
+func parseCandleRequest(msg []byte) (CandleRequestMessage, error) {
+	m := CandleRequestMessage{BaseMessage: BaseMessage{TypeOf: CandleRequest}}
+
+	if len(msg) < CandleRequestHeaderLen {
+		return CandleRequestMessage{}, ErrMessageTooShort
+	}
+	m.Ticker = string(msg[0:4])
+	m.Interval = binary.BigEndian.Uint32(msg[4:8])
+	m.From = unixNanos(binary.BigEndian.Uint64(msg[8:16]))
+	m.To = unixNanos(binary.BigEndian.Uint64(msg[16:24]))
+	m.Limit = candleLimit(binary.BigEndian.Uint16(msg[24:26]))
+
+	return m, nil
+}
+
+// unixNanos converts a wire timestamp, leaving 0 as the zero time.
+func unixNanos(nanos uint64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+// candleLimit is how many candles a page asking for limit gets. Zero asks for
+// the default, anything too large is clamped.
+func candleLimit(limit uint16) uint16 {
+	if limit == 0 {
+		return DefaultCandleLimit
+	}
+	return min(limit, MaxCandleLimit)
+}
+
+// Validate checks the request's interval is one candles are kept at, and its
+// range is the right way round.
+func (m CandleRequestMessage) Validate() error {
+	if m.Interval == 0 || m.Interval%60 != 0 {
+		return ErrInvalidCandleInterval
+	}
+	if !m.To.IsZero() && m.To.Before(m.From) {
+		return ErrInvalidCandleRange
+	}
+	return nil
+}
+
+// CandleHistory is the response to a CandleRequest, a page of candles oldest
+// first. Intervals without any trades have no candle.
+//
+//	MessageType   1 byte (CandleReport)
+//	Ticker        4 bytes
+//	Interval      4 bytes (seconds)
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+//	Next          8 bytes (unix nanos the next page starts from, 0 if none)
+//	Count         2 bytes
+//	Candles       CandleLen bytes each
+type CandleHistory struct {
+	CandlePage
+}
+
+const (
+	CandleHistoryHeaderLen = 1 + 4 + 4 + 1 + 1 + 8 + 2
+	// Start 8 bytes (unix nanos), Open, High, Low and Close 8 bytes each,
+	// Volume 8 bytes, Trades 4 bytes
+	CandleLen = 8 + 8 + 8 + 8 + 8 + 8 + 4
+)
+
+// Serialize converts the page to be sent on the wire.
+func (history CandleHistory) Serialize() []byte {
+	buf := make([]byte, CandleHistoryHeaderLen+len(history.Candles)*CandleLen)
+
+	buf[0] = byte(CandleReport)
+	copy(buf[1:5], history.Ticker)
+	binary.BigEndian.PutUint32(buf[5:9], uint32(history.Interval/time.Second))
+	buf[9] = history.QuantityScale
+	buf[10] = history.PriceScale
+	if !history.Next.IsZero() {
+		binary.BigEndian.PutUint64(buf[11:19], uint64(history.Next.UnixNano()))
+	}
+	binary.BigEndian.PutUint16(buf[19:21], uint16(len(history.Candles)))
+
+	offset := CandleHistoryHeaderLen
+	for _, candle := range history.Candles {
+		c := buf[offset : offset+CandleLen]
+		binary.BigEndian.PutUint64(c[0:8], uint64(candle.Start.UnixNano()))
+		binary.BigEndian.PutUint64(c[8:16], math.Float64bits(candle.Open))
+		binary.BigEndian.PutUint64(c[16:24], math.Float64bits(candle.High))
+		binary.BigEndian.PutUint64(c[24:32], math.Float64bits(candle.Low))
+		binary.BigEndian.PutUint64(c[32:40], math.Float64bits(candle.Close))
+		binary.BigEndian.PutUint64(c[40:48], candle.Volume)
+		binary.BigEndian.PutUint32(c[48:52], candle.Trades)
+		offset += CandleLen
+	}
+	return buf
+}
+
+// candles fetches the page of candles asked for.
+func (s *Server) candles(request CandleRequestMessage) (CandleHistory, error) {
+	interval := time.Duration(request.Interval) * time.Second
+	page, err := s.engine.Candles(request.Ticker, interval, request.From, request.To, int(request.Limit))
+	return CandleHistory{page}, err
+}
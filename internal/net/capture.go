@@ -0,0 +1,213 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CaptureDirection is which way captured bytes went over a connection.
+type CaptureDirection string
+
+const (
+	CaptureInbound  CaptureDirection = "in"  // Sent by the client
+	CaptureOutbound CaptureDirection = "out" // Written to the client
+)
+
+// CaptureRecord is one read or write on a captured connection, as it was.
+type CaptureRecord struct {
+	Offset    time.Duration    `json:"offset"` // Since the connection was accepted
+	Direction CaptureDirection `json:"dir"`
+	Data      []byte           `json:"data"`
+}
+
+// SetCaptureDir records every byte exchanged over each TCP session from then
+// on, a file per connection in dir, for replaying through the gateway in tests
+// with ReplayCapture. Empty, the default, records nothing. Captures hold
+// everything clients send, logons included, so are as sensitive as the
+// credentials.
+func (s *Server) SetCaptureDir(dir string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.captureDir = dir
+}
+
+// captureConn has a newly accepted connection recorded, if capturing. Failing
+// to start a capture is only logged, the client is served regardless.
+func (s *Server) captureConn(conn net.Conn) net.Conn {
+	s.clientSessionsLock.Lock()
+	dir := s.captureDir
+	s.clientSessionsLock.Unlock()
+	if dir == "" {
+		return conn
+	}
+
+	address := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(conn.RemoteAddr().String())
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s.capture", time.Now().UnixNano(), address))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("unable to capture connection")
+		return conn
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to capture connection")
+		return conn
+	}
+	return &capturedConn{Conn: conn, file: file, encoder: json.NewEncoder(file), start: time.Now()}
+}
+
+// capturedConn is a net.Conn which records what is read off and written to it,
+// as JSON lines of CaptureRecords.
+type capturedConn struct {
+	net.Conn
+	lock    sync.Mutex // Held while recording
+	file    *os.File
+	encoder *json.Encoder
+	start   time.Time
+}
+
+func (conn *capturedConn) Read(buf []byte) (int, error) {
+	n, err := conn.Conn.Read(buf)
+	if n > 0 {
+		conn.record(CaptureInbound, buf[:n])
+	}
+	return n, err
+}
+
+func (conn *capturedConn) Write(buf []byte) (int, error) {
+	n, err := conn.Conn.Write(buf)
+	if n > 0 {
+		conn.record(CaptureOutbound, buf[:n])
+	}
+	return n, err
+}
+
+func (conn *capturedConn) Close() error {
+	err := conn.Conn.Close()
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if conn.file != nil {
+		if closeErr := conn.file.Close(); closeErr != nil {
+			log.Error().Err(closeErr).Msg("unable to close capture")
+		}
+		conn.file = nil
+	}
+	return err
+}
+
+func (conn *capturedConn) record(direction CaptureDirection, buf []byte) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if conn.file == nil {
+		return
+	}
+	record := CaptureRecord{Offset: time.Since(conn.start), Direction: direction, Data: buf}
+	if err := conn.encoder.Encode(record); err != nil {
+		log.Error().Err(err).Str("path", conn.file.Name()).Msg("unable to record capture, stopping")
+		conn.file.Close()
+		conn.file = nil
+	}
+}
+
+// ReadCapture reads back a capture recorded by SetCaptureDir.
+func ReadCapture(path string) ([]CaptureRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []CaptureRecord
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var record CaptureRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// CaptureReplay is what the gateway makes of a captured connection.
+type CaptureReplay struct {
+	Messages []Message        // Read off the inbound stream, heartbeats and all
+	Reports  []map[string]any // Written to the client, as JSON reports
+}
+
+// ReplayCapture runs a capture's inbound bytes through the gateway's framing
+// and parsing, as readSession would, and decodes its outbound bytes as a
+// client would, so protocol changes can be checked against what deployed
+// clients actually send and expect. A capture cut short mid-message, as the
+// client went away, replays up to the last whole message. Times the gateway
+// stamps messages with as they are parsed are cleared, they were never on the
+// wire.
+func ReplayCapture(records []CaptureRecord) (CaptureReplay, error) {
+	var inbound, outbound []byte
+	for _, record := range records {
+		switch record.Direction {
+		case CaptureInbound:
+			inbound = append(inbound, record.Data...)
+		case CaptureOutbound:
+			outbound = append(outbound, record.Data...)
+		}
+	}
+
+	var replay CaptureReplay
+	var decoder Decoder
+	reader := bufio.NewReaderSize(bytes.NewReader(inbound), MAX_RECV_SIZE)
+	for {
+		frame, err := readFrame(reader)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return replay, fmt.Errorf("inbound message %d: %w", len(replay.Messages)+1, err)
+		}
+		message, err := parseSafely(&decoder, frame)
+		if err != nil {
+			return replay, fmt.Errorf("inbound message %d: %w", len(replay.Messages)+1, err)
+		}
+		replay.Messages = append(replay.Messages, unstamp(message))
+	}
+
+	reports, err := JSONReports(outbound, true)
+	if err != nil {
+		return replay, fmt.Errorf("outbound reports: %w", err)
+	}
+	replay.Reports = reports
+	return replay, nil
+}
+
+// unstamp clears the times message was stamped with as it was parsed.
+func unstamp(message Message) Message {
+	switch m := message.(type) {
+	case NewOrderMessage:
+		m.ReceivedAt = time.Time{}
+		return m
+	case PingMessage:
+		m.ReceivedAt = time.Time{}
+		return m
+	case OrderGroupMessage:
+		for i := range m.Orders {
+			m.Orders[i].ReceivedAt = time.Time{}
+		}
+		return m
+	case OrderBatchMessage:
+		for i, entry := range m.Messages {
+			m.Messages[i] = unstamp(entry)
+		}
+		return m
+	}
+	return message
+}
@@ -0,0 +1,324 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"fenrir/internal/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CertificationStep is a behaviour a client is certified on, in the order they
+// are run through.
+type CertificationStep int
+
+const (
+	// The client places an order, then cancels it by the UUID it was acked
+	// with.
+	CertifyAcks CertificationStep = iota
+	// Once the cancel is acked, the client treats the order as gone, placing
+	// another rather than cancelling it again.
+	CertifyCancels
+	// The client answers a heartbeat request with a heartbeat.
+	CertifyHeartbeats
+	// A report goes missing, and the client asks for it to be resent once the
+	// next shows the gap.
+	CertifyGapRecovery
+)
+
+var certificationSteps = map[CertificationStep]string{
+	CertifyAcks:        "acks",
+	CertifyCancels:     "cancels",
+	CertifyHeartbeats:  "heartbeats",
+	CertifyGapRecovery: "gapRecovery",
+}
+
+func (step CertificationStep) String() string {
+	return certificationSteps[step]
+}
+
+// CertificationResult is how a client did on one step.
+type CertificationResult struct {
+	Step   string        `json:"step"`
+	Passed bool          `json:"passed"`
+	Detail string        `json:"detail,omitempty"` // Why it failed
+	Took   time.Duration `json:"took"`
+}
+
+// CertificationReport is the outcome of certifying an owner's connection,
+// passed only if every step was.
+type CertificationReport struct {
+	Owner    string                `json:"owner"`
+	Address  string                `json:"address"`
+	Started  time.Time             `json:"started"`
+	Finished time.Time             `json:"finished"`
+	Passed   bool                  `json:"passed"`
+	Steps    []CertificationResult `json:"steps"`
+}
+
+// certification is where a connection is in being certified.
+type certification struct {
+	report    CertificationReport
+	step      CertificationStep
+	stepStart time.Time
+	timer     *utils.Timer
+
+	ackedUUID    string // Of the order the acks step is waiting on a cancel of
+	ackedClOrdID uint64
+	missing      uint64 // Sequence of the report withheld for gap recovery
+}
+
+// SetCertification puts the server in certification mode, as venues certify
+// the connectivity of members before letting them trade: every session logging
+// on is run through each CertificationStep, with timeout to pass each, and
+// told whether it passed with a CertificationPassed or CertificationFailed
+// notice. Reports are kept for Certifications and, if dir is set, written
+// there as JSON. A zero timeout leaves certification mode.
+//
+// Sessions trade as they otherwise would while certified, so it is meant for
+// a test environment, on a symbol nobody else is trading.
+func (s *Server) SetCertification(timeout time.Duration, dir string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.certifyTimeout = timeout
+	s.certifyDir = dir
+}
+
+// Certifications returns the latest report of each owner certified, by owner.
+func (s *Server) Certifications() []CertificationReport {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	reports := make([]CertificationReport, 0, len(s.certified))
+	for _, report := range s.certified {
+		reports = append(reports, report)
+	}
+	slices.SortFunc(reports, func(a, b CertificationReport) int {
+		return strings.Compare(a.Owner, b.Owner)
+	})
+	return reports
+}
+
+// certify starts certifying the session which just logged on at clientAddress,
+// if in certification mode.
+func (s *Server) certify(clientAddress string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	if s.certifyTimeout <= 0 || !ok {
+		return
+	}
+	if cert, ok := s.certifications[clientAddress]; ok && cert.timer != nil {
+		cert.timer.Stop()
+	}
+	now := time.Now()
+	cert := &certification{
+		report: CertificationReport{Owner: session.owner, Address: clientAddress, Started: now},
+	}
+	s.certifications[clientAddress] = cert
+	log.Info().
+		Str("owner", session.owner).
+		Str("clientAddress", clientAddress).
+		Msg("certifying session")
+	s.startStepLockFree(clientAddress, cert, CertifyAcks)
+}
+
+// certifyOrder notes an order from clientAddress was acked with ack.
+func (s *Server) certifyOrder(clientAddress string, ack OrderAck) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	cert, ok := s.certifications[clientAddress]
+	if !ok {
+		return
+	}
+	switch cert.step {
+	case CertifyAcks:
+		if cert.ackedUUID == "" {
+			cert.ackedUUID, cert.ackedClOrdID = ack.UUID, ack.ClOrdID
+		}
+	case CertifyCancels:
+		s.passStepLockFree(clientAddress, cert)
+	}
+}
+
+// certifyCancel notes a cancel from clientAddress, err being why it was
+// refused, if it was.
+func (s *Server) certifyCancel(clientAddress string, request CancelOrderMessage, err error) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	cert, ok := s.certifications[clientAddress]
+	if !ok || cert.ackedUUID == "" {
+		return
+	}
+	cancelsAcked := request.OrderUUID == cert.ackedUUID || (request.OrderUUID == "" && request.ClOrdID == cert.ackedClOrdID)
+	switch {
+	case cert.step == CertifyAcks && request.OrderUUID != cert.ackedUUID:
+		s.failStepLockFree(clientAddress, cert, fmt.Sprintf("cancelled %s rather than the uuid %s acked", describeCancel(request), cert.ackedUUID))
+	case cert.step == CertifyAcks && err != nil:
+		s.failStepLockFree(clientAddress, cert, fmt.Sprintf("cancel refused: %v", err))
+	case cert.step == CertifyAcks:
+		s.passStepLockFree(clientAddress, cert)
+	case cert.step == CertifyCancels && cancelsAcked:
+		s.failStepLockFree(clientAddress, cert, "cancelled an order again after its cancel was acked")
+	}
+}
+
+func describeCancel(request CancelOrderMessage) string {
+	if request.OrderUUID == "" {
+		return fmt.Sprintf("client order id %d", request.ClOrdID)
+	}
+	return "uuid " + request.OrderUUID
+}
+
+// certifyHeartbeat notes a heartbeat was read off clientAddress.
+func (s *Server) certifyHeartbeat(clientAddress string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if cert, ok := s.certifications[clientAddress]; ok && cert.step == CertifyHeartbeats {
+		s.passStepLockFree(clientAddress, cert)
+	}
+}
+
+// certifyResend notes clientAddress asked for reports to be resent.
+func (s *Server) certifyResend(clientAddress string, request ResendRequestMessage) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	cert, ok := s.certifications[clientAddress]
+	if !ok || cert.step != CertifyGapRecovery {
+		return
+	}
+	if request.BeginSequence > cert.missing {
+		s.failStepLockFree(clientAddress, cert, fmt.Sprintf("asked for reports from #%d, missing #%d", request.BeginSequence, cert.missing))
+		return
+	}
+	s.passStepLockFree(clientAddress, cert)
+}
+
+func (s *Server) passStepLockFree(clientAddress string, cert *certification) {
+	s.endStepLockFree(clientAddress, cert, CertificationResult{Passed: true})
+}
+
+func (s *Server) failStepLockFree(clientAddress string, cert *certification, detail string) {
+	s.endStepLockFree(clientAddress, cert, CertificationResult{Detail: detail})
+}
+
+// endStepLockFree records how the current step went, and moves on to the next,
+// or finishes if it was the last.
+func (s *Server) endStepLockFree(clientAddress string, cert *certification, result CertificationResult) {
+	if cert.timer != nil {
+		cert.timer.Stop()
+		cert.timer = nil
+	}
+	result.Step = cert.step.String()
+	result.Took = time.Since(cert.stepStart)
+	cert.report.Steps = append(cert.report.Steps, result)
+	log.Info().
+		Str("owner", cert.report.Owner).
+		Str("step", result.Step).
+		Bool("passed", result.Passed).
+		Str("detail", result.Detail).
+		Msg("certification step")
+
+	if cert.step == CertifyGapRecovery {
+		s.finishCertificationLockFree(clientAddress, cert)
+		return
+	}
+	s.startStepLockFree(clientAddress, cert, cert.step+1)
+}
+
+// startStepLockFree runs step, failing it unless passed within the timeout.
+func (s *Server) startStepLockFree(clientAddress string, cert *certification, step CertificationStep) {
+	cert.step = step
+	cert.stepStart = time.Now()
+	cert.timer = s.timers.Schedule(s.certifyTimeout, func() {
+		s.clientSessionsLock.Lock()
+		defer s.clientSessionsLock.Unlock()
+		if s.certifications[clientAddress] == cert && cert.step == step {
+			s.failStepLockFree(clientAddress, cert, "timed out")
+		}
+	})
+
+	session, ok := s.connections[clientAddress]
+	if !ok {
+		return
+	}
+	switch step {
+	case CertifyHeartbeats:
+		report, err := generateWireHeartbeatRequest()
+		if err == nil {
+			err = session.send(report)
+		}
+		if err != nil {
+			s.failStepLockFree(clientAddress, cert, fmt.Sprintf("unable to send heartbeat request: %v", err))
+		}
+	case CertifyGapRecovery:
+		if err := s.sendGapLockFree(session, cert); err != nil {
+			s.failStepLockFree(clientAddress, cert, fmt.Sprintf("unable to send reports: %v", err))
+		}
+	}
+}
+
+// sendGapLockFree numbers and stores a report as if sent, without writing it,
+// then sends another for the client to notice the one missing.
+func (s *Server) sendGapLockFree(session *ClientSession, cert *certification) error {
+	report, err := generateWireHeartbeatRequest()
+	if err != nil {
+		return err
+	}
+	session.outbound.Add(report)
+	cert.missing = session.outbound.Sequence()
+	session.journal.Record(JournalOutbound, cert.missing, report)
+	return session.send(report)
+}
+
+// finishCertificationLockFree reports how the connection did, to it and to
+// admins.
+func (s *Server) finishCertificationLockFree(clientAddress string, cert *certification) {
+	delete(s.certifications, clientAddress)
+	report := cert.report
+	report.Finished = time.Now()
+	report.Passed = true
+	for _, result := range report.Steps {
+		report.Passed = report.Passed && result.Passed
+	}
+	s.certified[report.Owner] = report
+
+	log.Info().
+		Str("owner", report.Owner).
+		Str("clientAddress", clientAddress).
+		Bool("passed", report.Passed).
+		Msg("certification finished")
+	notice := CertificationFailed
+	if report.Passed {
+		notice = CertificationPassed
+	}
+	if session, ok := s.connections[clientAddress]; ok {
+		s.sendSessionNoticeLockFree(session, report.Owner, notice)
+	}
+	if s.certifyDir != "" {
+		if err := writeCertification(s.certifyDir, report); err != nil {
+			log.Error().Err(err).Str("owner", report.Owner).Msg("unable to write certification report")
+		}
+	}
+}
+
+// writeCertification writes the report to dir as owner-time.json.
+func writeCertification(dir string, report CertificationReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", report.Owner, report.Finished.UTC().Format("20060102T150405"))
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
@@ -0,0 +1,112 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults for the most a session can have its reports batched by, see
+// SetReportBatchLimits.
+const (
+	DefaultMaxReportBatchBytes = 16 * 1024
+	DefaultMaxReportBatchDelay = 5 * time.Millisecond
+)
+
+// SetReportBatchLimits caps how far sessions may ask for their reports to be
+// batched at logon. Zero for either turns batching off for sessions logging on
+// after it is set.
+func (s *Server) SetReportBatchLimits(maxBytes int, maxDelay time.Duration) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.maxBatchBytes = maxBytes
+	s.maxBatchDelay = maxDelay
+}
+
+// reportBatcherLockFree returns a batcher for conn as logon asks for, within
+// the server's limits, or nil if its reports are written as they are sent. The
+// caller must hold clientSessionsLock.
+func (s *Server) reportBatcherLockFree(conn net.Conn, logon LogonMessage) *reportBatcher {
+	maxBytes := min(int(logon.BatchBytes), s.maxBatchBytes)
+	maxDelay := min(time.Duration(logon.BatchDelay)*time.Microsecond, s.maxBatchDelay)
+	if maxBytes <= 0 || maxDelay <= 0 {
+		return nil
+	}
+	return &reportBatcher{conn: conn, maxBytes: maxBytes, maxDelay: maxDelay}
+}
+
+// reportBatcher coalesces the reports written to a session into fewer writes,
+// for busy participants. Reports are held until maxBytes of them are waiting or
+// the first of them has waited maxDelay, whichever is sooner. Each report keeps
+// its own sequence header, so clients split a batch as they would any other
+// reports read together.
+type reportBatcher struct {
+	lock     sync.Mutex
+	conn     net.Conn
+	maxBytes int
+	maxDelay time.Duration
+	pending  []byte
+	timer    *time.Timer // Flushes pending once maxDelay is up, nil if not set
+}
+
+// write batches buf, writing the batch out straight away if it is full.
+func (batcher *reportBatcher) write(buf []byte) error {
+	batcher.lock.Lock()
+	defer batcher.lock.Unlock()
+
+	batcher.pending = append(batcher.pending, buf...)
+	if len(batcher.pending) >= batcher.maxBytes {
+		return batcher.flushLockFree()
+	}
+	if batcher.timer == nil {
+		batcher.timer = time.AfterFunc(batcher.maxDelay, batcher.expire)
+	}
+	return nil
+}
+
+// flush writes out whatever is waiting, e.g. before writing around the batcher.
+func (batcher *reportBatcher) flush() error {
+	batcher.lock.Lock()
+	defer batcher.lock.Unlock()
+	return batcher.flushLockFree()
+}
+
+func (batcher *reportBatcher) flushLockFree() error {
+	if batcher.timer != nil {
+		batcher.timer.Stop()
+		batcher.timer = nil
+	}
+	if len(batcher.pending) == 0 {
+		return nil
+	}
+	_, err := batcher.conn.Write(batcher.pending)
+	batcher.pending = batcher.pending[:0]
+	return err
+}
+
+// expire writes out a batch which has waited long enough. Nobody is waiting on
+// the write, so a failed one closes the connection for its reader to clean up
+// after, as a client going away would.
+func (batcher *reportBatcher) expire() {
+	if err := batcher.flush(); err != nil {
+		log.Warn().
+			Err(err).
+			Str("clientAddress", batcher.conn.RemoteAddr().String()).
+			Msg("unable to write report batch")
+		batcher.conn.Close()
+	}
+}
+
+// stop drops anything still waiting, once the connection is closed. Those
+// reports are stored, so can be resent on reconnecting.
+func (batcher *reportBatcher) stop() {
+	batcher.lock.Lock()
+	defer batcher.lock.Unlock()
+	if batcher.timer != nil {
+		batcher.timer.Stop()
+		batcher.timer = nil
+	}
+	batcher.pending = nil
+}
@@ -0,0 +1,96 @@
+package net
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// maxInternedTickers is the most tickers a Decoder keeps strings of. Past it,
+// e.g. for a client sending made up tickers, each is allocated as it comes.
+const maxInternedTickers = 1024
+
+// Encoder encodes reports for a session into a buffer of its own, reused from
+// one report to the next rather than allocating for each. What it returns is
+// only good until it next encodes, so is copied by whatever keeps it, as the
+// outbound store does. The server has one per session, used under
+// clientSessionsLock. An Encoder is not safe for concurrent use.
+type Encoder struct {
+	buf []byte
+}
+
+// Report encodes a report, see Report.Serialize.
+func (enc *Encoder) Report(r *Report) []byte {
+	enc.buf = r.AppendTo(enc.buf[:0])
+	return enc.buf
+}
+
+// OrderAck encodes an order acknowledgement, see OrderAck.Serialize.
+func (enc *Encoder) OrderAck(ack *OrderAck) []byte {
+	enc.buf = ack.AppendTo(enc.buf[:0])
+	return enc.buf
+}
+
+// Decoder decodes messages off a session, the new orders and cancels which
+// make up most of them into structs the caller reuses. Tickers are interned,
+// so the same few are not allocated afresh on every order. The server has one
+// per connection, used by the goroutine reading it. A Decoder is not safe for
+// concurrent use.
+type Decoder struct {
+	tickers tickerTable
+}
+
+// tickerTable interns tickers by their bytes on the wire. A nil table interns
+// nothing.
+type tickerTable map[[4]byte]string
+
+// Decode parses a whole message, as parseMessage does, interning the tickers
+// of new orders.
+func (dec *Decoder) Decode(frame []byte) (Message, error) {
+	if len(frame) >= BaseMessageHeaderLen && MessageType(binary.BigEndian.Uint16(frame)) == NewOrder {
+		var m NewOrderMessage
+		if err := dec.NewOrder(frame[BaseMessageHeaderLen:], &m); err != nil {
+			return BaseMessage{}, err
+		}
+		return m, nil
+	}
+	return parseMessage(frame)
+}
+
+// NewOrder decodes a new order, without its message type, into m.
+func (dec *Decoder) NewOrder(msg []byte, m *NewOrderMessage) error {
+	if dec.tickers == nil {
+		dec.tickers = make(tickerTable)
+	}
+	return decodeNewOrder(msg, m, dec.tickers)
+}
+
+// CancelOrder decodes a cancel, without its message type, into m.
+func (dec *Decoder) CancelOrder(msg []byte, m *CancelOrderMessage) error {
+	return decodeCancelOrder(msg, m)
+}
+
+// intern returns the ticker of raw, kept from the last time it was seen.
+func (tickers tickerTable) intern(raw []byte) string {
+	if tickers == nil {
+		return string(raw)
+	}
+	key := [4]byte(raw)
+	if ticker, ok := tickers[key]; ok {
+		return ticker
+	}
+	ticker := string(raw)
+	if len(tickers) < maxInternedTickers {
+		tickers[key] = ticker
+	}
+	return ticker
+}
+
+// grow extends buf by n zeroed bytes, returning it along with the bytes added,
+// for them to be written to.
+func grow(buf []byte, n int) ([]byte, []byte) {
+	buf = slices.Grow(buf, n)
+	buf = buf[:len(buf)+n]
+	added := buf[len(buf)-n:]
+	clear(added)
+	return buf, added
+}
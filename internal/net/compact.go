@@ -0,0 +1,53 @@
+package net
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A Compactor tidies itself up while there is nothing else to do, see
+// engine.Compact. It is driven from the session handler, alongside the engine.
+type Compactor interface {
+	Compact() error
+}
+
+// RunCompaction compacts once nothing has been handled for quiet, and again
+// after each quiet period following any more activity, until ctx is done.
+func (s *Server) RunCompaction(ctx context.Context, compactor Compactor, quiet time.Duration) {
+	ticker := time.NewTicker(quiet / 2)
+	defer ticker.Stop()
+
+	var compactedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Checked on the session handler, so nothing can arrive in between.
+		err := s.call(ctx, func() {
+			if !compactedAt.Before(s.lastActive) || time.Since(s.lastActive) < quiet {
+				return
+			}
+			compactedAt = time.Now()
+			if err := compactor.Compact(); err != nil {
+				log.Error().Err(err).Msg("compaction found invariant violations")
+			}
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// BookMetrics returns what the books are holding on to, see
+// engine.BookMetrics. It is read on the session handler, alongside the engine.
+func (s *Server) BookMetrics(ctx context.Context) (BookMetrics, error) {
+	var metrics BookMetrics
+	err := s.call(ctx, func() { metrics = s.engine.BookMetrics() })
+	return metrics, err
+}
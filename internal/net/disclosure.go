@@ -0,0 +1,97 @@
+package net
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidDisclosure = errors.New("invalid counterparty disclosure")
+
+// anonymizedIDLen is how many bytes of an owner's keyed hash make up their
+// anonymized ID, sent as twice as many hex digits.
+const anonymizedIDLen = 8
+
+// Disclosure is how much an execution report tells a party of who they traded
+// with. Drop copies are for observers overseeing the venue, so always name
+// both sides.
+type Disclosure uint8
+
+const (
+	// The counterparty's owner, as they logged on.
+	DiscloseFull Disclosure = iota
+	// An ID standing in for the counterparty, the same for them across every
+	// trade, so parties can tell they keep trading with someone without
+	// learning who.
+	DiscloseAnonymized
+	// Nothing, the counterparty is left empty.
+	DiscloseHidden
+)
+
+// ParseDisclosure reads a disclosure as given on the command line: "full",
+// "anonymized" or "hidden".
+func ParseDisclosure(s string) (Disclosure, error) {
+	switch strings.ToLower(s) {
+	case "full":
+		return DiscloseFull, nil
+	case "anonymized":
+		return DiscloseAnonymized, nil
+	case "hidden":
+		return DiscloseHidden, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidDisclosure, s)
+}
+
+// SetCounterpartyDisclosure sets how much execution reports tell parties of
+// who they traded with, every owner's being in full unless set. Anonymized IDs
+// are keyed by key, so are only the same across restarts given the same key.
+// A random one is used if key is empty.
+func (s *Server) SetCounterpartyDisclosure(disclosure Disclosure, key []byte) error {
+	if disclosure == DiscloseAnonymized && len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("unable to generate anonymization key: %w", err)
+		}
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.disclosure = disclosure
+	s.disclosureKey = key
+	return nil
+}
+
+// Counterparty returns what parties trading with owner are told of them.
+func (s *Server) Counterparty(owner string) string {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.counterpartyLockFree(owner)
+}
+
+func (s *Server) counterpartyLockFree(owner string) string {
+	switch s.disclosure {
+	case DiscloseAnonymized:
+		return anonymize(s.disclosureKey, owner)
+	case DiscloseHidden:
+		return ""
+	}
+	return owner
+}
+
+// discloseLockFree replaces the counterparty of an execution report with as
+// much of them as is disclosed. The caller must hold clientSessionsLock.
+func (s *Server) discloseLockFree(report *Report) {
+	report.Counterparty = s.counterpartyLockFree(report.Counterparty)
+	report.CounterpartyLen = uint16(len(report.Counterparty))
+}
+
+// anonymize returns the ID standing in for owner under key.
+func anonymize(key []byte, owner string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(owner))
+	return hex.EncodeToString(mac.Sum(nil)[:anonymizedIDLen])
+}
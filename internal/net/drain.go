@@ -0,0 +1,111 @@
+package net
+
+import (
+	"context"
+	"errors"
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrExchangeDraining = Reject(RejectTradingHalted, errors.New("exchange is shutting down"))
+
+// Drain winds the server down ahead of it being stopped, so nothing in flight
+// is lost to the shutdown. New connections stop being accepted and the
+// exchange is closed, with every session told it is shutting down, so new
+// orders are refused from then on. Whatever sessions had already sent is
+// handled, and if cancelResting, every resting order is then cancelled, their
+// owners being told why. Drain returns once every report sent by then has
+// been written to its session, or ctx is done.
+//
+// Sessions already connected are left open, as is the engine, for the server
+// to be stopped by cancelling the context it runs with. Journals, trade stores
+// and snapshots are left to whoever stops it to flush, as nothing changes the
+// books once drained.
+func (s *Server) Drain(ctx context.Context, cancelResting bool) error {
+	s.clientSessionsLock.Lock()
+	s.draining = true
+	listener := s.listener
+	status := s.exchangeStatusLockFree()
+	status.State = ExchangeClosed
+	status.Message = "shutting down"
+	err := s.changeExchangeStatusLockFree(status, StatusClosed, "")
+	s.clientSessionsLock.Unlock()
+	if err != nil {
+		// Some session was not told, the rest still were.
+		log.Error().Err(err).Msg("unable to broadcast shutdown")
+	}
+	if listener != nil {
+		if err := listener.Close(); err != nil {
+			log.Error().Err(err).Msg("unable to close listener")
+		}
+	}
+	log.Info().Bool("cancelResting", cancelResting).Msg("draining server")
+
+	// Whatever was read before the exchange closed is handled, new orders
+	// among it being refused.
+	for pending := true; pending; {
+		if err := s.call(ctx, func() { pending = len(s.clientMessages) > 0 }); err != nil {
+			return err
+		}
+	}
+
+	if cancelResting {
+		var orders []Order
+		if err := s.call(ctx, func() {
+			orders, err = s.engine.Apply(Command{Type: AdminCancelAllCommand, Reason: AdminShutdown})
+		}); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		log.Info().Int("orders", len(orders)).Msg("cancelled resting orders")
+	}
+
+	return s.flushReports(ctx)
+}
+
+// isDraining returns whether the server is being drained, see Drain.
+func (s *Server) isDraining() bool {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.draining
+}
+
+// flushReports writes out every session's batched reports, returning once
+// everything queued for each session by then has been written, or its
+// connection closed.
+func (s *Server) flushReports(ctx context.Context) error {
+	type pending struct {
+		conn    *queuedConn
+		written chan struct{}
+	}
+	var waiting []pending
+
+	s.clientSessionsLock.Lock()
+	for address, session := range s.connections {
+		if session.batcher != nil {
+			if err := session.batcher.flush(); err != nil {
+				s.closeConnectionLockFree(address)
+				continue
+			}
+		}
+		if conn, ok := session.conn.(*queuedConn); ok {
+			written := make(chan struct{})
+			conn.afterWrites(func() { close(written) })
+			waiting = append(waiting, pending{conn: conn, written: written})
+		}
+	}
+	s.clientSessionsLock.Unlock()
+
+	for _, p := range waiting {
+		select {
+		case <-p.written:
+		case <-p.conn.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
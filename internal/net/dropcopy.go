@@ -0,0 +1,109 @@
+package net
+
+import (
+	"errors"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNotObserver = Reject(RejectNotEntitled, errors.New("session is not entitled to drop copies"))
+)
+
+// dropCopyFilter narrows down which execution reports a drop copy session is
+// sent. Empty sets let everything through.
+type dropCopyFilter struct {
+	symbols      map[string]bool
+	participants map[string]bool
+}
+
+func newDropCopyFilter(symbols []string, participants []string) *dropCopyFilter {
+	filter := &dropCopyFilter{
+		symbols:      make(map[string]bool),
+		participants: make(map[string]bool),
+	}
+	for _, symbol := range symbols {
+		filter.symbols[symbol] = true
+	}
+	for _, participant := range participants {
+		filter.participants[participant] = true
+	}
+	return filter
+}
+
+func (filter *dropCopyFilter) matches(ticker string, owner string) bool {
+	return (len(filter.symbols) == 0 || filter.symbols[ticker]) &&
+		(len(filter.participants) == 0 || filter.participants[owner])
+}
+
+// SetObservers configures which owners, besides admins, may subscribe to drop
+// copies of other participants' execution reports.
+func (s *Server) SetObservers(owners ...string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.observers = make(map[string]bool)
+	for _, owner := range owners {
+		s.observers[owner] = true
+	}
+}
+
+// subscribeDropCopy turns the session on clientAddress into a drop copy
+// session. Subscribing again replaces the previous filter.
+func (s *Server) subscribeDropCopy(clientAddress string, request DropCopySubscribeMessage) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if session.owner == "" || !(s.admins[session.owner] || s.observers[session.owner]) {
+		return ErrNotObserver
+	}
+
+	session.dropCopy = newDropCopyFilter(request.Symbols, request.Participants)
+
+	log.Info().
+		Str("owner", session.owner).
+		Strs("symbols", request.Symbols).
+		Strs("participants", request.Participants).
+		Msg("drop copy subscribed")
+	return nil
+}
+
+// sendDropCopiesLockFree copies both sides of a trade to every drop copy session
+// interested in them. The caller must hold clientSessionsLock.
+func (s *Server) sendDropCopiesLockFree(trade Trade, tradeErr error) {
+	partyReport, counterPartyReport := createTradeReports(trade, tradeErr)
+	sides := []struct {
+		order  *Order
+		report Report
+	}{
+		{trade.Party, partyReport},
+		{trade.CounterParty, counterPartyReport},
+	}
+
+	for _, session := range s.clientSessions {
+		if session.dropCopy == nil || !session.connected() {
+			continue
+		}
+		for _, side := range sides {
+			if !session.dropCopy.matches(side.order.Ticker, side.order.Owner) {
+				continue
+			}
+			report, err := generateWireDropCopyReport(side.report, side.order.Owner)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to generate drop copy")
+				continue
+			}
+			if err := session.send(report); err != nil {
+				log.Error().Err(err).Str("clientAddress", session.address).Msg("unable to send drop copy")
+				s.closeConnectionLockFree(session.address)
+				break
+			}
+		}
+	}
+}
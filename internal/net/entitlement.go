@@ -0,0 +1,68 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+)
+
+var (
+	ErrDataNotEntitled = Reject(RejectNotEntitled, errors.New("not entitled to that market data"))
+)
+
+// SetDataTiers configures the market data owners may subscribe to, see
+// DataTier. Owners without a tier, here or from being onboarded, see every
+// level. anonymous is the tier of those who have not logged on, to the feed
+// or a session. It applies to subscriptions made after it is set.
+func (s *Server) SetDataTiers(tiers map[string]DataTier, anonymous DataTier) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.dataTiers = make(map[string]DataTier, len(tiers))
+	for owner, tier := range tiers {
+		s.dataTiers[owner] = tier
+	}
+	s.anonymousTier = anonymous
+}
+
+// Entitle authenticates the logon of a feed subscriber, as a session's would
+// be, returning the market data its owner may subscribe to. See
+// Feed.SetEntitler.
+func (s *Server) Entitle(logon LogonMessage) (DataTier, error) {
+	if err := s.authenticate(logon); err != nil {
+		return 0, err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.dataTierLockFree(logon.Username), nil
+}
+
+// AnonymousTier returns the market data those who have not logged on may
+// subscribe to.
+func (s *Server) AnonymousTier() DataTier {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.anonymousTier
+}
+
+// sessionDataTier returns the market data the session on clientAddress may
+// subscribe to, as its owner if it has logged on.
+func (s *Server) sessionDataTier(clientAddress string) DataTier {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	var owner string
+	if session, ok := s.connections[clientAddress]; ok {
+		owner = session.owner
+	}
+	return s.dataTierLockFree(owner)
+}
+
+// dataTierLockFree returns owner's tier, the anonymous tier if there is no
+// owner. The caller must hold the lock.
+func (s *Server) dataTierLockFree(owner string) DataTier {
+	if owner == "" {
+		return s.anonymousTier
+	}
+	return s.dataTiers[owner]
+}
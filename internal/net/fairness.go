@@ -0,0 +1,70 @@
+package net
+
+import (
+	"slices"
+	"time"
+)
+
+// SetFairnessWindow has the session handler, on being handed a message, wait
+// until window after it was read off its socket for any others read about the
+// same time, then handle them all in the order they were read. Each session's
+// messages are read and handed over by a goroutine of its own, scheduled as
+// the runtime sees fit and held up by whatever checks it makes, so without a
+// window a message read first may well be handled second. With one, near
+// simultaneous orders from different sessions are matched in the order they
+// arrived, at the cost of up to window more latency. Each session's messages
+// are always handled in the order it sent them. Zero, the default, handles
+// messages as they are handed over. It must be set before the server is run.
+func (s *Server) SetFairnessWindow(window time.Duration) {
+	s.fairnessWindow = window
+}
+
+// fairBatch returns first, and whatever else is handed over within the
+// fairness window of first being read, in the order they were read.
+func (s *Server) fairBatch(dying <-chan struct{}, first ClientMessage) []ClientMessage {
+	batch := []ClientMessage{first}
+	if s.fairnessWindow <= 0 {
+		return batch
+	}
+
+	window := time.NewTimer(time.Until(first.readAt.Add(s.fairnessWindow)))
+	defer window.Stop()
+collect:
+	for {
+		select {
+		case message := <-s.clientMessages:
+			batch = append(batch, message)
+		case <-window.C:
+			break collect
+		case <-dying:
+			break collect
+		}
+	}
+
+	byReadAt := func(a, b ClientMessage) int {
+		return a.readAt.Compare(b.readAt)
+	}
+	if slices.IsSortedFunc(batch, byReadAt) {
+		return batch
+	}
+	sorted := slices.Clone(batch)
+	// Stable, so a session's messages read at the same instant keep their
+	// order.
+	slices.SortStableFunc(sorted, byReadAt)
+	for i := range sorted {
+		if !sorted[i].readAt.Equal(batch[i].readAt) {
+			s.inputStats.reordered.Add(1)
+		}
+	}
+	return sorted
+}
+
+// handledInOrder counts message as late if one read after it has already been
+// handled, see InputQueueMetrics.
+func (s *Server) handledInOrder(message ClientMessage) {
+	if message.readAt.Before(s.lastReadAt) {
+		s.inputStats.late.Add(1)
+		return
+	}
+	s.lastReadAt = message.readAt
+}
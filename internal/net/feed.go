@@ -0,0 +1,211 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	. "fenrir/internal/common"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Feed publishes market data to subscribers on its own listener, separate from
+// order entry.
+//
+// Subscribers send Subscribe and Unsubscribe messages naming the channel and
+// ticker, an all zero ticker means every ticker. Nothing is sent until the
+// first subscription. Subscribers which fall too far behind are disconnected,
+// they can resync from a book snapshot.
+//
+// If the feed has an Entitler, subscribers may only subscribe to the channels
+// their DataTier is entitled to, and are disconnected for asking for any other.
+// They are anonymous until they send a Logon, signed as a session's is, which
+// is not answered but for being disconnected if it fails.
+type Feed struct {
+	address string
+	port    int
+	pubsub  *PubSub
+
+	lock     sync.Mutex
+	entitler Entitler
+}
+
+// An Entitler decides what market data feed subscribers may subscribe to.
+type Entitler interface {
+	// Entitle authenticates a subscriber's logon, returning the tier of the
+	// participant it is on behalf of.
+	Entitle(logon LogonMessage) (DataTier, error)
+	// AnonymousTier is the tier of subscribers who have not logged on.
+	AnonymousTier() DataTier
+}
+
+func NewFeed(address string, port int) *Feed {
+	return &Feed{
+		address: address,
+		port:    port,
+		pubsub:  NewPubSub(),
+	}
+}
+
+func (f *Feed) Run(ctx context.Context) {
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", fmt.Sprintf("%s:%d", f.address, f.port))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to start feed listener")
+		return
+	}
+
+	// Unblock Accept on shutdown.
+	go func() {
+		<-ctx.Done()
+		if err := listener.Close(); err != nil {
+			log.Error().Err(err).Msg("unable to close feed listener")
+		}
+	}()
+
+	log.Info().Msg("feed running")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				f.pubsub.RemoveAll()
+				return
+			}
+			log.Error().Err(err).Msg("error accepting feed subscriber")
+			continue
+		}
+
+		log.Info().
+			Str("address", conn.RemoteAddr().String()).
+			Msg("new feed subscriber")
+
+		go f.readSubscriptions(f.pubsub.Add(conn))
+	}
+}
+
+// SetEntitler has subscriptions checked against the subscriber's DataTier, as
+// entitler decides it. Without one, the default, anyone may subscribe to
+// anything. It applies to subscribers connecting after it is set.
+func (f *Feed) SetEntitler(entitler Entitler) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.entitler = entitler
+}
+
+// PublishMarketData sends an update to subscribers of the ticker's book. Trades
+// are also printed to the ticker's tape.
+func (f *Feed) PublishMarketData(update MarketDataUpdate) {
+	f.pubsub.Publish(DepthChannel, update.Ticker, serializeMarketDataUpdate(update))
+	if update.Type == TradeUpdate {
+		f.pubsub.Publish(TradesChannel, update.Ticker, TradeTape{
+			Ticker:        update.Ticker,
+			TradeID:       update.TradeID,
+			Timestamp:     update.Timestamp,
+			Price:         update.Price,
+			Quantity:      update.Quantity,
+			Aggressor:     update.Side,
+			QuantityScale: update.QuantityScale,
+			PriceScale:    update.PriceScale,
+		}.Serialize())
+	}
+}
+
+// PublishBBO sends a top of book change to subscribers of the ticker's BBO.
+func (f *Feed) PublishBBO(bbo BBO) {
+	f.pubsub.Publish(BBOChannel, bbo.Ticker, serializeBBOUpdate(bbo))
+}
+
+// PublishDepth sends the top levels of a book to subscribers of its top depth.
+func (f *Feed) PublishDepth(depth BookDepth) {
+	buf, _ := BookSnapshot{depth}.Serialize()
+	f.pubsub.Publish(TopDepthChannel, depth.Ticker, buf)
+}
+
+// PublishGreeks sends an option's revaluation to subscribers of its analytics.
+func (f *Feed) PublishGreeks(greeks Greeks) {
+	f.pubsub.Publish(AnalyticsChannel, greeks.Ticker, serializeGreeks(greeks))
+}
+
+// readSubscriptions handles logons and subscription requests until the
+// subscriber leaves.
+func (f *Feed) readSubscriptions(sub *subscriber) {
+	f.lock.Lock()
+	entitler := f.entitler
+	f.lock.Unlock()
+	tier := FullDepthTier
+	if entitler != nil {
+		tier = entitler.AnonymousTier()
+	}
+
+	r := bufio.NewReader(sub.conn)
+	for {
+		buf, err := readFrame(r)
+		if errors.Is(err, ErrInvalidMessageType) || errors.Is(err, ErrMessageTooLong) {
+			f.invalidMessage(sub)
+			return
+		}
+		if err != nil {
+			f.pubsub.Remove(sub)
+			return
+		}
+
+		switch MessageType(binary.BigEndian.Uint16(buf[0:2])) {
+		case Logon:
+			logon, err := parseLogon(buf[BaseMessageHeaderLen:])
+			if err != nil {
+				f.invalidMessage(sub)
+				return
+			}
+			if entitler == nil {
+				continue
+			}
+			if tier, err = entitler.Entitle(logon); err != nil {
+				f.refuse(sub, logon.Username, err)
+				return
+			}
+		case Subscribe, Unsubscribe:
+			channel := Channel(buf[2])
+			ticker := string(buf[3:7])
+			if channel >= NumChannels {
+				f.invalidMessage(sub)
+				return
+			}
+			if MessageType(binary.BigEndian.Uint16(buf[0:2])) == Unsubscribe {
+				f.pubsub.Unsubscribe(sub, channel, ticker)
+				continue
+			}
+			if !tier.Includes(channel.Tier()) {
+				f.refuse(sub, "", ErrDataNotEntitled)
+				return
+			}
+			f.pubsub.Subscribe(sub, channel, ticker)
+		default:
+			f.invalidMessage(sub)
+			return
+		}
+	}
+}
+
+// refuse disconnects a subscriber which failed to log on as owner, or asked
+// for data it is not entitled to.
+func (f *Feed) refuse(sub *subscriber, owner string, err error) {
+	log.Warn().
+		Err(err).
+		Str("address", sub.conn.RemoteAddr().String()).
+		Str("owner", owner).
+		Msg("feed subscriber refused")
+	f.pubsub.Remove(sub)
+}
+
+// invalidMessage disconnects a subscriber which sent something unexpected.
+func (f *Feed) invalidMessage(sub *subscriber) {
+	log.Error().
+		Str("address", sub.conn.RemoteAddr().String()).
+		Msg("invalid feed message")
+	f.pubsub.Remove(sub)
+}
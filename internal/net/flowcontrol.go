@@ -0,0 +1,182 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// flowQueuedRemaining is how few more commands a book must be willing to take
+// before a session whose command was queued on it is told to slow down.
+const flowQueuedRemaining = 2
+
+// FlowState is why a FlowControl was sent.
+type FlowState uint8
+
+const (
+	// A command was rejected as a book it was routed to is backed up. It is
+	// worth sending again once its priority's RetryAfter has passed.
+	FlowThrottled FlowState = iota
+	// A command was admitted, but queued on a book so far backed up it will
+	// soon throttle. Sessions should hold off for the RetryAfter of any
+	// priority they have used up.
+	FlowQueued
+	// A command was rejected as its session sent too many too fast, see
+	// Server.SetMessageRate. It is not about any one book, so has no ticker.
+	// The session may send again once the RetryAfter has passed.
+	FlowSessionThrottled
+)
+
+// FlowControl tells a session how much more a book will take from it, so
+// clients can pace themselves rather than retry blindly. It follows the
+// ErrorReport of a throttled command, or is sent on its own when a command was
+// queued on a book close to throttling.
+//
+//	MessageType 1 byte (FlowControlReport)
+//	State       1 byte (FlowState)
+//	Ticker      4 bytes
+//	Priority    1 byte (CommandPriority of the command it is about)
+//	Remaining   4 bytes per CommandPriority (signed, commands the book will
+//	            still admit, -1 if never throttled)
+//	RetryAfter  8 bytes per CommandPriority (nanos until the book is expected
+//	            to admit another, 0 if it does now)
+//	Timestamp   8 bytes (unix nanos)
+type FlowControl struct {
+	State     FlowState
+	Ticker    string
+	Priority  CommandPriority
+	Budget    ThrottleBudget
+	Timestamp time.Time
+}
+
+const FlowControlLen = 1 + 1 + 4 + 1 + int(NumCommandPriorities)*(4+8) + 8
+
+// Serialize converts the flow control to be sent on the wire.
+func (flow FlowControl) Serialize() []byte {
+	buf := make([]byte, FlowControlLen)
+	buf[0] = byte(FlowControlReport)
+	buf[1] = byte(flow.State)
+	copy(buf[2:6], flow.Ticker)
+	buf[6] = byte(flow.Priority)
+	offset := 7
+	for _, remaining := range flow.Budget.Remaining {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], uint32(int32(remaining)))
+		offset += 4
+	}
+	for _, retryAfter := range flow.Budget.RetryAfter {
+		binary.BigEndian.PutUint64(buf[offset:offset+8], uint64(retryAfter))
+		offset += 8
+	}
+	binary.BigEndian.PutUint64(buf[offset:offset+8], uint64(flow.Timestamp.UnixNano()))
+	return buf
+}
+
+// ParseFlowControl reads a flow control serialized by Serialize.
+func ParseFlowControl(buf []byte) (FlowControl, error) {
+	if len(buf) < FlowControlLen {
+		return FlowControl{}, ErrReportTooShort
+	}
+	flow := FlowControl{
+		State:    FlowState(buf[1]),
+		Ticker:   string(buf[2:6]),
+		Priority: CommandPriority(buf[6]),
+	}
+	offset := 7
+	for i := range flow.Budget.Remaining {
+		flow.Budget.Remaining[i] = int(int32(binary.BigEndian.Uint32(buf[offset : offset+4])))
+		offset += 4
+	}
+	for i := range flow.Budget.RetryAfter {
+		flow.Budget.RetryAfter[i] = time.Duration(binary.BigEndian.Uint64(buf[offset : offset+8]))
+		offset += 8
+	}
+	flow.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(buf[offset:offset+8])))
+	return flow, nil
+}
+
+// throttledError is a command throttled by a book, along with what the book
+// will take, so whoever sent it can be told when to try again.
+type throttledError struct {
+	error
+	flow FlowControl
+}
+
+func (err throttledError) Unwrap() error {
+	return err.error
+}
+
+// retryAfter is how long until the book is expected to admit the command.
+func (err throttledError) retryAfter() time.Duration {
+	return err.flow.Budget.RetryAfter[err.flow.Priority]
+}
+
+// retryAfterHeader is retryAfter as an HTTP Retry-After, in whole seconds and
+// never less than one.
+func (err throttledError) retryAfterHeader() string {
+	return strconv.Itoa(max(1, int(math.Ceil(err.retryAfter().Seconds()))))
+}
+
+// throttled wraps a book's refusal to admit a command with its flow control.
+func (s *Server) throttled(err error, ticker string, priority CommandPriority) error {
+	return throttledError{
+		error: err,
+		flow: FlowControl{
+			State:     FlowThrottled,
+			Ticker:    ticker,
+			Priority:  priority,
+			Budget:    s.engine.ThrottleBudget(ticker),
+			Timestamp: time.Now(),
+		},
+	}
+}
+
+// paceSession tells the session on clientAddress how to pace itself after
+// admitting its message, admitErr being what admit returned. Throttled
+// commands are told when to try again, and commands queued on a book close to
+// throttling how much more it will take.
+func (s *Server) paceSession(clientAddress string, message Message, admitErr error) {
+	var throttled throttledError
+	if errors.As(admitErr, &throttled) {
+		s.ReportFlowControl(clientAddress, throttled.flow)
+		return
+	}
+	if admitErr != nil {
+		return
+	}
+
+	tickers, priority := commandRoutes(message)
+	for _, ticker := range tickers {
+		budget := s.engine.ThrottleBudget(ticker)
+		remaining := budget.Remaining[priority]
+		if remaining < 0 || remaining > flowQueuedRemaining {
+			continue
+		}
+		s.ReportFlowControl(clientAddress, FlowControl{
+			State:     FlowQueued,
+			Ticker:    ticker,
+			Priority:  priority,
+			Budget:    budget,
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// ReportFlowControl tells a session how much more a book will take from it.
+func (s *Server) ReportFlowControl(clientAddress string, flow FlowControl) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if err := client.send(flow.Serialize()); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package net
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"io"
+)
+
+var (
+	ErrMessageTooLong = Reject(RejectMalformed, errors.New("message too long"))
+)
+
+// readFrame reads the next whole message off a client's stream. Messages carry
+// no length of their own, so it is worked out from the message type, peeking
+// at any length fields along the way. A message must fit in the reader's
+// buffer.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	header, err := r.Peek(BaseMessageHeaderLen)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := frameLen(r, MessageType(binary.BigEndian.Uint16(header)))
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, ErrMessageTooLong
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// frameLen returns the length of the message at the head of r, including its
+// header.
+func frameLen(r *bufio.Reader, typeOf MessageType) (int, error) {
+	n := BaseMessageHeaderLen
+
+	// peekLen reads a single byte length field at offset.
+	peekLen := func(offset int) (int, error) {
+		buf, err := r.Peek(offset + 1)
+		if err != nil {
+			return 0, err
+		}
+		return int(buf[offset]), nil
+	}
+
+	switch typeOf {
+	case Heartbeat, LogBook, ExchangeStatusRequest:
+		return n, nil
+	case NewOrder:
+		// Trailed by the sender's name, which is ignored in favour of the
+		// session's owner.
+		n += NewOrderMessageHeaderLen
+		ownerLen, err := peekLen(n)
+		return n + 1 + ownerLen, err
+	case CancelOrder:
+		return n + CancelOrderMessageHeaderLen, nil
+	case Logon:
+		usernameLen, err := peekLen(n)
+		return n + LogonMessageHeaderLen + usernameLen + LogonAuthLen + LogonBatchingLen, err
+	case BBORequest:
+		return n + BBORequestMessageHeaderLen, nil
+	case Subscribe, Unsubscribe:
+		// Only valid on the feed, see Feed.
+		return n + SubscribeHeaderLen, nil
+	case BookSnapshotRequest:
+		return n + BookSnapshotRequestHeaderLen, nil
+	case AdminCancel:
+		return n + AdminCancelMessageHeaderLen, nil
+	case DropCopySubscribe:
+		counts, err := r.Peek(n + DropCopySubscribeHeaderLen)
+		if err != nil {
+			return 0, err
+		}
+		nSymbols, nParticipants := int(counts[n]), int(counts[n+1])
+		n += DropCopySubscribeHeaderLen + nSymbols*4
+		for range nParticipants {
+			participantLen, err := peekLen(n)
+			if err != nil {
+				return 0, err
+			}
+			n += 1 + participantLen
+		}
+		return n, nil
+	case Ping:
+		return n + PingMessageHeaderLen, nil
+	case QuoteRequest:
+		return n + QuoteRequestHeaderLen, nil
+	case CandleRequest:
+		return n + CandleRequestHeaderLen, nil
+	case ExchangeStatusUpdate:
+		lens, err := r.Peek(n + ExchangeStatusUpdateHeaderLen)
+		if err != nil {
+			return 0, err
+		}
+		componentLen, messageLen := int(lens[n+17]), int(lens[n+18])
+		return n + ExchangeStatusUpdateHeaderLen + componentLen + messageLen, nil
+	case KillSwitch:
+		messageLen, err := peekLen(n + 1)
+		return n + KillSwitchHeaderLen + messageLen, err
+	case SettleRequest:
+		return n + SettleRequestHeaderLen, nil
+	case TradingPhaseOverride:
+		return n + TradingPhaseOverrideHeaderLen, nil
+	case OrderGroup:
+		count, err := peekLen(n + OrderGroupHeaderLen - 1)
+		return n + OrderGroupHeaderLen + count*NewOrderMessageHeaderLen, err
+	case OrderBatch:
+		count, err := peekLen(n)
+		if err != nil {
+			return 0, err
+		}
+		n += OrderBatchHeaderLen
+		for range count {
+			header, err := r.Peek(n + BaseMessageHeaderLen)
+			if err != nil {
+				return 0, err
+			}
+			entryLen, err := batchEntryLen(MessageType(binary.BigEndian.Uint16(header[n:])))
+			if err != nil {
+				return 0, err
+			}
+			n += BaseMessageHeaderLen + entryLen
+		}
+		return n, nil
+	case JournalRequest:
+		ownerLen, err := peekLen(n)
+		return n + JournalRequestHeaderLen + ownerLen, err
+	case ResendRequest:
+		return n + ResendRequestHeaderLen, nil
+	case RegisterParticipant:
+		lens, err := r.Peek(n + 2)
+		if err != nil {
+			return 0, err
+		}
+		return n + RegisterParticipantHeaderLen + int(lens[n]) + int(lens[n+1]), nil
+	default:
+		return 0, ErrInvalidMessageType
+	}
+}
@@ -0,0 +1,121 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A Funder exchanges funding between a perpetual's holders, see engine.Fund.
+// It is driven from the session handler, alongside the engine.
+type Funder interface {
+	Fund(ticker string) (Funding, error)
+}
+
+// FundingStatement tells a holder of a perpetual what they paid or received in
+// a funding.
+//
+//	MessageType   1 byte (FundingReport)
+//	Ticker        4 bytes
+//	Rate          8 bytes (positive when longs pay shorts)
+//	MarkPrice     8 bytes
+//	IndexPrice    8 bytes
+//	Position      8 bytes (signed lots, long is positive)
+//	Amount        8 bytes (received less paid)
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+//	Timestamp     8 bytes (unix nanos)
+type FundingStatement struct {
+	Ticker        string
+	Rate          float64
+	MarkPrice     float64
+	IndexPrice    float64
+	Position      int64
+	Amount        float64
+	QuantityScale uint8
+	PriceScale    uint8
+	Timestamp     time.Time
+}
+
+const FundingStatementLen = 1 + 4 + 8 + 8 + 8 + 8 + 8 + 1 + 1 + 8
+
+// Serialize converts the statement to be sent on the wire.
+func (statement FundingStatement) Serialize() []byte {
+	buf := make([]byte, FundingStatementLen)
+	buf[0] = byte(FundingReport)
+	copy(buf[1:5], statement.Ticker)
+	binary.BigEndian.PutUint64(buf[5:13], math.Float64bits(statement.Rate))
+	binary.BigEndian.PutUint64(buf[13:21], math.Float64bits(statement.MarkPrice))
+	binary.BigEndian.PutUint64(buf[21:29], math.Float64bits(statement.IndexPrice))
+	binary.BigEndian.PutUint64(buf[29:37], uint64(statement.Position))
+	binary.BigEndian.PutUint64(buf[37:45], math.Float64bits(statement.Amount))
+	buf[45] = statement.QuantityScale
+	buf[46] = statement.PriceScale
+	binary.BigEndian.PutUint64(buf[47:55], uint64(statement.Timestamp.UnixNano()))
+	return buf
+}
+
+// RunFunding funds perp at each of its funding times on the server's clock,
+// until ctx is done. Fundings the perpetual has no prices for yet are skipped.
+func (s *Server) RunFunding(ctx context.Context, funder Funder, perp Perpetual) {
+	s.clientSessionsLock.Lock()
+	clock := s.clock
+	s.clientSessionsLock.Unlock()
+
+	for {
+		now := clock.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(perp.NextFunding(now).Sub(now)):
+		}
+
+		err := s.call(ctx, func() {
+			funding, err := funder.Fund(perp.Ticker)
+			if err != nil {
+				log.Warn().Err(err).Str("ticker", perp.Ticker).Msg("unable to fund perpetual")
+				return
+			}
+			s.ReportFunding(funding)
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ReportFunding sends every holder with a session their statement for a
+// funding. Holders who are not logged on can find it in the ledger.
+func (s *Server) ReportFunding(funding Funding) {
+	log.Info().
+		Str("ticker", funding.Ticker).
+		Float64("markPrice", funding.MarkPrice).
+		Float64("indexPrice", funding.IndexPrice).
+		Float64("premium", funding.Premium).
+		Float64("rate", funding.Rate).
+		Int("holders", len(funding.Payments)).
+		Msg("funded perpetual")
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	for _, payment := range funding.Payments {
+		statement := FundingStatement{
+			Ticker:        funding.Ticker,
+			Rate:          funding.Rate,
+			MarkPrice:     funding.MarkPrice,
+			IndexPrice:    funding.IndexPrice,
+			Position:      payment.Position,
+			Amount:        payment.Amount,
+			QuantityScale: funding.QuantityScale,
+			PriceScale:    funding.PriceScale,
+			Timestamp:     funding.Timestamp,
+		}
+		if err := s.sendToOwnerLockFree(payment.Owner, statement.Serialize()); err != nil {
+			log.Error().Err(err).Str("owner", payment.Owner).Msg("unable to send funding statement")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+)
+
+// MaxOrderGroupSize is the most orders a single OrderGroup may carry.
+const MaxOrderGroupSize = 16
+
+var (
+	ErrInvalidOrderGroupSize = fmt.Errorf("order group must have between 1 and %d orders", MaxOrderGroupSize)
+)
+
+// OrderGroupMessage places orders, on any symbols, which are accepted together
+// or rejected together, e.g. both legs of a pairs trade. Every order in the
+// group is acknowledged, echoing back the GroupID. A rejected group gets a
+// single ErrorReport, saying which order it was rejected for.
+//
+//	GroupID 8 bytes (client chosen)
+//	Count   1 byte
+//	Orders  NewOrderMessageHeaderLen bytes each, as on a NewOrder without its
+//	        trailing owner
+type OrderGroupMessage struct {
+	BaseMessage
+	GroupID uint64
+	Orders  []NewOrderMessage
+}
+
+func parseOrderGroup(msg []byte) (OrderGroupMessage, error) {
+	m := OrderGroupMessage{BaseMessage: BaseMessage{TypeOf: OrderGroup}}
+
+	if len(msg) < OrderGroupHeaderLen {
+		return OrderGroupMessage{}, ErrMessageTooShort
+	}
+	m.GroupID = binary.BigEndian.Uint64(msg[0:8])
+	count := int(msg[8])
+	msg = msg[OrderGroupHeaderLen:]
+
+	if len(msg) < count*NewOrderMessageHeaderLen {
+		return OrderGroupMessage{}, ErrMessageTooShort
+	}
+	for range count {
+		order, err := parseNewOrder(msg[:NewOrderMessageHeaderLen])
+		if err != nil {
+			return OrderGroupMessage{}, err
+		}
+		m.Orders = append(m.Orders, order)
+		msg = msg[NewOrderMessageHeaderLen:]
+	}
+
+	return m, nil
+}
+
+// Validate checks every order in the group is well formed.
+func (m OrderGroupMessage) Validate() error {
+	if len(m.Orders) == 0 || len(m.Orders) > MaxOrderGroupSize {
+		return ErrInvalidOrderGroupSize
+	}
+	for i, order := range m.Orders {
+		if err := order.Validate(); err != nil {
+			return fmt.Errorf("%w: order %d: %w", ErrOrderGroupRejected, i+1, err)
+		}
+	}
+	return nil
+}
+
+// placeOrderGroup places every order in the group on behalf of owner, or none
+// of them, returning how each is to be acknowledged.
+func (s *Server) placeOrderGroup(owner string, origin CommandOrigin, group OrderGroupMessage) ([]OrderAck, error) {
+	tickers := make([]string, 0, len(group.Orders))
+	for _, order := range group.Orders {
+		tickers = append(tickers, order.Ticker)
+	}
+	if err := s.tradingErr(tickers...); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOrderGroupRejected, err)
+	}
+	// Groups are never held for the open, as they must be placed at once.
+	for _, order := range group.Orders {
+		if err := s.tradingPhaseErr(order.Ticker, order.AssetType); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOrderGroupRejected, err)
+		}
+	}
+	orders := make([]Order, 0, len(group.Orders))
+	for i, order := range group.Orders {
+		ord, err := order.Order(owner)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkOrderLimit(ord); err != nil {
+			return nil, fmt.Errorf("%w: order %d: %w", ErrOrderGroupRejected, i+1, err)
+		}
+		if err := s.CheckRiskLimits(ord); err != nil {
+			return nil, fmt.Errorf("%w: order %d: %w", ErrOrderGroupRejected, i+1, err)
+		}
+		orders = append(orders, ord)
+	}
+
+	_, err := s.engine.Apply(Command{Origin: origin, Type: PlaceOrderGroupCommand, Orders: orders})
+	if errors.Is(err, ErrOrderGroupRejected) {
+		return nil, err
+	}
+
+	// Once accepted, every order is acknowledged, even if something went wrong
+	// after it was placed.
+	acks := make([]OrderAck, 0, len(orders))
+	for i, ord := range orders {
+		ack := s.orderAck(s.engine, group.Orders[i], ord)
+		ack.GroupID = group.GroupID
+		acks = append(acks, ack)
+	}
+	return acks, err
+}
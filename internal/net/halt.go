@@ -0,0 +1,50 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSymbolHalted    = Reject(RejectTradingHalted, errors.New("symbol is halted"))
+	ErrSymbolNotHalted = errors.New("symbol is not halted")
+)
+
+// HaltSymbol refuses new orders on ticker until it is resumed, broadcasting
+// SymbolHalted to every session. Resting orders are left on the book, and may
+// still be cancelled.
+func (s *Server) HaltSymbol(ticker string) error {
+	s.clientSessionsLock.Lock()
+	s.haltedSymbols[ticker] = true
+	s.clientSessionsLock.Unlock()
+
+	log.Warn().Str("ticker", ticker).Msg("symbol halted")
+	return s.ReportSymbolStatus(ticker, SymbolHalted)
+}
+
+// ResumeSymbol takes new orders on a halted ticker again, broadcasting
+// SymbolNormal to every session.
+func (s *Server) ResumeSymbol(ticker string) error {
+	s.clientSessionsLock.Lock()
+	halted := s.haltedSymbols[ticker]
+	delete(s.haltedSymbols, ticker)
+	s.clientSessionsLock.Unlock()
+	if !halted {
+		return fmt.Errorf("%w: %s", ErrSymbolNotHalted, ticker)
+	}
+
+	log.Info().Str("ticker", ticker).Msg("symbol resumed")
+	return s.ReportSymbolStatus(ticker, SymbolNormal)
+}
+
+// HaltedSymbols returns every halted ticker, in order.
+func (s *Server) HaltedSymbols() []string {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return slices.Sorted(maps.Keys(s.haltedSymbols))
+}
@@ -0,0 +1,32 @@
+package net
+
+import "context"
+
+// An IndexPricer takes prices from outside the exchange, see
+// engine.SetIndexPrice. The engine is given index prices as they change, if it
+// is one.
+type IndexPricer interface {
+	SetIndexPrice(ticker string, price float64)
+}
+
+// SetIndexPrice sets the price of ticker taken from outside the exchange, a
+// price of 0 clearing it, e.g. once every source of it has gone stale. New
+// orders are collared around it, see RiskLimits, and the engine marks positions
+// and funds perpetuals against it.
+func (s *Server) SetIndexPrice(ctx context.Context, ticker string, price float64) error {
+	s.clientSessionsLock.Lock()
+	if price > 0 {
+		s.indexPrices[ticker] = price
+	} else {
+		delete(s.indexPrices, ticker)
+	}
+	s.clientSessionsLock.Unlock()
+
+	pricer, ok := s.engine.(IndexPricer)
+	if !ok {
+		return nil
+	}
+	return s.call(ctx, func() {
+		pricer.SetIndexPrice(ticker, price)
+	})
+}
@@ -0,0 +1,208 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownSession = errors.New("no session for owner")
+
+// DefaultJournalSize is how many of its latest messages a session's journal
+// keeps.
+const DefaultJournalSize = 100000
+
+// JournalDirection is which way a journaled message went, and whether it
+// made it.
+type JournalDirection uint8
+
+const (
+	// Received from the client.
+	JournalInbound JournalDirection = iota
+	// Sent to the client.
+	JournalOutbound
+	// Numbered for the client, but not sent as they were not connected.
+	JournalUndelivered
+	// Sent to the client again on a ResendRequest.
+	JournalResent
+)
+
+// JournalEntry is a single message exchanged with a session, exactly as it was
+// on the wire. Inbound messages are numbered as they are received, outbound
+// ones carry the sequence number they were sent with, which is not included in
+// Message.
+type JournalEntry struct {
+	Direction JournalDirection
+	Sequence  uint64
+	Timestamp time.Time
+	Message   []byte
+}
+
+// Journal records every message exchanged with a session, other than
+// heartbeats, so what a client did or did not send can be settled from the
+// exchange's side.
+type Journal struct {
+	clock   Clock
+	inbound uint64 // Last inbound sequence
+	entries []JournalEntry
+	size    int
+}
+
+func NewJournal(clock Clock, size int) *Journal {
+	return &Journal{clock: clock, size: max(size, 1)}
+}
+
+// RecordInbound numbers a message received from the client and records it.
+func (journal *Journal) RecordInbound(message []byte) {
+	journal.inbound++
+	journal.Record(JournalInbound, journal.inbound, message)
+}
+
+// Record adds a message to the journal.
+func (journal *Journal) Record(direction JournalDirection, sequence uint64, message []byte) {
+	journal.entries = append(journal.entries, JournalEntry{
+		Direction: direction,
+		Sequence:  sequence,
+		Timestamp: journal.clock.Now(),
+		Message:   message,
+	})
+	if len(journal.entries) > journal.size {
+		journal.entries = journal.entries[1:]
+	}
+}
+
+// Entries returns the latest limit entries, oldest first, or all of those kept
+// if limit is 0.
+func (journal *Journal) Entries(limit int) []JournalEntry {
+	entries := journal.entries
+	if limit > 0 && limit < len(entries) {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// adopt takes over the entries of the journal kept for a connection before it
+// logged on to an existing session. Inbound messages are renumbered to follow
+// on from this journal's own.
+func (journal *Journal) adopt(other *Journal) {
+	for _, entry := range other.entries {
+		if entry.Direction == JournalInbound {
+			journal.inbound++
+			entry.Sequence = journal.inbound
+		}
+		journal.entries = append(journal.entries, entry)
+	}
+	if len(journal.entries) > journal.size {
+		journal.entries = journal.entries[len(journal.entries)-journal.size:]
+	}
+}
+
+// followOn renumbers the journal's inbound messages to follow on from
+// sequence, e.g. the last command the engine applied from the owner before a
+// restart.
+func (journal *Journal) followOn(sequence uint64) {
+	if sequence == 0 {
+		return
+	}
+	for i := range journal.entries {
+		if journal.entries[i].Direction == JournalInbound {
+			journal.entries[i].Sequence += sequence
+		}
+	}
+	journal.inbound += sequence
+}
+
+// journalInbound records a message read off the connection at clientAddress,
+// returning where it came from for the engine to mark as applied. Messages read
+// before the session logged on have no origin, they are numbered apart from
+// the owner's session until it is taken over.
+func (s *Server) journalInbound(clientAddress string, message []byte) CommandOrigin {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	if !ok {
+		return CommandOrigin{}
+	}
+	session.journal.RecordInbound(message)
+	if session.owner == "" {
+		return CommandOrigin{}
+	}
+	return CommandOrigin{Session: session.owner, Sequence: session.journal.inbound}
+}
+
+// sendJournal answers an admin's request for an owner's session journal.
+func (s *Server) sendJournal(clientAddress string, request JournalRequestMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.clientSessions[request.Owner]
+	if !ok {
+		return ErrUnknownSession
+	}
+	report, err := SessionJournal{
+		Owner:   request.Owner,
+		Entries: session.journal.Entries(int(request.Limit)),
+	}.Serialize()
+	if err != nil {
+		return err
+	}
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if err := client.send(report); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// SessionJournal is the response to a JournalRequest. It has its own layout
+// rather than the Report one, as it carries a variable number of entries:
+//
+//	MessageType 1 byte (JournalReport)
+//	OwnerLen    1 byte
+//	Entries     4 bytes
+//	Owner       n bytes
+//	Entries     each JournalEntryHeaderLen bytes followed by the message
+type SessionJournal struct {
+	Owner   string
+	Entries []JournalEntry
+}
+
+const (
+	JournalHeaderLen = 1 + 1 + 4
+	// Direction 1 byte, Sequence 8 bytes, Timestamp 8 bytes (unix nanos),
+	// MessageLen 4 bytes
+	JournalEntryHeaderLen = 1 + 8 + 8 + 4
+)
+
+// Serialize converts the journal to be sent on the wire.
+func (journal SessionJournal) Serialize() ([]byte, error) {
+	if len(journal.Owner) > 255 {
+		return nil, ErrInvalidUsername
+	}
+
+	buf := make([]byte, JournalHeaderLen, JournalHeaderLen+len(journal.Owner))
+	buf[0] = byte(JournalReport)
+	buf[1] = byte(len(journal.Owner))
+	binary.BigEndian.PutUint32(buf[2:6], uint32(len(journal.Entries)))
+	buf = append(buf, journal.Owner...)
+
+	for _, entry := range journal.Entries {
+		buf = append(buf, byte(entry.Direction))
+		buf = binary.BigEndian.AppendUint64(buf, entry.Sequence)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(entry.Timestamp.UnixNano()))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Message)))
+		buf = append(buf, entry.Message...)
+	}
+	return buf, nil
+}
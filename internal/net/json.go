@@ -0,0 +1,830 @@
+package net
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownJSONMessage = Reject(RejectMalformed, errors.New("unknown json message type"))
+	ErrInvalidTicker      = Reject(RejectMalformed, errors.New("ticker longer than 4 characters"))
+	ErrInvalidChannel     = errors.New("invalid channel")
+	ErrReportTooShort     = errors.New("report too short")
+)
+
+// JSON clients send and receive the same messages as binary ones, as objects
+// with a "type" naming the message. Enums are sent by name, quantities are in
+// lots of the instrument and timestamps are unix nanos, exactly as on the
+// binary protocol. For example:
+//
+//	{"type": "newOrder", "ticker": "AAPL", "side": "buy", "price": 101.5, "quantity": 10, "clOrdId": 1}
+//
+// Asset type, order type and time in force may be left out for equities, limit
+// and day respectively.
+type jsonMessage struct {
+	Type        string        `json:"type"`
+	Username    string        `json:"username"`   // logon
+	Signature   string        `json:"signature"`  // logon, hex, see SignLogon
+	Timestamp   uint64        `json:"timestamp"`  // logon, newOrder and ping
+	BatchBytes  uint16        `json:"batchBytes"` // logon, see LogonMessage
+	BatchDelay  uint16        `json:"batchDelay"` // logon, microseconds
+	AssetType   string        `json:"assetType"`
+	OrderType   string        `json:"orderType"`
+	Side        string        `json:"side"`
+	TimeInForce string        `json:"timeInForce"`
+	Ticker      string        `json:"ticker"`
+	Price       float64       `json:"price"`
+	Quantity    uint64        `json:"quantity"`
+	ClOrdID     uint64        `json:"clOrdId"`
+	UUID        string        `json:"uuid"`     // cancel
+	Depth       uint16        `json:"depth"`    // depth
+	ID          uint64        `json:"id"`       // ping
+	From        uint64        `json:"from"`     // resend, and candles as unix nanos
+	To          uint64        `json:"to"`       // candles, unix nanos
+	Interval    uint32        `json:"interval"` // candles, seconds
+	Limit       uint16        `json:"limit"`    // candles
+	Channel     string        `json:"channel"`  // subscribe and unsubscribe
+	GroupID     uint64        `json:"groupId"`  // orderGroup
+	Orders      []jsonMessage `json:"orders"`   // orderGroup, each a newOrder, and orderBatch, each a newOrder or cancel
+}
+
+var (
+	jsonAssetTypes = map[string]AssetType{"equities": Equities, "crypto": Crypto}
+	jsonOrderTypes = map[string]OrderType{"limit": LimitOrder, "market": MarketOrder}
+	jsonSides      = map[string]Side{"buy": Buy, "sell": Sell}
+	jsonTIFs       = map[string]TimeInForce{"day": Day, "gtc": GoodTillCancel}
+	jsonChannels   = map[string]Channel{"bbo": BBOChannel, "depth": DepthChannel, "trades": TradesChannel, "analytics": AnalyticsChannel, "topDepth": TopDepthChannel}
+
+	jsonUpdateTypes = map[MarketDataUpdateType]string{
+		LevelAdd:         "add",
+		LevelModify:      "modify",
+		LevelDelete:      "delete",
+		TradeUpdate:      "trade",
+		IndicativeUpdate: "indicative",
+	}
+	jsonSymbolStatuses = map[SymbolStatus]string{
+		SymbolNormal:   "normal",
+		SymbolStressed: "stressed",
+		SymbolHalted:   "halted",
+		SymbolPreOpen:  "preOpen",
+		SymbolClosed:   "closed",
+	}
+	jsonTradingPhases = map[TradingPhase]string{
+		PhaseContinuous: "continuous",
+		PhasePreOpen:    "preOpen",
+		PhaseHalted:     "halted",
+		PhaseClosed:     "closed",
+		PhaseScheduled:  "scheduled",
+	}
+	jsonRejectReasons = map[RejectReason]string{
+		RejectUnspecified:           "unspecified",
+		RejectMalformed:             "malformed",
+		RejectInvalidOrder:          "invalidOrder",
+		RejectUnknownSymbol:         "unknownSymbol",
+		RejectInvalidPrice:          "invalidPrice",
+		RejectInvalidTick:           "invalidTick",
+		RejectInvalidQuantity:       "invalidQuantity",
+		RejectDuplicateOrderID:      "duplicateOrderId",
+		RejectInsufficientLiquidity: "insufficientLiquidity",
+		RejectRiskBreach:            "riskBreach",
+		RejectRiskUnavailable:       "riskUnavailable",
+		RejectThrottled:             "throttled",
+		RejectTradingHalted:         "tradingHalted",
+		RejectNotEntitled:           "notEntitled",
+		RejectInternalError:         "internalError",
+		RejectMaxQuantity:           "maxQuantity",
+		RejectMaxNotional:           "maxNotional",
+		RejectPriceCollar:           "priceCollar",
+		RejectCreditLimit:           "creditLimit",
+		RejectPositionLimit:         "positionLimit",
+		RejectEngineBusy:            "engineBusy",
+	}
+	jsonExchangeStates = map[ExchangeState]string{
+		ExchangeOpen:   "open",
+		ExchangeHalted: "halted",
+		ExchangeClosed: "closed",
+		ExchangeKilled: "killed",
+	}
+	jsonStatusEvents = map[StatusEvent]string{
+		StatusCurrent:              "current",
+		StatusOpened:               "opened",
+		StatusClosed:               "closed",
+		StatusHalted:               "halted",
+		StatusResumed:              "resumed",
+		StatusComponentDegraded:    "componentDegraded",
+		StatusComponentRecovered:   "componentRecovered",
+		StatusMaintenanceScheduled: "maintenanceScheduled",
+		StatusMaintenanceCancelled: "maintenanceCancelled",
+		StatusKilled:               "killed",
+	}
+	jsonCancelReasons = map[CancelReason]string{
+		CancelRequested:     "requested",
+		AdminCancelled:      "adminCancelled",
+		AdminErroneousOrder: "erroneousOrder",
+		AdminRiskBreach:     "riskBreach",
+		AdminRegulatory:     "regulatory",
+		BrokerCancelled:     "brokerCancelled",
+		AdminKillSwitch:     "killSwitch",
+		AdminShutdown:       "shutdown",
+		MarketClosed:        "marketClosed",
+	}
+	jsonSessionNotices = map[SessionNotice]string{
+		LogonAccepted:          "logonAccepted",
+		LogonRejected:          "logonRejected",
+		DuplicateLogonRejected: "duplicateLogonRejected",
+		SessionTakeover:        "sessionTakeover",
+		SessionTakenOver:       "sessionTakenOver",
+		AuthenticationRejected: "authenticationRejected",
+		SessionResumed:         "sessionResumed",
+		LogonBlocked:           "logonBlocked",
+		CertificationPassed:    "certificationPassed",
+		CertificationFailed:    "certificationFailed",
+	}
+	jsonFlowStates = map[FlowState]string{
+		FlowThrottled:        "throttled",
+		FlowQueued:           "queued",
+		FlowSessionThrottled: "sessionThrottled",
+	}
+	jsonPriorities = map[CommandPriority]string{
+		QueryPriority:    "query",
+		NewOrderPriority: "newOrder",
+		CancelPriority:   "cancel",
+	}
+)
+
+// jsonEnum looks up an enum by name, an empty name being fallback. Unknown
+// names come back invalid, for validation to reject.
+func jsonEnum[T ~int](names map[string]T, name string, fallback T) T {
+	if name == "" {
+		return fallback
+	}
+	if value, ok := names[name]; ok {
+		return value
+	}
+	return -1
+}
+
+// jsonName is the name an enum is sent by.
+func jsonName[T comparable](names map[string]T, value T) string {
+	for name, v := range names {
+		if v == value {
+			return name
+		}
+	}
+	return ""
+}
+
+// jsonTicker pads a ticker out to the 4 bytes it is on the binary protocol.
+func jsonTicker(ticker string) (string, error) {
+	if len(ticker) > 4 {
+		return "", ErrInvalidTicker
+	}
+	return ticker + strings.Repeat("\x00", 4-len(ticker)), nil
+}
+
+// subscribeMessage asks for, or stops, market data on a channel. On the binary
+// protocol it is sent to the feed, JSON clients send it on their session.
+type subscribeMessage struct {
+	BaseMessage
+	Channel Channel
+	Ticker  string // AllTickers for every ticker
+}
+
+// ParseJSONMessage converts a JSON message into the message a binary client
+// would have sent.
+func ParseJSONMessage(data []byte) (Message, error) {
+	var m jsonMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m.message()
+}
+
+// message converts the JSON message into the message it stands for.
+func (m jsonMessage) message() (Message, error) {
+	switch m.Type {
+	case "heartbeat":
+		return BaseMessage{TypeOf: Heartbeat}, nil
+	case "logon":
+		if m.Username == "" || len(m.Username) > math.MaxUint8 {
+			return nil, ErrInvalidUsername
+		}
+		signature, err := hex.DecodeString(m.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature: %w", err)
+		}
+		return LogonMessage{
+			BaseMessage: BaseMessage{TypeOf: Logon},
+			Username:    m.Username,
+			Timestamp:   m.Timestamp,
+			Signature:   signature,
+			BatchBytes:  m.BatchBytes,
+			BatchDelay:  m.BatchDelay,
+		}, nil
+	case "newOrder":
+		return m.newOrder()
+	case "orderGroup":
+		group := OrderGroupMessage{BaseMessage: BaseMessage{TypeOf: OrderGroup}, GroupID: m.GroupID}
+		for _, o := range m.Orders {
+			order, err := o.newOrder()
+			if err != nil {
+				return nil, err
+			}
+			group.Orders = append(group.Orders, order)
+		}
+		return group, nil
+	case "orderBatch":
+		batch := OrderBatchMessage{BaseMessage: BaseMessage{TypeOf: OrderBatch}}
+		for _, o := range m.Orders {
+			if o.Type != "newOrder" && o.Type != "cancel" {
+				return nil, ErrInvalidOrderBatchEntry
+			}
+			entry, err := o.message()
+			if err != nil {
+				return nil, err
+			}
+			batch.Messages = append(batch.Messages, entry)
+		}
+		return batch, nil
+	case "cancel":
+		return CancelOrderMessage{
+			BaseMessage: BaseMessage{TypeOf: CancelOrder},
+			AssetType:   jsonEnum(jsonAssetTypes, m.AssetType, Equities),
+			OrderUUID:   m.UUID,
+			ClOrdID:     m.ClOrdID,
+		}, nil
+	case "bbo":
+		ticker, err := jsonTicker(m.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		return BBORequestMessage{BaseMessage: BaseMessage{TypeOf: BBORequest}, Ticker: ticker}, nil
+	case "depth":
+		ticker, err := jsonTicker(m.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		return BookSnapshotRequestMessage{
+			BaseMessage: BaseMessage{TypeOf: BookSnapshotRequest},
+			Ticker:      ticker,
+			Depth:       snapshotDepth(m.Depth),
+		}, nil
+	case "candles":
+		ticker, err := jsonTicker(m.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		return CandleRequestMessage{
+			BaseMessage: BaseMessage{TypeOf: CandleRequest},
+			Ticker:      ticker,
+			Interval:    m.Interval,
+			From:        unixNanos(m.From),
+			To:          unixNanos(m.To),
+			Limit:       candleLimit(m.Limit),
+		}, nil
+	case "status":
+		return BaseMessage{TypeOf: ExchangeStatusRequest}, nil
+	case "quote":
+		ticker, err := jsonTicker(m.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		return QuoteRequestMessage{BaseMessage: BaseMessage{TypeOf: QuoteRequest}, Ticker: ticker, Quantity: m.Quantity}, nil
+	case "ping":
+		return PingMessage{
+			BaseMessage:     BaseMessage{TypeOf: Ping},
+			CorrelationID:   m.ID,
+			ClientTimestamp: m.Timestamp,
+			ReceivedAt:      time.Now(),
+		}, nil
+	case "resend":
+		return ResendRequestMessage{BaseMessage: BaseMessage{TypeOf: ResendRequest}, BeginSequence: m.From}, nil
+	case "subscribe", "unsubscribe":
+		channel, ok := jsonChannels[m.Channel]
+		if !ok {
+			return nil, ErrInvalidChannel
+		}
+		ticker := AllTickers
+		if m.Ticker != "" {
+			var err error
+			if ticker, err = jsonTicker(m.Ticker); err != nil {
+				return nil, err
+			}
+		}
+		typeOf := Subscribe
+		if m.Type == "unsubscribe" {
+			typeOf = Unsubscribe
+		}
+		return subscribeMessage{BaseMessage: BaseMessage{TypeOf: typeOf}, Channel: channel, Ticker: ticker}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownJSONMessage, m.Type)
+}
+
+func (m jsonMessage) newOrder() (NewOrderMessage, error) {
+	ticker, err := jsonTicker(m.Ticker)
+	if err != nil {
+		return NewOrderMessage{}, err
+	}
+	return NewOrderMessage{
+		BaseMessage:     BaseMessage{TypeOf: NewOrder},
+		AssetType:       jsonEnum(jsonAssetTypes, m.AssetType, Equities),
+		OrderType:       jsonEnum(jsonOrderTypes, m.OrderType, LimitOrder),
+		Ticker:          ticker,
+		LimitPrice:      m.Price,
+		Quantity:        m.Quantity,
+		Side:            jsonEnum(jsonSides, m.Side, -1),
+		TimeInForce:     jsonEnum(jsonTIFs, m.TimeInForce, Day),
+		ClientTimestamp: m.Timestamp,
+		ClOrdID:         m.ClOrdID,
+	}, nil
+}
+
+// JSONReports converts reports serialized for the binary protocol into JSON
+// objects, one per report. Reports sent on a session are each preceded by their
+// sequence number, which is carried as "seq", those sent on the feed are not.
+func JSONReports(buf []byte, numbered bool) ([]map[string]any, error) {
+	var reports []map[string]any
+	for len(buf) > 0 {
+		var sequence uint64
+		if numbered {
+			if len(buf) < SequenceHeaderLen {
+				return nil, ErrReportTooShort
+			}
+			sequence = binary.BigEndian.Uint64(buf)
+			buf = buf[SequenceHeaderLen:]
+		}
+
+		report, n, err := jsonReport(buf)
+		if err != nil {
+			return nil, err
+		}
+		if numbered {
+			report["seq"] = sequence
+		}
+		reports = append(reports, report)
+		buf = buf[n:]
+	}
+	return reports, nil
+}
+
+// ReportLen returns the length of the report at the head of buf, or
+// ErrReportTooShort if not all of it is there yet, for reading reports off a
+// session as they come without converting each. Acknowledgements and execution
+// reports, most of what is sent, are measured without being read.
+func ReportLen(buf []byte) (int, error) {
+	if len(buf) < 1 {
+		return 0, ErrReportTooShort
+	}
+	n := 0
+	switch ReportMessageType(buf[0]) {
+	case OrderAckReport:
+		n = OrderAckLen
+	case CancelAckReport:
+		n = CancelAckLen
+	case CancelRejectReport:
+		n = CancelRejectLen
+	case ExecutionReport, ErrorReport:
+		if len(buf) < ReportFixedHeaderLen {
+			return 0, ErrReportTooShort
+		}
+		n = ReportFixedHeaderLen + int(binary.BigEndian.Uint32(buf[29:33])) + int(binary.BigEndian.Uint16(buf[27:29])) + int(buf[55])
+	default:
+		_, n, err := jsonReport(buf)
+		return n, err
+	}
+	if len(buf) < n {
+		return 0, ErrReportTooShort
+	}
+	return n, nil
+}
+
+// jsonReport converts the report at the head of buf, returning its length.
+func jsonReport(buf []byte) (map[string]any, int, error) {
+	if len(buf) < 1 {
+		return nil, 0, ErrReportTooShort
+	}
+	need := func(n int) error {
+		if len(buf) < n {
+			return ErrReportTooShort
+		}
+		return nil
+	}
+	ticker := func(b []byte) string {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	float := func(b []byte) float64 {
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	nanos := func(b []byte) uint64 {
+		return binary.BigEndian.Uint64(b)
+	}
+
+	switch ReportMessageType(buf[0]) {
+	case OrderAckReport:
+		if err := need(OrderAckLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "orderAck",
+			"clOrdId":    binary.BigEndian.Uint64(buf[1:9]),
+			"uuid":       string(buf[9:45]),
+			"status":     OrderStatus(buf[45]).String(),
+			"ticker":     ticker(buf[46:50]),
+			"side":       jsonName(jsonSides, Side(buf[50])),
+			"price":      float(buf[51:59]),
+			"leaves":     binary.BigEndian.Uint64(buf[59:67]),
+			"quantity":   binary.BigEndian.Uint64(buf[67:75]),
+			"qtyScale":   buf[75],
+			"priceScale": buf[76],
+			"timestamp":  nanos(buf[77:85]),
+			"groupId":    binary.BigEndian.Uint64(buf[85:93]),
+		}, OrderAckLen, nil
+	case CancelAckReport:
+		if err := need(CancelAckLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "cancelAck",
+			"clOrdId":    binary.BigEndian.Uint64(buf[1:9]),
+			"uuid":       string(buf[9:45]),
+			"ticker":     ticker(buf[45:49]),
+			"side":       jsonName(jsonSides, Side(buf[49])),
+			"price":      float(buf[50:58]),
+			"quantity":   binary.BigEndian.Uint64(buf[58:66]),
+			"qtyScale":   buf[66],
+			"priceScale": buf[67],
+			"timestamp":  nanos(buf[68:76]),
+		}, CancelAckLen, nil
+	case CancelRejectReport:
+		if err := need(CancelRejectLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":        "cancelReject",
+			"clOrdId":     binary.BigEndian.Uint64(buf[1:9]),
+			"uuid":        strings.TrimRight(string(buf[9:45]), "\x00"),
+			"reason":      CancelRejectReason(buf[45]).Error(),
+			"timestamp":   nanos(buf[46:54]),
+			"orderStatus": OrderStatus(buf[54]).String(),
+			"ticker":      ticker(buf[55:59]),
+			"filledQty":   binary.BigEndian.Uint64(buf[59:67]),
+		}, CancelRejectLen, nil
+	case LatencyReport:
+		if err := need(LatencyEchoLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":      "latency",
+			"of":        messageName(MessageType(buf[1])),
+			"readAt":    nanos(buf[2:10]),
+			"writtenAt": nanos(buf[10:18]),
+		}, LatencyEchoLen, nil
+	case PongReport:
+		if err := need(PongLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "pong",
+			"id":         binary.BigEndian.Uint64(buf[1:9]),
+			"timestamp":  nanos(buf[9:17]),
+			"receivedAt": nanos(buf[17:25]),
+			"sentAt":     nanos(buf[25:33]),
+		}, PongLen, nil
+	case QuoteReport:
+		if err := need(QuoteLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "quote",
+			"ticker":     ticker(buf[1:5]),
+			"bid":        float(buf[5:13]),
+			"ask":        float(buf[13:21]),
+			"quantity":   binary.BigEndian.Uint64(buf[21:29]),
+			"qtyScale":   buf[29],
+			"priceScale": buf[30],
+			"timestamp":  nanos(buf[31:39]),
+		}, QuoteLen, nil
+	case NettingReport:
+		if err := need(NettingLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "netting",
+			"ticker":     ticker(buf[1:5]),
+			"fills":      binary.BigEndian.Uint32(buf[5:9]),
+			"net":        int64(binary.BigEndian.Uint64(buf[9:17])),
+			"gross":      binary.BigEndian.Uint64(buf[17:25]),
+			"vwap":       float(buf[25:33]),
+			"qtyScale":   buf[33],
+			"priceScale": buf[34],
+			"firstFill":  nanos(buf[35:43]),
+			"lastFill":   nanos(buf[43:51]),
+		}, NettingLen, nil
+	case FundingReport:
+		if err := need(FundingStatementLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "funding",
+			"ticker":     ticker(buf[1:5]),
+			"rate":       float(buf[5:13]),
+			"markPrice":  float(buf[13:21]),
+			"indexPrice": float(buf[21:29]),
+			"position":   int64(binary.BigEndian.Uint64(buf[29:37])),
+			"amount":     float(buf[37:45]),
+			"qtyScale":   buf[45],
+			"priceScale": buf[46],
+			"timestamp":  nanos(buf[47:55]),
+		}, FundingStatementLen, nil
+	case BookSnapshotReport:
+		if err := need(BookSnapshotHeaderLen); err != nil {
+			return nil, 0, err
+		}
+		nBids := int(binary.BigEndian.Uint16(buf[15:17]))
+		nAsks := int(binary.BigEndian.Uint16(buf[17:19]))
+		n := BookSnapshotHeaderLen + (nBids+nAsks)*BookSnapshotLevelLen
+		if err := need(n); err != nil {
+			return nil, 0, err
+		}
+		levels := func(offset int, count int) []map[string]any {
+			out := make([]map[string]any, 0, count)
+			for i := range count {
+				level := buf[offset+i*BookSnapshotLevelLen:]
+				out = append(out, map[string]any{
+					"price":    float(level[0:8]),
+					"quantity": binary.BigEndian.Uint64(level[8:16]),
+					"orders":   binary.BigEndian.Uint32(level[16:20]),
+				})
+			}
+			return out
+		}
+		return map[string]any{
+			"type":       "bookSnapshot",
+			"ticker":     ticker(buf[1:5]),
+			"qtyScale":   buf[5],
+			"priceScale": buf[6],
+			"sequence":   binary.BigEndian.Uint64(buf[7:15]),
+			"bids":       levels(BookSnapshotHeaderLen, nBids),
+			"asks":       levels(BookSnapshotHeaderLen+nBids*BookSnapshotLevelLen, nAsks),
+		}, n, nil
+	case CandleReport:
+		if err := need(CandleHistoryHeaderLen); err != nil {
+			return nil, 0, err
+		}
+		count := int(binary.BigEndian.Uint16(buf[19:21]))
+		n := CandleHistoryHeaderLen + count*CandleLen
+		if err := need(n); err != nil {
+			return nil, 0, err
+		}
+		candles := make([]map[string]any, 0, count)
+		for i := range count {
+			c := buf[CandleHistoryHeaderLen+i*CandleLen:]
+			candles = append(candles, map[string]any{
+				"start":  nanos(c[0:8]),
+				"open":   float(c[8:16]),
+				"high":   float(c[16:24]),
+				"low":    float(c[24:32]),
+				"close":  float(c[32:40]),
+				"volume": binary.BigEndian.Uint64(c[40:48]),
+				"trades": binary.BigEndian.Uint32(c[48:52]),
+			})
+		}
+		return map[string]any{
+			"type":       "candles",
+			"ticker":     ticker(buf[1:5]),
+			"interval":   binary.BigEndian.Uint32(buf[5:9]),
+			"qtyScale":   buf[9],
+			"priceScale": buf[10],
+			"next":       nanos(buf[11:19]),
+			"candles":    candles,
+		}, n, nil
+	case ExchangeStatusReport:
+		change, n, err := ParseExchangeStatusChange(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		degraded := change.Degraded
+		if degraded == nil {
+			degraded = []string{}
+		}
+		report := map[string]any{
+			"type":      "exchangeStatus",
+			"event":     jsonStatusEvents[change.Event],
+			"state":     jsonExchangeStates[change.State],
+			"timestamp": nanos(buf[3:11]),
+			"degraded":  degraded,
+		}
+		if change.Component != "" {
+			report["component"] = change.Component
+		}
+		if !change.Maintenance.Start.IsZero() {
+			report["maintenanceStart"] = nanos(buf[11:19])
+			report["maintenanceEnd"] = nanos(buf[19:27])
+		}
+		if change.Message != "" {
+			report["message"] = change.Message
+		}
+		return report, n, nil
+	case SettlementReport:
+		if err := need(SettlementSummaryLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":      "settlement",
+			"day":       nanos(buf[1:9]),
+			"trades":    binary.BigEndian.Uint32(buf[9:13]),
+			"owners":    binary.BigEndian.Uint32(buf[13:17]),
+			"positions": binary.BigEndian.Uint32(buf[17:21]),
+			"timestamp": nanos(buf[21:29]),
+		}, SettlementSummaryLen, nil
+	case FlowControlReport:
+		flow, err := ParseFlowControl(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		remaining := make(map[string]int)
+		retryAfter := make(map[string]int64)
+		for priority, name := range jsonPriorities {
+			remaining[name] = flow.Budget.Remaining[priority]
+			retryAfter[name] = int64(flow.Budget.RetryAfter[priority])
+		}
+		return map[string]any{
+			"type":       "flowControl",
+			"state":      jsonFlowStates[flow.State],
+			"ticker":     ticker(buf[2:6]),
+			"priority":   jsonPriorities[flow.Priority],
+			"remaining":  remaining,
+			"retryAfter": retryAfter,
+			"timestamp":  nanos(buf[FlowControlLen-8 : FlowControlLen]),
+		}, FlowControlLen, nil
+	case MarketDataUpdateReport:
+		if err := need(MarketDataUpdateLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "marketData",
+			"update":     jsonUpdateTypes[MarketDataUpdateType(buf[1])],
+			"side":       jsonName(jsonSides, Side(buf[2])),
+			"ticker":     ticker(buf[3:7]),
+			"sequence":   binary.BigEndian.Uint64(buf[7:15]),
+			"timestamp":  nanos(buf[15:23]),
+			"price":      float(buf[23:31]),
+			"quantity":   binary.BigEndian.Uint64(buf[31:39]),
+			"orders":     binary.BigEndian.Uint32(buf[39:43]),
+			"qtyScale":   buf[43],
+			"priceScale": buf[44],
+		}, MarketDataUpdateLen, nil
+	case TradeTapeReport:
+		if err := need(TradeTapeLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":       "trade",
+			"ticker":     ticker(buf[1:5]),
+			"tradeId":    binary.BigEndian.Uint64(buf[5:13]),
+			"timestamp":  nanos(buf[13:21]),
+			"price":      float(buf[21:29]),
+			"quantity":   binary.BigEndian.Uint64(buf[29:37]),
+			"aggressor":  jsonName(jsonSides, Side(buf[37])),
+			"qtyScale":   buf[38],
+			"priceScale": buf[39],
+		}, TradeTapeLen, nil
+	case BBOUpdateReport:
+		if err := need(BBOUpdateLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":        "bboUpdate",
+			"ticker":      ticker(buf[1:5]),
+			"sequence":    binary.BigEndian.Uint64(buf[5:13]),
+			"bidPrice":    float(buf[13:21]),
+			"bidQuantity": binary.BigEndian.Uint64(buf[21:29]),
+			"askPrice":    float(buf[29:37]),
+			"askQuantity": binary.BigEndian.Uint64(buf[37:45]),
+			"qtyScale":    buf[45],
+			"priceScale":  buf[46],
+		}, BBOUpdateLen, nil
+	case GreeksReport:
+		if err := need(GreeksLen); err != nil {
+			return nil, 0, err
+		}
+		return map[string]any{
+			"type":            "greeks",
+			"ticker":          ticker(buf[1:5]),
+			"timestamp":       nanos(buf[5:13]),
+			"underlyingPrice": float(buf[13:21]),
+			"theo":            float(buf[21:29]),
+			"delta":           float(buf[29:37]),
+			"gamma":           float(buf[37:45]),
+			"vega":            float(buf[45:53]),
+			"theta":           float(buf[53:61]),
+			"priceScale":      buf[61],
+		}, GreeksLen, nil
+	case JournalReport:
+		// Journals are only sent to admins, over the binary protocol.
+		return nil, 0, fmt.Errorf("%w: journal", ErrInvalidMessageType)
+	}
+
+	// Everything else uses the Report layout.
+	if err := need(ReportFixedHeaderLen); err != nil {
+		return nil, 0, err
+	}
+	counterpartyLen := int(binary.BigEndian.Uint16(buf[27:29]))
+	errLen := int(binary.BigEndian.Uint32(buf[29:33]))
+	ownerLen := int(buf[55])
+	n := ReportFixedHeaderLen + errLen + counterpartyLen + ownerLen
+	if err := need(n); err != nil {
+		return nil, 0, err
+	}
+	errStr := string(buf[ReportFixedHeaderLen : ReportFixedHeaderLen+errLen])
+	counterparty := string(buf[ReportFixedHeaderLen+errLen : ReportFixedHeaderLen+errLen+counterpartyLen])
+	owner := string(buf[ReportFixedHeaderLen+errLen+counterpartyLen : n])
+	status := buf[54]
+
+	report := map[string]any{"timestamp": binary.BigEndian.Uint64(buf[3:11])}
+	order := func() {
+		report["side"] = jsonName(jsonSides, Side(buf[2]))
+		report["ticker"] = ticker(buf[33:37])
+		report["uuid"] = string(buf[37:53])
+		report["clOrdId"] = binary.BigEndian.Uint64(buf[56:64])
+		report["quantity"] = binary.BigEndian.Uint64(buf[11:19])
+		report["price"] = float(buf[19:27])
+		report["qtyScale"] = buf[53]
+		report["priceScale"] = buf[64]
+	}
+	fill := func() {
+		report["tradeId"] = binary.BigEndian.Uint64(buf[65:73])
+		report["liquidity"] = strings.ToLower(Liquidity(buf[73]).String())
+		report["leaves"] = binary.BigEndian.Uint64(buf[74:82])
+		report["cumQty"] = binary.BigEndian.Uint64(buf[82:90])
+		report["orderStatus"] = OrderStatus(buf[90]).String()
+	}
+
+	switch ReportMessageType(buf[0]) {
+	case ExecutionReport, DropCopyReport:
+		report["type"] = "execution"
+		order()
+		fill()
+		// Left out of the usual, matched, fills.
+		if tradeType := TradeType(status); tradeType != MatchedTrade {
+			report["tradeType"] = tradeType.String()
+		}
+		report["counterparty"] = counterparty
+		if errStr != "" {
+			report["reason"] = jsonRejectReasons[RejectReason(buf[91])]
+			report["error"] = errStr
+		}
+		if ReportMessageType(buf[0]) == DropCopyReport {
+			report["type"] = "dropCopy"
+			report["owner"] = owner
+		}
+	case ErrorReport:
+		report["type"] = "error"
+		report["reason"] = jsonRejectReasons[RejectReason(buf[91])]
+		report["error"] = errStr
+	case HeartbeatRequest:
+		report["type"] = "heartbeatRequest"
+	case SymbolStatusReport:
+		report["type"] = "symbolStatus"
+		report["ticker"] = ticker(buf[33:37])
+		report["status"] = jsonSymbolStatuses[SymbolStatus(status)]
+	case SessionReport:
+		report["type"] = "session"
+		report["owner"] = counterparty
+		report["notice"] = jsonSessionNotices[SessionNotice(status)]
+	case BBOReport:
+		report["type"] = "bbo"
+		report["side"] = jsonName(jsonSides, Side(buf[2]))
+		report["ticker"] = ticker(buf[33:37])
+		report["quantity"] = binary.BigEndian.Uint64(buf[11:19])
+		report["price"] = float(buf[19:27])
+		report["qtyScale"] = buf[53]
+		report["priceScale"] = buf[64]
+	case OpenOrderReport:
+		report["type"] = "openOrder"
+		order()
+		report["leaves"] = binary.BigEndian.Uint64(buf[74:82])
+		report["cumQty"] = binary.BigEndian.Uint64(buf[82:90])
+		report["orderStatus"] = OrderStatus(buf[90]).String()
+		report["timeInForce"] = jsonName(jsonTIFs, TimeInForce(status))
+	case UnsolicitedCancelReport:
+		report["type"] = "unsolicitedCancel"
+		order()
+		report["reason"] = jsonCancelReasons[CancelReason(status)]
+	case ParticipantRegisteredReport:
+		report["type"] = "participantRegistered"
+		report["id"] = counterparty
+		report["entitlements"] = status
+		report["maxOrderQuantity"] = binary.BigEndian.Uint64(buf[11:19])
+	default:
+		return nil, 0, fmt.Errorf("%w: %d", ErrInvalidMessageType, buf[0])
+	}
+	return report, n, nil
+}
@@ -0,0 +1,88 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"math"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrLogonsBlocked = Reject(RejectTradingHalted, errors.New("exchange is refusing logons"))
+
+// KillSwitchFlags are the options a kill switch is pulled with.
+type KillSwitchFlags uint8
+
+const (
+	// Refuse logons from everyone but admins until the exchange is resumed.
+	KillSwitchBlockLogons KillSwitchFlags = 1 << iota
+)
+
+// KillSwitchMessage is an admin halting the whole exchange in an emergency,
+// cancelling every resting order on every book.
+//
+//	Flags      1 byte (KillSwitchFlags)
+//	MessageLen 1 byte
+//	Message    MessageLen bytes (said to every session alongside it)
+type KillSwitchMessage struct {
+	BaseMessage
+	Flags   KillSwitchFlags
+	Message string
+}
+
+func parseKillSwitch(msg []byte) (KillSwitchMessage, error) {
+	m := KillSwitchMessage{BaseMessage: BaseMessage{TypeOf: KillSwitch}}
+
+	if len(msg) < KillSwitchHeaderLen || len(msg) < KillSwitchHeaderLen+int(msg[1]) {
+		return KillSwitchMessage{}, ErrMessageTooShort
+	}
+	m.Flags = KillSwitchFlags(msg[0])
+	m.Message = string(msg[KillSwitchHeaderLen : KillSwitchHeaderLen+int(msg[1])])
+
+	return m, nil
+}
+
+// PullKillSwitch halts the exchange and cancels every resting order on behalf
+// of admin, returning the orders cancelled. Every session is told the exchange
+// was killed, and each owner of an order is sent an unsolicited cancel for it.
+// New orders are refused, as are logons from anyone but admins if asked, until
+// the exchange is resumed or opened again.
+//
+// The exchange is halted before anything is cancelled, so nothing can be
+// placed in between. It must be run from the session handler.
+func (s *Server) PullKillSwitch(admin string, origin CommandOrigin, flags KillSwitchFlags, message string) ([]Order, error) {
+	if len(message) > math.MaxUint8 {
+		return nil, ErrStatusFieldTooLong
+	}
+
+	s.clientSessionsLock.Lock()
+	status := s.exchangeStatusLockFree()
+	status.State = ExchangeHalted
+	if flags&KillSwitchBlockLogons != 0 {
+		status.State = ExchangeKilled
+	}
+	status.Message = message
+	err := s.changeExchangeStatusLockFree(status, StatusKilled, "")
+	s.clientSessionsLock.Unlock()
+	if err != nil {
+		// Some session was not told, the rest still were.
+		log.Error().Err(err).Msg("unable to broadcast kill switch")
+	}
+
+	return s.engine.Apply(Command{Origin: origin, Type: KillSwitchCommand, Owner: admin})
+}
+
+// pullKillSwitch pulls the kill switch on behalf of the admin on clientAddress.
+func (s *Server) pullKillSwitch(clientAddress string, origin CommandOrigin, request KillSwitchMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+	_, err := s.PullKillSwitch(s.sessionOwner(clientAddress), origin, request.Flags, request.Message)
+	return err
+}
+
+// logonsBlockedLockFree returns whether owner is refused logons by the kill
+// switch.
+func (s *Server) logonsBlockedLockFree(owner string) bool {
+	return s.status.State == ExchangeKilled && !s.admins[owner]
+}
@@ -0,0 +1,235 @@
+package net
+
+import (
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets is how many buckets a LatencyHistogram counts in. The first
+// is of latencies under a microsecond, each after it twice as wide as the one
+// before, the last taking whatever is over about nine minutes.
+const latencyBuckets = 30
+
+// LatencyHistogram counts latencies in buckets doubling in width from a
+// microsecond, enough to tell the median from the tail without keeping every
+// one. It is safe for concurrent use.
+type LatencyHistogram struct {
+	lock    sync.Mutex
+	buckets [latencyBuckets]uint64
+	count   uint64
+	sum     time.Duration
+	max     time.Duration
+}
+
+// Observe counts a latency.
+func (histogram *LatencyHistogram) Observe(latency time.Duration) {
+	latency = max(latency, 0)
+	bucket := min(bits.Len64(uint64(latency/time.Microsecond)), latencyBuckets-1)
+
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+	histogram.buckets[bucket]++
+	histogram.count++
+	histogram.sum += latency
+	histogram.max = max(histogram.max, latency)
+}
+
+// LatencyStats summarises a LatencyHistogram, every latency in nanoseconds.
+// Quantiles are the upper bound of the bucket they fall in, so are at most
+// twice what they are really, and never more than Max.
+type LatencyStats struct {
+	Count   uint64          `json:"count"`
+	Mean    time.Duration   `json:"mean"`
+	P50     time.Duration   `json:"p50"`
+	P90     time.Duration   `json:"p90"`
+	P99     time.Duration   `json:"p99"`
+	P999    time.Duration   `json:"p999"`
+	Max     time.Duration   `json:"max"`
+	Buckets []LatencyBucket `json:"buckets"` // Those counted in, fastest first
+}
+
+// LatencyBucket is how many latencies were under UpTo, and at least the UpTo
+// of the bucket before.
+type LatencyBucket struct {
+	UpTo  time.Duration `json:"upTo"`
+	Count uint64        `json:"count"`
+}
+
+// Stats summarises what has been counted so far.
+func (histogram *LatencyHistogram) Stats() LatencyStats {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	stats := LatencyStats{Count: histogram.count, Max: histogram.max, Buckets: []LatencyBucket{}}
+	if histogram.count == 0 {
+		return stats
+	}
+	stats.Mean = histogram.sum / time.Duration(histogram.count)
+	quantile := func(q float64) time.Duration {
+		rank := uint64(q * float64(histogram.count))
+		seen := uint64(0)
+		for bucket, count := range histogram.buckets {
+			seen += count
+			if seen > rank {
+				return min(histogram.upTo(bucket), histogram.max)
+			}
+		}
+		return histogram.max
+	}
+	stats.P50, stats.P90, stats.P99, stats.P999 = quantile(0.5), quantile(0.9), quantile(0.99), quantile(0.999)
+	for bucket, count := range histogram.buckets {
+		if count > 0 {
+			stats.Buckets = append(stats.Buckets, LatencyBucket{UpTo: histogram.upTo(bucket), Count: count})
+		}
+	}
+	return stats
+}
+
+// upTo is the latency bucket counts those under, the largest counted for the
+// last bucket.
+func (histogram *LatencyHistogram) upTo(bucket int) time.Duration {
+	if bucket == latencyBuckets-1 {
+		return histogram.max
+	}
+	return time.Microsecond << bucket
+}
+
+// arrivedAt is when a message read off its socket at readAt, in real time,
+// arrived on clock. On the system clock it is readAt itself.
+func arrivedAt(clock Clock, readAt time.Time) time.Time {
+	if _, ok := clock.(SystemClock); ok {
+		return readAt
+	}
+	return clock.Now()
+}
+
+// messageNames name message types in stats and JSON reports, as their JSON
+// messages are where they have one, see ParseJSONMessage.
+var messageNames = map[MessageType]string{
+	NewOrder:              "newOrder",
+	CancelOrder:           "cancel",
+	Logon:                 "logon",
+	BBORequest:            "bbo",
+	BookSnapshotRequest:   "depth",
+	AdminCancel:           "adminCancel",
+	DropCopySubscribe:     "dropCopy",
+	Ping:                  "ping",
+	RegisterParticipant:   "registerParticipant",
+	ResendRequest:         "resend",
+	JournalRequest:        "journal",
+	QuoteRequest:          "quote",
+	OrderGroup:            "orderGroup",
+	OrderBatch:            "orderBatch",
+	CandleRequest:         "candles",
+	ExchangeStatusRequest: "status",
+	ExchangeStatusUpdate:  "statusUpdate",
+	KillSwitch:            "killSwitch",
+	SettleRequest:         "settle",
+	TradingPhaseOverride:  "tradingPhase",
+}
+
+// messageName is what message type t is called in stats and JSON reports.
+func messageName(t MessageType) string {
+	if name, ok := messageNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// Latency returns how long messages took from being read off their session's
+// socket to the reports they caused being written back to it, by the type of
+// message. Reports to other sessions, e.g. counterparties, are not waited on,
+// and those batched are counted as written once they are batched.
+func (s *Server) Latency() map[string]LatencyStats {
+	s.latencyLock.Lock()
+	defer s.latencyLock.Unlock()
+	latency := make(map[string]LatencyStats, len(s.latency))
+	for t, histogram := range s.latency {
+		latency[messageName(t)] = histogram.Stats()
+	}
+	return latency
+}
+
+// SetLatencyEcho has every message a session sends answered, once the reports
+// it caused have been written, by a LatencyEcho saying when it was read and
+// when they were, so clients can tell time spent in the exchange from that
+// spent getting to it. Off, the default, sends none.
+func (s *Server) SetLatencyEcho(echo bool) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.echoLatency = echo
+}
+
+// recordLatency counts message's latency once the reports sessionHandler wrote
+// back to its client in handling it have been, see Latency, echoing it if
+// asked to.
+func (s *Server) recordLatency(message ClientMessage) {
+	if message.readAt.IsZero() {
+		return
+	}
+	t := message.message.GetType()
+	s.latencyLock.Lock()
+	histogram, ok := s.latency[t]
+	if !ok {
+		histogram = &LatencyHistogram{}
+		s.latency[t] = histogram
+	}
+	s.latencyLock.Unlock()
+
+	s.afterWrites(message.clientAddress, func() {
+		writtenAt := time.Now()
+		histogram.Observe(writtenAt.Sub(message.readAt))
+
+		s.clientSessionsLock.Lock()
+		defer s.clientSessionsLock.Unlock()
+		session, ok := s.connections[message.clientAddress]
+		if !ok || !s.echoLatency {
+			return
+		}
+		echo := LatencyEcho{Of: t, ReadAt: message.readAt, WrittenAt: writtenAt}
+		if err := session.send(echo.Serialize()); err != nil {
+			s.closeConnectionLockFree(message.clientAddress)
+		}
+	})
+}
+
+// LatencyEcho follows the reports a message caused, once they are written, if
+// the server echoes latency, see SetLatencyEcho.
+//
+//	MessageType 1 byte (LatencyReport)
+//	Of          1 byte (MessageType of the message)
+//	ReadAt      8 bytes (unix nanos it was read off the socket)
+//	WrittenAt   8 bytes (unix nanos the reports it caused were written)
+type LatencyEcho struct {
+	Of        MessageType
+	ReadAt    time.Time
+	WrittenAt time.Time
+}
+
+const LatencyEchoLen = 1 + 1 + 8 + 8
+
+// Serialize converts the echo to be sent on the wire.
+func (echo LatencyEcho) Serialize() []byte {
+	buf := make([]byte, LatencyEchoLen)
+	buf[0] = byte(LatencyReport)
+	buf[1] = byte(echo.Of)
+	binary.BigEndian.PutUint64(buf[2:10], uint64(echo.ReadAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[10:18], uint64(echo.WrittenAt.UnixNano()))
+	return buf
+}
+
+// ParseLatencyEcho reads an echo serialized by Serialize.
+func ParseLatencyEcho(buf []byte) (LatencyEcho, error) {
+	if len(buf) < LatencyEchoLen {
+		return LatencyEcho{}, ErrReportTooShort
+	}
+	return LatencyEcho{
+		Of:        MessageType(buf[1]),
+		ReadAt:    time.Unix(0, int64(binary.BigEndian.Uint64(buf[2:10]))),
+		WrittenAt: time.Unix(0, int64(binary.BigEndian.Uint64(buf[10:18]))),
+	}, nil
+}
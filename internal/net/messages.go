@@ -1,10 +1,10 @@
 package net
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	. "fenrir/internal/common"
-	"fmt"
 	"math"
 	"time"
 
@@ -12,9 +12,10 @@ import (
 )
 
 var (
-	ErrInvalidMessageType = errors.New("invalid message type")
-	ErrMessageTooShort    = errors.New("message too short for specified username length")
-	ErrInvalidUUID        = errors.New("invalid uuid")
+	ErrInvalidMessageType = Reject(RejectMalformed, errors.New("invalid message type"))
+	ErrMessageTooShort    = Reject(RejectMalformed, errors.New("message too short"))
+	ErrInvalidUUID        = Reject(RejectMalformed, errors.New("invalid uuid"))
+	ErrInvalidUsername    = Reject(RejectMalformed, errors.New("invalid username"))
 )
 
 type MessageType int
@@ -25,6 +26,40 @@ const (
 	CancelOrder
 	// Debug Messages
 	LogBook
+	// Session Messages
+	Logon
+	// Market Data Messages
+	BBORequest
+	BookSnapshotRequest
+	// Admin Messages
+	AdminCancel
+	// Feed Messages, only valid on the market data feed
+	Subscribe
+	Unsubscribe
+	// Drop Copy Messages
+	DropCopySubscribe
+	// Latency Messages
+	Ping
+	// Admin Messages
+	RegisterParticipant
+	// Session Messages
+	ResendRequest
+	// Admin Messages
+	JournalRequest
+	// Quote Messages
+	QuoteRequest
+	// Order Messages
+	OrderGroup
+	OrderBatch
+	// Market Data Messages
+	CandleRequest
+	// Status Messages
+	ExchangeStatusRequest
+	// Admin Messages
+	ExchangeStatusUpdate
+	KillSwitch
+	SettleRequest
+	TradingPhaseOverride
 )
 
 type ReportMessageType int
@@ -33,7 +68,52 @@ const (
 	HeartbeatRequest ReportMessageType = iota
 	ExecutionReport
 	ErrorReport
-	OrderPlacedReport
+	// OrderAckReport does not use the Report layout, see OrderAck.
+	OrderAckReport
+	SymbolStatusReport
+	SessionReport
+	BBOReport
+	// BookSnapshotReport does not use the Report layout, see BookSnapshot.
+	BookSnapshotReport
+	OpenOrderReport
+	UnsolicitedCancelReport
+	// MarketDataUpdateReport does not use the Report layout, see
+	// serializeMarketDataUpdate.
+	MarketDataUpdateReport
+	DropCopyReport
+	// TradeTapeReport does not use the Report layout, see TradeTape.
+	TradeTapeReport
+	// BBOUpdateReport does not use the Report layout, see serializeBBOUpdate.
+	BBOUpdateReport
+	// PongReport does not use the Report layout, see Pong.
+	PongReport
+	// CancelAckReport does not use the Report layout, see CancelAck.
+	CancelAckReport
+	// CancelRejectReport does not use the Report layout, see CancelReject.
+	CancelRejectReport
+	ParticipantRegisteredReport
+	// JournalReport does not use the Report layout, see SessionJournal.
+	JournalReport
+	// QuoteReport does not use the Report layout, see QuoteResponse.
+	QuoteReport
+	// NettingReport does not use the Report layout, see Netting.
+	NettingReport
+	// CandleReport does not use the Report layout, see CandleHistory.
+	CandleReport
+	// ExchangeStatusReport does not use the Report layout, see
+	// ExchangeStatusChange.
+	ExchangeStatusReport
+	// FlowControlReport does not use the Report layout, see FlowControl.
+	FlowControlReport
+	// SettlementReport does not use the Report layout, see
+	// SettlementSummary.
+	SettlementReport
+	// GreeksReport does not use the Report layout, see serializeGreeks.
+	GreeksReport
+	// FundingReport does not use the Report layout, see FundingStatement.
+	FundingReport
+	// LatencyReport does not use the Report layout, see LatencyEcho.
+	LatencyReport
 )
 
 type Message interface {
@@ -42,9 +122,38 @@ type Message interface {
 
 // Message format constants
 const (
-	BaseMessageHeaderLen        = 2
-	NewOrderMessageHeaderLen    = 2 + 2 + 4 + 8 + 8 + 1
-	CancelOrderMessageHeaderLen = 2 + 16
+	BaseMessageHeaderLen          = 2
+	NewOrderMessageHeaderLen      = 2 + 2 + 4 + 8 + 8 + 1 + 1 + 8 + 8
+	CancelOrderMessageHeaderLen   = 2 + UUIDLen + 8
+	LogonMessageHeaderLen         = 1
+	LogonAuthLen                  = 8 + LogonSignatureLen
+	LogonBatchingLen              = 2 + 2
+	BBORequestMessageHeaderLen    = 4
+	BookSnapshotRequestHeaderLen  = 4 + 2
+	AdminCancelMessageHeaderLen   = 1 + 1 + 4 + UUIDLen
+	SubscribeHeaderLen            = 1 + 4
+	DropCopySubscribeHeaderLen    = 1 + 1
+	PingMessageHeaderLen          = 8 + 8
+	RegisterParticipantHeaderLen  = 1 + 1 + 1 + 8 + 1 + 8 + 1 + 1
+	ResendRequestHeaderLen        = 8
+	JournalRequestHeaderLen       = 1 + 4
+	QuoteRequestHeaderLen         = 4 + 8
+	OrderGroupHeaderLen           = 8 + 1
+	OrderBatchHeaderLen           = 1
+	CandleRequestHeaderLen        = 4 + 4 + 8 + 8 + 2
+	ExchangeStatusUpdateHeaderLen = 1 + 8 + 8 + 1 + 1
+	KillSwitchHeaderLen           = 1 + 1
+	SettleRequestHeaderLen        = 8
+	TradingPhaseOverrideHeaderLen = 1 + 1 + 4
+)
+
+// UUIDLen is the length of a full, canonical form, order uuid.
+const UUIDLen = 36
+
+// Book snapshot constants
+const (
+	DefaultSnapshotDepth = 10
+	MaxSnapshotDepth     = 100
 )
 
 // Generic message type.
@@ -62,31 +171,110 @@ type LogBookMessage struct {
 
 func parseMessage(msg []byte) (Message, error) {
 	if len(msg) < BaseMessageHeaderLen {
-		return BaseMessage{}, errors.New("message too short to contain header")
+		return BaseMessage{}, ErrMessageTooShort
 	}
 
 	typeOf := MessageType(binary.BigEndian.Uint16(msg[0:2]))
 	msg = msg[2:]
 	switch typeOf {
+	case Heartbeat:
+		return BaseMessage{TypeOf: Heartbeat}, nil
 	case NewOrder:
 		return parseNewOrder(msg)
 	case CancelOrder:
 		return parseCancelOrder(msg)
 	case LogBook:
 		return LogBookMessage{BaseMessage{TypeOf: LogBook}}, nil
+	case Logon:
+		return parseLogon(msg)
+	case BBORequest:
+		return parseBBORequest(msg)
+	case BookSnapshotRequest:
+		return parseBookSnapshotRequest(msg)
+	case AdminCancel:
+		return parseAdminCancel(msg)
+	case DropCopySubscribe:
+		return parseDropCopySubscribe(msg)
+	case Ping:
+		return parsePing(msg)
+	case RegisterParticipant:
+		return parseRegisterParticipant(msg)
+	case ResendRequest:
+		return parseResendRequest(msg)
+	case JournalRequest:
+		return parseJournalRequest(msg)
+	case QuoteRequest:
+		return parseQuoteRequest(msg)
+	case OrderGroup:
+		return parseOrderGroup(msg)
+	case OrderBatch:
+		return parseOrderBatch(msg)
+	case CandleRequest:
+		return parseCandleRequest(msg)
+	case ExchangeStatusRequest:
+		return BaseMessage{TypeOf: ExchangeStatusRequest}, nil
+	case ExchangeStatusUpdate:
+		return parseExchangeStatusUpdate(msg)
+	case KillSwitch:
+		return parseKillSwitch(msg)
+	case SettleRequest:
+		return parseSettleRequest(msg)
+	case TradingPhaseOverride:
+		return parseTradingPhaseOverride(msg)
 	default:
 		return BaseMessage{}, ErrInvalidMessageType
 	}
 }
 
+// commandRoutes returns the tickers of the books a message is addressed to, if
+// any, along with its priority for throttling.
+func commandRoutes(message Message) ([]string, CommandPriority) {
+	switch m := message.(type) {
+	case NewOrderMessage:
+		return []string{m.Ticker}, NewOrderPriority
+	case OrderGroupMessage:
+		var tickers []string
+		for _, order := range m.Orders {
+			tickers = append(tickers, order.Ticker)
+		}
+		return tickers, NewOrderPriority
+	case OrderBatchMessage:
+		// Only its new orders, as with cancels sent alone.
+		var tickers []string
+		for _, entry := range m.Messages {
+			if order, ok := entry.(NewOrderMessage); ok {
+				tickers = append(tickers, order.Ticker)
+			}
+		}
+		return tickers, NewOrderPriority
+	case QuoteRequestMessage:
+		// The quoter may add liquidity to answer it.
+		return []string{m.Ticker}, NewOrderPriority
+	case BBORequestMessage:
+		return []string{m.Ticker}, QueryPriority
+	case BookSnapshotRequestMessage:
+		return []string{m.Ticker}, QueryPriority
+	case CandleRequestMessage:
+		return []string{m.Ticker}, QueryPriority
+	}
+	return nil, QueryPriority
+}
+
 type NewOrderMessage struct {
 	BaseMessage
-	AssetType  AssetType // 2 bytes
-	OrderType  OrderType // 2 bytes
-	Ticker     string    // 4 bytes
-	LimitPrice float64   // 8 bytes
-	Quantity   uint64    // 8 bytes
-	Side       Side      // 1 byte
+	AssetType   AssetType   // 2 bytes
+	OrderType   OrderType   // 2 bytes
+	Ticker      string      // 4 bytes
+	LimitPrice  float64     // 8 bytes
+	Quantity    uint64      // 8 bytes
+	Side        Side        // 1 byte
+	TimeInForce TimeInForce // 1 byte
+	// Unix nanos the client sent the order at, 0 if it does not say.
+	ClientTimestamp uint64 // 8 bytes
+	// Client chosen id, 0 for none. It is echoed back on every report about the
+	// order and can be cancelled by, so clients need not wait for the UUID.
+	ClOrdID    uint64    // 8 bytes
+	ReceivedAt time.Time // Stamped by the server as the order is parsed
 }
 
 // Order generates an Order type, given an owner.
@@ -96,57 +284,580 @@ func (o *NewOrderMessage) Order(owner string) (Order, error) {
 		return Order{}, ErrInvalidUUID
 	}
 
+	// The order arrived when the gateway read it off the wire.
+	received := o.ReceivedAt
+	if received.IsZero() {
+		received = time.Now()
+	}
+	var clientTimestamp time.Time
+	if o.ClientTimestamp != 0 {
+		clientTimestamp = time.Unix(0, int64(o.ClientTimestamp))
+	}
+
 	return Order{
-		UUID:          orderUUID,
-		AssetType:     o.AssetType,
-		OrderType:     o.OrderType,
-		Ticker:        o.Ticker,
-		Side:          o.Side,
-		LimitPrice:    o.LimitPrice,
-		Quantity:      o.Quantity,
-		TotalQuantity: o.Quantity,
-		Timestamp:     time.Now(),
-		Owner:         owner,
+		UUID:            orderUUID,
+		ClOrdID:         o.ClOrdID,
+		AssetType:       o.AssetType,
+		OrderType:       o.OrderType,
+		TimeInForce:     o.TimeInForce,
+		Ticker:          o.Ticker,
+		Side:            o.Side,
+		LimitPrice:      o.LimitPrice,
+		Quantity:        o.Quantity,
+		TotalQuantity:   o.Quantity,
+		ClientTimestamp: clientTimestamp,
+		Timestamp:       received,
+		Owner:           owner,
 	}, nil
 }
 
 func parseNewOrder(msg []byte) (NewOrderMessage, error) {
-	m := NewOrderMessage{BaseMessage: BaseMessage{TypeOf: NewOrder}}
+	var m NewOrderMessage
+	if err := decodeNewOrder(msg, &m, nil); err != nil {
+		return NewOrderMessage{}, err
+	}
+	return m, nil
+}
 
+// decodeNewOrder decodes msg into m, taking its ticker from tickers.
+func decodeNewOrder(msg []byte, m *NewOrderMessage, tickers tickerTable) error {
+	if len(msg) < NewOrderMessageHeaderLen {
+		return ErrMessageTooShort
+	}
+
+	m.BaseMessage = BaseMessage{TypeOf: NewOrder}
 	m.AssetType = AssetType(binary.BigEndian.Uint16(msg[0:2]))
 	m.OrderType = OrderType(binary.BigEndian.Uint16(msg[2:4]))
-	m.Ticker = string(msg[4:8]) // Assuming ASCII/UTF-8 string
+	m.Ticker = tickers.intern(msg[4:8]) // Assuming ASCII/UTF-8 string
 	m.LimitPrice = math.Float64frombits(binary.BigEndian.Uint64(msg[8:16]))
 	m.Quantity = binary.BigEndian.Uint64(msg[16:24])
 	m.Side = Side(msg[24])
-
-	// Calculate expected total length.
-	expectedTotalLen := int(NewOrderMessageHeaderLen)
-	if len(msg) < expectedTotalLen {
-		return NewOrderMessage{}, ErrMessageTooShort
-	}
-
-	return m, nil
+	m.TimeInForce = TimeInForce(msg[25])
+	m.ClientTimestamp = binary.BigEndian.Uint64(msg[26:34])
+	m.ClOrdID = binary.BigEndian.Uint64(msg[34:42])
+	m.ReceivedAt = time.Now()
+	return nil
 }
 
+// CancelOrderMessage cancels an order by its UUID or, if the UUID is left
+// blank (zeroed), by the ClOrdID its owner gave it.
 type CancelOrderMessage struct {
 	BaseMessage
 	AssetType AssetType // 2 bytes
-	OrderUUID string    // 16 bytes
+	OrderUUID string    // 36 bytes
+	ClOrdID   uint64    // 8 bytes
 }
 
 func parseCancelOrder(msg []byte) (CancelOrderMessage, error) {
-	m := CancelOrderMessage{BaseMessage: BaseMessage{TypeOf: CancelOrder}}
+	var m CancelOrderMessage
+	if err := decodeCancelOrder(msg, &m); err != nil {
+		return CancelOrderMessage{}, err
+	}
+	return m, nil
+}
 
+// decodeCancelOrder decodes msg into m. Only the UUID is allocated, and only if
+// it is not blank.
+func decodeCancelOrder(msg []byte, m *CancelOrderMessage) error {
 	if len(msg) < CancelOrderMessageHeaderLen {
-		return CancelOrderMessage{}, ErrMessageTooShort
+		return ErrMessageTooShort
 	}
+	m.BaseMessage = BaseMessage{TypeOf: CancelOrder}
 	m.AssetType = AssetType(binary.BigEndian.Uint16(msg[0:2]))
-	m.OrderUUID = string(msg[2:16])
+	m.OrderUUID = string(bytes.TrimRight(msg[2:2+UUIDLen], "\x00"))
+	m.ClOrdID = binary.BigEndian.Uint64(msg[2+UUIDLen : 2+UUIDLen+8])
+	return nil
+}
+
+// LogonMessage must be the first message on a connection.
+//
+//	Username  1 byte length, n bytes
+//	Timestamp 8 bytes (unix nanos the logon was signed at)
+//	Signature  LogonSignatureLen bytes, see SignLogon
+//	BatchBytes 2 bytes, see reportBatcher (0 for reports as they are sent)
+//	BatchDelay 2 bytes (microseconds)
+//
+// The batching asked for is capped by the server, see SetReportBatchLimits.
+type LogonMessage struct {
+	BaseMessage
+	Username   string
+	Timestamp  uint64
+	Signature  []byte
+	BatchBytes uint16 // Most bytes of reports held back to write together
+	BatchDelay uint16 // Most microseconds a report is held back for
+}
+
+func parseLogon(msg []byte) (LogonMessage, error) {
+	m := LogonMessage{BaseMessage: BaseMessage{TypeOf: Logon}}
+
+	if len(msg) < LogonMessageHeaderLen {
+		return LogonMessage{}, ErrMessageTooShort
+	}
+	usernameLen := int(msg[0])
+	if usernameLen == 0 {
+		return LogonMessage{}, ErrInvalidUsername
+	}
+	if len(msg) < LogonMessageHeaderLen+usernameLen+LogonAuthLen+LogonBatchingLen {
+		return LogonMessage{}, ErrMessageTooShort
+	}
+	m.Username = string(msg[1 : 1+usernameLen])
+	msg = msg[1+usernameLen:]
+	m.Timestamp = binary.BigEndian.Uint64(msg[0:8])
+	m.Signature = msg[8 : 8+LogonSignatureLen]
+	msg = msg[LogonAuthLen:]
+	m.BatchBytes = binary.BigEndian.Uint16(msg[0:2])
+	m.BatchDelay = binary.BigEndian.Uint16(msg[2:4])
+
+	return m, nil
+}
+
+type BBORequestMessage struct {
+	BaseMessage
+	Ticker string // 4 bytes
+}
+
+func parseBBORequest(msg []byte) (BBORequestMessage, error) {
+	m := BBORequestMessage{BaseMessage: BaseMessage{TypeOf: BBORequest}}
+
+	if len(msg) < BBORequestMessageHeaderLen {
+		return BBORequestMessage{}, ErrMessageTooShort
+	}
+	m.Ticker = string(msg[0:4])
+
+	return m, nil
+}
+
+type BookSnapshotRequestMessage struct {
+	BaseMessage
+	Ticker string // 4 bytes
+	Depth  uint16 // 2 bytes, levels per side
+}
+
+func parseBookSnapshotRequest(msg []byte) (BookSnapshotRequestMessage, error) {
+	m := BookSnapshotRequestMessage{BaseMessage: BaseMessage{TypeOf: BookSnapshotRequest}}
+
+	if len(msg) < BookSnapshotRequestHeaderLen {
+		return BookSnapshotRequestMessage{}, ErrMessageTooShort
+	}
+	m.Ticker = string(msg[0:4])
+	m.Depth = snapshotDepth(binary.BigEndian.Uint16(msg[4:6]))
+
+	return m, nil
+}
+
+// snapshotDepth is how many levels a snapshot asking for depth gets. Zero asks
+// for the default, anything too large is clamped.
+func snapshotDepth(depth uint16) uint16 {
+	if depth == 0 {
+		return DefaultSnapshotDepth
+	}
+	return min(depth, MaxSnapshotDepth)
+}
+
+// AdminCancelScope is what an AdminCancelMessage applies to.
+type AdminCancelScope uint8
+
+const (
+	// Cancel the single order given by OrderUUID.
+	AdminCancelOrderScope AdminCancelScope = iota
+	// Cancel every order resting on Ticker.
+	AdminCancelSymbolScope
+)
+
+type AdminCancelMessage struct {
+	BaseMessage
+	Scope     AdminCancelScope // 1 byte
+	Reason    CancelReason     // 1 byte
+	Ticker    string           // 4 bytes
+	OrderUUID string           // 36 bytes
+}
+
+func parseAdminCancel(msg []byte) (AdminCancelMessage, error) {
+	m := AdminCancelMessage{BaseMessage: BaseMessage{TypeOf: AdminCancel}}
+
+	if len(msg) < AdminCancelMessageHeaderLen {
+		return AdminCancelMessage{}, ErrMessageTooShort
+	}
+	m.Scope = AdminCancelScope(msg[0])
+	m.Reason = CancelReason(msg[1])
+	m.Ticker = string(msg[2:6])
+	m.OrderUUID = string(msg[6 : 6+UUIDLen])
+
+	return m, nil
+}
+
+// DropCopySubscribeMessage asks for copies of execution reports, filtered to
+// the given symbols and participants. An empty list does not filter.
+//
+//	SymbolCount      1 byte
+//	ParticipantCount 1 byte
+//	Symbols          4 bytes each
+//	Participants     1 byte length, n bytes each
+type DropCopySubscribeMessage struct {
+	BaseMessage
+	Symbols      []string
+	Participants []string
+}
+
+func parseDropCopySubscribe(msg []byte) (DropCopySubscribeMessage, error) {
+	m := DropCopySubscribeMessage{BaseMessage: BaseMessage{TypeOf: DropCopySubscribe}}
+
+	if len(msg) < DropCopySubscribeHeaderLen {
+		return DropCopySubscribeMessage{}, ErrMessageTooShort
+	}
+	nSymbols, nParticipants := int(msg[0]), int(msg[1])
+	msg = msg[DropCopySubscribeHeaderLen:]
+
+	if len(msg) < nSymbols*4 {
+		return DropCopySubscribeMessage{}, ErrMessageTooShort
+	}
+	for i := range nSymbols {
+		m.Symbols = append(m.Symbols, string(msg[i*4:i*4+4]))
+	}
+	msg = msg[nSymbols*4:]
+
+	for range nParticipants {
+		if len(msg) < 1 || len(msg) < 1+int(msg[0]) {
+			return DropCopySubscribeMessage{}, ErrMessageTooShort
+		}
+		m.Participants = append(m.Participants, string(msg[1:1+int(msg[0])]))
+		msg = msg[1+int(msg[0]):]
+	}
+
+	return m, nil
+}
+
+// PingMessage asks the server to answer with a Pong straight away, so a client
+// can measure the round trip through the gateway without touching the books.
+//
+//	CorrelationID   8 bytes (client chosen, echoed back)
+//	ClientTimestamp 8 bytes (unix nanos, echoed back)
+type PingMessage struct {
+	BaseMessage
+	CorrelationID   uint64
+	ClientTimestamp uint64
+	ReceivedAt      time.Time // Stamped by the server as the ping is parsed
+}
+
+func parsePing(msg []byte) (PingMessage, error) {
+	m := PingMessage{BaseMessage: BaseMessage{TypeOf: Ping}, ReceivedAt: time.Now()}
+
+	if len(msg) < PingMessageHeaderLen {
+		return PingMessage{}, ErrMessageTooShort
+	}
+	m.CorrelationID = binary.BigEndian.Uint64(msg[0:8])
+	m.ClientTimestamp = binary.BigEndian.Uint64(msg[8:16])
+
+	return m, nil
+}
+
+// RegisterParticipantMessage onboards a new participant, admins only.
+//
+//	IDLen            1 byte
+//	SecretLen        1 byte
+//	Entitlements     1 byte
+//	MaxOrderQuantity 8 bytes (lots, 0 for no limit)
+//	FeeTier          1 byte
+//	CreditLimit      8 bytes (float64, 0 for no limit)
+//	MarginMode       1 byte
+//	DataTier         1 byte
+//	ID               n bytes
+//	Secret           n bytes
+type RegisterParticipantMessage struct {
+	BaseMessage
+	Participant Participant
+}
+
+func parseRegisterParticipant(msg []byte) (RegisterParticipantMessage, error) {
+	m := RegisterParticipantMessage{BaseMessage: BaseMessage{TypeOf: RegisterParticipant}}
+
+	if len(msg) < RegisterParticipantHeaderLen {
+		return RegisterParticipantMessage{}, ErrMessageTooShort
+	}
+	idLen, secretLen := int(msg[0]), int(msg[1])
+	if len(msg) < RegisterParticipantHeaderLen+idLen+secretLen {
+		return RegisterParticipantMessage{}, ErrMessageTooShort
+	}
+	m.Participant.Entitlements = Entitlement(msg[2])
+	m.Participant.MaxOrderQuantity = binary.BigEndian.Uint64(msg[3:11])
+	m.Participant.FeeTier = msg[11]
+	m.Participant.CreditLimit = math.Float64frombits(binary.BigEndian.Uint64(msg[12:20]))
+	m.Participant.MarginMode = MarginMode(msg[20])
+	m.Participant.DataTier = DataTier(msg[21])
+	msg = msg[RegisterParticipantHeaderLen:]
+	m.Participant.ID = string(msg[:idLen])
+	m.Participant.Secret = string(msg[idLen : idLen+secretLen])
+
+	return m, nil
+}
+
+// ResendRequestMessage asks for the reports sent to the session to be sent
+// again, from BeginSequence onwards. Clients send it on spotting a gap in the
+// sequence numbers, or after reconnecting to a session.
+//
+//	BeginSequence 8 bytes
+type ResendRequestMessage struct {
+	BaseMessage
+	BeginSequence uint64
+}
+
+func parseResendRequest(msg []byte) (ResendRequestMessage, error) {
+	m := ResendRequestMessage{BaseMessage: BaseMessage{TypeOf: ResendRequest}}
+
+	if len(msg) < ResendRequestHeaderLen {
+		return ResendRequestMessage{}, ErrMessageTooShort
+	}
+	m.BeginSequence = binary.BigEndian.Uint64(msg[0:8])
+
+	return m, nil
+}
+
+// JournalRequestMessage asks for the journal of an owner's session, admins
+// only.
+//
+//	OwnerLen 1 byte
+//	Limit    4 bytes (latest entries, 0 for all kept)
+//	Owner    n bytes
+type JournalRequestMessage struct {
+	BaseMessage
+	Owner string
+	Limit uint32
+}
+
+func parseJournalRequest(msg []byte) (JournalRequestMessage, error) {
+	m := JournalRequestMessage{BaseMessage: BaseMessage{TypeOf: JournalRequest}}
+
+	if len(msg) < JournalRequestHeaderLen {
+		return JournalRequestMessage{}, ErrMessageTooShort
+	}
+	ownerLen := int(msg[0])
+	if len(msg) < JournalRequestHeaderLen+ownerLen {
+		return JournalRequestMessage{}, ErrMessageTooShort
+	}
+	m.Limit = binary.BigEndian.Uint32(msg[1:5])
+	m.Owner = string(msg[JournalRequestHeaderLen : JournalRequestHeaderLen+ownerLen])
 
 	return m, nil
 }
 
+// Pong answers a Ping. The gap between ReceivedAt and SentAt is time spent in
+// the gateway, the rest of the round trip is the network.
+//
+//	MessageType     1 byte (PongReport)
+//	CorrelationID   8 bytes
+//	ClientTimestamp 8 bytes
+//	ReceivedAt      8 bytes (unix nanos)
+//	SentAt          8 bytes (unix nanos)
+type Pong struct {
+	CorrelationID   uint64
+	ClientTimestamp uint64
+	ReceivedAt      time.Time
+	SentAt          time.Time
+}
+
+const PongLen = 1 + 8 + 8 + 8 + 8
+
+// Serialize converts the pong to be sent on the wire.
+func (pong Pong) Serialize() []byte {
+	buf := make([]byte, PongLen)
+	buf[0] = byte(PongReport)
+	binary.BigEndian.PutUint64(buf[1:9], pong.CorrelationID)
+	binary.BigEndian.PutUint64(buf[9:17], pong.ClientTimestamp)
+	binary.BigEndian.PutUint64(buf[17:25], uint64(pong.ReceivedAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[25:33], uint64(pong.SentAt.UnixNano()))
+	return buf
+}
+
+// OrderAck acknowledges a successfully placed order, telling the client the
+// UUID the exchange knows it by. Orders which are rejected get an ErrorReport
+// instead.
+//
+//	MessageType     1 byte (OrderAckReport)
+//	ClOrdID         8 bytes (as sent on the NewOrder)
+//	UUID            36 bytes
+//	Status          1 byte (OrderStatus)
+//	Ticker          4 bytes
+//	Side            1 byte
+//	Price           8 bytes
+//	LeavesQuantity  8 bytes (still resting)
+//	TotalQuantity   8 bytes
+//	QuantityScale   1 byte
+//	PriceScale      1 byte
+//	Timestamp       8 bytes (unix nanos)
+//	GroupID         8 bytes (as sent on the OrderGroup, 0 if not in one)
+type OrderAck struct {
+	ClOrdID        uint64
+	UUID           string
+	Status         OrderStatus
+	Ticker         string
+	Side           Side
+	Price          float64
+	LeavesQuantity uint64
+	TotalQuantity  uint64
+	QuantityScale  uint8
+	PriceScale     uint8
+	Timestamp      time.Time
+	GroupID        uint64
+}
+
+const OrderAckLen = 1 + 8 + UUIDLen + 1 + 4 + 1 + 8 + 8 + 8 + 1 + 1 + 8 + 8
+
+// Serialize converts the acknowledgement to be sent on the wire.
+func (ack OrderAck) Serialize() []byte {
+	return ack.AppendTo(make([]byte, 0, OrderAckLen))
+}
+
+// AppendTo appends the acknowledgement as it is sent on the wire to dst.
+func (ack OrderAck) AppendTo(dst []byte) []byte {
+	dst, buf := grow(dst, OrderAckLen)
+	buf[0] = byte(OrderAckReport)
+	binary.BigEndian.PutUint64(buf[1:9], ack.ClOrdID)
+	copy(buf[9:45], ack.UUID)
+	buf[45] = byte(ack.Status)
+	copy(buf[46:50], ack.Ticker)
+	buf[50] = byte(ack.Side)
+	binary.BigEndian.PutUint64(buf[51:59], math.Float64bits(ack.Price))
+	binary.BigEndian.PutUint64(buf[59:67], ack.LeavesQuantity)
+	binary.BigEndian.PutUint64(buf[67:75], ack.TotalQuantity)
+	buf[75] = ack.QuantityScale
+	buf[76] = ack.PriceScale
+	binary.BigEndian.PutUint64(buf[77:85], uint64(ack.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(buf[85:93], ack.GroupID)
+	return dst
+}
+
+// CancelAck confirms an order was cancelled at its owner's request.
+//
+//	MessageType       1 byte (CancelAckReport)
+//	ClOrdID           8 bytes
+//	UUID              36 bytes
+//	Ticker            4 bytes
+//	Side              1 byte
+//	Price             8 bytes
+//	CancelledQuantity 8 bytes (what was left on the book)
+//	QuantityScale     1 byte
+//	PriceScale        1 byte
+//	Timestamp         8 bytes (unix nanos)
+type CancelAck struct {
+	ClOrdID           uint64
+	UUID              string
+	Ticker            string
+	Side              Side
+	Price             float64
+	CancelledQuantity uint64
+	QuantityScale     uint8
+	PriceScale        uint8
+	Timestamp         time.Time
+}
+
+const CancelAckLen = 1 + 8 + UUIDLen + 4 + 1 + 8 + 8 + 1 + 1 + 8
+
+// Serialize converts the acknowledgement to be sent on the wire.
+func (ack CancelAck) Serialize() []byte {
+	return ack.AppendTo(make([]byte, 0, CancelAckLen))
+}
+
+// AppendTo appends the acknowledgement as it is sent on the wire to dst.
+func (ack CancelAck) AppendTo(dst []byte) []byte {
+	dst, buf := grow(dst, CancelAckLen)
+	buf[0] = byte(CancelAckReport)
+	binary.BigEndian.PutUint64(buf[1:9], ack.ClOrdID)
+	copy(buf[9:45], ack.UUID)
+	copy(buf[45:49], ack.Ticker)
+	buf[49] = byte(ack.Side)
+	binary.BigEndian.PutUint64(buf[50:58], math.Float64bits(ack.Price))
+	binary.BigEndian.PutUint64(buf[58:66], ack.CancelledQuantity)
+	buf[66] = ack.QuantityScale
+	buf[67] = ack.PriceScale
+	binary.BigEndian.PutUint64(buf[68:76], uint64(ack.Timestamp.UnixNano()))
+	return dst
+}
+
+// CancelReject tells a client their cancel was refused, and where the order
+// stands instead so they can reconcile. It echoes back whichever of the UUID
+// and ClOrdID it was sent with, filling in the other if the order is theirs.
+// Orders which are not the client's are always OrderUnknown.
+//
+//	MessageType 1 byte (CancelRejectReport)
+//	ClOrdID     8 bytes
+//	UUID        36 bytes
+//	Reason      1 byte (CancelRejectReason)
+//	Timestamp   8 bytes (unix nanos)
+//	OrderStatus 1 byte
+//	Ticker      4 bytes (empty unless the order is known)
+//	FilledQty   8 bytes (of the order so far)
+type CancelReject struct {
+	ClOrdID     uint64
+	UUID        string
+	Reason      CancelRejectReason
+	Timestamp   time.Time
+	OrderStatus OrderStatus
+	Ticker      string
+	FilledQty   uint64
+}
+
+const CancelRejectLen = 1 + 8 + UUIDLen + 1 + 8 + 1 + 4 + 8
+
+// Serialize converts the reject to be sent on the wire.
+func (reject CancelReject) Serialize() []byte {
+	buf := make([]byte, CancelRejectLen)
+	buf[0] = byte(CancelRejectReport)
+	binary.BigEndian.PutUint64(buf[1:9], reject.ClOrdID)
+	copy(buf[9:45], reject.UUID)
+	buf[45] = byte(reject.Reason)
+	binary.BigEndian.PutUint64(buf[46:54], uint64(reject.Timestamp.UnixNano()))
+	buf[54] = byte(reject.OrderStatus)
+	copy(buf[55:59], reject.Ticker)
+	binary.BigEndian.PutUint64(buf[59:67], reject.FilledQty)
+	return buf
+}
+
+// BookSnapshot is the response to a BookSnapshotRequest. It has its own layout
+// rather than the Report one, as it carries a variable number of levels:
+//
+//	MessageType   1 byte (BookSnapshotReport)
+//	Ticker        4 bytes
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+//	Sequence      8 bytes (of the last market data update applied)
+//	BidLevels     2 bytes
+//	AskLevels     2 bytes
+//	Levels        BookSnapshotLevelLen bytes each, bids then asks, best first
+type BookSnapshot struct {
+	BookDepth
+}
+
+const (
+	BookSnapshotHeaderLen = 1 + 4 + 1 + 1 + 8 + 2 + 2
+	// Price 8 bytes, Quantity 8 bytes, Orders 4 bytes
+	BookSnapshotLevelLen = 8 + 8 + 4
+)
+
+// Serialize converts the snapshot to be sent on the wire.
+func (snap BookSnapshot) Serialize() ([]byte, error) {
+	nLevels := len(snap.Bids) + len(snap.Asks)
+	buf := make([]byte, BookSnapshotHeaderLen+nLevels*BookSnapshotLevelLen)
+
+	buf[0] = byte(BookSnapshotReport)
+	copy(buf[1:5], snap.Ticker)
+	buf[5] = snap.QuantityScale
+	buf[6] = snap.PriceScale
+	binary.BigEndian.PutUint64(buf[7:15], snap.Sequence)
+	binary.BigEndian.PutUint16(buf[15:17], uint16(len(snap.Bids)))
+	binary.BigEndian.PutUint16(buf[17:19], uint16(len(snap.Asks)))
+
+	offset := BookSnapshotHeaderLen
+	for _, levels := range [][]DepthLevel{snap.Bids, snap.Asks} {
+		for _, level := range levels {
+			binary.BigEndian.PutUint64(buf[offset:offset+8], math.Float64bits(level.Price))
+			binary.BigEndian.PutUint64(buf[offset+8:offset+16], level.Quantity)
+			binary.BigEndian.PutUint32(buf[offset+16:offset+20], level.Orders)
+			offset += BookSnapshotLevelLen
+		}
+	}
+	return buf, nil
+}
+
 type Report struct {
 	MessageType     ReportMessageType // 1 byte
 	AssetType       AssetType         // 1 byte
@@ -156,18 +867,56 @@ type Report struct {
 	Price           float64           // 8 bytes
 	CounterpartyLen uint16            // 2 bytes
 	ErrStrLen       uint32            // 4 bytes
+	OwnerLen        uint8             // 1 byte
 	Ticker          string            // 4 bytes
 	UUID            string            // 16 bytes
-	Err             string            // n bytes
+	QuantityScale   uint8             // 1 byte
+	Status          uint8             // 1 byte (SymbolStatus, SessionNotice or a fill's TradeType)
+	ClOrdID         uint64            // 8 bytes (of the order reported on, 0 if none)
+	PriceScale      uint8             // 1 byte
+	TradeID         uint64            // 8 bytes (of the fill reported on, 0 if none)
+	Liquidity       Liquidity         // 1 byte
+	LeavesQuantity  uint64            // 8 bytes (of the order reported on)
+	CumQuantity     uint64            // 8 bytes (of the order reported on, filled so far)
+	OrderStatus     OrderStatus       // 1 byte (of the order reported on)
+	RejectReason    RejectReason      // 1 byte (why Err happened, see RejectReasonOf)
+	Err             string            // n bytes (optional text alongside RejectReason)
 	Counterparty    string            // n bytes (in this case we show who)
+	Owner           string            // n bytes (whose report this is, for drop copies)
 }
 
-const reportFixedHeaderLen = 1 + 1 + 1 + 8 + 8 + 8 + 2 + 4 + 4 + 16
+// ReportFixedHeaderLen is the size of the fixed portion of a serialized Report.
+// Quantity is in lots, which are interpreted using QuantityScale decimal places,
+// and Price is to PriceScale decimal places.
+const ReportFixedHeaderLen = 1 + 1 + 1 + 8 + 8 + 8 + 2 + 4 + 4 + 16 + 1 + 1 + 1 + 8 + 1 + 8 + 1 + 8 + 8 + 1 + 1
 
 // Serialize converts the report to be sent on the wire.
 func (r Report) Serialize() ([]byte, error) {
-	totalSize := reportFixedHeaderLen + len(r.Err) + len(r.Counterparty)
+	return r.AppendTo(make([]byte, 0, r.Len())), nil
+}
 
+// Len returns the length of the report on the wire.
+func (r Report) Len() int {
+	r = r.fitted()
+	return ReportFixedHeaderLen + len(r.Err) + len(r.Counterparty) + len(r.Owner)
+}
+
+// fitted returns the report with its strings cut to what their lengths can
+// say, and the lengths set to match, so what is sent always reads back the
+// same whatever the lengths were left as.
+func (r Report) fitted() Report {
+	r.Err = r.Err[:min(len(r.Err), math.MaxUint32)]
+	r.Counterparty = r.Counterparty[:min(len(r.Counterparty), math.MaxUint16)]
+	r.Owner = r.Owner[:min(len(r.Owner), math.MaxUint8)]
+	r.ErrStrLen = uint32(len(r.Err))
+	r.CounterpartyLen = uint16(len(r.Counterparty))
+	r.OwnerLen = uint8(len(r.Owner))
+	return r
+}
+
+// AppendTo appends the report as it is sent on the wire to dst.
+func (r Report) AppendTo(dst []byte) []byte {
+	r = r.fitted()
 	// Pad when unset
 	if len(r.Ticker) < 4 {
 		r.Ticker = "XXXX"
@@ -176,7 +925,7 @@ func (r Report) Serialize() ([]byte, error) {
 		r.UUID = "XXXXXXXXXXXXXXXX"
 	}
 
-	buf := make([]byte, totalSize)
+	dst, buf := grow(dst, r.Len())
 	buf[0] = byte(r.MessageType)
 	buf[1] = byte(r.AssetType)
 	buf[2] = byte(r.Side)
@@ -187,11 +936,23 @@ func (r Report) Serialize() ([]byte, error) {
 	binary.BigEndian.PutUint32(buf[29:33], r.ErrStrLen)
 
 	// Pack Strings (Ticker and UUID) into fixed buffers
-	// copy() ensures we don't panic if strings are shorter.
-	copy(buf[33:37], r.Ticker[:4])
-	copy(buf[37:53], r.UUID[:16])
+	// copy() ensures we don't panic if strings are shorter, and cuts them
+	// short if longer.
+	copy(buf[33:37], r.Ticker)
+	copy(buf[37:53], r.UUID)
+	buf[53] = r.QuantityScale
+	buf[54] = r.Status
+	buf[55] = r.OwnerLen
+	binary.BigEndian.PutUint64(buf[56:64], r.ClOrdID)
+	buf[64] = r.PriceScale
+	binary.BigEndian.PutUint64(buf[65:73], r.TradeID)
+	buf[73] = byte(r.Liquidity)
+	binary.BigEndian.PutUint64(buf[74:82], r.LeavesQuantity)
+	binary.BigEndian.PutUint64(buf[82:90], r.CumQuantity)
+	buf[90] = byte(r.OrderStatus)
+	buf[91] = byte(r.RejectReason)
 
-	offset := reportFixedHeaderLen
+	offset := ReportFixedHeaderLen
 	if r.ErrStrLen > 0 {
 		copy(buf[offset:], r.Err)
 	}
@@ -199,19 +960,78 @@ func (r Report) Serialize() ([]byte, error) {
 	if r.CounterpartyLen > 0 {
 		copy(buf[offset:], r.Counterparty)
 	}
-	return buf, nil
+	offset += int(r.CounterpartyLen)
+	if r.OwnerLen > 0 {
+		copy(buf[offset:], r.Owner)
+	}
+	return dst
+}
+
+// ParseReport reads a report serialized by Serialize at the head of buf,
+// returning its length. Only reports of the Report layout can be read, see
+// ReportMessageType.
+func ParseReport(buf []byte) (Report, int, error) {
+	if len(buf) < ReportFixedHeaderLen {
+		return Report{}, 0, ErrReportTooShort
+	}
+	r := Report{
+		MessageType:     ReportMessageType(buf[0]),
+		AssetType:       AssetType(buf[1]),
+		Side:            Side(buf[2]),
+		Timestamp:       binary.BigEndian.Uint64(buf[3:11]),
+		Quantity:        binary.BigEndian.Uint64(buf[11:19]),
+		Price:           math.Float64frombits(binary.BigEndian.Uint64(buf[19:27])),
+		CounterpartyLen: binary.BigEndian.Uint16(buf[27:29]),
+		ErrStrLen:       binary.BigEndian.Uint32(buf[29:33]),
+		Ticker:          string(buf[33:37]),
+		UUID:            string(buf[37:53]),
+		QuantityScale:   buf[53],
+		Status:          buf[54],
+		OwnerLen:        buf[55],
+		ClOrdID:         binary.BigEndian.Uint64(buf[56:64]),
+		PriceScale:      buf[64],
+		TradeID:         binary.BigEndian.Uint64(buf[65:73]),
+		Liquidity:       Liquidity(buf[73]),
+		LeavesQuantity:  binary.BigEndian.Uint64(buf[74:82]),
+		CumQuantity:     binary.BigEndian.Uint64(buf[82:90]),
+		OrderStatus:     OrderStatus(buf[90]),
+		RejectReason:    RejectReason(buf[91]),
+	}
+
+	// The lengths are checked as a whole before any string is read, so a
+	// length past the end of buf is never sliced up to.
+	n := ReportFixedHeaderLen
+	if uint64(len(buf)-n) < uint64(r.ErrStrLen)+uint64(r.CounterpartyLen)+uint64(r.OwnerLen) {
+		return Report{}, 0, ErrReportTooShort
+	}
+	r.Err = string(buf[n : n+int(r.ErrStrLen)])
+	n += int(r.ErrStrLen)
+	r.Counterparty = string(buf[n : n+int(r.CounterpartyLen)])
+	n += int(r.CounterpartyLen)
+	r.Owner = string(buf[n : n+int(r.OwnerLen)])
+	n += int(r.OwnerLen)
+	return r, n, nil
 }
 
-// generateTradeReports generates both trade reports required addressable to
-// the respective counterparty.
-func generateWireTradeReports(trade Trade, err error) ([]byte, []byte, error) {
-	errStr := ""
+// createTradeReports creates both trade reports required addressable to the
+// respective counterparty.
+func createTradeReports(trade Trade, err error) (Report, Report) {
+	errStr, reason := "", RejectUnspecified
 	if err != nil {
-		errStr = fmt.Sprintf("%w", err)
+		errStr, reason = err.Error(), RejectReasonOf(err)
 	}
 
-	// Helper to create a report.
-	createReport := func(party *Order, counterParty *Order, trade Trade) Report {
+	// Helper to create a report. The party is the taker, as it was the
+	// order which traded on arrival.
+	createReport := func(party *Order, counterParty *Order, liquidity Liquidity) Report {
+		status := OrderPartiallyFilled
+		if party.Quantity == 0 {
+			status = OrderFilled
+		}
+		if trade.Type == ManualTrade {
+			// Neither side made nor took liquidity.
+			liquidity = LiquidityNone
+		}
 		return Report{
 			MessageType:     ExecutionReport,
 			AssetType:       counterParty.AssetType,
@@ -221,51 +1041,294 @@ func generateWireTradeReports(trade Trade, err error) ([]byte, []byte, error) {
 			Price:           trade.Price,
 			CounterpartyLen: uint16(len(counterParty.Owner)),
 			ErrStrLen:       uint32(len(errStr)),
-			Ticker:          party.Ticker[:4],
-			UUID:            party.UUID[:16],
+			Ticker:          party.Ticker,
+			UUID:            party.UUID,
+			ClOrdID:         party.ClOrdID,
+			QuantityScale:   party.QuantityScale,
+			PriceScale:      party.PriceScale,
+			TradeID:         trade.ID,
+			Status:          uint8(trade.Type),
+			Liquidity:       liquidity,
+			LeavesQuantity:  party.Quantity,
+			CumQuantity:     party.TotalQuantity - party.Quantity,
+			OrderStatus:     status,
+			RejectReason:    reason,
 			Counterparty:    counterParty.Owner,
 			Err:             errStr,
 		}
 	}
 
-	// Create struct representations
-	r1 := createReport(trade.Party, trade.CounterParty, trade)
-	r2 := createReport(trade.CounterParty, trade.Party, trade)
+	return createReport(trade.Party, trade.CounterParty, LiquidityTaker),
+		createReport(trade.CounterParty, trade.Party, LiquidityMaker)
+}
+
+// tradeReportsLockFree creates both trade reports required addressable to the
+// respective counterparty, disclosing as much of each counterparty as the
+// server does. The caller must hold clientSessionsLock.
+func (s *Server) tradeReportsLockFree(trade Trade, err error) (Report, Report) {
+	r1, r2 := createTradeReports(trade, err)
+	s.discloseLockFree(&r1)
+	s.discloseLockFree(&r2)
+	return r1, r2
+}
+
+// generateWireDropCopyReport converts an execution report into a copy for an
+// observer, tagged with whose report it is.
+func generateWireDropCopyReport(report Report, owner string) ([]byte, error) {
+	report.MessageType = DropCopyReport
+	report.OwnerLen = uint8(len(owner))
+	report.Owner = owner[:report.OwnerLen]
+	return report.Serialize()
+}
 
-	// Serialize to []byte
-	b1, err := r1.Serialize()
+// generateWireErrorReports tells a client why their message was rejected, as
+// a RejectReason they can act on and the error's text for people to read.
+func generateWireErrorReports(err error) ([]byte, error) {
+	errStr := err.Error()
+	report := Report{
+		MessageType:  ErrorReport,
+		Timestamp:    uint64(time.Now().UnixNano()),
+		RejectReason: RejectReasonOf(err),
+		ErrStrLen:    uint32(len(errStr)),
+		Err:          errStr,
+	}
+	return report.Serialize()
+}
+
+// generateWireHeartbeatRequest asks a quiet client to show it is still there.
+func generateWireHeartbeatRequest() ([]byte, error) {
+	return Report{
+		MessageType: HeartbeatRequest,
+		Timestamp:   uint64(time.Now().UnixNano()),
+	}.Serialize()
+}
+
+func generateWireSymbolStatusReport(ticker string, status SymbolStatus) ([]byte, error) {
+	return Report{
+		MessageType: SymbolStatusReport,
+		Timestamp:   uint64(time.Now().UnixNano()),
+		Ticker:      ticker,
+		Status:      uint8(status),
+	}.Serialize()
+}
+
+// generateWireParticipantRegisteredReport confirms a participant was onboarded.
+func generateWireParticipantRegisteredReport(participant Participant) ([]byte, error) {
+	return Report{
+		MessageType:     ParticipantRegisteredReport,
+		Timestamp:       uint64(time.Now().UnixNano()),
+		Status:          uint8(participant.Entitlements),
+		Quantity:        participant.MaxOrderQuantity,
+		CounterpartyLen: uint16(len(participant.ID)),
+		Counterparty:    participant.ID,
+	}.Serialize()
+}
+
+func generateWireSessionReport(owner string, notice SessionNotice) ([]byte, error) {
+	return Report{
+		MessageType:     SessionReport,
+		Timestamp:       uint64(time.Now().UnixNano()),
+		Status:          uint8(notice),
+		CounterpartyLen: uint16(len(owner)),
+		Counterparty:    owner,
+	}.Serialize()
+}
+
+// generateWireBBOReports generates a report per side of the book. A side with no
+// liquidity is reported with zero quantity.
+func generateWireBBOReports(bbo BBO) ([]byte, []byte, error) {
+	createReport := func(side Side, price float64, quantity uint64) Report {
+		return Report{
+			MessageType:   BBOReport,
+			Side:          side,
+			Timestamp:     uint64(time.Now().UnixNano()),
+			Quantity:      quantity,
+			Price:         price,
+			Ticker:        bbo.Ticker,
+			QuantityScale: bbo.QuantityScale,
+			PriceScale:    bbo.PriceScale,
+		}
+	}
+
+	bid, err := createReport(Buy, bbo.BidPrice, bbo.BidQuantity).Serialize()
 	if err != nil {
 		return nil, nil, err
 	}
-
-	b2, err := r2.Serialize()
+	ask, err := createReport(Sell, bbo.AskPrice, bbo.AskQuantity).Serialize()
 	if err != nil {
 		return nil, nil, err
 	}
-
-	return b1, b2, nil
+	return bid, ask, nil
 }
 
-func generateWireErrorReports(err error) ([]byte, error) {
-	errStr := fmt.Sprintf("%w", err)
-	report := Report{
-		MessageType: ErrorReport,
-		Timestamp:   uint64(time.Now().UnixNano()),
-		ErrStrLen:   uint32(len(errStr)),
-		Err:         errStr,
+// generateWireOpenOrderReport describes an order still resting in the book, sent
+// to owners when they log on so they can reconcile their view of the book.
+func generateWireOpenOrderReport(ord Order) ([]byte, error) {
+	status := OrderNew
+	if ord.Quantity < ord.TotalQuantity {
+		status = OrderPartiallyFilled
 	}
-	return report.Serialize()
+	return Report{
+		MessageType:    OpenOrderReport,
+		AssetType:      ord.AssetType,
+		Side:           ord.Side,
+		Timestamp:      uint64(ord.ExchTimestamp.UnixNano()),
+		Quantity:       ord.Quantity,
+		Price:          ord.LimitPrice,
+		Ticker:         ord.Ticker,
+		UUID:           ord.UUID,
+		ClOrdID:        ord.ClOrdID,
+		QuantityScale:  ord.QuantityScale,
+		PriceScale:     ord.PriceScale,
+		Status:         uint8(ord.TimeInForce),
+		LeavesQuantity: ord.Quantity,
+		CumQuantity:    ord.TotalQuantity - ord.Quantity,
+		OrderStatus:    status,
+	}.Serialize()
 }
 
-func generateWireOrderPlacedReport(ord Order) ([]byte, error) {
+func generateWireUnsolicitedCancelReport(ord Order, reason CancelReason) ([]byte, error) {
 	return Report{
-		MessageType: OrderPlacedReport,
-		AssetType:   ord.AssetType,
-		Side:        ord.Side,
-		Timestamp:   uint64(time.Now().UnixNano()),
-		Quantity:    ord.Quantity,
-		Price:       ord.LimitPrice,
-		Ticker:      ord.Ticker[:4],
-		UUID:        ord.UUID[:16],
+		MessageType:   UnsolicitedCancelReport,
+		AssetType:     ord.AssetType,
+		Side:          ord.Side,
+		Timestamp:     uint64(time.Now().UnixNano()),
+		Quantity:      ord.Quantity,
+		Price:         ord.LimitPrice,
+		Ticker:        ord.Ticker,
+		UUID:          ord.UUID,
+		ClOrdID:       ord.ClOrdID,
+		QuantityScale: ord.QuantityScale,
+		PriceScale:    ord.PriceScale,
+		Status:        uint8(reason),
 	}.Serialize()
 }
+
+// MarketDataUpdateLen is the size of a serialized market data update:
+//
+//	MessageType   1 byte (MarketDataUpdateReport)
+//	UpdateType    1 byte
+//	Side          1 byte
+//	Ticker        4 bytes
+//	Sequence      8 bytes
+//	Timestamp     8 bytes
+//	Price         8 bytes
+//	Quantity      8 bytes
+//	Orders        4 bytes
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+const MarketDataUpdateLen = 1 + 1 + 1 + 4 + 8 + 8 + 8 + 8 + 4 + 1 + 1
+
+func serializeMarketDataUpdate(update MarketDataUpdate) []byte {
+	buf := make([]byte, MarketDataUpdateLen)
+	buf[0] = byte(MarketDataUpdateReport)
+	buf[1] = byte(update.Type)
+	buf[2] = byte(update.Side)
+	copy(buf[3:7], update.Ticker)
+	binary.BigEndian.PutUint64(buf[7:15], update.Sequence)
+	binary.BigEndian.PutUint64(buf[15:23], uint64(update.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(buf[23:31], math.Float64bits(update.Price))
+	binary.BigEndian.PutUint64(buf[31:39], update.Quantity)
+	binary.BigEndian.PutUint32(buf[39:43], update.Orders)
+	buf[43] = update.QuantityScale
+	buf[44] = update.PriceScale
+	return buf
+}
+
+// TradeTape is a public time and sales print of a single match. It does not
+// identify either party.
+//
+//	MessageType   1 byte (TradeTapeReport)
+//	Ticker        4 bytes
+//	TradeID       8 bytes
+//	Timestamp     8 bytes
+//	Price         8 bytes
+//	Quantity      8 bytes
+//	Aggressor     1 byte (the taker's side)
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+type TradeTape struct {
+	Ticker        string
+	TradeID       uint64
+	Timestamp     time.Time
+	Price         float64
+	Quantity      uint64
+	Aggressor     Side
+	QuantityScale uint8
+	PriceScale    uint8
+}
+
+const TradeTapeLen = 1 + 4 + 8 + 8 + 8 + 8 + 1 + 1 + 1
+
+// Serialize converts the print to be sent on the wire.
+func (tape TradeTape) Serialize() []byte {
+	buf := make([]byte, TradeTapeLen)
+	buf[0] = byte(TradeTapeReport)
+	copy(buf[1:5], tape.Ticker)
+	binary.BigEndian.PutUint64(buf[5:13], tape.TradeID)
+	binary.BigEndian.PutUint64(buf[13:21], uint64(tape.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(buf[21:29], math.Float64bits(tape.Price))
+	binary.BigEndian.PutUint64(buf[29:37], tape.Quantity)
+	buf[37] = byte(tape.Aggressor)
+	buf[38] = tape.QuantityScale
+	buf[39] = tape.PriceScale
+	return buf
+}
+
+// BBOUpdateLen is the size of a serialized top of book update.
+const BBOUpdateLen = 1 + 4 + 8 + 8 + 8 + 8 + 8 + 1 + 1
+
+// serializeBBOUpdate converts a top of book change to be sent on the feed.
+//
+//	MessageType   1 byte (BBOUpdateReport)
+//	Ticker        4 bytes
+//	Sequence      8 bytes
+//	BidPrice      8 bytes
+//	BidQuantity   8 bytes
+//	AskPrice      8 bytes
+//	AskQuantity   8 bytes
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+func serializeBBOUpdate(bbo BBO) []byte {
+	buf := make([]byte, BBOUpdateLen)
+	buf[0] = byte(BBOUpdateReport)
+	copy(buf[1:5], bbo.Ticker)
+	binary.BigEndian.PutUint64(buf[5:13], bbo.Sequence)
+	binary.BigEndian.PutUint64(buf[13:21], math.Float64bits(bbo.BidPrice))
+	binary.BigEndian.PutUint64(buf[21:29], bbo.BidQuantity)
+	binary.BigEndian.PutUint64(buf[29:37], math.Float64bits(bbo.AskPrice))
+	binary.BigEndian.PutUint64(buf[37:45], bbo.AskQuantity)
+	buf[45] = bbo.QuantityScale
+	buf[46] = bbo.PriceScale
+	return buf
+}
+
+// GreeksLen is the size of a serialized option valuation.
+const GreeksLen = 1 + 4 + 8 + 8 + 8 + 8 + 8 + 8 + 8 + 1
+
+// serializeGreeks converts an option's valuation to be sent on the feed.
+//
+//	MessageType     1 byte (GreeksReport)
+//	Ticker          4 bytes (the option)
+//	Timestamp       8 bytes
+//	UnderlyingPrice 8 bytes
+//	Theo            8 bytes
+//	Delta           8 bytes
+//	Gamma           8 bytes
+//	Vega            8 bytes
+//	Theta           8 bytes
+//	PriceScale      1 byte
+func serializeGreeks(greeks Greeks) []byte {
+	buf := make([]byte, GreeksLen)
+	buf[0] = byte(GreeksReport)
+	copy(buf[1:5], greeks.Ticker)
+	binary.BigEndian.PutUint64(buf[5:13], uint64(greeks.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(buf[13:21], math.Float64bits(greeks.UnderlyingPrice))
+	binary.BigEndian.PutUint64(buf[21:29], math.Float64bits(greeks.Theo))
+	binary.BigEndian.PutUint64(buf[29:37], math.Float64bits(greeks.Delta))
+	binary.BigEndian.PutUint64(buf[37:45], math.Float64bits(greeks.Gamma))
+	binary.BigEndian.PutUint64(buf[45:53], math.Float64bits(greeks.Vega))
+	binary.BigEndian.PutUint64(buf[53:61], math.Float64bits(greeks.Theta))
+	buf[61] = greeks.PriceScale
+	return buf
+}
@@ -0,0 +1,185 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Netting collapses an owner's fills on a symbol since their last netting
+// report, so high frequency participants can book one figure rather than every
+// execution. Fills are still reported individually as they happen.
+//
+//	MessageType   1 byte (NettingReport)
+//	Ticker        4 bytes
+//	Fills         4 bytes
+//	NetQuantity   8 bytes (signed, bought less sold)
+//	GrossQuantity 8 bytes (bought and sold)
+//	VWAP          8 bytes (of every fill, either side)
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+//	FirstFill     8 bytes (unix nanos)
+//	LastFill      8 bytes (unix nanos)
+type Netting struct {
+	Ticker        string
+	Fills         uint32
+	NetQuantity   int64
+	GrossQuantity uint64
+	VWAP          float64
+	QuantityScale uint8
+	PriceScale    uint8
+	FirstFill     time.Time
+	LastFill      time.Time
+}
+
+const NettingLen = 1 + 4 + 4 + 8 + 8 + 8 + 1 + 1 + 8 + 8
+
+// Serialize converts the netting report to be sent on the wire.
+func (netting Netting) Serialize() []byte {
+	buf := make([]byte, NettingLen)
+	buf[0] = byte(NettingReport)
+	copy(buf[1:5], netting.Ticker)
+	binary.BigEndian.PutUint32(buf[5:9], netting.Fills)
+	binary.BigEndian.PutUint64(buf[9:17], uint64(netting.NetQuantity))
+	binary.BigEndian.PutUint64(buf[17:25], netting.GrossQuantity)
+	binary.BigEndian.PutUint64(buf[25:33], math.Float64bits(netting.VWAP))
+	buf[33] = netting.QuantityScale
+	buf[34] = netting.PriceScale
+	binary.BigEndian.PutUint64(buf[35:43], uint64(netting.FirstFill.UnixNano()))
+	binary.BigEndian.PutUint64(buf[43:51], uint64(netting.LastFill.UnixNano()))
+	return buf
+}
+
+// Netter accumulates the fills of the owners it nets for, until they are taken
+// to be reported.
+type Netter struct {
+	owners  map[string]bool
+	pending map[PositionKey]*pendingNetting
+}
+
+// pendingNetting is a Netting being added up.
+type pendingNetting struct {
+	Netting
+	notional float64 // Price times quantity, over every fill
+}
+
+func NewNetter(owners ...string) *Netter {
+	netter := &Netter{
+		owners:  make(map[string]bool),
+		pending: make(map[PositionKey]*pendingNetting),
+	}
+	for _, owner := range owners {
+		netter.owners[owner] = true
+	}
+	return netter
+}
+
+// AddTrade nets whichever sides of the trade belong to owners netted for.
+func (netter *Netter) AddTrade(trade Trade) {
+	for _, order := range []*Order{trade.Party, trade.CounterParty} {
+		if !netter.owners[order.Owner] {
+			continue
+		}
+
+		key := PositionKey{Owner: order.Owner, Ticker: order.Ticker}
+		n, ok := netter.pending[key]
+		if !ok {
+			n = &pendingNetting{Netting: Netting{
+				Ticker:        order.Ticker,
+				QuantityScale: order.QuantityScale,
+				PriceScale:    order.PriceScale,
+				FirstFill:     trade.Timestamp,
+			}}
+			netter.pending[key] = n
+		}
+
+		n.Fills++
+		n.GrossQuantity += trade.MatchQty
+		if order.Side == Buy {
+			n.NetQuantity += int64(trade.MatchQty)
+		} else {
+			n.NetQuantity -= int64(trade.MatchQty)
+		}
+		n.notional += trade.Price * float64(trade.MatchQty)
+		n.VWAP = n.notional / float64(n.GrossQuantity)
+		n.LastFill = trade.Timestamp
+	}
+}
+
+// Owners returns every owner with fills waiting to be reported, sorted.
+func (netter *Netter) Owners() []string {
+	var owners []string
+	for key := range netter.pending {
+		if !slices.Contains(owners, key.Owner) {
+			owners = append(owners, key.Owner)
+		}
+	}
+	slices.Sort(owners)
+	return owners
+}
+
+// Take returns the owner's netting reports, one per symbol sorted by ticker,
+// and starts netting their fills afresh.
+func (netter *Netter) Take(owner string) []Netting {
+	var reports []Netting
+	for key, n := range netter.pending {
+		if key.Owner == owner {
+			reports = append(reports, n.Netting)
+			delete(netter.pending, key)
+		}
+	}
+	slices.SortFunc(reports, func(a, b Netting) int {
+		return strings.Compare(a.Ticker, b.Ticker)
+	})
+	return reports
+}
+
+// SetNetting sends owners netting reports of their fills, see SendNettingReports.
+func (s *Server) SetNetting(owners ...string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.netter = NewNetter(owners...)
+}
+
+// SendNettingReports sends every netted owner a report per symbol they have
+// traded since their last. Owners who have never logged on keep netting until
+// they have a session to be sent them on, disconnected ones can have them
+// resent.
+func (s *Server) SendNettingReports() {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if s.netter == nil {
+		return
+	}
+	for _, owner := range s.netter.Owners() {
+		if _, ok := s.clientSessions[owner]; !ok {
+			continue
+		}
+		for _, report := range s.netter.Take(owner) {
+			if err := s.sendToOwnerLockFree(owner, report.Serialize()); err != nil {
+				log.Error().Err(err).Str("owner", owner).Msg("unable to send netting report")
+			}
+		}
+	}
+}
+
+// RunNetting sends netting reports every interval until ctx is done.
+func (s *Server) RunNetting(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SendNettingReports()
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+)
+
+var (
+	ErrNoParticipantRegistry = errors.New("participant onboarding is not enabled")
+	ErrOrderLimitExceeded    = Reject(RejectRiskBreach, errors.New("order exceeds the participant's size limit"))
+)
+
+// A ParticipantRegistry persists participants registered by admins, onboarding
+// them wherever they need to be known.
+type ParticipantRegistry interface {
+	Register(participant Participant) error
+}
+
+// SetParticipantRegistry enables onboarding participants over the admin API.
+func (s *Server) SetParticipantRegistry(registry ParticipantRegistry) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.registry = registry
+}
+
+// Onboard lets a registered participant log on straight away, with the rights
+// and limits they were registered with. Their logons are always authenticated.
+func (s *Server) Onboard(participant Participant) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if s.credentials == nil {
+		s.credentials = make(map[string][]byte)
+	}
+	s.credentials[participant.ID] = []byte(participant.Secret)
+	if participant.Entitlements.Has(AdminEntitlement) {
+		s.admins[participant.ID] = true
+	}
+	if participant.Entitlements.Has(ObserverEntitlement) {
+		s.observers[participant.ID] = true
+	}
+	if len(participant.Clients) > 0 {
+		s.brokers[participant.ID] = make(map[string]bool)
+		for _, client := range participant.Clients {
+			s.brokers[participant.ID][client] = true
+		}
+	} else {
+		delete(s.brokers, participant.ID)
+	}
+	if participant.MaxOrderQuantity > 0 {
+		s.orderLimits[participant.ID] = participant.MaxOrderQuantity
+	} else {
+		delete(s.orderLimits, participant.ID)
+	}
+	if participant.DataTier != FullDepthTier {
+		s.dataTiers[participant.ID] = participant.DataTier
+	} else {
+		delete(s.dataTiers, participant.ID)
+	}
+	return nil
+}
+
+// registerParticipant onboards a participant on behalf of the admin on
+// clientAddress.
+func (s *Server) registerParticipant(clientAddress string, request RegisterParticipantMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+
+	s.clientSessionsLock.Lock()
+	registry := s.registry
+	s.clientSessionsLock.Unlock()
+	if registry == nil {
+		return ErrNoParticipantRegistry
+	}
+	if err := registry.Register(request.Participant); err != nil {
+		return err
+	}
+
+	report, err := generateWireParticipantRegisteredReport(request.Participant)
+	if err != nil {
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if err := client.send(report); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// checkOrderLimit rejects orders larger than the owner may place.
+func (s *Server) checkOrderLimit(ord Order) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if limit, ok := s.orderLimits[ord.Owner]; ok && ord.TotalQuantity > limit {
+		return ErrOrderLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fenrir/internal/tracing"
+)
+
+var ErrNotPipelined = errors.New("engine cannot take commands without being waited on")
+
+// PipelinedEngine is an engine which can apply commands without the server
+// waiting on each, such as shards of engines, see engine.Shards. The server
+// goes on to route the next new order while those before it are matched.
+type PipelinedEngine interface {
+	Engine
+	// Submit applies cmd without waiting on it, running reply once it is, see
+	// engine.Shards.Submit.
+	Submit(cmd Command, reply CommandReply) error
+	// Replied is signalled when there are replies for RunReplies to run.
+	Replied() <-chan struct{}
+	RunReplies()
+}
+
+// pipelinedOrder is a new order submitted to the engine, waiting on it and on
+// those sent before it to be acknowledged.
+type pipelinedOrder struct {
+	message ClientMessage
+	match   *tracing.Span
+	ack     OrderAck
+	err     error
+	placed  bool // Whether it got as far as the engine, to replenish quotes after
+	done    bool
+}
+
+// SetPipelined has new orders submitted to the engine without waiting on each
+// to be matched, if the engine can take them so, see PipelinedEngine. Acks
+// are still sent in the order the orders were, and every other message waits
+// on the orders before it, so each session is answered in the order it sent.
+// It must be set before Run.
+func (s *Server) SetPipelined(pipelined bool) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if !pipelined {
+		s.pipeline = nil
+		return nil
+	}
+	engine, ok := s.engine.(PipelinedEngine)
+	if !ok {
+		return ErrNotPipelined
+	}
+	s.pipeline = engine
+	return nil
+}
+
+// replied is signalled when the engine has replies for runReplies, never if
+// orders are not pipelined.
+func (s *Server) replied() <-chan struct{} {
+	if s.pipeline == nil {
+		return nil
+	}
+	return s.pipeline.Replied()
+}
+
+// submitOrder submits a new order to the engine, acknowledging it once it and
+// every order before it have been applied.
+func (s *Server) submitOrder(message ClientMessage, order NewOrderMessage, match *tracing.Span) {
+	pending := &pipelinedOrder{message: message, match: match}
+	s.pipelined = append(s.pipelined, pending)
+	defer s.flushPipeline()
+	// As handleSafely, with the order failed rather than left to be waited on.
+	defer func() {
+		if r := recover(); r != nil {
+			s.recovered(r, message.clientAddress)
+			pending.err, pending.done = ErrInternal, true
+		}
+	}()
+
+	if !s.loggedOn(message.clientAddress) {
+		pending.err, pending.done = ErrNotLoggedOn, true
+		return
+	}
+	ord, held, err := s.checkOrder(s.sessionOwner(message.clientAddress), order)
+	if err != nil {
+		pending.err, pending.done = err, true
+		return
+	}
+	if held {
+		pending.ack, pending.placed, pending.done = s.ackOf(s.engine, order, ord, OrderNew, ord.TotalQuantity), true, true
+		return
+	}
+	cmd := Command{Origin: message.origin, Type: PlaceOrderCommand, AssetType: order.AssetType, Orders: []Order{ord}}
+	err = s.pipeline.Submit(cmd, func(view EngineView, _ []Order, err error) func() {
+		// Acknowledged with wherever the order got to on its shard, before
+		// anything after it there moves it on.
+		var ack OrderAck
+		if err == nil {
+			ack = s.orderAck(view, order, ord)
+		}
+		return func() {
+			pending.ack, pending.err, pending.placed, pending.done = ack, err, err == nil, true
+		}
+	})
+	if err != nil {
+		pending.err, pending.done = err, true
+	}
+}
+
+// runReplies runs whatever replies the engine has, acknowledging the orders
+// they complete.
+func (s *Server) runReplies() {
+	s.pipeline.RunReplies()
+	s.flushPipeline()
+}
+
+// awaitPipeline waits until every order submitted has been acknowledged,
+// unless dying first.
+func (s *Server) awaitPipeline(dying <-chan struct{}) {
+	for len(s.pipelined) > 0 {
+		select {
+		case <-dying:
+			return
+		case <-s.pipeline.Replied():
+			s.runReplies()
+		}
+	}
+}
+
+// flushPipeline acknowledges the orders submitted which have been applied, in
+// the order they were sent, up to the first still being matched.
+func (s *Server) flushPipeline() {
+	placed := false
+	for len(s.pipelined) > 0 && s.pipelined[0].done {
+		pending := s.pipelined[0]
+		s.pipelined[0] = nil
+		s.pipelined = s.pipelined[1:]
+
+		err := pending.err
+		if err == nil {
+			if err = s.ReportOrderAck(pending.message.clientAddress, pending.ack); err == nil {
+				s.certifyOrder(pending.message.clientAddress, pending.ack)
+			}
+		}
+		placed = placed || pending.placed
+		s.handled(pending.message, pending.match, err)
+	}
+	// Only once the orders are acknowledged does the quoter top back up
+	// whatever they traded.
+	if placed {
+		s.replenishQuotes()
+	}
+}
@@ -0,0 +1,154 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMaxQuantityExceeded = Reject(RejectMaxQuantity, errors.New("order quantity over the account's limit"))
+	ErrMaxNotionalExceeded = Reject(RejectMaxNotional, errors.New("order notional over the account's limit"))
+	ErrPriceOutsideCollar  = Reject(RejectPriceCollar, errors.New("order price outside the price collar"))
+	ErrInvalidRiskLimits   = errors.New("invalid risk limits")
+)
+
+// DefaultRiskAccount is the account whose limits apply to owners without
+// limits of their own.
+const DefaultRiskAccount = "*"
+
+// RiskLimits are the checks every new order of an account is put through
+// before it reaches the engine. A zero limit is not checked.
+type RiskLimits struct {
+	MaxQuantity uint64  // Lots in a single order
+	MaxNotional float64 // Price times quantity of a single order, in whole units
+	// Furthest a limit price may be from the index price, the last trade if
+	// there is none, or the reference price if there has not been one either,
+	// as a fraction of it (e.g. 0.1 for 10%).
+	Collar float64
+}
+
+// ParseRiskLimits reads comma-separated owner:maxQty:maxNotional:collar%
+// limits, e.g. "alice:1000:50000:5" for orders of at most 1000 lots, 50000 in
+// notional and priced within 5% of the last trade. Any limit may be left
+// empty, and the owner DefaultRiskAccount sets everyone else's.
+func ParseRiskLimits(spec string) (map[string]RiskLimits, error) {
+	accounts := make(map[string]RiskLimits)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 4 || parts[0] == "" {
+			return nil, fmt.Errorf("%w: %q is not owner:maxQty:maxNotional:collar%%", ErrInvalidRiskLimits, entry)
+		}
+
+		var limits RiskLimits
+		var err error
+		if parts[1] != "" {
+			if limits.MaxQuantity, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: max quantity %q", ErrInvalidRiskLimits, parts[1])
+			}
+		}
+		if parts[2] != "" {
+			if limits.MaxNotional, err = strconv.ParseFloat(parts[2], 64); err != nil || limits.MaxNotional < 0 {
+				return nil, fmt.Errorf("%w: max notional %q", ErrInvalidRiskLimits, parts[2])
+			}
+		}
+		if parts[3] != "" {
+			percent, err := strconv.ParseFloat(parts[3], 64)
+			if err != nil || percent < 0 {
+				return nil, fmt.Errorf("%w: collar %q", ErrInvalidRiskLimits, parts[3])
+			}
+			limits.Collar = percent / 100
+		}
+		accounts[parts[0]] = limits
+	}
+	return accounts, nil
+}
+
+// ParseReferencePrices reads comma-separated ticker:price reference prices,
+// e.g. the previous day's closes.
+func ParseReferencePrices(spec string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	for _, entry := range strings.Split(spec, ",") {
+		ticker, price, ok := strings.Cut(entry, ":")
+		reference, err := strconv.ParseFloat(price, 64)
+		if !ok || ticker == "" || err != nil || !(reference > 0) {
+			return nil, fmt.Errorf("%w: %q is not ticker:price", ErrInvalidRiskLimits, entry)
+		}
+		prices[ticker] = reference
+	}
+	return prices, nil
+}
+
+// SetRiskLimits sets the pre-trade limits of each account, by owner, replacing
+// any set before. Owners without limits, when there are none for
+// DefaultRiskAccount either, are not checked.
+func (s *Server) SetRiskLimits(accounts map[string]RiskLimits) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.riskLimits = accounts
+}
+
+// SetReferencePrices sets the prices orders are collared around, by ticker,
+// until each trades.
+func (s *Server) SetReferencePrices(prices map[string]float64) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.referencePrices = prices
+}
+
+// referencePriceLockFree is the price orders on ticker are checked against, its
+// index price if it has one, else the last it traded at if it has. The caller
+// must hold clientSessionsLock.
+func (s *Server) referencePriceLockFree(ticker string) (float64, bool) {
+	if price, ok := s.indexPrices[ticker]; ok {
+		return price, true
+	}
+	if price, ok := s.lastPrices[ticker]; ok {
+		return price, true
+	}
+	price, ok := s.referencePrices[ticker]
+	return price, ok
+}
+
+// CheckRiskLimits returns the error a new order is rejected with for being over
+// its owner's limits, if it is. Market orders are priced at the reference
+// price, and their notional is not checked if there is none.
+func (s *Server) CheckRiskLimits(ord Order) error {
+	lot := 1.0
+	if inst, ok := s.engine.Instrument(ord.Ticker); ok {
+		lot = inst.Lot()
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	limits, ok := s.riskLimits[ord.Owner]
+	if !ok {
+		if limits, ok = s.riskLimits[DefaultRiskAccount]; !ok {
+			return nil
+		}
+	}
+	if limits.MaxQuantity > 0 && ord.TotalQuantity > limits.MaxQuantity {
+		return fmt.Errorf("%w: %d lots, limit %d", ErrMaxQuantityExceeded, ord.TotalQuantity, limits.MaxQuantity)
+	}
+
+	reference, referenced := s.referencePriceLockFree(ord.Ticker)
+	price := ord.LimitPrice
+	if ord.OrderType == MarketOrder {
+		price = reference
+	}
+	if notional := price * float64(ord.TotalQuantity) * lot; limits.MaxNotional > 0 && notional > limits.MaxNotional {
+		return fmt.Errorf("%w: %g, limit %g", ErrMaxNotionalExceeded, notional, limits.MaxNotional)
+	}
+
+	if limits.Collar > 0 && ord.OrderType == LimitOrder && referenced {
+		if deviation := math.Abs(ord.LimitPrice-reference) / reference; deviation > limits.Collar {
+			return fmt.Errorf("%w: %g is %.2f%% from %g, limit %.2f%%",
+				ErrPriceOutsideCollar, ord.LimitPrice, deviation*100, reference, limits.Collar*100)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	. "fenrir/internal/common"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// FanoutRingLen is how many published messages are kept for subscribers
+	// to catch up on. Subscribers which fall further behind are considered
+	// too slow and disconnected.
+	FanoutRingLen = 64 * 1024
+
+	// How long a write to a subscriber may block before it is considered
+	// stalled and disconnected.
+	subscriberWriteTimeout = 5 * time.Second
+)
+
+// Channel is a class of published data a subscriber can ask for.
+type Channel uint8
+
+const (
+	// Top of book changes, see serializeBBOUpdate.
+	BBOChannel Channel = iota
+	// Incremental book updates, see MarketDataUpdate.
+	DepthChannel
+	// Public time and sales, see TradeTape.
+	TradesChannel
+	// Option theoretical values and greeks, see serializeGreeks.
+	AnalyticsChannel
+	// The top TopDepthLevels levels of each side as they change, see
+	// BookSnapshot.
+	TopDepthChannel
+	NumChannels
+)
+
+// Tier is the least market data tier entitled to subscribe to the channel.
+func (channel Channel) Tier() DataTier {
+	switch channel {
+	case DepthChannel:
+		return FullDepthTier
+	case TopDepthChannel:
+		return TopDepthTier
+	}
+	return TopOfBookTier
+}
+
+// AllTickers subscribes to a channel for every ticker.
+const AllTickers = "\x00\x00\x00\x00"
+
+type topic struct {
+	channel Channel
+	ticker  string
+}
+
+// PubSub fans published messages out to subscribed connections.
+//
+// Each message is serialized once by the publisher and put on a ring shared by
+// every subscriber, which publishing never waits on. A writer per subscriber
+// follows the ring with a cursor of its own, sending on whatever its
+// subscriber subscribes to, so a slow consumer never holds up the publisher or
+// anyone else. Messages for WebSocket subscribers are translated to JSON once,
+// by whichever writer gets to them first, rather than once for each.
+// Subscribers which are lapped by the ring, or whose writes stall, are
+// disconnected.
+type PubSub struct {
+	lock        sync.RWMutex
+	published   *sync.Cond // Broadcast as messages are published and subscribers removed
+	ring        []*published
+	head        atomic.Uint64 // Sequence of the next message published, only changed with the lock held
+	subscribers map[*subscriber]struct{}
+}
+
+// published is a message on the ring. It is never changed once published, but
+// for its JSON being encoded.
+type published struct {
+	seq     uint64
+	topic   topic
+	buf     []byte
+	encode  sync.Once
+	json    [][]byte
+	jsonErr error
+}
+
+// JSON returns the message as WebSocket messages are sent, encoding it the
+// first time it is asked for.
+func (msg *published) JSON() ([][]byte, error) {
+	msg.encode.Do(func() {
+		reports, err := JSONReports(msg.buf, false)
+		if err != nil {
+			msg.jsonErr = err
+			return
+		}
+		for _, report := range reports {
+			var encoded bytes.Buffer
+			if err := json.NewEncoder(&encoded).Encode(report); err != nil {
+				msg.jsonErr = err
+				return
+			}
+			msg.json = append(msg.json, encoded.Bytes())
+		}
+	})
+	return msg.json, msg.jsonErr
+}
+
+type subscriber struct {
+	conn    net.Conn
+	topics  map[topic]bool // Guarded by the PubSub lock
+	removed bool           // Guarded by the PubSub lock
+	cursor  uint64         // Sequence of the next message to look at, only used by the writer
+}
+
+func NewPubSub() *PubSub {
+	ps := &PubSub{
+		ring:        make([]*published, FanoutRingLen),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+	// Writers only ever read the ring, so wait on it sharing the lock.
+	ps.published = sync.NewCond(ps.lock.RLocker())
+	return ps
+}
+
+// Add registers a connection and starts its writer. It receives nothing until
+// it subscribes to something, and nothing published before it was added.
+func (ps *PubSub) Add(conn net.Conn) *subscriber {
+	sub := &subscriber{
+		conn:   conn,
+		topics: make(map[topic]bool),
+	}
+
+	ps.lock.Lock()
+	sub.cursor = ps.head.Load()
+	ps.subscribers[sub] = struct{}{}
+	ps.lock.Unlock()
+
+	go ps.write(sub)
+	return sub
+}
+
+// Subscribe adds a topic to the subscriber, ticker may be AllTickers.
+func (ps *PubSub) Subscribe(sub *subscriber, channel Channel, ticker string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	sub.topics[topic{channel, ticker}] = true
+}
+
+// Unsubscribe removes a topic from the subscriber.
+func (ps *PubSub) Unsubscribe(sub *subscriber, channel Channel, ticker string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	delete(sub.topics, topic{channel, ticker})
+}
+
+// Publish puts buf on the ring for subscribers of the channel for ticker. buf
+// must not be changed afterwards.
+func (ps *PubSub) Publish(channel Channel, ticker string, buf []byte) {
+	ps.lock.Lock()
+	head := ps.head.Load()
+	ps.ring[head%uint64(len(ps.ring))] = &published{seq: head, topic: topic{channel, ticker}, buf: buf}
+	ps.head.Store(head + 1)
+	ps.lock.Unlock()
+	ps.published.Broadcast()
+}
+
+// write sends the subscriber whatever it subscribes to as it is published,
+// until it is removed.
+func (ps *PubSub) write(sub *subscriber) {
+	var batch []*published
+	for {
+		var ok bool
+		batch, ok = ps.next(sub, batch[:0])
+		if !ok {
+			return
+		}
+		for i, msg := range batch {
+			// Nothing is held on to for longer than it has to be.
+			batch[i] = nil
+			// Messages already taken off the ring still count against the
+			// subscriber, so one stuck writing a backlog is lapped all the
+			// same.
+			if ps.lapped(sub, msg.seq) {
+				return
+			}
+			if err := ps.send(sub, msg); err != nil {
+				ps.Remove(sub)
+				return
+			}
+		}
+	}
+}
+
+// next waits for messages to be published past the subscriber's cursor,
+// appending those it subscribes to onto batch and moving the cursor past
+// them. It returns false once the subscriber has been removed, removing it if
+// the ring has lapped it.
+func (ps *PubSub) next(sub *subscriber, batch []*published) ([]*published, bool) {
+	ps.lock.RLock()
+	for sub.cursor == ps.head.Load() && !sub.removed {
+		ps.published.Wait()
+	}
+	if sub.removed {
+		ps.lock.RUnlock()
+		return nil, false
+	}
+	head := ps.head.Load()
+	if head-sub.cursor > uint64(len(ps.ring)) {
+		ps.lock.RUnlock()
+		ps.lapped(sub, sub.cursor)
+		return nil, false
+	}
+	for ; sub.cursor < head; sub.cursor++ {
+		msg := ps.ring[sub.cursor%uint64(len(ps.ring))]
+		if sub.topics[msg.topic] || sub.topics[topic{msg.topic.channel, AllTickers}] {
+			batch = append(batch, msg)
+		}
+	}
+	ps.lock.RUnlock()
+	return batch, true
+}
+
+// lapped removes the subscriber if the message numbered seq has since been
+// overwritten on the ring, returning whether it was.
+func (ps *PubSub) lapped(sub *subscriber, seq uint64) bool {
+	if ps.head.Load()-seq <= uint64(len(ps.ring)) {
+		return false
+	}
+	log.Warn().
+		Str("address", sub.conn.RemoteAddr().String()).
+		Msg("subscriber too slow, disconnecting")
+	ps.Remove(sub)
+	return true
+}
+
+// send writes a message to the subscriber, as JSON to WebSocket subscribers.
+func (ps *PubSub) send(sub *subscriber, msg *published) error {
+	if err := sub.conn.SetWriteDeadline(time.Now().Add(subscriberWriteTimeout)); err != nil {
+		return err
+	}
+	if conn, ok := sub.conn.(*jsonConn); ok {
+		encoded, err := msg.JSON()
+		if err != nil {
+			return err
+		}
+		return conn.writeEncoded(encoded)
+	}
+	_, err := sub.conn.Write(msg.buf)
+	return err
+}
+
+// Remove drops the subscriber and closes its connection.
+func (ps *PubSub) Remove(sub *subscriber) {
+	ps.lock.Lock()
+	ps.removeLockFree(sub)
+	ps.lock.Unlock()
+	ps.published.Broadcast()
+}
+
+// removeLockFree closes the subscriber, if it has not been already. The caller
+// must hold the PubSub lock, and wake its writer once released.
+func (ps *PubSub) removeLockFree(sub *subscriber) {
+	if _, ok := ps.subscribers[sub]; !ok {
+		return
+	}
+	delete(ps.subscribers, sub)
+	sub.removed = true
+	if err := sub.conn.Close(); err != nil {
+		log.Error().Err(err).Msg("unable to close subscriber")
+	}
+}
+
+// RemoveAll drops every subscriber.
+func (ps *PubSub) RemoveAll() {
+	ps.lock.Lock()
+	for sub := range ps.subscribers {
+		ps.removeLockFree(sub)
+	}
+	ps.lock.Unlock()
+	ps.published.Broadcast()
+}
@@ -0,0 +1,160 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultInputQueueDepth is how many messages wait for the session handler,
+// by default.
+const DefaultInputQueueDepth = 1
+
+var (
+	ErrInvalidOverflowPolicy = errors.New("invalid overflow policy")
+	ErrEngineBusy            = Reject(RejectEngineBusy, errors.New("engine busy, input queue full"))
+)
+
+// OverflowPolicy decides what happens to a message read off a session while
+// the input queue to the session handler is full.
+type OverflowPolicy uint8
+
+const (
+	// The session waits for room, nothing more being read off it meanwhile.
+	BlockOnOverflow OverflowPolicy = iota
+	// The message is rejected with ErrEngineBusy.
+	RejectOnOverflow
+	// The oldest message queued is rejected with ErrEngineBusy to make room,
+	// so the engine works on what is most recent.
+	DropOldestOnOverflow
+)
+
+// ParseOverflowPolicy reads an overflow policy as given on the command line:
+// "block", "reject" or "dropoldest".
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "block":
+		return BlockOnOverflow, nil
+	case "reject":
+		return RejectOnOverflow, nil
+	case "dropoldest":
+		return DropOldestOnOverflow, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidOverflowPolicy, s)
+}
+
+// InputQueueMetrics is how the input queue to the session handler has fared
+// since the server started.
+type InputQueueMetrics struct {
+	Capacity  int    `json:"capacity"`
+	Depth     int    `json:"depth"`     // Messages queued now
+	HighWater int    `json:"highWater"` // Most ever queued at once
+	Enqueued  uint64 `json:"enqueued"`
+	Blocked   uint64 `json:"blocked"`  // Sessions made to wait for room
+	Rejected  uint64 `json:"rejected"` // Turned away while full
+	Dropped   uint64 `json:"dropped"`  // Queued, then dropped for newer ones
+	// Handled in a different order than they were handed over, to be handled
+	// in the order they were read, see SetFairnessWindow.
+	Reordered uint64 `json:"reordered"`
+	// Handled after a message read later than them, having been handed over
+	// too late to be put in order.
+	Late uint64 `json:"late"`
+}
+
+// inputQueueStats are counted by every session's reader at once.
+type inputQueueStats struct {
+	highWater atomic.Int64
+	enqueued  atomic.Uint64
+	blocked   atomic.Uint64
+	rejected  atomic.Uint64
+	dropped   atomic.Uint64
+	reordered atomic.Uint64
+	late      atomic.Uint64
+}
+
+// SetInputQueue sets how many messages read off sessions may wait for the
+// session handler, and what happens to those read while it is full. A depth
+// below 1 is taken as 1. It must be set before the server is run.
+func (s *Server) SetInputQueue(depth int, policy OverflowPolicy) {
+	s.clientMessages = make(chan ClientMessage, max(depth, 1))
+	s.inputPolicy = policy
+}
+
+// InputQueueMetrics returns how the input queue has fared so far.
+func (s *Server) InputQueueMetrics() InputQueueMetrics {
+	return InputQueueMetrics{
+		Capacity:  cap(s.clientMessages),
+		Depth:     len(s.clientMessages),
+		HighWater: int(s.inputStats.highWater.Load()),
+		Enqueued:  s.inputStats.enqueued.Load(),
+		Blocked:   s.inputStats.blocked.Load(),
+		Rejected:  s.inputStats.rejected.Load(),
+		Dropped:   s.inputStats.dropped.Load(),
+		Reordered: s.inputStats.reordered.Load(),
+		Late:      s.inputStats.late.Load(),
+	}
+}
+
+// enqueue hands message to the session handler, applying the overflow policy
+// should the input queue be full. It returns false only if dying closes
+// before the message could be handed over.
+func (s *Server) enqueue(dying <-chan struct{}, message ClientMessage) bool {
+	if s.tryEnqueue(message) {
+		return true
+	}
+
+	switch s.inputPolicy {
+	case RejectOnOverflow:
+		s.inputStats.rejected.Add(1)
+		s.release(message.message)
+		s.ReportError(message.clientAddress, ErrEngineBusy)
+		endTrace(message.trace, ErrEngineBusy)
+		return true
+	case DropOldestOnOverflow:
+		for !s.tryEnqueue(message) {
+			select {
+			case oldest := <-s.clientMessages:
+				s.inputStats.dropped.Add(1)
+				s.release(oldest.message)
+				s.ReportError(oldest.clientAddress, ErrEngineBusy)
+				endTrace(oldest.trace, ErrEngineBusy)
+			default:
+			}
+		}
+		return true
+	}
+
+	s.inputStats.blocked.Add(1)
+	select {
+	case s.clientMessages <- message:
+		s.queued()
+		return true
+	case <-dying:
+		return false
+	}
+}
+
+// tryEnqueue hands message to the session handler if there is room.
+func (s *Server) tryEnqueue(message ClientMessage) bool {
+	select {
+	case s.clientMessages <- message:
+		s.queued()
+		return true
+	default:
+		return false
+	}
+}
+
+// queued counts a message onto the input queue.
+func (s *Server) queued() {
+	s.inputStats.enqueued.Add(1)
+	depth := int64(len(s.clientMessages))
+	for {
+		highWater := s.inputStats.highWater.Load()
+		if depth <= highWater || s.inputStats.highWater.CompareAndSwap(highWater, depth) {
+			return
+		}
+	}
+}
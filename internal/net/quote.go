@@ -0,0 +1,117 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoQuoter = errors.New("no quoter running")
+
+// A Quoter answers requests for quote and keeps passive liquidity on the
+// symbols it quotes, see the quoter package. It is driven from the session
+// handler, alongside the engine.
+type Quoter interface {
+	Quote(ticker string, quantity uint64) (Quote, error)
+	Replenish() error
+}
+
+// SetQuoter sets the quoter requests for quote are answered by.
+func (s *Server) SetQuoter(quoter Quoter) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.quoter = quoter
+}
+
+// replenishQuotes tops the quoter's liquidity back up after anything which may
+// have traded against it.
+func (s *Server) replenishQuotes() {
+	if s.quoter == nil || s.tradingErr() != nil {
+		return
+	}
+	if err := s.quoter.Replenish(); err != nil {
+		log.Error().Err(err).Msg("unable to replenish quotes")
+	}
+}
+
+// respondToQuote answers a request for quote from the session on clientAddress.
+func (s *Server) respondToQuote(clientAddress string, request QuoteRequestMessage) error {
+	if s.quoter == nil {
+		return ErrNoQuoter
+	}
+	quote, err := s.quoter.Quote(request.Ticker, request.Quantity)
+	if err != nil {
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if err := client.send(QuoteResponse{Quote: quote, Timestamp: s.clock.Now()}.Serialize()); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// QuoteRequestMessage asks for a two way price good for Quantity.
+//
+//	Ticker   4 bytes
+//	Quantity 8 bytes (lots)
+type QuoteRequestMessage struct {
+	BaseMessage
+	Ticker   string
+	Quantity uint64
+}
+
+func parseQuoteRequest(msg []byte) (QuoteRequestMessage, error) {
+	m := QuoteRequestMessage{BaseMessage: BaseMessage{TypeOf: QuoteRequest}}
+
+	if len(msg) < QuoteRequestHeaderLen {
+		return QuoteRequestMessage{}, ErrMessageTooShort
+	}
+	m.Ticker = string(msg[0:4])
+	m.Quantity = binary.BigEndian.Uint64(msg[4:12])
+
+	return m, nil
+}
+
+// QuoteResponse answers a QuoteRequest.
+//
+//	MessageType   1 byte (QuoteReport)
+//	Ticker        4 bytes
+//	BidPrice      8 bytes
+//	AskPrice      8 bytes
+//	Quantity      8 bytes
+//	QuantityScale 1 byte
+//	PriceScale    1 byte
+//	Timestamp     8 bytes (unix nanos)
+type QuoteResponse struct {
+	Quote
+	Timestamp time.Time
+}
+
+const QuoteLen = 1 + 4 + 8 + 8 + 8 + 1 + 1 + 8
+
+// Serialize converts the quote to be sent on the wire.
+func (response QuoteResponse) Serialize() []byte {
+	buf := make([]byte, QuoteLen)
+	buf[0] = byte(QuoteReport)
+	copy(buf[1:5], response.Ticker)
+	binary.BigEndian.PutUint64(buf[5:13], math.Float64bits(response.BidPrice))
+	binary.BigEndian.PutUint64(buf[13:21], math.Float64bits(response.AskPrice))
+	binary.BigEndian.PutUint64(buf[21:29], response.Quantity)
+	buf[29] = response.QuantityScale
+	buf[30] = response.PriceScale
+	binary.BigEndian.PutUint64(buf[31:39], uint64(response.Timestamp.UnixNano()))
+	return buf
+}
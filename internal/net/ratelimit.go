@@ -0,0 +1,127 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"math"
+	"time"
+)
+
+var ErrSessionThrottled = Reject(RejectThrottled, errors.New("session sending messages too fast"))
+
+// TokenBucket limits how fast messages are admitted, to rate a second on
+// average in bursts of up to burst at once. Each message admitted takes a
+// token, and tokens come back at rate a second up to burst. It is not safe for
+// concurrent use.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time // Tokens were last topped up at
+}
+
+// NewTokenBucket returns a full bucket. A burst below one admits a single
+// message at a time.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	bucket := &TokenBucket{rate: rate, burst: float64(max(burst, 1))}
+	bucket.tokens = bucket.burst
+	return bucket
+}
+
+// Allow takes a token if there is one as of now, returning whether the message
+// is admitted.
+func (bucket *TokenBucket) Allow(now time.Time) bool {
+	if now.After(bucket.last) {
+		bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// RetryAfter is how long after the last Allow until another message would be
+// admitted.
+func (bucket *TokenBucket) RetryAfter() time.Duration {
+	if bucket.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+// SetMessageRate limits how many messages a second each session may send, in
+// bursts of up to burst, 0 taking the rate rounded up. Messages over the limit
+// are rejected with ErrSessionThrottled, followed by a FlowControl saying when
+// to send again, rather than queued for the engine, so one session sending too
+// fast can not hold up everyone else's. Heartbeats and
+// cancels are never limited, nor are they counted. A rate of 0, the default,
+// does not limit sessions. It applies to sessions connecting after it is set.
+func (s *Server) SetMessageRate(rate float64, burst int) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	s.messageRate, s.messageBurst = rate, burst
+}
+
+// newRateLimiter returns what limits a newly connected session's messages, nil
+// if they are not limited.
+func (s *Server) newRateLimiter() *TokenBucket {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	if !(s.messageRate > 0) {
+		return nil
+	}
+	return NewTokenBucket(s.messageRate, s.messageBurst)
+}
+
+// Budget is what the bucket will admit as of the last Allow, as flow control
+// tells a session of it. Cancels are never limited.
+func (bucket *TokenBucket) Budget() ThrottleBudget {
+	var budget ThrottleBudget
+	for priority := range NumCommandPriorities {
+		if priority == CancelPriority {
+			budget.Remaining[priority] = -1
+			continue
+		}
+		budget.Remaining[priority] = int(bucket.tokens)
+		budget.RetryAfter[priority] = bucket.RetryAfter()
+	}
+	return budget
+}
+
+// rateLimited returns whether message counts towards its session's rate limit.
+// Cancels only ever take risk off the book, so are always let through.
+func rateLimited(message Message) bool {
+	switch message.GetType() {
+	case Heartbeat, CancelOrder, AdminCancel, KillSwitch:
+		return false
+	}
+	return true
+}
+
+// throttleSession rejects message if the session on address has sent too many
+// too fast, returning whether it was. The session is told when to try again
+// as it is for a book throttling it, see paceSession.
+func (s *Server) throttleSession(limiter *TokenBucket, address string, message Message) bool {
+	now := time.Now()
+	if limiter == nil || !rateLimited(message) || limiter.Allow(now) {
+		return false
+	}
+	_, priority := commandRoutes(message)
+	err := throttledError{
+		error: ErrSessionThrottled,
+		flow: FlowControl{
+			State:     FlowSessionThrottled,
+			Priority:  priority,
+			Budget:    limiter.Budget(),
+			Timestamp: now,
+		},
+	}
+	s.ReportError(address, err)
+	s.paceSession(address, message, err)
+	return true
+}
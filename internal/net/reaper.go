@@ -0,0 +1,205 @@
+package net
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultAbandonAfter is how long the reaper keeps the session of an owner who
+// has disconnected, for them to resume, by default.
+const DefaultAbandonAfter = 24 * time.Hour
+
+// LivenessCheck is what the reaper makes of a connection.
+type LivenessCheck int
+
+const (
+	// Alive connections have sent something recently enough.
+	Alive LivenessCheck = iota
+	// Probe connections have gone quiet and should be sent a heartbeat request.
+	Probe
+	// Dead connections did not answer their probe and should be closed.
+	Dead
+)
+
+// Liveness tracks when a connection was last heard from and whether it has been
+// probed since.
+type Liveness struct {
+	LastSeen time.Time
+	ProbedAt time.Time // Zero unless probed since LastSeen
+}
+
+// Seen notes something, even a heartbeat, was read off the connection.
+func (l *Liveness) Seen(now time.Time) {
+	l.LastSeen = now
+	l.ProbedAt = time.Time{}
+}
+
+// Check decides what to do with a connection which should be heard from at
+// least every idle, and answer a probe within idle. A connection found to need
+// probing is assumed to be probed.
+func (l *Liveness) Check(now time.Time, idle time.Duration) LivenessCheck {
+	switch {
+	case now.Sub(l.LastSeen) < idle:
+		return Alive
+	case l.ProbedAt.IsZero():
+		l.ProbedAt = now
+		return Probe
+	case now.Sub(l.ProbedAt) >= idle:
+		return Dead
+	}
+	return Alive
+}
+
+// Due returns when Check next has something other than Alive to say.
+func (l *Liveness) Due(idle time.Duration) time.Time {
+	if l.ProbedAt.IsZero() {
+		return l.LastSeen.Add(idle)
+	}
+	return l.ProbedAt.Add(idle)
+}
+
+// seen notes a message was read off the connection on address.
+func (s *Server) seen(address string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if session, ok := s.connections[address]; ok {
+		session.liveness.Seen(time.Now())
+	}
+}
+
+// RunReaper cleans up after clients which have gone away without saying so,
+// until ctx is done. Connections which send nothing for idle are sent a
+// heartbeat request, and closed if they still send nothing for another idle.
+// Sessions whose owner has been disconnected for abandonAfter are dropped, so
+// can no longer be resumed, along with the reports kept for them.
+//
+// Every connection, and every session disconnected from, has a timer on the
+// server's timer wheel for when it is next due a look, so quiet ones cost
+// nothing until then however many there are.
+//
+// Connections are also TCP keepalive probed by the OS, which catches peers
+// which have gone but not hung ones.
+func (s *Server) RunReaper(ctx context.Context, idle time.Duration, abandonAfter time.Duration) {
+	s.clientSessionsLock.Lock()
+	s.reaping = true
+	s.reapIdle = idle
+	s.abandonAfter = abandonAfter
+	for _, session := range s.connections {
+		s.watchLivenessLockFree(session)
+	}
+	for _, session := range s.clientSessions {
+		if !session.connected() {
+			s.abandonLaterLockFree(session)
+		}
+	}
+	s.clientSessionsLock.Unlock()
+
+	<-ctx.Done()
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.reaping = false
+	for _, session := range s.connections {
+		session.stopTimers()
+	}
+	for _, session := range s.clientSessions {
+		session.stopTimers()
+	}
+}
+
+// watchLivenessLockFree times the next check of the session's connection, if
+// reaping, replacing any timed before.
+func (s *Server) watchLivenessLockFree(session *ClientSession) {
+	if session.livenessTimer != nil {
+		session.livenessTimer.Stop()
+		session.livenessTimer = nil
+	}
+	if !s.reaping {
+		return
+	}
+
+	address := session.address
+	wait := time.Until(session.liveness.Due(s.reapIdle))
+	session.livenessTimer = s.timers.Schedule(wait, func() {
+		s.checkLiveness(address)
+	})
+}
+
+// checkLiveness probes the connection on address if it has gone quiet, or
+// closes it if it has not answered, then times its next check.
+func (s *Server) checkLiveness(address string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[address]
+	if !ok || !s.reaping {
+		return
+	}
+	switch session.liveness.Check(time.Now(), s.reapIdle) {
+	case Probe:
+		report, err := generateWireHeartbeatRequest()
+		if err == nil {
+			err = session.send(report)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("clientAddress", address).Msg("unable to probe connection")
+		}
+	case Dead:
+		log.Warn().
+			Str("clientAddress", address).
+			Str("owner", session.owner).
+			Time("lastSeen", session.liveness.LastSeen).
+			Msg("reaping dead connection")
+		s.closeConnectionLockFree(address)
+		return
+	}
+	s.watchLivenessLockFree(session)
+}
+
+// abandonLaterLockFree times the session, which its owner has disconnected
+// from, being dropped, if reaping.
+func (s *Server) abandonLaterLockFree(session *ClientSession) {
+	if session.abandonTimer != nil {
+		session.abandonTimer.Stop()
+		session.abandonTimer = nil
+	}
+	if !s.reaping || session.owner == "" {
+		return
+	}
+
+	owner := session.owner
+	wait := time.Until(session.disconnectedAt.Add(s.abandonAfter))
+	session.abandonTimer = s.timers.Schedule(wait, func() {
+		s.abandon(owner, session)
+	})
+}
+
+// abandon drops the owner's session, unless they have since reconnected to it.
+func (s *Server) abandon(owner string, session *ClientSession) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if !s.reaping || s.clientSessions[owner] != session || session.connected() {
+		return
+	}
+	log.Info().
+		Str("owner", owner).
+		Time("disconnectedAt", session.disconnectedAt).
+		Msg("reaping abandoned session")
+	delete(s.clientSessions, owner)
+}
+
+// stopTimers stops the session being reaped.
+func (session *ClientSession) stopTimers() {
+	if session.livenessTimer != nil {
+		session.livenessTimer.Stop()
+		session.livenessTimer = nil
+	}
+	if session.abandonTimer != nil {
+		session.abandonTimer.Stop()
+		session.abandonTimer = nil
+	}
+}
@@ -0,0 +1,93 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/rs/zerolog/log"
+	tomb "gopkg.in/tomb.v2"
+)
+
+// EngineComponent is the component reported degraded when the engine is found
+// in a bad state, see StatusComponentDegraded.
+const EngineComponent = "engine"
+
+var (
+	ErrInternal         = Reject(RejectInternalError, errors.New("internal error"))
+	ErrMalformedMessage = Reject(RejectMalformed, errors.New("malformed message"))
+)
+
+// An IntegrityChecker checks its own state, see engine.CheckIntegrity. The
+// engine is checked after anything panics while using it, if it is one.
+type IntegrityChecker interface {
+	CheckIntegrity() error
+}
+
+// handleSafely handles a message, rejecting it with ErrInternal rather than
+// taking the whole exchange down if handling it panics.
+func (s *Server) handleSafely(t *tomb.Tomb, message ClientMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.recovered(r, message.clientAddress)
+			err = ErrInternal
+		}
+	}()
+	return s.handleMessage(t, message)
+}
+
+// parseSafely parses a frame with decoder, failing with ErrMalformedMessage
+// rather than taking the whole exchange down if parsing it panics.
+func parseSafely(decoder *Decoder, frame []byte) (message Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().
+				Str("panic", fmt.Sprint(r)).
+				Str("stack", string(debug.Stack())).
+				Msg("recovered from panic parsing message")
+			err = ErrMalformedMessage
+		}
+	}()
+	return decoder.Decode(frame)
+}
+
+// callSafely runs a call, carrying on if it panics. Whoever made the call is
+// not left waiting, see call.
+func (s *Server) callSafely(call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.recovered(r, "")
+		}
+	}()
+	call()
+}
+
+// recovered raises the alarm over a panic on the session handler, and checks
+// the engine was not left half way through changing the books. If it was, the
+// engine is reported degraded to every session until an admin says otherwise,
+// the books may no longer be what they should.
+func (s *Server) recovered(r any, clientAddress string) {
+	log.Error().
+		Str("panic", fmt.Sprint(r)).
+		Str("clientAddress", clientAddress).
+		Str("stack", string(debug.Stack())).
+		Msg("recovered from panic")
+
+	checker, ok := s.engine.(IntegrityChecker)
+	if !ok {
+		return
+	}
+	err := checker.CheckIntegrity()
+	if err == nil {
+		return
+	}
+	log.Error().Err(err).Msg("engine left inconsistent by panic")
+	if err := s.UpdateExchangeStatus(StatusUpdate{
+		Event:     StatusComponentDegraded,
+		Component: EngineComponent,
+		Message:   "internal error",
+	}); err != nil {
+		log.Error().Err(err).Msg("unable to report engine degraded")
+	}
+}
@@ -0,0 +1,124 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrResendUnavailable = errors.New("reports requested for resend are no longer stored")
+
+// SequenceHeaderLen is the length of the sequence number written ahead of every
+// report on a session.
+const SequenceHeaderLen = 8
+
+// DefaultOutboundStoreSize is how many of its latest reports a session keeps
+// around to resend.
+const DefaultOutboundStoreSize = 10000
+
+// OutboundStore numbers the reports sent to a session, starting from 1, and
+// keeps the latest of them so a client which missed some can ask for them
+// again.
+type OutboundStore struct {
+	sequence uint64   // Last assigned sequence
+	reports  [][]byte // Numbered reports, the last of them being sequence
+	size     int
+}
+
+func NewOutboundStore(size int) *OutboundStore {
+	return &OutboundStore{size: max(size, 1)}
+}
+
+// Add numbers the report and stores it, returning it ready to be written.
+func (store *OutboundStore) Add(report []byte) []byte {
+	store.sequence++
+	numbered := make([]byte, SequenceHeaderLen, SequenceHeaderLen+len(report))
+	binary.BigEndian.PutUint64(numbered, store.sequence)
+	numbered = append(numbered, report...)
+
+	store.reports = append(store.reports, numbered)
+	if len(store.reports) > store.size {
+		store.reports = store.reports[1:]
+	}
+	return numbered
+}
+
+// Sequence is the sequence number of the last report added.
+func (store *OutboundStore) Sequence() uint64 {
+	return store.sequence
+}
+
+// From returns the stored reports numbered sequence onwards, as they were first
+// written. If the earliest of them are no longer stored, those which are still
+// are returned along with ErrResendUnavailable.
+func (store *OutboundStore) From(sequence uint64) ([][]byte, error) {
+	if sequence > store.sequence {
+		return nil, nil
+	}
+	first := store.sequence - uint64(len(store.reports)) + 1
+	if sequence < first {
+		return store.reports, ErrResendUnavailable
+	}
+	return store.reports[sequence-first:], nil
+}
+
+// send numbers, stores and journals each report, writing them to the session
+// if it is connected. Those sent while the owner is away can be asked for again
+// once they reconnect. The caller must hold clientSessionsLock.
+func (session *ClientSession) send(reports ...[]byte) error {
+	direction := JournalOutbound
+	if !session.connected() {
+		direction = JournalUndelivered
+	}
+
+	buf := writeBuffer()
+	defer releaseWriteBuffer(buf)
+	for _, report := range reports {
+		// Both keep the outbound store's copy, reports may be encoded into a
+		// buffer reused once sent, see Encoder.
+		numbered := session.outbound.Add(report)
+		*buf = append(*buf, numbered...)
+		session.journal.Record(direction, session.outbound.Sequence(), numbered[SequenceHeaderLen:])
+	}
+	if !session.connected() {
+		return nil
+	}
+	if session.batcher != nil {
+		return session.batcher.write(*buf)
+	}
+	_, err := session.conn.Write(*buf)
+	return err
+}
+
+// resend writes the reports from the requested sequence onwards to the session
+// on clientAddress once more, with their original sequence numbers.
+func (s *Server) resend(clientAddress string, request ResendRequestMessage) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	reports, unavailable := session.outbound.From(request.BeginSequence)
+	var buf []byte
+	for _, report := range reports {
+		buf = append(buf, report...)
+		session.journal.Record(JournalResent, binary.BigEndian.Uint64(report), report[SequenceHeaderLen:])
+	}
+	if len(buf) > 0 {
+		// Anything batched was sent before these are resent.
+		if session.batcher != nil {
+			if err := session.batcher.flush(); err != nil {
+				s.closeConnectionLockFree(clientAddress)
+				return fmt.Errorf("unable to resend reports: %w", err)
+			}
+		}
+		if _, err := session.conn.Write(buf); err != nil {
+			s.closeConnectionLockFree(clientAddress)
+			return fmt.Errorf("unable to resend reports: %w", err)
+		}
+	}
+	return unavailable
+}
@@ -0,0 +1,444 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Headers a REST request is authenticated by, see API.
+const (
+	OwnerHeader     = "X-Fenrir-Owner"
+	TimestampHeader = "X-Fenrir-Timestamp"
+	SignatureHeader = "X-Fenrir-Signature"
+)
+
+// cancelRejectStatuses is the HTTP status a cancel reject is answered with.
+var cancelRejectStatuses = map[CancelRejectReason]int{
+	CancelRejectUnknownOrder: http.StatusNotFound,
+	CancelRejectFilled:       http.StatusConflict,
+	CancelRejectNotOwner:     http.StatusForbidden,
+}
+
+// DefaultTradesLimit is how many trades GET /trades returns without a limit.
+const DefaultTradesLimit = 100
+
+// API serves orders and book queries over plain HTTP, for tooling, dashboards
+// and quick integration tests:
+//
+//	POST   /orders           place an order, the body a JSON newOrder (see json.go)
+//	DELETE /orders/{id}      cancel an order by its UUID or client order id
+//	GET    /book/{symbol}    the book's depth, ?depth= levels per side
+//	GET    /trades           the latest trades, ?symbol=, ?from= and ?to= (unix
+//	                         nanos) and ?limit= to narrow down, ?owner= for only
+//	                         those the authenticated owner traded in
+//	GET    /candles/{symbol} a page of candles, ?interval= (e.g. 5m, 1m if left
+//	                         out), ?from= and ?to= (unix nanos) and ?limit=
+//	GET    /status           the exchange's status, see ExchangeStatusChange
+//	GET    /queue            how the session handler's input queue has fared,
+//	                         see InputQueueMetrics
+//
+// along with the admin endpoints of handleAdmin, unless they are served apart,
+// see NewAdminAPI. Responses are the JSON reports
+// a WebSocket session would be sent, or for GET /queue the metrics as they
+// are, errors are an object with just an "error". Orders are placed and
+// cancelled on behalf of the owner in OwnerHeader, authenticated as a logon
+// would be: TimestampHeader is unix nanos and SignatureHeader is the hex
+// SignLogon signature.
+//
+// Requests are handled by the server's session handler, alongside its
+// sessions, so are throttled and reported on in the same way. Throttled
+// requests are answered 429, with a Retry-After of when the book is expected
+// to take them. Fills are reported to the owner's session, if they have one.
+type API struct {
+	address string
+	port    int
+	server  *Server
+	name    string      // Logged as
+	public  bool        // Whether it serves the endpoints above
+	private bool        // Whether it serves those of handleAdmin
+	tls     *tls.Config // Served over, plain HTTP if nil
+}
+
+func NewAPI(address string, port int, server *Server) *API {
+	return &API{
+		address: address,
+		port:    port,
+		server:  server,
+		name:    "rest api",
+		public:  true,
+		private: true,
+	}
+}
+
+// SetAdmin sets whether the API serves the admin endpoints, which it does
+// unless they are served by an admin API of their own. It must be set before
+// the API is run.
+func (api *API) SetAdmin(serve bool) {
+	api.private = serve
+}
+
+// SetTLS has the API served over TLS, see AdminTLSConfig. It must be set before
+// the API is run.
+func (api *API) SetTLS(config *tls.Config) {
+	api.tls = config
+}
+
+func (api *API) Run(ctx context.Context) {
+	mux := http.NewServeMux()
+	if api.public {
+		mux.HandleFunc("POST /orders", api.placeOrder)
+		mux.HandleFunc("DELETE /orders/{id}", api.cancelOrder)
+		mux.HandleFunc("GET /book/{symbol}", api.book)
+		mux.HandleFunc("GET /trades", api.trades)
+		mux.HandleFunc("GET /candles/{symbol}", api.candles)
+		mux.HandleFunc("GET /status", api.status)
+		mux.HandleFunc("GET /queue", api.queue)
+	}
+	if api.private {
+		api.handleAdmin(mux)
+	}
+
+	httpServer := &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", api.address, api.port),
+		Handler:   mux,
+		TLSConfig: api.tls,
+	}
+	// Unblock ListenAndServe on shutdown.
+	go func() {
+		<-ctx.Done()
+		if err := httpServer.Close(); err != nil {
+			log.Error().Err(err).Msg("unable to close " + api.name)
+		}
+	}()
+
+	log.Info().Msg(api.name + " running")
+	var err error
+	if api.tls != nil {
+		// The certificate is in the config.
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Msg("unable to start " + api.name)
+	}
+}
+
+// owner authenticates whoever the request is on behalf of.
+func (api *API) owner(r *http.Request) (string, error) {
+	owner := r.Header.Get(OwnerHeader)
+	if owner == "" {
+		return "", ErrInvalidUsername
+	}
+	timestamp, _ := strconv.ParseUint(r.Header.Get(TimestampHeader), 10, 64)
+	signature, _ := hex.DecodeString(r.Header.Get(SignatureHeader))
+	return owner, api.server.authenticate(LogonMessage{
+		BaseMessage: BaseMessage{TypeOf: Logon},
+		Username:    owner,
+		Timestamp:   timestamp,
+		Signature:   signature,
+	})
+}
+
+// run handles a command on the session handler on behalf of owner, risk
+// checked and throttled as the same command from a session would be. fn returns
+// the report to answer with.
+func (api *API) run(r *http.Request, owner string, message Message, fn func() ([]byte, error)) ([]byte, error) {
+	if err := validateMessage(message); err != nil {
+		return nil, err
+	}
+	if _, rejected := api.server.checkRisk(r.Context(), owner, message); rejected != nil {
+		return nil, errors.Join(rejected...)
+	}
+	if err := api.server.admit(message); err != nil {
+		return nil, err
+	}
+
+	var report []byte
+	var err error
+	callErr := api.server.call(r.Context(), func() {
+		api.server.lastActive = time.Now()
+		report, err = fn()
+		api.server.release(message)
+	})
+	if callErr != nil {
+		// Never handled, so never released either.
+		api.server.release(message)
+		return nil, callErr
+	}
+	return report, err
+}
+
+func (api *API) placeOrder(w http.ResponseWriter, r *http.Request) {
+	owner, err := api.owner(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var body jsonMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_RECV_SIZE)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	body.Type = "newOrder"
+	message, err := body.message()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	order := message.(NewOrderMessage)
+
+	report, err := api.run(r, owner, order, func() ([]byte, error) {
+		order.ReceivedAt = api.server.clock.Now()
+		ack, err := api.server.placeOrder(owner, CommandOrigin{}, order)
+		if err != nil {
+			return nil, err
+		}
+		api.server.replenishQuotes()
+		return ack.Serialize(), nil
+	})
+	writeReport(w, http.StatusCreated, report, err)
+}
+
+func (api *API) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	owner, err := api.owner(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// Client order ids are numbers, UUIDs never are.
+	request := CancelOrderMessage{
+		BaseMessage: BaseMessage{TypeOf: CancelOrder},
+		AssetType:   jsonEnum(jsonAssetTypes, r.URL.Query().Get("assetType"), Equities),
+	}
+	id := r.PathValue("id")
+	if clOrdID, err := strconv.ParseUint(id, 10, 64); err == nil {
+		request.ClOrdID = clOrdID
+	} else {
+		request.OrderUUID = id
+	}
+
+	report, err := api.run(r, owner, request, func() ([]byte, error) {
+		ord, err := api.server.cancelOrder(owner, CommandOrigin{}, request)
+		return api.server.cancelReport(request, ord, err)
+	})
+
+	// Rejects are still reported, under a status saying why.
+	status := http.StatusOK
+	if err == nil && ReportMessageType(report[0]) == CancelRejectReport {
+		status = cancelRejectStatuses[CancelRejectReason(report[45])]
+	}
+	writeReport(w, status, report, err)
+}
+
+func (api *API) book(w http.ResponseWriter, r *http.Request) {
+	ticker, err := jsonTicker(r.PathValue("symbol"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Market data is public, so queried by no one in particular, and only as
+	// deep as those not logged on may see.
+	api.writeBook(w, r, ticker, api.server.AnonymousTier().Levels())
+}
+
+// writeBook answers with the book's depth, ?depth= levels per side but no more
+// than maxLevels.
+func (api *API) writeBook(w http.ResponseWriter, r *http.Request, ticker string, maxLevels int) {
+	depth, _ := strconv.ParseUint(r.URL.Query().Get("depth"), 10, 16)
+	request := BookSnapshotRequestMessage{
+		BaseMessage: BaseMessage{TypeOf: BookSnapshotRequest},
+		Ticker:      ticker,
+		Depth:       snapshotDepth(uint16(depth)),
+	}
+
+	levels := min(int(request.Depth), maxLevels)
+	report, err := api.run(r, "", request, func() ([]byte, error) {
+		depth, err := api.server.engine.Depth(request.Ticker, levels)
+		if err != nil {
+			// The only way it fails.
+			return nil, errNotFound{err}
+		}
+		return BookSnapshot{depth}.Serialize()
+	})
+	writeReport(w, http.StatusOK, report, err)
+}
+
+func (api *API) trades(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var ticker string
+	if symbol := query.Get("symbol"); symbol != "" {
+		var err error
+		if ticker, err = jsonTicker(symbol); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	limit := DefaultTradesLimit
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	from, _ := strconv.ParseInt(query.Get("from"), 10, 64)
+	to, _ := strconv.ParseInt(query.Get("to"), 10, 64)
+	tradeQuery := TradeQuery{Ticker: ticker, Limit: limit}
+	if from > 0 {
+		tradeQuery.From = time.Unix(0, from)
+	}
+	if to > 0 {
+		tradeQuery.To = time.Unix(0, to)
+	}
+
+	// Who traded is private, so only ever asked after by themselves.
+	if query.Has("owner") {
+		owner, err := api.owner(r)
+		if err == nil && owner != query.Get("owner") {
+			err = ErrInvalidUsername
+		}
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		tradeQuery.Owner = owner
+	}
+
+	records, err := api.server.Trades(r.Context(), tradeQuery)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	// Printed as they are on the tape, without either party.
+	var buf []byte
+	for _, trade := range records {
+		buf = append(buf, TradeTape{
+			Ticker:        trade.Ticker,
+			TradeID:       trade.ID,
+			Timestamp:     trade.Timestamp,
+			Price:         trade.Price,
+			Quantity:      trade.Quantity,
+			Aggressor:     trade.Aggressor,
+			QuantityScale: trade.QuantityScale,
+			PriceScale:    trade.PriceScale,
+		}.Serialize()...)
+	}
+	trades, err := JSONReports(buf, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if trades == nil {
+		trades = []map[string]any{}
+	}
+	writeJSON(w, http.StatusOK, trades)
+}
+
+func (api *API) candles(w http.ResponseWriter, r *http.Request) {
+	ticker, err := jsonTicker(r.PathValue("symbol"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query()
+	interval := time.Minute
+	if query.Has("interval") {
+		if interval, err = time.ParseDuration(query.Get("interval")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	from, _ := strconv.ParseUint(query.Get("from"), 10, 64)
+	to, _ := strconv.ParseUint(query.Get("to"), 10, 64)
+	limit, _ := strconv.ParseUint(query.Get("limit"), 10, 16)
+	request := CandleRequestMessage{
+		BaseMessage: BaseMessage{TypeOf: CandleRequest},
+		Ticker:      ticker,
+		Interval:    uint32(interval / time.Second),
+		From:        unixNanos(from),
+		To:          unixNanos(to),
+		Limit:       candleLimit(uint16(limit)),
+	}
+
+	// Market data is public, so queried by no one in particular.
+	report, err := api.run(r, "", request, func() ([]byte, error) {
+		history, err := api.server.candles(request)
+		if err != nil {
+			// The interval was validated, so it can only be the symbol.
+			return nil, errNotFound{err}
+		}
+		return history.Serialize(), nil
+	})
+	writeReport(w, http.StatusOK, report, err)
+}
+
+func (api *API) status(w http.ResponseWriter, r *http.Request) {
+	report := ExchangeStatusChange{ExchangeStatus: api.server.ExchangeStatus()}.Serialize()
+	writeReport(w, http.StatusOK, report, nil)
+}
+
+func (api *API) queue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.server.InputQueueMetrics())
+}
+
+// errNotFound marks an error as being for something which does not exist.
+type errNotFound struct {
+	error
+}
+
+func (err errNotFound) Unwrap() error {
+	return err.error
+}
+
+// writeReport answers with a report as JSON, or err if there is no report.
+func writeReport(w http.ResponseWriter, status int, report []byte, err error) {
+	var notFound errNotFound
+	var throttled throttledError
+	switch {
+	case errors.As(err, &notFound):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", throttled.retryAfterHeader())
+		writeError(w, http.StatusTooManyRequests, err)
+		return
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrExchangeHalted), errors.Is(err, ErrExchangeClosed), errors.Is(err, ErrSymbolHalted),
+		errors.Is(err, ErrSymbolPreOpen), errors.Is(err, ErrSymbolClosed):
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		// Otherwise it is the order, or cancel, which was rejected.
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	body, _, err := jsonReport(report)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Err(err).Msg("unable to write rest response")
+	}
+}
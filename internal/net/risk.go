@@ -0,0 +1,234 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRiskTimeout is how long the risk service is given to answer for each
+// order, by default.
+const DefaultRiskTimeout = 50 * time.Millisecond
+
+var (
+	ErrRiskRejected    = Reject(RejectRiskBreach, errors.New("rejected by risk service"))
+	ErrRiskUnavailable = Reject(RejectRiskUnavailable, errors.New("risk service unavailable"))
+)
+
+// RiskChecker is an external pre-trade risk service, for firms which keep their
+// risk controls in one place rather than at each venue. It returns an error
+// wrapping ErrRiskRejected if the order must not be placed, any other error
+// meaning it could not say either way.
+type RiskChecker interface {
+	CheckOrder(ctx context.Context, owner string, order NewOrderMessage) error
+}
+
+// RiskPolicy is what becomes of orders the risk service could not say either
+// way on, e.g. as it took too long.
+type RiskPolicy int
+
+const (
+	// RiskFailClosed rejects the order.
+	RiskFailClosed RiskPolicy = iota
+	// RiskFailOpen places the order as if the risk service had accepted it.
+	RiskFailOpen
+)
+
+// RiskGate calls out to the risk service for each order, within a strict time
+// budget.
+type RiskGate struct {
+	checker RiskChecker
+	timeout time.Duration
+	policy  RiskPolicy
+}
+
+func NewRiskGate(checker RiskChecker, timeout time.Duration, policy RiskPolicy) *RiskGate {
+	return &RiskGate{checker: checker, timeout: timeout, policy: policy}
+}
+
+// Check asks the risk service about every order at once, each with its own time
+// budget. It returns why each order was rejected, nil for those which may be
+// placed.
+func (gate *RiskGate) Check(ctx context.Context, owner string, orders []NewOrderMessage) []error {
+	errs := make([]error, len(orders))
+	var wg sync.WaitGroup
+	for i, order := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = gate.check(ctx, owner, order)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (gate *RiskGate) check(ctx context.Context, owner string, order NewOrderMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, gate.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := gate.checker.CheckOrder(ctx, owner, order)
+	if err == nil || errors.Is(err, ErrRiskRejected) {
+		return err
+	}
+
+	log.Warn().
+		Err(err).
+		Str("owner", owner).
+		Uint64("clOrdId", order.ClOrdID).
+		Dur("elapsed", time.Since(start)).
+		Bool("failOpen", gate.policy == RiskFailOpen).
+		Msg("risk service unavailable")
+	if gate.policy == RiskFailOpen {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrRiskUnavailable, err)
+}
+
+// HTTPRiskChecker asks a risk service over HTTP, POSTing each order to URL as
+// JSON, as a JSON client would send it with its owner added:
+//
+//	{"owner": "alice", "ticker": "AAPL", "side": "buy", "price": 101.5, "quantity": 10, ...}
+//
+// The service answers 200 to accept the order, or 403 with {"reason": "..."}
+// to reject it. Anything else is taken as the service being unavailable.
+type HTTPRiskChecker struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+type riskRequest struct {
+	Owner       string  `json:"owner"`
+	AssetType   string  `json:"assetType"`
+	OrderType   string  `json:"orderType"`
+	Side        string  `json:"side"`
+	TimeInForce string  `json:"timeInForce"`
+	Ticker      string  `json:"ticker"`
+	Price       float64 `json:"price"`
+	Quantity    uint64  `json:"quantity"`
+	ClOrdID     uint64  `json:"clOrdId"`
+}
+
+func (checker HTTPRiskChecker) CheckOrder(ctx context.Context, owner string, order NewOrderMessage) error {
+	body, err := json.Marshal(riskRequest{
+		Owner:       owner,
+		AssetType:   jsonName(jsonAssetTypes, order.AssetType),
+		OrderType:   jsonName(jsonOrderTypes, order.OrderType),
+		Side:        jsonName(jsonSides, order.Side),
+		TimeInForce: jsonName(jsonTIFs, order.TimeInForce),
+		Ticker:      strings.TrimRight(order.Ticker, "\x00"),
+		Price:       order.LimitPrice,
+		Quantity:    order.Quantity,
+		ClOrdID:     order.ClOrdID,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, checker.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := checker.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusForbidden:
+		var rejection struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.NewDecoder(io.LimitReader(response.Body, MAX_RECV_SIZE)).Decode(&rejection)
+		if rejection.Reason == "" {
+			return ErrRiskRejected
+		}
+		return fmt.Errorf("%w: %s", ErrRiskRejected, rejection.Reason)
+	}
+	return fmt.Errorf("unexpected risk service status %d", response.StatusCode)
+}
+
+// SetRiskGate has every new order checked by an external risk service before
+// it is placed, nil to stop checking them.
+func (s *Server) SetRiskGate(gate *RiskGate) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.riskGate = gate
+}
+
+// checkRisk has the new orders in a message checked by the risk service, if
+// there is one. It returns the message left to handle, nil if nothing is, and
+// why any orders were rejected. A rejected order rejects its whole group, but
+// only itself from a batch.
+//
+// Orders are checked before they are handed to the engine, so waiting on the
+// risk service holds up only the owner's own session.
+func (s *Server) checkRisk(ctx context.Context, owner string, message Message) (Message, []error) {
+	s.clientSessionsLock.Lock()
+	gate := s.riskGate
+	s.clientSessionsLock.Unlock()
+	// Orders from sessions which have not logged on are refused anyway.
+	if gate == nil || owner == "" {
+		return message, nil
+	}
+
+	switch m := message.(type) {
+	case NewOrderMessage:
+		if err := gate.Check(ctx, owner, []NewOrderMessage{m})[0]; err != nil {
+			return nil, []error{err}
+		}
+	case OrderGroupMessage:
+		for i, err := range gate.Check(ctx, owner, m.Orders) {
+			if err != nil {
+				return nil, []error{fmt.Errorf("%w: order %d: %w", ErrOrderGroupRejected, i+1, err)}
+			}
+		}
+	case OrderBatchMessage:
+		var orders []NewOrderMessage
+		for _, entry := range m.Messages {
+			if order, ok := entry.(NewOrderMessage); ok {
+				orders = append(orders, order)
+			}
+		}
+		checks := gate.Check(ctx, owner, orders)
+
+		var rejected []error
+		kept := make([]Message, 0, len(m.Messages))
+		for _, entry := range m.Messages {
+			if _, ok := entry.(NewOrderMessage); ok {
+				err := checks[0]
+				checks = checks[1:]
+				if err != nil {
+					rejected = append(rejected, err)
+					continue
+				}
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) == 0 {
+			return nil, rejected
+		}
+		m.Messages = kept
+		return m, rejected
+	}
+	return message, nil
+}
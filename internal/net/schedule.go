@@ -0,0 +1,368 @@
+package net
+
+import (
+	"context"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSymbolPreOpen       = Reject(RejectTradingHalted, errors.New("symbol is in pre-open"))
+	ErrSymbolClosed        = Reject(RejectTradingHalted, errors.New("symbol is closed"))
+	ErrInvalidTradingPhase = errors.New("invalid trading phase")
+)
+
+// PhaseScheduled, put over a scope by an admin, puts it back on its trading
+// calendar, see Server.SetTradingPhase.
+const PhaseScheduled TradingPhase = math.MaxUint8
+
+// TradingPhaseOverrideMessage is an admin putting symbols in a trading phase,
+// over their calendar, until they are put back on it.
+//
+//	Phase     1 byte (TradingPhase, or PhaseScheduled)
+//	AssetType 1 byte
+//	Ticker    4 bytes (all zero for every ticker of the asset type)
+type TradingPhaseOverrideMessage struct {
+	BaseMessage
+	Phase TradingPhase
+	Scope CalendarScope
+}
+
+func parseTradingPhaseOverride(msg []byte) (TradingPhaseOverrideMessage, error) {
+	m := TradingPhaseOverrideMessage{BaseMessage: BaseMessage{TypeOf: TradingPhaseOverride}}
+
+	if len(msg) < TradingPhaseOverrideHeaderLen {
+		return TradingPhaseOverrideMessage{}, ErrMessageTooShort
+	}
+	m.Phase = TradingPhase(msg[0])
+	m.Scope.AssetType = AssetType(msg[1])
+	if ticker := string(msg[2:6]); ticker != "\x00\x00\x00\x00" {
+		m.Scope = CalendarScope{Ticker: ticker}
+	}
+
+	return m, nil
+}
+
+// SetTradingCalendars moves symbols between trading phases on calendars, see
+// RunSchedule. A ticker's own calendar is followed over its asset type's, and
+// those with neither trade continuously.
+func (s *Server) SetTradingCalendars(calendars ...TradingCalendar) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.calendars = make(map[CalendarScope]TradingCalendar)
+	for _, calendar := range calendars {
+		s.calendars[calendar.Scope] = calendar
+	}
+}
+
+// SetQueuePreOpen has orders sent in pre-open held for the open, rather than
+// refused. Held orders are acknowledged as new and may be cancelled as any
+// other. They are placed in the order they were sent once the symbol trades
+// continuously, or cancelled if it closes first. Only the server holds them,
+// so they are lost if it stops before the open.
+func (s *Server) SetQueuePreOpen(queue bool) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.queuePreOpen = queue
+}
+
+// TradingPhase returns the phase ticker, of assetType, is in.
+func (s *Server) TradingPhase(ticker string, assetType AssetType) TradingPhase {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.phaseLockFree(ticker, assetType)
+}
+
+// phaseLockFree returns the phase ticker is in: whatever an admin has put it,
+// or else its asset type, in, or else where its calendar, or else its asset
+// type's, has it.
+func (s *Server) phaseLockFree(ticker string, assetType AssetType) TradingPhase {
+	scopes := []CalendarScope{{Ticker: ticker}, {AssetType: assetType}}
+	for _, scope := range scopes {
+		if phase, ok := s.phaseOverrides[scope]; ok {
+			return phase
+		}
+	}
+	now := s.clock.Now()
+	for _, scope := range scopes {
+		if calendar, ok := s.calendars[scope]; ok {
+			return calendar.Phase(now)
+		}
+	}
+	return PhaseContinuous
+}
+
+// phaseErr returns why new orders are refused on ticker in phase, nil if they
+// are not.
+func phaseErr(phase TradingPhase, ticker string) error {
+	switch phase {
+	case PhasePreOpen:
+		return fmt.Errorf("%w: %s", ErrSymbolPreOpen, ticker)
+	case PhaseHalted:
+		return fmt.Errorf("%w: %s", ErrSymbolHalted, ticker)
+	case PhaseClosed:
+		return fmt.Errorf("%w: %s", ErrSymbolClosed, ticker)
+	}
+	return nil
+}
+
+// tradingPhaseErr returns why new orders on ticker, of assetType, are refused
+// in the phase it is in, nil if it is trading continuously.
+func (s *Server) tradingPhaseErr(ticker string, assetType AssetType) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return phaseErr(s.phaseLockFree(ticker, assetType), ticker)
+}
+
+// holdOrder holds ord for the open if its symbol is in pre-open and orders are
+// queued, returning whether it was. Otherwise it returns why ord is refused in
+// the phase its symbol is in, if it is, none if it goes into the symbol's
+// opening auction. Once the symbol opens, anything still held is placed ahead
+// of ord.
+func (s *Server) holdOrder(ord Order) (bool, error) {
+	s.clientSessionsLock.Lock()
+	phase := s.phaseLockFree(ord.Ticker, ord.AssetType)
+	held := len(s.heldOrders[ord.Ticker]) > 0
+	if phase == PhasePreOpen && s.openingAuction {
+		s.clientSessionsLock.Unlock()
+		return false, s.startAuction(ord.Ticker)
+	}
+	if phase == PhasePreOpen && s.queuePreOpen {
+		s.heldOrders[ord.Ticker] = append(s.heldOrders[ord.Ticker], ord)
+		s.clientSessionsLock.Unlock()
+		return true, nil
+	}
+	s.clientSessionsLock.Unlock()
+
+	if phase == PhaseContinuous && held {
+		s.releaseHeldOrders(ord.Ticker)
+	}
+	return false, phaseErr(phase, ord.Ticker)
+}
+
+// cancelHeldOrder cancels the held order a cancel request from owner is for,
+// returning it, if it is for one.
+func (s *Server) cancelHeldOrder(owner string, request CancelOrderMessage) (Order, bool) {
+	s.clientSessionsLock.Lock()
+	var found Order
+	ok := false
+	for ticker, orders := range s.heldOrders {
+		// Brokers may cancel their clients' held orders by UUID too.
+		i := slices.IndexFunc(orders, func(ord Order) bool {
+			if request.OrderUUID == "" {
+				return ord.Owner == owner && ord.ClOrdID == request.ClOrdID
+			}
+			return ord.UUID == request.OrderUUID && owner != "" && (ord.Owner == owner || s.brokers[owner][ord.Owner])
+		})
+		if i >= 0 {
+			found, ok = orders[i], true
+			s.heldOrders[ticker] = slices.Delete(orders, i, i+1)
+			break
+		}
+	}
+	s.clientSessionsLock.Unlock()
+
+	if ok && found.Owner != owner {
+		if err := s.ReportUnsolicitedCancel(found, BrokerCancelled); err != nil {
+			log.Warn().Err(err).Str("owner", found.Owner).Msg("unable to report broker cancel")
+		}
+	}
+	return found, ok
+}
+
+// releaseHeldOrders places every order held for the open of ticker, in the
+// order they were sent. Owners are told of any the engine refuses.
+func (s *Server) releaseHeldOrders(ticker string) {
+	s.clientSessionsLock.Lock()
+	orders := s.heldOrders[ticker]
+	delete(s.heldOrders, ticker)
+	s.clientSessionsLock.Unlock()
+
+	for _, ord := range orders {
+		cmd := Command{Type: PlaceOrderCommand, AssetType: ord.AssetType, Orders: []Order{ord}}
+		if _, err := s.engine.Apply(cmd); err != nil {
+			log.Warn().Err(err).Str("uuid", ord.UUID).Str("owner", ord.Owner).Msg("held order refused at the open")
+			s.reportToOwner(ord.Owner, fmt.Errorf("held order %s: %w", ord.UUID, err))
+		}
+	}
+	if len(orders) > 0 {
+		log.Info().Str("ticker", ticker).Int("orders", len(orders)).Msg("released held orders")
+	}
+}
+
+// cancelHeldOrders cancels every order held for the open of ticker, as it
+// closed first.
+func (s *Server) cancelHeldOrders(ticker string) {
+	s.clientSessionsLock.Lock()
+	orders := s.heldOrders[ticker]
+	delete(s.heldOrders, ticker)
+	s.clientSessionsLock.Unlock()
+
+	for _, ord := range orders {
+		if err := s.ReportUnsolicitedCancel(ord, MarketClosed); err != nil {
+			log.Warn().Err(err).Str("owner", ord.Owner).Msg("unable to report held order cancel")
+		}
+	}
+}
+
+// reportToOwner sends err to owner's session, if they have one.
+func (s *Server) reportToOwner(owner string, err error) {
+	report, err := generateWireErrorReports(err)
+	if err != nil {
+		return
+	}
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	if err := s.sendToOwnerLockFree(owner, report); err != nil {
+		log.Warn().Err(err).Str("owner", owner).Msg("unable to send error report")
+	}
+}
+
+// SetTradingPhase puts every symbol in scope in phase, over its calendar,
+// until it is put in another or, with PhaseScheduled, back on its calendar.
+// Every session is told of each symbol whose phase changes. It must be run
+// from the session handler.
+func (s *Server) SetTradingPhase(scope CalendarScope, phase TradingPhase) error {
+	if !phase.Valid() && phase != PhaseScheduled {
+		return ErrInvalidTradingPhase
+	}
+
+	s.clientSessionsLock.Lock()
+	if phase == PhaseScheduled {
+		delete(s.phaseOverrides, scope)
+	} else {
+		s.phaseOverrides[scope] = phase
+	}
+	s.clientSessionsLock.Unlock()
+
+	log.Info().Str("scope", scope.String()).Int("phase", int(phase)).Msg("trading phase set")
+	return s.advanceSchedule()
+}
+
+// setTradingPhase sets a trading phase on behalf of the admin on
+// clientAddress.
+func (s *Server) setTradingPhase(clientAddress string, request TradingPhaseOverrideMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+	return s.SetTradingPhase(request.Scope, request.Phase)
+}
+
+// RunSchedule moves symbols between the phases of their trading calendars on
+// the server's clock, until ctx is done. Every session is told of each symbol
+// whose phase changes. Orders held for the open are placed as their symbol
+// opens, or cancelled if it closes first, and opening auctions start and
+// uncross.
+func (s *Server) RunSchedule(ctx context.Context) {
+	s.clientSessionsLock.Lock()
+	clock := s.clock
+	s.clientSessionsLock.Unlock()
+
+	for {
+		if err := s.call(ctx, func() {
+			if err := s.advanceSchedule(); err != nil {
+				log.Error().Err(err).Msg("unable to report trading phases")
+			}
+		}); err != nil {
+			return
+		}
+
+		now := clock.Now()
+		next, ok := s.nextTransition(now)
+		if !ok {
+			<-ctx.Done()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(next.Sub(now)):
+		}
+	}
+}
+
+// nextTransition returns when any calendar next moves its symbols into another
+// phase after now, if there are any calendars.
+func (s *Server) nextTransition(now time.Time) (time.Time, bool) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	var next time.Time
+	for _, calendar := range s.calendars {
+		if at, _ := calendar.Next(now); next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// advanceSchedule tells every session of each symbol whose phase has changed
+// since it was last told, placing or cancelling orders held for its open, and
+// starting or uncrossing its opening auction. It must be run from the session
+// handler.
+func (s *Server) advanceSchedule() error {
+	// Every ticker a calendar or admin has a say over, and those with orders
+	// held, which may not have a book yet.
+	assetTypes := make(map[string]AssetType)
+	s.clientSessionsLock.Lock()
+	scopes := slices.Collect(maps.Keys(s.calendars))
+	for scope := range s.phaseOverrides {
+		scopes = append(scopes, scope)
+	}
+	for ticker, orders := range s.heldOrders {
+		if len(orders) > 0 {
+			assetTypes[ticker] = orders[0].AssetType
+		}
+	}
+	s.clientSessionsLock.Unlock()
+	for _, scope := range scopes {
+		if scope.Ticker != "" {
+			if inst, ok := s.engine.Instrument(scope.Ticker); ok {
+				assetTypes[scope.Ticker] = inst.AssetType
+			} else if _, ok := assetTypes[scope.Ticker]; !ok {
+				assetTypes[scope.Ticker] = scope.AssetType
+			}
+			continue
+		}
+		for _, ticker := range s.engine.Tickers(scope.AssetType) {
+			assetTypes[ticker] = scope.AssetType
+		}
+	}
+
+	var errs []error
+	for _, ticker := range slices.Sorted(maps.Keys(assetTypes)) {
+		s.clientSessionsLock.Lock()
+		phase := s.phaseLockFree(ticker, assetTypes[ticker])
+		last, reported := s.phases[ticker]
+		s.phases[ticker] = phase
+		auction := s.openingAuction
+		s.clientSessionsLock.Unlock()
+
+		switch phase {
+		case PhasePreOpen:
+			if auction {
+				errs = append(errs, s.startAuction(ticker))
+			}
+		case PhaseContinuous:
+			// The book uncrosses ahead of anything held being placed on it.
+			errs = append(errs, s.uncross(ticker))
+			s.releaseHeldOrders(ticker)
+		case PhaseClosed:
+			s.cancelHeldOrders(ticker)
+		}
+		if reported && last == phase {
+			continue
+		}
+		log.Info().Str("ticker", ticker).Int("phase", int(phase)).Msg("trading phase changed")
+		errs = append(errs, s.ReportSymbolStatus(ticker, phase.SymbolStatus()))
+	}
+	return errors.Join(errs...)
+}
@@ -1,57 +1,203 @@
 package net
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	. "fenrir/internal/common"
+	"fenrir/internal/tracing"
 	"fenrir/internal/utils"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	tomb "gopkg.in/tomb.v2"
 )
 
 const (
-	MAX_RECV_SIZE   = 4 * 1024
-	defaultNWorkers = 10
+	// Largest message a client may send.
+	MAX_RECV_SIZE = 4 * 1024
+
+	// Granularity of the server's timers, see TimerWheel.
+	DefaultTimerTick = 10 * time.Millisecond
 )
 
 var (
 	ErrImproperConversion = errors.New("improper type conversion")
 	ErrClientDoesNotExist = errors.New("client does not exist")
+	ErrNotAdmin           = Reject(RejectNotEntitled, errors.New("session is not an admin"))
+	ErrInvalidAdminScope  = errors.New("invalid admin cancel scope")
 )
 
 // ClientSession contains relevant information pertaining to an individual
-// connected TCP session.
+// connected TCP session. Once logged on, a session belongs to its owner rather
+// than the connection, and outlives it so the owner can reconnect to it.
 type ClientSession struct {
-	conn net.Conn
+	conn     net.Conn        // Nil while a logged on owner is disconnected, see writequeue.go
+	batcher  *reportBatcher  // Of conn, nil unless asked for at logon
+	address  string          // Remote address of conn
+	owner    string          // Set once the session has logged on
+	dropCopy *dropCopyFilter // Set if the session wants execution report copies
+	outbound *OutboundStore  // Every report sent, see resend.go
+	journal  *Journal        // Every message exchanged, see journal.go
+	encoder  Encoder         // Of the reports sent most often, see codec.go
+	liveness Liveness        // Of conn, see reaper.go
+	// When the owner last disconnected, sessions are reaped once abandoned.
+	disconnectedAt time.Time
+	livenessTimer  *utils.Timer // Next check of conn, while reaping
+	abandonTimer   *utils.Timer // Set while disconnected, when reaping
+}
+
+func (session *ClientSession) connected() bool {
+	return session.conn != nil
 }
 
 // ClientMessage links a message to the client sending it.
 type ClientMessage struct {
 	clientAddress string
+	origin        CommandOrigin // Of the commands it carries, see journalInbound
 	message       Message
+	trace         context.Context // Carries the message's trace, see trace.go
+	queued        *tracing.Span   // Waiting for sessionHandler
+	readAt        time.Time       // Off the socket, in real time, see latency.go
 }
 
 // TODO: Maybe move this to common/
 // Engine is interface that provides access to order handling.
 type Engine interface {
-	PlaceOrder(assetType AssetType, order Order) error
-	CancelOrder(assetType AssetType, uuid string) error
+	Instrument(ticker string) (Instrument, bool)
+	Tickers(assetType AssetType) []string
+	// Apply runs every command which changes the books, see engine.Apply.
+	Apply(cmd Command) ([]Order, error)
+	OrderStatus(ticker string, uuid string) (OrderStatus, uint64)
+	BBO(ticker string) (BBO, error)
+	Depth(ticker string, levels int) (BookDepth, error)
+	InAuction(ticker string) bool
+	IndicativeUncross(ticker string) (Uncross, error)
+	BookMetrics() BookMetrics
+	OpenOrders(owner string) []Order
+	// SessionMarker is the last command applied from an owner's session, see
+	// engine.SessionMarker.
+	SessionMarker(session string) CommandOrigin
+	OrderOwner(uuid string) (string, bool)
+	QueryTrades(query TradeQuery) []TradeRecord
+	Candles(ticker string, interval time.Duration, from, to time.Time, limit int) (CandlePage, error)
 	LogBook()
+
+	// Admit and Release bracket every command routed to a book, once per book,
+	// so the engine can throttle books that are backing up.
+	Admit(ticker string, priority CommandPriority) error
+	Release(ticker string)
+	ThrottleBudget(ticker string) ThrottleBudget
 }
 
 type Server struct {
 	address            string
 	port               int
 	engine             Engine
-	pool               utils.WorkerPool
 	cancel             context.CancelFunc
-	clientSessions     map[string]ClientSession
+	connections        map[string]*ClientSession // Open connections by client address
+	clientSessions     map[string]*ClientSession // Logged on sessions by owner
 	clientSessionsLock sync.Mutex
-	clientMessages     chan (ClientMessage)
+	clientMessages     chan (ClientMessage) // To sessionHandler, see queue.go
+	inputPolicy        OverflowPolicy
+	inputStats         inputQueueStats
+	calls              chan func() // Run by sessionHandler, see call
+	sessionPolicy      SessionPolicy
+	idleTimeout        time.Duration
+	admins             map[string]bool            // Owners allowed to send admin messages
+	observers          map[string]bool            // Owners allowed drop copies
+	brokers            map[string]map[string]bool // Owners each broker acts for, see broker.go
+	credentials        map[string][]byte          // Owner API secrets, see auth.go
+	authRequired       bool                       // Whether owners without a secret are refused
+	clock              Clock                      // Orders are stamped on, see SetClock
+	registry           ParticipantRegistry
+	orderLimits        map[string]uint64 // Largest order per owner, see onboard.go
+	quoter             Quoter            // Answers requests for quote, see quote.go
+	netter             *Netter           // Nets fills for reporting, see netting.go
+	riskGate           *RiskGate         // Checks new orders with a risk service, see risk.go
+	tradeHistory       TradeHistory      // Answers trade queries, see tradehistory.go
+	settler            Settler           // Settles each day's trading, see settlement.go
+	disclosure         Disclosure        // Of counterparties to parties, see disclosure.go
+	disclosureKey      []byte            // Anonymized counterparties are keyed by
+	status             ExchangeStatus    // Broadcast to every session, see status.go
+	maxBatchBytes      int               // Most a session's reports are batched by, see coalesce.go
+	maxBatchDelay      time.Duration
+	writeQueueLen      int             // Writes waiting on each session, see writequeue.go
+	captureDir         string          // Sessions are recorded to, see capture.go
+	tracer             *tracing.Tracer // Messages are traced with, see trace.go
+	lastActive         time.Time       // Last handled a message, see RunCompaction
+	timers             *utils.TimerWheel
+
+	// Of messages from being read to their reports being written, by type,
+	// see latency.go.
+	latencyLock sync.Mutex
+	latency     map[MessageType]*LatencyHistogram
+	echoLatency bool // Whether sessions are sent a LatencyEcho of each
+
+	// Messages handed over within it are handled in the order they were read,
+	// see fairness.go.
+	fairnessWindow time.Duration
+	lastReadAt     time.Time // Of the last handled, only used by sessionHandler
+
+	// Market data each owner may see, and those not logged on may, see
+	// entitlement.go.
+	dataTiers     map[string]DataTier
+	anonymousTier DataTier
+
+	// Snapshots asked for by admins, taken by RunSnapshots, see snapshot.go.
+	snapshots    chan chan error
+	snapshotting atomic.Bool
+
+	// Sessions are served over TLS with it, if set, see tls.go.
+	tlsConfig *tls.Config
+	tlsStats  tlsCounters
+
+	// Trading calendars symbols move between phases on, and the phases admins
+	// have put them in over them, see schedule.go.
+	calendars      map[CalendarScope]TradingCalendar
+	phaseOverrides map[CalendarScope]TradingPhase
+	phases         map[string]TradingPhase // Each ticker was last reported in
+	queuePreOpen   bool                    // Whether orders sent in pre-open are held for the open
+	heldOrders     map[string][]Order      // By ticker, in the order they were sent
+	openingAuction bool                    // Whether orders sent in pre-open go into an auction, see auction.go
+
+	// Sessions being certified, by address, and the latest report of each owner
+	// certified, see certify.go.
+	certifyTimeout time.Duration // Zero unless in certification mode
+	certifyDir     string
+	certifications map[string]*certification
+	certified      map[string]CertificationReport
+
+	// Set as the server winds down ahead of stopping, see drain.go.
+	draining bool
+	listener net.Listener // Nil until Run is listening
+
+	// Pre-trade checks of new orders, see pretrade.go.
+	riskLimits      map[string]RiskLimits // By owner
+	referencePrices map[string]float64    // By ticker, until it trades
+	lastPrices      map[string]float64    // Each ticker last traded at
+	indexPrices     map[string]float64    // From outside the exchange, see index.go
+	haltedSymbols   map[string]bool       // Refusing new orders, see halt.go
+
+	// Messages each session may send a second, and at once, see ratelimit.go.
+	messageRate  float64
+	messageBurst int
+
+	// New orders submitted to the engine without waiting on them, and those
+	// yet to be acknowledged in the order they were sent, see pipeline.go.
+	pipeline  PipelinedEngine
+	pipelined []*pipelinedOrder
+
+	// Set while running the reaper, see reaper.go.
+	reaping      bool
+	reapIdle     time.Duration
+	abandonAfter time.Duration
 }
 
 func New(address string, port int, engine Engine) *Server {
@@ -59,12 +205,71 @@ func New(address string, port int, engine Engine) *Server {
 		address:        address,
 		port:           port,
 		engine:         engine,
-		pool:           utils.NewWorkerPool(defaultNWorkers),
-		clientSessions: make(map[string]ClientSession),
-		clientMessages: make(chan ClientMessage, 1),
+		connections:    make(map[string]*ClientSession),
+		clientSessions: make(map[string]*ClientSession),
+		clientMessages: make(chan ClientMessage, DefaultInputQueueDepth),
+		calls:          make(chan func()),
+		admins:         make(map[string]bool),
+		observers:      make(map[string]bool),
+		brokers:        make(map[string]map[string]bool),
+		orderLimits:    make(map[string]uint64),
+		dataTiers:      make(map[string]DataTier),
+		snapshots:      make(chan chan error),
+		lastPrices:     make(map[string]float64),
+		indexPrices:    make(map[string]float64),
+		haltedSymbols:  make(map[string]bool),
+		phaseOverrides: make(map[CalendarScope]TradingPhase),
+		phases:         make(map[string]TradingPhase),
+		heldOrders:     make(map[string][]Order),
+		certifications: make(map[string]*certification),
+		certified:      make(map[string]CertificationReport),
+		clock:          SystemClock{},
+		maxBatchBytes:  DefaultMaxReportBatchBytes,
+		maxBatchDelay:  DefaultMaxReportBatchDelay,
+		writeQueueLen:  DefaultWriteQueueLen,
+		timers:         utils.NewTimerWheel(DefaultTimerTick),
+		latency:        make(map[MessageType]*LatencyHistogram),
+	}
+}
+
+// SetClock sets the clock orders are stamped with as they arrive. It should be
+// the engine's, so an order's timestamps are all on the same timeline. Latency
+// probes are always measured in real time.
+func (s *Server) SetClock(clock Clock) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.clock = clock
+}
+
+// SetIdleTimeout disconnects sessions which send nothing for timeout. Zero, the
+// default, never disconnects idle sessions. It applies to sessions connecting
+// after it is set.
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.idleTimeout = timeout
+}
+
+// SetAdmins configures which owners may send admin messages, once logged on.
+func (s *Server) SetAdmins(owners ...string) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	s.admins = make(map[string]bool)
+	for _, owner := range owners {
+		s.admins[owner] = true
 	}
 }
 
+// isAdmin returns whether the session on clientAddress is logged on as an admin.
+func (s *Server) isAdmin(clientAddress string) bool {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	session, ok := s.connections[clientAddress]
+	return ok && session.owner != "" && s.admins[session.owner]
+}
+
 func (s *Server) Shutdown() {
 	log.Info().Msg("server shutting down")
 	s.cancel()
@@ -85,16 +290,17 @@ func (s *Server) Run(ctx context.Context) {
 		return
 	}
 	defer func() {
-		if err := listener.Close(); err != nil {
+		// Already closed if the server was drained.
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			log.Error().Err(err).Msg("unable to close listener")
 		}
 	}()
-
-	// Start the worker pool.
-	t.Go(func() error {
-		s.pool.Setup(t, s.handleConnection)
-		return nil
-	})
+	s.clientSessionsLock.Lock()
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.listener = listener
+	s.clientSessionsLock.Unlock()
 
 	// Start the session handler.
 	t.Go(func() error {
@@ -112,56 +318,154 @@ func (s *Server) Run(ctx context.Context) {
 			log.Info().Msg("listening for new client connections")
 			conn, err := listener.Accept()
 			if err != nil {
+				if s.isDraining() {
+					// Sessions already connected run until stopped.
+					<-ctx.Done()
+					return
+				}
 				log.Error().Err(err).Msg("error accepting client")
 				continue
 			}
 
-			log.Info().
-				Str("address", conn.RemoteAddr().String()).
-				Msg("new client added")
-
-			// Add the client to client sessions we are tracking.
-			// We expect to potentially maintain a long TCP session.
-			s.addClientSession(conn)
-
-			// Pass over the connection to be read from.
-			s.pool.AddTask(conn)
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				// Handshaken off the accept loop, so a client slow to finish
+				// holds up nobody else.
+				t.Go(func() error {
+					if err := s.handshake(ctx, tlsConn); err == nil {
+						s.startSession(t, conn)
+					}
+					return nil
+				})
+				continue
+			}
+			s.startSession(t, conn)
 		}
 	}
 }
 
+// startSession tracks a newly accepted connection, reading from it until the
+// session ends.
+func (s *Server) startSession(t *tomb.Tomb, conn net.Conn) {
+	log.Info().
+		Str("address", conn.RemoteAddr().String()).
+		Msg("new client added")
+
+	// Add the client to client sessions we are tracking.
+	// We expect to potentially maintain a long TCP session.
+	conn = s.queueWrites(s.captureConn(conn))
+	s.addConnection(conn)
+
+	// Read from the connection until the session ends.
+	t.Go(func() error {
+		return s.readSession(t, conn)
+	})
+}
+
 func (s *Server) ReportTrade(trade Trade, err error) error {
 	s.clientSessionsLock.Lock()
 	defer s.clientSessionsLock.Unlock()
 
-	partyReport, counterPartyReport, err := generateWireTradeReports(trade, err)
+	// Observers are told regardless of whether the parties are connected.
+	s.sendDropCopiesLockFree(trade, err)
+	if s.netter != nil && err == nil {
+		s.netter.AddTrade(trade)
+	}
+	// Manual trades were not made at the market, so are no guide to it.
+	if err == nil && trade.Type == MatchedTrade {
+		s.lastPrices[trade.Party.Ticker] = trade.Price
+	}
+
+	partyReport, counterPartyReport := s.tradeReportsLockFree(trade, err)
+
+	// Each side goes to its owner, one not being connected doesn't stop the
+	// other from being told.
+	return errors.Join(
+		s.sendReportToOwnerLockFree(trade.Party.Owner, &partyReport),
+		s.sendReportToOwnerLockFree(trade.CounterParty.Owner, &counterPartyReport),
+	)
+}
+
+// ReportCancel answers a cancel request with an ack, or a reject if the engine
+// refused it. Errors other than refusals are returned to be reported as usual.
+func (s *Server) ReportCancel(clientAddress string, request CancelOrderMessage, ord Order, cancelErr error) error {
+	report, err := s.cancelReport(request, ord, cancelErr)
 	if err != nil {
 		return err
 	}
 
-	party, partyOk := s.clientSessions[trade.Party.Owner]
-	counterParty, counterPartyOk := s.clientSessions[trade.CounterParty.Owner]
-	log.Info().Str("party", trade.Party.Owner).Str("counter", trade.CounterParty.Owner).Msg("reporttrade")
-	if !partyOk || !counterPartyOk {
-		return fmt.Errorf("client does not exist: party [%v], counter [%v]", party, counterParty)
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
 	}
 
-	_, err = party.conn.Write(partyReport)
-	if err != nil {
-		s.deleteClientSessionLockFree(party.conn.RemoteAddr().String())
+	if err := client.send(report); err != nil {
+		s.closeConnectionLockFree(clientAddress)
 		return fmt.Errorf("unable to send report: %w", err)
 	}
+	return nil
+}
 
-	_, err = counterParty.conn.Write(counterPartyReport)
-	if err != nil {
-		s.deleteClientSessionLockFree(counterParty.conn.RemoteAddr().String())
+// cancelReport serializes the ack, or reject, a cancel request is answered
+// with. Errors other than refusals are returned as they are.
+func (s *Server) cancelReport(request CancelOrderMessage, ord Order, cancelErr error) ([]byte, error) {
+	var reason CancelRejectReason
+	switch {
+	case cancelErr == nil:
+		return CancelAck{
+			ClOrdID:           ord.ClOrdID,
+			UUID:              ord.UUID,
+			Ticker:            ord.Ticker,
+			Side:              ord.Side,
+			Price:             ord.LimitPrice,
+			CancelledQuantity: ord.Quantity,
+			QuantityScale:     ord.QuantityScale,
+			PriceScale:        ord.PriceScale,
+			Timestamp:         s.clock.Now(),
+		}.Serialize(), nil
+	case errors.As(cancelErr, &reason):
+		reject := CancelReject{
+			ClOrdID:     request.ClOrdID,
+			UUID:        request.OrderUUID,
+			Reason:      reason,
+			Timestamp:   s.clock.Now(),
+			OrderStatus: OrderUnknown,
+		}
+		// Only an owner's own filled orders come back from the engine.
+		if reason == CancelRejectFilled && ord.UUID != "" {
+			reject.ClOrdID = ord.ClOrdID
+			reject.UUID = ord.UUID
+			reject.OrderStatus = OrderFilled
+			reject.Ticker = ord.Ticker
+			reject.FilledQty = ord.TotalQuantity
+		}
+		return reject.Serialize(), nil
+	}
+	return nil, cancelErr
+}
+
+// ReportOrderAck acknowledges a successfully placed order to the session which
+// sent it.
+func (s *Server) ReportOrderAck(clientAddress string, ack OrderAck) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	if err := client.send(client.encoder.OrderAck(&ack)); err != nil {
+		s.closeConnectionLockFree(clientAddress)
 		return fmt.Errorf("unable to send report: %w", err)
 	}
 	return nil
 }
 
-func (s *Server) ReportOrderPlaced(clientAddress string, ord Order) error {
-	report, err := generateWireOrderPlacedReport(ord)
+func (s *Server) ReportBBO(clientAddress string, bbo BBO) error {
+	bid, ask, err := generateWireBBOReports(bbo)
 	if err != nil {
 		return err
 	}
@@ -169,19 +473,121 @@ func (s *Server) ReportOrderPlaced(clientAddress string, ord Order) error {
 	s.clientSessionsLock.Lock()
 	defer s.clientSessionsLock.Unlock()
 
-	client, ok := s.clientSessions[clientAddress]
+	client, ok := s.connections[clientAddress]
 	if !ok {
 		return ErrClientDoesNotExist
 	}
 
-	_, err = client.conn.Write(report)
+	if err = client.send(bid, ask); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) ReportBookSnapshot(clientAddress string, depth BookDepth) error {
+	snapshot, err := BookSnapshot{depth}.Serialize()
 	if err != nil {
-		s.deleteClientSessionLockFree(clientAddress)
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	if err = client.send(snapshot); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) ReportCandles(clientAddress string, history CandleHistory) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	if err := client.send(history.Serialize()); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) ReportOpenOrders(clientAddress string, orders []Order) error {
+	var reports [][]byte
+	for _, ord := range orders {
+		report, err := generateWireOpenOrderReport(ord)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	if err := client.send(reports...); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// ReportPong answers a ping, stamping the time it leaves the gateway.
+func (s *Server) ReportPong(clientAddress string, ping PingMessage) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	pong := Pong{
+		CorrelationID:   ping.CorrelationID,
+		ClientTimestamp: ping.ClientTimestamp,
+		ReceivedAt:      ping.ReceivedAt,
+		SentAt:          time.Now(),
+	}
+	if err := client.send(pong.Serialize()); err != nil {
+		s.closeConnectionLockFree(clientAddress)
 		return fmt.Errorf("unable to send report: %w", err)
 	}
 	return nil
 }
 
+// ReportUnsolicitedCancel tells an owner their order was cancelled by someone
+// other than themselves. Owners which are not connected will pick up the state
+// of their orders on their next logon.
+func (s *Server) ReportUnsolicitedCancel(ord Order, reason CancelReason) error {
+	report, err := generateWireUnsolicitedCancelReport(ord, reason)
+	if err != nil {
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	return s.sendToOwnerLockFree(ord.Owner, report)
+}
+
 func (s *Server) ReportError(clientAddress string, err error) error {
 	report, err := generateWireErrorReports(err)
 	if err != nil {
@@ -191,87 +597,293 @@ func (s *Server) ReportError(clientAddress string, err error) error {
 	s.clientSessionsLock.Lock()
 	defer s.clientSessionsLock.Unlock()
 
-	client, ok := s.clientSessions[clientAddress]
+	client, ok := s.connections[clientAddress]
 	if !ok {
 		return ErrClientDoesNotExist
 	}
 
-	_, err = client.conn.Write(report)
+	err = client.send(report)
 	if err != nil {
-		s.deleteClientSessionLockFree(clientAddress)
+		s.closeConnectionLockFree(clientAddress)
 		return fmt.Errorf("unable to send report: %w", err)
 	}
 	return nil
 }
 
+// ReportSymbolStatus broadcasts a change in a symbol's status to every session.
+func (s *Server) ReportSymbolStatus(ticker string, status SymbolStatus) error {
+	report, err := generateWireSymbolStatusReport(ticker, status)
+	if err != nil {
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	return s.broadcastLockFree(report)
+}
+
+// broadcastLockFree sends a report to every session.
+func (s *Server) broadcastLockFree(report []byte) error {
+	var errs []error
+	for address, client := range s.connections {
+		if err := client.send(report); err != nil {
+			s.closeConnectionLockFree(address)
+			errs = append(errs, fmt.Errorf("unable to send report: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // sessionHandler reads off incoming messages from clients and handles high-level
-// session logic. Messages are received from the pool of workers.
+// session logic. Messages are received from each session's reader.
 func (s *Server) sessionHandler(t *tomb.Tomb) error {
 	for {
 		select {
 		case <-t.Dying():
 			return nil
+		case <-s.replied():
+			s.runReplies()
+		case call := <-s.calls:
+			s.awaitPipeline(t.Dying())
+			s.callSafely(call)
 		case message := <-s.clientMessages:
-			if err := s.handleMessage(t, message); err != nil {
-				log.Error().
-					Err(err).
-					Str("clientAddress", message.clientAddress).
-					Msg("error handling message")
-				// Log the error back to the client
-				s.ReportError(message.clientAddress, err)
+			for _, message := range s.fairBatch(t.Dying(), message) {
+				s.handleClientMessage(t, message)
 			}
 		}
 	}
 }
 
+// handleClientMessage handles a message handed over by a session's reader,
+// reporting any error back to the session.
+func (s *Server) handleClientMessage(t *tomb.Tomb, message ClientMessage) {
+	s.lastActive = time.Now()
+	s.handledInOrder(message)
+	message.queued.End()
+	_, match := tracing.Start(message.trace, "match")
+	if order, ok := message.message.(NewOrderMessage); ok && s.pipeline != nil {
+		s.submitOrder(message, order, match)
+		return
+	}
+	// Anything else waits on the orders before it, so is reported after them.
+	s.awaitPipeline(t.Dying())
+	s.handled(message, match, s.handleSafely(t, message))
+}
+
+// handled reports the error a message was handled with back to the session,
+// if any, and finishes tracing it.
+func (s *Server) handled(message ClientMessage, match *tracing.Span, err error) {
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("clientAddress", message.clientAddress).
+			Msg("error handling message")
+		// Log the error back to the client
+		s.ReportError(message.clientAddress, err)
+	}
+	match.SetError(err)
+	match.End()
+	s.traceWrites(message, err)
+	s.recordLatency(message)
+	s.release(message.message)
+}
+
 func (s *Server) handleMessage(t *tomb.Tomb, message ClientMessage) error {
+	// Nothing but a logon is accepted until the session has logged on. This is
+	// checked here, rather than as messages are read, as the logon is only
+	// complete once it has been handled.
+	if message.message.GetType() != Logon && !s.loggedOn(message.clientAddress) {
+		return ErrNotLoggedOn
+	}
+
 	switch message.message.GetType() {
 	case NewOrder:
 		order, ok := message.message.(NewOrderMessage)
 		if !ok {
 			return ErrInvalidMessageType
 		}
-		ord, err := order.Order(message.clientAddress)
+		ack, err := s.placeOrder(s.sessionOwner(message.clientAddress), message.origin, order)
 		if err != nil {
 			return err
 		}
-		err = s.engine.PlaceOrder(order.AssetType, ord)
-		if err != nil {
-			s.ReportError(message.clientAddress, err)
-			log.Error().
-				Err(err).
-				Str("clientAddress", message.clientAddress).
-				Msg("error while placing order")
+		// Only once the order is acknowledged does the quoter top back up
+		// whatever it traded.
+		defer s.replenishQuotes()
+		if err := s.ReportOrderAck(message.clientAddress, ack); err != nil {
+			return err
 		}
-
-		// Report back.
-		t.Go(func() error {
-			if err := s.ReportOrderPlaced(message.clientAddress, ord); err != nil {
-				s.ReportError(message.clientAddress, err)
-				log.Error().
-					Err(err).
-					Str("clientAddress", message.clientAddress).
-					Msg("error while generating order")
+		s.certifyOrder(message.clientAddress, ack)
+	case OrderGroup:
+		group, ok := message.message.(OrderGroupMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		acks, err := s.placeOrderGroup(s.sessionOwner(message.clientAddress), message.origin, group)
+		defer s.replenishQuotes()
+		for _, ack := range acks {
+			if err := s.ReportOrderAck(message.clientAddress, ack); err != nil {
+				return err
 			}
-			return nil
-		})
+		}
+		return err
+	case OrderBatch:
+		batch, ok := message.message.(OrderBatchMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		s.handleOrderBatch(message.clientAddress, message.origin, batch)
+		defer s.replenishQuotes()
 	case CancelOrder:
-		// TODO: Implement
-		order, ok := message.message.(CancelOrderMessage)
+		request, ok := message.message.(CancelOrderMessage)
 		if !ok {
 			return ErrInvalidMessageType
 		}
-		err := s.engine.CancelOrder(order.AssetType, order.OrderUUID)
+		ord, err := s.cancelOrder(s.sessionOwner(message.clientAddress), message.origin, request)
 		if err != nil {
-			s.ReportError(message.clientAddress, err)
-			log.Error().
+			log.Warn().
 				Err(err).
 				Str("clientAddress", message.clientAddress).
-				Str("uuid", order.OrderUUID).
-				Msg("error while cancelling order")
+				Str("uuid", request.OrderUUID).
+				Uint64("clOrdId", request.ClOrdID).
+				Msg("cancel refused")
 		}
+		if err := s.ReportCancel(message.clientAddress, request, ord, err); err != nil {
+			return err
+		}
+		s.certifyCancel(message.clientAddress, request, err)
 	case LogBook:
 		s.engine.LogBook()
+	case BBORequest:
+		request, ok := message.message.(BBORequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		bbo, err := s.engine.BBO(request.Ticker)
+		if err != nil {
+			return err
+		}
+		return s.ReportBBO(message.clientAddress, bbo)
+	case BookSnapshotRequest:
+		request, ok := message.message.(BookSnapshotRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		levels := min(int(request.Depth), s.sessionDataTier(message.clientAddress).Levels())
+		depth, err := s.engine.Depth(request.Ticker, levels)
+		if err != nil {
+			return err
+		}
+		return s.ReportBookSnapshot(message.clientAddress, depth)
+	case CandleRequest:
+		request, ok := message.message.(CandleRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		history, err := s.candles(request)
+		if err != nil {
+			return err
+		}
+		return s.ReportCandles(message.clientAddress, history)
+	case ExchangeStatusRequest:
+		return s.ReportExchangeStatus(message.clientAddress)
+	case ExchangeStatusUpdate:
+		request, ok := message.message.(ExchangeStatusUpdateMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.updateExchangeStatus(message.clientAddress, request)
+	case KillSwitch:
+		request, ok := message.message.(KillSwitchMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.pullKillSwitch(message.clientAddress, message.origin, request)
+	case SettleRequest:
+		request, ok := message.message.(SettleRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.settle(message.clientAddress, request)
+	case TradingPhaseOverride:
+		request, ok := message.message.(TradingPhaseOverrideMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.setTradingPhase(message.clientAddress, request)
+	case AdminCancel:
+		request, ok := message.message.(AdminCancelMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		if !s.isAdmin(message.clientAddress) {
+			return ErrNotAdmin
+		}
+		cmd := Command{Origin: message.origin, UUID: request.OrderUUID, Ticker: request.Ticker, Reason: request.Reason}
+		switch request.Scope {
+		case AdminCancelOrderScope:
+			cmd.Type = AdminCancelOrderCommand
+		case AdminCancelSymbolScope:
+			cmd.Type = AdminCancelSymbolCommand
+		default:
+			return ErrInvalidAdminScope
+		}
+		_, err := s.engine.Apply(cmd)
+		return err
+	case DropCopySubscribe:
+		request, ok := message.message.(DropCopySubscribeMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.subscribeDropCopy(message.clientAddress, request)
+	case RegisterParticipant:
+		request, ok := message.message.(RegisterParticipantMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.registerParticipant(message.clientAddress, request)
+	case ResendRequest:
+		request, ok := message.message.(ResendRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		s.certifyResend(message.clientAddress, request)
+		return s.resend(message.clientAddress, request)
+	case QuoteRequest:
+		request, ok := message.message.(QuoteRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.respondToQuote(message.clientAddress, request)
+	case JournalRequest:
+		request, ok := message.message.(JournalRequestMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.sendJournal(message.clientAddress, request)
+	case Ping:
+		ping, ok := message.message.(PingMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		return s.ReportPong(message.clientAddress, ping)
+	case Logon:
+		logon, ok := message.message.(LogonMessage)
+		if !ok {
+			return ErrInvalidMessageType
+		}
+		if err := s.logon(message.clientAddress, logon); err != nil {
+			return err
+		}
+		// Sync the owner back up with anything still resting from before, and
+		// with how the exchange stands.
+		if err := s.ReportOpenOrders(message.clientAddress, s.engine.OpenOrders(logon.Username)); err != nil {
+			return err
+		}
+		if err := s.ReportExchangeStatus(message.clientAddress); err != nil {
+			return err
+		}
+		s.certify(message.clientAddress)
 	default:
 		log.Error().
 			Int("messageType", int(message.message.GetType())).
@@ -282,93 +894,343 @@ func (s *Server) handleMessage(t *tomb.Tomb, message ClientMessage) error {
 	return nil
 }
 
-// handleConnection is a short-lived worker method which reads the next message off the
-// connection, parses and passes it forward to sessionHandler to handle it. If the connection
-// dies, the client ssession is cleaned up. This method does not lock any client session
-// directly and gives up early if the connection is terminated. Therefore this method is
-// thread safe on map accesses.
-// Note, any error returned from here is fatal.
-func (s *Server) handleConnection(t *tomb.Tomb, task any) error {
-	conn, ok := task.(net.Conn)
-	if !ok {
-		return ErrImproperConversion
+// placeOrder places an order on behalf of owner, returning how it is to be
+// acknowledged. origin is the message it came in, see journalInbound.
+func (s *Server) placeOrder(owner string, origin CommandOrigin, order NewOrderMessage) (OrderAck, error) {
+	ord, held, err := s.checkOrder(owner, order)
+	if err != nil {
+		return OrderAck{}, err
+	}
+	if held {
+		return s.ackOf(s.engine, order, ord, OrderNew, ord.TotalQuantity), nil
+	}
+	cmd := Command{Origin: origin, Type: PlaceOrderCommand, AssetType: order.AssetType, Orders: []Order{ord}}
+	if _, err := s.engine.Apply(cmd); err != nil {
+		return OrderAck{}, err
 	}
+	return s.orderAck(s.engine, order, ord), nil
+}
+
+// checkOrder makes owner's order of a new order message, checking it may be
+// placed, and holding it for the open if it is sent before.
+func (s *Server) checkOrder(owner string, order NewOrderMessage) (Order, bool, error) {
+	ord, err := order.Order(owner)
+	if err != nil {
+		return Order{}, false, err
+	}
+	if err := s.checkOrderLimit(ord); err != nil {
+		return Order{}, false, err
+	}
+	if err := s.CheckRiskLimits(ord); err != nil {
+		return Order{}, false, err
+	}
+	if err := s.tradingErr(ord.Ticker); err != nil {
+		return Order{}, false, err
+	}
+	held, err := s.holdOrder(ord)
+	if err != nil {
+		return Order{}, false, err
+	}
+	return ord, held, nil
+}
+
+// orderAck acknowledges a placed order, as it stands on view.
+func (s *Server) orderAck(view EngineView, order NewOrderMessage, ord Order) OrderAck {
+	// Acknowledge with wherever the order got to, it may have traded already.
+	status, leaves := view.OrderStatus(ord.Ticker, ord.UUID)
+	return s.ackOf(view, order, ord, status, leaves)
+}
+
+// ackOf acknowledges an order as having status, with leaves left.
+func (s *Server) ackOf(view EngineView, order NewOrderMessage, ord Order, status OrderStatus, leaves uint64) OrderAck {
+	// Reports echo quantities and prices back in the instrument's precision,
+	// it exists by now even if this was its first order.
+	if inst, ok := view.Instrument(ord.Ticker); ok {
+		ord.QuantityScale = inst.QuantityScale
+		ord.PriceScale = inst.PriceScale
+	}
+	return OrderAck{
+		ClOrdID:        order.ClOrdID,
+		UUID:           ord.UUID,
+		Status:         status,
+		Ticker:         ord.Ticker,
+		Side:           ord.Side,
+		Price:          ord.LimitPrice,
+		LeavesQuantity: leaves,
+		TotalQuantity:  ord.TotalQuantity,
+		QuantityScale:  ord.QuantityScale,
+		PriceScale:     ord.PriceScale,
+		Timestamp:      s.clock.Now(),
+	}
+}
 
-	buffer := make([]byte, MAX_RECV_SIZE)
+// cancelOrder cancels one of owner's orders, by UUID or else by ClOrdID. Brokers
+// may cancel their clients' orders by UUID too, see broker.go.
+func (s *Server) cancelOrder(owner string, origin CommandOrigin, request CancelOrderMessage) (Order, error) {
+	if ord, ok := s.cancelHeldOrder(owner, request); ok {
+		return ord, nil
+	}
+	cmd := Command{Origin: origin, Type: CancelOwnOrderCommand, AssetType: request.AssetType, Owner: owner, UUID: request.OrderUUID}
+	if request.OrderUUID == "" {
+		// Client order ids are only unique to their owner.
+		cmd.Type, cmd.ClOrdID = CancelClientOrderCommand, request.ClOrdID
+		return s.applyCancel(cmd)
+	}
+
+	orderOwner, ok := s.engine.OrderOwner(request.OrderUUID)
+	if !ok || !s.actsFor(owner, orderOwner) {
+		return s.applyCancel(cmd)
+	}
+	cmd.Owner = orderOwner
+	ord, err := s.applyCancel(cmd)
+	if err == nil && orderOwner != owner {
+		if err := s.ReportUnsolicitedCancel(ord, BrokerCancelled); err != nil {
+			log.Warn().Err(err).Str("owner", orderOwner).Msg("unable to report broker cancel")
+		}
+	}
+	return ord, err
+}
+
+// applyCancel applies a cancel of a single order, returning the order.
+func (s *Server) applyCancel(cmd Command) (Order, error) {
+	orders, err := s.engine.Apply(cmd)
+	if len(orders) == 0 {
+		return Order{}, err
+	}
+	return orders[0], err
+}
+
+// admit throttles a command for every book it is routed to, see
+// Engine.Admit. Either it is admitted to all of them, or none. Throttled
+// commands carry the flow control of the book which refused them, see
+// paceSession.
+func (s *Server) admit(message Message) error {
+	tickers, priority := commandRoutes(message)
+	for i, ticker := range tickers {
+		if err := s.engine.Admit(ticker, priority); err != nil {
+			for _, admitted := range tickers[:i] {
+				s.engine.Release(admitted)
+			}
+			return s.throttled(err, ticker, priority)
+		}
+	}
+	return nil
+}
+
+// release releases an admitted command, once handled.
+func (s *Server) release(message Message) {
+	tickers, _ := commandRoutes(message)
+	for _, ticker := range tickers {
+		s.engine.Release(ticker)
+	}
+}
+
+// call runs fn on sessionHandler, in between the messages it handles, so fn may
+// use the engine. It waits for fn to return, unless ctx is done first.
+func (s *Server) call(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
 	select {
-	case <-t.Dying():
-		return nil
-	default:
-		n, err := conn.Read(buffer)
+	case s.calls <- func() {
+		defer close(done)
+		fn()
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
+
+// readSession reads messages off a client's connection for as long as the
+// session lasts, passing them forward to sessionHandler to handle. The next
+// message is not read until the last has been handed over, so a client's
+// messages reach the engine in the order they were sent. Sessions which send
+// nothing, not even a heartbeat, for the idle timeout are disconnected.
+func (s *Server) readSession(t *tomb.Tomb, conn net.Conn) error {
+	address := conn.RemoteAddr().String()
+	defer s.closeConnection(address)
+
+	s.clientSessionsLock.Lock()
+	idleTimeout := s.idleTimeout
+	clock := s.clock
+	tracer := s.tracer
+	s.clientSessionsLock.Unlock()
+	limiter := s.newRateLimiter()
+
+	reader := bufio.NewReaderSize(conn, MAX_RECV_SIZE)
+	var decoder Decoder
+	for {
+		if idleTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
+				return nil
+			}
+		}
+
+		// Reading is timed from when the client has sent something, not from
+		// when the session started waiting on it. Whatever fails here fails
+		// reading the frame just the same.
+		reader.Peek(1)
+		readAt := time.Now()
+		frame, err := readFrame(reader)
 		if err != nil {
-			// TODO: Think about heartbeating but I cba.
-			log.Error().
-				Err(err).
-				Str("address", conn.RemoteAddr().String()).
-				Msg("error reading from connection")
-			s.deleteClientSession(conn.RemoteAddr().String())
+			var netErr net.Error
+			switch {
+			case errors.Is(err, io.EOF):
+				log.Info().Str("address", address).Msg("client disconnected")
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.Warn().Str("address", address).Msg("client idle, disconnecting")
+			default:
+				log.Error().
+					Err(err).
+					Str("address", address).
+					Msg("error reading from connection")
+			}
 			return nil
 		}
+		s.seen(address)
 
-		message, err := parseMessage(buffer[:n])
+		parseAt := tracer.Now()
+		message, err := parseSafely(&decoder, frame)
+		parsedAt := tracer.Now()
+		// Everything but heartbeats is journaled, including what is rejected.
+		var origin CommandOrigin
+		if err != nil || message.GetType() != Heartbeat {
+			origin = s.journalInbound(address, frame)
+		}
 		if err != nil {
 			log.Error().
 				Err(err).
-				Str("address", conn.RemoteAddr().String()).
+				Str("address", address).
 				Msg("error parsing message")
-			s.deleteClientSession(conn.RemoteAddr().String())
 			return nil
 		}
+		if message.GetType() == Heartbeat {
+			s.certifyHeartbeat(address)
+			continue
+		}
+		if s.throttleSession(limiter, address, message) {
+			continue
+		}
+		ctx := traceMessage(tracer, address, message, readAt, parseAt, parsedAt)
+		if !s.dispatch(ctx, t.Dying(), address, origin, message, readAt, clock) {
+			return nil
+		}
+	}
+}
 
-		// Pass over to the message handling buffer and exit this worker.
-		s.clientMessages <- ClientMessage{
-			message:       message,
-			clientAddress: conn.RemoteAddr().String(),
+// dispatch passes a message read off the session on address forward to
+// sessionHandler, unless it is rejected on the way. It returns false only if
+// dying closes before the message could be handed over. ctx carries the
+// message's trace. Orders are stamped as arriving when the message was read
+// off the socket, at readAt, on clock.
+func (s *Server) dispatch(ctx context.Context, dying <-chan struct{}, address string, origin CommandOrigin, message Message, readAt time.Time, clock Clock) bool {
+	switch m := message.(type) {
+	case NewOrderMessage:
+		m.ReceivedAt = arrivedAt(clock, readAt)
+		message = m
+	case OrderGroupMessage:
+		now := arrivedAt(clock, readAt)
+		for i := range m.Orders {
+			m.Orders[i].ReceivedAt = now
+		}
+		message = m
+	case OrderBatchMessage:
+		now := arrivedAt(clock, readAt)
+		for i, entry := range m.Messages {
+			if order, ok := entry.(NewOrderMessage); ok {
+				order.ReceivedAt = now
+				m.Messages[i] = order
+			}
 		}
+		message = m
+	}
 
-		// Push the client connection back to handle the next message.
-		s.pool.AddTask(conn)
+	// Reject malformed commands straight away, they never reach the engine.
+	// The client keeps its session, only the command is rejected.
+	if err := validateMessage(message); err != nil {
+		s.ReportError(address, err)
+		endTrace(ctx, err)
+		return true
 	}
-	return nil
+
+	// Have the risk service check any new orders, before they hold up the
+	// engine. Rejected orders are answered straight away.
+	riskCtx, risk := tracing.Start(ctx, "risk")
+	message, rejected := s.checkRisk(riskCtx, s.sessionOwner(address), message)
+	risk.End()
+	for _, err := range rejected {
+		s.ReportError(address, err)
+	}
+	if message == nil {
+		endTrace(ctx, rejected[0])
+		return true
+	}
+
+	// Throttle commands for books which are backing up. The client keeps its
+	// session, only the command is rejected, and is told when to try again.
+	err := s.admit(message)
+	if err != nil {
+		s.ReportError(address, err)
+	}
+	s.paceSession(address, message, err)
+	if err != nil {
+		endTrace(ctx, err)
+		return true
+	}
+
+	// Pass over to the message handling buffer.
+	_, queued := tracing.Start(ctx, "queue")
+	return s.enqueue(dying, ClientMessage{message: message, clientAddress: address, origin: origin, trace: ctx, queued: queued, readAt: readAt})
 }
 
-// addClientSession is an atomic map add
-func (s *Server) addClientSession(conn net.Conn) {
+// addConnection is an atomic map add
+func (s *Server) addConnection(conn net.Conn) {
 	s.clientSessionsLock.Lock()
 	defer s.clientSessionsLock.Unlock()
 
-	s.clientSessions[conn.RemoteAddr().String()] = ClientSession{
-		conn: conn,
+	address := conn.RemoteAddr().String()
+	session := &ClientSession{
+		conn:     conn,
+		address:  address,
+		outbound: NewOutboundStore(DefaultOutboundStoreSize),
+		journal:  NewJournal(s.clock, DefaultJournalSize),
 	}
+	session.liveness.Seen(time.Now())
+	s.connections[address] = session
+	s.watchLivenessLockFree(session)
 }
 
-// deleteClientSession is an atomic map remove
-func (s *Server) deleteClientSession(address string) {
+// closeConnection is an atomic map remove
+func (s *Server) closeConnection(address string) {
 	s.clientSessionsLock.Lock()
 	defer s.clientSessionsLock.Unlock()
+	s.closeConnectionLockFree(address)
+}
 
-	if client, ok := s.clientSessions[address]; ok {
-		// Cleanup the connection object.
-		if err := client.conn.Close(); err != nil {
-			log.Error().
-				Err(err).
-				Str("clientAddress", address).
-				Msg("unable to close client connection")
-		}
-		delete(s.clientSessions, address)
+// closeConnectionLockFree is intended to prevent renetrancy on locks. A logged
+// on session is kept for its owner to reconnect to.
+func (s *Server) closeConnectionLockFree(address string) {
+	session, ok := s.connections[address]
+	if !ok {
+		return
 	}
-}
 
-// deleteClientSessionLockFree is intended to prevent renetrancy on locks.
-func (s *Server) deleteClientSessionLockFree(address string) {
-	if client, ok := s.clientSessions[address]; ok {
-		// Cleanup the connection object.
-		if err := client.conn.Close(); err != nil {
-			log.Error().
-				Err(err).
-				Str("clientAddress", address).
-				Msg("unable to close client connection")
-		}
-		delete(s.clientSessions, address)
+	// Cleanup the connection object. Reports still batched are dropped, they
+	// are stored to be resent.
+	if session.batcher != nil {
+		session.batcher.stop()
+		session.batcher = nil
+	}
+	session.stopTimers()
+	if err := session.conn.Close(); err != nil {
+		log.Error().
+			Err(err).
+			Str("clientAddress", address).
+			Msg("unable to close client connection")
 	}
+	delete(s.connections, address)
+	session.conn = nil
+	session.address = ""
+	session.disconnectedAt = time.Now()
+	s.abandonLaterLockFree(session)
 }
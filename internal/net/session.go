@@ -0,0 +1,202 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDuplicateSession = errors.New("owner already has an active session")
+	ErrAlreadyLoggedOn  = errors.New("session already logged on")
+)
+
+// SessionPolicy decides what happens when an owner logs on while they already
+// have an active session on another connection.
+type SessionPolicy int
+
+const (
+	// RejectDuplicateSession refuses the new logon, the existing session is kept.
+	RejectDuplicateSession SessionPolicy = iota
+	// TakeoverDuplicateSession terminates the existing session and moves report
+	// delivery for the owner over to the new connection.
+	TakeoverDuplicateSession
+)
+
+// SessionNotice is carried in the Status of a SessionReport.
+type SessionNotice int
+
+const (
+	// Sent to a connection whose logon succeeded.
+	LogonAccepted SessionNotice = iota
+	// Sent to a connection whose logon was refused as the owner is active elsewhere.
+	LogonRejected
+	// Sent to an active session when a duplicate logon for its owner was refused.
+	DuplicateLogonRejected
+	// Sent to a connection whose logon succeeded by replacing an existing session.
+	SessionTakeover
+	// Sent to an active session just before it is terminated by a takeover.
+	SessionTakenOver
+	// Sent to a connection whose logon could not be authenticated, just before
+	// it is disconnected.
+	AuthenticationRejected
+	// Sent to a connection whose logon picked up the session an owner left
+	// behind when they disconnected.
+	SessionResumed
+	// Sent to a connection whose logon was refused as the kill switch is
+	// blocking logons, just before it is disconnected.
+	LogonBlocked
+	// Sent to a session which passed, or failed, certification, see
+	// Server.SetCertification.
+	CertificationPassed
+	CertificationFailed
+)
+
+// SetSessionPolicy configures how duplicate logons are handled.
+func (s *Server) SetSessionPolicy(policy SessionPolicy) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.sessionPolicy = policy
+}
+
+// logon authenticates the owner and binds them to the session on
+// clientAddress, applying the session policy if the owner is already logged on
+// elsewhere. An owner who has since disconnected picks their session back up.
+// Connections which fail authentication are disconnected.
+func (s *Server) logon(clientAddress string, logon LogonMessage) error {
+	owner := logon.Username
+	authErr := s.authenticate(logon)
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	pending, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if pending.owner != "" {
+		return ErrAlreadyLoggedOn
+	}
+	if authErr != nil {
+		log.Warn().
+			Str("owner", owner).
+			Str("clientAddress", clientAddress).
+			Msg("logon authentication failed")
+		s.sendSessionNoticeLockFree(pending, owner, AuthenticationRejected)
+		s.closeConnectionLockFree(clientAddress)
+		return authErr
+	}
+	if s.logonsBlockedLockFree(owner) {
+		log.Warn().
+			Str("owner", owner).
+			Str("clientAddress", clientAddress).
+			Msg("logon refused by kill switch")
+		s.sendSessionNoticeLockFree(pending, owner, LogonBlocked)
+		s.closeConnectionLockFree(clientAddress)
+		return ErrLogonsBlocked
+	}
+
+	session, ok := s.clientSessions[owner]
+	if !ok {
+		// The engine may have applied commands from an earlier session of the
+		// owner's, before a restart, which the new session has to number its
+		// own on from or have them refused as already applied.
+		pending.journal.followOn(s.engine.SessionMarker(owner).Sequence)
+		pending.owner = owner
+		pending.batcher = s.reportBatcherLockFree(pending.conn, logon)
+		s.clientSessions[owner] = pending
+		s.sendSessionNoticeLockFree(pending, owner, LogonAccepted)
+		return nil
+	}
+
+	notice := SessionResumed
+	if session.connected() {
+		switch s.sessionPolicy {
+		case RejectDuplicateSession:
+			log.Warn().
+				Str("owner", owner).
+				Str("clientAddress", clientAddress).
+				Str("activeAddress", session.address).
+				Msg("duplicate logon rejected")
+			s.sendSessionNoticeLockFree(session, owner, DuplicateLogonRejected)
+			s.sendSessionNoticeLockFree(pending, owner, LogonRejected)
+			return ErrDuplicateSession
+		case TakeoverDuplicateSession:
+			log.Warn().
+				Str("owner", owner).
+				Str("clientAddress", clientAddress).
+				Str("activeAddress", session.address).
+				Msg("session taken over")
+			s.sendSessionNoticeLockFree(session, owner, SessionTakenOver)
+			s.closeConnectionLockFree(session.address)
+			notice = SessionTakeover
+		}
+	}
+
+	// Move the owner's session over to this connection.
+	session.journal.adopt(pending.journal)
+	session.liveness = pending.liveness
+	session.conn = pending.conn
+	session.batcher = s.reportBatcherLockFree(session.conn, logon)
+	session.address = clientAddress
+	s.connections[clientAddress] = session
+	pending.stopTimers()
+	session.stopTimers()
+	s.watchLivenessLockFree(session)
+	s.sendSessionNoticeLockFree(session, owner, notice)
+	return nil
+}
+
+// sessionOwner returns who orders from clientAddress belong to, empty if the
+// session has not logged on.
+func (s *Server) sessionOwner(clientAddress string) string {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if session, ok := s.connections[clientAddress]; ok {
+		return session.owner
+	}
+	return ""
+}
+
+// sendToOwnerLockFree writes a report to wherever owner is logged on. Reports
+// for owners which are not connected are only stored, they can ask for them to
+// be resent once they reconnect. The caller must hold clientSessionsLock.
+func (s *Server) sendToOwnerLockFree(owner string, report []byte) error {
+	session, ok := s.clientSessions[owner]
+	if !ok {
+		return nil
+	}
+	if err := session.send(report); err != nil {
+		s.closeConnectionLockFree(session.address)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// sendReportToOwnerLockFree is sendToOwnerLockFree for a report encoded by the
+// owner's session. The caller must hold clientSessionsLock.
+func (s *Server) sendReportToOwnerLockFree(owner string, report *Report) error {
+	session, ok := s.clientSessions[owner]
+	if !ok {
+		return nil
+	}
+	return s.sendToOwnerLockFree(owner, session.encoder.Report(report))
+}
+
+// sendSessionNoticeLockFree writes a session notice, failures are only logged
+// as the session is likely on its way out regardless.
+func (s *Server) sendSessionNoticeLockFree(session *ClientSession, owner string, notice SessionNotice) {
+	report, err := generateWireSessionReport(owner, notice)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to generate session report")
+		return
+	}
+	if err := session.send(report); err != nil {
+		log.Error().
+			Err(err).
+			Str("clientAddress", session.address).
+			Msg("unable to send session report")
+	}
+}
@@ -0,0 +1,151 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSettleTimeout is how long settling a day may take.
+const DefaultSettleTimeout = time.Minute
+
+var ErrNoSettler = errors.New("settlement is not set up")
+
+// A Settler settles a day's trading, see backoffice.Settler. It is run off the
+// session handler.
+type Settler interface {
+	Settle(ctx context.Context, day time.Time) (Settlement, error)
+}
+
+// SettleRequestMessage is an admin running end of day settlement on demand,
+// e.g. to settle a day again.
+//
+//	Day 8 bytes (unix nanos of any time on the day, 0 for today)
+type SettleRequestMessage struct {
+	BaseMessage
+	Day time.Time // Zero for today
+}
+
+func parseSettleRequest(msg []byte) (SettleRequestMessage, error) {
+	m := SettleRequestMessage{BaseMessage: BaseMessage{TypeOf: SettleRequest}}
+
+	if len(msg) < SettleRequestHeaderLen {
+		return SettleRequestMessage{}, ErrMessageTooShort
+	}
+	if day := binary.BigEndian.Uint64(msg[0:8]); day != 0 {
+		m.Day = time.Unix(0, int64(day))
+	}
+	return m, nil
+}
+
+// SettlementSummary answers a SettleRequestMessage once the day is settled.
+//
+//	MessageType 1 byte (SettlementReport)
+//	Day         8 bytes (unix nanos of midnight UTC)
+//	Trades      4 bytes
+//	Owners      4 bytes
+//	Positions   4 bytes (an owner's in one instrument)
+//	Timestamp   8 bytes (unix nanos)
+type SettlementSummary struct {
+	Day       time.Time
+	Trades    uint32
+	Owners    uint32
+	Positions uint32
+	Timestamp time.Time
+}
+
+const SettlementSummaryLen = 1 + 8 + 4 + 4 + 4 + 8
+
+// Serialize converts the summary to be sent on the wire.
+func (summary SettlementSummary) Serialize() []byte {
+	buf := make([]byte, SettlementSummaryLen)
+	buf[0] = byte(SettlementReport)
+	binary.BigEndian.PutUint64(buf[1:9], uint64(summary.Day.UnixNano()))
+	binary.BigEndian.PutUint32(buf[9:13], summary.Trades)
+	binary.BigEndian.PutUint32(buf[13:17], summary.Owners)
+	binary.BigEndian.PutUint32(buf[17:21], summary.Positions)
+	binary.BigEndian.PutUint64(buf[21:29], uint64(summary.Timestamp.UnixNano()))
+	return buf
+}
+
+// SetSettler settles each day's trading as the exchange closes, and lets
+// admins settle a day on demand.
+func (s *Server) SetSettler(settler Settler) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.settler = settler
+}
+
+// settleLater settles the day in the background, as settling may take a while
+// to look up the day's trades. done is called with the result, if not nil.
+func (s *Server) settleLater(day time.Time, done func(Settlement, error)) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.settleLaterLockFree(day, done)
+}
+
+func (s *Server) settleLaterLockFree(day time.Time, done func(Settlement, error)) error {
+	settler := s.settler
+	if settler == nil {
+		return ErrNoSettler
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultSettleTimeout)
+		defer cancel()
+		settlement, err := settler.Settle(ctx, day)
+		if err != nil {
+			log.Error().Err(err).Time("day", day).Msg("unable to settle")
+		}
+		if done != nil {
+			done(settlement, err)
+		}
+	}()
+	return nil
+}
+
+// settle settles the day asked for on behalf of the admin on clientAddress,
+// who is sent a summary once it is done.
+func (s *Server) settle(clientAddress string, request SettleRequestMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+	day := request.Day
+	if day.IsZero() {
+		day = s.clock.Now()
+	}
+	return s.settleLater(day, func(settlement Settlement, err error) {
+		if err != nil {
+			s.ReportError(clientAddress, fmt.Errorf("unable to settle: %w", err))
+			return
+		}
+		s.ReportSettlement(clientAddress, SettlementSummary{
+			Day:       settlement.Day,
+			Trades:    uint32(len(settlement.Trades)),
+			Owners:    uint32(len(settlement.Cash)),
+			Positions: uint32(len(settlement.Positions)),
+			Timestamp: time.Now(),
+		})
+	})
+}
+
+// ReportSettlement tells an admin the day they asked for is settled.
+func (s *Server) ReportSettlement(clientAddress string, summary SettlementSummary) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+	if err := client.send(summary.Serialize()); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package net
+
+import (
+	"context"
+	"errors"
+	. "fenrir/internal/common"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNotSnapshotting = errors.New("snapshots are not being taken")
+)
+
+// A Snapshotter captures the state of the books, see engine.Snapshot. It is
+// driven from the session handler, alongside the engine.
+type Snapshotter interface {
+	Snapshot() Snapshot
+}
+
+// RunSnapshots takes a snapshot every interval and hands it to save, until ctx
+// is done. Snapshots are captured on the session handler but saved off it, so
+// writing them out never holds up matching. One is only saved if a command has
+// been applied since the last. Zero every only takes those asked for, see
+// TriggerSnapshot.
+func (s *Server) RunSnapshots(ctx context.Context, snapshotter Snapshotter, every time.Duration, save func(Snapshot) error) {
+	var tick <-chan time.Time
+	if every > 0 {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	s.snapshotting.Store(true)
+	defer s.snapshotting.Store(false)
+
+	var saved uint64
+	for {
+		var triggered chan error
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case triggered = <-s.snapshots:
+		}
+
+		var snap Snapshot
+		if err := s.call(ctx, func() { snap = snapshotter.Snapshot() }); err != nil {
+			if triggered != nil {
+				triggered <- err
+			}
+			return
+		}
+		if snap.Markers.Sequence == saved && triggered == nil {
+			continue
+		}
+		err := save(snap)
+		if triggered != nil {
+			triggered <- err
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("unable to save snapshot")
+			continue
+		}
+		saved = snap.Markers.Sequence
+	}
+}
+
+// TriggerSnapshot has RunSnapshots take and save a snapshot now, whether or not
+// anything has changed since the last, returning once it is saved.
+func (s *Server) TriggerSnapshot(ctx context.Context) error {
+	if !s.snapshotting.Load() {
+		return ErrNotSnapshotting
+	}
+	// Buffered, so RunSnapshots is never held up by a caller who gave up.
+	done := make(chan error, 1)
+	select {
+	case s.snapshots <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
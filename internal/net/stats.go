@@ -0,0 +1,36 @@
+package net
+
+import "strings"
+
+// Stats is a snapshot of how the server is doing, for operators.
+type Stats struct {
+	Connections   int               `json:"connections"` // Open, logged on or not
+	Sessions      int               `json:"sessions"`    // Logged on, connected or not
+	Queue         InputQueueMetrics `json:"queue"`
+	HaltedSymbols []string          `json:"haltedSymbols"`
+	Status        string            `json:"status"` // Exchange state, as in exchangeStatus reports
+	// Of each type of message, from being read to its reports being written,
+	// see Server.Latency.
+	Latency map[string]LatencyStats `json:"latency"`
+	TLS     TLSStats                `json:"tls"` // Zero unless served over TLS
+}
+
+// Stats returns how the server is doing now.
+func (s *Server) Stats() Stats {
+	stats := Stats{
+		Queue:         s.InputQueueMetrics(),
+		HaltedSymbols: []string{},
+		Latency:       s.Latency(),
+		TLS:           s.TLSStats(),
+	}
+	for _, ticker := range s.HaltedSymbols() {
+		stats.HaltedSymbols = append(stats.HaltedSymbols, strings.TrimRight(ticker, "\x00"))
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	stats.Connections = len(s.connections)
+	stats.Sessions = len(s.clientSessions)
+	stats.Status = jsonExchangeStates[s.exchangeStatusLockFree().State]
+	return stats
+}
@@ -0,0 +1,386 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrExchangeHalted         = Reject(RejectTradingHalted, errors.New("exchange is halted"))
+	ErrExchangeClosed         = Reject(RejectTradingHalted, errors.New("exchange is closed"))
+	ErrInvalidStatusEvent     = errors.New("invalid exchange status event")
+	ErrMissingComponent       = errors.New("exchange status event needs a component")
+	ErrInvalidMaintenance     = errors.New("maintenance window ends before it starts")
+	ErrStatusFieldTooLong     = errors.New("exchange status field too long")
+	ErrExchangeNotHalted      = errors.New("exchange is not halted")
+	ErrComponentNotDegraded   = errors.New("component is not degraded")
+	ErrNoMaintenanceScheduled = errors.New("no maintenance is scheduled")
+)
+
+// ExchangeState is whether the exchange as a whole is trading. New orders are
+// refused unless it is open, cancels never are.
+type ExchangeState uint8
+
+const (
+	ExchangeOpen ExchangeState = iota
+	ExchangeHalted
+	ExchangeClosed
+	// Halted by the kill switch, refusing logons from all but admins too.
+	ExchangeKilled
+)
+
+// StatusEvent is what an ExchangeStatusChange is reporting.
+type StatusEvent uint8
+
+const (
+	// StatusCurrent is the status as it stands, sent in answer to an
+	// ExchangeStatusRequest and on logon. It is never broadcast.
+	StatusCurrent StatusEvent = iota
+	StatusOpened
+	StatusClosed
+	StatusHalted
+	StatusResumed
+	StatusComponentDegraded
+	StatusComponentRecovered
+	StatusMaintenanceScheduled
+	StatusMaintenanceCancelled
+	// The kill switch was pulled, see Server.PullKillSwitch. It is never sent
+	// in an ExchangeStatusUpdate, as it does more than change the status.
+	StatusKilled
+)
+
+func (event StatusEvent) Valid() bool {
+	return event <= StatusKilled
+}
+
+// MaintenanceWindow is when the exchange is next down for maintenance, the zero
+// window if it is not.
+type MaintenanceWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ExchangeStatus is the exchange wide state clients are kept up to date with,
+// so they need not work it out from rejects. Any change is broadcast to every
+// session, see ExchangeStatusChange.
+type ExchangeStatus struct {
+	State       ExchangeState
+	Degraded    []string // Components not working as they should, sorted
+	Maintenance MaintenanceWindow
+	Message     string // Said by the operator alongside the last change
+	Timestamp   time.Time
+}
+
+// StatusUpdate is a change to the exchange's status, see
+// Server.UpdateExchangeStatus.
+type StatusUpdate struct {
+	Event       StatusEvent
+	Maintenance MaintenanceWindow // StatusMaintenanceScheduled only
+	Component   string            // Component events only
+	Message     string            // Said to clients alongside it, if anything
+}
+
+// Validate checks the update carries what its event needs.
+func (update StatusUpdate) Validate() error {
+	if update.Event == StatusCurrent || update.Event == StatusKilled || !update.Event.Valid() {
+		return ErrInvalidStatusEvent
+	}
+	switch update.Event {
+	case StatusComponentDegraded, StatusComponentRecovered:
+		if update.Component == "" {
+			return ErrMissingComponent
+		}
+	case StatusMaintenanceScheduled:
+		if update.Maintenance.Start.IsZero() || update.Maintenance.End.Before(update.Maintenance.Start) {
+			return ErrInvalidMaintenance
+		}
+	}
+	if len(update.Component) > math.MaxUint8 || len(update.Message) > math.MaxUint8 {
+		return ErrStatusFieldTooLong
+	}
+	return nil
+}
+
+// ExchangeStatusUpdateMessage is an admin changing the exchange's status.
+//
+//	Event            1 byte (StatusEvent, not StatusCurrent)
+//	MaintenanceStart 8 bytes (unix nanos)
+//	MaintenanceEnd   8 bytes (unix nanos)
+//	ComponentLen     1 byte
+//	MessageLen       1 byte
+//	Component        ComponentLen bytes
+//	Message          MessageLen bytes
+type ExchangeStatusUpdateMessage struct {
+	BaseMessage
+	StatusUpdate
+}
+
+func parseExchangeStatusUpdate(msg []byte) (ExchangeStatusUpdateMessage, error) {
+	m := ExchangeStatusUpdateMessage{BaseMessage: BaseMessage{TypeOf: ExchangeStatusUpdate}}
+
+	if len(msg) < ExchangeStatusUpdateHeaderLen {
+		return ExchangeStatusUpdateMessage{}, ErrMessageTooShort
+	}
+	componentLen, messageLen := int(msg[17]), int(msg[18])
+	if len(msg) < ExchangeStatusUpdateHeaderLen+componentLen+messageLen {
+		return ExchangeStatusUpdateMessage{}, ErrMessageTooShort
+	}
+	m.Event = StatusEvent(msg[0])
+	m.Maintenance.Start = unixNanos(binary.BigEndian.Uint64(msg[1:9]))
+	m.Maintenance.End = unixNanos(binary.BigEndian.Uint64(msg[9:17]))
+	msg = msg[ExchangeStatusUpdateHeaderLen:]
+	m.Component = string(msg[:componentLen])
+	m.Message = string(msg[componentLen : componentLen+messageLen])
+
+	return m, nil
+}
+
+// ExchangeStatusChange is sent to every session whenever the exchange's status
+// changes, to a session asking for it and to each session as it logs on. It
+// carries the whole status after the change, so clients need only keep the
+// latest.
+//
+//	MessageType      1 byte (ExchangeStatusReport)
+//	Event            1 byte (StatusEvent)
+//	State            1 byte (ExchangeState)
+//	Timestamp        8 bytes (unix nanos)
+//	MaintenanceStart 8 bytes (unix nanos, 0 if none is scheduled)
+//	MaintenanceEnd   8 bytes (unix nanos, 0 if none is scheduled)
+//	ComponentLen     1 byte
+//	Component        ComponentLen bytes (what a component event is for)
+//	DegradedCount    1 byte
+//	Degraded         DegradedCount components, each a 1 byte length then name
+//	MessageLen       1 byte
+//	Message          MessageLen bytes
+type ExchangeStatusChange struct {
+	ExchangeStatus
+	Event     StatusEvent
+	Component string
+}
+
+const ExchangeStatusChangeHeaderLen = 1 + 1 + 1 + 8 + 8 + 8
+
+// Serialize converts the change to be sent on the wire.
+func (change ExchangeStatusChange) Serialize() []byte {
+	buf := make([]byte, ExchangeStatusChangeHeaderLen, ExchangeStatusChangeHeaderLen+3+len(change.Component)+len(change.Message))
+
+	buf[0] = byte(ExchangeStatusReport)
+	buf[1] = byte(change.Event)
+	buf[2] = byte(change.State)
+	binary.BigEndian.PutUint64(buf[3:11], uint64(change.Timestamp.UnixNano()))
+	if !change.Maintenance.Start.IsZero() {
+		binary.BigEndian.PutUint64(buf[11:19], uint64(change.Maintenance.Start.UnixNano()))
+		binary.BigEndian.PutUint64(buf[19:27], uint64(change.Maintenance.End.UnixNano()))
+	}
+
+	buf = append(buf, byte(len(change.Component)))
+	buf = append(buf, change.Component...)
+	buf = append(buf, byte(len(change.Degraded)))
+	for _, component := range change.Degraded {
+		buf = append(buf, byte(len(component)))
+		buf = append(buf, component...)
+	}
+	buf = append(buf, byte(len(change.Message)))
+	buf = append(buf, change.Message...)
+	return buf
+}
+
+// ParseExchangeStatusChange reads the change at the head of buf, returning its
+// length.
+func ParseExchangeStatusChange(buf []byte) (ExchangeStatusChange, int, error) {
+	if len(buf) < ExchangeStatusChangeHeaderLen+1 {
+		return ExchangeStatusChange{}, 0, ErrReportTooShort
+	}
+	change := ExchangeStatusChange{
+		Event: StatusEvent(buf[1]),
+		ExchangeStatus: ExchangeStatus{
+			State:     ExchangeState(buf[2]),
+			Timestamp: unixNanos(binary.BigEndian.Uint64(buf[3:11])),
+			Maintenance: MaintenanceWindow{
+				Start: unixNanos(binary.BigEndian.Uint64(buf[11:19])),
+				End:   unixNanos(binary.BigEndian.Uint64(buf[19:27])),
+			},
+		},
+	}
+
+	// Each length prefixed string in turn.
+	n := ExchangeStatusChangeHeaderLen
+	next := func() (string, bool) {
+		if len(buf) < n+1 || len(buf) < n+1+int(buf[n]) {
+			return "", false
+		}
+		s := string(buf[n+1 : n+1+int(buf[n])])
+		n += 1 + len(s)
+		return s, true
+	}
+	var ok bool
+	if change.Component, ok = next(); !ok {
+		return ExchangeStatusChange{}, 0, ErrReportTooShort
+	}
+	if len(buf) < n+1 {
+		return ExchangeStatusChange{}, 0, ErrReportTooShort
+	}
+	count := int(buf[n])
+	n++
+	for range count {
+		component, ok := next()
+		if !ok {
+			return ExchangeStatusChange{}, 0, ErrReportTooShort
+		}
+		change.Degraded = append(change.Degraded, component)
+	}
+	if change.Message, ok = next(); !ok {
+		return ExchangeStatusChange{}, 0, ErrReportTooShort
+	}
+	return change, n, nil
+}
+
+// ExchangeStatus returns the exchange's current status.
+func (s *Server) ExchangeStatus() ExchangeStatus {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	return s.exchangeStatusLockFree()
+}
+
+// exchangeStatusLockFree returns the current status, dropping maintenance
+// which has been and gone.
+func (s *Server) exchangeStatusLockFree() ExchangeStatus {
+	if end := s.status.Maintenance.End; !end.IsZero() && s.clock.Now().After(end) {
+		s.status.Maintenance = MaintenanceWindow{}
+	}
+	status := s.status
+	status.Degraded = slices.Clone(status.Degraded)
+	return status
+}
+
+// UpdateExchangeStatus changes the exchange's status, broadcasting the change
+// to every session. Halting or closing the exchange refuses new orders until
+// it is resumed or opened again.
+func (s *Server) UpdateExchangeStatus(update StatusUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	// Nothing reopens an exchange which is shutting down.
+	if s.draining && (update.Event == StatusOpened || update.Event == StatusResumed) {
+		return ErrExchangeDraining
+	}
+	status := s.exchangeStatusLockFree()
+	switch update.Event {
+	case StatusOpened:
+		status.State = ExchangeOpen
+	case StatusClosed:
+		status.State = ExchangeClosed
+	case StatusHalted:
+		status.State = ExchangeHalted
+	case StatusResumed:
+		if status.State != ExchangeHalted && status.State != ExchangeKilled {
+			return ErrExchangeNotHalted
+		}
+		status.State = ExchangeOpen
+	case StatusComponentDegraded:
+		if i, found := slices.BinarySearch(status.Degraded, update.Component); !found {
+			status.Degraded = slices.Insert(status.Degraded, i, update.Component)
+		}
+	case StatusComponentRecovered:
+		i, found := slices.BinarySearch(status.Degraded, update.Component)
+		if !found {
+			return ErrComponentNotDegraded
+		}
+		status.Degraded = slices.Delete(status.Degraded, i, i+1)
+	case StatusMaintenanceScheduled:
+		status.Maintenance = update.Maintenance
+	case StatusMaintenanceCancelled:
+		if status.Maintenance.Start.IsZero() {
+			return ErrNoMaintenanceScheduled
+		}
+		status.Maintenance = MaintenanceWindow{}
+	}
+	status.Message = update.Message
+	err := s.changeExchangeStatusLockFree(status, update.Event, update.Component)
+
+	// The day's trading is done, so it can be settled.
+	if update.Event == StatusClosed && s.settler != nil {
+		s.settleLaterLockFree(status.Timestamp, nil)
+	}
+	return err
+}
+
+// changeExchangeStatusLockFree sets the exchange's status, broadcasting event
+// to every session.
+func (s *Server) changeExchangeStatusLockFree(status ExchangeStatus, event StatusEvent, component string) error {
+	status.Timestamp = s.clock.Now()
+	s.status = status
+
+	log.Info().
+		Int("event", int(event)).
+		Int("state", int(status.State)).
+		Str("component", component).
+		Str("note", status.Message).
+		Msg("exchange status changed")
+
+	return s.broadcastLockFree(ExchangeStatusChange{
+		ExchangeStatus: status,
+		Event:          event,
+		Component:      component,
+	}.Serialize())
+}
+
+// updateExchangeStatus changes the exchange's status on behalf of the admin on
+// clientAddress.
+func (s *Server) updateExchangeStatus(clientAddress string, request ExchangeStatusUpdateMessage) error {
+	if !s.isAdmin(clientAddress) {
+		return ErrNotAdmin
+	}
+	return s.UpdateExchangeStatus(request.StatusUpdate)
+}
+
+func (s *Server) ReportExchangeStatus(clientAddress string) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	client, ok := s.connections[clientAddress]
+	if !ok {
+		return ErrClientDoesNotExist
+	}
+
+	report := ExchangeStatusChange{ExchangeStatus: s.exchangeStatusLockFree()}.Serialize()
+	if err := client.send(report); err != nil {
+		s.closeConnectionLockFree(clientAddress)
+		return fmt.Errorf("unable to send report: %w", err)
+	}
+	return nil
+}
+
+// tradingErr returns why new orders on tickers are refused, nil if they are
+// not. See also HaltSymbol.
+func (s *Server) tradingErr(tickers ...string) error {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+
+	if s.draining {
+		return ErrExchangeDraining
+	}
+	switch s.status.State {
+	case ExchangeHalted, ExchangeKilled:
+		return ErrExchangeHalted
+	case ExchangeClosed:
+		return ErrExchangeClosed
+	}
+	for _, ticker := range tickers {
+		if s.haltedSymbols[ticker] {
+			return fmt.Errorf("%w: %s", ErrSymbolHalted, ticker)
+		}
+	}
+	return nil
+}
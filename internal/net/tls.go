@@ -0,0 +1,220 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TLSHandshakeTimeout is how long a client connecting over TLS has to finish
+// its handshake before it is disconnected.
+const TLSHandshakeTimeout = 5 * time.Second
+
+var (
+	ErrInvalidTicketKey = errors.New("session ticket keys must be 32 bytes of hex, one a line")
+	ErrNoTicketKeys     = errors.New("no session ticket keys found")
+)
+
+// TLSStats counts the TLS handshakes clients have made, and how many of them
+// resumed an earlier session off its ticket, skipping most of the handshake.
+type TLSStats struct {
+	Handshakes uint64 `json:"handshakes"`
+	Resumed    uint64 `json:"resumed"`
+	Failed     uint64 `json:"failed"`
+}
+
+type tlsCounters struct {
+	handshakes atomic.Uint64
+	resumed    atomic.Uint64
+	failed     atomic.Uint64
+}
+
+// SetTLS has sessions served over TLS with config, see ServerTLSConfig. It
+// must be set before Run.
+func (s *Server) SetTLS(config *tls.Config) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.tlsConfig = config
+}
+
+// TLSStats returns the TLS handshakes made so far.
+func (s *Server) TLSStats() TLSStats {
+	return TLSStats{
+		Handshakes: s.tlsStats.handshakes.Load(),
+		Resumed:    s.tlsStats.resumed.Load(),
+		Failed:     s.tlsStats.failed.Load(),
+	}
+}
+
+// ServerTLSConfig serves sessions with the certificate and key in PEM files.
+// Clients are handed session tickets, so one which drops can resume its TLS
+// session as it reconnects in a single round trip, then have whatever it
+// missed resent, see ResendRequestMessage.
+//
+// Tickets are encrypted with keys made afresh each time the server starts,
+// unless ticketKeysFile is given, see LoadTicketKeys, so that they outlive
+// restarts and are honoured by every server sharing the keys.
+func ServerTLSConfig(certFile, keyFile, ticketKeysFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if ticketKeysFile == "" {
+		return config, nil
+	}
+	keys, err := LoadTicketKeys(ticketKeysFile)
+	if err != nil {
+		return nil, err
+	}
+	config.SetSessionTicketKeys(keys)
+	return config, nil
+}
+
+// LoadTicketKeys reads session ticket keys from path, each 32 bytes of hex on
+// a line of its own, blank lines and those starting with # being skipped. The
+// first encrypts new tickets, all of them decrypt, so keys are rotated by
+// adding a new one at the top and dropping the last once its tickets have
+// expired.
+func LoadTicketKeys(path string) ([][32]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys [][32]byte
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var key [32]byte
+		if n, err := hex.Decode(key[:], []byte(text)); err != nil || n != len(key) || len(text) != hex.EncodedLen(len(key)) {
+			return nil, fmt.Errorf("%w: %s:%d", ErrInvalidTicketKey, path, line)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoTicketKeys, path)
+	}
+	return keys, nil
+}
+
+// handshake finishes the TLS handshake of a newly accepted connection, within
+// TLSHandshakeTimeout, closing it if it fails.
+func (s *Server) handshake(ctx context.Context, conn *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, TLSHandshakeTimeout)
+	defer cancel()
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		s.tlsStats.failed.Add(1)
+		log.Warn().
+			Err(err).
+			Str("address", conn.RemoteAddr().String()).
+			Msg("tls handshake failed")
+		conn.Close()
+		return err
+	}
+	s.tlsStats.handshakes.Add(1)
+	if conn.ConnectionState().DidResume {
+		s.tlsStats.resumed.Add(1)
+	}
+	return nil
+}
+
+// FileSessionCache is a tls.ClientSessionCache kept in a file, so that a client
+// can resume its TLS session after restarting, not only after reconnecting.
+// Sessions are stored by server, the file holding the tickets needed to
+// resume them, so it must be kept private.
+type FileSessionCache struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileSessionCache returns a cache of sessions kept in path, made once a
+// session is first stored.
+func NewFileSessionCache(path string) *FileSessionCache {
+	return &FileSessionCache{path: path}
+}
+
+// cachedSession is a session as FileSessionCache stores it.
+type cachedSession struct {
+	Ticket []byte `json:"ticket"`
+	State  []byte `json:"state"`
+}
+
+func (cache *FileSessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cached, ok := cache.load()[key]
+	if !ok {
+		return nil, false
+	}
+	state, err := tls.ParseSessionState(cached.State)
+	if err != nil {
+		return nil, false
+	}
+	session, err := tls.NewResumptionState(cached.Ticket, state)
+	if err != nil {
+		return nil, false
+	}
+	return session, true
+}
+
+// Put stores the session for key, or forgets it if session is nil. A session
+// which cannot be stored is only kept until the client exits.
+func (cache *FileSessionCache) Put(key string, session *tls.ClientSessionState) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	sessions := cache.load()
+	if session == nil {
+		delete(sessions, key)
+	} else {
+		ticket, state, err := session.ResumptionState()
+		if err != nil {
+			return
+		}
+		encoded, err := state.Bytes()
+		if err != nil {
+			return
+		}
+		sessions[key] = cachedSession{Ticket: ticket, State: encoded}
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(cache.path, data, 0o600); err != nil {
+		log.Warn().Err(err).Str("path", cache.path).Msg("unable to store tls session")
+	}
+}
+
+// load reads the sessions stored so far, none if they cannot be read.
+func (cache *FileSessionCache) load() map[string]cachedSession {
+	sessions := make(map[string]cachedSession)
+	if data, err := os.ReadFile(cache.path); err == nil {
+		json.Unmarshal(data, &sessions)
+	}
+	return sessions
+}
@@ -0,0 +1,62 @@
+package net
+
+import (
+	"context"
+	"fenrir/internal/tracing"
+	"time"
+)
+
+// SetTracer traces messages read off sessions from then on, each as a span
+// with one for every stage it goes through: read off the socket, parsed,
+// checked for risk, queued for the engine, matched (or otherwise handled) and
+// the reports it caused written back to the client. Nil, the default, traces
+// nothing.
+func (s *Server) SetTracer(tracer *tracing.Tracer) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.tracer = tracer
+}
+
+// traceMessage starts the trace of a message read off the session on address,
+// if it is sampled, with spans for reading and parsing it as they were timed.
+// Messages only ever read whole, as over WebSockets, are read as they are
+// parsed.
+func traceMessage(tracer *tracing.Tracer, address string, message Message, readAt, parseAt, parsedAt time.Time) context.Context {
+	ctx, span := tracer.Start(context.Background(), "message", readAt)
+	if span == nil {
+		return ctx
+	}
+	span.SetString("client.address", address)
+	span.SetInt("message.type", int64(message.GetType()))
+	if parseAt.After(readAt) {
+		_, read := tracing.StartAt(ctx, "read", readAt)
+		read.EndAt(parseAt)
+	}
+	_, parse := tracing.StartAt(ctx, "parse", parseAt)
+	parse.EndAt(parsedAt)
+	return ctx
+}
+
+// endTrace ends the trace of a message which goes no further, as it failed
+// with err if not nil.
+func endTrace(ctx context.Context, err error) {
+	span := tracing.FromContext(ctx)
+	span.SetError(err)
+	span.End()
+}
+
+// traceWrites ends the trace of a message once the reports sessionHandler
+// wrote back to its client in handling it have been, as it failed with err if
+// not nil. Reports to other sessions, e.g. counterparties, are not waited on.
+func (s *Server) traceWrites(message ClientMessage, err error) {
+	span := tracing.FromContext(message.trace)
+	if span == nil {
+		return
+	}
+	span.SetError(err)
+	_, write := tracing.Start(message.trace, "write")
+	s.afterWrites(message.clientAddress, func() {
+		write.End()
+		span.End()
+	})
+}
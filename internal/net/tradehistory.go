@@ -0,0 +1,37 @@
+package net
+
+import (
+	"context"
+	. "fenrir/internal/common"
+)
+
+// A TradeHistory looks back over every trade kept for good, see tradestore. It
+// is queried from the API's goroutines, not the session handler.
+type TradeHistory interface {
+	Trades(query TradeQuery) ([]TradeRecord, error)
+}
+
+// SetTradeHistory answers trade queries from history rather than the trades
+// the engine still keeps in memory.
+func (s *Server) SetTradeHistory(history TradeHistory) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.tradeHistory = history
+}
+
+// Trades picks out trades from history, if there is one, or else those the
+// engine still keeps. It must not be called from the session handler.
+func (s *Server) Trades(ctx context.Context, query TradeQuery) ([]TradeRecord, error) {
+	s.clientSessionsLock.Lock()
+	history := s.tradeHistory
+	s.clientSessionsLock.Unlock()
+	if history != nil {
+		return history.Trades(query)
+	}
+
+	var trades []TradeRecord
+	err := s.call(ctx, func() {
+		trades = s.engine.QueryTrades(query)
+	})
+	return trades, err
+}
@@ -0,0 +1,68 @@
+package net
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"math"
+)
+
+var (
+	ErrUnknownAssetType   = Reject(RejectInvalidOrder, errors.New("unknown asset type"))
+	ErrInvalidSide        = Reject(RejectInvalidOrder, errors.New("invalid side"))
+	ErrInvalidOrderType   = Reject(RejectInvalidOrder, errors.New("invalid order type"))
+	ErrInvalidTimeInForce = Reject(RejectInvalidOrder, errors.New("invalid time in force"))
+	ErrZeroQuantity       = Reject(RejectInvalidQuantity, errors.New("quantity must be positive"))
+	ErrInvalidPrice       = Reject(RejectInvalidPrice, errors.New("limit price must be positive"))
+	ErrMissingOrderID     = errors.New("cancel needs an order uuid or client order id")
+)
+
+// validateMessage does the sanity checks which need no book state, so garbage
+// is rejected at the gateway rather than queued up behind real work for the
+// engine.
+func validateMessage(message Message) error {
+	switch m := message.(type) {
+	case NewOrderMessage:
+		return m.Validate()
+	case OrderGroupMessage:
+		return m.Validate()
+	case OrderBatchMessage:
+		return m.Validate()
+	case CandleRequestMessage:
+		return m.Validate()
+	case ExchangeStatusUpdateMessage:
+		return m.Validate()
+	case CancelOrderMessage:
+		if !m.AssetType.Valid() {
+			return ErrUnknownAssetType
+		}
+		if m.OrderUUID == "" && m.ClOrdID == 0 {
+			return ErrMissingOrderID
+		}
+	}
+	return nil
+}
+
+// Validate checks the order is well formed. It says nothing of whether the
+// order can trade.
+func (o NewOrderMessage) Validate() error {
+	if !o.AssetType.Valid() {
+		return ErrUnknownAssetType
+	}
+	if !o.Side.Valid() {
+		return ErrInvalidSide
+	}
+	if !o.OrderType.Valid() {
+		return ErrInvalidOrderType
+	}
+	if !o.TimeInForce.Valid() {
+		return ErrInvalidTimeInForce
+	}
+	if o.Quantity == 0 {
+		return ErrZeroQuantity
+	}
+	// Market orders take whatever price the book gives them.
+	if o.OrderType == LimitOrder && (!(o.LimitPrice > 0) || math.IsInf(o.LimitPrice, 1)) {
+		return ErrInvalidPrice
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package net
+
+import (
+	"context"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// Gateway accepts WebSocket connections speaking JSON rather than the binary
+// protocol, so browsers and scripting languages can trade without a codec. See
+// json.go for the messages.
+//
+// Each connection is a session on the server, logged on, throttled and
+// reported to exactly as a TCP one, so both kinds of client trade against the
+// same books. Connections may also subscribe to the feed's market data, which
+// is sent on the same connection, as much of it as the session's DataTier is
+// entitled to.
+type Gateway struct {
+	address  string
+	port     int
+	server   *Server
+	feed     *Feed
+	upgrader websocket.Upgrader
+}
+
+func NewGateway(address string, port int, server *Server, feed *Feed) *Gateway {
+	return &Gateway{
+		address: address,
+		port:    port,
+		server:  server,
+		feed:    feed,
+		upgrader: websocket.Upgrader{
+			// Browsers connect from pages served elsewhere. Sessions still have
+			// to log on like any other.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+func (g *Gateway) Run(ctx context.Context) {
+	httpServer := &http.Server{
+		Addr: fmt.Sprintf("%s:%d", g.address, g.port),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			g.serve(ctx, w, r)
+		}),
+	}
+	// Unblock ListenAndServe on shutdown.
+	go func() {
+		<-ctx.Done()
+		if err := httpServer.Close(); err != nil {
+			log.Error().Err(err).Msg("unable to close websocket gateway")
+		}
+	}()
+
+	log.Info().Msg("websocket gateway running")
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Msg("unable to start websocket gateway")
+	}
+}
+
+// serve upgrades a request and reads messages off the connection for as long
+// as the session lasts, much as readSession does for TCP sessions.
+func (g *Gateway) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request.
+		log.Error().Err(err).Str("address", r.RemoteAddr).Msg("unable to upgrade websocket")
+		return
+	}
+	sock := &socket{ws: ws}
+	conn := g.server.queueWrites(&jsonConn{socket: sock, numbered: true})
+	address := conn.RemoteAddr().String()
+	log.Info().Str("address", address).Msg("new websocket client added")
+
+	// Hijacked connections outlive the http server, so are closed here.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	g.server.addConnection(conn)
+	defer g.server.closeConnection(address)
+	var sub *subscriber
+	defer func() {
+		if sub != nil {
+			g.feed.pubsub.Remove(sub)
+		}
+	}()
+
+	g.server.clientSessionsLock.Lock()
+	idleTimeout := g.server.idleTimeout
+	clock := g.server.clock
+	tracer := g.server.tracer
+	g.server.clientSessionsLock.Unlock()
+	limiter := g.server.newRateLimiter()
+
+	for {
+		if idleTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
+				return
+			}
+		}
+
+		_, data, err := ws.ReadMessage()
+		readAt := time.Now()
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+				log.Info().Str("address", address).Msg("websocket client disconnected")
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.Warn().Str("address", address).Msg("websocket client idle, disconnecting")
+			default:
+				log.Error().
+					Err(err).
+					Str("address", address).
+					Msg("error reading from websocket")
+			}
+			return
+		}
+		g.server.seen(address)
+
+		// Messages are only ever read whole, so are read as they are parsed.
+		parseAt := tracer.Now()
+		message, err := ParseJSONMessage(data)
+		parsedAt := tracer.Now()
+		var origin CommandOrigin
+		if err != nil || message.GetType() != Heartbeat {
+			origin = g.server.journalInbound(address, data)
+		}
+		// A bad message does not lose the framing, as it does on the binary
+		// protocol, so only the message is rejected.
+		if err != nil {
+			g.server.ReportError(address, err)
+			continue
+		}
+		if g.server.throttleSession(limiter, address, message) {
+			continue
+		}
+
+		switch m := message.(type) {
+		case subscribeMessage:
+			if sub == nil {
+				sub = g.feed.pubsub.Add(&jsonConn{socket: sock})
+			}
+			if m.GetType() == Subscribe {
+				if !g.server.sessionDataTier(address).Includes(m.Channel.Tier()) {
+					g.server.ReportError(address, ErrDataNotEntitled)
+					continue
+				}
+				g.feed.pubsub.Subscribe(sub, m.Channel, m.Ticker)
+			} else {
+				g.feed.pubsub.Unsubscribe(sub, m.Channel, m.Ticker)
+			}
+		default:
+			if message.GetType() == Heartbeat {
+				continue
+			}
+			trace := traceMessage(tracer, address, message, parseAt, parseAt, parsedAt)
+			if !g.server.dispatch(trace, ctx.Done(), address, origin, message, readAt, clock) {
+				return
+			}
+		}
+	}
+}
+
+// socket is a WebSocket connection shared by the session's reports and its
+// market data, which are written from different goroutines.
+type socket struct {
+	ws    *websocket.Conn
+	lock  sync.Mutex // Held while writing
+	close sync.Once
+}
+
+// jsonConn is a net.Conn over a socket, for the server and feed to write to as
+// they would a TCP connection. Whatever they write is translated into JSON,
+// one WebSocket message per report. Reads are done off the socket directly.
+type jsonConn struct {
+	*socket
+	numbered bool // Whether reports carry a sequence number, see JSONReports
+}
+
+func (conn *jsonConn) Read([]byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (conn *jsonConn) Write(buf []byte) (int, error) {
+	reports, err := JSONReports(buf, conn.numbered)
+	if err != nil {
+		return 0, err
+	}
+
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for _, report := range reports {
+		if err := conn.ws.WriteJSON(report); err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
+
+// writeEncoded writes messages already encoded as JSON, as the feed's are.
+func (conn *jsonConn) writeEncoded(messages [][]byte) error {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for _, message := range messages {
+		if err := conn.ws.WriteMessage(websocket.TextMessage, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the socket, the first time it is called by either of its
+// writers.
+func (conn *jsonConn) Close() error {
+	var err error
+	conn.close.Do(func() {
+		err = conn.ws.Close()
+	})
+	return err
+}
+
+func (conn *jsonConn) LocalAddr() net.Addr {
+	return conn.ws.LocalAddr()
+}
+
+func (conn *jsonConn) RemoteAddr() net.Addr {
+	return conn.ws.RemoteAddr()
+}
+
+func (conn *jsonConn) SetDeadline(t time.Time) error {
+	if err := conn.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return conn.ws.SetWriteDeadline(t)
+}
+
+func (conn *jsonConn) SetReadDeadline(t time.Time) error {
+	return conn.ws.SetReadDeadline(t)
+}
+
+func (conn *jsonConn) SetWriteDeadline(t time.Time) error {
+	return conn.ws.SetWriteDeadline(t)
+}
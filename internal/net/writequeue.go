@@ -0,0 +1,203 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultWriteQueueLen is how many writes may wait on a session's
+	// connection before its client is considered too slow and disconnected.
+	DefaultWriteQueueLen = 1024
+
+	// How long writes still queued as a connection is closed have to reach
+	// the client, e.g. the notice of why it is being closed.
+	closeFlushTimeout = time.Second
+
+	// Buffers grown past this, e.g. by a large snapshot, are left to the
+	// garbage collector rather than kept in writeBuffers.
+	maxPooledWriteLen = 64 << 10
+)
+
+var ErrWriteQueueFull = errors.New("client too slow, write queue full")
+
+// writeBuffers holds the buffers reports are put together and queued in, for
+// reuse once written, so a session sent reports steadily does not allocate
+// afresh for every one.
+var writeBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// writeBuffer returns an empty buffer from writeBuffers, to be handed back with
+// releaseWriteBuffer once written.
+func writeBuffer() *[]byte {
+	buf := writeBuffers.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func releaseWriteBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledWriteLen {
+		writeBuffers.Put(buf)
+	}
+}
+
+// SetWriteQueueLen sets how many writes may wait on each session's connection,
+// see NewQueuedConn. It applies to sessions connecting after it is set.
+func (s *Server) SetWriteQueueLen(size int) {
+	s.clientSessionsLock.Lock()
+	defer s.clientSessionsLock.Unlock()
+	s.writeQueueLen = size
+}
+
+// queueWrites has a newly accepted connection's writes queued for a writer of
+// its own.
+func (s *Server) queueWrites(conn net.Conn) net.Conn {
+	s.clientSessionsLock.Lock()
+	size := s.writeQueueLen
+	s.clientSessionsLock.Unlock()
+	return NewQueuedConn(conn, size)
+}
+
+// queuedConn is a net.Conn whose writes are queued for a writer of its own, so
+// a client slow to read never holds up whoever writes to it, usually with
+// clientSessionsLock held. Clients which fall too far behind are disconnected,
+// their reports being stored to be resent once they reconnect.
+type queuedConn struct {
+	net.Conn
+	out   chan queuedWrite
+	done  chan struct{} // Closed once the connection is
+	close sync.Once
+}
+
+// queuedWrite is a write waiting on a queuedConn, or with no buf, a call to be
+// made once those ahead of it are written, see afterWrites.
+type queuedWrite struct {
+	buf     *[]byte // From writeBuffers
+	written func()
+}
+
+// NewQueuedConn wraps conn so that up to size writes wait for a writer of their
+// own rather than being written as they are made. A write made while size are
+// waiting fails with ErrWriteQueueFull and closes the connection. Writes which
+// fail do too, for its reader to clean up after as it would a client going
+// away. A size below 1 is taken as 1.
+func NewQueuedConn(conn net.Conn, size int) net.Conn {
+	queued := &queuedConn{
+		Conn: conn,
+		out:  make(chan queuedWrite, max(size, 1)),
+		done: make(chan struct{}),
+	}
+	go queued.write()
+	return queued
+}
+
+func (conn *queuedConn) Write(buf []byte) (int, error) {
+	select {
+	case <-conn.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	// Callers are free to reuse buf once Write returns.
+	queued := writeBuffer()
+	*queued = append(*queued, buf...)
+	select {
+	case conn.out <- queuedWrite{buf: queued}:
+		return len(buf), nil
+	default:
+		releaseWriteBuffer(queued)
+		log.Warn().
+			Str("address", conn.RemoteAddr().String()).
+			Msg("client too slow, disconnecting")
+		// Nothing more is getting through, so nothing queued is flushed.
+		conn.Conn.Close()
+		conn.Close()
+		return 0, ErrWriteQueueFull
+	}
+}
+
+// afterWrites has written called once whatever is queued by then has been
+// written. It is called straight away if the queue is full, and never if the
+// connection is closed before getting to it.
+func (conn *queuedConn) afterWrites(written func()) {
+	select {
+	case conn.out <- queuedWrite{written: written}:
+	default:
+		written()
+	}
+}
+
+// afterWrites has written called once whatever is queued on the connection of
+// the session on clientAddress by then has been written, see
+// queuedConn.afterWrites. It is called straight away if the session's writes
+// are not queued, or it has gone.
+func (s *Server) afterWrites(clientAddress string, written func()) {
+	s.clientSessionsLock.Lock()
+	session, ok := s.connections[clientAddress]
+	s.clientSessionsLock.Unlock()
+	if !ok {
+		written()
+		return
+	}
+	if conn, ok := session.conn.(*queuedConn); ok {
+		conn.afterWrites(written)
+	} else {
+		written()
+	}
+}
+
+// Close stops any more writes being queued, and closes the connection once
+// those already queued have been written, or closeFlushTimeout is up.
+func (conn *queuedConn) Close() error {
+	conn.close.Do(func() {
+		close(conn.done)
+	})
+	return nil
+}
+
+// write drains the queue onto the connection, until it is closed.
+func (conn *queuedConn) write() {
+	defer conn.Conn.Close()
+	for {
+		select {
+		case queued := <-conn.out:
+			if err := queued.write(conn.Conn); err != nil {
+				conn.Close()
+				return
+			}
+		case <-conn.done:
+			conn.flush()
+			return
+		}
+	}
+}
+
+// flush writes whatever is still queued as the connection is closed.
+func (conn *queuedConn) flush() {
+	if err := conn.Conn.SetWriteDeadline(time.Now().Add(closeFlushTimeout)); err != nil {
+		return
+	}
+	for {
+		select {
+		case queued := <-conn.out:
+			if err := queued.write(conn.Conn); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (queued queuedWrite) write(conn net.Conn) error {
+	if queued.written != nil {
+		queued.written()
+		return nil
+	}
+	_, err := conn.Write(*queued.buf)
+	releaseWriteBuffer(queued.buf)
+	return err
+}
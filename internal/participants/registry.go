@@ -0,0 +1,167 @@
+// Package participants keeps the registry of exchange members, so new ones can
+// be onboarded while the exchange is running.
+package participants
+
+import (
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrParticipantExists  = errors.New("participant already registered")
+	ErrInvalidParticipant = errors.New("participant needs an id and secret")
+)
+
+// An Onboarder is told about every participant in the registry, both those
+// loaded at startup and those registered since, so the participant is usable
+// straight away.
+type Onboarder interface {
+	Onboard(participant Participant) error
+}
+
+// Registry is the set of participants, persisted to a file.
+type Registry struct {
+	path         string
+	participants map[string]Participant
+	onboarders   []Onboarder
+	lock         sync.Mutex
+}
+
+// Open loads the registry at path and onboards everyone in it. A missing file
+// is an empty registry, it is created on the first registration.
+func Open(path string, onboarders ...Onboarder) (*Registry, error) {
+	registry := &Registry{
+		path:         path,
+		participants: make(map[string]Participant),
+		onboarders:   onboarders,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load participants: %w", err)
+	}
+
+	var participants []Participant
+	if err := json.Unmarshal(data, &participants); err != nil {
+		return nil, fmt.Errorf("unable to load participants: %w", err)
+	}
+	for _, participant := range participants {
+		if err := registry.onboard(participant); err != nil {
+			return nil, fmt.Errorf("unable to onboard %s: %w", participant.ID, err)
+		}
+		registry.participants[participant.ID] = participant
+	}
+
+	log.Info().Int("participants", len(participants)).Str("path", path).Msg("loaded participants")
+	return registry, nil
+}
+
+// Register adds a new participant. They are persisted before being onboarded,
+// so anyone able to log on survives a restart.
+func (registry *Registry) Register(participant Participant) error {
+	if participant.ID == "" || participant.Secret == "" || strings.ContainsAny(participant.ID, ":\n") {
+		return ErrInvalidParticipant
+	}
+	if participant.MarginMode >= NumMarginModes {
+		return ErrInvalidMarginMode
+	}
+	if participant.DataTier >= NumDataTiers {
+		return ErrInvalidDataTier
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if _, ok := registry.participants[participant.ID]; ok {
+		return ErrParticipantExists
+	}
+	registry.participants[participant.ID] = participant
+	if err := registry.save(); err != nil {
+		delete(registry.participants, participant.ID)
+		return err
+	}
+	if err := registry.onboard(participant); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("participant", participant.ID).
+		Uint8("entitlements", uint8(participant.Entitlements)).
+		Uint64("maxOrderQuantity", participant.MaxOrderQuantity).
+		Uint8("feeTier", participant.FeeTier).
+		Float64("creditLimit", participant.CreditLimit).
+		Stringer("marginMode", participant.MarginMode).
+		Stringer("dataTier", participant.DataTier).
+		Msg("participant onboarded")
+	return nil
+}
+
+// Participants returns everyone registered, ordered by id.
+func (registry *Registry) Participants() []Participant {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	return registry.sorted()
+}
+
+// sorted lists participants by id. The caller must hold the lock.
+func (registry *Registry) sorted() []Participant {
+	participants := make([]Participant, 0, len(registry.participants))
+	for _, participant := range registry.participants {
+		participants = append(participants, participant)
+	}
+	slices.SortFunc(participants, func(a, b Participant) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return participants
+}
+
+func (registry *Registry) onboard(participant Participant) error {
+	for _, onboarder := range registry.onboarders {
+		if err := onboarder.Onboard(participant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the registry alongside and renames it into place, so a crash
+// mid-write never loses it. It holds secrets, so is only readable by its owner.
+// The caller must hold the lock.
+func (registry *Registry) save() error {
+	participants := registry.sorted()
+
+	tmp, err := os.CreateTemp(filepath.Dir(registry.path), filepath.Base(registry.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save participants: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(participants); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to save participants: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to save participants: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to save participants: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), registry.path); err != nil {
+		return fmt.Errorf("unable to save participants: %w", err)
+	}
+	return nil
+}
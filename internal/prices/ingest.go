@@ -0,0 +1,178 @@
+// Package prices ingests reference prices from outside the exchange, such as
+// index providers or other venues, to mark positions, fund perpetuals and
+// collar new orders against.
+package prices
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultStaleAfter is how long a source's price of a ticker is used for
+	// without it being updated, by default.
+	DefaultStaleAfter = 10 * time.Second
+	// How long a source which failed is left before it is run again.
+	restartDelay = time.Second
+)
+
+// A Sink is given the index price of a ticker whenever it changes, and a price
+// of 0 once no source has a fresh one, see net.Server.SetIndexPrice.
+type Sink interface {
+	SetIndexPrice(ctx context.Context, ticker string, price float64) error
+}
+
+// quote is the last price a source gave for a ticker.
+type quote struct {
+	price float64
+	at    time.Time
+}
+
+// selected is the price a ticker was last given to the sink, and the source it
+// came from, -1 for none.
+type selected struct {
+	price  float64
+	source int
+}
+
+// Ingester takes prices from its sources, in order of preference, and keeps
+// the sink up to date with the preferred source's price of each ticker. A
+// source's price goes stale if it is not updated for staleAfter, the next
+// source with a fresh price being failed over to until it is updated again.
+// Once every source's price of a ticker is stale, the sink is told there is
+// none rather than left trusting an old one.
+type Ingester struct {
+	sink       Sink
+	sources    []Source
+	staleAfter time.Duration
+	clock      Clock
+
+	lock     sync.Mutex
+	quotes   []map[string]quote // By source, then ticker
+	selected map[string]selected
+}
+
+func NewIngester(sink Sink, staleAfter time.Duration, sources ...Source) *Ingester {
+	ing := &Ingester{
+		sink:       sink,
+		sources:    sources,
+		staleAfter: staleAfter,
+		clock:      SystemClock{},
+		quotes:     make([]map[string]quote, len(sources)),
+		selected:   make(map[string]selected),
+	}
+	for i := range ing.quotes {
+		ing.quotes[i] = make(map[string]quote)
+	}
+	return ing
+}
+
+// SetClock sets the clock prices are aged by, real time by default. It must be
+// set before running the ingester.
+func (ing *Ingester) SetClock(clock Clock) {
+	ing.clock = clock
+}
+
+// Run runs every source, running them again should they fail, and checks for
+// stale prices until ctx is done.
+func (ing *Ingester) Run(ctx context.Context) {
+	for i, source := range ing.sources {
+		go ing.runSource(ctx, i, source)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ing.clock.After(ing.staleAfter / 2):
+			ing.Check(ctx)
+		}
+	}
+}
+
+func (ing *Ingester) runSource(ctx context.Context, i int, source Source) {
+	publish := func(ticker string, price float64) {
+		ing.publish(ctx, i, ticker, price)
+	}
+	for {
+		err := source.Run(ctx, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Str("source", source.Name()).Msg("price source failed, restarting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// publish records a source's price of ticker.
+func (ing *Ingester) publish(ctx context.Context, source int, ticker string, price float64) {
+	if !(price > 0) {
+		return
+	}
+	ing.lock.Lock()
+	defer ing.lock.Unlock()
+	ing.quotes[source][ticker] = quote{price: price, at: ing.clock.Now()}
+	ing.selectLockFree(ctx, ticker)
+}
+
+// Check fails over from any price which has gone stale.
+func (ing *Ingester) Check(ctx context.Context) {
+	ing.lock.Lock()
+	defer ing.lock.Unlock()
+	for ticker := range ing.selected {
+		ing.selectLockFree(ctx, ticker)
+	}
+}
+
+// Price returns the price of ticker the sink was last given, and the name of
+// the source it came from.
+func (ing *Ingester) Price(ticker string) (float64, string, bool) {
+	ing.lock.Lock()
+	defer ing.lock.Unlock()
+	sel, ok := ing.selected[ticker]
+	if !ok || sel.source < 0 {
+		return 0, "", false
+	}
+	return sel.price, ing.sources[sel.source].Name(), true
+}
+
+// selectLockFree gives the sink the preferred fresh price of ticker, if it has
+// changed. The caller must hold lock, so the sink sees prices in order.
+func (ing *Ingester) selectLockFree(ctx context.Context, ticker string) {
+	now := ing.clock.Now()
+	sel := selected{source: -1}
+	for i, quotes := range ing.quotes {
+		if q, ok := quotes[ticker]; ok && now.Sub(q.at) <= ing.staleAfter {
+			sel = selected{price: q.price, source: i}
+			break
+		}
+	}
+
+	last, ok := ing.selected[ticker]
+	if ok && last == sel {
+		return
+	}
+	if ok && last.source != sel.source {
+		event := log.Warn().Str("ticker", ticker)
+		if last.source >= 0 {
+			event = event.Str("from", ing.sources[last.source].Name())
+		}
+		if sel.source >= 0 {
+			event.Str("to", ing.sources[sel.source].Name()).Msg("failed over price source")
+		} else {
+			event.Msg("every price source is stale")
+		}
+	}
+	ing.selected[ticker] = sel
+
+	if err := ing.sink.SetIndexPrice(ctx, ticker, sel.price); err != nil {
+		log.Error().Err(err).Str("ticker", ticker).Msg("unable to set index price")
+	}
+}
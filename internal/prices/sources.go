@@ -0,0 +1,151 @@
+package prices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultPollInterval is how often REST sources are polled, by default.
+const DefaultPollInterval = time.Second
+
+var ErrInvalidSource = errors.New("invalid price source")
+
+// A Source is somewhere prices come from outside the exchange.
+type Source interface {
+	Name() string
+	// Run publishes prices as they arrive, until ctx is done or the source
+	// fails.
+	Run(ctx context.Context, publish func(ticker string, price float64)) error
+}
+
+// ParseSource parses a "kind:url" price source, kind being "rest" for a REST
+// endpoint polled every poll, or "ws" for a WebSocket stream, e.g.
+// "ws:wss://prices.example.com/stream". See RESTSource and WebSocketSource for
+// what each must send.
+func ParseSource(spec string, poll time.Duration) (Source, error) {
+	kind, address, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not kind:url", ErrInvalidSource, spec)
+	}
+	if _, err := url.ParseRequestURI(address); err != nil {
+		return nil, fmt.Errorf("%w: url %q", ErrInvalidSource, address)
+	}
+	switch strings.ToLower(kind) {
+	case "rest":
+		return NewRESTSource(address, poll), nil
+	case "ws":
+		return NewWebSocketSource(address), nil
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSource, kind)
+}
+
+// RESTSource polls an HTTP endpoint answering with a JSON object of prices by
+// ticker, e.g. {"BTC": 64000.5, "ETH": 3100.25}.
+type RESTSource struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+}
+
+func NewRESTSource(url string, interval time.Duration) *RESTSource {
+	return &RESTSource{
+		url:      url,
+		interval: interval,
+		// A poll taking longer than the interval is as good as failed.
+		client: &http.Client{Timeout: interval},
+	}
+}
+
+func (source *RESTSource) Name() string {
+	return source.url
+}
+
+// Run polls the endpoint every interval. Polls which fail are skipped, the
+// prices going stale if they keep failing.
+func (source *RESTSource) Run(ctx context.Context, publish func(ticker string, price float64)) error {
+	ticker := time.NewTicker(source.interval)
+	defer ticker.Stop()
+	for {
+		if prices, err := source.poll(ctx); err == nil {
+			for symbol, price := range prices {
+				publish(symbol, price)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (source *RESTSource) poll(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price source answered %s", resp.Status)
+	}
+
+	var prices map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// WebSocketSource streams prices from a WebSocket endpoint sending JSON
+// messages of one price each, e.g. {"ticker": "BTC", "price": 64000.5}.
+type WebSocketSource struct {
+	url    string
+	dialer websocket.Dialer
+}
+
+func NewWebSocketSource(url string) *WebSocketSource {
+	return &WebSocketSource{url: url}
+}
+
+func (source *WebSocketSource) Name() string {
+	return source.url
+}
+
+// Run streams prices until the connection drops. Messages which are not
+// prices are ignored.
+func (source *WebSocketSource) Run(ctx context.Context, publish func(ticker string, price float64)) error {
+	conn, _, err := source.dialer.DialContext(ctx, source.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Unblock reading on shutdown.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var msg struct {
+			Ticker string  `json:"ticker"`
+			Price  float64 `json:"price"`
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if json.Unmarshal(data, &msg) == nil && msg.Ticker != "" {
+			publish(msg.Ticker, msg.Price)
+		}
+	}
+}
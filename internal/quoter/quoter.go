@@ -0,0 +1,182 @@
+// Package quoter is a built in market maker for test symbols, so a developer
+// can trade against something locally without running bots of their own.
+package quoter
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNotQuoted     = errors.New("symbol is not quoted")
+	ErrInvalidSymbol = errors.New("quoted symbol needs a positive spread, bid and size")
+)
+
+// DefaultOwner is who the quoter's orders belong to.
+const DefaultOwner = "autoquoter"
+
+// Engine is what the quoter needs of the matching engine. It must only be used
+// from wherever the engine is otherwise driven from. Quotes are placed with
+// Apply, so they are journaled alongside every other order.
+type Engine interface {
+	Apply(cmd Command) ([]Order, error)
+	OpenOrders(owner string) []Order
+	Instrument(ticker string) (Instrument, bool)
+	Now() time.Time
+}
+
+// Symbol is a ticker the quoter makes a market in, quoting Size lots either
+// side of Mid, Spread apart.
+type Symbol struct {
+	Ticker    string
+	AssetType AssetType
+	Mid       float64
+	Spread    float64
+	Size      uint64
+}
+
+func (symbol Symbol) bid() float64 {
+	return symbol.Mid - symbol.Spread/2
+}
+
+func (symbol Symbol) ask() float64 {
+	return symbol.Mid + symbol.Spread/2
+}
+
+// ParseSymbol parses a ticker:mid:spread:size quoted symbol spec.
+func ParseSymbol(spec string) (Symbol, error) {
+	fields := strings.Split(spec, ":")
+	if len(fields) != 4 {
+		return Symbol{}, fmt.Errorf("invalid quoted symbol %q, expected ticker:mid:spread:size", spec)
+	}
+
+	symbol := Symbol{Ticker: fields[0], AssetType: Equities}
+	var err error
+	if symbol.Mid, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return Symbol{}, fmt.Errorf("invalid quoted symbol mid: %w", err)
+	}
+	if symbol.Spread, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return Symbol{}, fmt.Errorf("invalid quoted symbol spread: %w", err)
+	}
+	if symbol.Size, err = strconv.ParseUint(fields[3], 10, 64); err != nil {
+		return Symbol{}, fmt.Errorf("invalid quoted symbol size: %w", err)
+	}
+	return symbol, nil
+}
+
+// Quoter rests passive liquidity on its symbols, topping it back up as it
+// trades, and answers requests for quote on them.
+type Quoter struct {
+	engine  Engine
+	owner   string
+	symbols map[string]Symbol
+}
+
+func New(engine Engine, owner string, symbols ...Symbol) (*Quoter, error) {
+	quoter := &Quoter{
+		engine:  engine,
+		owner:   owner,
+		symbols: make(map[string]Symbol, len(symbols)),
+	}
+	for _, symbol := range symbols {
+		// A quoter with crossed or locked quotes would trade with itself.
+		if !(symbol.Spread > 0) || !(symbol.bid() > 0) || symbol.Size == 0 {
+			return nil, ErrInvalidSymbol
+		}
+		quoter.symbols[symbol.Ticker] = symbol
+	}
+	return quoter, nil
+}
+
+// Replenish tops the quotes on every symbol back up to their size.
+func (quoter *Quoter) Replenish() error {
+	var errs []error
+	for _, symbol := range quoter.symbols {
+		errs = append(errs, quoter.rest(symbol, symbol.Size))
+	}
+	return errors.Join(errs...)
+}
+
+// Quote answers a request for quote, making sure there is at least quantity
+// resting at each side of the quote so it can be traded against.
+func (quoter *Quoter) Quote(ticker string, quantity uint64) (Quote, error) {
+	symbol, ok := quoter.symbols[ticker]
+	if !ok {
+		return Quote{}, ErrNotQuoted
+	}
+	quantity = max(quantity, symbol.Size)
+	if err := quoter.rest(symbol, quantity); err != nil {
+		return Quote{}, err
+	}
+
+	inst, _ := quoter.engine.Instrument(ticker)
+	return Quote{
+		Ticker:        ticker,
+		BidPrice:      symbol.bid(),
+		AskPrice:      symbol.ask(),
+		Quantity:      quantity,
+		QuantityScale: inst.QuantityScale,
+		PriceScale:    inst.PriceScale,
+	}, nil
+}
+
+// rest makes sure at least quantity of the quoter's orders rest at each side of
+// the symbol's quote.
+func (quoter *Quoter) rest(symbol Symbol, quantity uint64) error {
+	resting := map[Side]uint64{}
+	for _, order := range quoter.engine.OpenOrders(quoter.owner) {
+		if order.Ticker != symbol.Ticker {
+			continue
+		}
+		if (order.Side == Buy && order.LimitPrice == symbol.bid()) ||
+			(order.Side == Sell && order.LimitPrice == symbol.ask()) {
+			resting[order.Side] += order.Quantity
+		}
+	}
+
+	var errs []error
+	for _, side := range []Side{Buy, Sell} {
+		if resting[side] >= quantity {
+			continue
+		}
+		price := symbol.bid()
+		if side == Sell {
+			price = symbol.ask()
+		}
+		inst, _ := quoter.engine.Instrument(symbol.Ticker)
+		shortfall := quantity - resting[side]
+		order := Order{
+			UUID:          uuid.New().String(),
+			AssetType:     symbol.AssetType,
+			OrderType:     LimitOrder,
+			TimeInForce:   Day,
+			Ticker:        symbol.Ticker,
+			Side:          side,
+			LimitPrice:    price,
+			Quantity:      shortfall,
+			TotalQuantity: shortfall,
+			QuantityScale: inst.QuantityScale,
+			Timestamp:     quoter.engine.Now(),
+			Owner:         quoter.owner,
+		}
+		_, err := quoter.engine.Apply(Command{Type: PlaceOrderCommand, AssetType: symbol.AssetType, Orders: []Order{order}})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to quote %s: %w", symbol.Ticker, err))
+			continue
+		}
+		log.Debug().
+			Str("ticker", symbol.Ticker).
+			Int("side", int(side)).
+			Float64("price", price).
+			Uint64("quantity", shortfall).
+			Msg("quote replenished")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package simulation
+
+import (
+	. "fenrir/internal/common"
+	"fmt"
+	"math"
+)
+
+// agent is one member of a population, with what it has resting and how it
+// has done so far.
+type agent struct {
+	Population
+	resting []string // UUIDs of orders which may still rest, oldest first
+	placed  int      // Orders placed, for their UUIDs
+	result  AgentResult
+}
+
+// act has the agent look at the market and send what it decides to.
+func (agent *agent) act(sim *Simulation) {
+	agent.prune(sim)
+	switch agent.Kind {
+	case NoiseTrader:
+		agent.noise(sim)
+	case MomentumTrader:
+		agent.momentum(sim)
+	case MarketMaker:
+		agent.quote(sim)
+	}
+}
+
+// noise cancels a resting order or places one, at random.
+func (agent *agent) noise(sim *Simulation) {
+	if len(agent.resting) > 0 && sim.rng.Float64() < agent.CancelRatio {
+		agent.cancel(sim, sim.rng.IntN(len(agent.resting)))
+		return
+	}
+	side := Side(sim.rng.IntN(2))
+	qty := sim.rng.Uint64N(agent.MaxQuantity) + 1
+	if sim.rng.Float64() < agent.MarketRatio {
+		agent.place(sim, side, MarketOrder, 0, qty)
+		return
+	}
+	// Mostly resting a few ticks back, now and then crossing by one.
+	ticks := int64(math.Round(sim.rng.ExpFloat64()*agent.DepthTicks)) - 1
+	if side == Sell {
+		ticks = -ticks
+	}
+	agent.place(sim, side, LimitOrder, sim.price(sim.ticks(sim.value)-ticks), qty)
+}
+
+// momentum takes liquidity in the direction the price has moved over the
+// agent's lookback, if it has moved far enough.
+func (agent *agent) momentum(sim *Simulation) {
+	if len(sim.tape) <= agent.Lookback {
+		return
+	}
+	last := sim.tape[len(sim.tape)-1]
+	move := last/sim.tape[len(sim.tape)-1-agent.Lookback] - 1
+	if math.Abs(move) < agent.Threshold {
+		return
+	}
+	side := Buy
+	if move < 0 {
+		side = Sell
+	}
+	if !agent.within(side) {
+		return
+	}
+	agent.place(sim, side, MarketOrder, 0, sim.rng.Uint64N(agent.MaxQuantity)+1)
+}
+
+// quote replaces the agent's quotes with a bid and offer either side of the
+// price, shifted against what it holds so it is more likely to trade back
+// towards flat.
+func (agent *agent) quote(sim *Simulation) {
+	for len(agent.resting) > 0 {
+		agent.cancel(sim, 0)
+	}
+	skew := int64(math.Round(float64(agent.result.Position) * float64(agent.SpreadTicks) / float64(agent.MaxInventory)))
+	mid := sim.ticks(sim.reference()) - skew
+	spread := int64(agent.SpreadTicks)
+	if agent.within(Buy) {
+		agent.place(sim, Buy, LimitOrder, sim.price(mid-spread), agent.MaxQuantity)
+	}
+	if agent.within(Sell) {
+		agent.place(sim, Sell, LimitOrder, sim.price(mid+spread), agent.MaxQuantity)
+	}
+}
+
+// within is whether the agent can trade further to side without holding more
+// than its most.
+func (agent *agent) within(side Side) bool {
+	limit := int64(agent.MaxInventory)
+	if side == Buy {
+		return agent.result.Position < limit
+	}
+	return agent.result.Position > -limit
+}
+
+// place sends an order, remembering it to cancel if it may rest.
+func (agent *agent) place(sim *Simulation, side Side, orderType OrderType, price float64, qty uint64) {
+	agent.placed++
+	order := Order{
+		UUID:          fmt.Sprintf("%s-%d", agent.result.Owner, agent.placed),
+		AssetType:     sim.config.AssetType,
+		OrderType:     orderType,
+		TimeInForce:   GoodTillCancel,
+		Ticker:        sim.config.Ticker,
+		Side:          side,
+		Owner:         agent.result.Owner,
+		LimitPrice:    price,
+		Quantity:      qty,
+		TotalQuantity: qty,
+		Timestamp:     sim.Now(),
+	}
+	if orderType == MarketOrder {
+		order.TimeInForce = Day
+	}
+	agent.result.Orders++
+	err := sim.apply(agent, Command{Type: PlaceOrderCommand, AssetType: order.AssetType, Orders: []Order{order}})
+	if err == nil && orderType == LimitOrder {
+		agent.resting = append(agent.resting, order.UUID)
+	}
+}
+
+// cancel sends a cancel of the agent's resting order at i, forgetting it.
+func (agent *agent) cancel(sim *Simulation, i int) {
+	uuid := agent.resting[i]
+	agent.resting = append(agent.resting[:i], agent.resting[i+1:]...)
+	agent.result.Cancels++
+	sim.apply(agent, Command{Type: CancelOwnOrderCommand, AssetType: sim.config.AssetType, Owner: agent.result.Owner, UUID: uuid})
+}
+
+// prune forgets the agent's orders which have since filled, so it only cancels
+// what still rests.
+func (agent *agent) prune(sim *Simulation) {
+	resting := agent.resting[:0]
+	for _, uuid := range agent.resting {
+		if _, ok := sim.eng.OrderOwner(uuid); ok {
+			resting = append(resting, uuid)
+		}
+	}
+	agent.resting = resting
+}
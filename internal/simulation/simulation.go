@@ -0,0 +1,501 @@
+// Package simulation runs populations of trading agents against an engine in
+// process, on a virtual clock, so matching can be exercised at scale and what
+// comes of it compared from run to run.
+package simulation
+
+import (
+	"container/heap"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Defaults for whatever a Config leaves out.
+const (
+	DefaultDuration   = time.Hour // Of simulated time
+	DefaultStartPrice = 100.0
+	DefaultVolatility = 0.2 // A year, as a fraction of the value
+	DefaultTickSize   = 0.01
+)
+
+// DefaultTicker is the symbol traded if a Config names none.
+const DefaultTicker = "TEST"
+
+// How many trade prices are kept for momentum traders to look back over.
+const maxTape = 1024
+
+// Kind is what sort of agent a population is made up of.
+type Kind int
+
+const (
+	// NoiseTrader places limit orders around the value, and now and then
+	// market orders, at random, and cancels them at random.
+	NoiseTrader Kind = iota
+	// MomentumTrader buys when the price has risen over its last trades and
+	// sells when it has fallen.
+	MomentumTrader
+	// MarketMaker quotes both sides around the price, leaning its quotes
+	// against what it holds.
+	MarketMaker
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case NoiseTrader:
+		return "noise"
+	case MomentumTrader:
+		return "momentum"
+	case MarketMaker:
+		return "maker"
+	}
+	return fmt.Sprintf("Kind(%d)", int(kind))
+}
+
+// Population is a number of agents of one kind, all acting alike. Anything left
+// zero is defaulted for the kind.
+type Population struct {
+	Kind  Kind
+	Count int
+	// How many times a second of simulated time each agent acts, on average.
+	// Actions are Poisson, so come in bursts and lulls.
+	Intensity   float64
+	MaxQuantity uint64
+	// Noise traders: how many ticks away from the value limit orders rest,
+	// on average, some crossing it by a tick, and the fractions of actions
+	// cancelling a resting order and of orders being market orders. Below
+	// zero for none at all.
+	DepthTicks  float64
+	CancelRatio float64
+	MarketRatio float64
+	// Momentum traders: how many trades back they look, and how far, as a
+	// fraction, the price has to have moved over them to trade on it.
+	Lookback  int
+	Threshold float64
+	// Market makers: how many ticks either side of the price they quote.
+	SpreadTicks int
+	// Momentum traders and market makers: the most they hold long or short
+	// before only trading back towards flat.
+	MaxInventory uint64
+}
+
+// withDefaults fills in whatever population leaves out.
+func (population Population) withDefaults() Population {
+	if population.Intensity <= 0 {
+		population.Intensity = map[Kind]float64{NoiseTrader: 1, MomentumTrader: 0.2, MarketMaker: 2}[population.Kind]
+	}
+	if population.MaxQuantity == 0 {
+		population.MaxQuantity = 100
+	}
+	if population.DepthTicks <= 0 {
+		population.DepthTicks = 5
+	}
+	if population.CancelRatio == 0 {
+		population.CancelRatio = 0.3
+	}
+	if population.MarketRatio == 0 {
+		population.MarketRatio = 0.05
+	}
+	if population.Lookback <= 0 {
+		population.Lookback = 20
+	}
+	if population.Threshold <= 0 {
+		population.Threshold = 0.0002
+	}
+	if population.SpreadTicks <= 0 {
+		population.SpreadTicks = 1
+	}
+	if population.MaxInventory == 0 {
+		population.MaxInventory = 10 * population.MaxQuantity
+	}
+	return population
+}
+
+// DefaultPopulations trade if a Config names none: a crowd of noise traders,
+// a few momentum traders and a couple of market makers.
+var DefaultPopulations = []Population{
+	{Kind: NoiseTrader, Count: 20},
+	{Kind: MomentumTrader, Count: 5},
+	{Kind: MarketMaker, Count: 2},
+}
+
+// Config shapes a simulation. Anything left zero is defaulted.
+type Config struct {
+	Seed      uint64
+	Ticker    string
+	AssetType AssetType
+	// Simulated time the simulation starts at, the Unix epoch if zero, and
+	// how long it runs for.
+	Epoch    time.Time
+	Duration time.Duration
+	// Value the instrument starts at, which noise traders trade around, and
+	// its expected return and volatility over a year, as fractions. The value
+	// follows a geometric Brownian motion, which the price follows as noise
+	// traders trade on it, and the others on them.
+	StartPrice  float64
+	Drift       float64
+	Volatility  float64
+	TickSize    float64
+	Populations []Population
+}
+
+// withDefaults fills in whatever config leaves out.
+func (config Config) withDefaults() Config {
+	if config.Ticker == "" {
+		config.Ticker = DefaultTicker
+	}
+	if config.Epoch.IsZero() {
+		config.Epoch = time.Unix(0, 0).UTC()
+	}
+	if config.Duration <= 0 {
+		config.Duration = DefaultDuration
+	}
+	if config.StartPrice <= 0 {
+		config.StartPrice = DefaultStartPrice
+	}
+	if config.Volatility <= 0 {
+		config.Volatility = DefaultVolatility
+	}
+	if config.TickSize <= 0 {
+		config.TickSize = DefaultTickSize
+	}
+	if len(config.Populations) == 0 {
+		config.Populations = DefaultPopulations
+	}
+	populations := make([]Population, len(config.Populations))
+	for i, population := range config.Populations {
+		populations[i] = population.withDefaults()
+	}
+	config.Populations = populations
+	return config
+}
+
+// Result is what came of a simulation: the trades made, and how each agent
+// fared.
+type Result struct {
+	Commands int // Sent to the engine
+	Rejected int // Of those, refused
+	Trades   int
+	Volume   uint64
+	// Prices of the first and last trades, their range and the volume
+	// weighted average, zero if there were none.
+	Open, High, Low, Close, VWAP float64
+	// Standard deviation of the log return from each trade to the next.
+	Volatility float64
+	Agents     []AgentResult
+}
+
+// AgentResult is what one agent sent and traded. Cash is what it was paid for
+// what it sold less what it paid for what it bought, and PnL that along with
+// what it holds valued at the close.
+type AgentResult struct {
+	Owner                     string
+	Kind                      Kind
+	Orders, Cancels, Rejected int
+	Bought, Sold              uint64
+	Position                  int64
+	Cash, PnL                 float64
+}
+
+// Kinds totals the agents' results by their kind.
+func (result Result) Kinds() map[Kind]AgentResult {
+	kinds := make(map[Kind]AgentResult)
+	for _, agent := range result.Agents {
+		total := kinds[agent.Kind]
+		total.Kind = agent.Kind
+		total.Orders += agent.Orders
+		total.Cancels += agent.Cancels
+		total.Rejected += agent.Rejected
+		total.Bought += agent.Bought
+		total.Sold += agent.Sold
+		total.Position += agent.Position
+		total.Cash += agent.Cash
+		total.PnL += agent.PnL
+		kinds[agent.Kind] = total
+	}
+	return kinds
+}
+
+// Simulation runs agents against an engine, waking each in turn on a virtual
+// clock to look at the book and send what it decides to. Two simulations with
+// the same config, over engines set up the same, come out the same. It is not
+// safe for concurrent use.
+type Simulation struct {
+	config Config
+	eng    *engine.Engine
+	clock  *virtualClock
+	rng    *rand.Rand
+	agents []*agent
+	owners map[string]*agent
+	wakes  wakeQueue
+	value  float64   // Of the instrument, now
+	tape   []float64 // Most recent trade prices, oldest first
+	result Result
+
+	returns, returnsSquared float64 // Sums of the log returns trade to trade
+}
+
+// New readies a simulation of config against eng, which is set to the
+// simulation's clock and a reporter discarding what it is told. Anything else
+// the simulation is to run under, price ladders, match policies, credit limits
+// and so on, is set on eng beforehand.
+func New(eng *engine.Engine, config Config) *Simulation {
+	config = config.withDefaults()
+	sim := &Simulation{
+		config: config,
+		eng:    eng,
+		clock:  &virtualClock{now: config.Epoch},
+		rng:    rand.New(rand.NewPCG(config.Seed, config.Seed)),
+		value:  config.StartPrice,
+		owners: make(map[string]*agent),
+	}
+	eng.SetClock(sim.clock)
+	eng.SetReporter(discardReporter{})
+
+	counts := make(map[Kind]int)
+	for _, population := range config.Populations {
+		for range population.Count {
+			counts[population.Kind]++
+			agent := &agent{
+				Population: population,
+				result: AgentResult{
+					Owner: fmt.Sprintf("%s-%03d", population.Kind, counts[population.Kind]),
+					Kind:  population.Kind,
+				},
+			}
+			sim.agents = append(sim.agents, agent)
+			sim.owners[agent.result.Owner] = agent
+			sim.schedule(len(sim.agents) - 1)
+		}
+	}
+	return sim
+}
+
+// Now is the simulated time.
+func (sim *Simulation) Now() time.Time {
+	return sim.clock.Now()
+}
+
+// Value is what the instrument is worth now, which noise traders trade
+// around.
+func (sim *Simulation) Value() float64 {
+	return sim.value
+}
+
+// Run runs the simulation for its duration, waking agents in the order their
+// times come up, and returns what came of it.
+func (sim *Simulation) Run() Result {
+	end := sim.config.Epoch.Add(sim.config.Duration)
+	for len(sim.wakes) > 0 && !sim.wakes[0].at.After(end) {
+		wake := heap.Pop(&sim.wakes).(wake)
+		sim.move(wake.at.Sub(sim.clock.Now()))
+		sim.clock.advance(wake.at)
+		sim.agents[wake.agent].act(sim)
+		sim.schedule(wake.agent)
+	}
+	sim.clock.advance(end)
+	return sim.Result()
+}
+
+// Result is what has come of the simulation so far.
+func (sim *Simulation) Result() Result {
+	result := sim.result
+	result.Agents = make([]AgentResult, len(sim.agents))
+	for i, agent := range sim.agents {
+		agent.result.PnL = agent.result.Cash + float64(agent.result.Position)*result.Close
+		result.Agents[i] = agent.result
+	}
+	if result.Volume > 0 {
+		result.VWAP /= float64(result.Volume)
+	}
+	if n := float64(result.Trades - 1); n > 1 {
+		mean := sim.returns / n
+		result.Volatility = math.Sqrt(max(sim.returnsSquared/n-mean*mean, 0))
+	}
+	return result
+}
+
+// move walks the value forward dt.
+func (sim *Simulation) move(dt time.Duration) {
+	config := sim.config
+	years := dt.Seconds() / (365 * 24 * 60 * 60)
+	shock := sim.rng.NormFloat64() * math.Sqrt(years)
+	sim.value *= math.Exp((config.Drift-config.Volatility*config.Volatility/2)*years + config.Volatility*shock)
+}
+
+// schedule sets when the agent given next acts.
+func (sim *Simulation) schedule(i int) {
+	dt := sim.rng.ExpFloat64() / sim.agents[i].Intensity
+	heap.Push(&sim.wakes, wake{at: sim.clock.Now().Add(time.Duration(dt * float64(time.Second))), agent: i})
+}
+
+// apply sends cmd on behalf of agent, counting what it does.
+func (sim *Simulation) apply(agent *agent, cmd Command) error {
+	traded := len(sim.eng.Trades)
+	_, err := sim.eng.Apply(cmd)
+	sim.result.Commands++
+	if err != nil {
+		sim.result.Rejected++
+		agent.result.Rejected++
+	}
+	for _, trade := range sim.eng.Trades[traded:] {
+		sim.record(trade)
+	}
+	return err
+}
+
+// record counts a trade towards the price statistics and the positions of
+// both parties.
+func (sim *Simulation) record(trade Trade) {
+	result := &sim.result
+	if result.Trades == 0 {
+		result.Open, result.High, result.Low = trade.Price, trade.Price, trade.Price
+	} else {
+		r := math.Log(trade.Price / result.Close)
+		sim.returns += r
+		sim.returnsSquared += r * r
+	}
+	result.Trades++
+	result.Volume += trade.MatchQty
+	result.High = max(result.High, trade.Price)
+	result.Low = min(result.Low, trade.Price)
+	result.Close = trade.Price
+	// Summed weighted by volume, divided out by Result.
+	result.VWAP += trade.Price * float64(trade.MatchQty)
+
+	sim.tape = append(sim.tape, trade.Price)
+	if len(sim.tape) > maxTape {
+		sim.tape = sim.tape[len(sim.tape)-maxTape/2:]
+	}
+	for _, order := range []*Order{trade.Party, trade.CounterParty} {
+		agent, ok := sim.owners[order.Owner]
+		if !ok {
+			continue
+		}
+		value := trade.Price * float64(trade.MatchQty)
+		if order.Side == Buy {
+			agent.result.Bought += trade.MatchQty
+			agent.result.Position += int64(trade.MatchQty)
+			agent.result.Cash -= value
+		} else {
+			agent.result.Sold += trade.MatchQty
+			agent.result.Position -= int64(trade.MatchQty)
+			agent.result.Cash += value
+		}
+	}
+}
+
+// reference is the price market makers quote around: the middle of the book,
+// else the last trade, else the start price.
+func (sim *Simulation) reference() float64 {
+	if book, err := sim.eng.Book(sim.config.AssetType, sim.config.Ticker); err == nil {
+		bid, _, bidOk := book.BestBid()
+		ask, _, askOk := book.BestAsk()
+		if bidOk && askOk {
+			return (bid + ask) / 2
+		}
+	}
+	if len(sim.tape) > 0 {
+		return sim.tape[len(sim.tape)-1]
+	}
+	return sim.config.StartPrice
+}
+
+// ticks is price as a whole number of ticks, rounded to the nearest.
+func (sim *Simulation) ticks(price float64) int64 {
+	return int64(math.Round(price / sim.config.TickSize))
+}
+
+// price is the price ticks ticks up from zero, no lower than a tick.
+func (sim *Simulation) price(ticks int64) float64 {
+	ticks = max(ticks, 1)
+	// Dividing by a whole number of ticks to the unit rounds as a price
+	// written out would, as marketgen does.
+	if sim.config.TickSize < 1 {
+		return float64(ticks) / math.Round(1/sim.config.TickSize)
+	}
+	return float64(ticks) * sim.config.TickSize
+}
+
+// wake is when an agent, by its index, next acts.
+type wake struct {
+	at    time.Time
+	agent int
+}
+
+// wakeQueue is a min-heap of wakes, earliest first, ties going to the agent
+// made first.
+type wakeQueue []wake
+
+func (queue wakeQueue) Len() int { return len(queue) }
+
+func (queue wakeQueue) Less(i, j int) bool {
+	if queue[i].at.Equal(queue[j].at) {
+		return queue[i].agent < queue[j].agent
+	}
+	return queue[i].at.Before(queue[j].at)
+}
+
+func (queue wakeQueue) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *wakeQueue) Push(x any) { *queue = append(*queue, x.(wake)) }
+
+func (queue *wakeQueue) Pop() any {
+	old := *queue
+	x := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return x
+}
+
+// virtualClock is simulated time, only moved on by the simulation, so the
+// engine stamps what it does with when it happened in the simulation.
+type virtualClock struct {
+	now    time.Time
+	timers []timer
+}
+
+// timer is a wait on a virtualClock, to be sent the time once it is due.
+type timer struct {
+	due time.Time
+	ch  chan time.Time
+}
+
+func (clock *virtualClock) Now() time.Time {
+	return clock.now
+}
+
+// After waits for the simulation to run d on from now.
+func (clock *virtualClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- clock.now
+		return ch
+	}
+	clock.timers = append(clock.timers, timer{due: clock.now.Add(d), ch: ch})
+	return ch
+}
+
+// advance moves the clock on to now, firing the timers due by then.
+func (clock *virtualClock) advance(now time.Time) {
+	clock.now = now
+	pending := clock.timers[:0]
+	for _, timer := range clock.timers {
+		if timer.due.After(now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- now
+	}
+	clock.timers = pending
+}
+
+// discardReporter is told of trades and errors by the engine, which the
+// simulation reads from the engine itself instead.
+type discardReporter struct{}
+
+func (discardReporter) ReportTrade(Trade, error) error                    { return nil }
+func (discardReporter) ReportError(string, error) error                   { return nil }
+func (discardReporter) ReportSymbolStatus(string, SymbolStatus) error     { return nil }
+func (discardReporter) ReportUnsolicitedCancel(Order, CancelReason) error { return nil }
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdmin_SessionsAndDisconnect(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+
+	var server *fenrirNet.Server
+	conn := serve(t, engine.New(Equities), func(s *fenrirNet.Server) { server = s })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	address := conn.LocalAddr().String()
+	sessions := server.Sessions()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "alice", sessions[0].Owner)
+	assert.Equal(t, address, sessions[0].Address)
+	assert.True(t, sessions[0].Connected)
+
+	// Alice is cut off, but may still resume her session.
+	require.NoError(t, server.Disconnect(address))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err, "disconnected rather than timing out")
+	sessions = server.Sessions()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "alice", sessions[0].Owner)
+	assert.False(t, sessions[0].Connected)
+	assert.NotZero(t, sessions[0].DisconnectedAt)
+
+	assert.ErrorIs(t, server.Disconnect(address), fenrirNet.ErrUnknownConnection)
+}
+
+func TestAdmin_TriggerSnapshot(t *testing.T) {
+	eng := engine.New(Equities)
+	var server *fenrirNet.Server
+	serve(t, eng, func(s *fenrirNet.Server) { server = s })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	assert.ErrorIs(t, server.TriggerSnapshot(ctx), fenrirNet.ErrNotSnapshotting)
+
+	saved := make(chan Snapshot, 2)
+	go server.RunSnapshots(ctx, eng, 0, func(snap Snapshot) error {
+		saved <- snap
+		return nil
+	})
+	require.Eventually(t, func() bool {
+		return server.TriggerSnapshot(ctx) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	<-saved
+
+	// Saved when asked for, even with nothing changed since.
+	require.NoError(t, server.TriggerSnapshot(ctx))
+	select {
+	case <-saved:
+	default:
+		t.Fatal("snapshot not saved")
+	}
+}
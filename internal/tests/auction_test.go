@@ -0,0 +1,149 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lastIndicative returns the last indicative update published.
+func lastIndicative(t *testing.T, publisher *recordingPublisher) MarketDataUpdate {
+	for i := len(publisher.updates) - 1; i >= 0; i-- {
+		if publisher.updates[i].Type == IndicativeUpdate {
+			return publisher.updates[i]
+		}
+	}
+	require.Fail(t, "no indicative update published")
+	return MarketDataUpdate{}
+}
+
+func TestAuction_UncrossesAtMostVolume(t *testing.T) {
+	publisher := &recordingPublisher{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetMarketDataPublisher(publisher)
+	eng.StartAuction("TEST")
+
+	// However far they cross, nothing matches.
+	placeOwnedOrder(t, eng, "b1", "TEST", "alice", Buy, 101, 10)
+	placeOwnedOrder(t, eng, "b2", "TEST", "alice", Buy, 100, 5)
+	placeOwnedOrder(t, eng, "s1", "TEST", "bob", Sell, 99, 8)
+	placeOwnedOrder(t, eng, "s2", "TEST", "bob", Sell, 100, 6)
+	placeOwnedOrder(t, eng, "s3", "TEST", "bob", Sell, 102, 4)
+	assert.Empty(t, eng.Trades)
+	assert.ErrorIs(t, eng.PlaceOrder(Equities, Order{UUID: "m", Ticker: "TEST", Side: Buy, OrderType: MarketOrder, Quantity: 1, TotalQuantity: 1, Owner: "alice"}), engine.ErrAuctionMarketOrder)
+
+	// 99 executes 8, 100 executes 14 and 101 executes 10.
+	indicative, err := eng.IndicativeUncross("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, Uncross{Ticker: "TEST", Price: 100, Volume: 14, Surplus: 1, SurplusSide: Buy}, indicative)
+	last := lastIndicative(t, publisher)
+	assert.Equal(t, Buy, last.Side)
+	assert.Equal(t, 100.0, last.Price)
+	assert.Equal(t, uint64(14), last.Quantity)
+
+	uncross, err := eng.Uncross("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, indicative, uncross)
+	assert.False(t, eng.InAuction("TEST"))
+	var executed uint64
+	for _, trade := range eng.Trades {
+		assert.Equal(t, 100.0, trade.Price)
+		executed += trade.MatchQty
+	}
+	assert.Equal(t, uint64(14), executed)
+
+	// What is left no longer crosses, and trades continuously.
+	depth, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []DepthLevel{{Price: 100, Quantity: 1, Orders: 1}}, depth.Bids)
+	assert.Equal(t, []DepthLevel{{Price: 102, Quantity: 4, Orders: 1}}, depth.Asks)
+	last = lastIndicative(t, publisher)
+	assert.Equal(t, MarketDataUpdate{Type: IndicativeUpdate, Ticker: "TEST", Sequence: last.Sequence, PriceScale: DefaultPriceScale}, last)
+	placeOwnedOrder(t, eng, "b3", "TEST", "carol", Buy, 102, 4)
+	assert.Len(t, eng.Trades, 4)
+}
+
+func TestAuction_Tiebreaks(t *testing.T) {
+	uncrossOf := func(place func(eng *engine.Engine)) Uncross {
+		eng := engine.New(Equities)
+		eng.SetReporter(&MockReporter{})
+		eng.StartAuction("TEST")
+		place(eng)
+		uncross, err := eng.IndicativeUncross("TEST")
+		require.NoError(t, err)
+		return uncross
+	}
+
+	// Buyers left over at every price executing the most push it up.
+	assert.Equal(t, 101.0, uncrossOf(func(eng *engine.Engine) {
+		placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 101, 10)
+		placeOwnedOrder(t, eng, "s", "TEST", "bob", Sell, 99, 5)
+		placeOwnedOrder(t, eng, "s2", "TEST", "bob", Sell, 103, 5)
+	}).Price)
+	// Sellers push it down.
+	assert.Equal(t, 99.0, uncrossOf(func(eng *engine.Engine) {
+		placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 101, 5)
+		placeOwnedOrder(t, eng, "s", "TEST", "bob", Sell, 99, 10)
+	}).Price)
+	// With buyers left over at some and sellers at others, it is the middle
+	// price.
+	assert.Equal(t, 100.0, uncrossOf(func(eng *engine.Engine) {
+		placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 102, 5)
+		placeOwnedOrder(t, eng, "b2", "TEST", "alice", Buy, 100, 1)
+		placeOwnedOrder(t, eng, "s", "TEST", "bob", Sell, 99, 5)
+		placeOwnedOrder(t, eng, "s2", "TEST", "bob", Sell, 101, 1)
+	}).Price)
+	// Nothing crosses.
+	assert.Zero(t, uncrossOf(func(eng *engine.Engine) {
+		placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 99, 5)
+		placeOwnedOrder(t, eng, "s", "TEST", "bob", Sell, 101, 5)
+	}).Volume)
+}
+
+func TestAuction_OpensOnSchedule(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	calendar, err := ParseTradingCalendar("AAPL=08:00/09:30/16:00")
+	require.NoError(t, err)
+
+	eng := engine.New(Equities)
+	placeOwnedOrder(t, eng, uuid.NewString(), "AAPL", "bob", Sell, 99, 10)
+	conn := serve(t, eng, func(s *fenrirNet.Server) {
+		s.SetClock(fixedClock{time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)})
+		s.SetTradingCalendars(calendar)
+		s.SetOpeningAuction(true)
+		s.SetAdmins("alice")
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// In pre-open alice's bid goes into the auction, crossing bob's ask
+	// without matching it.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	ack := reports.reports(t, 1)[0]
+	assert.Equal(t, "orderAck", ack["type"])
+	assert.Equal(t, "NEW", ack["status"])
+	assert.Len(t, eng.OpenOrders("alice"), 1)
+
+	// At the open it uncrosses, in the middle of the prices executing as
+	// much, before the market is told it opened.
+	_, err = conn.Write(tradingPhaseOverride(CalendarScope{Ticker: "AAPL"}, PhaseContinuous))
+	require.NoError(t, err)
+	opened := reports.reports(t, 2)
+	assert.Equal(t, "execution", opened[0]["type"])
+	assert.Equal(t, 99.0, opened[0]["price"])
+	assert.Equal(t, "normal", opened[1]["status"])
+	assert.Empty(t, eng.OpenOrders("alice"))
+	assert.Empty(t, eng.OpenOrders("bob"))
+}
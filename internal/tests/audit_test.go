@@ -0,0 +1,65 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingAuditor struct {
+	events []AuditEvent
+}
+
+func (a *recordingAuditor) RecordAuditEvent(event AuditEvent) {
+	a.events = append(a.events, event)
+}
+
+func TestAudit_OrderLifecycle(t *testing.T) {
+	auditor := &recordingAuditor{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetAuditor(auditor)
+
+	sent := time.Unix(0, 1000)
+	received := time.Unix(0, 2000)
+	assert.NoError(t, eng.PlaceOrder(Equities, Order{
+		UUID: "a", Ticker: "TEST", Side: Sell, OrderType: LimitOrder, LimitPrice: 100.0,
+		Quantity: 10, TotalQuantity: 10, Owner: "alice",
+		ClientTimestamp: sent, Timestamp: received,
+	}))
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100.0, 4)
+	assert.NoError(t, eng.CancelOrder(Equities, "a"))
+
+	var types []AuditEventType
+	for i, event := range auditor.events {
+		types = append(types, event.Type)
+		assert.Equal(t, uint64(i+1), event.Sequence)
+	}
+	assert.Equal(t, []AuditEventType{NewOrderEvent, NewOrderEvent, TradeEvent, TradeEvent, CancelEvent}, types)
+
+	// The full chain of timestamps follows the order through its life.
+	accepted := auditor.events[0]
+	assert.Equal(t, sent, accepted.ClientTimestamp)
+	assert.Equal(t, received, accepted.GatewayTimestamp)
+	assert.False(t, accepted.SequencerTimestamp.IsZero())
+	assert.Equal(t, uint64(10), accepted.Quantity)
+
+	taker, maker := auditor.events[2], auditor.events[3]
+	assert.Equal(t, "b", taker.OrderUUID)
+	assert.True(t, taker.Aggressor)
+	assert.Equal(t, "a", taker.CounterpartyUUID)
+	assert.Equal(t, "a", maker.OrderUUID)
+	assert.False(t, maker.Aggressor)
+	assert.Equal(t, sent, maker.ClientTimestamp)
+	assert.Equal(t, accepted.OrderSequence, maker.OrderSequence)
+	assert.Equal(t, taker.TradeID, maker.TradeID)
+	assert.Equal(t, uint64(4), maker.Quantity)
+	assert.False(t, maker.MatchTimestamp.IsZero())
+
+	cancel := auditor.events[4]
+	assert.Equal(t, "a", cancel.OrderUUID)
+	assert.Equal(t, uint64(6), cancel.Quantity)
+	assert.Equal(t, CancelRequested, cancel.CancelReason)
+}
@@ -0,0 +1,34 @@
+package tests
+
+import (
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuth_LoadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(path, []byte("# owners\nalice:s3cret\n\nbob:hunter2:x\n"), 0o600))
+
+	secrets, err := fenrirNet.LoadCredentials(path)
+	assert.NoError(t, err)
+	// Only the first colon splits, secrets may contain them.
+	assert.Equal(t, map[string]string{"alice": "s3cret", "bob": "hunter2:x"}, secrets)
+
+	assert.NoError(t, os.WriteFile(path, []byte("alice\n"), 0o600))
+	_, err = fenrirNet.LoadCredentials(path)
+	assert.Error(t, err)
+}
+
+func TestAuth_SignLogon(t *testing.T) {
+	signature := fenrirNet.SignLogon("alice", 1234, "s3cret")
+	assert.Len(t, signature, fenrirNet.LogonSignatureLen)
+	assert.Equal(t, signature, fenrirNet.SignLogon("alice", 1234, "s3cret"))
+
+	// Every part of the logon is covered by the signature.
+	assert.NotEqual(t, signature, fenrirNet.SignLogon("alice", 1234, "other"))
+	assert.NotEqual(t, signature, fenrirNet.SignLogon("alice", 1235, "s3cret"))
+	assert.NotEqual(t, signature, fenrirNet.SignLogon("bob", 1234, "s3cret"))
+}
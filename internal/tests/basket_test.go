@@ -0,0 +1,80 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func createTestBasketEngine(t *testing.T) *engine.Engine {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	assert.NoError(t, eng.RegisterBasket(Basket{
+		Ticker:    "BSKT",
+		AssetType: Equities,
+		Legs: []BasketLeg{
+			{Ticker: "AAA", Weight: 1},
+			{Ticker: "BBB", Weight: 3},
+		},
+	}))
+	return eng
+}
+
+func TestPlaceOrder_Basket_FillsAllLegs(t *testing.T) {
+	eng := createTestBasketEngine(t)
+	aaa, bbb := eng.Books["AAA"], eng.Books["BBB"]
+	assert.NoError(t, placeTestOrders(aaa, 10.0, Sell, 5))
+	assert.NoError(t, placeTestOrders(bbb, 20.0, Sell, 4))
+	assert.NoError(t, placeTestOrders(bbb, 21.0, Sell, 10))
+
+	// 2 units = 2 AAA + 6 BBB, costing 2*10 + 4*20 + 2*21 = 142.
+	assert.NoError(t, eng.PlaceOrder(Equities, Order{
+		UUID:          "test-id",
+		Ticker:        "BSKT",
+		Side:          Buy,
+		OrderType:     LimitOrder,
+		LimitPrice:    71.0,
+		Quantity:      2,
+		TotalQuantity: 2,
+	}))
+
+	assert.Equal(t, []engine.FlatPriceLevel{
+		buildExpectedLevel(10.0, Sell, Quantity{3, 5}),
+	}, engine.FlattenLevels(aaa.Asks.Items()))
+	assert.Equal(t, []engine.FlatPriceLevel{
+		buildExpectedLevel(21.0, Sell, Quantity{8, 10}),
+	}, engine.FlattenLevels(bbb.Asks.Items()))
+	assert.Empty(t, aaa.Bids.Items())
+	assert.Empty(t, bbb.Bids.Items())
+	assert.Len(t, eng.Trades, 3)
+}
+
+func TestPlaceOrder_Basket_AllOrNothing(t *testing.T) {
+	eng := createTestBasketEngine(t)
+	aaa, bbb := eng.Books["AAA"], eng.Books["BBB"]
+	assert.NoError(t, placeTestOrders(aaa, 10.0, Sell, 5))
+	assert.NoError(t, placeTestOrders(bbb, 20.0, Sell, 4))
+
+	basketOrder := Order{
+		UUID:          "test-id",
+		Ticker:        "BSKT",
+		Side:          Buy,
+		OrderType:     MarketOrder,
+		Quantity:      2,
+		TotalQuantity: 2,
+	}
+
+	// BBB only has 4 of the 6 required, so AAA must not trade either.
+	assert.ErrorIs(t, eng.PlaceOrder(Equities, basketOrder), engine.ErrBasketNotExecutable)
+	assert.Equal(t, []engine.FlatPriceLevel{
+		buildExpectedLevel(10.0, Sell, newQuantity(5)),
+	}, engine.FlattenLevels(aaa.Asks.Items()))
+
+	// Enough liquidity, but not at the limit price.
+	basketOrder.OrderType = LimitOrder
+	basketOrder.LimitPrice = 60.0
+	basketOrder.Quantity, basketOrder.TotalQuantity = 1, 1
+	assert.ErrorIs(t, eng.PlaceOrder(Equities, basketOrder), engine.ErrBasketLimitNotReached)
+	assert.Empty(t, eng.Trades)
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOrderBatchMessage(t *testing.T) {
+	message, err := fenrirNet.ParseJSONMessage([]byte(`{"type": "orderBatch", "orders": [
+		{"type": "newOrder", "ticker": "AAPL", "side": "buy", "price": 99.5, "quantity": 10, "clOrdId": 1},
+		{"type": "cancel", "clOrdId": 2},
+		{"type": "newOrder", "ticker": "AAPL", "side": "sell", "price": 100.5, "quantity": 10, "clOrdId": 3}
+	]}`))
+	assert.NoError(t, err)
+	batch, ok := message.(fenrirNet.OrderBatchMessage)
+	assert.True(t, ok)
+	assert.NoError(t, batch.Validate())
+
+	// Entries keep the order they were sent in.
+	assert.Len(t, batch.Messages, 3)
+	assert.Equal(t, uint64(1), batch.Messages[0].(fenrirNet.NewOrderMessage).ClOrdID)
+	assert.Equal(t, uint64(2), batch.Messages[1].(fenrirNet.CancelOrderMessage).ClOrdID)
+	assert.Equal(t, Sell, batch.Messages[2].(fenrirNet.NewOrderMessage).Side)
+
+	// A malformed entry rejects the batch.
+	order := batch.Messages[2].(fenrirNet.NewOrderMessage)
+	order.Quantity = 0
+	batch.Messages[2] = order
+	err = batch.Validate()
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidOrderBatch)
+	assert.ErrorIs(t, err, fenrirNet.ErrZeroQuantity)
+	assert.ErrorContains(t, err, "entry 3")
+
+	// Only new orders and cancels can be batched.
+	_, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "orderBatch", "orders": [{"type": "ping"}]}`))
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidOrderBatchEntry)
+	assert.ErrorIs(t, fenrirNet.OrderBatchMessage{}.Validate(), fenrirNet.ErrInvalidOrderBatchSize)
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type cancelReporter struct {
+	MockReporter
+	cancels map[string]CancelReason
+}
+
+func (r *cancelReporter) ReportUnsolicitedCancel(order Order, reason CancelReason) error {
+	r.cancels[order.UUID] = reason
+	return nil
+}
+
+func placeOwnedOrder(t *testing.T, eng *engine.Engine, uuid, ticker, owner string, side Side, price float64, qty uint64) {
+	assert.NoError(t, eng.PlaceOrder(Equities, Order{
+		UUID:          uuid,
+		Ticker:        ticker,
+		Side:          side,
+		OrderType:     LimitOrder,
+		LimitPrice:    price,
+		Quantity:      qty,
+		TotalQuantity: qty,
+		Owner:         owner,
+	}))
+}
+
+func TestCancelOrder(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 99.0, 20)
+
+	assert.NoError(t, eng.CancelOrder(Equities, "a"))
+	assert.ErrorIs(t, eng.CancelOrder(Equities, "a"), engine.ErrOrderNotFound)
+	assert.Equal(t, []engine.FlatPriceLevel{
+		{PriceLevel: 99.0, Orders: []*Order{{
+			UUID: "b", Ticker: "TEST", Side: Buy, LimitPrice: 99.0,
+			Quantity: 20, TotalQuantity: 20, PriceScale: DefaultPriceScale, Owner: "alice",
+		}}},
+	}, engine.FlattenLevels(eng.Books["TEST"].Bids.Items()))
+
+	// The last order on a level takes the level with it.
+	assert.NoError(t, eng.CancelOrder(Equities, "b"))
+	assert.Empty(t, eng.Books["TEST"].Bids.Items())
+}
+
+func TestAdminCancel(t *testing.T) {
+	reporter := &cancelReporter{cancels: make(map[string]CancelReason)}
+	eng := engine.New(Equities)
+	eng.SetReporter(reporter)
+	placeOwnedOrder(t, eng, "a", "AAA", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "AAA", "bob", Sell, 101.0, 10)
+	placeOwnedOrder(t, eng, "c", "BBB", "bob", Sell, 101.0, 10)
+
+	_, err := eng.AdminCancelOrder("c", CancelRequested)
+	assert.ErrorIs(t, err, engine.ErrNotAdminReason)
+	_, err = eng.AdminCancelOrder("c", BrokerCancelled)
+	assert.ErrorIs(t, err, engine.ErrNotAdminReason)
+
+	order, err := eng.AdminCancelOrder("c", AdminErroneousOrder)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", order.Owner)
+
+	orders, err := eng.AdminCancelSymbol("AAA", AdminRegulatory)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Empty(t, eng.Books["AAA"].Bids.Items())
+	assert.Empty(t, eng.Books["AAA"].Asks.Items())
+
+	assert.Equal(t, map[string]CancelReason{
+		"a": AdminRegulatory,
+		"b": AdminRegulatory,
+		"c": AdminErroneousOrder,
+	}, reporter.cancels)
+}
+
+func TestAdminCancelOwner(t *testing.T) {
+	reporter := &cancelReporter{cancels: make(map[string]CancelReason)}
+	eng := engine.New(Equities)
+	eng.SetReporter(reporter)
+	placeOwnedOrder(t, eng, "a", "BBB", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "AAA", "alice", Sell, 101.0, 10)
+	placeOwnedOrder(t, eng, "c", "AAA", "bob", Sell, 102.0, 10)
+
+	_, err := eng.AdminCancelOwner("alice", CancelRequested)
+	assert.ErrorIs(t, err, engine.ErrNotAdminReason)
+
+	orders, err := eng.AdminCancelOwner("alice", AdminRiskBreach)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, "b", orders[0].UUID)
+	assert.Equal(t, "a", orders[1].UUID)
+	assert.Empty(t, eng.Books["BBB"].Bids.Items())
+	assert.Len(t, eng.Books["AAA"].Asks.Items(), 1)
+	assert.Equal(t, map[string]CancelReason{"a": AdminRiskBreach, "b": AdminRiskBreach}, reporter.cancels)
+
+	// Through the command log too.
+	orders, err = eng.Apply(Command{Type: AdminCancelOwnerCommand, Owner: "bob", Reason: AdminRegulatory})
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Empty(t, eng.Books["AAA"].Asks.Items())
+}
+
+func TestCancelClientOrder(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	place := func(uuid, owner string, clOrdID uint64) error {
+		return eng.PlaceOrder(Equities, Order{
+			UUID:          uuid,
+			ClOrdID:       clOrdID,
+			Ticker:        "TEST",
+			Side:          Buy,
+			OrderType:     LimitOrder,
+			LimitPrice:    99.0,
+			Quantity:      10,
+			TotalQuantity: 10,
+			Owner:         owner,
+		})
+	}
+
+	assert.NoError(t, place("a", "alice", 7))
+	// Ids are only unique per owner.
+	assert.NoError(t, place("b", "bob", 7))
+	assert.ErrorIs(t, place("c", "alice", 7), engine.ErrDuplicateClOrdID)
+
+	order, ok := eng.ClientOrder("alice", 7)
+	assert.True(t, ok)
+	assert.Equal(t, "a", order.UUID)
+
+	cancelled, err := eng.CancelClientOrder(Equities, "alice", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", cancelled.UUID)
+	_, err = eng.CancelClientOrder(Equities, "alice", 7)
+	assert.ErrorIs(t, err, engine.ErrOrderNotFound)
+	_, ok = eng.ClientOrder("bob", 7)
+	assert.True(t, ok)
+
+	// Once the order is gone its id can be used again.
+	assert.NoError(t, place("d", "alice", 7))
+}
+
+func TestCancelOwnOrder_Rejects(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Sell, 101.0, 10)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Buy, 100.0, 10)
+
+	var reason CancelRejectReason
+	filled, err := eng.CancelOwnOrder(Equities, "alice", "a")
+	assert.ErrorIs(t, err, engine.ErrOrderFilled)
+	assert.ErrorAs(t, err, &reason)
+	assert.Equal(t, CancelRejectFilled, reason)
+	// Filled orders come back as they were last filled, so the owner can
+	// reconcile, but only to their owner.
+	assert.Equal(t, "a", filled.UUID)
+	assert.Equal(t, "TEST", filled.Ticker)
+	assert.Zero(t, filled.Quantity)
+	_, err = eng.CancelOwnOrder(Equities, "bob", "a")
+	assert.ErrorIs(t, err, engine.ErrNotOrderOwner)
+
+	_, err = eng.CancelOwnOrder(Equities, "bob", "b")
+	assert.ErrorIs(t, err, engine.ErrNotOrderOwner)
+	_, err = eng.CancelOwnOrder(Equities, "alice", "z")
+	assert.ErrorIs(t, err, engine.ErrOrderNotFound)
+
+	// Whoever owns a resting order can be looked up, e.g. for their broker.
+	owner, ok := eng.OrderOwner("b")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", owner)
+	_, ok = eng.OrderOwner("a")
+	assert.False(t, ok)
+
+	cancelled, err := eng.CancelOwnOrder(Equities, "alice", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), cancelled.Quantity)
+	assert.Empty(t, eng.OpenOrders("alice"))
+}
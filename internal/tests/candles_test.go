@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"fenrir/internal/audit"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.Open(path)
+	assert.NoError(t, err)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetAuditor(auditLog)
+
+	open := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	trade := func(at time.Duration, price float64, qty uint64) {
+		eng.SetClock(fixedClock{open.Add(at)})
+		placeOwnedOrder(t, eng, "sell"+at.String(), "TEST", "alice", Sell, price, qty)
+		placeOwnedOrder(t, eng, "buy"+at.String(), "TEST", "bob", Buy, price, qty)
+	}
+	trade(10*time.Second, 100, 5)
+	trade(30*time.Second, 102, 1)
+	trade(50*time.Second, 99, 2)
+	trade(90*time.Second, 101, 3)
+	trade(7*time.Minute, 98, 4)
+
+	page, err := eng.Candles("TEST", time.Minute, time.Time{}, time.Time{}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, page.Interval)
+	assert.Equal(t, uint8(DefaultPriceScale), page.PriceScale)
+	assert.Equal(t, []Candle{
+		{Start: open, Open: 100, High: 102, Low: 99, Close: 99, Volume: 8, Trades: 3},
+		{Start: open.Add(time.Minute), Open: 101, High: 101, Low: 101, Close: 101, Volume: 3, Trades: 1},
+		{Start: open.Add(7 * time.Minute), Open: 98, High: 98, Low: 98, Close: 98, Volume: 4, Trades: 1},
+	}, page.Candles)
+	assert.True(t, page.Next.IsZero())
+
+	// Longer intervals are rolled up, and paged through.
+	page, err = eng.Candles("TEST", 5*time.Minute, open, time.Time{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Candle{{Start: open, Open: 100, High: 102, Low: 99, Close: 101, Volume: 11, Trades: 4}}, page.Candles)
+	assert.Equal(t, open.Add(5*time.Minute), page.Next)
+	page, err = eng.Candles("TEST", 5*time.Minute, page.Next, time.Time{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Candle{{Start: open.Add(5 * time.Minute), Open: 98, High: 98, Low: 98, Close: 98, Volume: 4, Trades: 1}}, page.Candles)
+	assert.True(t, page.Next.IsZero())
+
+	// Up to, but not including, to.
+	page, err = eng.Candles("TEST", time.Minute, open, open.Add(time.Minute), 0)
+	assert.NoError(t, err)
+	assert.Len(t, page.Candles, 1)
+
+	_, err = eng.Candles("TEST", 90*time.Second, open, time.Time{}, 0)
+	assert.ErrorIs(t, err, engine.ErrInvalidCandleInterval)
+	_, err = eng.Candles("NONE", time.Minute, open, time.Time{}, 0)
+	assert.ErrorIs(t, err, engine.ErrBookNotFound)
+
+	// History survives a restart, through the audit trail.
+	assert.NoError(t, auditLog.Close())
+	trades, err := audit.ReadTrades(path)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 5)
+	restarted := engine.New(Equities)
+	restarted.RestoreCandles(trades)
+	restored, err := restarted.Candles("TEST", time.Minute, time.Time{}, time.Time{}, 0)
+	assert.NoError(t, err)
+	want, _ := eng.Candles("TEST", time.Minute, time.Time{}, time.Time{}, 0)
+	assert.Equal(t, len(want.Candles), len(restored.Candles))
+	for i := range want.Candles {
+		assert.True(t, want.Candles[i].Start.Equal(restored.Candles[i].Start))
+		restored.Candles[i].Start = want.Candles[i].Start
+	}
+	assert.Equal(t, want.Candles, restored.Candles)
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"encoding/json"
+	fenrirNet "fenrir/internal/net"
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateCaptures = flag.Bool("update", false, "Rewrite the golden replays of testdata/captures")
+
+// TestCaptures replays sessions recorded off real clients (see
+// Server.SetCaptureDir) through the gateway, checking every message they sent
+// is still framed and parsed, and every report they were sent still decoded,
+// as it was when recorded. Run with -update to accept a deliberate change.
+func TestCaptures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "captures", "*.capture"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			records, err := fenrirNet.ReadCapture(path)
+			assert.NoError(t, err)
+			replay, err := fenrirNet.ReplayCapture(records)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, replay.Messages)
+
+			type message struct {
+				Type    string
+				Message fenrirNet.Message
+			}
+			golden := struct {
+				Messages []message
+				Reports  []map[string]any
+			}{Reports: replay.Reports}
+			for _, m := range replay.Messages {
+				golden.Messages = append(golden.Messages, message{fmt.Sprintf("%T", m), m})
+			}
+			got, err := json.MarshalIndent(golden, "", "  ")
+			assert.NoError(t, err)
+
+			goldenPath := strings.TrimSuffix(path, ".capture") + ".golden.json"
+			if *updateCaptures {
+				assert.NoError(t, os.WriteFile(goldenPath, append(got, '\n'), 0o644))
+			}
+			want, err := os.ReadFile(goldenPath)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+}
+
+func TestReplayCapture_Malformed(t *testing.T) {
+	// A message type no client sends.
+	_, err := fenrirNet.ReplayCapture([]fenrirNet.CaptureRecord{
+		{Direction: fenrirNet.CaptureInbound, Data: []byte{0xff, 0xff, 0, 0}},
+	})
+	assert.Error(t, err)
+
+	// Cut short as the client went away.
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	assert.NoError(t, err)
+	whole, err := fenrirNet.ReplayCapture(records)
+	assert.NoError(t, err)
+	last := records[len(records)-1]
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Direction == fenrirNet.CaptureInbound {
+			last = records[i]
+			records[i].Data = last.Data[:len(last.Data)-1]
+			break
+		}
+	}
+	cut, err := fenrirNet.ReplayCapture(records)
+	assert.NoError(t, err)
+	assert.Len(t, cut.Messages, len(whole.Messages)-1)
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertification_Passes(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	var server *fenrirNet.Server
+	conn := serve(t, engine.New(Equities), func(s *fenrirNet.Server) {
+		server = s
+		s.SetCertification(5*time.Second, dir)
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// Acks: the order is cancelled by the UUID it was acked with.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	ack := reports.reports(t, 1)[0]
+	require.Equal(t, "orderAck", ack["type"])
+	cancel := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(cancel[0:2], uint16(fenrirNet.CancelOrder))
+	copy(cancel[4:4+fenrirNet.UUIDLen], ack["uuid"].(string))
+	_, err = conn.Write(cancel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cancelAck"}, reports.next(t, 1))
+
+	// Cancels: it moves on to another order. Heartbeats: the request is
+	// answered.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orderAck", "heartbeatRequest"}, reports.next(t, 2))
+	_, err = conn.Write(make([]byte, fenrirNet.BaseMessageHeaderLen))
+	require.NoError(t, err)
+
+	// Gap recovery: a report goes missing, and is asked for again.
+	next := reports.reports(t, 1)[0]
+	assert.Equal(t, "heartbeatRequest", next["type"])
+	missing := next["seq"].(uint64) - 1
+	resend := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.ResendRequestHeaderLen)
+	binary.BigEndian.PutUint16(resend[0:2], uint16(fenrirNet.ResendRequest))
+	binary.BigEndian.PutUint64(resend[2:10], missing)
+	_, err = conn.Write(resend)
+	require.NoError(t, err)
+
+	notice := reports.reports(t, 1)[0]
+	assert.Equal(t, "certificationPassed", notice["notice"])
+	certifications := server.Certifications()
+	require.Len(t, certifications, 1)
+	assert.True(t, certifications[0].Passed)
+	assert.Equal(t, "alice", certifications[0].Owner)
+	var steps []string
+	for _, step := range certifications[0].Steps {
+		assert.True(t, step.Passed, step.Step)
+		steps = append(steps, step.Step)
+	}
+	assert.Equal(t, []string{"acks", "cancels", "heartbeats", "gapRecovery"}, steps)
+	written, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, written, 1)
+}
+
+func TestCertification_FailsWhatIsNotDone(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	var server *fenrirNet.Server
+	conn := serve(t, engine.New(Equities), func(s *fenrirNet.Server) {
+		server = s
+		s.SetCertification(100*time.Millisecond, "")
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// Cancelled by client order ID rather than the UUID acked.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	ack := reports.reports(t, 1)[0]
+	cancel := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(cancel[0:2], uint16(fenrirNet.CancelOrder))
+	binary.BigEndian.PutUint64(cancel[4+fenrirNet.UUIDLen:], ack["clOrdId"].(uint64))
+	_, err = conn.Write(cancel)
+	require.NoError(t, err)
+
+	// Nothing else is done, so the rest time out, the requests going
+	// unanswered.
+	var seen []string
+	for len(seen) == 0 || seen[len(seen)-1] != "session" {
+		seen = append(seen, reports.next(t, 1)...)
+	}
+	assert.Equal(t, []string{"cancelAck", "heartbeatRequest", "heartbeatRequest", "session"}, seen)
+
+	certifications := server.Certifications()
+	require.Len(t, certifications, 1)
+	assert.False(t, certifications[0].Passed)
+	require.Len(t, certifications[0].Steps, 4)
+	assert.Contains(t, certifications[0].Steps[0].Detail, "rather than the uuid")
+	for _, step := range certifications[0].Steps[1:] {
+		assert.False(t, step.Passed)
+		assert.Equal(t, "timed out", step.Detail)
+	}
+}
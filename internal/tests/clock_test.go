@@ -0,0 +1,54 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fixedClock is stuck at a single instant.
+type fixedClock struct {
+	now time.Time
+}
+
+func (clock fixedClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock fixedClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
+
+func TestClock_Accelerated(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	clock := NewAcceleratedClock(epoch, 3600)
+
+	time.Sleep(10 * time.Millisecond)
+	// 10ms at an hour a second is at least 36s.
+	assert.GreaterOrEqual(t, clock.Now().Sub(epoch), 36*time.Second)
+
+	// An hour on the clock passes in about a second.
+	select {
+	case fired := <-clock.After(time.Hour):
+		assert.GreaterOrEqual(t, fired.Sub(epoch), time.Hour)
+	case <-time.After(5 * time.Second):
+		t.Fatal("accelerated timer did not fire")
+	}
+}
+
+func TestClock_EngineTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{now})
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100.0, 10)
+
+	assert.Len(t, eng.Trades, 1)
+	assert.Equal(t, now, eng.Trades[0].Timestamp)
+	assert.Equal(t, now, eng.Trades[0].Party.ExchTimestamp)
+	assert.Equal(t, now, eng.Trades[0].CounterParty.ExchTimestamp)
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"encoding/binary"
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newOrderFrame encodes a NewOrder as a client would send it, from no one in
+// particular.
+func newOrderFrame(ticker string, side Side, price float64, qty, clOrdID uint64) []byte {
+	frame := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.NewOrderMessageHeaderLen+1)
+	binary.BigEndian.PutUint16(frame[0:2], uint16(fenrirNet.NewOrder))
+	binary.BigEndian.PutUint16(frame[2:4], uint16(Equities))
+	binary.BigEndian.PutUint16(frame[4:6], uint16(LimitOrder))
+	copy(frame[6:10], ticker)
+	binary.BigEndian.PutUint64(frame[10:18], math.Float64bits(price))
+	binary.BigEndian.PutUint64(frame[18:26], qty)
+	frame[26] = byte(side)
+	binary.BigEndian.PutUint64(frame[36:44], clOrdID)
+	return frame
+}
+
+func TestCodec_DecodesIntoReusedOrders(t *testing.T) {
+	var decoder fenrirNet.Decoder
+	var m fenrirNet.NewOrderMessage
+	for _, want := range []struct {
+		ticker string
+		side   Side
+		price  float64
+		qty    uint64
+	}{{"AAPL", Buy, 100.5, 10}, {"MSFT", Sell, 42, 3}, {"AAPL", Sell, 99, 1}} {
+		frame := newOrderFrame(want.ticker, want.side, want.price, want.qty, 7)
+		require.NoError(t, decoder.NewOrder(frame[fenrirNet.BaseMessageHeaderLen:], &m))
+		assert.Equal(t, fenrirNet.NewOrder, m.GetType())
+		assert.Equal(t, want.ticker, m.Ticker)
+		assert.Equal(t, want.side, m.Side)
+		assert.Equal(t, want.price, m.LimitPrice)
+		assert.Equal(t, want.qty, m.Quantity)
+		assert.Equal(t, uint64(7), m.ClOrdID)
+
+		// Decode agrees with it, whatever it is decoding into.
+		message, err := decoder.Decode(frame)
+		require.NoError(t, err)
+		decoded := message.(fenrirNet.NewOrderMessage)
+		decoded.ReceivedAt = m.ReceivedAt
+		assert.Equal(t, m, decoded)
+	}
+
+	// Tickers seen before are not allocated again.
+	frame := newOrderFrame("AAPL", Buy, 100, 1, 0)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		decoder.NewOrder(frame[fenrirNet.BaseMessageHeaderLen:], &m)
+	}))
+
+	// Orders cut short are refused rather than read past their end.
+	_, err := decoder.Decode(frame[:20])
+	assert.ErrorIs(t, err, fenrirNet.ErrMessageTooShort)
+	assert.ErrorIs(t, decoder.NewOrder(frame[fenrirNet.BaseMessageHeaderLen:20], &m), fenrirNet.ErrMessageTooShort)
+	var cancel fenrirNet.CancelOrderMessage
+	assert.ErrorIs(t, decoder.CancelOrder(make([]byte, 10), &cancel), fenrirNet.ErrMessageTooShort)
+}
+
+func TestCodec_EncodesAsSerialized(t *testing.T) {
+	var encoder fenrirNet.Encoder
+	long := fenrirNet.Report{
+		MessageType:     fenrirNet.ExecutionReport,
+		Ticker:          "AAPL",
+		UUID:            "0123456789abcdef",
+		Quantity:        10,
+		Price:           100,
+		Err:             "something went wrong",
+		ErrStrLen:       20,
+		Counterparty:    "bob",
+		CounterpartyLen: 3,
+	}
+	want, err := long.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, want, encoder.Report(&long))
+
+	// What the last left in the buffer never shows through.
+	short := fenrirNet.Report{MessageType: fenrirNet.ExecutionReport, Ticker: "MSFT", Quantity: 1}
+	want, err = short.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, want, encoder.Report(&short))
+
+	ack := fenrirNet.OrderAck{ClOrdID: 3, UUID: "short", Ticker: "AAPL", Side: Sell, Price: 1.5, Timestamp: time.Unix(1, 0)}
+	assert.Equal(t, ack.Serialize(), encoder.OrderAck(&ack))
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		encoder.Report(&long)
+		encoder.OrderAck(&ack)
+	}))
+}
+
+func FuzzDecoder_Decode(f *testing.F) {
+	f.Add(newOrderFrame("AAPL", Buy, 100, 10, 1))
+	f.Add(newOrderFrame("MSFT", Sell, -1, 0, math.MaxUint64)[:30])
+	cancel := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(cancel[0:2], uint16(fenrirNet.CancelOrder))
+	f.Add(cancel)
+	f.Add([]byte{0})
+
+	var decoder fenrirNet.Decoder
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		// Whatever comes in, reusing the decoder makes no difference.
+		got, gotErr := decoder.Decode(frame)
+		want, wantErr := (&fenrirNet.Decoder{}).Decode(frame)
+		assert.Equal(t, wantErr, gotErr)
+		assert.True(t, sameBits(reflect.ValueOf(want), reflect.ValueOf(got)), "decoded %#v, reused %#v", want, got)
+	})
+}
+
+// sameBits is whether a and b are equal, floats compared bit for bit so that
+// NaN is no different, and ignoring the times they were stamped with as they
+// were parsed.
+func sameBits(a, b reflect.Value) bool {
+	if a.IsValid() != b.IsValid() {
+		return false
+	}
+	if !a.IsValid() {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return math.Float64bits(a.Float()) == math.Float64bits(b.Float())
+	case reflect.Struct:
+		for i := range a.NumField() {
+			if a.Type().Field(i).Name == "ReceivedAt" {
+				continue
+			}
+			if !sameBits(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := range a.Len() {
+			if !sameBits(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			if !sameBits(a.MapIndex(key), b.MapIndex(key)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.Kind() == reflect.Pointer && a.Pointer() == b.Pointer() {
+			return true
+		}
+		return sameBits(a.Elem(), b.Elem())
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	panic("sameBits: unexpected " + a.Kind().String())
+}
+
+func BenchmarkCodec_DecodeNewOrder(b *testing.B) {
+	frame := newOrderFrame("AAPL", Buy, 100, 10, 1)
+	b.Run("reused", func(b *testing.B) {
+		var decoder fenrirNet.Decoder
+		var m fenrirNet.NewOrderMessage
+		b.ReportAllocs()
+		for range b.N {
+			decoder.NewOrder(frame[fenrirNet.BaseMessageHeaderLen:], &m)
+		}
+	})
+	b.Run("message", func(b *testing.B) {
+		// As the server decodes them, each a Message of its own.
+		var decoder fenrirNet.Decoder
+		b.ReportAllocs()
+		for range b.N {
+			decoder.Decode(frame)
+		}
+	})
+}
+
+func BenchmarkCodec_EncodeReport(b *testing.B) {
+	report := fenrirNet.Report{MessageType: fenrirNet.ExecutionReport, Ticker: "AAPL", UUID: "0123456789abcdef", Quantity: 10, Price: 100, Counterparty: "bob", CounterpartyLen: 3}
+	b.Run("encoder", func(b *testing.B) {
+		var encoder fenrirNet.Encoder
+		b.ReportAllocs()
+		for range b.N {
+			encoder.Report(&report)
+		}
+	})
+	b.Run("serialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			report.Serialize()
+		}
+	})
+}
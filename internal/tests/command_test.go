@@ -0,0 +1,139 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type commandRecorder struct {
+	cmds []Command
+}
+
+func (r *commandRecorder) RecordCommand(cmd Command) error {
+	r.cmds = append(r.cmds, cmd)
+	return nil
+}
+
+func placeCommand(uuid, owner string, side Side, price float64, qty uint64, origin CommandOrigin) Command {
+	return Command{
+		Origin:    origin,
+		Type:      PlaceOrderCommand,
+		AssetType: Equities,
+		Orders: []Order{{
+			UUID:          uuid,
+			Ticker:        "TEST",
+			Side:          side,
+			OrderType:     LimitOrder,
+			LimitPrice:    price,
+			Quantity:      qty,
+			TotalQuantity: qty,
+			Owner:         owner,
+		}},
+	}
+}
+
+func TestCommand_ApplyOnce(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	eng.SetCommandJournal(journal)
+
+	first := CommandOrigin{Session: "alice", Sequence: 3}
+	_, err := eng.Apply(placeCommand("a", "alice", Buy, 99, 10, first))
+	assert.NoError(t, err)
+
+	// Resent, or sent before it, by the same session.
+	_, err = eng.Apply(placeCommand("a2", "alice", Buy, 99, 10, first))
+	assert.ErrorIs(t, err, engine.ErrCommandApplied)
+	_, err = eng.Apply(placeCommand("a0", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 2}))
+	assert.ErrorIs(t, err, engine.ErrCommandApplied)
+
+	// Later parts of the same message are applied, as are other sessions and
+	// commands from no session at all.
+	_, err = eng.Apply(placeCommand("b", "alice", Buy, 98, 5, CommandOrigin{Session: "alice", Sequence: 3, Part: 1}))
+	assert.NoError(t, err)
+	_, err = eng.Apply(placeCommand("c", "bob", Sell, 101, 5, CommandOrigin{Session: "bob", Sequence: 1}))
+	assert.NoError(t, err)
+	_, err = eng.Apply(placeCommand("d", "quoter", Sell, 102, 5, CommandOrigin{}))
+	assert.NoError(t, err)
+	_, err = eng.Apply(placeCommand("e", "quoter", Sell, 103, 5, CommandOrigin{}))
+	assert.NoError(t, err)
+
+	orders, err := eng.Apply(Command{Origin: CommandOrigin{Session: "alice", Sequence: 4}, Type: CancelOwnOrderCommand, AssetType: Equities, Owner: "alice", UUID: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", orders[0].UUID)
+
+	// Rejected commands are journaled too, only those skipped are not.
+	_, err = eng.Apply(Command{Origin: CommandOrigin{Session: "alice", Sequence: 5}, Type: CancelOwnOrderCommand, AssetType: Equities, Owner: "alice", UUID: "b"})
+	assert.ErrorIs(t, err, engine.ErrOrderNotFound)
+
+	assert.Len(t, journal.cmds, 7)
+	for i, cmd := range journal.cmds {
+		assert.Equal(t, uint64(i+1), cmd.Sequence)
+	}
+	assert.Equal(t, ReplayMarkers{
+		Sequence: 7,
+		Sessions: map[string]CommandOrigin{
+			"alice": {Session: "alice", Sequence: 5},
+			"bob":   {Session: "bob", Sequence: 1},
+		},
+	}, eng.ReplayMarkers())
+}
+
+func TestCommand_Replay(t *testing.T) {
+	live := engine.New(Equities)
+	live.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	live.SetCommandJournal(journal)
+
+	for i, cmd := range []Command{
+		placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}),
+		placeCommand("b", "bob", Sell, 99, 4, CommandOrigin{Session: "bob", Sequence: 1}),
+		placeCommand("c", "quoter", Sell, 101, 5, CommandOrigin{}),
+		{Origin: CommandOrigin{Session: "alice", Sequence: 2}, Type: CancelOwnOrderCommand, AssetType: Equities, Owner: "alice", UUID: "a"},
+	} {
+		_, err := live.Apply(cmd)
+		assert.NoError(t, err, i)
+	}
+
+	// Replaying everything onto a fresh engine rebuilds the books.
+	replayed := engine.New(Equities)
+	replayed.SetReporter(&MockReporter{})
+	n, err := replayed.Replay(journal.cmds)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, live.ReplayMarkers(), replayed.ReplayMarkers())
+	assert.Empty(t, replayed.OpenOrders("alice"))
+	assert.Len(t, replayed.OpenOrders("quoter"), 1)
+	assert.Len(t, replayed.Trades, 1)
+
+	// Replaying it again applies nothing twice.
+	n, err = replayed.Replay(journal.cmds)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, replayed.Trades, 1)
+
+	// Restored part of the way along, only the rest is applied.
+	partial := engine.New(Equities)
+	partial.SetReporter(&MockReporter{})
+	_, err = partial.Replay(journal.cmds[:2])
+	assert.NoError(t, err)
+	markers := partial.ReplayMarkers()
+
+	restored := engine.New(Equities)
+	restored.SetReporter(&MockReporter{})
+	_, err = restored.Replay(journal.cmds[:2])
+	assert.NoError(t, err)
+	restored.RestoreReplayMarkers(markers)
+	n, err = restored.Replay(journal.cmds)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, restored.Trades, 1)
+	assert.Empty(t, restored.OpenOrders("alice"))
+
+	// A session resending a command already applied is refused.
+	_, err = restored.Apply(placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}))
+	assert.ErrorIs(t, err, engine.ErrCommandApplied)
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 98.0, 20)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Sell, 101.0, 5)
+	placeOwnedOrder(t, eng, "d", "TEST", "bob", Sell, 101.0, 6)
+	assert.NoError(t, eng.CancelOrder(Equities, "b"))
+	before, err := eng.Depth("TEST", 10)
+	assert.NoError(t, err)
+
+	// Nothing changes as far as trading is concerned.
+	assert.NoError(t, eng.Compact())
+	after, err := eng.Depth("TEST", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	placeOwnedOrder(t, eng, "e", "TEST", "alice", Buy, 101.0, 7)
+	assert.Len(t, eng.Trades, 2)
+	assert.Equal(t, "c", eng.Trades[0].CounterParty.UUID)
+	bids, asks := eng.Books["TEST"].Depth(10)
+	assert.Equal(t, []DepthLevel{{Price: 99.0, Quantity: 10, Orders: 1}}, bids)
+	assert.Equal(t, []DepthLevel{{Price: 101.0, Quantity: 4, Orders: 1}}, asks)
+
+	metrics := eng.CompactionMetrics()
+	assert.Equal(t, uint64(1), metrics.Runs)
+	assert.Equal(t, metrics.LastRun, metrics.TimeSpent)
+	assert.Zero(t, metrics.Violations)
+}
+
+func TestCompact_LevelTTL(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{epoch})
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "LIST", AssetType: Equities, PriceScale: 2}))
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Sell, 101.0, 5)
+	placeOwnedOrder(t, eng, "c", "GONE", "alice", Buy, 50.0, 1)
+	assert.NoError(t, eng.CancelOrder(Equities, "c"))
+	eng.SetClock(fixedClock{epoch.Add(45 * time.Minute)})
+	placeOwnedOrder(t, eng, "d", "TEST", "alice", Buy, 98.0, 10)
+
+	// Nothing goes stale without a TTL.
+	eng.SetClock(fixedClock{epoch.Add(90 * time.Minute)})
+	metrics := eng.BookMetrics()
+	assert.Zero(t, metrics.StaleBooks)
+	assert.Zero(t, metrics.StaleLevels)
+	assert.Equal(t, 90*time.Minute, metrics.OldestLevel)
+
+	eng.SetLevelTTL(time.Hour)
+	assert.Equal(t, BookMetrics{
+		Books:       3,
+		EmptyBooks:  2,
+		StaleBooks:  1, // Listed books are kept however long they are empty
+		Levels:      3,
+		StaleLevels: 2,
+		Orders:      3,
+		OldestLevel: 90 * time.Minute,
+	}, eng.BookMetrics())
+
+	// Only the empty book made on the fly is dropped.
+	assert.NoError(t, eng.Compact())
+	assert.NotContains(t, eng.Books, "GONE")
+	_, listed := eng.Instrument("GONE")
+	assert.False(t, listed)
+	assert.Contains(t, eng.Books, "LIST")
+	metrics = eng.BookMetrics()
+	assert.Equal(t, 2, metrics.Books)
+	assert.Equal(t, uint64(1), metrics.Dropped)
+	assert.Equal(t, uint64(1), eng.CompactionMetrics().Dropped)
+
+	// Trading it again makes it afresh.
+	placeOwnedOrder(t, eng, "e", "GONE", "bob", Sell, 51.0, 1)
+	assert.Contains(t, eng.Books, "GONE")
+}
+
+func TestCompact_InvariantViolations(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Sell, 101.0, 5)
+
+	// Corrupt the book behind the engine's back.
+	level, _ := eng.Books["TEST"].Bids.Min()
+	order, _ := level.Orders.Front()
+	order.Quantity = 0
+	level.PriceLevel = 102.0
+
+	// Checking finds it without compacting.
+	assert.ErrorIs(t, eng.CheckIntegrity(), engine.ErrInvariantViolation)
+	assert.Zero(t, eng.CompactionMetrics().Runs)
+
+	err := eng.Compact()
+	assert.ErrorIs(t, err, engine.ErrInvariantViolation)
+	assert.ErrorContains(t, err, "order a at 99 on level 102")
+	assert.ErrorContains(t, err, "crossed at 102/101")
+	// The level's aggregate was not told either.
+	assert.ErrorContains(t, err, "level at 102 totals 0, not 10")
+	assert.Equal(t, uint64(3), eng.CompactionMetrics().Violations)
+}
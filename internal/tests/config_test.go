@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"errors"
+	"fenrir/internal/config"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+port: 9101
+msgrate: 500.5
+takeover: true
+idle: 30s
+admins: [root, ops]
+risklimits:
+  - "*:1000:50000:5"
+  - "alice:5000::"
+quote:
+`), 0o644))
+	settings, err := config.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"port":       "9101",
+		"msgrate":    "500.5",
+		"takeover":   "true",
+		"idle":       "30s",
+		"admins":     "root,ops",
+		"risklimits": "*:1000:50000:5,alice:5000::",
+		"quote":      "",
+	}, settings)
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	port := flags.Int("port", 9001, "")
+	msgRate := flags.Float64("msgrate", 0, "")
+	takeover := flags.Bool("takeover", false, "")
+	idle := flags.Duration("idle", 0, "")
+	admins := flags.String("admins", "", "")
+	riskLimits := flags.String("risklimits", "", "")
+	quote := flags.String("quote", "AAPL:100:1:10", "")
+	host := flags.String("host", "0.0.0.0", "")
+	require.NoError(t, flags.Parse([]string{"-admins", "root"}))
+
+	// The command line wins over the environment, which wins over the file.
+	env := map[string]string{"FENRIR_ADMINS": "ops", "FENRIR_PORT": "9201"}
+	require.NoError(t, config.Apply(flags, settings, func(name string) string { return env[name] }))
+	assert.Equal(t, 9201, *port)
+	assert.Equal(t, 500.5, *msgRate)
+	assert.True(t, *takeover)
+	assert.Equal(t, 30*time.Second, *idle)
+	assert.Equal(t, "root", *admins)
+	assert.Equal(t, "*:1000:50000:5,alice:5000::", *riskLimits)
+	assert.Empty(t, *quote)
+	assert.Equal(t, "0.0.0.0", *host)
+
+	// Mistyped and malformed settings are refused.
+	assert.ErrorIs(t, config.Apply(flags, map[string]string{"prot": "1"}, os.Getenv), config.ErrUnknownSetting)
+	fresh := flag.NewFlagSet("server", flag.ContinueOnError)
+	fresh.Duration("idle", 0, "")
+	assert.ErrorIs(t, config.Apply(fresh, map[string]string{"idle": "soon"}, os.Getenv), config.ErrInvalidSetting)
+	require.NoError(t, os.WriteFile(path, []byte("risklimits: {alice: 1}\n"), 0o644))
+	_, err = config.Load(path)
+	assert.ErrorIs(t, err, config.ErrInvalidSetting)
+
+	// Checks report every flag which fails them.
+	errBad := errors.New("bad")
+	err = config.Validate(flags, map[string]config.Check{
+		"host": func(string) error { return nil },
+		"port": func(string) error { return errBad },
+		"admins": func(value string) error {
+			assert.Equal(t, "root", value)
+			return errBad
+		},
+	})
+	assert.ErrorIs(t, err, config.ErrInvalidSetting)
+	assert.ErrorIs(t, err, errBad)
+	assert.Contains(t, err.Error(), "port")
+	assert.Contains(t, err.Error(), "admins")
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/marketgen"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCredit_ReservesAndReleases(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	assert.NoError(t, eng.Onboard(Participant{ID: "alice", CreditLimit: 2000}))
+	_, ok := eng.Credit("bob")
+	assert.False(t, ok)
+
+	// Resting orders reserve their notional at their limit.
+	placeOwnedOrder(t, eng, "00000000-0000-0000-0000-00000000000a", "AAPL", "alice", Buy, 100, 10)
+	usage, ok := eng.Credit("alice")
+	assert.True(t, ok)
+	assert.Equal(t, CreditUsage{Limit: 2000, Reserved: 1000}, usage)
+
+	over := Order{UUID: "00000000-0000-0000-0000-00000000000b", Ticker: "AAPL", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 101, Quantity: 10, TotalQuantity: 10}
+	err := eng.PlaceOrder(Equities, over)
+	assert.ErrorIs(t, err, engine.ErrCreditLimitExceeded)
+	assert.Equal(t, RejectCreditLimit, RejectReasonOf(err))
+	assert.ErrorIs(t, eng.CheckOrder(Equities, over), engine.ErrCreditLimitExceeded)
+
+	// Fills move the reservation onto the position, at the price last traded.
+	placeOwnedOrder(t, eng, "00000000-0000-0000-0000-00000000000c", "AAPL", "bob", Sell, 100, 5)
+	usage, _ = eng.Credit("alice")
+	assert.Equal(t, CreditUsage{Limit: 2000, Reserved: 500, Positions: 500}, usage)
+
+	// Cancelling releases what is left.
+	assert.NoError(t, eng.CancelOrder(Equities, "00000000-0000-0000-0000-00000000000a"))
+	usage, _ = eng.Credit("alice")
+	assert.Equal(t, 500.0, usage.Exposure())
+	assert.Equal(t, 1500.0, usage.Available())
+	assert.NoError(t, eng.PlaceOrder(Equities, over))
+
+	// Market orders count what they would fill at.
+	placeOwnedOrder(t, eng, "00000000-0000-0000-0000-00000000000d", "MSFT", "bob", Sell, 50, 100)
+	market := Order{UUID: "00000000-0000-0000-0000-00000000000e", Ticker: "MSFT", Owner: "alice", Side: Buy, OrderType: MarketOrder, Quantity: 10, TotalQuantity: 10}
+	assert.ErrorIs(t, eng.CheckOrder(Equities, market), engine.ErrCreditLimitExceeded)
+	market.Quantity, market.TotalQuantity = 9, 9
+	assert.NotErrorIs(t, eng.CheckOrder(Equities, market), engine.ErrCreditLimitExceeded)
+}
+
+func TestCredit_TracksReservations(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	owners := []string{"trader-001", "trader-002", "trader-003", "trader-004", "trader-005"}
+	for _, owner := range owners {
+		eng.SetCreditLimit(owner, 1e12)
+	}
+	check := func(eng *engine.Engine) {
+		for _, owner := range owners {
+			usage, ok := eng.Credit(owner)
+			assert.True(t, ok)
+			assert.InDelta(t, eng.ScanReserved(owner), usage.Reserved, 1e-6, owner)
+		}
+	}
+
+	// Orders rest, fill and are cancelled as the flow goes on.
+	generator := marketgen.New(marketgen.Config{Seed: 9, Tickers: []string{"AAPL", "MSFT"}, Participants: len(owners)})
+	for range 10 {
+		_, err := eng.Replay(generator.Generate(500))
+		assert.NoError(t, err)
+		check(eng)
+	}
+	assert.NotZero(t, eng.ScanReserved("trader-001"))
+
+	// Restored, each order rests once more.
+	restored := engine.New(Equities)
+	restored.SetReporter(&MockReporter{})
+	for _, owner := range owners {
+		restored.SetCreditLimit(owner, 1e12)
+	}
+	assert.NoError(t, restored.RestoreSnapshot(eng.Snapshot()))
+	check(restored)
+}
@@ -0,0 +1,35 @@
+package tests
+
+import (
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDisclosure_Counterparty(t *testing.T) {
+	server := fenrirNet.New("127.0.0.1", 0, nil)
+	assert.Equal(t, "alice", server.Counterparty("alice"))
+
+	disclosure, err := fenrirNet.ParseDisclosure("Anonymized")
+	assert.NoError(t, err)
+	assert.NoError(t, server.SetCounterpartyDisclosure(disclosure, []byte("secret")))
+	alice := server.Counterparty("alice")
+	assert.Len(t, alice, 16)
+	assert.NotContains(t, alice, "alice")
+	// The same owner is always the same ID, and different owners different.
+	assert.Equal(t, alice, server.Counterparty("alice"))
+	assert.NotEqual(t, alice, server.Counterparty("bob"))
+
+	// IDs only carry across servers keyed the same.
+	other := fenrirNet.New("127.0.0.1", 0, nil)
+	assert.NoError(t, other.SetCounterpartyDisclosure(fenrirNet.DiscloseAnonymized, []byte("secret")))
+	assert.Equal(t, alice, other.Counterparty("alice"))
+	assert.NoError(t, other.SetCounterpartyDisclosure(fenrirNet.DiscloseAnonymized, nil))
+	assert.NotEqual(t, alice, other.Counterparty("alice"))
+
+	assert.NoError(t, server.SetCounterpartyDisclosure(fenrirNet.DiscloseHidden, nil))
+	assert.Empty(t, server.Counterparty("alice"))
+
+	_, err = fenrirNet.ParseDisclosure("partial")
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidDisclosure)
+}
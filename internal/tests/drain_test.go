@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+
+	eng := engine.New(Equities)
+	placeOwnedOrder(t, eng, uuid.New().String(), "TEST", "alice", Sell, 120, 10)
+	var server *fenrirNet.Server
+	conn := serve(t, eng, func(s *fenrirNet.Server) { server = s })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "openOrder", "exchangeStatus"}, reports.next(t, 3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	require.NoError(t, server.Drain(ctx, true))
+
+	// Alice is told the exchange is shutting down, then that her order is
+	// gone, before Drain returns.
+	drained := reports.reports(t, 2)
+	assert.Equal(t, "exchangeStatus", drained[0]["type"])
+	assert.Equal(t, "closed", drained[0]["state"])
+	assert.Equal(t, "shutting down", drained[0]["message"])
+	assert.Equal(t, "unsolicitedCancel", drained[1]["type"])
+	assert.Equal(t, "shutdown", drained[1]["reason"])
+	for _, book := range eng.Books {
+		assert.Empty(t, book.Asks.Items())
+	}
+
+	// Her session stays open, but new orders are refused, as are new
+	// connections.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	refused := reports.reports(t, 1)[0]
+	assert.Equal(t, "error", refused["type"])
+	assert.Equal(t, fenrirNet.ErrExchangeDraining.Error(), refused["error"])
+	_, err = net.DialTimeout("tcp", conn.RemoteAddr().String(), time.Second)
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusOpened}), fenrirNet.ErrExchangeDraining)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// logonFrame is a logon as owner, signed with secret.
+func logonFrame(owner, secret string) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, uint16(fenrirNet.Logon))
+	buf = append(buf, byte(len(owner)))
+	buf = append(buf, owner...)
+	timestamp := uint64(time.Now().UnixNano())
+	buf = binary.BigEndian.AppendUint64(buf, timestamp)
+	buf = append(buf, fenrirNet.SignLogon(owner, timestamp, secret)...)
+	return binary.BigEndian.AppendUint32(buf, 0)
+}
+
+func subscribeFrame(channel fenrirNet.Channel, ticker string) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, uint16(fenrirNet.Subscribe))
+	buf = append(buf, byte(channel))
+	return append(buf, ticker...)
+}
+
+func TestEntitlement_Feed(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	server := fenrirNet.New("127.0.0.1", 0, eng)
+	server.SetCredentials(map[string]string{"alice": "a", "bob": "b"})
+	server.SetDataTiers(map[string]DataTier{"alice": TopOfBookTier, "bob": TopDepthTier}, TopOfBookTier)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+	feed := fenrirNet.NewFeed("127.0.0.1", port)
+	feed.SetEntitler(server)
+	eng.SetMarketDataPublisher(feed)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go feed.Run(ctx)
+
+	subscribe := func(frames ...[]byte) net.Conn {
+		var conn net.Conn
+		require.Eventually(t, func() bool {
+			conn, err = net.Dial("tcp", listener.Addr().String())
+			return err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+		t.Cleanup(func() { conn.Close() })
+		for _, frame := range frames {
+			_, err := conn.Write(frame)
+			require.NoError(t, err)
+		}
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		return conn
+	}
+	refused := func(conn net.Conn) {
+		_, err := io.ReadAll(conn)
+		assert.NoError(t, err, "disconnected rather than timing out")
+	}
+
+	// Those not logged on, and those failing to, only see the top of book.
+	refused(subscribe(subscribeFrame(fenrirNet.TopDepthChannel, "TEST")))
+	refused(subscribe(logonFrame("bob", "wrong"), subscribeFrame(fenrirNet.BBOChannel, "TEST")))
+	refused(subscribe(logonFrame("alice", "a"), subscribeFrame(fenrirNet.BBOChannel, "TEST"), subscribeFrame(fenrirNet.TopDepthChannel, "TEST")))
+	refused(subscribe(logonFrame("bob", "b"), subscribeFrame(fenrirNet.DepthChannel, fenrirNet.AllTickers)))
+
+	// Bob sees the top levels of the book, however many more there are.
+	for i := range 7 {
+		placeOwnedOrder(t, eng, fmt.Sprint("ask", i), "TEST", "carol", Sell, 110.0+float64(i), 1)
+	}
+	conn := subscribe(logonFrame("bob", "b"), subscribeFrame(fenrirNet.TopDepthChannel, "TEST"))
+	var read []byte
+	bids := 0
+	// Subscribing is not answered, so better bids are placed until they are
+	// seen.
+	require.Eventually(t, func() bool {
+		placeOwnedOrder(t, eng, fmt.Sprint("bid", bids), "TEST", "dave", Buy, 100.0+float64(bids)/100, 1)
+		bids++
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+		buf := make([]byte, 4096)
+		n, _ := conn.Read(buf)
+		read = append(read, buf[:n]...)
+		return n > 0
+	}, 2*time.Second, time.Millisecond)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		if reports, err := fenrirNet.JSONReports(read, false); err == nil && len(reports) > 0 {
+			assert.Equal(t, "bookSnapshot", reports[0]["type"])
+			assert.Len(t, reports[0]["asks"], TopDepthLevels)
+			assert.Equal(t, 110.0, reports[0]["asks"].([]map[string]any)[0]["price"])
+			break
+		}
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		read = append(read, buf[:n]...)
+	}
+}
+
+func TestEntitlement_Snapshot(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	logon := records[0].Data
+
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	for i := range 7 {
+		placeOwnedOrder(t, eng, fmt.Sprint("ask", i), "TEST", "carol", Sell, 110.0+float64(i), 1)
+	}
+	conn := serve(t, eng, func(s *fenrirNet.Server) {
+		s.SetDataTiers(map[string]DataTier{"alice": TopDepthTier}, TopOfBookTier)
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(logon)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// However deep alice asks for, she is given no more than her tier.
+	request := binary.BigEndian.AppendUint16(nil, uint16(fenrirNet.BookSnapshotRequest))
+	request = binary.BigEndian.AppendUint16(append(request, "TEST"...), 10)
+	_, err = conn.Write(request)
+	require.NoError(t, err)
+	snapshot := reports.reports(t, 1)[0]
+	assert.Equal(t, "bookSnapshot", snapshot["type"])
+	assert.Len(t, snapshot["asks"], TopDepthLevels)
+}
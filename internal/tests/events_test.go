@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/events"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps every message published to it.
+type recordingSink struct {
+	lock     sync.Mutex
+	messages []events.Message
+}
+
+func (sink *recordingSink) Publish(messages []events.Message) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.messages = append(sink.messages, messages...)
+	return nil
+}
+
+func (sink *recordingSink) Close() error {
+	return nil
+}
+
+func TestEvents_Publisher(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	topics, err := events.ParseTopics("crypto:coins.orders:coins.trades")
+	assert.NoError(t, err)
+	sink := &recordingSink{}
+	publisher := events.NewPublisher(sink, topics, 64)
+
+	eng := engine.New(Equities, Crypto)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{epoch})
+	eng.SetAuditor(publisher)
+	eng.SetTradeRecorder(publisher, 0)
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "BTC", AssetType: Crypto, QuantityScale: 8, PriceScale: DefaultPriceScale}))
+
+	placeOwnedOrder(t, eng, "a", "AAPL", "alice", Sell, 100, 10)
+	placeOwnedOrder(t, eng, "b", "AAPL", "bob", Buy, 100, 4)
+	assert.NoError(t, eng.PlaceOrder(Crypto, Order{
+		UUID: "c", Ticker: "BTC", Side: Buy, OrderType: LimitOrder, LimitPrice: 50,
+		Quantity: 50_000_000, TotalQuantity: 50_000_000, Owner: "carol",
+	}))
+	eng.KillSwitch("admin")
+	assert.NoError(t, publisher.Close())
+	assert.Zero(t, publisher.Dropped())
+
+	var got []string
+	for _, msg := range sink.messages {
+		got = append(got, msg.Topic+" "+msg.Key)
+	}
+	assert.Equal(t, []string{
+		"fenrir.equities.orders AAPL", // a
+		"fenrir.equities.orders AAPL", // b
+		"fenrir.equities.trades AAPL",
+		"fenrir.equities.orders AAPL", // Trade, taker side
+		"fenrir.equities.orders AAPL", // Trade, maker side
+		"coins.orders BTC",            // c
+		"fenrir.equities.orders ",     // Kill switch, on every asset type
+		"coins.orders ",
+		"fenrir.equities.orders AAPL", // Cancel a
+		"coins.orders BTC",            // Cancel c
+	}, got)
+
+	decode := func(i int) map[string]any {
+		var event map[string]any
+		assert.NoError(t, json.Unmarshal(sink.messages[i].Value, &event))
+		return event
+	}
+	assert.Equal(t, map[string]any{
+		"schema":       float64(events.Schema),
+		"type":         "trade",
+		"tradeId":      float64(1),
+		"ts":           "2024-01-02T09:00:00Z",
+		"symbol":       "AAPL",
+		"assetType":    "equities",
+		"price":        float64(100),
+		"qty":          "4",
+		"aggressor":    "buy",
+		"taker":        "bob",
+		"takerOrderId": "b",
+		"maker":        "alice",
+		"makerOrderId": "a",
+	}, decode(2))
+
+	fill := decode(3)
+	assert.Equal(t, "trade", fill["event"])
+	assert.Equal(t, "b", fill["orderId"])
+	assert.Equal(t, "a", fill["counterpartyOrderId"])
+	assert.Equal(t, true, fill["aggressor"])
+
+	order := decode(5)
+	assert.Equal(t, "new", order["event"])
+	assert.Equal(t, "crypto", order["assetType"])
+	assert.Equal(t, "carol", order["owner"])
+
+	kill := decode(6)
+	assert.Equal(t, "killSwitch", kill["event"])
+	assert.Equal(t, "admin", kill["owner"])
+	assert.NotContains(t, kill, "symbol")
+
+	cancel := decode(9)
+	assert.Equal(t, "cancel", cancel["event"])
+	assert.Equal(t, "killSwitch", cancel["cancelReason"])
+	assert.Equal(t, "0.50000000", cancel["qty"])
+}
+
+func TestEvents_Topics(t *testing.T) {
+	topics, err := events.ParseTopics("")
+	assert.NoError(t, err)
+	assert.Equal(t, events.Topics{Orders: "fenrir.crypto.orders", Trades: "fenrir.crypto.trades"}, topics[Crypto])
+
+	_, err = events.ParseTopics("bonds:a:b")
+	assert.ErrorIs(t, err, events.ErrInvalidTopics)
+	_, err = events.ParseTopics("crypto:a")
+	assert.ErrorIs(t, err, events.ErrInvalidTopics)
+
+	_, err = events.Open("amqp://localhost")
+	assert.ErrorIs(t, err, events.ErrUnsupportedSink)
+}
+
+func TestEvents_NATS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// A server just far enough along to take publishes, and to check it is
+	// answered when it pings.
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+
+		var lines []string
+		for len(lines) < 6 {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB "):
+				fields := strings.Fields(line)
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				io.ReadFull(r, payload)
+				lines = append(lines, line, string(payload[:n]))
+				if len(lines) == 5 {
+					io.WriteString(conn, "PING\r\n")
+				}
+			default:
+				lines = append(lines, line)
+			}
+		}
+		received <- lines
+	}()
+
+	sink, err := events.DialNATS(listener.Addr().String())
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish([]events.Message{
+		{Topic: "fenrir.equities.orders", Key: "AAPL", Value: []byte(`{"a":1}`)},
+		{Topic: "fenrir.equities.trades", Key: "AAPL", Value: []byte(`{"b":2}`)},
+	}))
+
+	select {
+	case lines := <-received:
+		assert.True(t, strings.HasPrefix(lines[0], "CONNECT {"))
+		assert.Equal(t, []string{
+			"PUB fenrir.equities.orders 7", `{"a":1}`,
+			"PUB fenrir.equities.trades 7", `{"b":2}`,
+			"PONG",
+		}, lines[1:])
+	case <-time.After(5 * time.Second):
+		t.Fatal("nats server never received the publishes")
+	}
+	assert.NoError(t, sink.Close())
+}
+
+func TestEvents_KafkaREST(t *testing.T) {
+	type request struct {
+		path, contentType string
+		body              map[string][]map[string]any
+	}
+	var requests []request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path, contentType: r.Header.Get("Content-Type")}
+		json.NewDecoder(r.Body).Decode(&req.body)
+		requests = append(requests, req)
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.Error(w, "topic not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	sink, err := events.Open(proxy.URL + "/")
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish([]events.Message{
+		{Topic: "orders", Key: "AAPL", Value: []byte(`{"a":1}`)},
+		{Topic: "trades", Key: "AAPL", Value: []byte(`{"b":2}`)},
+		{Topic: "orders", Value: []byte(`{"c":3}`)},
+	}))
+
+	// One request a topic, in order, unkeyed messages keyed with null.
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/topics/orders", requests[0].path)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", requests[0].contentType)
+	assert.Equal(t, []map[string]any{
+		{"key": "AAPL", "value": map[string]any{"a": float64(1)}},
+		{"key": nil, "value": map[string]any{"c": float64(3)}},
+	}, requests[0].body["records"])
+	assert.Equal(t, "/topics/trades", requests[1].path)
+
+	err = sink.Publish([]events.Message{{Topic: "missing", Value: []byte(`{}`)}})
+	assert.ErrorContains(t, err, "topic not found")
+	assert.NoError(t, sink.Close())
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// slowRiskChecker holds up alice's orders, as her reader being scheduled late
+// would.
+type slowRiskChecker struct {
+	delay time.Duration
+}
+
+func (checker slowRiskChecker) CheckOrder(ctx context.Context, owner string, order fenrirNet.NewOrderMessage) error {
+	if owner == "alice" {
+		time.Sleep(checker.delay)
+	}
+	return nil
+}
+
+func TestFairness_OrdersByReadTime(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	// alice logging on, then the first of her orders.
+	logon, order := records[0].Data, records[3].Data[:50]
+
+	// Sends alice's order, then the same for bob shortly after, returning
+	// their orders as they rest, and how many of the two were reordered and
+	// late.
+	place := func(window time.Duration) (Order, Order, uint64, uint64) {
+		eng := engine.New(Equities)
+		var server *fenrirNet.Server
+		alice := serve(t, eng, func(s *fenrirNet.Server) {
+			server = s
+			s.SetFairnessWindow(window)
+			s.SetRiskGate(fenrirNet.NewRiskGate(slowRiskChecker{50 * time.Millisecond}, time.Second, fenrirNet.RiskFailClosed))
+		})
+		bob, err := net.Dial("tcp", alice.RemoteAddr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { bob.Close() })
+
+		aliceReports, bobReports := &reportReader{conn: alice}, &reportReader{conn: bob}
+		for conn, logon := range map[net.Conn][]byte{alice: logon, bob: logonFrame("bob", "")} {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err := conn.Write(logon)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, []string{"session", "exchangeStatus"}, aliceReports.next(t, 2))
+		assert.Equal(t, []string{"session", "exchangeStatus"}, bobReports.next(t, 2))
+		before := server.InputQueueMetrics()
+
+		_, err = alice.Write(order)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		_, err = bob.Write(order)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"orderAck"}, aliceReports.next(t, 1))
+		assert.Equal(t, []string{"orderAck"}, bobReports.next(t, 1))
+
+		after := server.InputQueueMetrics()
+		return eng.OpenOrders("alice")[0], eng.OpenOrders("bob")[0], after.Reordered - before.Reordered, after.Late - before.Late
+	}
+
+	// Handled as they are handed over, bob's order goes ahead of alice's,
+	// though she sent hers first.
+	alice, bob, reordered, late := place(0)
+	assert.Less(t, bob.Sequence, alice.Sequence)
+	assert.Zero(t, reordered)
+	assert.Equal(t, uint64(1), late)
+
+	// Within the window, they are put back in the order they were read.
+	alice, bob, reordered, late = place(200 * time.Millisecond)
+	assert.Less(t, alice.Sequence, bob.Sequence)
+	assert.Equal(t, uint64(2), reordered)
+	assert.Zero(t, late)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func createTestPerpetualEngine(t *testing.T) *engine.Engine {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	perp, err := ParsePerpetual(Equities, "BTCP:BTC:8h:1")
+	assert.NoError(t, err)
+	assert.NoError(t, eng.RegisterPerpetual(perp))
+	return eng
+}
+
+func TestFund(t *testing.T) {
+	eng := createTestPerpetualEngine(t)
+	_, err := eng.Fund("BTCP")
+	assert.ErrorIs(t, err, engine.ErrNoFundingPrice)
+	_, err = eng.Fund("BTC")
+	assert.ErrorIs(t, err, engine.ErrNotAPerpetual)
+
+	placeOwnedOrder(t, eng, "index-ask", "BTC", "x", Sell, 100.0, 1)
+	placeOwnedOrder(t, eng, "index-bid", "BTC", "y", Buy, 100.0, 1)
+	// Premiums of 2% then 1%.
+	placeOwnedOrder(t, eng, "ask1", "BTCP", "alice", Sell, 102.0, 5)
+	placeOwnedOrder(t, eng, "bid1", "BTCP", "bob", Buy, 102.0, 5)
+	placeOwnedOrder(t, eng, "ask2", "BTCP", "carol", Sell, 101.0, 2)
+	placeOwnedOrder(t, eng, "bid2", "BTCP", "bob", Buy, 101.0, 2)
+
+	// The 1.5% average premium is capped at 1%, longs paying shorts 1% of
+	// their position at the mark price.
+	funding, err := eng.Fund("BTCP")
+	assert.NoError(t, err)
+	assert.Equal(t, 101.0, funding.MarkPrice)
+	assert.Equal(t, 100.0, funding.IndexPrice)
+	assert.InDelta(t, 0.015, funding.Premium, 1e-9)
+	assert.Equal(t, 0.01, funding.Rate)
+	assert.Len(t, funding.Payments, 3)
+	expected := []FundingPayment{
+		{Owner: "alice", Position: -5, Amount: 5.05},
+		{Owner: "bob", Position: 7, Amount: -7.07},
+		{Owner: "carol", Position: -2, Amount: 2.02},
+	}
+	total := 0.0
+	for i, payment := range funding.Payments {
+		assert.Equal(t, expected[i].Owner, payment.Owner)
+		assert.Equal(t, expected[i].Position, payment.Position)
+		assert.InDelta(t, expected[i].Amount, payment.Amount, 1e-9)
+		total += payment.Amount
+	}
+	assert.InDelta(t, 0, total, 1e-9)
+
+	// Without trades since, the premium now is used, and funding adds up in
+	// the ledger.
+	funding, err = eng.Fund("BTCP")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.01, funding.Premium, 1e-9)
+	ledger := eng.Ledger()
+	assert.InDelta(t, -14.14, ledger.Funding[PositionKey{Owner: "bob", Ticker: "BTCP"}], 1e-9)
+	assert.InDelta(t, 10.10, ledger.Funding[PositionKey{Owner: "alice", Ticker: "BTCP"}], 1e-9)
+	assert.NotContains(t, ledger.Funding, PositionKey{Owner: "x", Ticker: "BTC"})
+}
+
+func TestRegisterPerpetual(t *testing.T) {
+	eng := createTestPerpetualEngine(t)
+	_, ok := eng.Instrument("BTCP")
+	assert.True(t, ok)
+
+	perp, _ := eng.Perpetual("BTCP")
+	assert.ErrorIs(t, eng.RegisterPerpetual(perp), engine.ErrInstrumentExists)
+	assert.NoError(t, eng.RegisterStrategy(Straddle("ST1", Equities, "C100", "P100")))
+	assert.ErrorIs(t, eng.RegisterPerpetual(Perpetual{Ticker: "STP", AssetType: Equities, Index: "ST1", Interval: time.Hour}), engine.ErrInvalidPerpIndex)
+	assert.ErrorIs(t, eng.RegisterPerpetual(Perpetual{Ticker: "ETHP", AssetType: Equities, Index: "ETH"}), ErrInvalidPerpetual)
+	assert.ErrorIs(t, eng.RegisterPerpetual(Perpetual{Ticker: "ETHP", AssetType: Crypto, Index: "ETH", Interval: time.Hour}), engine.ErrUnsupportedAsset)
+}
+
+func TestParsePerpetual(t *testing.T) {
+	perp, err := ParsePerpetual(Crypto, "ETHP:ETH:1h:")
+	assert.NoError(t, err)
+	assert.Equal(t, Perpetual{Ticker: "ETHP", AssetType: Crypto, Index: "ETH", Interval: time.Hour}, perp)
+	// Uncapped, and funded on the hour.
+	assert.Equal(t, -0.05, perp.FundingRate(-0.05))
+	at := time.Date(2026, 3, 1, 7, 59, 59, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), perp.NextFunding(at))
+	perp.Interval = 8 * time.Hour
+	assert.Equal(t, time.Date(2026, 3, 1, 16, 0, 0, 0, time.UTC), perp.NextFunding(at.Add(time.Second)))
+
+	for _, spec := range []string{"ETHP:ETH:1h", "ETHP:ETHP:1h:", "ETHP:ETH:soon:", "ETHP:ETH:-1h:", "ETHP:ETH:1h:-1"} {
+		_, err := ParsePerpetual(Crypto, spec)
+		assert.ErrorIs(t, err, ErrInvalidPerpetual, spec)
+	}
+}
+
+func TestFundingStatement_JSON(t *testing.T) {
+	statement := fenrirNet.FundingStatement{Ticker: "BTCP", Rate: 0.01, MarkPrice: 101, IndexPrice: 100, Position: -5, Amount: 5.05, PriceScale: 2}
+	reports, err := fenrirNet.JSONReports(statement.Serialize(), false)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, "funding", reports[0]["type"])
+	assert.Equal(t, int64(-5), reports[0]["position"])
+	assert.Equal(t, 5.05, reports[0]["amount"])
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGateway_ParseJSONMessage(t *testing.T) {
+	message, err := fenrirNet.ParseJSONMessage([]byte(`{"type": "newOrder", "ticker": "BT", "side": "sell", "timeInForce": "gtc", "price": 101.5, "quantity": 10, "clOrdId": 7}`))
+	assert.NoError(t, err)
+	order, ok := message.(fenrirNet.NewOrderMessage)
+	assert.True(t, ok)
+	// Tickers are padded as they are on the binary protocol, the rest defaulted.
+	assert.Equal(t, "BT\x00\x00", order.Ticker)
+	assert.Equal(t, Equities, order.AssetType)
+	assert.Equal(t, LimitOrder, order.OrderType)
+	assert.Equal(t, Sell, order.Side)
+	assert.Equal(t, GoodTillCancel, order.TimeInForce)
+	assert.Equal(t, 101.5, order.LimitPrice)
+	assert.Equal(t, uint64(10), order.Quantity)
+	assert.Equal(t, uint64(7), order.ClOrdID)
+	assert.NoError(t, order.Validate())
+
+	// Unknown names are left for validation to reject.
+	message, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "newOrder", "ticker": "AAPL", "side": "up", "price": 1, "quantity": 1}`))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, message.(fenrirNet.NewOrderMessage).Validate(), fenrirNet.ErrInvalidSide)
+
+	message, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "logon", "username": "alice", "timestamp": 1234, "signature": "0a0b", "batchBytes": 4096, "batchDelay": 500}`))
+	assert.NoError(t, err)
+	assert.Equal(t, fenrirNet.LogonMessage{
+		BaseMessage: fenrirNet.BaseMessage{TypeOf: fenrirNet.Logon},
+		Username:    "alice",
+		Timestamp:   1234,
+		Signature:   []byte{0x0a, 0x0b},
+		BatchBytes:  4096,
+		BatchDelay:  500,
+	}, message)
+
+	_, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "bbo", "ticker": "TOOLONG"}`))
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidTicker)
+	_, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "subscribe", "channel": "news"}`))
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidChannel)
+	_, err = fenrirNet.ParseJSONMessage([]byte(`{"type": "bogus"}`))
+	assert.ErrorIs(t, err, fenrirNet.ErrUnknownJSONMessage)
+	_, err = fenrirNet.ParseJSONMessage([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestGateway_JSONReports(t *testing.T) {
+	store := fenrirNet.NewOutboundStore(10)
+	ack := fenrirNet.OrderAck{
+		ClOrdID:        7,
+		UUID:           "0847286b-d34e-41b2-8ae3-fbb7f8868194",
+		Status:         OrderPartiallyFilled,
+		Ticker:         "BT\x00\x00",
+		Side:           Buy,
+		Price:          101.5,
+		LeavesQuantity: 4,
+		TotalQuantity:  10,
+		PriceScale:     DefaultPriceScale,
+		Timestamp:      time.Unix(0, 99),
+	}
+	snapshot, err := fenrirNet.BookSnapshot{BookDepth: BookDepth{
+		Ticker:   "AAPL",
+		Sequence: 3,
+		Bids:     []DepthLevel{{Price: 100, Quantity: 5, Orders: 2}},
+	}}.Serialize()
+	assert.NoError(t, err)
+
+	// Reports written together are split back up, keeping their numbers.
+	buf := append(store.Add(ack.Serialize()), store.Add(snapshot)...)
+	reports, err := fenrirNet.JSONReports(buf, true)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, map[string]any{
+		"type":       "orderAck",
+		"seq":        uint64(1),
+		"clOrdId":    uint64(7),
+		"uuid":       ack.UUID,
+		"status":     "PARTIALLY_FILLED",
+		"ticker":     "BT",
+		"side":       "buy",
+		"price":      101.5,
+		"leaves":     uint64(4),
+		"quantity":   uint64(10),
+		"qtyScale":   uint8(0),
+		"priceScale": uint8(DefaultPriceScale),
+		"timestamp":  uint64(99),
+		"groupId":    uint64(0),
+	}, reports[0])
+	assert.Equal(t, "bookSnapshot", reports[1]["type"])
+	assert.Equal(t, uint64(2), reports[1]["seq"])
+	assert.Equal(t, []map[string]any{{"price": 100.0, "quantity": uint64(5), "orders": uint32(2)}}, reports[1]["bids"])
+	assert.Empty(t, reports[1]["asks"])
+
+	// Feed messages are not numbered.
+	tape := fenrirNet.TradeTape{Ticker: "AAPL", TradeID: 1, Price: 100, Quantity: 5, Aggressor: Sell}
+	reports, err = fenrirNet.JSONReports(tape.Serialize(), false)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, "trade", reports[0]["type"])
+	assert.Equal(t, "sell", reports[0]["aggressor"])
+	assert.NotContains(t, reports[0], "seq")
+
+	// Fills carry everything needed to reconcile them.
+	execution, err := fenrirNet.Report{
+		MessageType:     fenrirNet.ExecutionReport,
+		Side:            Sell,
+		Timestamp:       99,
+		Quantity:        4,
+		Price:           101.5,
+		Ticker:          "BT\x00\x00",
+		UUID:            ack.UUID[:16],
+		ClOrdID:         7,
+		TradeID:         12,
+		Liquidity:       LiquidityMaker,
+		LeavesQuantity:  6,
+		CumQuantity:     4,
+		OrderStatus:     OrderPartiallyFilled,
+		CounterpartyLen: 3,
+		Counterparty:    "bob",
+	}.Serialize()
+	assert.NoError(t, err)
+	reports, err = fenrirNet.JSONReports(execution, false)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, uint64(12), reports[0]["tradeId"])
+	assert.Equal(t, "maker", reports[0]["liquidity"])
+	assert.Equal(t, uint64(6), reports[0]["leaves"])
+	assert.Equal(t, uint64(4), reports[0]["cumQty"])
+	assert.Equal(t, "PARTIALLY_FILLED", reports[0]["orderStatus"])
+	assert.Equal(t, "bob", reports[0]["counterparty"])
+
+	// Cancel rejects say where the order stands instead.
+	reject := fenrirNet.CancelReject{
+		ClOrdID:     7,
+		UUID:        ack.UUID,
+		Reason:      CancelRejectFilled,
+		Timestamp:   time.Unix(0, 99),
+		OrderStatus: OrderFilled,
+		Ticker:      "BT\x00\x00",
+		FilledQty:   10,
+	}
+	reports, err = fenrirNet.JSONReports(reject.Serialize(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{
+		"type":        "cancelReject",
+		"clOrdId":     uint64(7),
+		"uuid":        ack.UUID,
+		"reason":      "order already filled",
+		"timestamp":   uint64(99),
+		"orderStatus": "FILLED",
+		"ticker":      "BT",
+		"filledQty":   uint64(10),
+	}}, reports)
+
+	// A report cut short is an error rather than garbage.
+	_, err = fenrirNet.JSONReports(ack.Serialize()[:20], false)
+	assert.ErrorIs(t, err, fenrirNet.ErrReportTooShort)
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func groupOrder(uuid, ticker string, side Side, price float64, qty uint64, clOrdID uint64) Order {
+	return Order{
+		UUID:          uuid,
+		ClOrdID:       clOrdID,
+		AssetType:     Equities,
+		Ticker:        ticker,
+		Side:          side,
+		OrderType:     LimitOrder,
+		LimitPrice:    price,
+		Quantity:      qty,
+		TotalQuantity: qty,
+		Owner:         "alice",
+	}
+}
+
+func TestPlaceOrderGroup(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "ask", "MSFT", "bob", Sell, 300.0, 5)
+
+	// One bad order rejects the whole group, nothing is placed.
+	err := eng.PlaceOrderGroup([]Order{
+		groupOrder("a", "AAPL", Buy, 100.0, 10, 1),
+		groupOrder("b", "MSFT", Sell, 300.001, 5, 2),
+	})
+	assert.ErrorIs(t, err, ErrOrderGroupRejected)
+	assert.ErrorIs(t, err, engine.ErrInvalidPricePrecision)
+	assert.ErrorContains(t, err, "order 2")
+	assert.NotContains(t, eng.Books, "AAPL")
+	_, ok := eng.ClientOrder("alice", 1)
+	assert.False(t, ok)
+
+	// As does reusing a client order id within the group.
+	err = eng.PlaceOrderGroup([]Order{
+		groupOrder("a", "AAPL", Buy, 100.0, 10, 1),
+		groupOrder("b", "MSFT", Buy, 299.0, 5, 1),
+	})
+	assert.ErrorIs(t, err, engine.ErrDuplicateClOrdID)
+	assert.NotContains(t, eng.Books, "AAPL")
+
+	// Otherwise every order is placed, across books.
+	assert.NoError(t, eng.PlaceOrderGroup([]Order{
+		groupOrder("a", "AAPL", Buy, 100.0, 10, 1),
+		groupOrder("b", "MSFT", Buy, 300.0, 2, 2),
+	}))
+	bids, _ := eng.Books["AAPL"].Depth(10)
+	assert.Equal(t, []DepthLevel{{Price: 100.0, Quantity: 10, Orders: 1}}, bids)
+	assert.Len(t, eng.Trades, 1)
+	assert.Equal(t, uint64(2), eng.Trades[0].MatchQty)
+
+	// Client order ids still live on the book count against later groups.
+	err = eng.PlaceOrderGroup([]Order{groupOrder("c", "AAPL", Buy, 99.0, 1, 1)})
+	assert.ErrorIs(t, err, engine.ErrDuplicateClOrdID)
+}
+
+func TestOrderGroupMessage(t *testing.T) {
+	order := fenrirNet.NewOrderMessage{
+		BaseMessage: fenrirNet.BaseMessage{TypeOf: fenrirNet.NewOrder},
+		AssetType:   Equities,
+		OrderType:   LimitOrder,
+		Ticker:      "AAPL",
+		LimitPrice:  100.0,
+		Quantity:    10,
+		Side:        Buy,
+		TimeInForce: Day,
+	}
+	group := fenrirNet.OrderGroupMessage{BaseMessage: fenrirNet.BaseMessage{TypeOf: fenrirNet.OrderGroup}, GroupID: 7}
+	assert.ErrorIs(t, group.Validate(), fenrirNet.ErrInvalidOrderGroupSize)
+
+	group.Orders = []fenrirNet.NewOrderMessage{order, order}
+	assert.NoError(t, group.Validate())
+
+	group.Orders[1].Quantity = 0
+	err := group.Validate()
+	assert.ErrorIs(t, err, ErrOrderGroupRejected)
+	assert.ErrorContains(t, err, "order 2")
+}
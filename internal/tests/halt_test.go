@@ -0,0 +1,35 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHaltSymbol(t *testing.T) {
+	server := fenrirNet.New("127.0.0.1", 0, nil)
+	assert.Empty(t, server.HaltedSymbols())
+	assert.ErrorIs(t, server.ResumeSymbol("AAPL"), fenrirNet.ErrSymbolNotHalted)
+
+	assert.NoError(t, server.HaltSymbol("MSFT"))
+	assert.NoError(t, server.HaltSymbol("AAPL"))
+	assert.Equal(t, []string{"AAPL", "MSFT"}, server.HaltedSymbols())
+	assert.Equal(t, []string{"AAPL", "MSFT"}, server.Stats().HaltedSymbols)
+
+	assert.NoError(t, server.ResumeSymbol("MSFT"))
+	assert.Equal(t, []string{"AAPL"}, server.HaltedSymbols())
+	assert.ErrorIs(t, server.ResumeSymbol("MSFT"), fenrirNet.ErrSymbolNotHalted)
+
+	assert.Equal(t, RejectTradingHalted, RejectReasonOf(fenrirNet.ErrSymbolHalted))
+}
+
+func TestStats(t *testing.T) {
+	server := fenrirNet.New("127.0.0.1", 0, nil)
+	stats := server.Stats()
+	assert.Zero(t, stats.Connections)
+	assert.Zero(t, stats.Sessions)
+	assert.Empty(t, stats.HaltedSymbols)
+	assert.Equal(t, "open", stats.Status)
+	assert.Equal(t, server.InputQueueMetrics(), stats.Queue)
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// exchange is a server running in process on a free port, over a fresh
+// engine, for scripted clients to trade on as they would over the network.
+type exchange struct {
+	t       *testing.T
+	address string
+}
+
+func newExchange(t *testing.T, configure ...func(server *fenrirNet.Server)) *exchange {
+	return &exchange{t: t, address: startServer(t, engine.New(Equities), configure...)}
+}
+
+// scriptedClient is a session on an exchange, sending what a test scripts
+// and reading back the reports it is sent in turn.
+type scriptedClient struct {
+	t       *testing.T
+	owner   string
+	conn    net.Conn
+	reports *reportReader
+	pending []map[string]any // Read but not yet expected
+	clOrdID uint64           // Last given to an order
+}
+
+// connect connects a client to the exchange without logging on.
+func (ex *exchange) connect(owner string) *scriptedClient {
+	conn := dial(ex.t, ex.address)
+	require.NoError(ex.t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	return &scriptedClient{t: ex.t, owner: owner, conn: conn, reports: &reportReader{conn: conn}}
+}
+
+// logon connects a client and logs it on as owner, returning it along with
+// the reports it is sent up to its exchange status, the open orders it has
+// resting among them.
+func (ex *exchange) logon(owner string) (*scriptedClient, []map[string]any) {
+	client := ex.connect(owner)
+	client.send(logonFrame(owner, ""))
+	reports := client.until("exchangeStatus")
+	assert.Equal(client.t, "session", reports[0]["type"], owner)
+	return client, reports
+}
+
+// relogon logs owner back on, as logon does, once the exchange has seen their
+// last connection go. Until then, they are refused as logged on already.
+func (ex *exchange) relogon(owner string) (*scriptedClient, []map[string]any) {
+	var client *scriptedClient
+	var reports []map[string]any
+	require.Eventually(ex.t, func() bool {
+		client = ex.connect(owner)
+		client.send(logonFrame(owner, ""))
+		if notice := client.next(); notice["notice"] != "sessionResumed" {
+			client.disconnect()
+			return false
+		}
+		reports = client.until("exchangeStatus")
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+	return client, reports
+}
+
+func (client *scriptedClient) send(frame []byte) {
+	_, err := client.conn.Write(frame)
+	require.NoError(client.t, err)
+}
+
+// place sends a limit order on "TEST", returning the client order ID given it.
+func (client *scriptedClient) place(side Side, price float64, qty uint64) uint64 {
+	client.clOrdID++
+	client.send(newOrderFrame("TEST", side, price, qty, client.clOrdID))
+	return client.clOrdID
+}
+
+// cancel sends a cancel of the order given clOrdID.
+func (client *scriptedClient) cancel(clOrdID uint64) {
+	frame := typedFrame(fenrirNet.CancelOrder, fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(frame[2:4], uint16(Equities))
+	binary.BigEndian.PutUint64(frame[4+fenrirNet.UUIDLen:], clOrdID)
+	client.send(frame)
+}
+
+// book asks for the levels resting on "TEST", as the exchange has them once
+// everything sent before has been handled.
+func (client *scriptedClient) book() (bids, asks []map[string]any) {
+	frame := typedFrame(fenrirNet.BookSnapshotRequest, fenrirNet.BookSnapshotRequestHeaderLen)
+	copy(frame[2:6], "TEST")
+	client.send(frame)
+	snapshot := client.expect("bookSnapshot")[0]
+	return snapshot["bids"].([]map[string]any), snapshot["asks"].([]map[string]any)
+}
+
+// next reads the next report sent to the client.
+func (client *scriptedClient) next() map[string]any {
+	if len(client.pending) == 0 {
+		client.pending = client.reports.reports(client.t, 1)
+	}
+	report := client.pending[0]
+	client.pending = client.pending[1:]
+	return report
+}
+
+// expect reads the next reports, asserting they are of the types given in
+// turn.
+func (client *scriptedClient) expect(types ...string) []map[string]any {
+	var reports []map[string]any
+	var got []string
+	for range types {
+		report := client.next()
+		reports = append(reports, report)
+		got = append(got, report["type"].(string))
+	}
+	require.Equal(client.t, types, got, client.owner)
+	return reports
+}
+
+// until reads reports up to and including the first of the type given.
+func (client *scriptedClient) until(typeOf string) []map[string]any {
+	var reports []map[string]any
+	for {
+		report := client.next()
+		reports = append(reports, report)
+		if report["type"] == typeOf {
+			return reports
+		}
+	}
+}
+
+// disconnect drops the connection, whatever is left unread.
+func (client *scriptedClient) disconnect() {
+	require.NoError(client.t, client.conn.Close())
+}
+
+func TestIntegration_ScriptedSessions(t *testing.T) {
+	ex := newExchange(t)
+	alice, _ := ex.logon("alice")
+	bob, _ := ex.logon("bob")
+
+	// Alice rests an offer which bob takes part of, each told of the fill.
+	ask := alice.place(Sell, 101, 10)
+	acked := alice.expect("orderAck")[0]
+	assert.Equal(t, ask, acked["clOrdId"])
+	bob.place(Buy, 101, 4)
+	fill := bob.expect("execution", "orderAck")[0]
+	assert.Equal(t, uint64(4), fill["quantity"])
+	assert.Equal(t, "alice", fill["counterparty"])
+	fill = alice.expect("execution")[0]
+	assert.Equal(t, ask, fill["clOrdId"])
+	assert.Equal(t, uint64(6), fill["leaves"])
+
+	// She pulls what is left of it, and bob bids under where it was.
+	alice.cancel(ask)
+	cancelled := alice.expect("cancelAck")[0]
+	assert.Equal(t, uint64(6), cancelled["quantity"])
+	bid := bob.place(Buy, 99, 5)
+	bob.expect("orderAck")
+
+	// Carol drops mid-order, half of it sent, without touching the book.
+	carol, _ := ex.logon("carol")
+	frame := newOrderFrame("TEST", Sell, 90, 100, 1)
+	carol.send(frame[:len(frame)/2])
+	carol.disconnect()
+
+	// Nor does bob dropping and coming back, told of his bid as he does.
+	bob.disconnect()
+	bob, reports := ex.relogon("bob")
+	require.Len(t, reports, 2)
+	assert.Equal(t, "openOrder", reports[0]["type"])
+	assert.Equal(t, bid, reports[0]["clOrdId"])
+
+	bids, asks := bob.book()
+	assert.Equal(t, []map[string]any{{"price": float64(99), "quantity": uint64(5), "orders": uint32(1)}}, bids)
+	assert.Empty(t, asks)
+
+	// Cancelling an order already gone is refused.
+	alice.cancel(ask)
+	alice.expect("cancelReject")
+}
@@ -0,0 +1,271 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+// flowSource picks each step of order flow, random or from fuzzed bytes.
+type flowSource interface {
+	Intn(n int) int
+}
+
+// byteSource picks from a fuzzed input a byte at a time, then zeros once it
+// runs out.
+type byteSource struct {
+	data []byte
+}
+
+func (source *byteSource) Intn(n int) int {
+	if len(source.data) == 0 {
+		return 0
+	}
+	b := source.data[0]
+	source.data = source.data[1:]
+	return int(b) % n
+}
+
+// bookInvariants applies order flow on "TEST" a command at a time, checking
+// after each that the book is as the orders placed, filled and cancelled say
+// it should be.
+type bookInvariants struct {
+	t      *testing.T
+	eng    *engine.Engine
+	owners []string
+
+	placed    map[string]uint64 // Quantity each order was placed for
+	filled    map[string]uint64 // Traded, as taker or maker
+	cancelled map[string]uint64 // Left when cancelled
+	uuids     []string
+}
+
+func newBookInvariants(t *testing.T, ladder int) *bookInvariants {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetPriceLadder("TEST", ladder)
+	owners := []string{"alice", "bob", "carol"}
+	for _, owner := range owners {
+		// Only so Credit reports what is reserved, never to refuse.
+		eng.SetCreditLimit(owner, 1e12)
+	}
+	return &bookInvariants{
+		t:         t,
+		eng:       eng,
+		owners:    owners,
+		placed:    make(map[string]uint64),
+		filled:    make(map[string]uint64),
+		cancelled: make(map[string]uint64),
+	}
+}
+
+// step applies a command picked by source, limit orders around 100 most of
+// the time, market orders and cancels of orders placed before now and then.
+func (inv *bookInvariants) step(source flowSource) {
+	owner := inv.owners[source.Intn(len(inv.owners))]
+	var cmd Command
+	switch kind := source.Intn(10); {
+	case kind < 2 && len(inv.uuids) > 0:
+		// Some of them long gone or someone else's.
+		cmd = cancelCommand(inv.uuids[source.Intn(len(inv.uuids))], owner)
+	default:
+		id := fmt.Sprint("o", len(inv.uuids))
+		inv.uuids = append(inv.uuids, id)
+		cmd = placeCommand(id, owner, Side(source.Intn(2)), float64(95+source.Intn(10)), uint64(1+source.Intn(20)), CommandOrigin{})
+		if kind == 2 {
+			cmd.Orders[0].OrderType = MarketOrder
+			cmd.Orders[0].LimitPrice = 0
+		}
+	}
+
+	traded := len(inv.eng.Trades)
+	orders, err := inv.eng.Apply(cmd)
+	trades := inv.eng.Trades[traded:]
+	switch {
+	case cmd.Type == CancelOwnOrderCommand && err == nil:
+		require.Len(inv.t, orders, 1)
+		inv.cancelled[orders[0].UUID] = orders[0].Quantity
+	case cmd.Type == PlaceOrderCommand && err == nil:
+		inv.placed[cmd.Orders[0].UUID] = cmd.Orders[0].Quantity
+	}
+	// Whatever is refused is refused whole.
+	if err != nil {
+		require.Empty(inv.t, trades, "%v refused having traded", cmd)
+	}
+	for _, trade := range trades {
+		inv.filled[trade.Party.UUID] += trade.MatchQty
+		inv.filled[trade.CounterParty.UUID] += trade.MatchQty
+	}
+	inv.check(trades)
+}
+
+// check asserts the invariants, given the trades the last command made.
+func (inv *bookInvariants) check(trades []Trade) {
+	t := inv.t
+	book, err := inv.eng.Book(Equities, "TEST")
+	if err != nil {
+		return
+	}
+
+	// The book is never left crossed.
+	bid, _, bidOk := book.BestBid()
+	ask, _, askOk := book.BestAsk()
+	if bidOk && askOk {
+		require.Less(t, bid, ask, "book left crossed")
+	}
+
+	// Each level holds what its orders have left, in time priority, best
+	// levels first.
+	resting := make(map[string]*Order)
+	for _, side := range []struct {
+		side   Side
+		levels *engine.PriceLevels
+		better func(a, b float64) bool
+	}{
+		{Buy, book.Bids, func(a, b float64) bool { return a > b }},
+		{Sell, book.Asks, func(a, b float64) bool { return a < b }},
+	} {
+		var last *engine.PriceLevel
+		side.levels.Scan(func(level *engine.PriceLevel) bool {
+			if last != nil {
+				require.True(t, side.better(last.PriceLevel, level.PriceLevel), "levels %v and %v out of order", last.PriceLevel, level.PriceLevel)
+			}
+			last = level
+			var quantity uint64
+			var n int
+			var prev *Order
+			level.Orders.Scan(func(order *Order) bool {
+				require.Equal(t, side.side, order.Side)
+				require.Equal(t, level.PriceLevel, order.LimitPrice)
+				require.NotZero(t, order.Quantity, "%s rests filled", order.UUID)
+				if prev != nil {
+					require.Less(t, prev.Sequence, order.Sequence, "%s queued ahead of %s", prev.UUID, order.UUID)
+				}
+				prev = order
+				quantity += order.Quantity
+				n++
+				resting[order.UUID] = order
+				return true
+			})
+			require.NotZero(t, n, "empty level left at %v", level.PriceLevel)
+			require.Equal(t, n, level.Orders.Len())
+			require.Equal(t, quantity, level.Quantity(), "level %v", level.PriceLevel)
+			return true
+		})
+	}
+
+	// Every order placed is accounted for, traded, resting or cancelled,
+	// and only those resting can be found by UUID.
+	for uuid, quantity := range inv.placed {
+		left := inv.cancelled[uuid]
+		if order, ok := resting[uuid]; ok {
+			left += order.Quantity
+			owner, found := inv.eng.OrderOwner(uuid)
+			require.True(t, found, "%s rests unindexed", uuid)
+			require.Equal(t, order.Owner, owner)
+		} else {
+			_, found := inv.eng.OrderOwner(uuid)
+			require.False(t, found, "%s indexed but not resting", uuid)
+		}
+		require.Equal(t, quantity, inv.filled[uuid]+left, "%s placed for %d", uuid, quantity)
+	}
+	for uuid := range resting {
+		require.Contains(t, inv.placed, uuid, "%s rests never having been placed", uuid)
+	}
+
+	// What each owner has reserved is what they have resting.
+	for _, owner := range inv.owners {
+		usage, ok := inv.eng.Credit(owner)
+		require.True(t, ok)
+		require.InDelta(t, inv.eng.ScanReserved(owner), usage.Reserved, 1e-6, owner)
+		require.Len(t, inv.eng.OpenOrders(owner), countOwned(resting, owner))
+	}
+
+	if len(trades) > 0 {
+		inv.checkPriority(trades, resting)
+	}
+}
+
+// checkPriority asserts a command's trades were made in price-time priority:
+// the taker worked from the best price out, through each level oldest first,
+// and left nothing resting it should have traded with before.
+func (inv *bookInvariants) checkPriority(trades []Trade, resting map[string]*Order) {
+	t := inv.t
+	taker := trades[0].Party
+	better := func(a, b float64) bool { return a < b }
+	if taker.Side == Sell {
+		better = func(a, b float64) bool { return a > b }
+	}
+
+	// Sequence of the last maker traded with at each price.
+	latest := make(map[float64]uint64)
+	for i, trade := range trades {
+		require.Equal(t, taker.UUID, trade.Party.UUID, "trades of more than one taker")
+		maker := trade.CounterParty
+		require.NotEqual(t, taker.Side, maker.Side)
+		require.Equal(t, maker.LimitPrice, trade.Price, "traded off the maker's price")
+		if i > 0 {
+			prev := trades[i-1]
+			require.False(t, better(trade.Price, prev.Price), "traded at %v after %v", trade.Price, prev.Price)
+			if trade.Price == prev.Price {
+				require.Less(t, prev.CounterParty.Sequence, maker.Sequence, "%s traded before %s", prev.CounterParty.UUID, maker.UUID)
+			}
+		}
+		latest[trade.Price] = max(latest[trade.Price], maker.Sequence)
+	}
+
+	// Nothing older, or at a better price, was passed over.
+	worst := trades[len(trades)-1].Price
+	for _, order := range resting {
+		if order.Side == taker.Side {
+			continue
+		}
+		require.False(t, better(order.LimitPrice, worst), "%s at %v passed over", order.UUID, order.LimitPrice)
+		if seq, ok := latest[order.LimitPrice]; ok && order.Sequence < seq {
+			require.Fail(t, "passed over in time priority", "%s at %v", order.UUID, order.LimitPrice)
+		}
+	}
+}
+
+func countOwned(resting map[string]*Order, owner string) int {
+	n := 0
+	for _, order := range resting {
+		if order.Owner == owner {
+			n++
+		}
+	}
+	return n
+}
+
+func TestInvariants_RandomFlow(t *testing.T) {
+	for _, ladder := range []int{0, 4} {
+		t.Run(fmt.Sprint("ladder ", ladder), func(t *testing.T) {
+			for seed := range int64(20) {
+				inv := newBookInvariants(t, ladder)
+				rng := rand.New(rand.NewSource(seed))
+				for range 300 {
+					inv.step(rng)
+				}
+				require.NotEmpty(t, inv.eng.Trades)
+			}
+		})
+	}
+}
+
+func FuzzInvariants_OrderFlow(f *testing.F) {
+	f.Add([]byte{0, 5, 0, 5, 10, 1, 5, 1, 5, 10})
+	f.Add([]byte{1, 9, 0, 9, 3, 2, 2, 1, 0, 30, 0, 0, 0})
+	f.Add([]byte("a flow of bytes, whatever they come to"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Each step checks every order placed, so flows are kept short.
+		source := &byteSource{data: data[:min(len(data), 1024)]}
+		inv := newBookInvariants(t, source.Intn(2)*4)
+		for len(source.data) > 0 {
+			inv.step(source)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"encoding/binary"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJournal_Records(t *testing.T) {
+	now := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	journal := fenrirNet.NewJournal(fixedClock{now}, 3)
+
+	journal.RecordInbound([]byte{0, 1})
+	journal.Record(fenrirNet.JournalOutbound, 1, []byte{3})
+	journal.RecordInbound([]byte{0, 2})
+
+	entries := journal.Entries(0)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, fenrirNet.JournalEntry{
+		Direction: fenrirNet.JournalInbound,
+		Sequence:  2,
+		Timestamp: now,
+		Message:   []byte{0, 2},
+	}, entries[2])
+	assert.Equal(t, entries[1:], journal.Entries(2))
+
+	// Only the latest are kept.
+	journal.Record(fenrirNet.JournalUndelivered, 2, []byte{1})
+	entries = journal.Entries(0)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, fenrirNet.JournalOutbound, entries[0].Direction)
+
+	buf, err := fenrirNet.SessionJournal{Owner: "alice", Entries: entries}.Serialize()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(fenrirNet.JournalReport), buf[0])
+	assert.Equal(t, uint32(3), binary.BigEndian.Uint32(buf[2:6]))
+	assert.Len(t, buf, fenrirNet.JournalHeaderLen+len("alice")+3*fenrirNet.JournalEntryHeaderLen+1+2+1)
+}
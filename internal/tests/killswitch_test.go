@@ -0,0 +1,81 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKillSwitch_CancelsEverything(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	reporter := &cancelReporter{cancels: make(map[string]CancelReason)}
+	auditor := &recordingAuditor{}
+	eng := engine.New(Equities)
+	eng.SetReporter(reporter)
+	eng.SetClock(fixedClock{epoch})
+	placeOwnedOrder(t, eng, "a", "AAA", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "AAA", "bob", Sell, 101.0, 10)
+	placeOwnedOrder(t, eng, "c", "BBB", "carol", Sell, 50.0, 10)
+	eng.SetAuditor(auditor)
+
+	journal := &commandRecorder{}
+	eng.SetCommandJournal(journal)
+	server := fenrirNet.New("127.0.0.1", 0, eng)
+	server.SetClock(fixedClock{epoch})
+
+	orders, err := server.PullKillSwitch("admin", CommandOrigin{}, fenrirNet.KillSwitchBlockLogons, "emergency")
+	assert.NoError(t, err)
+	assert.Len(t, orders, 3)
+	for _, book := range eng.Books {
+		assert.Empty(t, book.Bids.Items())
+		assert.Empty(t, book.Asks.Items())
+	}
+	assert.Equal(t, map[string]CancelReason{
+		"a": AdminKillSwitch,
+		"b": AdminKillSwitch,
+		"c": AdminKillSwitch,
+	}, reporter.cancels)
+
+	// Audited as pulled by the admin, ahead of the cancels it caused.
+	assert.Len(t, auditor.events, 4)
+	assert.Equal(t, KillSwitchEvent, auditor.events[0].Type)
+	assert.Equal(t, "admin", auditor.events[0].Owner)
+	assert.Equal(t, epoch, auditor.events[0].Timestamp)
+	for _, event := range auditor.events[1:] {
+		assert.Equal(t, CancelEvent, event.Type)
+		assert.Equal(t, AdminKillSwitch, event.CancelReason)
+	}
+
+	// Journaled, so replaying it cancels everything again.
+	assert.Len(t, journal.cmds, 1)
+	assert.Equal(t, KillSwitchCommand, journal.cmds[0].Type)
+	assert.Equal(t, "admin", journal.cmds[0].Owner)
+
+	status := server.ExchangeStatus()
+	assert.Equal(t, fenrirNet.ExchangeKilled, status.State)
+	assert.Equal(t, "emergency", status.Message)
+
+	// Only the kill switch kills, and resuming undoes it.
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusKilled}), fenrirNet.ErrInvalidStatusEvent)
+	assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusResumed}))
+	assert.Equal(t, fenrirNet.ExchangeOpen, server.ExchangeStatus().State)
+
+	// Without blocking logons it only halts.
+	_, err = server.PullKillSwitch("admin", CommandOrigin{}, 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, fenrirNet.ExchangeHalted, server.ExchangeStatus().State)
+}
+
+func TestKillSwitch_Report(t *testing.T) {
+	buf := fenrirNet.ExchangeStatusChange{
+		ExchangeStatus: fenrirNet.ExchangeStatus{State: fenrirNet.ExchangeKilled, Message: "emergency"},
+		Event:          fenrirNet.StatusKilled,
+	}.Serialize()
+	reports, err := fenrirNet.JSONReports(buf, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "killed", reports[0]["event"])
+	assert.Equal(t, "killed", reports[0]["state"])
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"testing"
+)
+
+// tradeKey is what two engines given the same orders should agree on about a
+// trade.
+type tradeKey struct {
+	ID       uint64
+	Taker    string
+	Maker    string
+	Price    float64
+	Quantity uint64
+}
+
+func tradeKeys(eng *engine.Engine) []tradeKey {
+	keys := make([]tradeKey, 0, len(eng.Trades))
+	for _, trade := range eng.Trades {
+		keys = append(keys, tradeKey{trade.ID, trade.Party.UUID, trade.CounterParty.UUID, trade.Price, trade.MatchQty})
+	}
+	return keys
+}
+
+func TestPriceLadder_TradesLikeTree(t *testing.T) {
+	tree := engine.New(Equities)
+	tree.SetReporter(&MockReporter{})
+	// Narrow enough for levels to come off the ladder, and for it to be moved
+	// as the price wanders.
+	ladder := engine.New(Equities)
+	ladder.SetReporter(&MockReporter{})
+	ladder.SetPriceLadder("TEST", 16)
+
+	random := rand.New(rand.NewPCG(1, 2))
+	mid := 10000 // In ticks
+	var placed []string
+	for i := range 5000 {
+		mid += random.IntN(5) - 2
+		side := Side(random.IntN(2))
+		order := Order{
+			UUID:      fmt.Sprint(i),
+			Ticker:    "TEST",
+			Side:      side,
+			OrderType: LimitOrder,
+			// Mostly near the middle, at times far off.
+			LimitPrice: float64(mid+random.IntN(21)-10+random.IntN(2)*(random.IntN(200)-100)) / 100,
+			Quantity:   uint64(1 + random.IntN(10)),
+			Owner:      "alice",
+		}
+		if random.IntN(20) == 0 {
+			order.OrderType, order.LimitPrice = MarketOrder, 0
+		}
+		order.TotalQuantity = order.Quantity
+
+		cancel := ""
+		if len(placed) > 0 && random.IntN(3) == 0 {
+			cancel = placed[random.IntN(len(placed))]
+		}
+		placed = append(placed, order.UUID)
+
+		for _, eng := range []*engine.Engine{tree, ladder} {
+			eng.CancelOrder(Equities, cancel)
+			eng.PlaceOrder(Equities, order)
+		}
+
+		treeDepth, err := tree.Depth("TEST", 1000)
+		require.NoError(t, err)
+		ladderDepth, err := ladder.Depth("TEST", 1000)
+		require.NoError(t, err)
+		require.Equal(t, treeDepth.Bids, ladderDepth.Bids, i)
+		require.Equal(t, treeDepth.Asks, ladderDepth.Asks, i)
+	}
+
+	assert.True(t, ladder.Books["TEST"].Bids.Laddered())
+	assert.Greater(t, ladder.Books["TEST"].Bids.Len(), 16)
+	assert.Equal(t, tradeKeys(tree), tradeKeys(ladder))
+	assert.NotEmpty(t, ladder.Trades)
+	assert.NoError(t, ladder.CheckIntegrity())
+	assert.NoError(t, ladder.Compact())
+}
+
+func TestPriceLadder_SetOnBook(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Buy, 98.5, 10)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Sell, 101.0, 5)
+	before, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+
+	ticker, ticks, err := engine.ParsePriceLadder("TEST:64")
+	require.NoError(t, err)
+	assert.Equal(t, 64, ticks)
+	eng.SetPriceLadder(ticker, ticks)
+	book := eng.Books["TEST"]
+	assert.True(t, book.Bids.Laddered())
+	after, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	placeOwnedOrder(t, eng, "d", "TEST", "carol", Sell, 98.0, 15)
+	assert.Len(t, eng.Trades, 2)
+	assert.Equal(t, []DepthLevel{{Price: 98.5, Quantity: 5, Orders: 1}}, mustDepth(t, eng).Bids)
+
+	eng.SetPriceLadder(ticker, 0)
+	assert.False(t, book.Bids.Laddered())
+	assert.Equal(t, []DepthLevel{{Price: 98.5, Quantity: 5, Orders: 1}}, mustDepth(t, eng).Bids)
+
+	_, ticks, err = engine.ParsePriceLadder("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, engine.DefaultLadderTicks, ticks)
+	for _, spec := range []string{"", ":64", "TEST:0", "TEST:many"} {
+		_, _, err := engine.ParsePriceLadder(spec)
+		assert.ErrorIs(t, err, engine.ErrInvalidLadder, spec)
+	}
+}
+
+func mustDepth(t *testing.T, eng *engine.Engine) BookDepth {
+	depth, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	return depth
+}
+
+// Orders taking out the top level of a deep book and putting it back, on a
+// tree and on a ladder.
+func BenchmarkPriceLadder_Match(b *testing.B) {
+	for _, ticks := range []int{0, engine.DefaultLadderTicks} {
+		b.Run(fmt.Sprintf("ticks/%d", ticks), func(b *testing.B) {
+			eng := engine.New(Equities)
+			eng.SetReporter(&MockReporter{})
+			eng.SetPriceLadder("TEST", ticks)
+			place := func(id string, side Side, price float64) {
+				eng.PlaceOrder(Equities, Order{UUID: id, Ticker: "TEST", Side: side, OrderType: LimitOrder,
+					LimitPrice: price, Quantity: 1, TotalQuantity: 1, Owner: "alice"})
+			}
+			for i := range 500 {
+				place(fmt.Sprint("b", i), Buy, float64(9999-i)/100)
+				place(fmt.Sprint("s", i), Sell, float64(10001+i)/100)
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				place(fmt.Sprint("t", i), Buy, 100.01)
+				place(fmt.Sprint("r", i), Sell, 100.01)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var histogram fenrirNet.LatencyHistogram
+	assert.Equal(t, fenrirNet.LatencyStats{Buckets: []fenrirNet.LatencyBucket{}}, histogram.Stats())
+
+	histogram.Observe(500 * time.Nanosecond)
+	for range 8 {
+		histogram.Observe(3 * time.Microsecond)
+	}
+	histogram.Observe(100 * time.Microsecond)
+	histogram.Observe(2 * time.Second)
+
+	stats := histogram.Stats()
+	assert.Equal(t, uint64(11), stats.Count)
+	assert.Equal(t, (500*time.Nanosecond+24*time.Microsecond+100*time.Microsecond+2*time.Second)/11, stats.Mean)
+	// Quantiles are as coarse as the buckets they fall in.
+	assert.Equal(t, 4*time.Microsecond, stats.P50)
+	assert.Equal(t, 128*time.Microsecond, stats.P90)
+	assert.Equal(t, 2*time.Second, stats.P99)
+	assert.Equal(t, 2*time.Second, stats.Max)
+	assert.Equal(t, []fenrirNet.LatencyBucket{
+		{UpTo: time.Microsecond, Count: 1},
+		{UpTo: 4 * time.Microsecond, Count: 8},
+		{UpTo: 128 * time.Microsecond, Count: 1},
+		{UpTo: 1 << 21 * time.Microsecond, Count: 1},
+	}, stats.Buckets)
+}
+
+func TestLatency_Echo(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	// alice logging on, then placing two orders.
+	logon, orders := records[0].Data, records[3].Data
+
+	eng := engine.New(Equities)
+	var server *fenrirNet.Server
+	conn := serve(t, eng, func(s *fenrirNet.Server) {
+		server = s
+		s.SetLatencyEcho(true)
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(logon)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus", "latency"}, reports.next(t, 3))
+
+	// Each order is answered, then followed by how long it took.
+	_, err = conn.Write(orders)
+	require.NoError(t, err)
+	var readAt []uint64
+	for _, report := range reports.reports(t, 4) {
+		if report["type"] != "latency" {
+			continue
+		}
+		assert.Equal(t, "newOrder", report["of"])
+		assert.LessOrEqual(t, report["readAt"].(uint64), report["writtenAt"].(uint64))
+		readAt = append(readAt, report["readAt"].(uint64))
+	}
+
+	// Orders are stamped as they were read off the socket.
+	var stamped []uint64
+	for _, order := range eng.OpenOrders("alice") {
+		stamped = append(stamped, uint64(order.Timestamp.UnixNano()))
+	}
+	assert.Len(t, readAt, 2)
+	assert.ElementsMatch(t, readAt, stamped)
+
+	latency := server.Stats().Latency
+	assert.Equal(t, uint64(2), latency["newOrder"].Count)
+	assert.Equal(t, uint64(1), latency["logon"].Count)
+	assert.NotZero(t, latency["newOrder"].Max)
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManualTrade(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+
+	eng := engine.New(Equities)
+	publisher := &recordingPublisher{}
+	eng.SetMarketDataPublisher(publisher)
+	placeOwnedOrder(t, eng, "ask", "TEST", "carol", Sell, 110, 10)
+	before, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	updates := len(publisher.updates)
+
+	var server *fenrirNet.Server
+	conn := serve(t, eng, func(s *fenrirNet.Server) { server = s })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	orders, err := server.BookManualTrade(ctx, "admin", "TEST", "alice", "bob", 101, 5)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, "alice", orders[0].Owner)
+	assert.Equal(t, Buy, orders[0].Side)
+	assert.Zero(t, orders[0].Quantity)
+
+	// Alice is told of it as of any fill, but that it was booked manually.
+	execution := reports.reports(t, 1)[0]
+	assert.Equal(t, "execution", execution["type"])
+	assert.Equal(t, "manual", execution["tradeType"])
+	assert.Equal(t, "none", execution["liquidity"])
+	assert.Equal(t, "bob", execution["counterparty"])
+	assert.Equal(t, 101.0, execution["price"])
+	assert.Equal(t, "FILLED", execution["orderStatus"])
+
+	// Positions move, but the book and what the market is shown do not.
+	ledger := eng.Ledger()
+	assert.Equal(t, int64(5), ledger.Positions[PositionKey{Owner: "alice", Ticker: "TEST"}])
+	assert.Equal(t, int64(-5), ledger.Positions[PositionKey{Owner: "bob", Ticker: "TEST"}])
+	after, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	assert.Equal(t, before.Asks, after.Asks)
+	assert.Empty(t, after.Bids)
+	assert.Len(t, publisher.updates, updates)
+	require.Len(t, eng.Trades, 1)
+	assert.Equal(t, ManualTrade, eng.Trades[0].Type)
+
+	_, err = server.BookManualTrade(ctx, "admin", "TEST", "alice", "alice", 101, 5)
+	assert.ErrorIs(t, err, engine.ErrInvalidManualTrade)
+	_, err = server.BookManualTrade(ctx, "admin", "NONE", "alice", "bob", 101, 5)
+	assert.ErrorIs(t, err, engine.ErrBookNotFound)
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPortfolioMargin(t *testing.T) {
+	eng := createTestPerpetualEngine(t)
+	eng.SetClock(fixedClock{now: optionsNow})
+	assert.NoError(t, eng.RegisterOption(Option{Ticker: "P100", AssetType: Equities, Underlying: "BTC", Kind: Put, Strike: 100, Expiry: optionsNow.AddDate(0, 3, 0)}))
+	assert.NoError(t, eng.Onboard(Participant{ID: "alice", CreditLimit: 1000, MarginMode: PortfolioMargin}))
+	eng.SetCreditLimit("bob", 1000)
+	eng.SetCreditLimit("carol", 600)
+
+	// Alice is long the index and short the perpetual, bob long the perpetual
+	// alone, and carol long the index and a put on it.
+	placeOwnedOrder(t, eng, "btc-ask", "BTC", "x", Sell, 100.0, 10)
+	placeOwnedOrder(t, eng, "btc-bid1", "BTC", "alice", Buy, 100.0, 5)
+	placeOwnedOrder(t, eng, "btc-bid2", "BTC", "carol", Buy, 100.0, 5)
+	placeOwnedOrder(t, eng, "perp-ask", "BTCP", "alice", Sell, 101.0, 5)
+	placeOwnedOrder(t, eng, "perp-bid", "BTCP", "bob", Buy, 101.0, 5)
+	placeOwnedOrder(t, eng, "put-ask", "P100", "x", Sell, 2.0, 5)
+	placeOwnedOrder(t, eng, "put-bid", "P100", "carol", Buy, 2.0, 5)
+
+	// The perpetual moves with its index, so alice's positions offset.
+	assert.Equal(t, PortfolioMargin, eng.MarginMode("alice"))
+	usage, _ := eng.Credit("alice")
+	assert.Zero(t, usage.Positions)
+
+	// Standard margin values each position in full, portfolio margin at the
+	// most it would lose over the scan range.
+	usage, _ = eng.Credit("bob")
+	assert.Equal(t, 505.0, usage.Positions)
+	eng.SetMarginMode("bob", PortfolioMargin)
+	usage, _ = eng.Credit("bob")
+	assert.InDelta(t, 75.0, usage.Positions, 1e-9)
+	eng.SetScanRange("BTC", 0.2)
+	usage, _ = eng.Credit("bob")
+	assert.InDelta(t, 100.0, usage.Positions, 1e-9)
+
+	// The put covers carol's fall in the index, freeing credit to buy more.
+	bid := Order{Ticker: "BTC", Owner: "carol", Side: Buy, OrderType: LimitOrder, LimitPrice: 100, Quantity: 5, TotalQuantity: 5}
+	usage, _ = eng.Credit("carol")
+	assert.Equal(t, 510.0, usage.Positions)
+	assert.ErrorIs(t, eng.CheckOrder(Equities, bid), engine.ErrCreditLimitExceeded)
+	eng.SetMarginMode("carol", PortfolioMargin)
+	usage, _ = eng.Credit("carol")
+	assert.InDelta(t, 0.0, usage.Positions, 1e-9)
+	assert.NoError(t, eng.CheckOrder(Equities, bid))
+
+	// Back on standard margin.
+	eng.SetMarginMode("carol", StandardMargin)
+	assert.Equal(t, StandardMargin, eng.MarginMode("carol"))
+	assert.ErrorIs(t, eng.CheckOrder(Equities, bid), engine.ErrCreditLimitExceeded)
+}
+
+func TestParseMarginMode(t *testing.T) {
+	mode, err := ParseMarginMode("Portfolio")
+	assert.NoError(t, err)
+	assert.Equal(t, PortfolioMargin, mode)
+	_, err = ParseMarginMode("span")
+	assert.ErrorIs(t, err, ErrInvalidMarginMode)
+
+	ranges, err := ParseScanRanges("BTC:25,AAPL:10")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"BTC": 0.25, "AAPL": 0.1}, ranges)
+	for _, spec := range []string{"BTC", ":10", "BTC:0", "BTC:x"} {
+		_, err := ParseScanRanges(spec)
+		assert.ErrorIs(t, err, ErrInvalidScanRanges, spec)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingPublisher struct {
+	updates []MarketDataUpdate
+	bbos    []BBO
+	depths  []BookDepth
+	greeks  []Greeks
+}
+
+func (p *recordingPublisher) PublishMarketData(update MarketDataUpdate) {
+	// Zero out timestamps for strict equality checking.
+	update.Timestamp = time.Time{}
+	p.updates = append(p.updates, update)
+}
+
+func (p *recordingPublisher) PublishBBO(bbo BBO) {
+	p.bbos = append(p.bbos, bbo)
+}
+
+func (p *recordingPublisher) PublishDepth(depth BookDepth) {
+	p.depths = append(p.depths, depth)
+}
+
+func (p *recordingPublisher) PublishGreeks(greeks Greeks) {
+	p.greeks = append(p.greeks, greeks)
+}
+
+func TestMarketData_IncrementalUpdates(t *testing.T) {
+	publisher := &recordingPublisher{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetMarketDataPublisher(publisher)
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 101.0, 5)
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Sell, 101.0, 6)
+	placeOwnedOrder(t, eng, "c", "TEST", "alice", Sell, 102.0, 7)
+	// Sweeps 101 and part of 102, the bid never rests so is never published.
+	placeOwnedOrder(t, eng, "d", "TEST", "bob", Buy, 102.0, 13)
+	assert.NoError(t, eng.CancelOrder(Equities, "c"))
+
+	level := func(seq uint64, typ MarketDataUpdateType, price float64, qty uint64, orders uint32) MarketDataUpdate {
+		return MarketDataUpdate{Type: typ, Ticker: "TEST", Sequence: seq, Side: Sell, Price: price, Quantity: qty, Orders: orders, PriceScale: DefaultPriceScale}
+	}
+	trade := func(seq, id uint64, price float64, qty uint64) MarketDataUpdate {
+		return MarketDataUpdate{Type: TradeUpdate, Ticker: "TEST", Sequence: seq, TradeID: id, Side: Buy, Price: price, Quantity: qty, PriceScale: DefaultPriceScale}
+	}
+	assert.Equal(t, []MarketDataUpdate{
+		level(1, LevelAdd, 101.0, 5, 1),
+		level(2, LevelModify, 101.0, 11, 2),
+		level(3, LevelAdd, 102.0, 7, 1),
+		trade(4, 1, 101.0, 5),
+		trade(5, 2, 101.0, 6),
+		trade(6, 3, 102.0, 2),
+		level(7, LevelDelete, 101.0, 0, 0),
+		level(8, LevelModify, 102.0, 5, 1),
+		level(9, LevelDelete, 102.0, 0, 0),
+	}, publisher.updates)
+
+	// Snapshots line up with the feed.
+	depth, err := eng.Depth("TEST", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), depth.Sequence)
+}
+
+func TestMarketData_BBOChanges(t *testing.T) {
+	publisher := &recordingPublisher{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetMarketDataPublisher(publisher)
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 101.0, 5)
+	// Behind the best ask, the top of book does not move.
+	placeOwnedOrder(t, eng, "b", "TEST", "alice", Sell, 102.0, 5)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Buy, 100.0, 3)
+	placeOwnedOrder(t, eng, "d", "TEST", "bob", Buy, 101.0, 5)
+
+	bbo := func(seq uint64, bidPrice float64, bidQty uint64, askPrice float64, askQty uint64) BBO {
+		return BBO{Ticker: "TEST", Sequence: seq, BidPrice: bidPrice, BidQuantity: bidQty, AskPrice: askPrice, AskQuantity: askQty, PriceScale: DefaultPriceScale}
+	}
+	assert.Equal(t, []BBO{
+		bbo(1, 0, 0, 101.0, 5),
+		bbo(3, 100.0, 3, 101.0, 5),
+		bbo(5, 100.0, 3, 102.0, 5),
+	}, publisher.bbos)
+
+	current, err := eng.BBO("TEST")
+	assert.NoError(t, err)
+	assert.Equal(t, publisher.bbos[len(publisher.bbos)-1], current)
+}
+
+func TestMarketData_LevelAggregates(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 99.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 99.0, 5)
+	placeOwnedOrder(t, eng, "c", "TEST", "carol", Buy, 98.0, 7)
+
+	// Part of a resting order, part of an incoming one, and a cancel.
+	placeOwnedOrder(t, eng, "d", "TEST", "dave", Sell, 99.0, 4)
+	placeOwnedOrder(t, eng, "e", "TEST", "erin", Sell, 99.0, 20)
+	_, err := eng.CancelOwnOrder(Equities, "carol", "c")
+	assert.NoError(t, err)
+	placeOwnedOrder(t, eng, "f", "TEST", "frank", Sell, 100.0, 3)
+
+	bids, asks := eng.Books["TEST"].Depth(10)
+	assert.Empty(t, bids)
+	assert.Equal(t, []DepthLevel{{Price: 99.0, Quantity: 9, Orders: 1}, {Price: 100.0, Quantity: 3, Orders: 1}}, asks)
+	// Which agree with the orders on them.
+	assert.NoError(t, eng.Compact())
+}
+
+func TestMarketData_TopDepthChanges(t *testing.T) {
+	publisher := &recordingPublisher{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetMarketDataPublisher(publisher)
+
+	for i := range TopDepthLevels {
+		placeOwnedOrder(t, eng, fmt.Sprint("ask", i), "TEST", "alice", Sell, 101.0+float64(i), 1)
+	}
+	assert.Len(t, publisher.depths, TopDepthLevels)
+	// Behind the top levels, nothing is published.
+	placeOwnedOrder(t, eng, "deep", "TEST", "alice", Sell, 110.0, 1)
+	assert.Len(t, publisher.depths, TopDepthLevels)
+
+	// Taking the best level brings the one behind into view.
+	placeOwnedOrder(t, eng, "bid", "TEST", "bob", Buy, 101.0, 1)
+	depth := publisher.depths[len(publisher.depths)-1]
+	assert.Len(t, publisher.depths, TopDepthLevels+1)
+	assert.Equal(t, uint64(8), depth.Sequence)
+	assert.Empty(t, depth.Bids)
+	assert.Equal(t, []DepthLevel{
+		{Price: 102.0, Quantity: 1, Orders: 1},
+		{Price: 103.0, Quantity: 1, Orders: 1},
+		{Price: 104.0, Quantity: 1, Orders: 1},
+		{Price: 105.0, Quantity: 1, Orders: 1},
+		{Price: 110.0, Quantity: 1, Orders: 1},
+	}, depth.Asks)
+
+	current, err := eng.Depth("TEST", TopDepthLevels)
+	assert.NoError(t, err)
+	assert.Equal(t, depth, current)
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/marketgen"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMarketGenerator(t *testing.T) {
+	config := marketgen.Config{Seed: 42, Tickers: []string{"AAPL", "MSFT"}, Participants: 5}
+	cmds := marketgen.New(config).Generate(2000)
+	assert.Equal(t, cmds, marketgen.New(config).Generate(2000))
+	config.Seed = 43
+	assert.NotEqual(t, cmds, marketgen.New(config).Generate(2000))
+
+	cancels := 0
+	markets := make(map[string]bool)
+	for i, cmd := range cmds {
+		assert.Equal(t, uint64(i+1), cmd.Sequence)
+		if i > 0 {
+			assert.False(t, cmd.Time.Before(cmds[i-1].Time))
+		}
+		if cmd.Type == CancelOwnOrderCommand {
+			cancels++
+		} else if cmd.Orders[0].OrderType == MarketOrder {
+			markets[cmd.Orders[0].UUID] = true
+		}
+	}
+	assert.InDelta(t, 0.3, float64(cancels)/float64(len(cmds)), 0.05)
+
+	// Replayed, the books and trades come out the same every time.
+	replay := func() *engine.Engine {
+		eng := engine.New(Equities)
+		eng.SetReporter(&MockReporter{})
+		n, err := eng.Replay(cmds)
+		assert.NoError(t, err)
+		assert.Equal(t, len(cmds), n)
+		return eng
+	}
+	first, second := replay(), replay()
+	assert.NotEmpty(t, first.Trades)
+	assert.Equal(t, first.Trades, second.Trades)
+	assert.Empty(t, engine.DiffSnapshots(first.Snapshot(), second.Snapshot()))
+
+	// Market orders take liquidity, rather than all being turned away.
+	taken := make(map[string]bool)
+	for _, trade := range first.Trades {
+		if markets[trade.Party.UUID] {
+			taken[trade.Party.UUID] = true
+		}
+	}
+	assert.NotEmpty(t, markets)
+	assert.Greater(t, len(taken), len(markets)/2)
+}
+
+func TestMarketGenerator_Drift(t *testing.T) {
+	generator := marketgen.New(marketgen.Config{Seed: 1, Drift: 50, Volatility: 0.01, Intensity: 1})
+	generator.Generate(1000)
+	// A thousand arrivals at one a second is a little over a quarter hour.
+	assert.InDelta(t, 1000, generator.Now().Sub(time.Unix(0, 0)).Seconds(), 100)
+	assert.Greater(t, generator.Price(marketgen.DefaultTicker), marketgen.DefaultStartPrice)
+}
+
+func TestParseMarketGeneratorConfig(t *testing.T) {
+	config, err := marketgen.ParseConfig("seed=7,tickers=AAPL|MSFT,intensity=500,drift=0.05,participants=20,cancels=-1")
+	assert.NoError(t, err)
+	assert.Equal(t, marketgen.Config{
+		Seed:         7,
+		Tickers:      []string{"AAPL", "MSFT"},
+		Intensity:    500,
+		Drift:        0.05,
+		Participants: 20,
+		CancelRatio:  -1,
+	}, config)
+	for _, cmd := range marketgen.New(config).Generate(100) {
+		assert.Equal(t, PlaceOrderCommand, cmd.Type)
+	}
+
+	for _, spec := range []string{"seed", "seed=x", "speed=1"} {
+		_, err := marketgen.ParseConfig(spec)
+		assert.ErrorIs(t, err, marketgen.ErrInvalidConfig, spec)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func nettingTrade(maker, taker *Order, price float64, qty uint64, at int64) Trade {
+	return Trade{Party: taker, CounterParty: maker, Price: price, MatchQty: qty, Timestamp: time.Unix(0, at)}
+}
+
+func TestNetter(t *testing.T) {
+	mmBid := &Order{Owner: "mm", Ticker: "AAPL", Side: Buy, PriceScale: DefaultPriceScale}
+	mmAsk := &Order{Owner: "mm", Ticker: "AAPL", Side: Sell, PriceScale: DefaultPriceScale}
+	mmOther := &Order{Owner: "mm", Ticker: "MSFT", Side: Sell}
+	buyer := &Order{Owner: "alice", Ticker: "AAPL", Side: Buy}
+	seller := &Order{Owner: "alice", Ticker: "AAPL", Side: Sell}
+
+	netter := fenrirNet.NewNetter("mm")
+	netter.AddTrade(nettingTrade(mmAsk, buyer, 101, 10, 1))
+	netter.AddTrade(nettingTrade(mmBid, seller, 99, 4, 2))
+	netter.AddTrade(nettingTrade(mmAsk, buyer, 102, 6, 3))
+	netter.AddTrade(nettingTrade(mmOther, buyer, 50, 1, 4))
+	// Only owners netted for are netted.
+	assert.Equal(t, []string{"mm"}, netter.Owners())
+
+	reports := netter.Take("mm")
+	assert.Equal(t, []fenrirNet.Netting{
+		{
+			Ticker:        "AAPL",
+			Fills:         3,
+			NetQuantity:   -12,
+			GrossQuantity: 20,
+			VWAP:          (101*10 + 99*4 + 102*6) / 20.0,
+			PriceScale:    DefaultPriceScale,
+			FirstFill:     time.Unix(0, 1),
+			LastFill:      time.Unix(0, 3),
+		},
+		{
+			Ticker:        "MSFT",
+			Fills:         1,
+			NetQuantity:   -1,
+			GrossQuantity: 1,
+			VWAP:          50,
+			FirstFill:     time.Unix(0, 4),
+			LastFill:      time.Unix(0, 4),
+		},
+	}, reports)
+
+	// Taken reports start afresh.
+	assert.Empty(t, netter.Owners())
+	assert.Empty(t, netter.Take("mm"))
+	netter.AddTrade(nettingTrade(mmBid, seller, 100, 2, 5))
+	assert.Equal(t, int64(2), netter.Take("mm")[0].NetQuantity)
+
+	// And convert to JSON as any other report.
+	json, err := fenrirNet.JSONReports(reports[0].Serialize(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{
+		"type":       "netting",
+		"ticker":     "AAPL",
+		"fills":      uint32(3),
+		"net":        int64(-12),
+		"gross":      uint64(20),
+		"vwap":       reports[0].VWAP,
+		"qtyScale":   uint8(0),
+		"priceScale": uint8(DefaultPriceScale),
+		"firstFill":  uint64(1),
+		"lastFill":   uint64(3),
+	}}, json)
+}
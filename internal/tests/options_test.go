@@ -0,0 +1,125 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var optionsNow = time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+func TestBlackScholes(t *testing.T) {
+	model := BlackScholes{Volatility: 0.2, Rate: 0.05}
+	call := Option{Ticker: "C100", Underlying: "AAPL", Kind: Call, Strike: 100, Expiry: optionsNow.AddDate(1, 0, 0)}
+	put := call
+	put.Ticker, put.Kind = "P100", Put
+
+	// At the money a year out, against the textbook values.
+	greeks := model.Price(call, 100, optionsNow)
+	assert.InDelta(t, 10.4506, greeks.Theo, 1e-4)
+	assert.InDelta(t, 0.6368, greeks.Delta, 1e-4)
+	assert.InDelta(t, 0.0188, greeks.Gamma, 1e-4)
+	assert.InDelta(t, 0.3752, greeks.Vega, 1e-4)
+	assert.InDelta(t, -6.4140/365, greeks.Theta, 1e-5)
+
+	greeks = model.Price(put, 100, optionsNow)
+	assert.InDelta(t, 5.5735, greeks.Theo, 1e-4)
+	assert.InDelta(t, -0.3632, greeks.Delta, 1e-4)
+	assert.InDelta(t, -1.6579/365, greeks.Theta, 1e-5)
+
+	// Once expired, only the intrinsic value is left.
+	greeks = model.Price(call, 110, call.Expiry)
+	assert.Equal(t, 10.0, greeks.Theo)
+	assert.Equal(t, 1.0, greeks.Delta)
+	assert.Zero(t, greeks.Gamma)
+	assert.Zero(t, model.Price(put, 110, call.Expiry).Theo)
+}
+
+func TestPublishGreeks(t *testing.T) {
+	publisher := &recordingPublisher{}
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{now: optionsNow})
+	eng.SetMarketDataPublisher(publisher)
+	eng.SetPricingModel(IntrinsicModel{})
+
+	expiry := optionsNow.AddDate(0, 3, 0)
+	assert.NoError(t, eng.RegisterOption(Option{Ticker: "P100", AssetType: Equities, Underlying: "AAPL", Kind: Put, Strike: 100, Expiry: expiry}))
+	assert.NoError(t, eng.RegisterOption(Option{Ticker: "C100", AssetType: Equities, Underlying: "AAPL", Kind: Call, Strike: 100, Expiry: expiry}))
+	_, err := eng.Greeks("C100")
+	assert.ErrorIs(t, err, engine.ErrNoUnderlyingPrice)
+
+	// Trading the underlying revalues both options, in ticker order.
+	placeOwnedOrder(t, eng, "ask", "AAPL", "alice", Sell, 104.0, 5)
+	placeOwnedOrder(t, eng, "bid", "AAPL", "bob", Buy, 104.0, 5)
+	assert.Equal(t, []Greeks{
+		{Ticker: "C100", Timestamp: optionsNow, UnderlyingPrice: 104, Theo: 4, Delta: 1, PriceScale: DefaultPriceScale},
+		{Ticker: "P100", Timestamp: optionsNow, UnderlyingPrice: 104, PriceScale: DefaultPriceScale},
+	}, publisher.greeks)
+
+	greeks, err := eng.Greeks("C100")
+	assert.NoError(t, err)
+	assert.Equal(t, publisher.greeks[0], greeks)
+
+	// Trading an option does not.
+	placeOwnedOrder(t, eng, "c-ask", "C100", "alice", Sell, 4.0, 1)
+	placeOwnedOrder(t, eng, "c-bid", "C100", "bob", Buy, 4.0, 1)
+	assert.Len(t, publisher.greeks, 2)
+}
+
+func TestRegisterOption(t *testing.T) {
+	eng := engine.New(Equities)
+	option := Option{Ticker: "C100", AssetType: Equities, Underlying: "AAPL", Kind: Call, Strike: 100, Expiry: optionsNow}
+	assert.NoError(t, eng.RegisterOption(option))
+	_, ok := eng.Instrument("C100")
+	assert.True(t, ok)
+	_, err := eng.Greeks("C100")
+	assert.ErrorIs(t, err, engine.ErrNoPricingModel)
+	_, err = eng.Greeks("AAPL")
+	assert.ErrorIs(t, err, engine.ErrNotAnOption)
+
+	assert.ErrorIs(t, eng.RegisterOption(option), engine.ErrInstrumentExists)
+	onOption := option
+	onOption.Ticker, onOption.Underlying = "C200", "C100"
+	assert.ErrorIs(t, eng.RegisterOption(onOption), engine.ErrInvalidUnderlying)
+	noStrike := option
+	noStrike.Ticker, noStrike.Strike = "C000", 0
+	assert.ErrorIs(t, eng.RegisterOption(noStrike), ErrInvalidOption)
+	crypto := option
+	crypto.Ticker, crypto.AssetType = "C300", Crypto
+	assert.ErrorIs(t, eng.RegisterOption(crypto), engine.ErrUnsupportedAsset)
+}
+
+func TestParseOption(t *testing.T) {
+	option, err := ParseOption(Equities, "P100:AAPL:put:99.5:2026-12-18")
+	assert.NoError(t, err)
+	assert.Equal(t, Option{
+		Ticker:     "P100",
+		AssetType:  Equities,
+		Underlying: "AAPL",
+		Kind:       Put,
+		Strike:     99.5,
+		Expiry:     time.Date(2026, 12, 18, 0, 0, 0, 0, time.UTC),
+	}, option)
+
+	for _, spec := range []string{"P100:AAPL:put:99.5", "P100:AAPL:straddle:99.5:2026-12-18", "P100:AAPL:put:-1:2026-12-18", "P100:AAPL:put:99.5:18/12/2026"} {
+		_, err := ParseOption(Equities, spec)
+		assert.ErrorIs(t, err, ErrInvalidOption, spec)
+	}
+}
+
+func TestParsePricingModel(t *testing.T) {
+	model, err := ParsePricingModel("blackscholes:25:4.5")
+	assert.NoError(t, err)
+	assert.Equal(t, BlackScholes{Volatility: 0.25, Rate: 0.045}, model)
+	model, err = ParsePricingModel("intrinsic")
+	assert.NoError(t, err)
+	assert.Equal(t, IntrinsicModel{}, model)
+
+	for _, spec := range []string{"", "blackscholes:25", "blackscholes:0:5", "blackscholes:25:x", "intrinsic:1", "binomial"} {
+		_, err := ParsePricingModel(spec)
+		assert.ErrorIs(t, err, ErrInvalidPricingModel, spec)
+	}
+}
@@ -20,11 +20,22 @@ func (r *MockReporter) ReportError(client string, err error) error {
 	return nil
 }
 
+func (r *MockReporter) ReportSymbolStatus(ticker string, status SymbolStatus) error {
+	return nil
+}
+
+func (r *MockReporter) ReportUnsolicitedCancel(order Order, reason CancelReason) error {
+	return nil
+}
+
 func createTestOrderBook() *engine.OrderBook {
 	eng := engine.New(Equities)
 	eng.SetReporter(&MockReporter{})
-	book := eng.Books[Equities]
-	return &book
+	book, err := eng.Book(Equities, "TEST")
+	if err != nil {
+		panic(err)
+	}
+	return book
 }
 
 func placeTestOrders(book *engine.OrderBook, price float64, side Side, quantities ...uint64) error {
@@ -66,6 +77,7 @@ func buildExpectedLevel(price float64, side Side, quantities ...Quantity) engine
 			LimitPrice:    price,
 			Quantity:      qty.quantity,
 			TotalQuantity: qty.totalQuantity,
+			PriceScale:    DefaultPriceScale,
 		}
 	}
 	return engine.FlatPriceLevel{
@@ -229,3 +241,186 @@ func TestPlaceOrder_Limit_MultipleLevels_WithMatchSweep_Ask(t *testing.T) {
 	}
 	assert.Equal(t, expectedBids, engine.FlattenLevels(book.Bids.Items()), "Asks should be sorted Low -> High")
 }
+
+func TestPlaceOrder_Limit_FractionalQuantity(t *testing.T) {
+	eng := engine.New(Crypto)
+	eng.SetReporter(&MockReporter{})
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "BTC", AssetType: Crypto, QuantityScale: 8}))
+	book, err := eng.Book(Crypto, "BTC")
+	assert.NoError(t, err)
+
+	// 0.5 BTC resting against a 0.125 BTC take.
+	half, err := book.Instrument.ParseQuantity("0.5")
+	assert.NoError(t, err)
+	eighth, err := book.Instrument.ParseQuantity("0.125")
+	assert.NoError(t, err)
+	assert.NoError(t, placeTestOrders(book, 100.0, Sell, half))
+	assert.NoError(t, placeTestOrders(book, 100.0, Buy, eighth))
+
+	asks := engine.FlattenLevels(book.Asks.Items())
+	assert.Len(t, asks, 1)
+	assert.Len(t, asks[0].Orders, 1)
+	assert.Equal(t, uint8(8), asks[0].Orders[0].QuantityScale)
+	assert.Equal(t, "0.37500000", book.Instrument.FormatQuantity(asks[0].Orders[0].Quantity))
+	assert.Empty(t, book.Bids.Items())
+
+	// More precision than the instrument supports is rejected.
+	_, err = book.Instrument.ParseQuantity("0.000000001")
+	assert.ErrorIs(t, err, ErrInvalidQuantity)
+}
+
+func TestPlaceOrder_Market_FractionalQuantity(t *testing.T) {
+	eng := engine.New(Crypto)
+	eng.SetReporter(&MockReporter{})
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "BTC", AssetType: Crypto, QuantityScale: 8}))
+	book, err := eng.Book(Crypto, "BTC")
+	assert.NoError(t, err)
+	quantity := func(s string) uint64 {
+		q, err := book.Instrument.ParseQuantity(s)
+		assert.NoError(t, err)
+		return q
+	}
+	market := func(side Side, s string) error {
+		return book.PlaceOrder(Order{
+			UUID:          "market-id",
+			Side:          side,
+			OrderType:     MarketOrder,
+			Quantity:      quantity(s),
+			TotalQuantity: quantity(s),
+		})
+	}
+
+	// 0.75 BTC offered over two levels, and no bids at all.
+	assert.NoError(t, placeTestOrders(book, 100.0, Sell, quantity("0.5")))
+	assert.NoError(t, placeTestOrders(book, 101.0, Sell, quantity("0.25")))
+	assert.ErrorIs(t, market(Sell, "0.00000001"), engine.ErrNotEnoughLiquidity)
+
+	// Sweeping into the second level.
+	assert.NoError(t, market(Buy, "0.6"))
+	assert.Len(t, eng.Trades, 2)
+	assert.Equal(t, quantity("0.5"), eng.Trades[0].MatchQty)
+	assert.Equal(t, quantity("0.1"), eng.Trades[1].MatchQty)
+	assert.Equal(t, 101.0, eng.Trades[1].Price)
+	asks := engine.FlattenLevels(book.Asks.Items())
+	assert.Len(t, asks, 1)
+	assert.Equal(t, "0.15000000", book.Instrument.FormatQuantity(asks[0].Orders[0].Quantity))
+
+	// What is left is all there is to take.
+	assert.ErrorIs(t, market(Buy, "0.15000001"), engine.ErrNotEnoughLiquidity)
+	assert.NoError(t, market(Buy, "0.15"))
+	assert.Empty(t, book.Asks.Items())
+	assert.Len(t, eng.Trades, 3)
+}
+
+func TestPlaceOrder_Limit_PricePrecision(t *testing.T) {
+	eng := engine.New(Crypto)
+	eng.SetReporter(&MockReporter{})
+	assert.ErrorIs(t, eng.RegisterInstrument(Instrument{Ticker: "ETH", AssetType: Crypto, PriceScale: MaxPriceScale + 1}), engine.ErrInvalidPriceScale)
+
+	inst, err := ParseInstrument(Crypto, "BTC:8:1")
+	assert.NoError(t, err)
+	assert.NoError(t, eng.RegisterInstrument(inst))
+	book, err := eng.Book(Crypto, "BTC")
+	assert.NoError(t, err)
+
+	// Prices are in tenths, so cents are too precise.
+	assert.ErrorIs(t, placeTestOrders(book, 100.25, Buy, 10), engine.ErrInvalidPricePrecision)
+	assert.Empty(t, book.Bids.Items())
+	assert.NoError(t, placeTestOrders(book, 100.2, Buy, 10))
+
+	bids := engine.FlattenLevels(book.Bids.Items())
+	assert.Len(t, bids, 1)
+	assert.Equal(t, uint8(1), bids[0].Orders[0].PriceScale)
+	assert.Equal(t, "100.2", book.Instrument.FormatPrice(bids[0].PriceLevel))
+
+	// Books created on first use are priced in cents.
+	book, err = eng.Book(Crypto, "SOL")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(DefaultPriceScale), book.Instrument.PriceScale)
+	assert.Equal(t, "99.10", FormatPrice(99.1, DefaultPriceScale))
+
+	_, err = ParseInstrument(Crypto, "BTC:8:9")
+	assert.ErrorIs(t, err, ErrInvalidInstrument)
+}
+
+func TestBestBidAsk(t *testing.T) {
+	book := createTestOrderBook()
+
+	_, _, ok := book.BestBid()
+	assert.False(t, ok)
+
+	assert.NoError(t, placeTestOrders(book, 99.0, Buy, 100, 90))
+	assert.NoError(t, placeTestOrders(book, 98.0, Buy, 50))
+	assert.NoError(t, placeTestOrders(book, 101.0, Sell, 20))
+	assert.NoError(t, placeTestOrders(book, 100.0, Sell, 10, 5))
+
+	price, qty, ok := book.BestBid()
+	assert.True(t, ok)
+	assert.Equal(t, 99.0, price)
+	assert.Equal(t, uint64(190), qty)
+
+	price, qty, ok = book.BestAsk()
+	assert.True(t, ok)
+	assert.Equal(t, 100.0, price)
+	assert.Equal(t, uint64(15), qty)
+}
+
+func TestDepth(t *testing.T) {
+	book := createTestOrderBook()
+	assert.NoError(t, placeTestOrders(book, 99.0, Buy, 100, 90))
+	assert.NoError(t, placeTestOrders(book, 98.0, Buy, 50))
+	assert.NoError(t, placeTestOrders(book, 97.0, Buy, 10))
+	assert.NoError(t, placeTestOrders(book, 101.0, Sell, 20))
+
+	bids, asks := book.Depth(2)
+	assert.Equal(t, []DepthLevel{
+		{Price: 99.0, Quantity: 190, Orders: 2},
+		{Price: 98.0, Quantity: 50, Orders: 1},
+	}, bids)
+	assert.Equal(t, []DepthLevel{
+		{Price: 101.0, Quantity: 20, Orders: 1},
+	}, asks)
+}
+
+func TestOrderStatus(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+	status, leaves := eng.OrderStatus("TEST", "a")
+	assert.Equal(t, OrderNew, status)
+	assert.Equal(t, uint64(10), leaves)
+
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100.0, 4)
+	status, leaves = eng.OrderStatus("TEST", "a")
+	assert.Equal(t, OrderPartiallyFilled, status)
+	assert.Equal(t, uint64(6), leaves)
+	status, leaves = eng.OrderStatus("TEST", "b")
+	assert.Equal(t, OrderFilled, status)
+	assert.Equal(t, uint64(0), leaves)
+}
+
+func TestRecentTrades(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+	placeOwnedOrder(t, eng, "b", "OTHR", "alice", Sell, 50.0, 10)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Buy, 100.0, 1)
+	placeOwnedOrder(t, eng, "d", "OTHR", "bob", Buy, 50.0, 2)
+	placeOwnedOrder(t, eng, "e", "TEST", "bob", Buy, 100.0, 3)
+
+	quantities := func(trades []Trade) []uint64 {
+		var qtys []uint64
+		for _, trade := range trades {
+			qtys = append(qtys, trade.MatchQty)
+		}
+		return qtys
+	}
+	// Latest trades, but oldest first.
+	assert.Equal(t, []uint64{1, 2, 3}, quantities(eng.RecentTrades("", 0)))
+	assert.Equal(t, []uint64{2, 3}, quantities(eng.RecentTrades("", 2)))
+	assert.Equal(t, []uint64{1, 3}, quantities(eng.RecentTrades("TEST", 5)))
+	assert.Equal(t, []uint64{3}, quantities(eng.RecentTrades("TEST", 1)))
+	assert.Empty(t, eng.RecentTrades("NONE", 0))
+}
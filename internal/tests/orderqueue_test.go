@@ -0,0 +1,130 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+)
+
+// levelUUIDs returns the UUIDs of the orders on the best level of levels, in
+// time priority.
+func levelUUIDs(levels *engine.PriceLevels) []string {
+	var uuids []string
+	level, ok := levels.Min()
+	if !ok {
+		return nil
+	}
+	level.Orders.Scan(func(order *Order) bool {
+		uuids = append(uuids, order.UUID)
+		return true
+	})
+	return uuids
+}
+
+func TestOrderQueue_CancelFromAnywhere(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		placeOwnedOrder(t, eng, id, "TEST", "alice", Buy, 100, 10)
+	}
+	book := eng.Books["TEST"]
+
+	for _, id := range []string{"c", "a", "e"} {
+		_, err := eng.CancelOwnOrder(Equities, "alice", id)
+		require.NoError(t, err, id)
+	}
+	assert.Equal(t, []string{"b", "d"}, levelUUIDs(book.Bids))
+	bbo, err := eng.BBO("TEST")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), bbo.BidQuantity)
+	assert.NoError(t, eng.CheckIntegrity())
+
+	// What is left still trades in time priority, and once the level is
+	// emptied it is gone.
+	placeOwnedOrder(t, eng, "f", "TEST", "bob", Sell, 100, 15)
+	assert.Equal(t, []string{"d"}, levelUUIDs(book.Bids))
+	_, err = eng.CancelOwnOrder(Equities, "alice", "d")
+	require.NoError(t, err)
+	assert.Zero(t, book.Bids.Len())
+	_, err = eng.CancelOwnOrder(Equities, "alice", "d")
+	assert.ErrorIs(t, err, engine.ErrOrderNotFound)
+	assert.NoError(t, eng.CheckIntegrity())
+}
+
+func TestOrderQueue_SharedUUIDs(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	placeOwnedOrder(t, eng, "x", "TEST", "alice", Sell, 101, 1)
+	placeOwnedOrder(t, eng, "x", "TEST", "bob", Sell, 101, 2)
+	placeOwnedOrder(t, eng, "x", "TEST", "carol", Sell, 101, 3)
+
+	// The earliest is found first, and the rest are still taken off as they
+	// fill.
+	owner, ok := eng.OrderOwner("x")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", owner)
+	_, err := eng.AdminCancelOrder("x", AdminRegulatory)
+	require.NoError(t, err)
+	placeOwnedOrder(t, eng, "y", "TEST", "dave", Buy, 101, 2)
+	owner, _ = eng.OrderOwner("x")
+	assert.Equal(t, "carol", owner)
+	assert.Equal(t, []string{"x"}, levelUUIDs(eng.Books["TEST"].Asks))
+}
+
+func TestOrderQueue_RestoresInTimePriority(t *testing.T) {
+	order := func(id string, sequence uint64) Order {
+		return Order{UUID: id, Ticker: "TEST", AssetType: Equities, Side: Buy, OrderType: LimitOrder,
+			LimitPrice: 100, Quantity: 1, TotalQuantity: 1, Owner: "alice", Sequence: sequence}
+	}
+	eng := engine.New(Equities)
+	require.NoError(t, eng.RestoreSnapshot(Snapshot{Books: []BookState{{
+		AssetType: Equities,
+		Ticker:    "TEST",
+		Orders:    []Order{order("c", 3), order("a", 1), order("d", 4), order("b", 2)},
+	}}}))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, levelUUIDs(eng.Books["TEST"].Bids))
+	assert.NoError(t, eng.CheckIntegrity())
+}
+
+// Cancels from the middle of a deep level, against the slice a level could
+// otherwise keep its orders in.
+func BenchmarkOrderQueue_Cancel(b *testing.B) {
+	for _, depth := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("queue/%d", depth), func(b *testing.B) {
+			eng := engine.New(Equities)
+			eng.SetReporter(&MockReporter{})
+			place := func(id string) {
+				eng.PlaceOrder(Equities, Order{UUID: id, Ticker: "TEST", Side: Buy, OrderType: LimitOrder,
+					LimitPrice: 100, Quantity: 1, TotalQuantity: 1, Owner: "alice"})
+			}
+			ids := make([]string, depth)
+			for i := range ids {
+				ids[i] = fmt.Sprint(i)
+				place(ids[i])
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				id := ids[(depth/2+i)%depth]
+				eng.CancelOrder(Equities, id)
+				place(id)
+			}
+		})
+		b.Run(fmt.Sprintf("slice/%d", depth), func(b *testing.B) {
+			orders := make([]*Order, depth)
+			for i := range orders {
+				orders[i] = &Order{UUID: fmt.Sprint(i)}
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				id := orders[(depth/2+i)%depth].UUID
+				at := slices.IndexFunc(orders, func(order *Order) bool { return order.UUID == id })
+				order := orders[at]
+				orders = append(slices.Delete(orders, at, at+1), order)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/participants"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+type recordingOnboarder struct {
+	onboarded []Participant
+}
+
+func (o *recordingOnboarder) Onboard(participant Participant) error {
+	o.onboarded = append(o.onboarded, participant)
+	return nil
+}
+
+func TestParticipants_RegisterPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "participants.json")
+	carol := Participant{
+		ID:               "carol",
+		Secret:           "s3cret",
+		Entitlements:     MarketMakerEntitlement,
+		MaxOrderQuantity: 100,
+		FeeTier:          2,
+	}
+
+	onboarder := &recordingOnboarder{}
+	registry, err := participants.Open(path, onboarder)
+	assert.NoError(t, err)
+	assert.Empty(t, registry.Participants())
+
+	// Usable straight away, without reopening.
+	assert.NoError(t, registry.Register(carol))
+	assert.Equal(t, []Participant{carol}, onboarder.onboarded)
+
+	assert.ErrorIs(t, registry.Register(carol), participants.ErrParticipantExists)
+	assert.ErrorIs(t, registry.Register(Participant{ID: "dave"}), participants.ErrInvalidParticipant)
+	assert.ErrorIs(t, registry.Register(Participant{ID: "da:ve", Secret: "x"}), participants.ErrInvalidParticipant)
+
+	// And still there after a restart.
+	onboarder = &recordingOnboarder{}
+	registry, err = participants.Open(path, onboarder)
+	assert.NoError(t, err)
+	assert.Equal(t, []Participant{carol}, registry.Participants())
+	assert.Equal(t, []Participant{carol}, onboarder.onboarded)
+}
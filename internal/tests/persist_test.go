@@ -0,0 +1,58 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestGTC_SaveRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gtc.json")
+
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	for i, tif := range []TimeInForce{GoodTillCancel, Day, GoodTillCancel} {
+		assert.NoError(t, eng.PlaceOrder(Equities, Order{
+			UUID:          string(rune('a' + i)),
+			Ticker:        "TEST",
+			Side:          Sell,
+			OrderType:     LimitOrder,
+			TimeInForce:   tif,
+			LimitPrice:    100.0,
+			Quantity:      10,
+			TotalQuantity: 10,
+			Owner:         "alice",
+		}))
+	}
+	assert.NoError(t, eng.SaveGTC(path))
+
+	restored := engine.New(Equities)
+	restored.SetReporter(&MockReporter{})
+	assert.NoError(t, restored.RestoreGTC(path))
+
+	// Only GTC orders come back, in their original priority.
+	open := restored.OpenOrders("alice")
+	assert.Len(t, open, 2)
+	assert.Equal(t, "a", open[0].UUID)
+	assert.Equal(t, "c", open[1].UUID)
+
+	// New orders queue behind the restored ones.
+	assert.NoError(t, restored.PlaceOrder(Equities, Order{
+		UUID:          "d",
+		Ticker:        "TEST",
+		Side:          Sell,
+		OrderType:     LimitOrder,
+		LimitPrice:    100.0,
+		Quantity:      10,
+		TotalQuantity: 10,
+		Owner:         "alice",
+	}))
+	open = restored.OpenOrders("alice")
+	assert.Equal(t, "d", open[2].UUID)
+	assert.Greater(t, open[2].Sequence, open[1].Sequence)
+
+	// Nothing saved yet is not an error.
+	assert.NoError(t, engine.New(Equities).RestoreGTC(filepath.Join(t.TempDir(), "missing.json")))
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func restingFills(quantities ...uint64) []engine.Fill {
+	var resting []engine.Fill
+	for _, qty := range quantities {
+		resting = append(resting, engine.Fill{Maker: &Order{Quantity: qty}, Quantity: qty})
+	}
+	return resting
+}
+
+func TestPolicy_FIFO(t *testing.T) {
+	resting := restingFills(5, 10, 20)
+	fills := engine.FIFOPolicy{}.Allocate(resting, 12)
+	assert.Equal(t, []engine.Fill{
+		{Maker: resting[0].Maker, Quantity: 5},
+		{Maker: resting[1].Maker, Quantity: 7},
+	}, fills)
+}
+
+func TestPolicy_RandomIsSeeded(t *testing.T) {
+	resting := restingFills(5, 10, 20, 40)
+	first := engine.NewRandomPolicy(42).Allocate(resting, 50)
+	second := engine.NewRandomPolicy(42).Allocate(resting, 50)
+	assert.Equal(t, first, second)
+
+	total := uint64(0)
+	for _, fill := range first {
+		total += fill.Quantity
+		assert.LessOrEqual(t, fill.Quantity, fill.Maker.Quantity)
+	}
+	assert.Equal(t, uint64(50), total)
+
+	// Asking for more than is there fills everything exactly once.
+	all := engine.NewRandomPolicy(7).Allocate(resting, 1000)
+	assert.Len(t, all, len(resting))
+}
+
+func TestPolicy_RandomIsSizeWeighted(t *testing.T) {
+	resting := restingFills(10, 90)
+	policy := engine.NewRandomPolicy(1)
+
+	bigFirst := 0
+	for range 1000 {
+		if policy.Allocate(resting, 1)[0].Maker == resting[1].Maker {
+			bigFirst++
+		}
+	}
+	assert.InDelta(t, 900, bigFirst, 60)
+}
+
+func TestPolicy_RandomInBook(t *testing.T) {
+	run := func() [][2]any {
+		eng := engine.New(Equities)
+		eng.SetReporter(&MockReporter{})
+		eng.SetMatchPolicy(engine.NewRandomPolicy(3))
+		placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+		placeOwnedOrder(t, eng, "b", "TEST", "bob", Sell, 100.0, 10)
+		placeOwnedOrder(t, eng, "c", "TEST", "carol", Sell, 100.0, 10)
+		placeOwnedOrder(t, eng, "d", "TEST", "dave", Buy, 100.0, 15)
+		return makerFills(eng)
+	}
+	fills := run()
+	assert.Equal(t, fills, run())
+
+	total := uint64(0)
+	for _, fill := range fills {
+		total += fill[1].(uint64)
+	}
+	assert.Equal(t, uint64(15), total)
+}
+
+func TestPolicy_ProRata(t *testing.T) {
+	resting := restingFills(10, 30, 60)
+	assert.Equal(t, []engine.Fill{
+		{Maker: resting[0].Maker, Quantity: 5},
+		{Maker: resting[1].Maker, Quantity: 15},
+		{Maker: resting[2].Maker, Quantity: 30},
+	}, engine.ProRataPolicy{}.Allocate(resting, 50))
+
+	// Rounded down to 0, 2 and 4, the lot left over going in time priority.
+	assert.Equal(t, []engine.Fill{
+		{Maker: resting[0].Maker, Quantity: 1},
+		{Maker: resting[1].Maker, Quantity: 2},
+		{Maker: resting[2].Maker, Quantity: 4},
+	}, engine.ProRataPolicy{}.Allocate(resting, 7))
+	// Shares under the minimum are given to the front of the queue instead.
+	assert.Equal(t, []engine.Fill{
+		{Maker: resting[0].Maker, Quantity: 3},
+		{Maker: resting[2].Maker, Quantity: 4},
+	}, engine.ProRataPolicy{MinAllocation: 3}.Allocate(resting, 7))
+
+	assert.Len(t, engine.ProRataPolicy{}.Allocate(resting, 1000), len(resting))
+}
+
+func TestPolicy_ProRataInstrument(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	ticker, policy, err := engine.ParseProRata("TEST:2")
+	assert.NoError(t, err)
+	assert.Equal(t, engine.ProRataPolicy{MinAllocation: 2}, policy)
+	// Before its book is made.
+	eng.SetInstrumentPolicy(ticker, policy)
+
+	for _, ticker := range []string{"TEST", "FIFO"} {
+		placeOwnedOrder(t, eng, ticker+"a", ticker, "alice", Sell, 100.0, 10)
+		placeOwnedOrder(t, eng, ticker+"b", ticker, "bob", Sell, 100.0, 30)
+		placeOwnedOrder(t, eng, ticker+"c", ticker, "carol", Sell, 100.0, 60)
+		placeOwnedOrder(t, eng, ticker+"d", ticker, "dave", Buy, 100.0, 50)
+	}
+	assert.Equal(t, [][2]any{
+		{"TESTa", uint64(5)}, {"TESTb", uint64(15)}, {"TESTc", uint64(30)},
+		{"FIFOa", uint64(10)}, {"FIFOb", uint64(30)}, {"FIFOc", uint64(10)},
+	}, makerFills(eng))
+
+	for _, spec := range []string{"", ":2", "TEST:two"} {
+		_, _, err := engine.ParseProRata(spec)
+		assert.ErrorIs(t, err, engine.ErrInvalidProRata, spec)
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+)
+
+// cancelCommand cancels owner's order uuid on "TEST".
+func cancelCommand(uuid, owner string) Command {
+	return Command{Type: CancelOwnOrderCommand, AssetType: Equities, Owner: owner, UUID: uuid}
+}
+
+func TestPool_ReusedOrdersAndLevels(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	// Once cancelled, the order is handed back whole, and the level it was on
+	// and its entry are free to be reused by the next command.
+	_, err := eng.Apply(placeCommand("a", "alice", Buy, 99, 5, CommandOrigin{}))
+	require.NoError(t, err)
+	cancelled, err := eng.Apply(cancelCommand("a", "alice"))
+	require.NoError(t, err)
+	require.Len(t, cancelled, 1)
+	assert.Equal(t, "a", cancelled[0].UUID)
+	assert.Equal(t, uint64(5), cancelled[0].Quantity)
+
+	_, err = eng.Apply(placeCommand("b", "bob", Buy, 101, 3, CommandOrigin{}))
+	require.NoError(t, err)
+	depth, err := eng.Depth("TEST", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []DepthLevel{{Price: 101, Quantity: 3, Orders: 1}}, depth.Bids)
+	open := eng.OpenOrders("bob")
+	require.Len(t, open, 1)
+	assert.Equal(t, "b", open[0].UUID)
+	assert.Empty(t, eng.OpenOrders("alice"))
+}
+
+func TestPool_TradesKeepTheirOrders(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	_, err := eng.Apply(placeCommand("m", "bob", Sell, 100, 10, CommandOrigin{}))
+	require.NoError(t, err)
+	_, err = eng.Apply(placeCommand("t", "alice", Buy, 100, 4, CommandOrigin{}))
+	require.NoError(t, err)
+	_, err = eng.Apply(cancelCommand("m", "bob"))
+	require.NoError(t, err)
+
+	// Orders and levels coming and going after don't touch the orders
+	// which traded, as the trade still points at them.
+	for i := range 100 {
+		id := fmt.Sprint(i)
+		_, err = eng.Apply(placeCommand(id, "carol", Side(i%2), 50+float64(i%2)*100+float64(i%7), 1, CommandOrigin{}))
+		require.NoError(t, err)
+		_, err = eng.Apply(cancelCommand(id, "carol"))
+		require.NoError(t, err)
+	}
+
+	require.Len(t, eng.Trades, 1)
+	trade := eng.Trades[0]
+	assert.Equal(t, "t", trade.Party.UUID)
+	assert.Equal(t, uint64(0), trade.Party.Quantity)
+	assert.Equal(t, "m", trade.CounterParty.UUID)
+	assert.Equal(t, "bob", trade.CounterParty.Owner)
+	assert.Equal(t, uint64(6), trade.CounterParty.Quantity)
+	assert.Equal(t, uint64(10), trade.CounterParty.TotalQuantity)
+}
+
+// BenchmarkPool_PlaceCancel places and cancels orders over a spread of levels,
+// each emptied as its order is cancelled. Commands applied reuse the entries
+// and levels taken off, those called directly on the engine leave them to the
+// garbage collector.
+func BenchmarkPool_PlaceCancel(b *testing.B) {
+	const levels = 256
+	for _, pooled := range []bool{true, false} {
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			eng := engine.New(Equities)
+			eng.SetReporter(&MockReporter{})
+			cmds := make([][2]Command, levels)
+			for i := range cmds {
+				id := fmt.Sprint(i)
+				cmds[i] = [2]Command{placeCommand(id, "alice", Buy, float64(100+i), 1, CommandOrigin{}), cancelCommand(id, "alice")}
+			}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				place, cancel := cmds[i%levels][0], cmds[i%levels][1]
+				if pooled {
+					eng.Apply(place)
+					eng.Apply(cancel)
+				} else {
+					eng.PlaceOrder(Equities, place.Orders[0])
+					eng.CancelOrder(Equities, cancel.UUID)
+				}
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.NumGC-before.NumGC)*1e6/float64(b.N), "gcs/Mop")
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPositionLimit(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetPositionLimit(DefaultPositionAccount, "AAPL", PositionLimit{MaxLong: 10, MaxShort: 5})
+	eng.SetPositionLimit("bob", "AAPL", PositionLimit{MaxShort: 20})
+
+	// Resting bids count as though filled.
+	placeOwnedOrder(t, eng, "bid1", "AAPL", "alice", Buy, 100.0, 6)
+	err := eng.PlaceOrder(Equities, Order{UUID: "bid2", Ticker: "AAPL", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 100, Quantity: 5, TotalQuantity: 5})
+	assert.ErrorIs(t, err, engine.ErrPositionLimitExceeded)
+	assert.Equal(t, RejectPositionLimit, RejectReasonOf(err))
+	placeOwnedOrder(t, eng, "bid3", "AAPL", "alice", Buy, 99.0, 4)
+
+	// Bob's own limit lets him further short than everyone else.
+	placeOwnedOrder(t, eng, "ask1", "AAPL", "bob", Sell, 99.0, 8)
+	assert.Len(t, eng.Trades, 2)
+	assert.Equal(t, int64(-8), eng.Ledger().Positions[PositionKey{Owner: "bob", Ticker: "AAPL"}])
+
+	// Alice is now 8 long with 2 bid, so may only sell down to 5 short.
+	assert.ErrorIs(t, eng.CheckOrder(Equities, Order{Ticker: "AAPL", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 98, Quantity: 1, TotalQuantity: 1}), engine.ErrPositionLimitExceeded)
+	assert.NoError(t, eng.CheckOrder(Equities, Order{Ticker: "AAPL", Owner: "alice", Side: Sell, OrderType: LimitOrder, LimitPrice: 101, Quantity: 13, TotalQuantity: 13}))
+	assert.ErrorIs(t, eng.CheckOrder(Equities, Order{Ticker: "AAPL", Owner: "alice", Side: Sell, OrderType: LimitOrder, LimitPrice: 101, Quantity: 14, TotalQuantity: 14}), engine.ErrPositionLimitExceeded)
+	// Other tickers are not limited.
+	assert.NoError(t, eng.CheckOrder(Equities, Order{Ticker: "MSFT", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 100, Quantity: 100, TotalQuantity: 100}))
+
+	// Onboarding replaces a participant's limits.
+	assert.NoError(t, eng.Onboard(Participant{ID: "alice", PositionLimits: map[string]PositionLimit{"AAPL": {MaxLong: 20}, "MSFT": {MaxLong: 50}}}))
+	assert.NoError(t, eng.CheckOrder(Equities, Order{Ticker: "AAPL", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 98, Quantity: 1, TotalQuantity: 1}))
+	assert.ErrorIs(t, eng.CheckOrder(Equities, Order{Ticker: "MSFT", Owner: "alice", Side: Buy, OrderType: LimitOrder, LimitPrice: 100, Quantity: 100, TotalQuantity: 100}), engine.ErrPositionLimitExceeded)
+}
+
+func TestParsePositionLimits(t *testing.T) {
+	limits, err := ParsePositionLimits("*:AAPL:1000:500,alice:AAPL::2000")
+	assert.NoError(t, err)
+	assert.Equal(t, map[PositionKey]PositionLimit{
+		{Owner: "*", Ticker: "AAPL"}:     {MaxLong: 1000, MaxShort: 500},
+		{Owner: "alice", Ticker: "AAPL"}: {MaxShort: 2000},
+	}, limits)
+
+	for _, spec := range []string{"alice:AAPL:1000", ":AAPL:1:1", "alice::1:1", "alice:AAPL:-1:1", "alice:AAPL:1:x"} {
+		_, err := ParsePositionLimits(spec)
+		assert.ErrorIs(t, err, ErrInvalidPositionLimits, spec)
+	}
+}
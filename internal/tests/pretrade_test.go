@@ -0,0 +1,54 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPreTrade_RiskLimits(t *testing.T) {
+	eng := engine.New(Equities, Crypto)
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "BTC", AssetType: Crypto, QuantityScale: 8, PriceScale: 2}))
+	server := fenrirNet.New("127.0.0.1", 0, eng)
+	limits, err := fenrirNet.ParseRiskLimits("*:1000:50000:5,alice:::,bob::1000000:,dave::50000:")
+	assert.NoError(t, err)
+	server.SetRiskLimits(limits)
+	prices, err := fenrirNet.ParseReferencePrices("AAPL:100")
+	assert.NoError(t, err)
+	server.SetReferencePrices(prices)
+
+	order := func(owner, ticker string, orderType OrderType, price float64, qty uint64) Order {
+		return Order{Owner: owner, Ticker: ticker, Side: Buy, OrderType: orderType, LimitPrice: price, Quantity: qty, TotalQuantity: qty}
+	}
+	assert.NoError(t, server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 105, 400)))
+	assert.ErrorIs(t, server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 100, 1001)), fenrirNet.ErrMaxQuantityExceeded)
+	assert.ErrorIs(t, server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 100, 501)), fenrirNet.ErrMaxNotionalExceeded)
+	// Market orders are priced at the reference.
+	assert.ErrorIs(t, server.CheckRiskLimits(order("carol", "AAPL", MarketOrder, 0, 501)), fenrirNet.ErrMaxNotionalExceeded)
+	err = server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 94, 10))
+	assert.ErrorIs(t, err, fenrirNet.ErrPriceOutsideCollar)
+	assert.Equal(t, RejectPriceCollar, RejectReasonOf(err))
+	assert.Contains(t, err.Error(), "94 is 6.00% from 100, limit 5.00%")
+
+	// Notional is in whole units, not lots.
+	assert.NoError(t, server.CheckRiskLimits(order("dave", "BTC", LimitOrder, 60000, 50_000_000)))
+	assert.ErrorIs(t, server.CheckRiskLimits(order("dave", "BTC", LimitOrder, 60000, 90_000_000)), fenrirNet.ErrMaxNotionalExceeded)
+
+	// Accounts with their own limits are only held to those.
+	assert.NoError(t, server.CheckRiskLimits(order("alice", "AAPL", LimitOrder, 200, 5000)))
+	assert.NoError(t, server.CheckRiskLimits(order("bob", "AAPL", LimitOrder, 50, 5000)))
+
+	// Once traded, orders are collared around the last trade instead.
+	eng.SetReporter(server)
+	placeOwnedOrder(t, eng, "00000000-0000-0000-0000-00000000000a", "AAPL", "alice", Sell, 120, 1)
+	placeOwnedOrder(t, eng, "00000000-0000-0000-0000-00000000000b", "AAPL", "bob", Buy, 120, 1)
+	assert.NoError(t, server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 125, 10)))
+	assert.ErrorIs(t, server.CheckRiskLimits(order("carol", "AAPL", LimitOrder, 105, 10)), fenrirNet.ErrPriceOutsideCollar)
+
+	_, err = fenrirNet.ParseRiskLimits("alice:10:20")
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidRiskLimits)
+	_, err = fenrirNet.ParseReferencePrices("AAPL:-1")
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidRiskLimits)
+}
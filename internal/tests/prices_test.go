@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/prices"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// manualSource hands its publish function to the test to call.
+type manualSource struct {
+	name      string
+	published chan func(ticker string, price float64)
+}
+
+func newManualSource(name string) *manualSource {
+	return &manualSource{name: name, published: make(chan func(string, float64), 1)}
+}
+
+func (source *manualSource) Name() string {
+	return source.name
+}
+
+func (source *manualSource) Run(ctx context.Context, publish func(ticker string, price float64)) error {
+	source.published <- publish
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type indexPrice struct {
+	ticker string
+	price  float64
+}
+
+type recordingIndexSink struct {
+	prices []indexPrice
+}
+
+func (sink *recordingIndexSink) SetIndexPrice(ctx context.Context, ticker string, price float64) error {
+	sink.prices = append(sink.prices, indexPrice{ticker, price})
+	return nil
+}
+
+func TestIngester_Failover(t *testing.T) {
+	primary, backup := newManualSource("primary"), newManualSource("backup")
+	sink := &recordingIndexSink{}
+	clock := &tickingClock{now: time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)}
+	ing := prices.NewIngester(sink, 10*time.Second, primary, backup)
+	ing.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ing.Run(ctx)
+	fromPrimary, fromBackup := <-primary.published, <-backup.published
+
+	// The preferred source is used while it is fresh.
+	fromPrimary("BTC", 100)
+	fromBackup("BTC", 101)
+	assert.Equal(t, []indexPrice{{"BTC", 100}}, sink.prices)
+
+	// Once stale, the backup is failed over to.
+	clock.now = clock.now.Add(11 * time.Second)
+	fromBackup("BTC", 102)
+	assert.Equal(t, []indexPrice{{"BTC", 100}, {"BTC", 102}}, sink.prices)
+	price, source, ok := ing.Price("BTC")
+	assert.True(t, ok)
+	assert.Equal(t, 102.0, price)
+	assert.Equal(t, "backup", source)
+
+	// With every source stale there is no price, until one is fresh again.
+	clock.now = clock.now.Add(11 * time.Second)
+	ing.Check(ctx)
+	assert.Equal(t, indexPrice{"BTC", 0}, sink.prices[2])
+	_, _, ok = ing.Price("BTC")
+	assert.False(t, ok)
+	fromPrimary("BTC", 103)
+	assert.Equal(t, indexPrice{"BTC", 103}, sink.prices[3])
+	assert.Len(t, sink.prices, 4)
+}
+
+func TestRESTSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"BTC": 64000.5}`))
+	}))
+	defer server.Close()
+
+	source, err := prices.ParseSource("rest:"+server.URL, time.Second)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := make(chan indexPrice, 1)
+	go source.Run(ctx, func(ticker string, price float64) {
+		published <- indexPrice{ticker, price}
+	})
+	assert.Equal(t, indexPrice{"BTC", 64000.5}, <-published)
+}
+
+func TestWebSocketSource(t *testing.T) {
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Anything not a price is skipped.
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "hello"}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"ticker": "ETH", "price": 3100.25}`))
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	source, err := prices.ParseSource("ws:ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := make(chan indexPrice, 1)
+	go source.Run(ctx, func(ticker string, price float64) {
+		published <- indexPrice{ticker, price}
+	})
+	assert.Equal(t, indexPrice{"ETH", 3100.25}, <-published)
+
+	for _, spec := range []string{"https://example.com", "grpc:https://example.com", "ws:not a url"} {
+		_, err := prices.ParseSource(spec, time.Second)
+		assert.ErrorIs(t, err, prices.ErrInvalidSource, spec)
+	}
+}
+
+func TestSetIndexPrice(t *testing.T) {
+	eng := createTestPerpetualEngine(t)
+	eng.SetCreditLimit("bob", 1000)
+	placeOwnedOrder(t, eng, "ask", "BTCP", "alice", Sell, 102.0, 5)
+	placeOwnedOrder(t, eng, "bid", "BTCP", "bob", Buy, 102.0, 5)
+
+	// The index only priced from outside the exchange.
+	_, err := eng.Fund("BTCP")
+	assert.ErrorIs(t, err, engine.ErrNoFundingPrice)
+	eng.SetIndexPrice("BTC", 101)
+	price, ok := eng.IndexPrice("BTC")
+	assert.True(t, ok)
+	assert.Equal(t, 101.0, price)
+	funding, err := eng.Fund("BTCP")
+	assert.NoError(t, err)
+	assert.Equal(t, 101.0, funding.IndexPrice)
+
+	// Positions are marked at the index price over the last trade.
+	eng.SetIndexPrice("BTCP", 110)
+	usage, _ := eng.Credit("bob")
+	assert.Equal(t, 550.0, usage.Positions)
+	eng.SetIndexPrice("BTCP", 0)
+	usage, _ = eng.Credit("bob")
+	assert.Equal(t, 510.0, usage.Positions)
+}
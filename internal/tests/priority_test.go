@@ -0,0 +1,53 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// makerFills returns how much each maker was filled, in the order trades
+// happened.
+func makerFills(eng *engine.Engine) [][2]any {
+	var fills [][2]any
+	for _, trade := range eng.Trades {
+		fills = append(fills, [2]any{trade.CounterParty.UUID, trade.MatchQty})
+	}
+	return fills
+}
+
+func TestPriority_MarketMakerAllocation(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	assert.NoError(t, eng.SetPriorityClass("mm", MarketMakerClass))
+	assert.NoError(t, eng.SetAllocation(MarketMakerClass, 40))
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 50)
+	placeOwnedOrder(t, eng, "b", "TEST", "mm", Sell, 100.0, 50)
+	placeOwnedOrder(t, eng, "c", "TEST", "bob", Sell, 100.0, 50)
+
+	// The market maker takes 24 of the 60 first, the rest goes by time.
+	placeOwnedOrder(t, eng, "d", "TEST", "carol", Buy, 100.0, 60)
+	assert.Equal(t, [][2]any{{"b", uint64(24)}, {"a", uint64(36)}}, makerFills(eng))
+
+	// The market maker takes 20 of the 50, alice's last 14 go next by time.
+	// The market maker is next in time as well, so is filled in a single trade.
+	eng.Trades = nil
+	placeOwnedOrder(t, eng, "e", "TEST", "carol", Buy, 100.0, 50)
+	assert.Equal(t, [][2]any{{"b", uint64(26)}, {"a", uint64(14)}, {"c", uint64(10)}}, makerFills(eng))
+
+	// An allocation the market maker can not use falls back to time priority.
+	eng.Trades = nil
+	placeOwnedOrder(t, eng, "f", "TEST", "mm", Sell, 100.0, 5)
+	placeOwnedOrder(t, eng, "g", "TEST", "carol", Buy, 100.0, 40)
+	assert.Equal(t, [][2]any{{"f", uint64(5)}, {"c", uint64(35)}}, makerFills(eng))
+}
+
+func TestPriority_Config(t *testing.T) {
+	eng := engine.New(Equities)
+	assert.ErrorIs(t, eng.SetPriorityClass("mm", NumPriorityClasses), engine.ErrInvalidPriorityClass)
+	assert.ErrorIs(t, eng.SetAllocation(StandardClass, 10), engine.ErrInvalidPriorityClass)
+	assert.ErrorIs(t, eng.SetAllocation(MarketMakerClass, 101), engine.ErrInvalidAllocation)
+	assert.NoError(t, eng.SetAllocation(MarketMakerClass, 100))
+}
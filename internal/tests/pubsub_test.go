@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestPubSub(t *testing.T) {
+	ps := fenrirNet.NewPubSub()
+	defer ps.RemoveAll()
+
+	// Hundreds of subscribers to the one symbol, and one to everything.
+	var clients []net.Conn
+	for range 200 {
+		server, client := net.Pipe()
+		sub := ps.Add(server)
+		ps.Subscribe(sub, fenrirNet.BBOChannel, "AAPL")
+		clients = append(clients, client)
+	}
+	server, everything := net.Pipe()
+	sub := ps.Add(server)
+	ps.Subscribe(sub, fenrirNet.BBOChannel, fenrirNet.AllTickers)
+	ps.Subscribe(sub, fenrirNet.TradesChannel, fenrirNet.AllTickers)
+
+	ps.Publish(fenrirNet.BBOChannel, "AAPL", []byte("aapl1"))
+	ps.Publish(fenrirNet.BBOChannel, "MSFT", []byte("msft1"))
+	ps.Publish(fenrirNet.DepthChannel, "AAPL", []byte("depth"))
+	ps.Publish(fenrirNet.TradesChannel, "AAPL", []byte("trade"))
+	ps.Publish(fenrirNet.BBOChannel, "AAPL", []byte("aapl2"))
+
+	for _, client := range clients {
+		buf := make([]byte, 10)
+		_, err := io.ReadFull(client, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "aapl1aapl2", string(buf))
+	}
+	buf := make([]byte, 20)
+	_, err := io.ReadFull(everything, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "aapl1msft1tradeaapl2", string(buf))
+
+	// Unsubscribed, nothing more is sent.
+	ps.Unsubscribe(sub, fenrirNet.BBOChannel, fenrirNet.AllTickers)
+	ps.Publish(fenrirNet.BBOChannel, "AAPL", []byte("aapl3"))
+	ps.Publish(fenrirNet.TradesChannel, "MSFT", []byte("trade"))
+	buf = make([]byte, 5)
+	_, err = io.ReadFull(everything, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "trade", string(buf))
+
+	// Removed, the connection is closed.
+	ps.Remove(sub)
+	_, err = everything.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPubSub_Lapped(t *testing.T) {
+	ps := fenrirNet.NewPubSub()
+	defer ps.RemoveAll()
+	server, client := net.Pipe()
+	ps.Subscribe(ps.Add(server), fenrirNet.TradesChannel, "AAPL")
+
+	// A subscriber not reading while the ring goes all the way around is
+	// disconnected, whatever it got through before.
+	first := []byte("trade")
+	for range fenrirNet.FanoutRingLen + 2 {
+		ps.Publish(fenrirNet.TradesChannel, "AAPL", first)
+	}
+	read, err := io.ReadAll(client)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(read), len(first))
+	assert.True(t, bytes.HasPrefix(first, read))
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInputQueue(t *testing.T) {
+	for name, want := range map[string]fenrirNet.OverflowPolicy{
+		"block":      fenrirNet.BlockOnOverflow,
+		"Reject":     fenrirNet.RejectOnOverflow,
+		"dropoldest": fenrirNet.DropOldestOnOverflow,
+	} {
+		policy, err := fenrirNet.ParseOverflowPolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, policy)
+	}
+	_, err := fenrirNet.ParseOverflowPolicy("drop")
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidOverflowPolicy)
+
+	server := fenrirNet.New("127.0.0.1", 0, nil)
+	assert.Equal(t, fenrirNet.InputQueueMetrics{Capacity: fenrirNet.DefaultInputQueueDepth}, server.InputQueueMetrics())
+	server.SetInputQueue(64, fenrirNet.RejectOnOverflow)
+	assert.Equal(t, 64, server.InputQueueMetrics().Capacity)
+	server.SetInputQueue(0, fenrirNet.BlockOnOverflow)
+	assert.Equal(t, 1, server.InputQueueMetrics().Capacity)
+
+	assert.Equal(t, RejectEngineBusy, RejectReasonOf(fenrirNet.ErrEngineBusy))
+	assert.Equal(t, "ENGINE_BUSY", RejectEngineBusy.String())
+}
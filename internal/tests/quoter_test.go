@@ -0,0 +1,47 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/quoter"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQuoter_QuotesAndReplenishes(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	symbol, err := quoter.ParseSymbol("TEST:100:1:10")
+	assert.NoError(t, err)
+	q, err := quoter.New(eng, quoter.DefaultOwner, symbol)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Replenish())
+
+	bbo, err := eng.BBO("TEST")
+	assert.NoError(t, err)
+	assert.Equal(t, 99.5, bbo.BidPrice)
+	assert.Equal(t, uint64(10), bbo.BidQuantity)
+	assert.Equal(t, 100.5, bbo.AskPrice)
+	assert.Equal(t, uint64(10), bbo.AskQuantity)
+
+	// Lifting part of the offer is topped back up.
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Buy, 100.5, 4)
+	assert.NoError(t, q.Replenish())
+	bbo, _ = eng.BBO("TEST")
+	assert.Equal(t, uint64(10), bbo.AskQuantity)
+
+	// A quote is good for the size asked for.
+	quote, err := q.Quote("TEST", 25)
+	assert.NoError(t, err)
+	assert.Equal(t, Quote{Ticker: "TEST", BidPrice: 99.5, AskPrice: 100.5, Quantity: 25, PriceScale: DefaultPriceScale}, quote)
+	bbo, _ = eng.BBO("TEST")
+	assert.Equal(t, uint64(25), bbo.BidQuantity)
+	assert.Equal(t, uint64(25), bbo.AskQuantity)
+
+	_, err = q.Quote("NONE", 1)
+	assert.ErrorIs(t, err, quoter.ErrNotQuoted)
+
+	_, err = quoter.New(eng, quoter.DefaultOwner, quoter.Symbol{Ticker: "BAD", Mid: 100, Size: 1})
+	assert.ErrorIs(t, err, quoter.ErrInvalidSymbol)
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"context"
+	"encoding/hex"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	bucket := fenrirNet.NewTokenBucket(10, 3)
+
+	// A full burst is admitted at once, then nothing until tokens come back.
+	for range 3 {
+		assert.True(t, bucket.Allow(now))
+	}
+	assert.False(t, bucket.Allow(now))
+	assert.Equal(t, 100*time.Millisecond, bucket.RetryAfter())
+	now = now.Add(50 * time.Millisecond)
+	assert.False(t, bucket.Allow(now))
+	assert.Equal(t, 50*time.Millisecond, bucket.RetryAfter())
+	now = now.Add(50 * time.Millisecond)
+	assert.True(t, bucket.Allow(now))
+	assert.False(t, bucket.Allow(now))
+
+	// Idling refills no further than the burst.
+	now = now.Add(time.Minute)
+	for range 3 {
+		assert.True(t, bucket.Allow(now))
+	}
+	assert.False(t, bucket.Allow(now))
+	assert.Equal(t, RejectThrottled, RejectReasonOf(fenrirNet.ErrSessionThrottled))
+}
+
+func TestRateLimit_FlowControl(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	// alice logging on, then placing two orders at once.
+	logon, orders := records[0].Data, records[3].Data
+
+	// Only the logon and one order are let through, then a message a minute.
+	conn := serve(t, engine.New(Equities), func(server *fenrirNet.Server) {
+		server.SetMessageRate(1.0/60, 2)
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(logon)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// The second order is rejected, and alice told when to send another.
+	// It is rejected as it is read, so may be answered before the first.
+	_, err = conn.Write(orders)
+	require.NoError(t, err)
+	answered := make(map[string]map[string]any)
+	for _, report := range reports.reports(t, 3) {
+		answered[report["type"].(string)] = report
+	}
+	assert.Len(t, answered, 3)
+	assert.Contains(t, answered, "orderAck")
+	assert.Equal(t, "session sending messages too fast", answered["error"]["error"])
+	flow := answered["flowControl"]
+	assert.Equal(t, "sessionThrottled", flow["state"])
+	assert.Equal(t, "newOrder", flow["priority"])
+	assert.Equal(t, map[string]int{"query": 0, "newOrder": 0, "cancel": -1}, flow["remaining"])
+	retryAfter := time.Duration(flow["retryAfter"].(map[string]int64)["newOrder"])
+	assert.InDelta(t, time.Minute, retryAfter, float64(time.Second))
+}
+
+func TestRateLimit_WebSocket(t *testing.T) {
+	// WebSocket sessions are limited as TCP ones are, and told so the same.
+	var server *fenrirNet.Server
+	startServer(t, engine.New(Equities), func(s *fenrirNet.Server) {
+		s.SetMessageRate(1.0/60, 2)
+		server = s
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go fenrirNet.NewGateway("127.0.0.1", port, server, fenrirNet.NewFeed("127.0.0.1", 0)).Run(ctx)
+
+	var ws *websocket.Conn
+	require.Eventually(t, func() bool {
+		ws, _, err = websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { ws.Close() })
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	read := func() map[string]any {
+		var report map[string]any
+		require.NoError(t, ws.ReadJSON(&report))
+		return report
+	}
+
+	timestamp := uint64(time.Now().UnixNano())
+	require.NoError(t, ws.WriteJSON(map[string]any{
+		"type":      "logon",
+		"username":  "alice",
+		"timestamp": timestamp,
+		"signature": hex.EncodeToString(fenrirNet.SignLogon("alice", timestamp, "")),
+	}))
+	assert.Equal(t, "session", read()["type"])
+	assert.Equal(t, "exchangeStatus", read()["type"])
+
+	// The second order is rejected as it is read, so may be answered first.
+	for clOrdID := range 2 {
+		require.NoError(t, ws.WriteJSON(map[string]any{
+			"type": "newOrder", "ticker": "TEST", "side": "buy", "price": 99, "quantity": 10, "clOrdId": clOrdID + 1,
+		}))
+	}
+	answered := make(map[string]map[string]any)
+	for range 3 {
+		report := read()
+		answered[report["type"].(string)] = report
+	}
+	assert.Len(t, answered, 3)
+	assert.Contains(t, answered, "orderAck")
+	assert.Equal(t, "session sending messages too fast", answered["error"]["error"])
+	assert.Equal(t, "sessionThrottled", answered["flowControl"]["state"])
+	assert.Equal(t, "newOrder", answered["flowControl"]["priority"])
+}
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLiveness(t *testing.T) {
+	start := time.Unix(1000, 0)
+	idle := 10 * time.Second
+	var liveness fenrirNet.Liveness
+	liveness.Seen(start)
+
+	assert.Equal(t, fenrirNet.Alive, liveness.Check(start.Add(9*time.Second), idle))
+	assert.Equal(t, start.Add(10*time.Second), liveness.Due(idle))
+	// Quiet connections are probed once, then given as long again to answer.
+	assert.Equal(t, fenrirNet.Probe, liveness.Check(start.Add(10*time.Second), idle))
+	assert.Equal(t, start.Add(20*time.Second), liveness.Due(idle))
+	assert.Equal(t, fenrirNet.Alive, liveness.Check(start.Add(15*time.Second), idle))
+	assert.Equal(t, fenrirNet.Dead, liveness.Check(start.Add(20*time.Second), idle))
+
+	// Answering the probe, or anything else, keeps it alive.
+	liveness.Seen(start.Add(21 * time.Second))
+	assert.Equal(t, fenrirNet.Alive, liveness.Check(start.Add(30*time.Second), idle))
+	assert.Equal(t, fenrirNet.Probe, liveness.Check(start.Add(31*time.Second), idle))
+}
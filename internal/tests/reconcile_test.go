@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"fenrir/internal/audit"
+	"fenrir/internal/backoffice"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcile_MatchesAuditTrail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// An earlier run in the same file is not part of this run's ledger.
+	earlier, err := audit.Open(path)
+	assert.NoError(t, err)
+	old := engine.New(Equities)
+	old.SetReporter(&MockReporter{})
+	old.SetAuditor(earlier)
+	placeOwnedOrder(t, old, "x", "TEST", "alice", Sell, 100.0, 50)
+	placeOwnedOrder(t, old, "y", "TEST", "bob", Buy, 100.0, 50)
+	assert.NoError(t, earlier.Close())
+
+	auditLog, err := audit.Open(path)
+	assert.NoError(t, err)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetAuditor(auditLog)
+
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.0, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100.0, 4)
+	placeOwnedOrder(t, eng, "c", "TEST", "carol", Buy, 100.0, 6)
+
+	assert.Equal(t, map[PositionKey]int64{
+		{Owner: "alice", Ticker: "TEST"}: -10,
+		{Owner: "bob", Ticker: "TEST"}:   4,
+		{Owner: "carol", Ticker: "TEST"}: 6,
+	}, eng.Ledger().Positions)
+
+	reconciler := backoffice.NewReconciler(eng, path)
+	discrepancies, err := reconciler.Reconcile()
+	assert.NoError(t, err)
+	assert.Empty(t, discrepancies)
+
+	// Lose carol's trade from storage.
+	assert.NoError(t, auditLog.Close())
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var kept []string
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		if !strings.Contains(line, `"TRADE"`) || !strings.Contains(line, `"orderId":"c"`) {
+			kept = append(kept, line)
+		}
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(kept, "\n")+"\n"), 0o644))
+
+	discrepancies, err = reconciler.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, []backoffice.Discrepancy{
+		{Kind: backoffice.PositionDiscrepancy, Owner: "carol", Ticker: "TEST", Hot: 6, Stored: 0},
+		{Kind: backoffice.TradeCountDiscrepancy, Ticker: "TEST", Hot: 2, Stored: 1},
+	}, discrepancies)
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type tradeCounter struct {
+	MockReporter
+	trades int
+}
+
+func (r *tradeCounter) ReportTrade(trade Trade, err error) error {
+	r.trades++
+	return nil
+}
+
+func TestRecover_SnapshotAndJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir-snapshot.json")
+	live := engine.New(Equities)
+	live.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	live.SetCommandJournal(journal)
+
+	apply := func(cmds ...Command) {
+		for i, cmd := range cmds {
+			_, err := live.Apply(cmd)
+			assert.NoError(t, err, i)
+		}
+	}
+	apply(
+		placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}),
+		placeCommand("b", "bob", Sell, 101, 5, CommandOrigin{Session: "bob", Sequence: 1}),
+	)
+	assert.NoError(t, engine.SaveSnapshot(path, live.Snapshot()))
+	apply(
+		placeCommand("c", "bob", Buy, 99, 5, CommandOrigin{Session: "bob", Sequence: 2}),
+		placeCommand("d", "carol", Sell, 99, 12, CommandOrigin{Session: "carol", Sequence: 1}),
+		placeCommand("e", "quoter", Sell, 102, 5, CommandOrigin{}),
+		Command{Origin: CommandOrigin{Session: "bob", Sequence: 3}, Type: CancelOwnOrderCommand, AssetType: Equities, Owner: "bob", UUID: "b"},
+	)
+
+	snap, err := engine.LoadSnapshot(path)
+	assert.NoError(t, err)
+	reporter := &tradeCounter{}
+	recovered := engine.New(Equities)
+	recovered.SetReporter(reporter)
+	n, err := recovered.Recover(snap, journal.cmds)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	// Exactly as it was, down to the timestamps, without reporting anything
+	// again.
+	want, err := json.Marshal(live.Snapshot().Books)
+	assert.NoError(t, err)
+	got, err := json.Marshal(recovered.Snapshot().Books)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got))
+	assert.Equal(t, live.ReplayMarkers(), recovered.ReplayMarkers())
+	assert.Zero(t, reporter.trades)
+	assert.Empty(t, recovered.Ledger().Positions)
+
+	// Sequences carry on where they left off.
+	_, err = recovered.Apply(placeCommand("f", "alice", Sell, 99, 1, CommandOrigin{Session: "alice", Sequence: 2}))
+	assert.NoError(t, err)
+	_, err = live.Apply(placeCommand("f", "alice", Sell, 99, 1, CommandOrigin{Session: "alice", Sequence: 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, live.Trades[len(live.Trades)-1].ID, recovered.Trades[len(recovered.Trades)-1].ID)
+	assert.Equal(t, live.ReplayMarkers(), recovered.ReplayMarkers())
+}
+
+func TestRecover_JournalGap(t *testing.T) {
+	live := engine.New(Equities)
+	live.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	live.SetCommandJournal(journal)
+	for i := range 4 {
+		_, err := live.Apply(placeCommand(string(rune('a'+i)), "alice", Buy, 99, 1, CommandOrigin{}))
+		assert.NoError(t, err)
+	}
+	snap := live.Snapshot()
+
+	// A journal starting after the snapshot is missing what came in between,
+	// one ending before it is from some other run.
+	_, err := engine.New(Equities).Recover(Snapshot{}, journal.cmds[2:])
+	assert.ErrorIs(t, err, engine.ErrJournalGap)
+	snap.Markers.Sequence = 10
+	_, err = engine.New(Equities).Recover(snap, journal.cmds)
+	assert.ErrorIs(t, err, engine.ErrJournalGap)
+}
+
+// servedEngine is what serve serves, an engine or shards of them.
+type servedEngine interface {
+	fenrirNet.Engine
+	SetReporter(reporter engine.Reporter)
+}
+
+// serve runs a server for eng on a free port, returning a connection to it.
+func serve(t *testing.T, eng servedEngine, configure ...func(server *fenrirNet.Server)) net.Conn {
+	return dial(t, startServer(t, eng, configure...))
+}
+
+// startServer runs a server for eng on a free port until the test ends,
+// returning its address.
+func startServer(t *testing.T, eng servedEngine, configure ...func(server *fenrirNet.Server)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	server := fenrirNet.New("127.0.0.1", port, eng)
+	eng.SetReporter(server)
+	for _, configure := range configure {
+		configure(server)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.Run(ctx)
+	return listener.Addr().String()
+}
+
+// dial connects to the server on address, once it is listening, until the
+// test ends.
+func dial(t *testing.T, address string) net.Conn {
+	var conn net.Conn
+	var err error
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", address)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// reportReader reads reports off a connection, however they are split across
+// reads.
+type reportReader struct {
+	conn net.Conn
+	read []byte // Of reports not yet returned
+}
+
+// next reads the next n reports, returning their types.
+func (r *reportReader) next(t *testing.T, n int) []string {
+	var types []string
+	for _, report := range r.reports(t, n) {
+		types = append(types, report["type"].(string))
+	}
+	return types
+}
+
+// reports reads the next n reports, as JSON would have them.
+func (r *reportReader) reports(t *testing.T, n int) []map[string]any {
+	for {
+		// Reports split across reads fail to decode until the rest comes.
+		if reports, err := fenrirNet.JSONReports(r.read, true); err == nil && len(reports) >= n {
+			r.read = nil
+			return reports
+		}
+		buf := make([]byte, 4096)
+		n, err := r.conn.Read(buf)
+		require.NoError(t, err)
+		r.read = append(r.read, buf[:n]...)
+	}
+}
+
+func TestRecover_SessionCarriesOn(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	// alice logging on, then placing two orders, each 50 bytes long.
+	logon, orders := records[0].Data, records[3].Data
+	require.Len(t, orders, 2*50)
+
+	// Sends alice's orders on a fresh server over eng, their client order IDs
+	// moved on by clOrdIDs, returning what they are answered with. She is told
+	// of the orders she has resting as she logs on.
+	place := func(eng *engine.Engine, clOrdIDs uint64, resting int) []string {
+		conn := serve(t, eng)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		reports := &reportReader{conn: conn}
+		_, err := conn.Write(logon)
+		require.NoError(t, err)
+		// Orders sent before the logon is accepted would be refused.
+		logonReports := reports.next(t, 2+resting)
+		assert.Equal(t, "session", logonReports[0])
+		assert.Equal(t, "exchangeStatus", logonReports[len(logonReports)-1])
+
+		moved := bytes.Clone(orders)
+		for offset := 0; offset < len(moved); offset += 50 {
+			id := moved[offset+36 : offset+44]
+			binary.BigEndian.PutUint64(id, binary.BigEndian.Uint64(id)+clOrdIDs)
+		}
+		_, err = conn.Write(moved)
+		require.NoError(t, err)
+		return reports.next(t, 2)
+	}
+
+	live := engine.New(Equities)
+	assert.Equal(t, []string{"orderAck", "orderAck"}, place(live, 0, 0))
+	assert.Equal(t, uint64(3), live.SessionMarker("alice").Sequence)
+
+	// Restarted from a snapshot, alice's new session numbers its commands on
+	// from those applied before, rather than having them refused as already
+	// applied.
+	restarted := engine.New(Equities)
+	require.NoError(t, restarted.RestoreSnapshot(live.Snapshot()))
+	assert.Equal(t, []string{"orderAck", "orderAck"}, place(restarted, 100, 2))
+	assert.Equal(t, uint64(6), restarted.SessionMarker("alice").Sequence)
+	assert.Len(t, restarted.OpenOrders("alice"), 4)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReject_Reasons(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		reason RejectReason
+	}{
+		{engine.ErrBookNotFound, RejectUnknownSymbol},
+		{engine.ErrNotEnoughLiquidity, RejectInsufficientLiquidity},
+		{engine.ErrInvalidPricePrecision, RejectInvalidTick},
+		{engine.ErrSymbolThrottled, RejectThrottled},
+		{fenrirNet.ErrRiskRejected, RejectRiskBreach},
+		{fenrirNet.ErrExchangeHalted, RejectTradingHalted},
+		{fenrirNet.ErrNotLoggedOn, RejectNotEntitled},
+		{fenrirNet.ErrInternal, RejectInternalError},
+		// Wrapping keeps the reason, and the sentinel.
+		{fmt.Errorf("%w: AAPL", fenrirNet.ErrZeroQuantity), RejectInvalidQuantity},
+		{errors.New("something else"), RejectUnspecified},
+	} {
+		assert.Equal(t, test.reason, RejectReasonOf(test.err), test.err.Error())
+	}
+	assert.ErrorIs(t, fmt.Errorf("%w: AAPL", engine.ErrBookNotFound), engine.ErrBookNotFound)
+	assert.NotErrorIs(t, engine.ErrBookNotFound, engine.ErrNotEnoughLiquidity)
+	assert.Equal(t, "order book not found", engine.ErrBookNotFound.Error())
+}
+
+func TestReject_ErrorReport(t *testing.T) {
+	err := fmt.Errorf("%w: ZZZZ", engine.ErrBookNotFound)
+	buf, serr := fenrirNet.Report{
+		MessageType:  fenrirNet.ErrorReport,
+		Timestamp:    1234,
+		RejectReason: RejectReasonOf(err),
+		ErrStrLen:    uint32(len(err.Error())),
+		Err:          err.Error(),
+	}.Serialize()
+	assert.NoError(t, serr)
+
+	reports, jerr := fenrirNet.JSONReports(buf, false)
+	assert.NoError(t, jerr)
+	assert.Equal(t, []map[string]any{{
+		"type":      "error",
+		"timestamp": uint64(1234),
+		"reason":    "unknownSymbol",
+		"error":     "order book not found: ZZZZ",
+	}}, reports)
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/wal"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// randomFlow applies n commands of random order flow on "TEST", crossing often
+// and cancelling now and then.
+func randomFlow(eng *engine.Engine, rng *rand.Rand, n int) {
+	owners := []string{"alice", "bob", "carol"}
+	var placed []string
+	for i := range n {
+		owner := owners[rng.Intn(len(owners))]
+		var cmd Command
+		switch {
+		case len(placed) > 0 && rng.Intn(5) == 0:
+			cmd = Command{Type: AdminCancelOrderCommand, UUID: placed[rng.Intn(len(placed))], Reason: AdminRiskBreach}
+		default:
+			id := fmt.Sprint("o", i)
+			placed = append(placed, id)
+			cmd = placeCommand(id, owner, Side(rng.Intn(2)), float64(95+rng.Intn(10)), uint64(1+rng.Intn(20)), CommandOrigin{})
+		}
+		// Refusals are journaled and replayed all the same.
+		eng.Apply(cmd)
+	}
+}
+
+func TestReplay_MatchesLiveRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir.wal")
+	log, err := wal.Open(path, wal.SyncNever, 0)
+	require.NoError(t, err)
+
+	var tape bytes.Buffer
+	recorder := engine.NewTradeTape(&tape)
+	live := engine.New(Equities)
+	live.SetReporter(&MockReporter{})
+	live.SetClock(fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+	live.SetCommandJournal(log)
+	live.SetTradeRecorder(recorder, 0)
+	randomFlow(live, rand.New(rand.NewSource(1)), 500)
+	require.NoError(t, log.Close())
+	require.NoError(t, recorder.Flush())
+	require.NotEmpty(t, live.Trades)
+
+	cmds, err := wal.Read(path)
+	require.NoError(t, err)
+	setup := func() *engine.Engine { return engine.New(Equities) }
+	replayed, err := engine.ReplayFresh(setup, Snapshot{}, cmds)
+	require.NoError(t, err)
+
+	// The live run's books and trades, whether taken from the engine or as
+	// they were taped, are the replay's byte for byte.
+	state, err := live.ReplayState()
+	require.NoError(t, err)
+	assert.NoError(t, replayed.Check(state))
+	assert.NoError(t, engine.CheckTape(replayed.Tape, tape.Bytes()))
+	assert.Equal(t, len(live.Trades), bytes.Count(replayed.Tape, []byte("\n")))
+
+	// Replaying again comes to the same.
+	again, err := engine.ReplayFresh(setup, Snapshot{}, cmds)
+	require.NoError(t, err)
+	assert.NoError(t, again.Check(replayed))
+}
+
+func TestReplay_FindsDivergence(t *testing.T) {
+	live := engine.New(Equities)
+	journal := &commandRecorder{}
+	live.SetReporter(&MockReporter{})
+	live.SetCommandJournal(journal)
+	randomFlow(live, rand.New(rand.NewSource(2)), 200)
+	state, err := live.ReplayState()
+	require.NoError(t, err)
+
+	// A single order placed for more than it was throws it off.
+	cmds := journal.cmds
+	for i, cmd := range cmds {
+		if cmd.Type == PlaceOrderCommand {
+			cmd.Orders = []Order{cmd.Orders[0]}
+			cmd.Orders[0].Quantity++
+			cmd.Orders[0].TotalQuantity++
+			cmds[i] = cmd
+			break
+		}
+	}
+	replayed, err := engine.ReplayFresh(func() *engine.Engine { return engine.New(Equities) }, Snapshot{}, cmds)
+	require.NoError(t, err)
+	assert.ErrorIs(t, replayed.Check(state), engine.ErrReplayDiverged)
+
+	// Tapes differing only in their last trade are told apart too.
+	err = engine.CheckTape([]byte("a\nb\nc\n"), []byte("a\nb\nd\n"))
+	assert.ErrorIs(t, err, engine.ErrReplayDiverged)
+	assert.ErrorContains(t, err, "trade 3")
+}
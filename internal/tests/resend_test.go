@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"encoding/binary"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOutboundStore_NumbersAndResends(t *testing.T) {
+	store := fenrirNet.NewOutboundStore(3)
+
+	for i := range 5 {
+		numbered := store.Add([]byte{byte(i)})
+		assert.Equal(t, uint64(i+1), binary.BigEndian.Uint64(numbered))
+		assert.Equal(t, []byte{byte(i)}, numbered[fenrirNet.SequenceHeaderLen:])
+	}
+	assert.Equal(t, uint64(5), store.Sequence())
+
+	// Resent with their original numbers.
+	reports, err := store.From(4)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, uint64(4), binary.BigEndian.Uint64(reports[0]))
+
+	reports, err = store.From(6)
+	assert.NoError(t, err)
+	assert.Empty(t, reports)
+
+	// Only the latest 3 are kept, whatever is left is still resent.
+	reports, err = store.From(1)
+	assert.ErrorIs(t, err, fenrirNet.ErrResendUnavailable)
+	assert.Len(t, reports, 3)
+	assert.Equal(t, uint64(3), binary.BigEndian.Uint64(reports[0]))
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubRiskChecker answers by client order id: 1 accepts, 2 rejects, 3 is too
+// slow and anything else fails.
+type stubRiskChecker struct{}
+
+func (stubRiskChecker) CheckOrder(ctx context.Context, owner string, order fenrirNet.NewOrderMessage) error {
+	switch order.ClOrdID {
+	case 1:
+		return nil
+	case 2:
+		return fenrirNet.ErrRiskRejected
+	case 3:
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return errors.New("connection refused")
+}
+
+func riskOrders(clOrdIDs ...uint64) []fenrirNet.NewOrderMessage {
+	var orders []fenrirNet.NewOrderMessage
+	for _, id := range clOrdIDs {
+		orders = append(orders, fenrirNet.NewOrderMessage{Ticker: "AAPL", Side: Buy, LimitPrice: 100, Quantity: 10, ClOrdID: id})
+	}
+	return orders
+}
+
+func TestRiskGate(t *testing.T) {
+	closed := fenrirNet.NewRiskGate(stubRiskChecker{}, 10*time.Millisecond, fenrirNet.RiskFailClosed)
+	start := time.Now()
+	errs := closed.Check(context.Background(), "alice", riskOrders(1, 2, 3, 4))
+	// Orders are checked at once, each within its own budget.
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], fenrirNet.ErrRiskRejected)
+	assert.ErrorIs(t, errs[2], fenrirNet.ErrRiskUnavailable)
+	assert.ErrorIs(t, errs[2], context.DeadlineExceeded)
+	assert.ErrorIs(t, errs[3], fenrirNet.ErrRiskUnavailable)
+
+	// Failing open places orders the service could not say either way on, but
+	// never ones it rejected.
+	open := fenrirNet.NewRiskGate(stubRiskChecker{}, 10*time.Millisecond, fenrirNet.RiskFailOpen)
+	errs = open.Check(context.Background(), "alice", riskOrders(1, 2, 3, 4))
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], fenrirNet.ErrRiskRejected)
+	assert.NoError(t, errs[2])
+	assert.NoError(t, errs[3])
+}
+
+func TestHTTPRiskChecker(t *testing.T) {
+	var got map[string]any
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		switch got["clOrdId"] {
+		case 1.0:
+			w.WriteHeader(http.StatusOK)
+		case 2.0:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason": "credit limit breached"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer service.Close()
+	checker := fenrirNet.HTTPRiskChecker{URL: service.URL}
+
+	order := riskOrders(1)[0]
+	order.Ticker = "BT\x00\x00"
+	assert.NoError(t, checker.CheckOrder(context.Background(), "alice", order))
+	assert.Equal(t, "alice", got["owner"])
+	assert.Equal(t, "BT", got["ticker"])
+	assert.Equal(t, "buy", got["side"])
+	assert.Equal(t, 100.0, got["price"])
+
+	err := checker.CheckOrder(context.Background(), "alice", riskOrders(2)[0])
+	assert.ErrorIs(t, err, fenrirNet.ErrRiskRejected)
+	assert.ErrorContains(t, err, "credit limit breached")
+
+	err = checker.CheckOrder(context.Background(), "alice", riskOrders(3)[0])
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, fenrirNet.ErrRiskRejected)
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTradingCalendar(t *testing.T) {
+	calendar, err := ParseTradingCalendar("equities=08:00/09:30/16:00")
+	require.NoError(t, err)
+	assert.Equal(t, CalendarScope{AssetType: Equities}, calendar.Scope)
+
+	// Tuesday.
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, PhaseClosed, calendar.Phase(day.Add(7*time.Hour)))
+	assert.Equal(t, PhasePreOpen, calendar.Phase(day.Add(8*time.Hour)))
+	assert.Equal(t, PhaseContinuous, calendar.Phase(day.Add(9*time.Hour+30*time.Minute)))
+	assert.Equal(t, PhaseClosed, calendar.Phase(day.Add(16*time.Hour)))
+
+	next, phase := calendar.Next(day.Add(9 * time.Hour))
+	assert.Equal(t, day.Add(9*time.Hour+30*time.Minute), next)
+	assert.Equal(t, PhaseContinuous, phase)
+	next, phase = calendar.Next(day.Add(9*time.Hour + 30*time.Minute))
+	assert.Equal(t, day.Add(16*time.Hour), next)
+	assert.Equal(t, PhaseClosed, phase)
+
+	// Friday's close is followed by Monday's pre-open.
+	friday := time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC)
+	assert.Equal(t, PhaseClosed, calendar.Phase(time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC)))
+	next, phase = calendar.Next(friday)
+	assert.Equal(t, time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC), next)
+	assert.Equal(t, PhasePreOpen, phase)
+
+	// Without a pre-open it opens straight from closed.
+	calendar, err = ParseTradingCalendar("TEST=09:30/16:00")
+	require.NoError(t, err)
+	assert.Equal(t, CalendarScope{Ticker: "TEST"}, calendar.Scope)
+	assert.Equal(t, PhaseClosed, calendar.Phase(day.Add(9*time.Hour)))
+	next, phase = calendar.Next(day.Add(9 * time.Hour))
+	assert.Equal(t, day.Add(9*time.Hour+30*time.Minute), next)
+	assert.Equal(t, PhaseContinuous, phase)
+
+	for _, spec := range []string{"equities", "equities=16:00/09:30", "equities=09:30", "TOOLONG=09:30/16:00", "TEST=9.30/16:00"} {
+		_, err := ParseTradingCalendar(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// tradingPhaseOverride puts the symbols of scope in phase.
+func tradingPhaseOverride(scope CalendarScope, phase TradingPhase) []byte {
+	buf := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.TradingPhaseOverrideHeaderLen)
+	binary.BigEndian.PutUint16(buf[0:2], uint16(fenrirNet.TradingPhaseOverride))
+	buf[2] = byte(phase)
+	buf[3] = byte(scope.AssetType)
+	copy(buf[4:8], scope.Ticker)
+	return buf
+}
+
+func TestSchedule_HoldsOrdersForTheOpen(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	calendar, err := ParseTradingCalendar("AAPL=08:00/09:30/16:00")
+	require.NoError(t, err)
+
+	// In pre-open.
+	eng := engine.New(Equities)
+	conn := serve(t, eng, func(s *fenrirNet.Server) {
+		s.SetClock(fixedClock{time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)})
+		s.SetTradingCalendars(calendar)
+		s.SetQueuePreOpen(true)
+		s.SetAdmins("alice")
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// The order is acknowledged, but held off the book.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	ack := reports.reports(t, 1)[0]
+	assert.Equal(t, "orderAck", ack["type"])
+	assert.Equal(t, "NEW", ack["status"])
+	assert.Equal(t, ack["quantity"], ack["leaves"])
+	assert.Empty(t, eng.OpenOrders("alice"))
+
+	// Held orders may be cancelled.
+	cancel := make([]byte, fenrirNet.BaseMessageHeaderLen+fenrirNet.CancelOrderMessageHeaderLen)
+	binary.BigEndian.PutUint16(cancel[0:2], uint16(fenrirNet.CancelOrder))
+	copy(cancel[4:4+fenrirNet.UUIDLen], ack["uuid"].(string))
+	_, err = conn.Write(cancel)
+	require.NoError(t, err)
+	cancelled := reports.reports(t, 1)[0]
+	assert.Equal(t, "cancelAck", cancelled["type"])
+	assert.Equal(t, ack["quantity"], cancelled["quantity"])
+
+	// Those held as the symbol closes are cancelled, and orders refused.
+	aapl := CalendarScope{Ticker: "AAPL"}
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orderAck"}, reports.next(t, 1))
+	_, err = conn.Write(tradingPhaseOverride(aapl, PhaseClosed))
+	require.NoError(t, err)
+	closed := reports.reports(t, 2)
+	assert.Equal(t, "unsolicitedCancel", closed[0]["type"])
+	assert.Equal(t, "marketClosed", closed[0]["reason"])
+	assert.Equal(t, "symbolStatus", closed[1]["type"])
+	assert.Equal(t, "closed", closed[1]["status"])
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	refused := reports.reports(t, 1)[0]
+	assert.Equal(t, "error", refused["type"])
+	assert.Contains(t, refused["error"], fenrirNet.ErrSymbolClosed.Error())
+
+	// Put back on its calendar, it is in pre-open again, and whatever is held
+	// is placed as it opens.
+	_, err = conn.Write(tradingPhaseOverride(aapl, fenrirNet.PhaseScheduled))
+	require.NoError(t, err)
+	reopened := reports.reports(t, 1)[0]
+	assert.Equal(t, "preOpen", reopened["status"])
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orderAck"}, reports.next(t, 1))
+	_, err = conn.Write(tradingPhaseOverride(aapl, PhaseContinuous))
+	require.NoError(t, err)
+	opened := reports.reports(t, 1)[0]
+	assert.Equal(t, "symbolStatus", opened["type"])
+	assert.Equal(t, "normal", opened["status"])
+	assert.Len(t, eng.OpenOrders("alice"), 1)
+}
+
+func TestSchedule_RefusesOutsideContinuousTrading(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	calendar, err := ParseTradingCalendar("equities=08:00/09:30/16:00")
+	require.NoError(t, err)
+
+	// A minute before the close, a minute passing in a second.
+	epoch := time.Date(2024, 1, 2, 15, 59, 0, 0, time.UTC)
+	clock := NewAcceleratedClock(epoch, 60)
+	eng := engine.New(Equities)
+	var server *fenrirNet.Server
+	conn := serve(t, eng, func(s *fenrirNet.Server) {
+		server = s
+		s.SetClock(clock)
+		s.SetTradingCalendars(calendar)
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orderAck"}, reports.next(t, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.RunSchedule(ctx)
+
+	// Every symbol of the asset type is told where it stands, then that it
+	// closed.
+	assert.Equal(t, "normal", reports.reports(t, 1)[0]["status"])
+	closed := reports.reports(t, 1)[0]
+	assert.Equal(t, "symbolStatus", closed["type"])
+	assert.Equal(t, "closed", closed["status"])
+	assert.Equal(t, PhaseClosed, server.TradingPhase("AAPL", Equities))
+
+	// Orders are refused, not held, without queueing.
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	refused := reports.reports(t, 1)[0]
+	assert.Equal(t, "error", refused["type"])
+	assert.Contains(t, refused["error"], fenrirNet.ErrSymbolClosed.Error())
+
+	// Only admins may put symbols in another phase.
+	_, err = conn.Write(tradingPhaseOverride(CalendarScope{AssetType: Equities}, PhaseContinuous))
+	require.NoError(t, err)
+	refused = reports.reports(t, 1)[0]
+	assert.Equal(t, fenrirNet.ErrNotAdmin.Error(), refused["error"])
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"encoding/csv"
+	"fenrir/internal/backoffice"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// engineTrades looks trades up straight from the engine, as the server does
+// without a trade store.
+type engineTrades struct {
+	eng *engine.Engine
+}
+
+func (source engineTrades) Trades(ctx context.Context, query TradeQuery) ([]TradeRecord, error) {
+	return source.eng.QueryTrades(query), nil
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	assert.NoError(t, err)
+	return rows
+}
+
+func TestSettlement_Settle(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	trades := []TradeRecord{
+		{ID: 1, Ticker: "AAA", Price: 100, Quantity: 10, Aggressor: Buy, Taker: "bob", Maker: "alice", PriceScale: 2},
+		{ID: 2, Ticker: "AAA", Price: 101, Quantity: 4, Aggressor: Sell, Taker: "alice", Maker: "bob", PriceScale: 2},
+		{ID: 3, Ticker: "BTC", AssetType: Crypto, Price: 50000, Quantity: 50_000_000, Aggressor: Buy, Taker: "alice", Maker: "carol", QuantityScale: 8, PriceScale: 2},
+	}
+	settlement := Settle(day, trades)
+
+	assert.Equal(t, []SettlementPosition{
+		{Owner: "alice", Ticker: "AAA", Trades: 2, Sold: 14, NetQuantity: -14, Cash: 1404, PriceScale: 2},
+		{Owner: "alice", Ticker: "BTC", AssetType: Crypto, Trades: 1, Bought: 50_000_000, NetQuantity: 50_000_000, Cash: -25000, QuantityScale: 8, PriceScale: 2},
+		{Owner: "bob", Ticker: "AAA", Trades: 2, Bought: 14, NetQuantity: 14, Cash: -1404, PriceScale: 2},
+		{Owner: "carol", Ticker: "BTC", AssetType: Crypto, Trades: 1, Sold: 50_000_000, NetQuantity: -50_000_000, Cash: 25000, QuantityScale: 8, PriceScale: 2},
+	}, settlement.Positions)
+	assert.Equal(t, []SettlementCash{
+		{Owner: "alice", Cash: -23596, PriceScale: 2},
+		{Owner: "bob", Cash: -1404, PriceScale: 2},
+		{Owner: "carol", Cash: 25000, PriceScale: 2},
+	}, settlement.Cash)
+
+	// Trading with yourself nets to nothing.
+	self := Settle(day, []TradeRecord{{Ticker: "AAA", Price: 100, Quantity: 5, Aggressor: Buy, Taker: "dave", Maker: "dave"}})
+	assert.Equal(t, []SettlementPosition{{Owner: "dave", Ticker: "AAA", Trades: 2, Bought: 5, Sold: 5}}, self.Positions)
+}
+
+func TestSettlement_WritesFiles(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+
+	// A trade the day before, and two on the day.
+	eng.SetClock(fixedClock{day.Add(-time.Hour)})
+	placeOwnedOrder(t, eng, "a", "AAA", "alice", Sell, 99, 10)
+	placeOwnedOrder(t, eng, "b", "AAA", "bob", Buy, 99, 10)
+	eng.SetClock(fixedClock{day.Add(9 * time.Hour)})
+	placeOwnedOrder(t, eng, "c", "AAA", "alice", Sell, 100.5, 10)
+	placeOwnedOrder(t, eng, "d", "AAA", "bob", Buy, 100.5, 6)
+	placeOwnedOrder(t, eng, "e", "AAA", "carol", Buy, 100.5, 4)
+
+	dir := filepath.Join(t.TempDir(), "settlement")
+	settler := backoffice.NewSettler(engineTrades{eng}, dir)
+	settlement, err := settler.Settle(context.Background(), day.Add(17*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, day, settlement.Day)
+	assert.Len(t, settlement.Trades, 2)
+
+	trades := readCSV(t, filepath.Join(dir, "trades-2024-01-02.csv"))
+	assert.Equal(t, []string{"trade_id", "timestamp", "ticker", "asset_type", "price", "quantity", "aggressor", "taker", "taker_order", "maker", "maker_order"}, trades[0])
+	assert.Equal(t, []string{"2", "2024-01-02T09:00:00Z", "AAA", "equities", "100.50", "6", "buy", "bob", "d", "alice", "c"}, trades[1])
+	assert.Len(t, trades, 3)
+
+	assert.Equal(t, [][]string{
+		{"owner", "ticker", "asset_type", "trades", "bought", "sold", "net_quantity", "cash"},
+		{"alice", "AAA", "equities", "2", "0", "10", "-10", "1005.00"},
+		{"bob", "AAA", "equities", "1", "6", "0", "6", "-603.00"},
+		{"carol", "AAA", "equities", "1", "4", "0", "4", "-402.00"},
+	}, readCSV(t, filepath.Join(dir, "positions-2024-01-02.csv")))
+	assert.Equal(t, [][]string{
+		{"owner", "cash"},
+		{"alice", "1005.00"},
+		{"bob", "-603.00"},
+		{"carol", "-402.00"},
+	}, readCSV(t, filepath.Join(dir, "cash-2024-01-02.csv")))
+
+	// Settling again replaces the files, leaving nothing else behind.
+	_, err = settler.Settle(context.Background(), day)
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestSettlement_Report(t *testing.T) {
+	buf := fenrirNet.SettlementSummary{
+		Day:       time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Trades:    2,
+		Owners:    3,
+		Positions: 3,
+		Timestamp: time.Unix(0, 1704222000000000000),
+	}.Serialize()
+	reports, err := fenrirNet.JSONReports(buf, false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"type":      "settlement",
+		"day":       uint64(1704153600000000000),
+		"trades":    uint32(2),
+		"owners":    uint32(3),
+		"positions": uint32(3),
+		"timestamp": uint64(1704222000000000000),
+	}, reports[0])
+}
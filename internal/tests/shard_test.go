@@ -0,0 +1,322 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"fenrir/internal/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var shardTickers = []string{"AAPL", "MSFT", "TSLA", "GOOG", "AMZN", "NVDA"}
+
+func newShards(t *testing.T, count int) *engine.Shards {
+	engines := make([]*engine.Engine, count)
+	for i := range engines {
+		engines[i] = engine.New(Equities)
+		engines[i].SetReporter(&MockReporter{})
+	}
+	shards := engine.NewShards(engines...)
+	t.Cleanup(shards.Close)
+	return shards
+}
+
+// placeOn is placeCommand on ticker.
+func placeOn(id, ticker, owner string, side Side, price float64, qty uint64) Command {
+	cmd := placeCommand(id, owner, side, price, qty, CommandOrigin{})
+	cmd.Orders[0].Ticker = ticker
+	return cmd
+}
+
+func TestShards_RouteBySymbol(t *testing.T) {
+	shards := newShards(t, 4)
+	for _, ticker := range shardTickers {
+		_, err := shards.Apply(placeOn(ticker+"s", ticker, "bob", Sell, 100, 10))
+		require.NoError(t, err)
+		_, err = shards.Apply(placeOn(ticker+"b", ticker, "alice", Buy, 100, 4))
+		require.NoError(t, err)
+	}
+
+	// Each book is on the one shard, and only there.
+	books := map[*engine.Engine]int{}
+	for _, ticker := range shardTickers {
+		eng := shards.Engine(ticker)
+		assert.Contains(t, eng.Books, ticker)
+		books[eng] = len(eng.Books)
+	}
+	total := 0
+	for _, count := range books {
+		total += count
+	}
+	assert.Equal(t, len(shardTickers), total)
+	assert.IsIncreasing(t, shards.Tickers(Equities))
+	assert.Len(t, shards.Tickers(Equities), len(shardTickers))
+
+	bbo, err := shards.BBO("TSLA")
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, bbo.AskPrice)
+	assert.Equal(t, uint64(6), bbo.AskQuantity)
+
+	// Trade ids stay unique across shards.
+	trades := shards.QueryTrades(TradeQuery{})
+	require.Len(t, trades, len(shardTickers))
+	ids := map[uint64]bool{}
+	for _, trade := range trades {
+		ids[trade.ID] = true
+	}
+	assert.Len(t, ids, len(shardTickers))
+	assert.Len(t, shards.QueryTrades(TradeQuery{Limit: 2}), 2)
+	assert.Equal(t, len(shardTickers), shards.BookMetrics().Orders)
+}
+
+func TestShards_CommandsOnManyBooks(t *testing.T) {
+	shards := newShards(t, 4)
+	for _, ticker := range shardTickers {
+		_, err := shards.Apply(placeOn(ticker+"a", ticker, "alice", Buy, 99, 10))
+		require.NoError(t, err)
+		_, err = shards.Apply(placeOn(ticker+"b", ticker, "bob", Sell, 101, 10))
+		require.NoError(t, err)
+	}
+
+	// Cancels find the shard the order is on.
+	cancelled, err := shards.Apply(Command{Type: CancelOwnOrderCommand, AssetType: Equities, Owner: "alice", UUID: "MSFTa"})
+	require.NoError(t, err)
+	assert.Equal(t, "MSFTa", cancelled[0].UUID)
+	owner, ok := shards.OrderOwner("TSLAb")
+	assert.True(t, ok)
+	assert.Equal(t, "bob", owner)
+
+	// An owner's orders are cancelled on every shard.
+	cancelled, err = shards.Apply(Command{Type: AdminCancelOwnerCommand, Owner: "alice", Reason: AdminRegulatory})
+	require.NoError(t, err)
+	assert.Len(t, cancelled, len(shardTickers)-1)
+	assert.Empty(t, shards.OpenOrders("alice"))
+	assert.Len(t, shards.OpenOrders("bob"), len(shardTickers))
+
+	// Groups must be on the one shard.
+	var apart []string
+	for _, ticker := range shardTickers[1:] {
+		if shards.Engine(ticker) != shards.Engine(shardTickers[0]) {
+			apart = []string{shardTickers[0], ticker}
+			break
+		}
+	}
+	require.NotEmpty(t, apart)
+	group := Command{Type: PlaceOrderGroupCommand, AssetType: Equities, Orders: []Order{
+		placeOn("g1", apart[0], "carol", Buy, 90, 1).Orders[0],
+		placeOn("g2", apart[1], "carol", Buy, 90, 1).Orders[0],
+	}}
+	_, err = shards.Apply(group)
+	assert.ErrorIs(t, err, engine.ErrCrossShard)
+}
+
+func TestShards_SessionCommandsApplyOnce(t *testing.T) {
+	shards := newShards(t, 4)
+	place := placeOn("a", "AAPL", "alice", Buy, 99, 10)
+	place.Origin = CommandOrigin{Session: "alice", Sequence: 2}
+	_, err := shards.Apply(place)
+	require.NoError(t, err)
+
+	// Whichever shard it would go to.
+	for _, ticker := range shardTickers {
+		place := placeOn(ticker, ticker, "alice", Buy, 99, 10)
+		place.Origin = CommandOrigin{Session: "alice", Sequence: 1}
+		_, err = shards.Apply(place)
+		assert.ErrorIs(t, err, engine.ErrCommandApplied, ticker)
+	}
+	assert.Equal(t, CommandOrigin{Session: "alice", Sequence: 2}, shards.SessionMarker("alice"))
+}
+
+func TestShards_Served(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	shards := newShards(t, 4)
+	_, err = shards.Apply(placeOn(uuid.NewString(), "AAPL", "bob", Sell, 100, 10))
+	require.NoError(t, err)
+
+	conn := serve(t, shards)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err = conn.Write(records[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	_, err = conn.Write(records[3].Data[:50])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"execution", "orderAck"}, reports.next(t, 2))
+	assert.Empty(t, shards.OpenOrders("bob"))
+}
+
+// shardedTickers returns two of shardTickers on different shards.
+func shardedTickers(t *testing.T, shards *engine.Shards) (string, string) {
+	for _, ticker := range shardTickers[1:] {
+		if shards.Engine(ticker) != shards.Engine(shardTickers[0]) {
+			return shardTickers[0], ticker
+		}
+	}
+	require.FailNow(t, "every ticker is on the one shard")
+	return "", ""
+}
+
+func TestShards_SubmitRunsShardsAtOnce(t *testing.T) {
+	shards := newShards(t, 4)
+	held, free := shardedTickers(t, shards)
+
+	// Whatever the router is handed back, in the order it runs it.
+	var replies []string
+	reply := func(ticker, id string) CommandReply {
+		return func(view EngineView, _ []Order, err error) func() {
+			status, leaves := view.OrderStatus(ticker, id)
+			return func() {
+				assert.NoError(t, err)
+				assert.Equal(t, OrderNew, status, id)
+				assert.Equal(t, uint64(10), leaves, id)
+				replies = append(replies, id)
+			}
+		}
+	}
+	// Runs replies until there are n, or fails if they never come.
+	await := func(n int) {
+		timeout := time.After(5 * time.Second)
+		for len(replies) < n {
+			select {
+			case <-shards.Replied():
+				shards.RunReplies()
+			case <-timeout:
+				require.FailNow(t, "replies never came", "had %v", replies)
+			}
+		}
+	}
+
+	// One shard held up applying a command doesn't hold up another, nor the
+	// router.
+	release := make(chan struct{})
+	err := shards.Submit(placeOn("held", held, "alice", Buy, 99, 10), func(view EngineView, orders []Order, err error) func() {
+		<-release
+		return reply(held, "held")(view, orders, err)
+	})
+	require.NoError(t, err)
+	for i := range 3 {
+		require.NoError(t, shards.Submit(placeOn(fmt.Sprint("free", i), free, "alice", Buy, 99, 10), reply(free, fmt.Sprint("free", i))))
+	}
+	await(3)
+	assert.Equal(t, []string{"free0", "free1", "free2"}, replies)
+	close(release)
+	await(4)
+	assert.Equal(t, "held", replies[3])
+
+	// However far the router gets ahead of a shard, its replies come back in
+	// the order it was sent them.
+	replies = nil
+	count := 3 * engine.DefaultShardQueueLen
+	for i := range count {
+		require.NoError(t, shards.Submit(placeOn(fmt.Sprint(i), held, "bob", Sell, 101, 10), reply(held, fmt.Sprint(i))))
+	}
+	await(count)
+	for i, id := range replies {
+		require.Equal(t, fmt.Sprint(i), id)
+	}
+
+	// Those which cannot be routed are refused there and then, and those run on
+	// every shard are replied to before Submit returns.
+	group := placeOn("x", held, "alice", Buy, 99, 1)
+	group.Type = PlaceOrderGroupCommand
+	group.Orders = append(group.Orders, placeOn("y", free, "alice", Buy, 99, 1).Orders...)
+	assert.ErrorIs(t, shards.Submit(group, nil), engine.ErrCrossShard)
+	var cancelled []Order
+	err = shards.Submit(Command{Type: AdminCancelOwnerCommand, Owner: "alice", Reason: AdminRegulatory}, func(_ EngineView, orders []Order, err error) func() {
+		assert.NoError(t, err)
+		return func() { cancelled = orders }
+	})
+	require.NoError(t, err)
+	assert.Len(t, cancelled, 4)
+	assert.Empty(t, shards.OpenOrders("alice"))
+}
+
+func TestShards_ServedPipelined(t *testing.T) {
+	assert.ErrorIs(t, fenrirNet.New("127.0.0.1", 0, engine.New(Equities)).SetPipelined(true), fenrirNet.ErrNotPipelined)
+
+	shards := newShards(t, 4)
+	for _, ticker := range shardTickers {
+		_, err := shards.Apply(placeOn(ticker, ticker, "bob", Sell, 100, 5))
+		require.NoError(t, err)
+	}
+	conn := serve(t, shards, func(server *fenrirNet.Server) {
+		require.NoError(t, server.SetPipelined(true))
+	})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reports := &reportReader{conn: conn}
+	_, err := conn.Write(logonFrame("alice", ""))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session", "exchangeStatus"}, reports.next(t, 2))
+
+	// Orders on every shard, sent at once, each buying out bob's order and
+	// resting the rest.
+	var frames []byte
+	rounds := 4
+	for round := range rounds {
+		for i, ticker := range shardTickers {
+			frames = append(frames, newOrderFrame(ticker, Buy, 100, 10, uint64(round*len(shardTickers)+i+1))...)
+		}
+	}
+	_, err = conn.Write(frames)
+	require.NoError(t, err)
+
+	// Acknowledged in the order they were sent, whichever shard matched each
+	// first.
+	count := rounds * len(shardTickers)
+	var acks []map[string]any
+	executions := 0
+	for len(acks) < count {
+		for _, report := range reports.reports(t, 1) {
+			switch report["type"] {
+			case "orderAck":
+				acks = append(acks, report)
+			case "execution":
+				executions++
+			}
+		}
+	}
+	for i, ack := range acks {
+		assert.EqualValues(t, i+1, ack["clOrdId"])
+	}
+	assert.Equal(t, len(shardTickers), executions)
+	assert.Empty(t, shards.OpenOrders("bob"))
+	assert.Len(t, shards.OpenOrders("alice"), count)
+}
+
+func TestSPSCQueue_KeepsOrder(t *testing.T) {
+	queue := utils.NewSPSCQueue[int](5)
+	assert.Zero(t, queue.Len())
+	for i := range 8 {
+		assert.True(t, queue.TryPush(i))
+	}
+	assert.False(t, queue.TryPush(8))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 8; i < 10000; i++ {
+			queue.Push(i)
+		}
+		close(done)
+	}()
+	for i := range 10000 {
+		item, ok := queue.Pop(nil)
+		require.True(t, ok)
+		require.Equal(t, i, item)
+	}
+	<-done
+	_, ok := queue.TryPop()
+	assert.False(t, ok)
+
+	stop := make(chan struct{})
+	close(stop)
+	_, ok = queue.Pop(stop)
+	assert.False(t, ok)
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/simulation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSimulation_SameSeedSameOutcome(t *testing.T) {
+	run := func(seed uint64) (simulation.Result, []Trade) {
+		eng := engine.New(Equities)
+		result := simulation.New(eng, simulation.Config{Seed: seed, Duration: 10 * time.Minute}).Run()
+		return result, eng.Trades
+	}
+	first, trades := run(1)
+	second, again := run(1)
+	require.NotZero(t, first.Trades)
+	assert.Equal(t, first, second)
+	assert.Equal(t, trades, again)
+
+	other, _ := run(2)
+	assert.NotEqual(t, first, other)
+}
+
+func TestSimulation_Populations(t *testing.T) {
+	eng := engine.New(Equities)
+	epoch := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	config := simulation.Config{
+		Seed:     7,
+		Epoch:    epoch,
+		Duration: 30 * time.Minute,
+		Populations: []simulation.Population{
+			{Kind: simulation.NoiseTrader, Count: 10},
+			{Kind: simulation.MomentumTrader, Count: 3},
+			{Kind: simulation.MarketMaker, Count: 2, MaxInventory: 500},
+		},
+	}
+	sim := simulation.New(eng, config)
+	result := sim.Run()
+	assert.Equal(t, epoch.Add(config.Duration), sim.Now())
+	assert.Len(t, result.Agents, 15)
+	assert.Equal(t, len(eng.Trades), result.Trades)
+	assert.Zero(t, result.Rejected)
+
+	// Every kind trades, and what one buys another sells.
+	kinds := result.Kinds()
+	var position int64
+	var cash float64
+	for _, kind := range []simulation.Kind{simulation.NoiseTrader, simulation.MomentumTrader, simulation.MarketMaker} {
+		assert.NotZero(t, kinds[kind].Bought+kinds[kind].Sold, kind.String())
+		position += kinds[kind].Position
+		cash += kinds[kind].Cash
+	}
+	assert.Zero(t, position)
+	assert.InDelta(t, 0, cash, 1e-6)
+
+	// Makers hold no more than a fill past their most.
+	for _, agent := range result.Agents {
+		if agent.Kind == simulation.MarketMaker {
+			assert.LessOrEqual(t, max(agent.Position, -agent.Position), int64(500+100), agent.Owner)
+		}
+	}
+
+	// Trades are made on the simulation's clock, around the start price.
+	for _, trade := range eng.Trades {
+		assert.False(t, trade.Timestamp.Before(epoch) || trade.Timestamp.After(sim.Now()), "traded at %v", trade.Timestamp)
+	}
+	assert.LessOrEqual(t, result.Low, result.VWAP)
+	assert.GreaterOrEqual(t, result.High, result.VWAP)
+	assert.InDelta(t, simulation.DefaultStartPrice, result.Close, 5)
+	assert.Positive(t, result.Volatility)
+
+	// And the book is left as it should be.
+	book, err := eng.Book(Equities, simulation.DefaultTicker)
+	require.NoError(t, err)
+	bid, _, bidOk := book.BestBid()
+	ask, _, askOk := book.BestAsk()
+	require.True(t, bidOk && askOk)
+	assert.Less(t, bid, ask)
+}
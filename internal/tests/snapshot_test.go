@@ -0,0 +1,115 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir-snapshot.json")
+	live := engine.New(Equities)
+	live.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	live.SetCommandJournal(journal)
+
+	for i, cmd := range []Command{
+		placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}),
+		placeCommand("b", "bob", Buy, 99, 5, CommandOrigin{Session: "bob", Sequence: 1}),
+		placeCommand("c", "bob", Sell, 101, 5, CommandOrigin{Session: "bob", Sequence: 2}),
+		placeCommand("d", "carol", Sell, 99, 3, CommandOrigin{Session: "carol", Sequence: 1}),
+	} {
+		_, err := live.Apply(cmd)
+		assert.NoError(t, err, i)
+	}
+	assert.NoError(t, engine.SaveSnapshot(path, live.Snapshot()))
+
+	snap, err := engine.LoadSnapshot(path)
+	assert.NoError(t, err)
+	assert.Len(t, snap.Books, 1)
+	assert.Len(t, snap.Books[0].Orders, 3)
+	assert.Equal(t, live.ReplayMarkers(), snap.Markers)
+
+	restored := engine.New(Equities)
+	restored.SetReporter(&MockReporter{})
+	assert.NoError(t, restored.RestoreSnapshot(snap))
+	assert.Equal(t, live.ReplayMarkers(), restored.ReplayMarkers())
+	alice := restored.OpenOrders("alice")
+	assert.Len(t, alice, 1)
+	assert.Equal(t, uint64(7), alice[0].Quantity)
+
+	// Time priority is kept, alice is still ahead of bob at 99, and trade ids
+	// carry on from where they were.
+	reporter := &MockReporter{}
+	restored.SetReporter(reporter)
+	_, err = restored.Apply(placeCommand("e", "carol", Sell, 99, 7, CommandOrigin{Session: "carol", Sequence: 2}))
+	assert.NoError(t, err)
+	assert.Empty(t, restored.OpenOrders("alice"))
+	assert.Len(t, restored.OpenOrders("bob"), 2)
+	assert.Len(t, restored.Trades, 1)
+	assert.Equal(t, live.Trades[0].ID+1, restored.Trades[0].ID)
+
+	// Commands already in the snapshot are not applied again.
+	n, err := restored.Replay(journal.cmds)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	_, err = restored.Apply(placeCommand("d", "carol", Sell, 99, 3, CommandOrigin{Session: "carol", Sequence: 1}))
+	assert.ErrorIs(t, err, engine.ErrCommandApplied)
+}
+
+func TestSnapshot_Missing(t *testing.T) {
+	_, err := engine.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSnapshot_Diff(t *testing.T) {
+	primary := engine.New(Equities)
+	primary.SetReporter(&MockReporter{})
+	journal := &commandRecorder{}
+	primary.SetCommandJournal(journal)
+	for _, cmd := range []Command{
+		placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}),
+		placeCommand("b", "bob", Buy, 99, 5, CommandOrigin{Session: "bob", Sequence: 1}),
+		placeCommand("c", "bob", Sell, 101, 5, CommandOrigin{Session: "bob", Sequence: 2}),
+	} {
+		_, err := primary.Apply(cmd)
+		assert.NoError(t, err)
+	}
+
+	// Replaying the journal over an empty snapshot recovers the same books.
+	recovered := engine.New(Equities)
+	_, err := recovered.Recover(Snapshot{}, journal.cmds)
+	assert.NoError(t, err)
+	assert.Empty(t, engine.DiffSnapshots(primary.Snapshot(), recovered.Snapshot()))
+
+	// A replica which saw bob's bid first, missed his offer, and took one of
+	// carol's.
+	replica := engine.New(Equities)
+	replica.SetReporter(&MockReporter{})
+	for _, cmd := range []Command{
+		placeCommand("b", "bob", Buy, 99, 5, CommandOrigin{Session: "bob", Sequence: 1}),
+		placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}),
+		placeCommand("d", "carol", Sell, 102, 1, CommandOrigin{Session: "carol", Sequence: 1}),
+	} {
+		_, err := replica.Apply(cmd)
+		assert.NoError(t, err)
+	}
+
+	var diffs []string
+	for _, diff := range engine.DiffSnapshots(primary.Snapshot(), replica.Snapshot()) {
+		diffs = append(diffs, diff.String())
+	}
+	assert.Equal(t, []string{
+		"snapshot: session bob replayed to: 2.0 != 1.0",
+		"snapshot: session carol replayed to: none != 1.0",
+		"TEST bid 99: order a queue position: 1 != 2",
+		"TEST bid 99: order a sequence: 1 != 2",
+		"TEST bid 99: order b queue position: 2 != 1",
+		"TEST bid 99: order b sequence: 2 != 1",
+		"TEST ask 101: level: 5 in 1 orders != none",
+		"TEST ask 102: level: none != 1 in 1 orders",
+	}, diffs)
+}
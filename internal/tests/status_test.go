@@ -0,0 +1,94 @@
+package tests
+
+import (
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExchangeStatus_Updates(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	server := fenrirNet.New("127.0.0.1", 0, nil)
+	server.SetClock(fixedClock{epoch})
+
+	// Open until told otherwise.
+	assert.Equal(t, fenrirNet.ExchangeOpen, server.ExchangeStatus().State)
+
+	assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusHalted, Message: "volatility"}))
+	status := server.ExchangeStatus()
+	assert.Equal(t, fenrirNet.ExchangeHalted, status.State)
+	assert.Equal(t, "volatility", status.Message)
+	assert.Equal(t, epoch, status.Timestamp)
+	assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusResumed}))
+	assert.Equal(t, fenrirNet.ExchangeOpen, server.ExchangeStatus().State)
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusResumed}), fenrirNet.ErrExchangeNotHalted)
+
+	// Degraded components are kept sorted, once each.
+	for _, component := range []string{"risk", "audit", "risk"} {
+		assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusComponentDegraded, Component: component}))
+	}
+	assert.Equal(t, []string{"audit", "risk"}, server.ExchangeStatus().Degraded)
+	assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusComponentRecovered, Component: "audit"}))
+	assert.Equal(t, []string{"risk"}, server.ExchangeStatus().Degraded)
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusComponentRecovered, Component: "audit"}), fenrirNet.ErrComponentNotDegraded)
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusComponentDegraded}), fenrirNet.ErrMissingComponent)
+
+	// Maintenance is dropped once it has been and gone.
+	window := fenrirNet.MaintenanceWindow{Start: epoch.Add(time.Hour), End: epoch.Add(2 * time.Hour)}
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{
+		Event:       fenrirNet.StatusMaintenanceScheduled,
+		Maintenance: fenrirNet.MaintenanceWindow{Start: window.End, End: window.Start},
+	}), fenrirNet.ErrInvalidMaintenance)
+	assert.NoError(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusMaintenanceScheduled, Maintenance: window}))
+	assert.Equal(t, window, server.ExchangeStatus().Maintenance)
+	server.SetClock(fixedClock{epoch.Add(3 * time.Hour)})
+	assert.Zero(t, server.ExchangeStatus().Maintenance)
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusMaintenanceCancelled}), fenrirNet.ErrNoMaintenanceScheduled)
+
+	assert.ErrorIs(t, server.UpdateExchangeStatus(fenrirNet.StatusUpdate{Event: fenrirNet.StatusCurrent}), fenrirNet.ErrInvalidStatusEvent)
+}
+
+func TestExchangeStatus_Report(t *testing.T) {
+	epoch := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	change := fenrirNet.ExchangeStatusChange{
+		ExchangeStatus: fenrirNet.ExchangeStatus{
+			State:       fenrirNet.ExchangeHalted,
+			Degraded:    []string{"audit", "risk"},
+			Maintenance: fenrirNet.MaintenanceWindow{Start: epoch.Add(time.Hour), End: epoch.Add(2 * time.Hour)},
+			Message:     "back shortly",
+			Timestamp:   epoch,
+		},
+		Event:     fenrirNet.StatusComponentDegraded,
+		Component: "risk",
+	}
+	buf := change.Serialize()
+
+	parsed, n, err := fenrirNet.ParseExchangeStatusChange(append(buf, 0xff))
+	assert.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, change.Event, parsed.Event)
+	assert.Equal(t, change.State, parsed.State)
+	assert.Equal(t, change.Component, parsed.Component)
+	assert.Equal(t, change.Degraded, parsed.Degraded)
+	assert.Equal(t, change.Message, parsed.Message)
+	assert.True(t, change.Timestamp.Equal(parsed.Timestamp))
+	assert.True(t, change.Maintenance.End.Equal(parsed.Maintenance.End))
+
+	_, _, err = fenrirNet.ParseExchangeStatusChange(buf[:len(buf)-1])
+	assert.ErrorIs(t, err, fenrirNet.ErrReportTooShort)
+
+	reports, err := fenrirNet.JSONReports(buf, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{
+		"type":             "exchangeStatus",
+		"event":            "componentDegraded",
+		"state":            "halted",
+		"timestamp":        uint64(epoch.UnixNano()),
+		"component":        "risk",
+		"degraded":         []string{"audit", "risk"},
+		"maintenanceStart": uint64(epoch.Add(time.Hour).UnixNano()),
+		"maintenanceEnd":   uint64(epoch.Add(2 * time.Hour).UnixNano()),
+		"message":          "back shortly",
+	}}, reports)
+}
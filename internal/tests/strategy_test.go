@@ -0,0 +1,104 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func createTestStrategyEngine(t *testing.T) *engine.Engine {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	strategy, err := ParseStrategy(Equities, "CS1:vertical:C100|C105")
+	assert.NoError(t, err)
+	assert.NoError(t, eng.RegisterStrategy(strategy))
+
+	// A market maker quotes both legs, the spread being 5.00 - 2.00 = 3.00.
+	placeOwnedOrder(t, eng, "c100-ask", "C100", "mm", Sell, 5.0, 10)
+	placeOwnedOrder(t, eng, "c105-bid", "C105", "mm", Buy, 2.0, 10)
+	return eng
+}
+
+func TestPlaceOrder_Strategy_ImpliedAgainstLegs(t *testing.T) {
+	eng := createTestStrategyEngine(t)
+	placeOwnedOrder(t, eng, "spread", "CS1", "alice", Buy, 3.0, 4)
+
+	// Buying the spread buys the long leg and sells the short one.
+	assert.Len(t, eng.Trades, 2)
+	assert.Equal(t, "C100", eng.Trades[0].Party.Ticker)
+	assert.Equal(t, Buy, eng.Trades[0].Party.Side)
+	assert.Equal(t, "C105", eng.Trades[1].Party.Ticker)
+	assert.Equal(t, Sell, eng.Trades[1].Party.Side)
+	for _, trade := range eng.Trades {
+		assert.Equal(t, "alice", trade.Party.Owner)
+		assert.Equal(t, uint64(4), trade.MatchQty)
+	}
+	_, quantity, _ := eng.Books["C100"].BestAsk()
+	assert.Equal(t, uint64(6), quantity)
+	assert.Empty(t, eng.Books["CS1"].Bids.Items())
+}
+
+func TestPlaceOrder_Strategy_RestsAndMatchesStrategyOrders(t *testing.T) {
+	eng := createTestStrategyEngine(t)
+
+	// Below the implied price it rests on the strategy's own book, leaving the
+	// legs alone.
+	placeOwnedOrder(t, eng, "bid", "CS1", "alice", Buy, 2.5, 4)
+	assert.Empty(t, eng.Trades)
+	price, quantity, ok := eng.Books["CS1"].BestBid()
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, price)
+	assert.Equal(t, uint64(4), quantity)
+
+	// Nothing to imply a sale against, so a seller trades with the bid.
+	placeOwnedOrder(t, eng, "ask", "CS1", "bob", Sell, 2.5, 4)
+	assert.Len(t, eng.Trades, 1)
+	assert.Equal(t, "CS1", eng.Trades[0].Party.Ticker)
+	assert.Equal(t, 2.5, eng.Trades[0].Price)
+	assert.Empty(t, eng.Books["CS1"].Bids.Items())
+}
+
+func TestPlaceOrder_Strategy_BestPrice(t *testing.T) {
+	eng := createTestStrategyEngine(t)
+	placeOwnedOrder(t, eng, "ask", "CS1", "bob", Sell, 2.8, 4)
+
+	// The strategy book offers 2.80, better than the legs' 3.00.
+	placeOwnedOrder(t, eng, "bid", "CS1", "alice", Buy, 3.0, 4)
+	assert.Len(t, eng.Trades, 1)
+	assert.Equal(t, "CS1", eng.Trades[0].Party.Ticker)
+	assert.Equal(t, 2.8, eng.Trades[0].Price)
+
+	// Once the book only offers 3.10, the legs are better.
+	placeOwnedOrder(t, eng, "ask2", "CS1", "bob", Sell, 3.1, 4)
+	assert.NoError(t, eng.CheckOrder(Equities, Order{Ticker: "CS1", Side: Buy, OrderType: MarketOrder, Quantity: 8, TotalQuantity: 8}))
+	placeOwnedOrder(t, eng, "bid2", "CS1", "alice", Buy, 3.1, 4)
+	assert.Len(t, eng.Trades, 3)
+	assert.Equal(t, "C100", eng.Trades[1].Party.Ticker)
+	assert.Equal(t, "C105", eng.Trades[2].Party.Ticker)
+	_, quantity, _ := eng.Books["CS1"].BestAsk()
+	assert.Equal(t, uint64(4), quantity)
+
+	// Neither can fill a market order in full.
+	assert.ErrorIs(t, eng.CheckOrder(Equities, Order{Ticker: "CS1", Side: Buy, OrderType: MarketOrder, Quantity: 20, TotalQuantity: 20}), engine.ErrNotEnoughLiquidity)
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	eng := engine.New(Equities)
+	assert.NoError(t, eng.RegisterInstrument(Instrument{Ticker: "P100", AssetType: Equities, PriceScale: 3}))
+	assert.NoError(t, eng.RegisterStrategy(Straddle("ST1", Equities, "C100", "P100")))
+	// Priced to the finest of its legs' ticks.
+	inst, ok := eng.Instrument("ST1")
+	assert.True(t, ok)
+	assert.Equal(t, uint8(3), inst.PriceScale)
+
+	assert.ErrorIs(t, eng.RegisterStrategy(Straddle("ST1", Equities, "C105", "P105")), engine.ErrInstrumentExists)
+	assert.ErrorIs(t, eng.RegisterStrategy(Straddle("ST2", Equities, "C100", "C100")), ErrInvalidStrategy)
+	assert.ErrorIs(t, eng.RegisterStrategy(Vertical("ST3", Equities, "ST1", "C100")), ErrInvalidStrategy)
+	assert.ErrorIs(t, eng.RegisterStrategy(Strategy{Ticker: "ST4", AssetType: Equities, Legs: []StrategyLeg{{Ticker: "C100", Ratio: 1}}}), ErrInvalidStrategy)
+
+	_, err := ParseStrategy(Equities, "ST5:butterfly:C100|C105")
+	assert.ErrorIs(t, err, ErrInvalidStrategy)
+	_, err = ParseStrategy(Equities, "ST5:vertical:C100")
+	assert.ErrorIs(t, err, ErrInvalidStrategy)
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type statusReporter struct {
+	MockReporter
+	statuses []SymbolStatus
+}
+
+func (r *statusReporter) ReportSymbolStatus(ticker string, status SymbolStatus) error {
+	r.statuses = append(r.statuses, status)
+	return nil
+}
+
+func TestThrottle_RejectsLowestPriorityFirst(t *testing.T) {
+	reporter := &statusReporter{}
+	eng := engine.New(Equities)
+	eng.SetReporter(reporter)
+	eng.SetThrottleThresholds([NumCommandPriorities]int{
+		QueryPriority:    2,
+		NewOrderPriority: 4,
+	})
+
+	assert.NoError(t, eng.Admit("AAA", NewOrderPriority))
+	assert.NoError(t, eng.Admit("AAA", NewOrderPriority))
+
+	// Queries are shed first, orders still flow.
+	assert.ErrorIs(t, eng.Admit("AAA", QueryPriority), engine.ErrSymbolThrottled)
+	assert.NoError(t, eng.Admit("AAA", NewOrderPriority))
+	assert.NoError(t, eng.Admit("AAA", NewOrderPriority))
+	assert.ErrorIs(t, eng.Admit("AAA", NewOrderPriority), engine.ErrSymbolThrottled)
+
+	// Cancels are never throttled, and other symbols are unaffected.
+	assert.NoError(t, eng.Admit("AAA", CancelPriority))
+	assert.NoError(t, eng.Admit("BBB", QueryPriority))
+	assert.Equal(t, []SymbolStatus{SymbolStressed}, reporter.statuses)
+
+	// Drain the queue, the symbol recovers.
+	for range 5 {
+		eng.Release("AAA")
+	}
+	assert.Equal(t, []SymbolStatus{SymbolStressed, SymbolNormal}, reporter.statuses)
+	assert.NoError(t, eng.Admit("AAA", QueryPriority))
+}
+
+// tickingClock moves on by step every time it is read.
+type tickingClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (clock *tickingClock) Now() time.Time {
+	clock.now = clock.now.Add(clock.step)
+	return clock.now
+}
+
+func (clock *tickingClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
+
+func TestThrottle_Budget(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&statusReporter{})
+	eng.SetClock(&tickingClock{now: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), step: 2 * time.Millisecond})
+	eng.SetThrottleThresholds([NumCommandPriorities]int{
+		QueryPriority:    2,
+		NewOrderPriority: 4,
+	})
+
+	for range 4 {
+		assert.NoError(t, eng.Admit("AAA", NewOrderPriority))
+	}
+	for range 2 {
+		assert.NoError(t, eng.Admit("BBB", NewOrderPriority))
+	}
+
+	// Nothing handled yet, so each command is assumed to take the default.
+	// AAA's are handled in turn with BBB's, so it has to wait on its share of
+	// them too.
+	assert.Equal(t, ThrottleBudget{
+		Remaining:  [NumCommandPriorities]int{0, 0, -1},
+		RetryAfter: [NumCommandPriorities]time.Duration{5 * engine.DefaultCommandInterval, 2 * engine.DefaultCommandInterval, 0},
+	}, eng.ThrottleBudget("AAA"))
+	assert.Equal(t, [NumCommandPriorities]int{0, 2, -1}, eng.ThrottleBudget("BBB").Remaining)
+
+	// Releases while backed up measure how long commands take.
+	eng.Release("AAA")
+	eng.Release("AAA")
+	assert.Equal(t, ThrottleBudget{
+		Remaining:  [NumCommandPriorities]int{0, 2, -1},
+		RetryAfter: [NumCommandPriorities]time.Duration{4 * time.Millisecond, 0, 0},
+	}, eng.ThrottleBudget("AAA"))
+	assert.Equal(t, [NumCommandPriorities]int{2, 4, -1}, eng.ThrottleBudget("CCC").Remaining)
+}
+
+func TestThrottle_FlowControlReport(t *testing.T) {
+	flow := fenrirNet.FlowControl{
+		State:    fenrirNet.FlowThrottled,
+		Ticker:   "AAA",
+		Priority: NewOrderPriority,
+		Budget: ThrottleBudget{
+			Remaining:  [NumCommandPriorities]int{0, 0, -1},
+			RetryAfter: [NumCommandPriorities]time.Duration{5 * time.Millisecond, 2 * time.Millisecond, 0},
+		},
+		Timestamp: time.Unix(0, 1700000000000000000),
+	}
+	buf := flow.Serialize()
+	assert.Len(t, buf, fenrirNet.FlowControlLen)
+
+	parsed, err := fenrirNet.ParseFlowControl(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, flow.Budget, parsed.Budget)
+	assert.Equal(t, NewOrderPriority, parsed.Priority)
+	assert.True(t, flow.Timestamp.Equal(parsed.Timestamp))
+
+	reports, err := fenrirNet.JSONReports(buf, false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"type":       "flowControl",
+		"state":      "throttled",
+		"ticker":     "AAA",
+		"priority":   "newOrder",
+		"remaining":  map[string]int{"query": 0, "newOrder": 0, "cancel": -1},
+		"retryAfter": map[string]int64{"query": 5_000_000, "newOrder": 2_000_000, "cancel": 0},
+		"timestamp":  uint64(1700000000000000000),
+	}, reports[0])
+}
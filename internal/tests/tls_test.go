@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1, and its key, to
+// PEM files in dir, returning their paths and a pool trusting it.
+func writeCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fenrir"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestTLS_SessionResumption(t *testing.T) {
+	records, err := fenrirNet.ReadCapture(filepath.Join("testdata", "captures", "place.capture"))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile, pool := writeCert(t, dir)
+	ticketKeys := filepath.Join(dir, "tickets")
+	require.NoError(t, os.WriteFile(ticketKeys, []byte("# current\n"+strings.Repeat("ab", 32)+"\n"), 0o600))
+	config, err := fenrirNet.ServerTLSConfig(certFile, keyFile, ticketKeys)
+	require.NoError(t, err)
+
+	var server *fenrirNet.Server
+	plain := serve(t, engine.New(Equities), func(s *fenrirNet.Server) {
+		server = s
+		s.SetTLS(config)
+	})
+	address := plain.RemoteAddr().String()
+	sessions := filepath.Join(dir, "sessions")
+
+	// Logs alice on over a fresh client, as if restarted, returning whether
+	// it resumed its TLS session.
+	logon := func() bool {
+		conn, err := tls.Dial("tcp", address, &tls.Config{
+			RootCAs:            pool,
+			ClientSessionCache: fenrirNet.NewFileSessionCache(sessions),
+		})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err = conn.Write(records[0].Data)
+		require.NoError(t, err)
+		// The ticket comes ahead of any report.
+		reports := &reportReader{conn: conn}
+		assert.Equal(t, "session", reports.next(t, 1)[0])
+		return conn.ConnectionState().DidResume
+	}
+	assert.False(t, logon())
+	assert.True(t, logon())
+
+	stats := server.TLSStats()
+	assert.Equal(t, uint64(2), stats.Handshakes)
+	assert.Equal(t, uint64(1), stats.Resumed)
+}
+
+func TestTLS_TicketKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets")
+	first, second := strings.Repeat("01", 32), strings.Repeat("02", 32)
+	require.NoError(t, os.WriteFile(path, []byte("# newest first\n"+first+"\n\n"+second+"\n"), 0o600))
+	keys, err := fenrirNet.LoadTicketKeys(path)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, byte(0x01), keys[0][0])
+	assert.Equal(t, byte(0x02), keys[1][31])
+
+	require.NoError(t, os.WriteFile(path, []byte(first[:62]+"\n"), 0o600))
+	_, err = fenrirNet.LoadTicketKeys(path)
+	assert.ErrorIs(t, err, fenrirNet.ErrInvalidTicketKey)
+	require.NoError(t, os.WriteFile(path, []byte("# none yet\n"), 0o600))
+	_, err = fenrirNet.LoadTicketKeys(path)
+	assert.ErrorIs(t, err, fenrirNet.ErrNoTicketKeys)
+}
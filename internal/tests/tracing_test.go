@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fenrir/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(spans []tracing.SpanData) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Close() error { return nil }
+
+func TestTracer(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracer := tracing.New(recorder, 1, tracing.DefaultBuffer)
+
+	start := time.Unix(100, 0)
+	ctx, root := tracer.Start(context.Background(), "message", start)
+	assert.NotNil(t, root)
+	root.SetString("client.address", "127.0.0.1:1234")
+	_, risk := tracing.StartAt(ctx, "risk", start.Add(time.Millisecond))
+	risk.SetError(errors.New("too big"))
+	risk.EndAt(start.Add(2 * time.Millisecond))
+	root.EndAt(start.Add(3 * time.Millisecond))
+	// Only the first end counts.
+	root.End()
+	assert.NoError(t, tracer.Close())
+
+	assert.Len(t, recorder.spans, 2)
+	riskSpan, rootSpan := recorder.spans[0], recorder.spans[1]
+	assert.Equal(t, "message", rootSpan.Name)
+	assert.Equal(t, tracing.Server, rootSpan.Kind)
+	assert.Equal(t, [8]byte{}, rootSpan.ParentID)
+	assert.Equal(t, []tracing.Attribute{{Key: "client.address", Value: "127.0.0.1:1234"}}, rootSpan.Attributes)
+	assert.Equal(t, 3*time.Millisecond, rootSpan.End.Sub(rootSpan.Start))
+	assert.Equal(t, "risk", riskSpan.Name)
+	assert.Equal(t, tracing.Internal, riskSpan.Kind)
+	assert.Equal(t, rootSpan.TraceID, riskSpan.TraceID)
+	assert.Equal(t, rootSpan.SpanID, riskSpan.ParentID)
+	assert.Equal(t, "too big", riskSpan.Error)
+	assert.Zero(t, tracer.Dropped())
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracer := tracing.New(recorder, 0, tracing.DefaultBuffer)
+	ctx, root := tracer.Start(context.Background(), "message", time.Now())
+	assert.Nil(t, root)
+	// Nothing within a trace not sampled is either.
+	_, child := tracing.Start(ctx, "parse")
+	assert.Nil(t, child)
+	child.SetInt("n", 1)
+	child.End()
+	assert.NoError(t, tracer.Close())
+	assert.Empty(t, recorder.spans)
+
+	// About the fraction asked for are sampled.
+	tracer = tracing.New(recorder, 0.25, tracing.DefaultBuffer)
+	sampled := 0
+	for range 10000 {
+		if _, root := tracer.Start(context.Background(), "message", time.Now()); root != nil {
+			sampled++
+		}
+	}
+	assert.NoError(t, tracer.Close())
+	assert.InDelta(t, 2500, sampled, 250)
+
+	// A nil tracer traces nothing.
+	var off *tracing.Tracer
+	_, root = off.Start(context.Background(), "message", off.Now())
+	assert.Nil(t, root)
+	assert.True(t, off.Now().IsZero())
+	assert.NoError(t, off.Close())
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var path string
+	var body map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer collector.Close()
+
+	exporter := tracing.NewOTLP(collector.URL + "/")
+	err := exporter.Export([]tracing.SpanData{{
+		TraceID:    [16]byte{0: 0xab, 15: 0x01},
+		SpanID:     [8]byte{7: 0x02},
+		ParentID:   [8]byte{7: 0x03},
+		Name:       "match",
+		Kind:       tracing.Internal,
+		Start:      time.Unix(1, 5),
+		End:        time.Unix(2, 0),
+		Attributes: []tracing.Attribute{{Key: "message.type", Value: int64(1)}},
+		Error:      "insufficient liquidity",
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, exporter.Close())
+
+	assert.Equal(t, "/v1/traces", path)
+	resourceSpans := body["resourceSpans"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{"attributes": []any{
+		map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "fenrir"}},
+	}}, resourceSpans["resource"])
+	scopeSpans := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"traceId":           "ab000000000000000000000000000001",
+		"spanId":            "0000000000000002",
+		"parentSpanId":      "0000000000000003",
+		"name":              "match",
+		"kind":              float64(1),
+		"startTimeUnixNano": "1000000005",
+		"endTimeUnixNano":   "2000000000",
+		"attributes": []any{
+			map[string]any{"key": "message.type", "value": map[string]any{"intValue": "1"}},
+		},
+		"status": map[string]any{"code": float64(2), "message": "insufficient liquidity"},
+	}, scopeSpans["spans"].([]any)[0])
+
+	// Collectors refusing a batch fail the export.
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer refusing.Close()
+	assert.Error(t, tracing.NewOTLP(refusing.URL).Export([]tracing.SpanData{{Name: "match"}}))
+}
@@ -0,0 +1,73 @@
+//go:build cgo
+
+package tests
+
+import (
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/tradestore"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestTradeStore_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir.db")
+	store, err := tradestore.OpenSQL("sqlite3", path)
+	assert.NoError(t, err)
+	writer := tradestore.NewWriter(store, 16)
+
+	open := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{open})
+	eng.SetTradeRecorder(writer, 0)
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100.25, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100.25, 4)
+	eng.SetClock(fixedClock{open.Add(time.Minute)})
+	placeOwnedOrder(t, eng, "c", "TEST", "carol", Buy, 100.25, 6)
+	placeOwnedOrder(t, eng, "d", "OTHER", "dave", Sell, 50, 1)
+	assert.NoError(t, writer.Close())
+	assert.Zero(t, writer.Dropped())
+
+	// Reopened, the trades are read back as they were recorded.
+	store, err = tradestore.OpenSQL("sqlite3", path)
+	assert.NoError(t, err)
+	defer store.Close()
+	trades, err := store.Trades(TradeQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, eng.QueryTrades(TradeQuery{}), trades)
+	assert.Equal(t, TradeRecord{
+		ID:            1,
+		Ticker:        "TEST",
+		Timestamp:     open,
+		Price:         100.25,
+		Quantity:      4,
+		Aggressor:     Buy,
+		Taker:         "bob",
+		TakerOrder:    "b",
+		Maker:         "alice",
+		MakerOrder:    "a",
+		QuantityScale: trades[0].QuantityScale,
+		PriceScale:    trades[0].PriceScale,
+	}, trades[0])
+
+	ids := func(query TradeQuery) []uint64 {
+		trades, err := store.Trades(query)
+		assert.NoError(t, err)
+		var ids []uint64
+		for _, trade := range trades {
+			ids = append(ids, trade.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uint64{1, 2}, ids(TradeQuery{Owner: "alice"}))
+	assert.Equal(t, []uint64{2}, ids(TradeQuery{Owner: "carol"}))
+	assert.Equal(t, []uint64{2}, ids(TradeQuery{Owner: "alice", Limit: 1}))
+	assert.Equal(t, []uint64{2}, ids(TradeQuery{From: open.Add(time.Minute)}))
+	assert.Equal(t, []uint64{1}, ids(TradeQuery{Ticker: "TEST", To: open.Add(time.Minute)}))
+	assert.Empty(t, ids(TradeQuery{Ticker: "OTHER"}))
+}
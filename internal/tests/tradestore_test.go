@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/tradestore"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a trade store kept in memory.
+type memoryStore struct {
+	lock    sync.Mutex
+	trades  []TradeRecord
+	batches int
+	fail    bool
+	closed  bool
+}
+
+func (store *memoryStore) SaveTrades(trades []TradeRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.fail {
+		return errors.New("database down")
+	}
+	store.trades = append(store.trades, trades...)
+	store.batches++
+	return nil
+}
+
+func (store *memoryStore) Trades(query TradeQuery) ([]TradeRecord, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var trades []TradeRecord
+	for _, trade := range store.trades {
+		if query.Matches(trade) {
+			trades = append(trades, trade)
+		}
+	}
+	if query.Limit > 0 && len(trades) > query.Limit {
+		trades = trades[len(trades)-query.Limit:]
+	}
+	return trades, nil
+}
+
+func (store *memoryStore) Close() error {
+	store.closed = true
+	return nil
+}
+
+func TestTradeStore_Writer(t *testing.T) {
+	store := &memoryStore{}
+	writer := tradestore.NewWriter(store, 16)
+
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetTradeRecorder(writer, 0)
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100, 4)
+	placeOwnedOrder(t, eng, "c", "TEST", "carol", Buy, 100, 6)
+	placeOwnedOrder(t, eng, "d", "OTHER", "dave", Sell, 50, 1)
+
+	// Saved in the background, all of it by the time the writer is closed.
+	assert.NoError(t, writer.Close())
+	assert.True(t, store.closed)
+	assert.Zero(t, writer.Dropped())
+	assert.Len(t, store.trades, 2)
+
+	trade := store.trades[0]
+	assert.Equal(t, uint64(1), trade.ID)
+	assert.Equal(t, "TEST", trade.Ticker)
+	assert.Equal(t, uint64(4), trade.Quantity)
+	assert.Equal(t, Buy, trade.Aggressor)
+	assert.Equal(t, "bob", trade.Taker)
+	assert.Equal(t, "b", trade.TakerOrder)
+	assert.Equal(t, "alice", trade.Maker)
+	assert.Equal(t, "a", trade.MakerOrder)
+
+	// Querying by owner finds them on either side.
+	trades, err := writer.Trades(TradeQuery{Owner: "alice"})
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	trades, err = writer.Trades(TradeQuery{Owner: "carol"})
+	assert.NoError(t, err)
+	assert.Len(t, trades, 1)
+	assert.Equal(t, uint64(2), trades[0].ID)
+}
+
+func TestTradeStore_WriterDrops(t *testing.T) {
+	store := &memoryStore{fail: true}
+	writer := tradestore.NewWriter(store, 16)
+	for i := range 5 {
+		writer.RecordTrade(TradeRecord{ID: uint64(i + 1)})
+	}
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, uint64(5), writer.Dropped())
+	assert.Empty(t, store.trades)
+}
+
+func TestTradeStore_Retention(t *testing.T) {
+	store := &memoryStore{}
+	writer := tradestore.NewWriter(store, 64)
+
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetTradeRecorder(writer, 2)
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100, 20)
+	for i, uuid := range []string{"b", "c", "d", "e", "f"} {
+		placeOwnedOrder(t, eng, uuid, "TEST", "bob", Buy, 100, uint64(i+1))
+	}
+
+	// Only the latest are kept in memory, let go of in bulk, but all are saved.
+	assert.Len(t, eng.Trades, 3)
+	assert.Equal(t, uint64(5), eng.Trades[2].MatchQty)
+	assert.NoError(t, writer.Close())
+	assert.Len(t, store.trades, 5)
+}
+
+func TestTradeStore_Query(t *testing.T) {
+	open := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetClock(fixedClock{open})
+	placeOwnedOrder(t, eng, "a", "TEST", "alice", Sell, 100, 10)
+	placeOwnedOrder(t, eng, "b", "TEST", "bob", Buy, 100, 1)
+	eng.SetClock(fixedClock{open.Add(time.Minute)})
+	placeOwnedOrder(t, eng, "c", "TEST", "carol", Buy, 100, 2)
+	placeOwnedOrder(t, eng, "d", "TEST", "bob", Buy, 100, 3)
+
+	ids := func(trades []TradeRecord) []uint64 {
+		var ids []uint64
+		for _, trade := range trades {
+			ids = append(ids, trade.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, ids(eng.QueryTrades(TradeQuery{})))
+	assert.Equal(t, []uint64{1, 3}, ids(eng.QueryTrades(TradeQuery{Owner: "bob"})))
+	assert.Equal(t, []uint64{3}, ids(eng.QueryTrades(TradeQuery{Owner: "bob", Limit: 1})))
+	assert.Empty(t, eng.QueryTrades(TradeQuery{Ticker: "OTHER"}))
+
+	later := open.Add(time.Minute)
+	assert.Equal(t, []uint64{2, 3}, ids(eng.QueryTrades(TradeQuery{From: later})))
+	assert.Equal(t, []uint64{1}, ids(eng.QueryTrades(TradeQuery{To: later})))
+	assert.Empty(t, eng.QueryTrades(TradeQuery{From: later.Add(time.Hour)}))
+}
+
+func TestTradeStore_Dialect(t *testing.T) {
+	dialect, err := tradestore.DialectOf("sqlite3")
+	assert.NoError(t, err)
+	assert.Equal(t, tradestore.SQLite, dialect)
+	dialect, err = tradestore.DialectOf("pgx")
+	assert.NoError(t, err)
+	assert.Equal(t, tradestore.Postgres, dialect)
+	_, err = tradestore.DialectOf("mysql")
+	assert.ErrorIs(t, err, tradestore.ErrUnsupportedDriver)
+
+	_, err = tradestore.OpenSQL("mysql", "")
+	assert.ErrorIs(t, err, tradestore.ErrUnsupportedDriver)
+}
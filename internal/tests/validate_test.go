@@ -0,0 +1,50 @@
+package tests
+
+import (
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestValidate_NewOrder(t *testing.T) {
+	valid := fenrirNet.NewOrderMessage{
+		AssetType:   Equities,
+		OrderType:   LimitOrder,
+		Ticker:      "TEST",
+		LimitPrice:  100.0,
+		Quantity:    10,
+		Side:        Buy,
+		TimeInForce: Day,
+	}
+	assert.NoError(t, valid.Validate())
+
+	market := valid
+	market.OrderType = MarketOrder
+	market.LimitPrice = 0
+	assert.NoError(t, market.Validate(), "market orders carry no price")
+
+	tests := []struct {
+		name   string
+		modify func(*fenrirNet.NewOrderMessage)
+		err    error
+	}{
+		{"unknown asset", func(o *fenrirNet.NewOrderMessage) { o.AssetType = 7 }, fenrirNet.ErrUnknownAssetType},
+		{"invalid side", func(o *fenrirNet.NewOrderMessage) { o.Side = 2 }, fenrirNet.ErrInvalidSide},
+		{"invalid type", func(o *fenrirNet.NewOrderMessage) { o.OrderType = 5 }, fenrirNet.ErrInvalidOrderType},
+		{"invalid tif", func(o *fenrirNet.NewOrderMessage) { o.TimeInForce = 9 }, fenrirNet.ErrInvalidTimeInForce},
+		{"zero quantity", func(o *fenrirNet.NewOrderMessage) { o.Quantity = 0 }, fenrirNet.ErrZeroQuantity},
+		{"zero price", func(o *fenrirNet.NewOrderMessage) { o.LimitPrice = 0 }, fenrirNet.ErrInvalidPrice},
+		{"negative price", func(o *fenrirNet.NewOrderMessage) { o.LimitPrice = -1 }, fenrirNet.ErrInvalidPrice},
+		{"nan price", func(o *fenrirNet.NewOrderMessage) { o.LimitPrice = math.NaN() }, fenrirNet.ErrInvalidPrice},
+		{"infinite price", func(o *fenrirNet.NewOrderMessage) { o.LimitPrice = math.Inf(1) }, fenrirNet.ErrInvalidPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := valid
+			tt.modify(&order)
+			assert.ErrorIs(t, order.Validate(), tt.err)
+		})
+	}
+}
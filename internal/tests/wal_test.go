@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"errors"
+	. "fenrir/internal/common"
+	"fenrir/internal/engine"
+	"fenrir/internal/wal"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type failingJournal struct{}
+
+func (failingJournal) RecordCommand(Command) error {
+	return errors.New("disk full")
+}
+
+func TestWAL_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fenrir.wal")
+	for _, policy := range []wal.SyncPolicy{wal.SyncEveryCommand, wal.SyncInterval, wal.SyncNever} {
+		log, err := wal.Open(path, policy, time.Millisecond)
+		assert.NoError(t, err)
+		eng := engine.New(Equities)
+		eng.SetReporter(&MockReporter{})
+		eng.SetCommandJournal(log)
+
+		_, err = eng.Apply(placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}))
+		assert.NoError(t, err)
+		_, err = eng.Apply(placeCommand("b", "bob", Sell, 99, 4, CommandOrigin{Session: "bob", Sequence: 1}))
+		assert.NoError(t, err)
+		_, err = eng.Apply(Command{Type: AdminCancelSymbolCommand, Ticker: "TEST", Reason: AdminRiskBreach})
+		assert.NoError(t, err)
+		assert.NoError(t, log.Close())
+
+		// Only the latest run is read back, exactly as it was applied.
+		cmds, err := wal.Read(path)
+		assert.NoError(t, err)
+		assert.Len(t, cmds, 3)
+		assert.Equal(t, uint64(1), cmds[0].Sequence)
+		assert.Equal(t, CommandOrigin{Session: "bob", Sequence: 1}, cmds[1].Origin)
+		assert.Equal(t, "b", cmds[1].Orders[0].UUID)
+		assert.Equal(t, AdminCancelSymbolCommand, cmds[2].Type)
+		assert.Equal(t, AdminRiskBreach, cmds[2].Reason)
+
+		replayed := engine.New(Equities)
+		replayed.SetReporter(&MockReporter{})
+		n, err := replayed.Replay(cmds)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Len(t, replayed.Trades, 1)
+		assert.Empty(t, replayed.OpenOrders("alice"))
+	}
+
+	// A line cut short by a crash was never applied, so is dropped.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"command":{"Sequence":4,`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	cmds, err := wal.Read(path)
+	assert.NoError(t, err)
+	assert.Len(t, cmds, 3)
+
+	_, err = wal.ParseSyncPolicy("sometimes")
+	assert.ErrorIs(t, err, wal.ErrInvalidSyncPolicy)
+	_, err = wal.Open(path, wal.SyncInterval, 0)
+	assert.ErrorIs(t, err, wal.ErrInvalidSyncPolicy)
+}
+
+func TestWAL_RefusesUnjournaled(t *testing.T) {
+	eng := engine.New(Equities)
+	eng.SetReporter(&MockReporter{})
+	eng.SetCommandJournal(failingJournal{})
+
+	_, err := eng.Apply(placeCommand("a", "alice", Buy, 99, 10, CommandOrigin{Session: "alice", Sequence: 1}))
+	assert.ErrorIs(t, err, engine.ErrCommandNotJournaled)
+	assert.Empty(t, eng.OpenOrders("alice"))
+	assert.Zero(t, eng.ReplayMarkers().Sequence)
+}
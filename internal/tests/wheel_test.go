@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"fenrir/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimerWheel_FiresInOrder(t *testing.T) {
+	wheel := utils.NewTimerWheel(time.Millisecond)
+	var lock sync.Mutex
+	var fired []int
+	start := time.Now()
+	for i, d := range []time.Duration{30, 5, 70, 1} {
+		wheel.Schedule(d*time.Millisecond, func() {
+			// Never early.
+			assert.GreaterOrEqual(t, time.Since(start), d*time.Millisecond)
+			lock.Lock()
+			fired = append(fired, i)
+			lock.Unlock()
+		})
+	}
+	stopped := wheel.Schedule(10*time.Millisecond, func() { t.Error("stopped timer fired") })
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	assert.Eventually(t, func() bool { return wheel.Len() == 0 }, time.Second, time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []int{3, 1, 0, 2}, fired)
+}
+
+func TestTimerWheel_Cascades(t *testing.T) {
+	// Ticks short enough for most to start out on the upper levels.
+	wheel := utils.NewTimerWheel(time.Microsecond * 50)
+	var fired atomic.Int32
+	timers := make([]*utils.Timer, 0, 200000)
+	for i := range 200000 {
+		d := time.Duration(i%250) * time.Millisecond
+		timers = append(timers, wheel.Schedule(d, func() { fired.Add(1) }))
+	}
+	stopped := 0
+	for i := 0; i < len(timers); i += 2 {
+		if timers[i].Stop() {
+			stopped++
+		}
+	}
+
+	// Every timer either fired, or was stopped first.
+	assert.Eventually(t, func() bool { return wheel.Len() == 0 }, 5*time.Second, 5*time.Millisecond)
+	assert.Greater(t, stopped, 0)
+	assert.Equal(t, int32(len(timers)-stopped), fired.Load())
+
+	// Idle in between, a timer scheduled later is timed from then.
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	done := make(chan time.Duration, 1)
+	wheel.Schedule(20*time.Millisecond, func() { done <- time.Since(start) })
+	assert.GreaterOrEqual(t, <-done, 20*time.Millisecond)
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"encoding/binary"
+	. "fenrir/internal/common"
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"strings"
+	"testing"
+)
+
+// typedFrame is a frame of the given message type, its payload zeroed.
+func typedFrame(typeOf fenrirNet.MessageType, payload int) []byte {
+	frame := make([]byte, fenrirNet.BaseMessageHeaderLen+payload)
+	binary.BigEndian.PutUint16(frame, uint16(typeOf))
+	return frame
+}
+
+func TestWire_ReportRoundTrip(t *testing.T) {
+	report := fenrirNet.Report{
+		MessageType:    fenrirNet.DropCopyReport,
+		AssetType:      Equities,
+		Side:           Sell,
+		Timestamp:      42,
+		Quantity:       10,
+		Price:          100.25,
+		Ticker:         "AAPL",
+		UUID:           "0123456789abcdef",
+		QuantityScale:  2,
+		ClOrdID:        7,
+		PriceScale:     2,
+		TradeID:        3,
+		Liquidity:      LiquidityMaker,
+		LeavesQuantity: 5,
+		CumQuantity:    5,
+		OrderStatus:    OrderPartiallyFilled,
+		RejectReason:   RejectCreditLimit,
+		Err:            "over the limit",
+		Counterparty:   "bob",
+		Owner:          "alice",
+	}
+	buf, err := report.Serialize()
+	require.NoError(t, err)
+
+	// Lengths are those of the strings, whatever they were left as.
+	parsed, n, err := fenrirNet.ParseReport(append(buf, 0xff))
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	report.ErrStrLen, report.CounterpartyLen, report.OwnerLen = 14, 3, 5
+	assert.Equal(t, report, parsed)
+
+	// Cut short anywhere, it is refused rather than read past its end.
+	for i := range buf {
+		_, _, err := fenrirNet.ParseReport(buf[:i])
+		assert.ErrorIs(t, err, fenrirNet.ErrReportTooShort, "cut at %d", i)
+	}
+
+	// UUIDs and tickers of any length are sent padded or cut to theirs.
+	short := fenrirNet.Report{Ticker: "AAPL", UUID: "short"}
+	buf, err = short.Serialize()
+	require.NoError(t, err)
+	parsed, _, err = fenrirNet.ParseReport(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "short"+strings.Repeat("\x00", 11), parsed.UUID)
+}
+
+func TestWire_ReportLen(t *testing.T) {
+	report := fenrirNet.Report{MessageType: fenrirNet.ExecutionReport, Ticker: "AAPL", Err: "refused", Counterparty: "bob", Owner: "alice"}
+	execution, err := report.Serialize()
+	require.NoError(t, err)
+	ack := make([]byte, fenrirNet.OrderAckLen)
+	ack[0] = byte(fenrirNet.OrderAckReport)
+
+	// Reports are measured whole, and not until all of them is there.
+	for _, buf := range [][]byte{execution, ack} {
+		n, err := fenrirNet.ReportLen(append(buf, 0xff))
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		for i := range buf {
+			_, err := fenrirNet.ReportLen(buf[:i])
+			assert.ErrorIs(t, err, fenrirNet.ErrReportTooShort, "cut at %d", i)
+		}
+	}
+}
+
+func FuzzWire_ParseMessage(f *testing.F) {
+	for typeOf := fenrirNet.Heartbeat; typeOf <= fenrirNet.TradingPhaseOverride; typeOf++ {
+		f.Add(typedFrame(typeOf, 0))
+		f.Add(typedFrame(typeOf, 64))
+	}
+	f.Add(newOrderFrame("AAPL", Buy, 100, 10, 1))
+	f.Add([]byte{0})
+
+	var decoder fenrirNet.Decoder
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		message, err := decoder.Decode(frame)
+		if err != nil {
+			return
+		}
+		// Whatever is parsed is the type it said it was.
+		require.GreaterOrEqual(t, len(frame), fenrirNet.BaseMessageHeaderLen)
+		assert.Equal(t, fenrirNet.MessageType(binary.BigEndian.Uint16(frame)), message.GetType())
+	})
+}
+
+func FuzzWire_NewOrder(f *testing.F) {
+	f.Add(newOrderFrame("AAPL", Buy, 100, 10, 1)[fenrirNet.BaseMessageHeaderLen:])
+	f.Add(newOrderFrame("MSFT", Sell, math.Inf(1), math.MaxUint64, 0)[fenrirNet.BaseMessageHeaderLen:])
+	f.Add(make([]byte, fenrirNet.NewOrderMessageHeaderLen-1))
+
+	var decoder fenrirNet.Decoder
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		var m fenrirNet.NewOrderMessage
+		err := decoder.NewOrder(msg, &m)
+		if len(msg) < fenrirNet.NewOrderMessageHeaderLen {
+			assert.ErrorIs(t, err, fenrirNet.ErrMessageTooShort)
+			return
+		}
+		require.NoError(t, err)
+
+		// The fields are read from where they are sent.
+		frame := newOrderFrame(m.Ticker, m.Side, m.LimitPrice, m.Quantity, m.ClOrdID)[fenrirNet.BaseMessageHeaderLen:]
+		binary.BigEndian.PutUint16(frame[0:2], uint16(m.AssetType))
+		binary.BigEndian.PutUint16(frame[2:4], uint16(m.OrderType))
+		frame[25] = byte(m.TimeInForce)
+		binary.BigEndian.PutUint64(frame[26:34], m.ClientTimestamp)
+		assert.Equal(t, msg[:fenrirNet.NewOrderMessageHeaderLen], frame[:fenrirNet.NewOrderMessageHeaderLen])
+	})
+}
+
+func FuzzWire_CancelOrder(f *testing.F) {
+	cancel := make([]byte, fenrirNet.CancelOrderMessageHeaderLen)
+	copy(cancel[2:], "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	f.Add(cancel)
+	f.Add(make([]byte, fenrirNet.CancelOrderMessageHeaderLen))
+	f.Add(make([]byte, fenrirNet.CancelOrderMessageHeaderLen-1))
+
+	var decoder fenrirNet.Decoder
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		var m fenrirNet.CancelOrderMessage
+		err := decoder.CancelOrder(msg, &m)
+		if len(msg) < fenrirNet.CancelOrderMessageHeaderLen {
+			assert.ErrorIs(t, err, fenrirNet.ErrMessageTooShort)
+			return
+		}
+		require.NoError(t, err)
+
+		// Blank UUIDs are blank, whatever padding they were sent with.
+		assert.LessOrEqual(t, len(m.OrderUUID), fenrirNet.UUIDLen)
+		assert.False(t, strings.HasSuffix(m.OrderUUID, "\x00"))
+		assert.Equal(t, binary.BigEndian.Uint64(msg[2+fenrirNet.UUIDLen:]), m.ClOrdID)
+	})
+}
+
+func FuzzWire_Report(f *testing.F) {
+	f.Add(uint8(fenrirNet.ExecutionReport), "AAPL", "0123456789abcdef", 100.5, uint64(10), "", "bob", "")
+	f.Add(uint8(fenrirNet.DropCopyReport), "", "short", math.NaN(), uint64(0), "refused", "", "alice")
+	f.Add(uint8(fenrirNet.ErrorReport), "TOO LONG", strings.Repeat("u", 40), -1.0, uint64(math.MaxUint64), strings.Repeat("e", 300), "", strings.Repeat("o", 300))
+
+	f.Fuzz(func(t *testing.T, typeOf uint8, ticker, uuid string, price float64, qty uint64, errStr, counterparty, owner string) {
+		report := fenrirNet.Report{
+			MessageType:  fenrirNet.ReportMessageType(typeOf),
+			Ticker:       ticker,
+			UUID:         uuid,
+			Price:        price,
+			Quantity:     qty,
+			Err:          errStr,
+			Counterparty: counterparty,
+			Owner:        owner,
+		}
+		buf, err := report.Serialize()
+		require.NoError(t, err)
+		require.Equal(t, report.Len(), len(buf))
+
+		// What is sent reads back as it was, and is sent again the same.
+		parsed, n, err := fenrirNet.ParseReport(buf)
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		assert.Equal(t, math.Float64bits(price), math.Float64bits(parsed.Price))
+		assert.Equal(t, qty, parsed.Quantity)
+		assert.Equal(t, errStr, parsed.Err)
+		assert.Equal(t, counterparty[:min(len(counterparty), math.MaxUint16)], parsed.Counterparty)
+		assert.Equal(t, owner[:min(len(owner), math.MaxUint8)], parsed.Owner)
+		again, err := parsed.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, buf, again)
+	})
+}
+
+func FuzzWire_ParseReport(f *testing.F) {
+	report := fenrirNet.Report{MessageType: fenrirNet.ExecutionReport, Ticker: "AAPL", Err: "refused", Counterparty: "bob", Owner: "alice"}
+	buf, _ := report.Serialize()
+	f.Add(buf)
+	f.Add(buf[:fenrirNet.ReportFixedHeaderLen])
+	f.Add(make([]byte, fenrirNet.ReportFixedHeaderLen-1))
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		parsed, n, err := fenrirNet.ParseReport(buf)
+		if err != nil {
+			assert.ErrorIs(t, err, fenrirNet.ErrReportTooShort)
+			return
+		}
+		// Anything read is sent again the same, up to where it ended.
+		again, err := parsed.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, buf[:n], again)
+	})
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	fenrirNet "fenrir/internal/net"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestQueuedConn(t *testing.T) {
+	// Pipes block writes until they are read, as a client not reading would.
+	server, client := net.Pipe()
+	conn := fenrirNet.NewQueuedConn(server, 2)
+	for range 2 {
+		n, err := conn.Write([]byte("report"))
+		assert.NoError(t, err)
+		assert.Equal(t, 6, n)
+	}
+
+	// The writer may have taken the first off the queue, so one more could
+	// fit before the client is disconnected.
+	var err error
+	for range 2 {
+		if _, err = conn.Write([]byte("report")); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, fenrirNet.ErrWriteQueueFull)
+	_, err = conn.Write([]byte("report"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = io.ReadAll(client)
+	assert.NoError(t, err)
+}
+
+func TestQueuedConn_Close(t *testing.T) {
+	server, client := net.Pipe()
+	conn := fenrirNet.NewQueuedConn(server, fenrirNet.DefaultWriteQueueLen)
+
+	// Whatever was written before closing still reaches the client.
+	buf := []byte("bye")
+	_, err := conn.Write(buf)
+	assert.NoError(t, err)
+	copy(buf, "xxx")
+	assert.NoError(t, conn.Close())
+	read, err := io.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", string(read))
+}
+
+// BenchmarkQueuedConn_Write queues reports to a client keeping up with them,
+// the buffers they are queued in being reused once written.
+func BenchmarkQueuedConn_Write(b *testing.B) {
+	const window = fenrirNet.DefaultWriteQueueLen / 2
+	report := make([]byte, fenrirNet.ReportFixedHeaderLen)
+	server, client := net.Pipe()
+	read := make(chan struct{}, window)
+	go func() {
+		buf := make([]byte, len(report))
+		for {
+			if _, err := io.ReadFull(client, buf); err != nil {
+				return
+			}
+			read <- struct{}{}
+		}
+	}()
+	conn := fenrirNet.NewQueuedConn(server, fenrirNet.DefaultWriteQueueLen)
+	defer conn.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		// No more than window are ever waiting to be read.
+		if i >= window {
+			<-read
+		}
+		if _, err := conn.Write(report); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpTimeout is how long the collector is given to take each batch.
+const otlpTimeout = 10 * time.Second
+
+// ServiceName is what the exchange's spans are said to come from.
+const ServiceName = "fenrir"
+
+// OTLPExporter exports spans to an OpenTelemetry collector over OTLP/HTTP,
+// encoded as JSON rather than protobuf, which collectors take just the same.
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLP exports to the collector at address, e.g. http://localhost:4318,
+// posting to its /v1/traces endpoint.
+func NewOTLP(address string) *OTLPExporter {
+	return &OTLPExporter{
+		url:    strings.TrimRight(address, "/") + "/v1/traces",
+		client: &http.Client{Timeout: otlpTimeout},
+	}
+}
+
+// The layout of an OTLP export request, as the protobuf JSON mapping has it:
+// IDs in hex, 64 bit integers as strings and enums as numbers.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 2 for an error
+		Message string `json:"message,omitempty"`
+	}
+)
+
+func newOTLPRequest(spans []SpanData) otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		if span.ParentID != [8]byte{} {
+			encoded[i].ParentSpanID = hex.EncodeToString(span.ParentID[:])
+		}
+		for _, attribute := range span.Attributes {
+			encoded[i].Attributes = append(encoded[i].Attributes, newOTLPAttribute(attribute))
+		}
+		if span.Error != "" {
+			encoded[i].Status = &otlpStatus{Code: 2, Message: span.Error}
+		}
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{newOTLPAttribute(Attribute{Key: "service.name", Value: ServiceName})}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: ServiceName}, Spans: encoded}},
+	}}}
+}
+
+func newOTLPAttribute(attribute Attribute) otlpAttribute {
+	var value otlpValue
+	switch v := attribute.Value.(type) {
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		value.IntValue = &s
+	default:
+		s := fmt.Sprint(v)
+		value.StringValue = &s
+	}
+	return otlpAttribute{Key: attribute.Key, Value: value}
+}
+
+// Export sends spans to the collector in a single request.
+func (exporter *OTLPExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(newOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := exporter.client.Post(exporter.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp collector answered %s: %s", resp.Status, bytes.TrimSpace(reason))
+	}
+	return nil
+}
+
+func (exporter *OTLPExporter) Close() error {
+	exporter.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,295 @@
+// Package tracing follows messages through the exchange, from the socket they
+// are read off to the reports written back, as spans, so operators can see
+// where latency builds up. Spans are carried from one stage to the next in a
+// context.Context and exported in batches to an OpenTelemetry collector over
+// OTLP, see NewOTLP.
+//
+// A trace is started for only a sampled fraction of messages. Whether one is
+// sampled is decided on its trace ID, as OpenTelemetry's TraceIDRatioBased
+// sampler does, and every span within it goes with its root. Spans of traces
+// which are not sampled are nil, and every method of a nil Span or Tracer does
+// nothing, so what is traced costs next to nothing when tracing is off.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultBuffer is how many ended spans a Tracer holds waiting to be exported
+// by default.
+const DefaultBuffer = 16 * 1024
+
+// maxBatch is the most spans exported at once.
+const maxBatch = 512
+
+// Kind is the role of a span within its trace, as OpenTelemetry has it.
+type Kind int
+
+const (
+	Internal Kind = 1 // A stage of handling a message
+	Server   Kind = 2 // A message as a whole, from a client
+)
+
+// Attribute is a detail of what a span was of, e.g. the client it came from.
+// Values are strings or int64s.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is an ended span, as it is exported.
+type SpanData struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	ParentID   [8]byte // Zero for the root of a trace
+	Name       string
+	Kind       Kind
+	Start, End time.Time
+	Attributes []Attribute
+	Error      string // Empty if it succeeded
+}
+
+// An Exporter sends ended spans on to wherever they are collected. It is only
+// used from the tracer's own goroutine.
+type Exporter interface {
+	Export(spans []SpanData) error
+	Close() error
+}
+
+// Tracer starts traces, sampling a fraction of them, and exports their spans
+// in the background as they end, so nothing traced waits on the collector. If
+// the collector falls so far behind the buffer fills, spans are dropped. A nil
+// Tracer traces nothing.
+type Tracer struct {
+	exporter  Exporter
+	threshold uint64 // Traces whose IDs are below it are sampled
+	spans     chan SpanData
+	done      chan struct{}
+	dropped   atomic.Uint64 // Never exported, as the buffer was full or exporting failed
+
+	// Spans ended once closed, by whatever is still winding down, are dropped.
+	lock   sync.RWMutex
+	closed bool
+}
+
+// New traces a fraction, between 0 and 1, of what it is asked to, exporting
+// spans with exporter. Fractions outside that are taken as the nearest.
+func New(exporter Exporter, fraction float64, buffer int) *Tracer {
+	tracer := &Tracer{
+		exporter: exporter,
+		spans:    make(chan SpanData, buffer),
+		done:     make(chan struct{}),
+	}
+	switch threshold := math.Ldexp(fraction, 64); {
+	case threshold >= math.MaxUint64:
+		tracer.threshold = math.MaxUint64
+	case threshold > 0:
+		tracer.threshold = uint64(threshold)
+	}
+	go tracer.run()
+	return tracer
+}
+
+// Now is the time a span may later be started or ended at, or zero if tracing
+// is off, sparing the clock when it is.
+func (tracer *Tracer) Now() time.Time {
+	if tracer == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Start starts a trace at the time given, its root span named name, if it is
+// sampled. The span is carried in the context returned, for those of each
+// stage to be started within it. The span is nil if the trace is not sampled.
+func (tracer *Tracer) Start(ctx context.Context, name string, start time.Time) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	var span Span
+	for span.data.TraceID == [16]byte{} {
+		binary.BigEndian.PutUint64(span.data.TraceID[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(span.data.TraceID[8:], rand.Uint64())
+	}
+	// Sampled on the low half of the ID, so whoever has the ID would decide
+	// the same.
+	if lo := binary.BigEndian.Uint64(span.data.TraceID[8:]); lo >= tracer.threshold && tracer.threshold != math.MaxUint64 {
+		return ctx, nil
+	}
+	span.tracer = tracer
+	span.data.SpanID = newSpanID()
+	span.data.Name = name
+	span.data.Kind = Server
+	span.data.Start = start
+	return ContextWithSpan(ctx, &span), &span
+}
+
+// Dropped returns how many spans have not been exported.
+func (tracer *Tracer) Dropped() uint64 {
+	if tracer == nil {
+		return 0
+	}
+	return tracer.dropped.Load()
+}
+
+// Close exports whatever spans are still queued, then closes the exporter.
+// Spans ended after it is called are dropped.
+func (tracer *Tracer) Close() error {
+	if tracer == nil {
+		return nil
+	}
+	tracer.lock.Lock()
+	tracer.closed = true
+	close(tracer.spans)
+	tracer.lock.Unlock()
+
+	<-tracer.done
+	return tracer.exporter.Close()
+}
+
+func (tracer *Tracer) export(span SpanData) {
+	tracer.lock.RLock()
+	defer tracer.lock.RUnlock()
+	if tracer.closed {
+		tracer.dropped.Add(1)
+		return
+	}
+	select {
+	case tracer.spans <- span:
+	default:
+		tracer.dropped.Add(1)
+	}
+}
+
+func (tracer *Tracer) run() {
+	defer close(tracer.done)
+
+	batch := make([]SpanData, 0, maxBatch)
+	for span := range tracer.spans {
+		batch = append(batch[:0], span)
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case span, ok := <-tracer.spans:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, span)
+			default:
+				break drain
+			}
+		}
+
+		if err := tracer.exporter.Export(batch); err != nil {
+			tracer.dropped.Add(uint64(len(batch)))
+			log.Error().Err(err).Int("spans", len(batch)).Msg("unable to export spans")
+		}
+	}
+}
+
+// Span is a stage of handling a message, or the whole of it. It is exported
+// once ended. A span may be handed from one goroutine to another, but is not
+// safe for concurrent use.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span ctx carries, nil if none.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a span named name now, within the one ctx carries. See StartAt.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return StartAt(ctx, name, time.Now())
+}
+
+// StartAt starts a span named name at the time given, within the one ctx
+// carries, returning a copy of ctx carrying it in turn. If ctx carries none,
+// or its trace is not sampled, the span is nil.
+func StartAt(ctx context.Context, name string, start time.Time) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: parent.tracer}
+	span.data.TraceID = parent.data.TraceID
+	span.data.SpanID = newSpanID()
+	span.data.ParentID = parent.data.SpanID
+	span.data.Name = name
+	span.data.Kind = Internal
+	span.data.Start = start
+	return ContextWithSpan(ctx, span), span
+}
+
+// SetString records a string attribute of what span is of.
+func (span *Span) SetString(key, value string) {
+	if span != nil {
+		span.data.Attributes = append(span.data.Attributes, Attribute{Key: key, Value: value})
+	}
+}
+
+// SetInt records an integer attribute of what span is of.
+func (span *Span) SetInt(key string, value int64) {
+	if span != nil {
+		span.data.Attributes = append(span.data.Attributes, Attribute{Key: key, Value: value})
+	}
+}
+
+// SetError records that what span is of failed, if err is not nil.
+func (span *Span) SetError(err error) {
+	if span != nil && err != nil {
+		span.data.Error = err.Error()
+	}
+}
+
+// End ends span now. See EndAt.
+func (span *Span) End() {
+	span.EndAt(time.Now())
+}
+
+// EndAt ends span at the time given and has it exported. Only the first end
+// counts.
+func (span *Span) EndAt(end time.Time) {
+	if span == nil || span.ended {
+		return
+	}
+	span.ended = true
+	span.data.End = end
+	span.tracer.export(span.data)
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	for id == [8]byte{} {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
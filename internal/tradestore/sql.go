@@ -0,0 +1,216 @@
+package tradestore
+
+import (
+	"database/sql"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrUnsupportedDriver = errors.New("unsupported trade store driver")
+
+// Dialect is the flavour of SQL a database speaks.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+// DialectOf returns the dialect of a database/sql driver name.
+func DialectOf(driver string) (Dialect, error) {
+	switch driver {
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "pgx":
+		return Postgres, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnsupportedDriver, driver)
+}
+
+// placeholder returns the nth (from 1) query parameter.
+func (dialect Dialect) placeholder(n int) string {
+	if dialect == Postgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// The same schema works for both. Times are unix nanos, so they sort and
+// compare the same everywhere. Trade ids start over for an engine started
+// afresh, so do not identify a trade on their own.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS trades (
+		id             BIGINT NOT NULL,
+		ticker         TEXT NOT NULL,
+		ts             BIGINT NOT NULL,
+		price          DOUBLE PRECISION NOT NULL,
+		quantity       BIGINT NOT NULL,
+		aggressor      SMALLINT NOT NULL,
+		taker          TEXT NOT NULL,
+		taker_order    TEXT NOT NULL,
+		maker          TEXT NOT NULL,
+		maker_order    TEXT NOT NULL,
+		quantity_scale SMALLINT NOT NULL,
+		price_scale    SMALLINT NOT NULL,
+		trade_type     SMALLINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS trades_ticker_ts ON trades (ticker, ts)`,
+	`CREATE INDEX IF NOT EXISTS trades_taker_ts ON trades (taker, ts)`,
+	`CREATE INDEX IF NOT EXISTS trades_maker_ts ON trades (maker, ts)`,
+	`CREATE INDEX IF NOT EXISTS trades_ts ON trades (ts)`,
+}
+
+// addTradeType brings tables created before trades had a type up to date, their
+// trades all having been matched.
+const addTradeType = `ALTER TABLE trades ADD COLUMN trade_type SMALLINT NOT NULL DEFAULT 0`
+
+const columns = "id, ticker, ts, price, quantity, aggressor, taker, taker_order, maker, maker_order, quantity_scale, price_scale, trade_type"
+
+// SQLStore keeps trades in a SQLite or Postgres database.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	insert  string
+}
+
+// OpenSQL opens the database at dsn with the database/sql driver of that name,
+// which must be linked into the binary, creating the trades table if it is
+// not there yet.
+func OpenSQL(driver, dsn string) (*SQLStore, error) {
+	dialect, err := DialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open trade store: %w", err)
+	}
+	store, err := NewSQLStore(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLStore keeps trades in an already open database.
+func NewSQLStore(db *sql.DB, dialect Dialect) (*SQLStore, error) {
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("unable to create trades table: %w", err)
+		}
+	}
+	if _, err := db.Exec("SELECT trade_type FROM trades LIMIT 0"); err != nil {
+		if _, err := db.Exec(addTradeType); err != nil {
+			return nil, fmt.Errorf("unable to add trade types: %w", err)
+		}
+	}
+
+	params := make([]string, 13)
+	for i := range params {
+		params[i] = dialect.placeholder(i + 1)
+	}
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+		insert:  fmt.Sprintf("INSERT INTO trades (%s) VALUES (%s)", columns, strings.Join(params, ", ")),
+	}, nil
+}
+
+func (store *SQLStore) SaveTrades(trades []TradeRecord) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(store.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, trade := range trades {
+		_, err := stmt.Exec(
+			int64(trade.ID), trade.Ticker, trade.Timestamp.UnixNano(), trade.Price, int64(trade.Quantity),
+			int(trade.Aggressor), trade.Taker, trade.TakerOrder, trade.Maker, trade.MakerOrder,
+			int(trade.QuantityScale), int(trade.PriceScale), int(trade.Type),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (store *SQLStore) Trades(query TradeQuery) ([]TradeRecord, error) {
+	var where []string
+	var args []any
+	param := func(arg any) string {
+		args = append(args, arg)
+		return store.dialect.placeholder(len(args))
+	}
+	if query.Ticker != "" {
+		where = append(where, "ticker = "+param(query.Ticker))
+	}
+	if query.Owner != "" {
+		where = append(where, fmt.Sprintf("(taker = %s OR maker = %s)", param(query.Owner), param(query.Owner)))
+	}
+	if !query.From.IsZero() {
+		where = append(where, "ts >= "+param(query.From.UnixNano()))
+	}
+	if !query.To.IsZero() {
+		where = append(where, "ts < "+param(query.To.UnixNano()))
+	}
+
+	// Latest first so the limit keeps the latest, turned back round below.
+	statement := "SELECT " + columns + " FROM trades"
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	statement += " ORDER BY ts DESC, id DESC"
+	if query.Limit > 0 {
+		statement += " LIMIT " + param(query.Limit)
+	}
+
+	rows, err := store.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []TradeRecord
+	for rows.Next() {
+		var trade TradeRecord
+		var id, ts, quantity int64
+		var aggressor, quantityScale, priceScale, tradeType int
+		if err := rows.Scan(
+			&id, &trade.Ticker, &ts, &trade.Price, &quantity,
+			&aggressor, &trade.Taker, &trade.TakerOrder, &trade.Maker, &trade.MakerOrder,
+			&quantityScale, &priceScale, &tradeType,
+		); err != nil {
+			return nil, err
+		}
+		trade.ID = uint64(id)
+		trade.Timestamp = time.Unix(0, ts).UTC()
+		trade.Quantity = uint64(quantity)
+		trade.Aggressor = Side(aggressor)
+		trade.QuantityScale = uint8(quantityScale)
+		trade.PriceScale = uint8(priceScale)
+		trade.Type = TradeType(tradeType)
+		trades = append(trades, trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(trades)
+	return trades, nil
+}
+
+func (store *SQLStore) Close() error {
+	return store.db.Close()
+}
@@ -0,0 +1,116 @@
+// Package tradestore keeps every trade the engine makes for good, in a
+// database, so they need not all be kept in memory and can be looked back over
+// by symbol, owner and time.
+package tradestore
+
+import (
+	. "fenrir/internal/common"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultWriteBuffer is how many trades a Writer holds waiting to be saved by
+// default.
+const DefaultWriteBuffer = 64 * 1024
+
+// A Store keeps trades. It is used from several goroutines at once.
+type Store interface {
+	// SaveTrades keeps a batch of trades, all of them or none.
+	SaveTrades(trades []TradeRecord) error
+	// Trades returns those kept which match the query, earliest first.
+	Trades(query TradeQuery) ([]TradeRecord, error)
+	Close() error
+}
+
+// Writer saves trades to a store in the background, so matching never waits on
+// the database. Trades are saved in batches of whatever has built up while the
+// last batch was being saved. If the store falls so far behind the buffer
+// fills, trades are dropped rather than holding up matching, the audit trail
+// still has them.
+type Writer struct {
+	store   Store
+	trades  chan TradeRecord
+	done    chan struct{}
+	dropped atomic.Uint64 // Never saved, as the buffer was full or saving failed
+
+	// Trades recorded once closed, by whatever is still winding down, are
+	// dropped.
+	lock   sync.RWMutex
+	closed bool
+}
+
+func NewWriter(store Store, buffer int) *Writer {
+	w := &Writer{
+		store:  store,
+		trades: make(chan TradeRecord, buffer),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// RecordTrade queues a trade to be saved, see engine.TradeRecorder.
+func (w *Writer) RecordTrade(trade TradeRecord) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+	select {
+	case w.trades <- trade:
+	default:
+		w.dropped.Add(1)
+		log.Error().Uint64("tradeId", trade.ID).Msg("trade store behind, trade not saved")
+	}
+}
+
+// Trades queries the store, see Store.
+func (w *Writer) Trades(query TradeQuery) ([]TradeRecord, error) {
+	return w.store.Trades(query)
+}
+
+// Dropped returns how many trades have not been saved.
+func (w *Writer) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close saves whatever trades are still queued, then closes the store. Trades
+// recorded after it is called are dropped.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	w.closed = true
+	close(w.trades)
+	w.lock.Unlock()
+
+	<-w.done
+	return w.store.Close()
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	batch := make([]TradeRecord, 0, 1024)
+	for trade := range w.trades {
+		batch = append(batch[:0], trade)
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case trade, ok := <-w.trades:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, trade)
+			default:
+				break drain
+			}
+		}
+
+		if err := w.store.SaveTrades(batch); err != nil {
+			w.dropped.Add(uint64(len(batch)))
+			log.Error().Err(err).Int("trades", len(batch)).Msg("unable to save trades")
+		}
+	}
+}
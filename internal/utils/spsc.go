@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"sync/atomic"
+)
+
+// SPSCQueue is a bounded ring buffer for exactly one goroutine to push onto
+// and one to pop off. Neither side takes a lock: each only moves its own end
+// of the ring, and reads the other's atomically. A side waiting on the other,
+// for room or for an item, parks on a channel rather than spinning.
+type SPSCQueue[T any] struct {
+	items []T
+	mask  uint64
+	head  atomic.Uint64 // Next to pop, only moved by the consumer
+	tail  atomic.Uint64 // Next to push, only moved by the producer
+	ready chan struct{} // Signalled on push, for a consumer waiting on empty
+	room  chan struct{} // Signalled on pop, for a producer waiting on full
+}
+
+// NewSPSCQueue makes a queue holding capacity items, rounded up to a power of
+// two.
+func NewSPSCQueue[T any](capacity int) *SPSCQueue[T] {
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	return &SPSCQueue[T]{
+		items: make([]T, size),
+		mask:  uint64(size - 1),
+		ready: make(chan struct{}, 1),
+		room:  make(chan struct{}, 1),
+	}
+}
+
+// TryPush adds item unless the queue is full. Only the producer may push.
+func (queue *SPSCQueue[T]) TryPush(item T) bool {
+	tail := queue.tail.Load()
+	if tail-queue.head.Load() == uint64(len(queue.items)) {
+		return false
+	}
+	queue.items[tail&queue.mask] = item
+	queue.tail.Store(tail + 1)
+	signal(queue.ready)
+	return true
+}
+
+// Push adds item, waiting for room if the queue is full.
+func (queue *SPSCQueue[T]) Push(item T) {
+	for !queue.TryPush(item) {
+		<-queue.room
+	}
+}
+
+// TryPop takes the oldest item, unless the queue is empty. Only the consumer
+// may pop.
+func (queue *SPSCQueue[T]) TryPop() (T, bool) {
+	var zero T
+	head := queue.head.Load()
+	if head == queue.tail.Load() {
+		return zero, false
+	}
+	item := queue.items[head&queue.mask]
+	queue.items[head&queue.mask] = zero
+	queue.head.Store(head + 1)
+	signal(queue.room)
+	return item, true
+}
+
+// Pop takes the oldest item, waiting for one if the queue is empty. It gives
+// up once done is closed.
+func (queue *SPSCQueue[T]) Pop(done <-chan struct{}) (T, bool) {
+	for {
+		if item, ok := queue.TryPop(); ok {
+			return item, true
+		}
+		select {
+		case <-queue.ready:
+		case <-done:
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// Len returns how many items are queued. It is only a snapshot while the other
+// side is running.
+func (queue *SPSCQueue[T]) Len() int {
+	return int(queue.tail.Load() - queue.head.Load())
+}
+
+// signal wakes whoever is waiting on wake, if anyone is, without blocking.
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// The wheel has wheelLevels levels of wheelSlots slots each. A slot on level 0
+// is a single tick, a slot on each level above spans a whole turn of the level
+// below it. Timers further out than the top level spans are parked in its last
+// slot until they are close enough.
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 6
+	wheelSpan   = uint64(1) << (wheelBits * wheelLevels) // In ticks
+)
+
+// TimerWheel is a hierarchical timing wheel. Scheduling and stopping a timer
+// are constant time however many are pending, where a timer per pending
+// deadline costs the runtime a heap entry and a goroutine wake up each, so it
+// suits features with a deadline per order or session.
+//
+// Timers fire no earlier than asked, and up to a tick later. They fire on the
+// wheel's own goroutine, one after another, so should hand anything slow off
+// rather than hold up those behind them. The goroutine only runs while timers
+// are pending.
+type TimerWheel struct {
+	lock    sync.Mutex
+	tick    time.Duration
+	start   time.Time
+	now     uint64 // Ticks since start, every timer due by then has fired
+	slots   [wheelLevels][wheelSlots]list.List
+	pending int
+	running bool // Whether the goroutine advancing the wheel is
+}
+
+// Timer is a callback scheduled on a TimerWheel.
+type Timer struct {
+	wheel  *TimerWheel
+	expiry uint64 // Tick it is due on
+	fire   func()
+	slot   *list.List // Nil once fired or stopped
+	elem   *list.Element
+}
+
+func NewTimerWheel(tick time.Duration) *TimerWheel {
+	return &TimerWheel{
+		tick:  tick,
+		start: time.Now(),
+	}
+}
+
+// Schedule calls fire once d has passed, unless the timer is stopped first.
+func (wheel *TimerWheel) Schedule(d time.Duration, fire func()) *Timer {
+	wheel.lock.Lock()
+	defer wheel.lock.Unlock()
+
+	elapsed := time.Since(wheel.start)
+	if wheel.pending == 0 {
+		// Nothing has needed the wheel turning since it last stopped.
+		wheel.now = max(wheel.now, uint64(elapsed/wheel.tick))
+	}
+
+	// Rounded up, so the timer never fires early.
+	due := elapsed + max(d, 0)
+	expiry := uint64((due + wheel.tick - 1) / wheel.tick)
+	timer := &Timer{
+		wheel:  wheel,
+		expiry: max(expiry, wheel.now+1),
+		fire:   fire,
+	}
+	wheel.insert(timer)
+	wheel.pending++
+
+	if !wheel.running {
+		wheel.running = true
+		go wheel.run()
+	}
+	return timer
+}
+
+// Len returns how many timers are pending.
+func (wheel *TimerWheel) Len() int {
+	wheel.lock.Lock()
+	defer wheel.lock.Unlock()
+	return wheel.pending
+}
+
+// Stop prevents the timer from firing, returning false if it already has or
+// was already stopped.
+func (timer *Timer) Stop() bool {
+	wheel := timer.wheel
+	wheel.lock.Lock()
+	defer wheel.lock.Unlock()
+
+	if timer.slot == nil {
+		return false
+	}
+	timer.slot.Remove(timer.elem)
+	timer.slot = nil
+	wheel.pending--
+	return true
+}
+
+// insert files the timer under the slot covering its expiry, on the lowest
+// level which reaches that far.
+func (wheel *TimerWheel) insert(timer *Timer) {
+	delta := timer.expiry - wheel.now
+	at := timer.expiry
+	if delta >= wheelSpan {
+		at = wheel.now + wheelSpan - 1
+		delta = wheelSpan - 1
+	}
+
+	level := 0
+	for delta >= uint64(1)<<(wheelBits*(level+1)) {
+		level++
+	}
+	timer.slot = &wheel.slots[level][(at>>(wheelBits*level))&wheelMask]
+	timer.elem = timer.slot.PushBack(timer)
+}
+
+// run turns the wheel every tick, firing timers as they fall due, until none
+// are left.
+func (wheel *TimerWheel) run() {
+	ticker := time.NewTicker(wheel.tick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		due, more := wheel.advance(now)
+		for _, fire := range due {
+			fire()
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// advance turns the wheel up to now, returning the timers which fell due and
+// whether any are left pending.
+func (wheel *TimerWheel) advance(now time.Time) ([]func(), bool) {
+	wheel.lock.Lock()
+	defer wheel.lock.Unlock()
+
+	var due []func()
+	target := uint64(now.Sub(wheel.start) / wheel.tick)
+	for wheel.now < target && wheel.pending > 0 {
+		wheel.now++
+
+		// Each time a level comes back round, the next slot of the level above
+		// is close enough to be spread out over the levels below.
+		for level := 1; level < wheelLevels; level++ {
+			if wheel.now&(uint64(1)<<(wheelBits*level)-1) != 0 {
+				break
+			}
+			slot := &wheel.slots[level][(wheel.now>>(wheelBits*level))&wheelMask]
+			for slot.Len() > 0 {
+				wheel.insert(slot.Remove(slot.Front()).(*Timer))
+			}
+		}
+
+		slot := &wheel.slots[0][wheel.now&wheelMask]
+		for slot.Len() > 0 {
+			timer := slot.Remove(slot.Front()).(*Timer)
+			timer.slot = nil
+			wheel.pending--
+			due = append(due, timer.fire)
+		}
+	}
+	wheel.now = max(wheel.now, target)
+
+	if wheel.pending == 0 {
+		wheel.running = false
+	}
+	return due, wheel.running
+}
@@ -0,0 +1,150 @@
+// Package wal writes the write-ahead log of every command the engine applies,
+// the record recovery replays to rebuild the books after a crash.
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	. "fenrir/internal/common"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidSyncPolicy = errors.New("invalid wal sync policy")
+
+// SyncPolicy is how often the log is synced to disk. Commands are always
+// written before they are applied, so a crashed process never loses any, but
+// only those synced survive the machine going down with it.
+type SyncPolicy int
+
+const (
+	// Sync every command before it is applied. Nothing applied is ever lost,
+	// at the cost of a sync on the matching path.
+	SyncEveryCommand SyncPolicy = iota
+	// Sync in the background every interval. At most an interval of commands
+	// are lost.
+	SyncInterval
+	// Leave syncing to the operating system.
+	SyncNever
+)
+
+// ParseSyncPolicy reads a policy as given on the command line: "always",
+// "interval" or "never".
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return SyncEveryCommand, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidSyncPolicy, s)
+}
+
+// Log appends commands to a file as JSON lines, one command per line, in the
+// order they were applied. The file is only ever appended to.
+type Log struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	policy  SyncPolicy
+	dirty   bool // Written to since last synced
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// record is the layout of a single line of the file, either a command or the
+// start of a run.
+type record struct {
+	Start   string   `json:"start,omitempty"`
+	Command *Command `json:"command,omitempty"`
+}
+
+// Open appends to the log at path, creating it if needed. interval is how often
+// a SyncInterval log is synced.
+func Open(path string, policy SyncPolicy, interval time.Duration) (*Log, error) {
+	if policy == SyncInterval && interval <= 0 {
+		return nil, fmt.Errorf("%w: interval must be positive", ErrInvalidSyncPolicy)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{file: file, encoder: json.NewEncoder(file), policy: policy}
+	if err := l.encoder.Encode(record{Start: time.Now().UTC().Format(time.RFC3339Nano)}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if policy == SyncInterval {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.syncEvery(interval)
+	}
+	return l, nil
+}
+
+// RecordCommand writes the command to the file, and syncs it if the policy says
+// to, before the engine applies it. The engine refuses the command if it could
+// not be written.
+func (l *Log) RecordCommand(cmd Command) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err := l.encoder.Encode(record{Command: &cmd}); err != nil {
+		return err
+	}
+	if l.policy == SyncEveryCommand {
+		return l.file.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+// syncEvery syncs the file every interval, for as long as it is open.
+func (l *Log) syncEvery(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.sync(); err != nil {
+				log.Error().Err(err).Msg("unable to sync wal")
+			}
+		}
+	}
+}
+
+func (l *Log) sync() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	return l.file.Sync()
+}
+
+// Close syncs the file to disk and closes it.
+func (l *Log) Close() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
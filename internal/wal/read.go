@@ -0,0 +1,42 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	. "fenrir/internal/common"
+	"fmt"
+	"os"
+)
+
+// Read returns the commands of the latest run in the log at path, in the order
+// they were applied. Earlier runs in the same file are skipped. A last line cut
+// short by a crash mid-write is dropped, the command it held was never
+// applied.
+func Read(path string) ([]Command, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Only whole lines were written in full.
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		data = data[:i+1]
+	}
+
+	var cmds []Command
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		switch {
+		case rec.Start != "":
+			cmds = nil
+		case rec.Command != nil:
+			cmds = append(cmds, *rec.Command)
+		}
+	}
+	return cmds, scanner.Err()
+}